@@ -0,0 +1,635 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/apikey"
+	"github.com/epps11/goguard/internal/services/bundle"
+	"github.com/epps11/goguard/internal/services/netaccess"
+	"github.com/epps11/goguard/internal/services/policy"
+)
+
+const adminUsage = `Usage:
+  goguard admin policy list [-json]
+  goguard admin policy export [-o FILE]
+  goguard admin policy apply -f FILE [-dry-run] [-prune]
+  goguard admin user create -email EMAIL -name NAME [-role ROLE] [-groups G1,G2]
+  goguard admin apikey issue -name NAME [-role ROLE | -permissions P1,P2] [-user ID] [-expires-in-days N] [-allowed-cidrs C1,C2] [-llm-profile NAME]
+  goguard admin audit tail [-n N] [-user ID] [-status STATUS] [-event-types T1,T2] [-json]
+  goguard admin migrate [-overwrite]
+  goguard admin migrate -db [-f scripts/init.sql]
+
+Every command talks to a running instance through the control API, using
+-server and -api-key (default GOGUARD_SERVER and GOGUARD_API_KEY), or with
+-db works on the database directly, connecting with the GOGUARD_DB_*
+variables. Instances load policies and users from the database when they
+start, so restart them to pick up changes made with -db.
+
+migrate copies a running instance's in-memory policies, users and spending
+limits into its database. With -db it applies the schema script instead,
+when the database is behind this build.
+`
+
+// adminDialTimeout bounds connecting to the database in -db mode
+const adminDialTimeout = 10 * time.Second
+
+// adminPollInterval is how often audit tail -db checks for new entries
+const adminPollInterval = 2 * time.Second
+
+// runAdmin implements the admin subcommand and returns the exit code
+func runAdmin(args []string) int {
+	command, rest := adminCommand(args)
+	if command == "" {
+		fmt.Fprint(os.Stderr, adminUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("admin "+command, flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, adminUsage) }
+	server := fs.String("server", getEnv("GOGUARD_SERVER", "http://localhost:8080"), "GoGuard base URL")
+	apiKey := fs.String("api-key", os.Getenv("GOGUARD_API_KEY"), "API key with the permissions the command needs")
+	direct := fs.Bool("db", false, "work on the database directly instead of a running instance")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	output := fs.String("o", "", "policy export: write the bundle to this file instead of stdout")
+	file := fs.String("f", "", "policy apply: bundle file (- for stdin); migrate -db: schema script")
+	dryRun := fs.Bool("dry-run", false, "policy apply: show what would change without applying")
+	prune := fs.Bool("prune", false, "policy apply: delete policies that are not in the bundle")
+	email := fs.String("email", "", "user create: email address")
+	name := fs.String("name", "", "user create: display name; apikey issue: key name")
+	role := fs.String("role", "", "user create, apikey issue: role (users default to user)")
+	groups := fs.String("groups", "", "user create: comma-separated group IDs")
+	permissions := fs.String("permissions", "", "apikey issue: comma-separated permissions, instead of a role's")
+	userID := fs.String("user", "", "apikey issue: owning user ID; audit tail: only entries for this user ID")
+	expiresInDays := fs.Int("expires-in-days", 0, "apikey issue: days until the key expires (0 for never)")
+	allowedCIDRs := fs.String("allowed-cidrs", "", "apikey issue: comma-separated addresses or CIDR ranges the key may be used from")
+	llmProfile := fs.String("llm-profile", "", "apikey issue: LLM profile of the key's requests that don't name one")
+	lines := fs.Int("n", 10, "audit tail: number of past entries to print before following")
+	status := fs.String("status", "", "audit tail: only entries with this status")
+	eventTypes := fs.String("event-types", "", "audit tail: only these comma-separated event types")
+	overwrite := fs.Bool("overwrite", false, "migrate: replace rows that already exist in the database")
+	if err := fs.Parse(rest); err != nil {
+		return 2
+	}
+
+	a := &admin{
+		server: strings.TrimSuffix(*server, "/"),
+		apiKey: *apiKey,
+		http:   &http.Client{Timeout: 60 * time.Second},
+		json:   *asJSON,
+	}
+	if *direct {
+		// Services log as they work; only the command's own output is wanted
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+		ctx, cancel := context.WithTimeout(context.Background(), adminDialTimeout)
+		db, err := database.Connect(ctx, database.ConfigFromEnv())
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "admin %s: %v\n", command, err)
+			return 1
+		}
+		defer db.Close()
+		a.db = db
+		a.repo = database.NewRepository(db)
+	}
+
+	ctx := context.Background()
+	var err error
+	switch command {
+	case "policy list":
+		err = a.listPolicies(ctx)
+	case "policy export":
+		err = a.exportPolicies(ctx, *output)
+	case "policy apply":
+		if *file == "" {
+			fmt.Fprintln(os.Stderr, "admin policy apply: -f is required")
+			return 2
+		}
+		err = a.applyPolicies(ctx, *file, bundle.ApplyOptions{DryRun: *dryRun, Prune: *prune})
+	case "user create":
+		if *email == "" || *name == "" {
+			fmt.Fprintln(os.Stderr, "admin user create: -email and -name are required")
+			return 2
+		}
+		u := &models.User{
+			Email:  *email,
+			Name:   *name,
+			Role:   models.UserRole(getOr(*role, string(models.RoleUser))),
+			Groups: splitComma(*groups),
+			Status: "active",
+		}
+		err = a.createUser(ctx, u)
+	case "apikey issue":
+		if *name == "" {
+			fmt.Fprintln(os.Stderr, "admin apikey issue: -name is required")
+			return 2
+		}
+		if *role == "" && *permissions == "" {
+			fmt.Fprintln(os.Stderr, "admin apikey issue: -role or -permissions is required")
+			return 2
+		}
+		req := adminKeyRequest{
+			Name:          *name,
+			UserID:        *userID,
+			Role:          models.UserRole(*role),
+			Permissions:   splitComma(*permissions),
+			ExpiresInDays: *expiresInDays,
+			AllowedCIDRs:  splitComma(*allowedCIDRs),
+			LLMProfile:    *llmProfile,
+		}
+		err = a.issueKey(ctx, req)
+	case "audit tail":
+		filter := auditFilter{user: *userID, status: *status, eventTypes: *eventTypes}
+		err = a.tailAudit(ctx, filter, *lines)
+	case "migrate":
+		if *direct {
+			err = a.migrateSchema(ctx, getOr(*file, "scripts/init.sql"))
+		} else {
+			err = a.migrateState(*overwrite)
+		}
+	default:
+		fmt.Fprint(os.Stderr, adminUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "admin %s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// adminCommand splits the command, such as "policy list", from its flags
+func adminCommand(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	if args[0] == "migrate" {
+		return args[0], args[1:]
+	}
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return "", nil
+	}
+	return args[0] + " " + args[1], args[2:]
+}
+
+func getOr(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// admin runs admin commands against the control API, or against the
+// database when db is set
+type admin struct {
+	server string
+	apiKey string
+	http   *http.Client
+	json   bool
+
+	db   *database.DB
+	repo *database.Repository
+}
+
+// call sends a JSON request to the control API and decodes the response
+// into out, if given
+func (a *admin) call(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, a.server+"/api/v1/control"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.apiKey != "" {
+		req.Header.Set("X-API-Key", a.apiKey)
+	}
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s (HTTP %d)", apiErr.Error, resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unreadable response: %w", err)
+	}
+	return nil
+}
+
+func (a *admin) bundles() *bundleClient {
+	return &bundleClient{baseURL: a.server + "/api/v1/control/bundle", apiKey: a.apiKey, http: a.http}
+}
+
+// printJSON writes v indented to stdout
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// actor names who makes changes with -db, for policy versions and the
+// audit log
+func actor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// audit records a change made with -db. The server audits the changes made
+// through the API itself.
+func (a *admin) audit(ctx context.Context, entry *models.AuditLog) {
+	entry.UserID = actor()
+	entry.Status = models.AuditStatusSuccess
+	entry.Details = map[string]interface{}{"source": "goguard admin"}
+	if err := a.repo.CreateAuditLog(ctx, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write audit log: %v\n", err)
+	}
+}
+
+func (a *admin) listPolicies(ctx context.Context) error {
+	var policies []*models.Policy
+	if a.repo != nil {
+		var err error
+		if policies, err = a.repo.ListPolicies(ctx); err != nil {
+			return err
+		}
+	} else {
+		var page struct {
+			Policies []*models.Policy `json:"policies"`
+		}
+		if err := a.call(http.MethodGet, "/policies", nil, &page); err != nil {
+			return err
+		}
+		policies = page.Policies
+	}
+
+	if a.json {
+		return printJSON(policies)
+	}
+	slices.SortFunc(policies, func(x, y *models.Policy) int {
+		if x.Priority != y.Priority {
+			return x.Priority - y.Priority
+		}
+		return strings.Compare(x.Name, y.Name)
+	})
+	fmt.Printf("%-36s  %-8s  %-8s  %-16s  %-8s  %s\n", "ID", "PRIORITY", "VERSION", "TYPE", "STATUS", "NAME")
+	for _, p := range policies {
+		fmt.Printf("%-36s  %-8d  %-8d  %-16s  %-8s  %s\n", p.ID, p.Priority, p.Version, p.Type, p.Status, p.Name)
+	}
+	return nil
+}
+
+// engine returns a policy engine holding the database's policies and their
+// history, writing changes back to it, as a server started on it would
+func (a *admin) engine(ctx context.Context) (*policy.Engine, error) {
+	policies, err := a.repo.ListPolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+	versions, err := a.repo.ListPolicyVersions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policy versions: %w", err)
+	}
+
+	engine := policy.NewEngine()
+	engine.ImportState(&policy.State{Policies: policies, PolicyVersions: versions})
+	engine.SetStore(a.repo)
+	return engine, nil
+}
+
+func (a *admin) exportPolicies(ctx context.Context, output string) error {
+	if a.repo == nil {
+		return a.bundles().export(output)
+	}
+
+	engine, err := a.engine(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := bundle.NewService(engine, a.repo).Export(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := b.YAML()
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
+
+func (a *admin) applyPolicies(ctx context.Context, file string, opts bundle.ApplyOptions) error {
+	if a.repo == nil {
+		return a.bundles().apply(file, opts.DryRun, opts.Prune)
+	}
+
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	b, err := bundle.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	engine, err := a.engine(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = policy.WithActor(ctx, actor())
+	result, err := bundle.NewService(engine, a.repo).Apply(ctx, b, opts)
+	if result == nil {
+		return err
+	}
+	for _, change := range result.Changes {
+		fmt.Printf("%-10s %-15s %s\n", change.Action, change.Kind, change.Name)
+		if opts.DryRun || change.Kind != "policy" || change.Action == bundle.ActionUnchanged || change.ID == "" {
+			continue
+		}
+		entry := &models.AuditLog{
+			EventType:    models.EventTypePolicyChange,
+			Action:       "policy_" + change.Action,
+			ResourceType: "policy",
+			ResourceID:   change.ID,
+		}
+		if version, err := engine.LatestPolicyVersion(ctx, change.ID); err == nil {
+			entry.Action = "policy_" + string(version.ChangeType)
+		}
+		a.audit(ctx, entry)
+	}
+	if result.DryRun {
+		fmt.Println("(dry run - no changes applied)")
+	}
+	return err
+}
+
+func (a *admin) createUser(ctx context.Context, u *models.User) error {
+	if a.repo != nil {
+		if err := a.repo.CreateUser(ctx, u); err != nil {
+			return err
+		}
+		a.audit(ctx, &models.AuditLog{
+			EventType:    models.EventTypeUserAction,
+			Action:       "user_create",
+			ResourceType: "user",
+			ResourceID:   u.ID,
+		})
+	} else if err := a.call(http.MethodPost, "/users", u, u); err != nil {
+		return err
+	}
+
+	if a.json {
+		return printJSON(u)
+	}
+	fmt.Printf("Created user %s (%s, %s)\n", u.ID, u.Email, u.Role)
+	return nil
+}
+
+// adminKeyRequest mirrors the API key creation request of the control API
+type adminKeyRequest struct {
+	Name          string          `json:"name"`
+	UserID        string          `json:"user_id,omitempty"`
+	Role          models.UserRole `json:"role,omitempty"`
+	Permissions   []string        `json:"permissions,omitempty"`
+	ExpiresInDays int             `json:"expires_in_days,omitempty"`
+	AllowedCIDRs  []string        `json:"allowed_cidrs,omitempty"`
+	LLMProfile    string          `json:"llm_profile,omitempty"`
+}
+
+func (a *admin) issueKey(ctx context.Context, req adminKeyRequest) error {
+	var issued struct {
+		APIKey *models.APIKey `json:"api_key"`
+		Key    string         `json:"key"`
+	}
+	if a.repo != nil {
+		key, err := newAPIKey(req)
+		if err != nil {
+			return err
+		}
+		if issued.Key, err = apikey.NewService(a.repo).Create(ctx, key); err != nil {
+			return err
+		}
+		issued.APIKey = key
+		a.audit(ctx, &models.AuditLog{
+			EventType:    models.EventTypeUserAction,
+			Action:       "apikey_create",
+			ResourceType: "api_key",
+			ResourceID:   key.ID,
+		})
+	} else if err := a.call(http.MethodPost, "/api-keys", req, &issued); err != nil {
+		return err
+	}
+
+	if a.json {
+		return printJSON(issued)
+	}
+	fmt.Printf("Issued API key %s (%s)\n", issued.APIKey.ID, issued.APIKey.Name)
+	if issued.APIKey.ExpiresAt != nil {
+		fmt.Printf("Expires %s\n", issued.APIKey.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	fmt.Println(issued.Key)
+	fmt.Fprintln(os.Stderr, "The key is shown only once; store it now.")
+	return nil
+}
+
+// newAPIKey checks a key request as the control API does. Only the built-in
+// roles are known without a running instance; custom roles need -server.
+func newAPIKey(req adminKeyRequest) (*models.APIKey, error) {
+	if _, ok := auth.DefaultRolePermissions[string(req.Role)]; req.Role != "" && !ok {
+		return nil, fmt.Errorf("unknown role: %s (custom roles can only be granted through -server)", req.Role)
+	}
+	for _, p := range req.Permissions {
+		if perm := auth.Permission(p); perm != auth.PermAll && !slices.Contains(auth.AllPermissions, perm) {
+			return nil, fmt.Errorf("unknown permission: %s", p)
+		}
+	}
+	allowedNets, err := netaccess.ParsePrefixes(req.AllowedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.APIKey{
+		Name:        req.Name,
+		UserID:      req.UserID,
+		Role:        req.Role,
+		Permissions: req.Permissions,
+		LLMProfile:  req.LLMProfile,
+		CreatedBy:   actor(),
+	}
+	for _, n := range allowedNets {
+		key.AllowedCIDRs = append(key.AllowedCIDRs, n.String())
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	return key, nil
+}
+
+func (a *admin) tailAudit(ctx context.Context, filter auditFilter, n int) error {
+	printer := auditPrinter{json: a.json}
+	if a.repo == nil {
+		client := &auditClient{baseURL: a.server + "/api/v1/control", apiKey: a.apiKey, http: a.http}
+		return client.tail(filter, n, printer)
+	}
+
+	types := splitComma(filter.eventTypes)
+	matches := func(entry *models.AuditLog) bool {
+		return (filter.user == "" || entry.UserID == filter.user) &&
+			(filter.status == "" || string(entry.Status) == filter.status) &&
+			(len(types) == 0 || slices.Contains(types, string(entry.EventType)))
+	}
+
+	// Entries come newest first; printed ones are remembered by ID, since
+	// several can share the newest timestamp
+	var last time.Time
+	printed := make(map[string]bool)
+	for first := true; ; first = false {
+		entries, err := a.repo.ListAuditLogs(ctx, auditPageSize)
+		if err != nil {
+			return err
+		}
+		var fresh []*models.AuditLog
+		for _, entry := range entries {
+			if entry.Timestamp.Before(last) {
+				break
+			}
+			if !printed[entry.ID] && matches(entry) {
+				fresh = append(fresh, entry)
+			}
+		}
+		if first && len(fresh) > n {
+			fresh = fresh[:max(n, 0)]
+		}
+		for i := len(fresh) - 1; i >= 0; i-- {
+			if raw, err := json.Marshal(fresh[i]); err == nil {
+				printer.print(raw)
+			}
+		}
+
+		if len(entries) > 0 && entries[0].Timestamp.After(last) {
+			last = entries[0].Timestamp
+			clear(printed)
+		}
+		for _, entry := range entries {
+			if entry.Timestamp.Equal(last) {
+				printed[entry.ID] = true
+			}
+		}
+		time.Sleep(adminPollInterval)
+	}
+}
+
+// migrateSchema applies the schema script when the database is behind this
+// build. The script is idempotent, so a partly applied one is safe to rerun.
+func (a *admin) migrateSchema(ctx context.Context, script string) error {
+	version, err := a.db.SchemaVersion(ctx)
+	if err != nil && !errors.Is(err, database.ErrNoSchemaVersion) {
+		return err
+	}
+	if version >= database.CurrentSchemaVersion {
+		fmt.Printf("Schema is at version %d; nothing to do\n", version)
+		return nil
+	}
+
+	data, err := os.ReadFile(script)
+	if err != nil {
+		return fmt.Errorf("%w (point -f at scripts/init.sql from this release)", err)
+	}
+	if _, err := a.db.ExecContext(ctx, string(data)); err != nil {
+		return fmt.Errorf("applying %s: %w", script, err)
+	}
+
+	applied, err := a.db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if applied < database.CurrentSchemaVersion {
+		return fmt.Errorf("%s brought the schema to version %d, but this build needs %d", script, applied, database.CurrentSchemaVersion)
+	}
+	fmt.Printf("Schema migrated from version %d to %d\n", version, applied)
+	return nil
+}
+
+// migrateState has a running instance copy its in-memory state into the
+// database
+func (a *admin) migrateState(overwrite bool) error {
+	path := "/settings/storage/migrate"
+	if overwrite {
+		path += "?overwrite=true"
+	}
+	var result struct {
+		Imported        map[string]int `json:"imported"`
+		Skipped         map[string]int `json:"skipped"`
+		Conflicts       []string       `json:"conflicts,omitempty"`
+		RestartRequired bool           `json:"restart_required"`
+	}
+	if err := a.call(http.MethodPost, path, nil, &result); err != nil {
+		return err
+	}
+
+	if a.json {
+		return printJSON(result)
+	}
+	for _, kind := range []string{"users", "policies", "spending_limits"} {
+		fmt.Printf("%-16s imported %d, skipped %d\n", kind, result.Imported[kind], result.Skipped[kind])
+	}
+	for _, conflict := range result.Conflicts {
+		fmt.Println("Skipped " + conflict)
+	}
+	if result.RestartRequired {
+		fmt.Println("Restart the instance to serve from the database")
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const auditUsage = `Usage:
+  goguard audit tail [-user ID] [-status STATUS] [-event-types T1,T2] [-n N] [-json]
+  goguard audit grep PATTERN [-user ID] [-status STATUS] [-event-types T1,T2] [-since 24h] [-limit N] [-json]
+
+tail prints the last N matching audit entries, then follows new ones as
+they are logged. grep searches entries from the last -since for a regular
+expression, matched against each entry's JSON, newest first.
+
+Both take -server and -api-key, defaulting to GOGUARD_SERVER and
+GOGUARD_API_KEY. The key needs the audit:read permission.
+`
+
+// auditPageSize is how many entries grep fetches per request
+const auditPageSize = 200
+
+// auditReconnectDelay is how long tail waits before reopening a dropped stream
+const auditReconnectDelay = 2 * time.Second
+
+// auditEntry is the part of an audit log entry the CLI prints
+type auditEntry struct {
+	Timestamp    time.Time              `json:"timestamp"`
+	EventType    string                 `json:"event_type"`
+	Action       string                 `json:"action"`
+	UserID       string                 `json:"user_id"`
+	ResourceType string                 `json:"resource_type"`
+	ResourceID   string                 `json:"resource_id"`
+	RequestID    string                 `json:"request_id"`
+	Status       string                 `json:"status"`
+	Details      map[string]interface{} `json:"details"`
+}
+
+// runAudit implements the audit subcommand and returns the exit code
+func runAudit(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, auditUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("audit "+args[0], flag.ContinueOnError)
+	server := fs.String("server", getEnv("GOGUARD_SERVER", "http://localhost:8080"), "GoGuard base URL")
+	apiKey := fs.String("api-key", os.Getenv("GOGUARD_API_KEY"), "API key with audit:read permission")
+	user := fs.String("user", "", "only entries for this user ID")
+	status := fs.String("status", "", "only entries with this status (success, failure, blocked, warning)")
+	eventTypes := fs.String("event-types", "", "only these comma-separated event types")
+	asJSON := fs.Bool("json", false, "print entries as JSON lines")
+	lines := fs.Int("n", 10, "tail: number of past entries to print before following")
+	since := fs.Duration("since", 24*time.Hour, "grep: how far back to search")
+	limit := fs.Int("limit", 0, "grep: stop after this many matches (0 for all)")
+
+	// The pattern comes first, so parse the flags that follow it
+	rest := args[1:]
+	var pattern string
+	if args[0] == "grep" && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		pattern, rest = rest[0], rest[1:]
+	}
+	if err := fs.Parse(rest); err != nil {
+		return 2
+	}
+	if pattern == "" && fs.NArg() > 0 {
+		pattern = fs.Arg(0)
+	}
+
+	client := &auditClient{
+		baseURL: strings.TrimSuffix(*server, "/") + "/api/v1/control",
+		apiKey:  *apiKey,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+	filter := auditFilter{user: *user, status: *status, eventTypes: *eventTypes}
+	printer := auditPrinter{json: *asJSON}
+
+	var err error
+	switch args[0] {
+	case "tail":
+		err = client.tail(filter, *lines, printer)
+	case "grep":
+		if pattern == "" {
+			fmt.Fprintln(os.Stderr, "audit grep: a pattern is required")
+			return 2
+		}
+		re, compileErr := regexp.Compile(pattern)
+		if compileErr != nil {
+			fmt.Fprintf(os.Stderr, "audit grep: invalid pattern: %v\n", compileErr)
+			return 2
+		}
+		var matches int
+		matches, err = client.grep(filter, re, *since, *limit, printer)
+		if err == nil && matches == 0 {
+			return 1
+		}
+	default:
+		fmt.Fprint(os.Stderr, auditUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// auditFilter selects entries; the logs API applies all of it, the event
+// stream everything but the status
+type auditFilter struct {
+	user       string
+	status     string
+	eventTypes string
+}
+
+func (f auditFilter) query() url.Values {
+	query := url.Values{}
+	if f.user != "" {
+		query.Set("user_id", f.user)
+	}
+	if f.status != "" {
+		query.Set("status", f.status)
+	}
+	if f.eventTypes != "" {
+		query.Set("event_types", f.eventTypes)
+	}
+	return query
+}
+
+// auditPrinter writes entries as one line of text or JSON each
+type auditPrinter struct {
+	json bool
+}
+
+func (p auditPrinter) print(raw json.RawMessage) {
+	if p.json {
+		fmt.Println(string(raw))
+		return
+	}
+
+	var entry auditEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		fmt.Println(string(raw))
+		return
+	}
+	resource := entry.ResourceType
+	if entry.ResourceID != "" {
+		resource += "/" + entry.ResourceID
+	}
+	line := fmt.Sprintf("%s  %-8s %-15s %-20s %-20s %s",
+		entry.Timestamp.Local().Format("2006-01-02 15:04:05"),
+		entry.Status, entry.EventType, entry.Action, orDash(entry.UserID), resource)
+	if entry.RequestID != "" {
+		line += "  request=" + entry.RequestID
+	}
+	if reason, ok := entry.Details["reason"].(string); ok && reason != "" {
+		line += "  reason=" + strconv.Quote(reason)
+	}
+	fmt.Println(line)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+type auditClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func (c *auditClient) get(path string, query url.Values) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("%s (HTTP %d)", apiErr.Error, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// logsPage is a page of the audit logs API
+type logsPage struct {
+	Logs  []json.RawMessage `json:"logs"`
+	Total int               `json:"total"`
+}
+
+func (c *auditClient) logs(query url.Values) (*logsPage, error) {
+	resp, err := c.get("/audit/logs", query)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var page logsPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("unreadable response: %w", err)
+	}
+	return &page, nil
+}
+
+// grep pages through the entries logged in the last since, newest first, and
+// prints those whose JSON matches re. It returns the number of matches.
+func (c *auditClient) grep(filter auditFilter, re *regexp.Regexp, since time.Duration, limit int, printer auditPrinter) (int, error) {
+	// A fixed end keeps offsets stable while new entries are logged
+	now := time.Now().UTC()
+	query := filter.query()
+	query.Set("start_time", now.Add(-since).Format(time.RFC3339Nano))
+	query.Set("end_time", now.Format(time.RFC3339Nano))
+	query.Set("limit", strconv.Itoa(auditPageSize))
+
+	matches := 0
+	for offset := 0; ; offset += auditPageSize {
+		query.Set("offset", strconv.Itoa(offset))
+		page, err := c.logs(query)
+		if err != nil {
+			return matches, err
+		}
+		for _, raw := range page.Logs {
+			if !re.Match(raw) {
+				continue
+			}
+			printer.print(raw)
+			matches++
+			if limit > 0 && matches >= limit {
+				return matches, nil
+			}
+		}
+		if len(page.Logs) < auditPageSize || offset+len(page.Logs) >= page.Total {
+			return matches, nil
+		}
+	}
+}
+
+// tail prints the last n matching entries oldest first, then follows the
+// live event stream, reconnecting when it drops
+func (c *auditClient) tail(filter auditFilter, n int, printer auditPrinter) error {
+	if n > 0 {
+		query := filter.query()
+		query.Set("limit", strconv.Itoa(n))
+		page, err := c.logs(query)
+		if err != nil {
+			return err
+		}
+		for i := len(page.Logs) - 1; i >= 0; i-- {
+			printer.print(page.Logs[i])
+		}
+	}
+
+	query := url.Values{"kinds": {"audit"}}
+	if filter.user != "" {
+		query.Set("user_id", filter.user)
+	}
+	if filter.eventTypes != "" {
+		query.Set("event_types", filter.eventTypes)
+	}
+
+	// Streams stay open indefinitely, so the client timeout can't apply
+	c.http.Timeout = 0
+	for {
+		err := c.follow(query, filter.status, printer)
+		var fatal *fatalStreamError
+		if errors.As(err, &fatal) {
+			return fatal.err
+		}
+		fmt.Fprintf(os.Stderr, "audit tail: stream interrupted (%v), reconnecting\n", err)
+		time.Sleep(auditReconnectDelay)
+	}
+}
+
+// fatalStreamError is a stream failure that reconnecting won't fix
+type fatalStreamError struct {
+	err error
+}
+
+func (e *fatalStreamError) Error() string { return e.err.Error() }
+
+// follow prints audit events from the stream until it ends
+func (c *auditClient) follow(query url.Values, status string, printer auditPrinter) error {
+	resp, err := c.get("/events", query)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return err
+		}
+		return &fatalStreamError{err: err}
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if v, ok := strings.CutPrefix(line, "data:"); ok {
+				data.WriteString(strings.TrimPrefix(v, " "))
+			}
+			continue
+		}
+		if data.Len() == 0 {
+			continue
+		}
+
+		var event struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(data.String()), &event); err == nil && len(event.Data) > 0 {
+			var entry auditEntry
+			if status == "" || (json.Unmarshal(event.Data, &entry) == nil && entry.Status == status) {
+				printer.print(event.Data)
+			}
+		}
+		data.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const bundleUsage = `Usage:
+  goguard bundle export [-server URL] [-api-key KEY] [-o FILE]
+  goguard bundle apply -f FILE [-server URL] [-api-key KEY] [-dry-run] [-prune]
+
+Exports or applies a policy bundle (policies and spending limits as YAML)
+against a running GoGuard instance. The server and API key default to
+GOGUARD_SERVER and GOGUARD_API_KEY.
+`
+
+// runBundle implements the bundle subcommand and returns the exit code
+func runBundle(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, bundleUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("bundle "+args[0], flag.ContinueOnError)
+	server := fs.String("server", getEnv("GOGUARD_SERVER", "http://localhost:8080"), "GoGuard base URL")
+	apiKey := fs.String("api-key", os.Getenv("GOGUARD_API_KEY"), "API key with policy and spending permissions")
+	output := fs.String("o", "", "write the exported bundle to this file instead of stdout")
+	file := fs.String("f", "", "bundle file to apply (- for stdin)")
+	dryRun := fs.Bool("dry-run", false, "show what would change without applying")
+	prune := fs.Bool("prune", false, "delete policies that are not in the bundle")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	client := &bundleClient{
+		baseURL: strings.TrimSuffix(*server, "/") + "/api/v1/control/bundle",
+		apiKey:  *apiKey,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = client.export(*output)
+	case "apply":
+		if *file == "" {
+			fmt.Fprintln(os.Stderr, "bundle apply: -f is required")
+			return 2
+		}
+		err = client.apply(*file, *dryRun, *prune)
+	default:
+		fmt.Fprint(os.Stderr, bundleUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bundle %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// bundleResult mirrors the apply response of the bundle endpoint
+type bundleResult struct {
+	DryRun  bool `json:"dry_run"`
+	Changes []struct {
+		Kind   string `json:"kind"`
+		Name   string `json:"name"`
+		Action string `json:"action"`
+	} `json:"changes"`
+}
+
+type bundleClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func (c *bundleClient) do(method, target string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/yaml")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return data, fmt.Errorf("%s (HTTP %d)", apiErr.Error, resp.StatusCode)
+		}
+		return data, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+func (c *bundleClient) export(output string) error {
+	data, err := c.do(http.MethodGet, c.baseURL, nil)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(output, data, 0644)
+}
+
+func (c *bundleClient) apply(file string, dryRun, prune bool) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	if prune {
+		query.Set("prune", "true")
+	}
+	target := c.baseURL
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	body, err := c.do(http.MethodPost, target, bytes.NewReader(data))
+
+	// Partial results are returned alongside errors, so print what we have
+	var result struct {
+		bundleResult
+		Result *bundleResult `json:"result"`
+	}
+	if json.Unmarshal(body, &result) == nil {
+		changes := result.Changes
+		if result.Result != nil {
+			changes = result.Result.Changes
+		}
+		for _, change := range changes {
+			fmt.Printf("%-10s %-15s %s\n", change.Action, change.Kind, change.Name)
+		}
+		if result.DryRun {
+			fmt.Println("(dry run - no changes applied)")
+		}
+	}
+	return err
+}
+
+func getEnv(key, defaultValue string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return defaultValue
+}
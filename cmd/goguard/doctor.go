@@ -0,0 +1,599 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/secretstore"
+	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/epps11/goguard/internal/services/secrets"
+)
+
+const doctorUsage = `Usage:
+  goguard doctor [-config FILE] [-cert FILE,...] [-clock-url URL] [-skip CHECKS] [-timeout 10s] [-json]
+
+Checks that this environment is ready to run GoGuard: configuration and
+environment variables, database connectivity and schema version, LLM
+provider credentials, pattern compilation, clock skew and the expiry of
+TLS certificates for the endpoints GoGuard calls and any -cert files.
+
+Each check prints PASS, WARN, FAIL or SKIP. The exit code is 1 if any
+check fails. -skip takes comma-separated check names: secrets, config,
+database, llm, patterns, clock, tls.
+`
+
+// certExpiryWarning is how close to expiry a certificate gets a warning
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// clockSkewWarning is the skew worth a warning even within the JWT leeway;
+// Date headers have whole-second precision
+const clockSkewWarning = 5 * time.Second
+
+// minJWTSecretLength is the shortest HMAC secret not reported as weak
+const minJWTSecretLength = 32
+
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// checkResult is one line of the doctor report
+type checkResult struct {
+	Check  string `json:"check"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// doctor runs the checks against a loaded configuration
+type doctor struct {
+	cfg      *config.Config
+	timeout  time.Duration
+	certs    []string
+	clockURL string
+	results  []checkResult
+}
+
+// runDoctor implements the doctor subcommand and returns the exit code
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, doctorUsage) }
+	configPath := fs.String("config", "", "Path to configuration file")
+	certs := fs.String("cert", "", "comma-separated PEM certificate files to check for expiry")
+	clockURL := fs.String("clock-url", "", "HTTPS URL whose Date header the clock is compared with (default: the LLM endpoint)")
+	skip := fs.String("skip", "", "comma-separated checks to skip")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for each network check")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "doctor: failed to load configuration: %v\n", err)
+		return 1
+	}
+
+	// Services log while they start; the report is the only output wanted
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+
+	d := &doctor{cfg: cfg, timeout: *timeout, certs: splitComma(*certs), clockURL: *clockURL}
+	checks := []struct {
+		name string
+		run  func()
+	}{
+		{"secrets", d.checkSecrets},
+		{"config", d.checkConfig},
+		{"database", d.checkDatabase},
+		{"llm", d.checkProviders},
+		{"patterns", d.checkPatterns},
+		{"clock", d.checkClock},
+		{"tls", d.checkCertificates},
+	}
+	skipped := make(map[string]bool)
+	for _, name := range splitComma(*skip) {
+		skipped[name] = true
+	}
+	for _, c := range checks {
+		if skipped[c.name] {
+			d.add(c.name, c.name, checkSkip, "skipped with -skip")
+			continue
+		}
+		c.run()
+	}
+
+	failed := d.print(*asJSON)
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func (d *doctor) add(check, name, status, detail string) {
+	d.results = append(d.results, checkResult{Check: check, Name: name, Status: status, Detail: detail})
+}
+
+// print writes the report and reports whether any check failed
+func (d *doctor) print(asJSON bool) bool {
+	counts := make(map[string]int)
+	for _, r := range d.results {
+		counts[r.Status]++
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(map[string]interface{}{"checks": d.results, "ready": counts[checkFail] == 0})
+		return counts[checkFail] > 0
+	}
+
+	for _, r := range d.results {
+		fmt.Printf("%-5s %-28s %s\n", r.Status, r.Name, r.Detail)
+	}
+	fmt.Printf("\n%d passed, %d warnings, %d failed, %d skipped\n",
+		counts[checkPass], counts[checkWarn], counts[checkFail], counts[checkSkip])
+	if counts[checkFail] > 0 {
+		fmt.Println("Not ready for production: fix the failed checks above.")
+	}
+	return counts[checkFail] > 0
+}
+
+// checkSecrets resolves the secret:// references in the configuration, so
+// the checks after it see the secrets
+func (d *doctor) checkSecrets() {
+	refs := secretstore.References(d.cfg)
+	if len(refs) == 0 {
+		return
+	}
+	fields := make([]string, 0, len(refs))
+	for field := range refs {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	store := secretstore.NewStore(d.cfg.SecretStore)
+	for _, field := range fields {
+		if _, err := store.Resolve(ctx, refs[field]); err != nil {
+			d.add("secrets", field, checkFail, err.Error())
+		} else {
+			d.add("secrets", field, checkPass, "resolved "+refs[field])
+		}
+	}
+	// Failures were reported above; resolving again only fills in the rest
+	secretstore.ResolveConfig(ctx, store, d.cfg)
+}
+
+// checkConfig reports settings and environment variables that are missing
+// or unsafe in production
+func (d *doctor) checkConfig() {
+	cfg := d.cfg
+
+	if cfg.Server.Mode == "release" {
+		d.add("config", "server mode", checkPass, "release")
+	} else {
+		d.add("config", "server mode", checkWarn, fmt.Sprintf("%s; set GOGUARD_MODE=release in production", cfg.Server.Mode))
+	}
+	if cfg.Server.FaultInjectionEnabled() {
+		d.add("config", "fault injection", checkFail, "enabled; guard requests can simulate LLM failures")
+	}
+
+	if cfg.LLM.APIKey != "" || cfg.LLM.Provider == "ollama" {
+		d.add("config", "GOGUARD_LLM_API_KEY", checkPass, "set")
+	} else {
+		d.add("config", "GOGUARD_LLM_API_KEY", checkWarn, "not set; requests are only forwarded with dashboard or per-request credentials")
+	}
+
+	if !cfg.Auth.Enabled {
+		d.add("config", "GOGUARD_AUTH_ENABLED", checkFail, "control plane authentication is off")
+	} else if cfg.JWT.Secret == "" && len(cfg.JWT.SigningKeys) == 0 && len(cfg.Auth.TrustedIssuers) == 0 && cfg.Auth.BootstrapAPIKey == "" {
+		d.add("config", "GOGUARD_AUTH_ENABLED", checkFail, "on, but no JWT secret, signing key, trusted issuer or bootstrap API key is configured")
+	} else {
+		d.add("config", "GOGUARD_AUTH_ENABLED", checkPass, "control plane requires credentials")
+	}
+	if cfg.Auth.Enabled && !cfg.Auth.RequireDataPlane {
+		d.add("config", "GOGUARD_AUTH_REQUIRE_DATA_PLANE", checkWarn, "guard requests are accepted without credentials")
+	}
+
+	switch {
+	case cfg.JWT.Secret == "":
+		if len(cfg.JWT.SigningKeys) > 0 {
+			d.add("config", "GOGUARD_JWT_SECRET", checkPass, "not set; tokens are signed with signing keys")
+		} else if len(cfg.Auth.TrustedIssuers) > 0 {
+			d.add("config", "GOGUARD_JWT_SECRET", checkPass, "not set; tokens come from trusted issuers")
+		} else {
+			d.add("config", "GOGUARD_JWT_SECRET", checkWarn, "not set; dashboard logins can't be issued")
+		}
+	case len(cfg.JWT.Secret) < minJWTSecretLength:
+		d.add("config", "GOGUARD_JWT_SECRET", checkWarn, fmt.Sprintf("only %d characters; use at least %d", len(cfg.JWT.Secret), minJWTSecretLength))
+	default:
+		d.add("config", "GOGUARD_JWT_SECRET", checkPass, "set")
+	}
+
+	if len(cfg.JWT.SigningKeys) > 0 {
+		if tokens, err := auth.NewTokenIssuer(cfg.JWT, auth.JWTValidation{}, nil); err != nil {
+			d.add("config", "jwt.signing_keys", checkFail, err.Error())
+		} else {
+			d.add("config", "jwt.signing_keys", checkPass, fmt.Sprintf("%d key(s) published at /.well-known/jwks.json", len(tokens.JWKS().Keys)))
+		}
+	}
+	if cfg.Auth.BootstrapAPIKey == config.DevAPIKey {
+		d.add("config", "GOGUARD_BOOTSTRAP_API_KEY", checkFail, "is the public dev mode key")
+	}
+	if !cfg.Auth.Session.CookieSecure {
+		d.add("config", "session cookie", checkWarn, "cookie_secure is off; session cookies are sent over plain HTTP")
+	}
+	if envelope, err := secretstore.NewEnvelope(cfg.Encryption, cfg.SecretStore.AWS); err != nil {
+		d.add("config", "GOGUARD_MASTER_KEY", checkFail, err.Error())
+	} else if !envelope.Enabled() {
+		d.add("config", "GOGUARD_MASTER_KEY", checkWarn, "not set; API keys saved in the dashboard are stored unencrypted")
+	} else {
+		d.add("config", "GOGUARD_MASTER_KEY", checkPass, "set, key "+envelope.KeyID())
+	}
+	if cfg.Notify.SMTP.Host != "" && cfg.Notify.SMTP.Password == "" {
+		d.add("config", "GOGUARD_SMTP_PASSWORD", checkWarn, "SMTP host is set without a password")
+	}
+
+	if os.Getenv("GOGUARD_DB_PASSWORD") == "" {
+		d.add("config", "GOGUARD_DB_PASSWORD", checkWarn, "not set; the default password is used")
+	} else if os.Getenv("GOGUARD_DB_PASSWORD") == database.DefaultPassword {
+		d.add("config", "GOGUARD_DB_PASSWORD", checkWarn, "is the default password")
+	} else {
+		d.add("config", "GOGUARD_DB_PASSWORD", checkPass, "set")
+	}
+}
+
+// checkDatabase connects once and compares the schema version with the one
+// this build expects
+func (d *doctor) checkDatabase() {
+	dbCfg := database.ConfigFromEnv()
+	target := fmt.Sprintf("%s@%s:%s/%s", dbCfg.User, dbCfg.Host, dbCfg.Port, dbCfg.DBName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	db, err := database.Connect(ctx, dbCfg)
+	if err != nil {
+		d.add("database", "database connection", checkFail, fmt.Sprintf("%s: %v", target, err))
+		return
+	}
+	defer db.Close()
+	d.add("database", "database connection", checkPass, target)
+
+	if dbCfg.SSLMode == "disable" && !isLocalHost(dbCfg.Host) {
+		d.add("database", "database TLS", checkWarn, "GOGUARD_DB_SSLMODE=disable for a remote database")
+	}
+
+	version, err := db.SchemaVersion(ctx)
+	switch {
+	case errors.Is(err, database.ErrNoSchemaVersion):
+		d.add("database", "schema version", checkFail, "no schema_version table; the schema predates this build, apply scripts/init.sql")
+	case err != nil:
+		d.add("database", "schema version", checkFail, err.Error())
+	case version < database.CurrentSchemaVersion:
+		d.add("database", "schema version", checkFail, fmt.Sprintf("%d, this build needs %d; apply scripts/init.sql", version, database.CurrentSchemaVersion))
+	case version > database.CurrentSchemaVersion:
+		d.add("database", "schema version", checkWarn, fmt.Sprintf("%d is newer than this build's %d", version, database.CurrentSchemaVersion))
+	default:
+		d.add("database", "schema version", checkPass, fmt.Sprintf("%d", version))
+	}
+}
+
+// checkProviders validates the credentials of the default LLM and each
+// configured profile with a minimal completion request
+func (d *doctor) checkProviders() {
+	targets := map[string]config.LLMConfig{"default": d.cfg.LLM}
+	for name, profile := range d.cfg.LLM.Profiles {
+		targets[name] = profile
+	}
+
+	for _, name := range sortedKeys(targets) {
+		cfg := targets[name]
+		check := "llm " + name
+		if cfg.APIKey == "" && cfg.Provider != "ollama" {
+			d.add("llm", check, checkSkip, "no API key configured")
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		err := llm.ValidateConfig(ctx, cfg)
+		cancel()
+		if err != nil {
+			d.add("llm", check, checkFail, fmt.Sprintf("%s/%s: %v", cfg.Provider, cfg.Model, err))
+		} else {
+			d.add("llm", check, checkPass, fmt.Sprintf("%s/%s accepted the key", cfg.Provider, cfg.Model))
+		}
+	}
+}
+
+// checkPatterns compiles configured patterns. The detector drops custom
+// injection patterns that don't compile, so a typo silently disables them.
+func (d *doctor) checkPatterns() {
+	var invalid []string
+	for _, p := range d.cfg.Security.InjectionPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q: %v", p, err))
+		}
+	}
+	if len(invalid) > 0 {
+		d.add("patterns", "injection patterns", checkFail, strings.Join(invalid, "; "))
+	} else {
+		d.add("patterns", "injection patterns", checkPass, fmt.Sprintf("%d custom patterns compile", len(d.cfg.Security.InjectionPatterns)))
+	}
+
+	known := make(map[string]bool)
+	for _, t := range pii.NewMasker(d.cfg.PII.PIITypes, d.cfg.PII.MaskCharacter, false, true).Types() {
+		known[t] = true
+	}
+	var unknown []string
+	for _, t := range d.cfg.PII.PIITypes {
+		if !known[t] {
+			unknown = append(unknown, t)
+		}
+	}
+	if len(unknown) > 0 {
+		d.add("patterns", "PII types", checkFail, "unknown types are not detected: "+strings.Join(unknown, ", "))
+	} else {
+		d.add("patterns", "PII types", checkPass, strings.Join(d.cfg.PII.PIITypes, ", "))
+	}
+	if len(d.cfg.PII.Locales) > 0 {
+		if _, err := pii.WithLocales(d.cfg.PII.PIITypes, d.cfg.PII.Locales); err != nil {
+			d.add("patterns", "PII locales", checkFail, err.Error())
+		} else {
+			d.add("patterns", "PII locales", checkPass, strings.Join(d.cfg.PII.Locales, ", "))
+		}
+	}
+	switch d.cfg.PII.Mode {
+	case "", pii.ModeMask:
+	case pii.ModePseudonymize:
+		if d.cfg.PII.PseudonymKey == "" {
+			d.add("patterns", "PII mode", checkWarn, "pseudonymize without GOGUARD_PII_PSEUDONYM_KEY; pseudonyms change on every restart")
+		} else {
+			d.add("patterns", "PII mode", checkPass, "pseudonymize")
+		}
+	default:
+		d.add("patterns", "PII mode", checkFail, fmt.Sprintf("unknown mode %q; PII is masked", d.cfg.PII.Mode))
+	}
+
+	if !d.cfg.Secrets.Enabled {
+		d.add("patterns", "secret types", checkWarn, "secret detection is off; credentials in prompts reach the provider")
+		return
+	}
+	unknown = nil
+	for _, t := range d.cfg.Secrets.Types {
+		if !slices.Contains(secrets.Types(), t) {
+			unknown = append(unknown, t)
+		}
+	}
+	types := strings.Join(d.cfg.Secrets.Types, ", ")
+	if types == "" {
+		types = "all types"
+	}
+	if len(unknown) > 0 {
+		d.add("patterns", "secret types", checkFail, "unknown types are not detected: "+strings.Join(unknown, ", "))
+	} else {
+		d.add("patterns", "secret types", checkPass, types+", action "+d.cfg.Secrets.Action)
+	}
+}
+
+// checkClock compares the local clock with the Date header of an HTTPS
+// server. Token expiry checks fail once skew exceeds the JWT leeway.
+func (d *doctor) checkClock() {
+	target := d.clockURL
+	if target == "" {
+		target = llm.BaseURL(d.cfg.LLM)
+	}
+	if target == "" || !strings.HasPrefix(target, "https://") {
+		d.add("clock", "clock skew", checkSkip, "no HTTPS reference; pass -clock-url")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		d.add("clock", "clock skew", checkFail, err.Error())
+		return
+	}
+	sent := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		d.add("clock", "clock skew", checkWarn, fmt.Sprintf("couldn't reach %s: %v", target, err))
+		return
+	}
+	resp.Body.Close()
+	received := time.Now()
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.add("clock", "clock skew", checkWarn, fmt.Sprintf("%s sent no usable Date header", target))
+		return
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	// Date headers are truncated to the second
+	if skew < time.Second {
+		skew = 0
+	}
+
+	detail := fmt.Sprintf("%s off %s (JWT leeway %s)", skew.Round(time.Second), hostOf(target), d.cfg.JWT.Leeway)
+	switch {
+	case skew > d.cfg.JWT.Leeway:
+		d.add("clock", "clock skew", checkFail, detail)
+	case skew > clockSkewWarning:
+		d.add("clock", "clock skew", checkWarn, detail)
+	default:
+		d.add("clock", "clock skew", checkPass, detail)
+	}
+}
+
+// checkCertificates checks the TLS certificates of the HTTPS endpoints
+// GoGuard calls, the configured certificate files and the -cert files
+func (d *doctor) checkCertificates() {
+	certs := d.certs
+	for _, path := range []string{d.cfg.Server.TLS.CertFile, d.cfg.Server.TLS.ClientCAFile, d.cfg.LLM.TLS.CertFile, d.cfg.LLM.TLS.CAFile} {
+		if path != "" && !slices.Contains(certs, path) {
+			certs = append(certs, path)
+		}
+	}
+	for _, path := range certs {
+		d.checkCertFile(path)
+	}
+
+	endpoints := d.tlsEndpoints()
+	if len(endpoints) == 0 && len(certs) == 0 {
+		d.add("tls", "certificates", checkSkip, "no HTTPS endpoints configured; pass -cert to check certificate files")
+		return
+	}
+	for _, addr := range endpoints {
+		dialer := &net.Dialer{Timeout: d.timeout}
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{})
+		if err != nil {
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				d.add("tls", "tls "+addr, checkFail, err.Error())
+			} else {
+				d.add("tls", "tls "+addr, checkWarn, fmt.Sprintf("couldn't connect: %v", err))
+			}
+			continue
+		}
+		certs := conn.ConnectionState().PeerCertificates
+		conn.Close()
+		if len(certs) == 0 {
+			d.add("tls", "tls "+addr, checkFail, "no certificate presented")
+			continue
+		}
+		d.addExpiry("tls "+addr, certs[0])
+	}
+}
+
+func (d *doctor) checkCertFile(path string) {
+	name := "cert " + path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		d.add("tls", name, checkFail, err.Error())
+		return
+	}
+	// Key files often hold the key first; the leaf is the first certificate
+	block, rest := pem.Decode(data)
+	for block != nil && block.Type != "CERTIFICATE" {
+		block, rest = pem.Decode(rest)
+	}
+	if block == nil {
+		d.add("tls", name, checkFail, "no PEM certificate found")
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		d.add("tls", name, checkFail, err.Error())
+		return
+	}
+	d.addExpiry(name, cert)
+}
+
+func (d *doctor) addExpiry(name string, cert *x509.Certificate) {
+	left := time.Until(cert.NotAfter)
+	expiry := cert.NotAfter.UTC().Format("2006-01-02")
+	switch {
+	case left <= 0:
+		d.add("tls", name, checkFail, fmt.Sprintf("%s expired on %s", cert.Subject.CommonName, expiry))
+	case left < certExpiryWarning:
+		d.add("tls", name, checkWarn, fmt.Sprintf("%s expires on %s, in %d days", cert.Subject.CommonName, expiry, int(left.Hours()/24)))
+	default:
+		d.add("tls", name, checkPass, fmt.Sprintf("%s valid until %s", cert.Subject.CommonName, expiry))
+	}
+}
+
+// tlsEndpoints returns the host:port of every HTTPS URL in the configuration
+func (d *doctor) tlsEndpoints() []string {
+	cfg := d.cfg
+	urls := []string{llm.BaseURL(cfg.LLM), cfg.OPA.URL, cfg.Pricing.FeedURL}
+	for _, profile := range cfg.LLM.Profiles {
+		urls = append(urls, llm.BaseURL(profile))
+	}
+	for _, issuer := range cfg.Auth.TrustedIssuers {
+		urls = append(urls, issuer.Issuer, issuer.JWKSURL)
+	}
+	if cfg.Currency.Feed != "" {
+		urls = append(urls, cfg.Currency.FeedURL)
+	}
+
+	seen := make(map[string]bool)
+	var endpoints []string
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		addr := net.JoinHostPort(u.Hostname(), port)
+		if !seen[addr] {
+			seen[addr] = true
+			endpoints = append(endpoints, addr)
+		}
+	}
+	return endpoints
+}
+
+func hostOf(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return raw
+}
+
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func splitComma(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]config.LLMConfig) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/budget"
+	"github.com/epps11/goguard/internal/services/policy"
+)
+
+const initUsage = `Usage: goguard init [-db] [-server URL] [-api-key KEY] [-admin-email EMAIL] [-admin-name NAME] [-monthly-limit AMOUNT]
+
+Sets up a fresh deployment with
+  - a super_admin user, and an API key for them, unless there is a super_admin
+  - a policy denying prompt injections of critical threat level to everyone
+  - an enforced global budget capping the monthly spend of all requests
+
+Each is only created if it is missing, so init can run on every deploy.
+The flags default to GOGUARD_INIT_ADMIN_EMAIL, GOGUARD_INIT_ADMIN_NAME and
+GOGUARD_INIT_MONTHLY_LIMIT; a monthly limit of 0 skips the budget.
+
+Like goguard admin, init talks to a running instance through the control
+API, authenticating with -api-key (default GOGUARD_API_KEY, then
+GOGUARD_BOOTSTRAP_API_KEY), or with -db works on the database directly.
+`
+
+// Names of what init creates; existing entries are recognized by them
+const (
+	initPolicyName = "Deny critical prompt injection"
+	initBudgetName = "Global monthly spend"
+)
+
+// runInit implements the init subcommand and returns the exit code
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, initUsage) }
+	server := fs.String("server", getEnv("GOGUARD_SERVER", "http://localhost:8080"), "GoGuard base URL")
+	apiKey := fs.String("api-key", getEnv("GOGUARD_API_KEY", os.Getenv("GOGUARD_BOOTSTRAP_API_KEY")), "API key of a super_admin, such as the bootstrap key")
+	direct := fs.Bool("db", false, "work on the database directly instead of a running instance")
+	email := fs.String("admin-email", os.Getenv("GOGUARD_INIT_ADMIN_EMAIL"), "email of the super_admin to create")
+	name := fs.String("admin-name", getEnv("GOGUARD_INIT_ADMIN_NAME", "Administrator"), "name of the super_admin to create")
+	limit := fs.String("monthly-limit", getEnv("GOGUARD_INIT_MONTHLY_LIMIT", "1000"), "global monthly budget in USD (0 for none)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	monthlyLimit, err := strconv.ParseFloat(*limit, 64)
+	if err != nil || monthlyLimit < 0 {
+		fmt.Fprintf(os.Stderr, "init: invalid monthly limit %q\n", *limit)
+		return 2
+	}
+
+	a := &admin{
+		server: strings.TrimSuffix(*server, "/"),
+		apiKey: *apiKey,
+		http:   &http.Client{Timeout: 60 * time.Second},
+	}
+	if *direct {
+		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+		ctx, cancel := context.WithTimeout(context.Background(), adminDialTimeout)
+		db, err := database.Connect(ctx, database.ConfigFromEnv())
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "init: %v\n", err)
+			return 1
+		}
+		defer db.Close()
+		a.db = db
+		a.repo = database.NewRepository(db)
+	}
+
+	ctx := context.Background()
+	steps := []func() error{
+		func() error { return a.initAdmin(ctx, *email, *name) },
+		func() error { return a.initPolicy(ctx) },
+		func() error { return a.initBudget(ctx, monthlyLimit) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			fmt.Fprintf(os.Stderr, "init: %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// initAdmin creates a super_admin, and a key for them, if there is none
+func (a *admin) initAdmin(ctx context.Context, email, name string) error {
+	var admins []*models.User
+	if a.repo != nil {
+		users, err := a.repo.ListUsers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if u.Role == models.RoleSuperAdmin {
+				admins = append(admins, u)
+			}
+		}
+	} else {
+		var page struct {
+			Users []*models.User `json:"users"`
+		}
+		if err := a.call(http.MethodGet, "/users?role="+string(models.RoleSuperAdmin)+"&limit=1", nil, &page); err != nil {
+			return err
+		}
+		admins = page.Users
+	}
+	if len(admins) > 0 {
+		fmt.Printf("Super admin %s exists\n", admins[0].Email)
+		return nil
+	}
+	if email == "" {
+		return fmt.Errorf("there is no super_admin yet; give one with -admin-email")
+	}
+
+	u := &models.User{Email: email, Name: name, Role: models.RoleSuperAdmin, Status: "active"}
+	if err := a.createUser(ctx, u); err != nil {
+		return fmt.Errorf("failed to create super_admin: %w", err)
+	}
+	return a.issueKey(ctx, adminKeyRequest{Name: "init: " + email, UserID: u.ID, Role: models.RoleSuperAdmin})
+}
+
+// initPolicy creates the policy denying critical prompt injections unless a
+// policy of its name exists, whatever it has become since
+func (a *admin) initPolicy(ctx context.Context) error {
+	p := &models.Policy{
+		Name:        initPolicyName,
+		Description: "Blocks requests whose prompt injection threat level is critical, for every user",
+		Type:        models.PolicyTypeContent,
+		Status:      models.PolicyStatusActive,
+		Priority:    1,
+		Config:      models.PolicyConfig{BlockThreatLevel: "critical"},
+		Targets:     models.PolicyTargets{AllUsers: true},
+		Actions: models.PolicyActions{
+			Action:  models.ActionDeny,
+			Message: "Critical prompt injections are denied",
+		},
+	}
+
+	if a.repo != nil {
+		engine, err := a.engine(ctx)
+		if err != nil {
+			return err
+		}
+		policies, err := engine.ListPolicies(ctx)
+		if err != nil {
+			return err
+		}
+		if existing := policyNamed(policies, initPolicyName); existing != nil {
+			fmt.Printf("Policy %q exists\n", existing.Name)
+			return nil
+		}
+		ctx = policy.WithActor(ctx, actor())
+		if _, err := engine.CreatePolicy(ctx, p); err != nil {
+			return err
+		}
+		a.audit(ctx, &models.AuditLog{
+			EventType:    models.EventTypePolicyChange,
+			Action:       "policy_create",
+			ResourceType: "policy",
+			ResourceID:   p.ID,
+		})
+	} else {
+		var page struct {
+			Policies []*models.Policy `json:"policies"`
+		}
+		if err := a.call(http.MethodGet, "/policies?type="+string(models.PolicyTypeContent)+"&limit=1000", nil, &page); err != nil {
+			return err
+		}
+		if existing := policyNamed(page.Policies, initPolicyName); existing != nil {
+			fmt.Printf("Policy %q exists\n", existing.Name)
+			return nil
+		}
+		if err := a.call(http.MethodPost, "/policies", p, p); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Created policy %s (%s)\n", p.ID, p.Name)
+	return nil
+}
+
+func policyNamed(policies []*models.Policy, name string) *models.Policy {
+	for _, p := range policies {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// initBudget creates an enforced global monthly budget of limit unless there
+// is a global budget already
+func (a *admin) initBudget(ctx context.Context, limit float64) error {
+	if limit == 0 {
+		return nil
+	}
+
+	var budgets []*models.Budget
+	svc := budget.NewService(config.BudgetConfig{}, a.repo, nil)
+	if a.repo != nil {
+		var err error
+		if budgets, err = svc.List(ctx); err != nil {
+			return err
+		}
+	} else {
+		var page struct {
+			Budgets []*models.Budget `json:"budgets"`
+		}
+		if err := a.call(http.MethodGet, "/budgets", nil, &page); err != nil {
+			return err
+		}
+		budgets = page.Budgets
+	}
+	for _, b := range budgets {
+		if b.Scope == models.BudgetScopeGlobal {
+			fmt.Printf("Global budget %q exists (%.2f %s %s)\n", b.Name, b.LimitAmount, b.Currency, b.Period)
+			return nil
+		}
+	}
+
+	b := &models.Budget{
+		Name:        initBudgetName,
+		Scope:       models.BudgetScopeGlobal,
+		Period:      "monthly",
+		LimitAmount: limit,
+		Currency:    "USD",
+		AlertAt:     80,
+		Enforce:     true,
+	}
+	if a.repo != nil {
+		if _, err := svc.Create(ctx, b); err != nil {
+			return err
+		}
+		a.audit(ctx, &models.AuditLog{
+			EventType:    models.EventTypeUserAction,
+			Action:       "budget_create",
+			ResourceType: "budget",
+			ResourceID:   b.ID,
+		})
+	} else if err := a.call(http.MethodPost, "/budgets", b, b); err != nil {
+		return err
+	}
+	fmt.Printf("Created budget %s (%s, %.2f %s %s)\n", b.ID, b.Name, b.LimitAmount, b.Currency, b.Period)
+	return nil
+}
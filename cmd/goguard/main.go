@@ -16,12 +16,31 @@ import (
 	"github.com/epps11/goguard/internal/api"
 	"github.com/epps11/goguard/internal/config"
 	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/secretstore"
 	"github.com/epps11/goguard/internal/services/llm"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bundle":
+			os.Exit(runBundle(os.Args[2:]))
+		case "audit":
+			os.Exit(runAudit(os.Args[2:]))
+		case "doctor":
+			os.Exit(runDoctor(os.Args[2:]))
+		case "secrets":
+			os.Exit(runSecrets(os.Args[2:]))
+		case "admin":
+			os.Exit(runAdmin(os.Args[2:]))
+		case "init":
+			os.Exit(runInit(os.Args[2:]))
+		}
+	}
+
 	// Parse flags
 	configPath := flag.String("config", "", "Path to configuration file")
+	dev := flag.Bool("dev", false, "Run for local evaluation: console logs, in-memory state, demo users and policies")
 	flag.Parse()
 
 	// Load configuration
@@ -29,25 +48,56 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
+	if *dev {
+		cfg.ApplyDevMode()
+	}
 
 	// Setup logging
 	setupLogging(cfg.Logging)
 
+	// Replace secret:// references before anything reads the config
+	secretStore := secretstore.NewStore(cfg.SecretStore)
+	if err := secretstore.ResolveConfig(context.Background(), secretStore, cfg); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+	envelope, err := secretstore.NewEnvelope(cfg.Encryption, cfg.SecretStore.AWS)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid master key")
+	}
+
 	log.Info().
 		Str("version", "1.0.0").
 		Str("mode", cfg.Server.Mode).
 		Msg("Starting GoGuard AI Governance Data Plane")
 
-	// Initialize database connection
+	// Initialize database connection; dev mode keeps everything in memory
 	var repo *database.Repository
-	db, err := database.NewFromEnv()
-	if err != nil {
+	var db *database.DB
+	if *dev {
+		log.Info().Msg("Dev mode - using in-memory storage")
+	} else if db, err = database.New(databaseConfig(cfg.Database)); err != nil {
 		log.Warn().Err(err).Msg("Failed to connect to database - running without persistent settings")
 	} else {
 		repo = database.NewRepository(db)
 		log.Info().Msg("Database connected - dashboard settings will be used")
 	}
 
+	// Simulated upstream failures must be enabled before any LLM client is created
+	if cfg.Server.FaultInjectionEnabled() {
+		llm.EnableFaultInjection()
+		log.Warn().Msg("Fault injection enabled - guard requests can simulate LLM failures with X-GoGuard-Chaos-* headers")
+	} else if cfg.Server.FaultInjection {
+		log.Warn().Str("mode", cfg.Server.Mode).Msg("Fault injection is only available in debug mode - ignoring")
+	}
+
+	llm.ConfigureCircuitBreakers(cfg.LLM.CircuitBreaker)
+	if cfg.Server.WriteTimeout > 0 && max(cfg.LLM.Timeout, cfg.LLM.MaxTimeout) >= cfg.Server.WriteTimeout {
+		log.Warn().
+			Dur("llm_timeout", max(cfg.LLM.Timeout, cfg.LLM.MaxTimeout)).
+			Dur("write_timeout", cfg.Server.WriteTimeout).
+			Msg("LLM timeout isn't below the server write timeout - slow responses will be cut off")
+	}
+
 	// Initialize LLM client (optional)
 	var llmClient *llm.Client
 	if cfg.LLM.APIKey != "" {
@@ -65,7 +115,12 @@ func main() {
 	}
 
 	// Create router with database repository for dynamic settings
-	router := api.NewRouter(cfg, llmClient, repo)
+	router := api.NewRouter(cfg, llmClient, secretStore, envelope, repo)
+	if *dev {
+		if err := seedDemo(context.Background(), router); err != nil {
+			log.Fatal().Err(err).Msg("Failed to seed demo data")
+		}
+	}
 
 	// Create server
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -75,15 +130,67 @@ func main() {
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 	}
+	var certs *serverTLS
+	if cfg.Server.TLS.Enabled() {
+		if certs, err = newServerTLS(cfg.Server.TLS); err != nil {
+			log.Fatal().Err(err).Msg("Invalid TLS configuration")
+		}
+		server.TLSConfig = certs.config()
+	}
 
 	// Start server in goroutine
 	go func() {
-		log.Info().Str("address", addr).Msg("Server listening")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		scheme := "http"
+		if certs != nil {
+			scheme = "https"
+			log.Info().Str("client_certificates", certs.clientAuth()).Msg("TLS enabled")
+		}
+		log.Info().Str("address", addr).Str("scheme", scheme).Msg("Server listening")
+		if *dev {
+			printDevSamples(fmt.Sprintf("%s://localhost:%d", scheme, cfg.Server.Port), cfg.Auth.BootstrapAPIKey, llmClient != nil)
+		}
+		var err error
+		if certs != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatal().Err(err).Msg("Server failed")
 		}
 	}()
 
+	// Reload the config file on SIGHUP or when it changes
+	reload := make(chan struct{}, 1)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Info().Msg("SIGHUP received - reloading configuration")
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	config.Watch(context.Background(), *configPath, cfg.Server.ConfigWatchInterval, func() {
+		log.Info().Str("path", *configPath).Msg("Configuration file changed - reloading")
+		select {
+		case reload <- struct{}{}:
+		default:
+		}
+	})
+	go func() {
+		for range reload {
+			reloadConfig(router, secretStore, *configPath, *dev)
+			if certs != nil {
+				if err := certs.reload(); err != nil {
+					log.Error().Err(err).Msg("Failed to reload TLS certificates - keeping the loaded ones")
+				}
+			}
+		}
+	}()
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -100,6 +207,7 @@ func main() {
 	}
 
 	// Cleanup
+	router.Close()
 	if llmClient != nil {
 		llmClient.Close()
 	}
@@ -110,6 +218,32 @@ func main() {
 	log.Info().Msg("Server stopped")
 }
 
+// reloadConfig re-reads the configuration and applies what can change
+// without a restart, keeping the running configuration if it is invalid
+// databaseConfig returns the connection settings of the environment, tuned
+// by the database section of the config file
+func databaseConfig(cfg config.DatabaseConfig) database.Config {
+	dbCfg := database.ConfigFromEnv()
+	dbCfg.SlowQueryThreshold = cfg.SlowQueryThreshold
+	dbCfg.StatementCacheSize = cfg.StatementCacheSize
+	return dbCfg
+}
+
+func reloadConfig(router *api.Router, secretStore *secretstore.Store, path string, dev bool) {
+	cfg, err := config.Load(path)
+	if err == nil {
+		if dev {
+			cfg.ApplyDevMode()
+		}
+		err = secretstore.ResolveConfig(context.Background(), secretStore, cfg)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to reload configuration - keeping the running one")
+		return
+	}
+	router.Reload(cfg)
+}
+
 func setupLogging(cfg config.LoggingConfig) {
 	// Set log level
 	level, err := zerolog.ParseLevel(cfg.Level)
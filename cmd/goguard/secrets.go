@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/epps11/goguard/internal/secretstore"
+)
+
+const secretsUsage = `Usage:
+  goguard secrets keygen
+  goguard secrets encrypt [-in FILE] [-o FILE]
+  goguard secrets decrypt [-in FILE] [-o FILE]
+
+Manages the encrypted secrets file read by secret://file/NAME references.
+keygen prints a new key, for GOGUARD_SECRETS_FILE_KEY or GOGUARD_MASTER_KEY.
+encrypt reads a JSON object of names and secrets and writes it encrypted
+with GOGUARD_SECRETS_FILE_KEY; decrypt reverses it, e.g. to edit the
+secrets. Files default to stdin and stdout.
+`
+
+// runSecrets implements the secrets subcommand and returns the exit code
+func runSecrets(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, secretsUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("secrets "+args[0], flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, secretsUsage) }
+	in := fs.String("in", "-", "file to read (- for stdin)")
+	out := fs.String("o", "-", "file to write (- for stdout)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "keygen":
+		fmt.Println(secretstore.NewKey())
+	case "encrypt":
+		err = transformSecrets(*in, *out, func(key, data []byte) ([]byte, error) {
+			var secrets map[string]interface{}
+			if err := json.Unmarshal(data, &secrets); err != nil {
+				return nil, fmt.Errorf("input must be a JSON object of names and secrets: %w", err)
+			}
+			sealed, err := secretstore.Seal(key, data)
+			return []byte(sealed + "\n"), err
+		})
+	case "decrypt":
+		err = transformSecrets(*in, *out, func(key, data []byte) ([]byte, error) {
+			return secretstore.Open(key, string(data))
+		})
+	default:
+		fmt.Fprint(os.Stderr, secretsUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "secrets %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// transformSecrets reads in, applies fn with the key from
+// GOGUARD_SECRETS_FILE_KEY and writes the result to out
+func transformSecrets(in, out string, fn func(key, data []byte) ([]byte, error)) error {
+	key, err := secretstore.ParseKey(os.Getenv("GOGUARD_SECRETS_FILE_KEY"))
+	if err != nil {
+		return fmt.Errorf("GOGUARD_SECRETS_FILE_KEY: %w", err)
+	}
+
+	var data []byte
+	if in == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(in)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := fn(key, bytes.TrimSpace(data))
+	if err != nil {
+		return err
+	}
+	if out == "-" {
+		_, err = os.Stdout.Write(result)
+		return err
+	}
+	return os.WriteFile(out, result, 0600)
+}
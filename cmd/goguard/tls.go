@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// serverTLS holds the server's certificate and the CAs client certificates
+// are verified against. reload re-reads them, so certificates can be rotated
+// in place with a SIGHUP.
+type serverTLS struct {
+	cfg     config.ServerTLSConfig
+	current atomic.Pointer[tls.Config]
+}
+
+func newServerTLS(cfg config.ServerTLSConfig) (*serverTLS, error) {
+	s := &serverTLS{cfg: cfg}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload re-reads the certificate files, keeping the loaded ones on error
+func (s *serverTLS) reload() error {
+	loaded, err := loadServerTLS(s.cfg)
+	if err != nil {
+		return err
+	}
+	s.current.Store(loaded)
+	return nil
+}
+
+// config returns the server's TLS configuration, which hands each
+// connection the certificates loaded last
+func (s *serverTLS) config() *tls.Config {
+	return &tls.Config{
+		MinVersion: s.current.Load().MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.current.Load(), nil
+		},
+	}
+}
+
+// clientAuth describes who may connect, for logging
+func (s *serverTLS) clientAuth() string {
+	switch s.current.Load().ClientAuth {
+	case tls.RequireAndVerifyClientCert:
+		return "required"
+	case tls.VerifyClientCertIfGiven:
+		return "verified if given"
+	default:
+		return "none"
+	}
+}
+
+// loadServerTLS builds a TLS configuration from cfg
+func loadServerTLS(cfg config.ServerTLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("server.tls needs both cert_file and key_file")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	switch cfg.MinVersion {
+	case "", "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported server.tls.min_version %q; use 1.2 or 1.3", cfg.MinVersion)
+	}
+
+	if cfg.ClientCAFile == "" {
+		if cfg.ClientAuth != "" {
+			return nil, errors.New("server.tls.client_auth needs client_ca_file")
+		}
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	switch cfg.ClientAuth {
+	case "", "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "verify_if_given":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unsupported server.tls.client_auth %q; use require or verify_if_given", cfg.ClientAuth)
+	}
+	return tlsConfig, nil
+}
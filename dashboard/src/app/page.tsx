@@ -6,7 +6,7 @@ import { StatsCard } from "@/components/dashboard/stats-card"
 import { AlertsList } from "@/components/dashboard/alerts-list"
 import { UsageChart } from "@/components/dashboard/usage-chart"
 import { fetchAPI, formatCurrency, formatNumber } from "@/lib/utils"
-import { Activity, Users, ShieldAlert, DollarSign } from "lucide-react"
+import { Activity, Users, ShieldAlert, DollarSign, TrendingUp } from "lucide-react"
 
 interface DashboardMetrics {
   overview: {
@@ -19,6 +19,11 @@ interface DashboardMetrics {
     total_spend_24h: number
     spend_change_percent: number
   }
+  spending: {
+    total_spend_month: number
+    projected_spend_month: number
+    currency: string
+  }
   security: {
     injection_attempts_24h: number
     pii_detections_24h: number
@@ -61,6 +66,11 @@ export default function DashboardPage() {
             total_spend_24h: 1234.56,
             spend_change_percent: 15.7,
           },
+          spending: {
+            total_spend_month: 18420.75,
+            projected_spend_month: 36150.2,
+            currency: "USD",
+          },
           security: {
             injection_attempts_24h: 23,
             pii_detections_24h: 156,
@@ -96,7 +106,7 @@ export default function DashboardPage() {
       <Header title="Dashboard" description="AI governance overview and metrics" />
       <div className="flex-1 p-6 space-y-6">
         {/* Stats Cards */}
-        <div className="grid gap-4 md:grid-cols-2 lg:grid-cols-4">
+        <div className="grid gap-4 md:grid-cols-3 lg:grid-cols-5">
           <StatsCard
             title="Total Requests (24h)"
             value={formatNumber(metrics?.overview.total_requests_24h || 0)}
@@ -117,10 +127,16 @@ export default function DashboardPage() {
           />
           <StatsCard
             title="Total Spend (24h)"
-            value={formatCurrency(metrics?.overview.total_spend_24h || 0)}
+            value={formatCurrency(metrics?.overview.total_spend_24h || 0, metrics?.spending.currency)}
             change={metrics?.overview.spend_change_percent}
             icon={DollarSign}
           />
+          <StatsCard
+            title="Projected Spend (Month)"
+            value={formatCurrency(metrics?.spending.projected_spend_month || 0, metrics?.spending.currency)}
+            description={`${formatCurrency(metrics?.spending.total_spend_month || 0, metrics?.spending.currency)} month to date`}
+            icon={TrendingUp}
+          />
         </div>
 
         {/* Charts and Alerts */}
@@ -16,6 +16,15 @@ import {
 import { Settings, Shield, Bell, Database, Key, Loader2 } from "lucide-react"
 import { fetchAPI } from "@/lib/utils"
 
+interface ModerationSettings {
+  enabled: boolean
+  provider: string
+  action: string
+  thresholds: Record<string, number> | null
+}
+
+const moderationCategories = ["harassment", "hate", "illicit", "self_harm", "sexual", "violence"]
+
 export default function SettingsPage() {
   const [llmProvider, setLlmProvider] = useState("openai")
   const [llmModel, setLlmModel] = useState("gpt-4o")
@@ -31,6 +40,15 @@ export default function SettingsPage() {
   const [blockOnDetection, setBlockOnDetection] = useState(true)
   const [piiMasking, setPiiMasking] = useState(true)
   const [rateLimit, setRateLimit] = useState(100)
+  const [maxConcurrentPerUser, setMaxConcurrentPerUser] = useState(0)
+  const [maxConcurrentPerKey, setMaxConcurrentPerKey] = useState(0)
+  const [concurrencyQueueTimeout, setConcurrencyQueueTimeout] = useState(10000)
+  const [moderation, setModeration] = useState<ModerationSettings>({
+    enabled: false,
+    provider: "keywords",
+    action: "warn",
+    thresholds: {},
+  })
 
   // Storage settings
   const [storageType, setStorageType] = useState("In-Memory")
@@ -54,6 +72,10 @@ export default function SettingsPage() {
           block_on_detection: boolean
           pii_masking_enabled: boolean
           rate_limit_per_minute: number
+          max_concurrent_per_user?: number
+          max_concurrent_per_key?: number
+          concurrency_queue_timeout_ms?: number
+          moderation?: ModerationSettings
         }>("/api/v1/control/settings/security")
         if (secSettings.injection_detection_enabled !== undefined)
           setInjectionDetection(secSettings.injection_detection_enabled)
@@ -63,6 +85,13 @@ export default function SettingsPage() {
           setPiiMasking(secSettings.pii_masking_enabled)
         if (secSettings.rate_limit_per_minute)
           setRateLimit(secSettings.rate_limit_per_minute)
+        if (secSettings.max_concurrent_per_user !== undefined)
+          setMaxConcurrentPerUser(secSettings.max_concurrent_per_user)
+        if (secSettings.max_concurrent_per_key !== undefined)
+          setMaxConcurrentPerKey(secSettings.max_concurrent_per_key)
+        if (secSettings.concurrency_queue_timeout_ms !== undefined)
+          setConcurrencyQueueTimeout(secSettings.concurrency_queue_timeout_ms)
+        if (secSettings.moderation) setModeration(secSettings.moderation)
 
         // Load storage info
         const storageInfo = await fetchAPI<{
@@ -108,6 +137,10 @@ export default function SettingsPage() {
           block_on_detection: blockOnDetection,
           pii_masking_enabled: piiMasking,
           rate_limit_per_minute: rateLimit,
+          max_concurrent_per_user: maxConcurrentPerUser,
+          max_concurrent_per_key: maxConcurrentPerKey,
+          concurrency_queue_timeout_ms: concurrencyQueueTimeout,
+          moderation,
         }),
       })
 
@@ -276,7 +309,7 @@ export default function SettingsPage() {
               Security Settings
             </CardTitle>
             <CardDescription>
-              Configure injection detection and content filtering
+              Configure injection detection, content filtering and response moderation
             </CardDescription>
           </CardHeader>
           <CardContent className="space-y-4">
@@ -337,6 +370,108 @@ export default function SettingsPage() {
                 />
               </div>
             </div>
+            <div className="grid grid-cols-3 gap-4">
+              <div className="space-y-2">
+                <Label>Max In-Flight per User (0 = unlimited)</Label>
+                <Input
+                  type="number"
+                  min={0}
+                  value={maxConcurrentPerUser}
+                  onChange={(e) => setMaxConcurrentPerUser(parseInt(e.target.value) || 0)}
+                />
+              </div>
+              <div className="space-y-2">
+                <Label>Max In-Flight per API Key (0 = unlimited)</Label>
+                <Input
+                  type="number"
+                  min={0}
+                  value={maxConcurrentPerKey}
+                  onChange={(e) => setMaxConcurrentPerKey(parseInt(e.target.value) || 0)}
+                />
+              </div>
+              <div className="space-y-2">
+                <Label>Queue Timeout (ms)</Label>
+                <Input
+                  type="number"
+                  min={0}
+                  value={concurrencyQueueTimeout}
+                  onChange={(e) => setConcurrencyQueueTimeout(parseInt(e.target.value) || 0)}
+                />
+              </div>
+            </div>
+            <div className="grid grid-cols-3 gap-4">
+              <div className="space-y-2">
+                <Label>Response Moderation</Label>
+                <Select
+                  value={moderation.enabled ? "enabled" : "disabled"}
+                  onValueChange={(v) => setModeration({ ...moderation, enabled: v === "enabled" })}
+                >
+                  <SelectTrigger>
+                    <SelectValue />
+                  </SelectTrigger>
+                  <SelectContent>
+                    <SelectItem value="enabled">Enabled</SelectItem>
+                    <SelectItem value="disabled">Disabled</SelectItem>
+                  </SelectContent>
+                </Select>
+              </div>
+              <div className="space-y-2">
+                <Label>Moderation Provider</Label>
+                <Select
+                  value={moderation.provider}
+                  onValueChange={(v) => setModeration({ ...moderation, provider: v })}
+                >
+                  <SelectTrigger>
+                    <SelectValue />
+                  </SelectTrigger>
+                  <SelectContent>
+                    <SelectItem value="keywords">Built-in Rules</SelectItem>
+                    <SelectItem value="openai">OpenAI Moderations</SelectItem>
+                  </SelectContent>
+                </Select>
+              </div>
+              <div className="space-y-2">
+                <Label>Flagged Responses</Label>
+                <Select
+                  value={moderation.action}
+                  onValueChange={(v) => setModeration({ ...moderation, action: v })}
+                >
+                  <SelectTrigger>
+                    <SelectValue />
+                  </SelectTrigger>
+                  <SelectContent>
+                    <SelectItem value="warn">Deliver with Warning</SelectItem>
+                    <SelectItem value="redact">Redact</SelectItem>
+                    <SelectItem value="block">Block</SelectItem>
+                  </SelectContent>
+                </Select>
+              </div>
+            </div>
+            <div className="space-y-2">
+              <Label>Moderation Thresholds (0-1, empty uses 0.5)</Label>
+              <div className="grid grid-cols-3 gap-4">
+                {moderationCategories.map((category) => (
+                  <div key={category} className="space-y-1">
+                    <Label className="text-xs">{category.replace("_", " ")}</Label>
+                    <Input
+                      type="number"
+                      step="0.05"
+                      min={0}
+                      value={moderation.thresholds?.[category] ?? ""}
+                      onChange={(e) => {
+                        const thresholds = { ...(moderation.thresholds || {}) }
+                        if (e.target.value === "") {
+                          delete thresholds[category]
+                        } else {
+                          thresholds[category] = parseFloat(e.target.value)
+                        }
+                        setModeration({ ...moderation, thresholds })
+                      }}
+                    />
+                  </div>
+                ))}
+              </div>
+            </div>
           </CardContent>
         </Card>
 
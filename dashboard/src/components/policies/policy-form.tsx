@@ -35,10 +35,16 @@ interface PolicyFormData {
     // Rate Limit
     requests_per_minute?: number
     requests_per_hour?: number
+    requests_per_day?: number
     burst_limit?: number
     // Content Filter
     blocked_keywords?: string
     allowed_models?: string
+    denied_models?: string
+    allowed_providers?: string
+    denied_providers?: string
+    allowed_tools?: string
+    denied_tools?: string
     max_tokens?: number
     // Access Control
     allowed_roles?: string
@@ -48,7 +54,45 @@ interface PolicyFormData {
     require_audit?: boolean
     data_retention_days?: number
     pii_handling?: string
+    system_prompt?: string
+    system_prompt_mode?: string
+    // Topic Restriction
+    allowed_topics?: Topic[]
+    blocked_topics?: Topic[]
+    topic_threshold?: number
+    check_responses?: boolean
+    // Routing
+    llm_profile?: string
+    route_model?: string
   }
+  actions?: {
+    action?: string
+  }
+}
+
+interface Topic {
+  name: string
+  keywords?: string[]
+  examples?: string[]
+}
+
+// Topics are edited one per line as "name: keyword, keyword". Example
+// phrases are set through the API and kept when a topic's keywords change.
+function formatTopics(topics?: Topic[]) {
+  return (topics || []).map((t) => `${t.name}: ${(t.keywords || []).join(", ")}`).join("\n")
+}
+
+function parseTopics(text: string, existing?: Topic[]): Topic[] {
+  return text
+    .split("\n")
+    .map((line) => {
+      const colon = line.indexOf(":")
+      const name = colon < 0 ? line : line.slice(0, colon)
+      const keywords = colon < 0 ? "" : line.slice(colon + 1)
+      return { name: name.trim(), keywords: keywords.split(",").map((k) => k.trim()).filter(Boolean) }
+    })
+    .filter((t) => t.name)
+    .map((t) => ({ ...t, examples: existing?.find((e) => e.name === t.name)?.examples }))
 }
 
 interface PolicyFormProps {
@@ -67,6 +111,11 @@ export function PolicyForm({ open, onOpenChange, onSubmit, initialData, mode = "
     status: initialData?.status || "active",
     priority: initialData?.priority || 1,
     config: initialData?.config || {},
+    actions: initialData?.actions || {},
+  })
+  const [topicText, setTopicText] = useState({
+    allowed: formatTopics(initialData?.config?.allowed_topics),
+    blocked: formatTopics(initialData?.config?.blocked_topics),
   })
 
   const handleSubmit = (e: React.FormEvent) => {
@@ -80,13 +129,21 @@ export function PolicyForm({ open, onOpenChange, onSubmit, initialData, mode = "
       status: "active",
       priority: 1,
       config: {},
+      actions: {},
     })
+    setTopicText({ allowed: "", blocked: "" })
   }
 
-  const updateConfig = (key: string, value: string | number | boolean) => {
+  const updateConfig = (key: string, value: string | number | boolean | Topic[]) => {
     setFormData({ ...formData, config: { ...formData.config, [key]: value } })
   }
 
+  const updateTopics = (list: "allowed" | "blocked", text: string) => {
+    const key = list === "allowed" ? "allowed_topics" : "blocked_topics"
+    setTopicText({ ...topicText, [list]: text })
+    updateConfig(key, parseTopics(text, formData.config[key]))
+  }
+
   return (
     <Dialog open={open} onOpenChange={onOpenChange}>
       <DialogContent className="sm:max-w-[500px]">
@@ -135,6 +192,8 @@ export function PolicyForm({ open, onOpenChange, onSubmit, initialData, mode = "
                     <SelectItem value="content">Content Filter</SelectItem>
                     <SelectItem value="access">Access Control</SelectItem>
                     <SelectItem value="compliance">Compliance</SelectItem>
+                    <SelectItem value="topic">Topic Restriction</SelectItem>
+                    <SelectItem value="routing">Routing</SelectItem>
                   </SelectContent>
                 </Select>
               </div>
@@ -237,15 +296,27 @@ export function PolicyForm({ open, onOpenChange, onSubmit, initialData, mode = "
                     />
                   </div>
                 </div>
-                <div className="space-y-1">
-                  <Label className="text-xs">Burst Limit</Label>
-                  <Input
-                    type="number"
-                    min={1}
-                    value={formData.config.burst_limit || ""}
-                    onChange={(e) => updateConfig("burst_limit", parseInt(e.target.value) || 0)}
-                    placeholder="e.g., 10"
-                  />
+                <div className="grid grid-cols-2 gap-3">
+                  <div className="space-y-1">
+                    <Label className="text-xs">Requests/Day</Label>
+                    <Input
+                      type="number"
+                      min={1}
+                      value={formData.config.requests_per_day || ""}
+                      onChange={(e) => updateConfig("requests_per_day", parseInt(e.target.value) || 0)}
+                      placeholder="e.g., 5000"
+                    />
+                  </div>
+                  <div className="space-y-1">
+                    <Label className="text-xs">Burst Limit</Label>
+                    <Input
+                      type="number"
+                      min={1}
+                      value={formData.config.burst_limit || ""}
+                      onChange={(e) => updateConfig("burst_limit", parseInt(e.target.value) || 0)}
+                      placeholder="e.g., 10"
+                    />
+                  </div>
                 </div>
               </div>
             )}
@@ -269,6 +340,46 @@ export function PolicyForm({ open, onOpenChange, onSubmit, initialData, mode = "
                     placeholder="e.g., gpt-4o, claude-3-5-sonnet"
                   />
                 </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Denied Models (comma-separated, * matches any suffix)</Label>
+                  <Input
+                    value={formData.config.denied_models || ""}
+                    onChange={(e) => updateConfig("denied_models", e.target.value)}
+                    placeholder="e.g., gpt-4*, o1"
+                  />
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Allowed Providers (comma-separated)</Label>
+                  <Input
+                    value={formData.config.allowed_providers || ""}
+                    onChange={(e) => updateConfig("allowed_providers", e.target.value)}
+                    placeholder="e.g., openai, ollama"
+                  />
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Denied Providers (comma-separated)</Label>
+                  <Input
+                    value={formData.config.denied_providers || ""}
+                    onChange={(e) => updateConfig("denied_providers", e.target.value)}
+                    placeholder="e.g., xai"
+                  />
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Allowed Tools (comma-separated function names)</Label>
+                  <Input
+                    value={formData.config.allowed_tools || ""}
+                    onChange={(e) => updateConfig("allowed_tools", e.target.value)}
+                    placeholder="e.g., search_docs, get_weather"
+                  />
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Denied Tools (comma-separated, * matches any suffix)</Label>
+                  <Input
+                    value={formData.config.denied_tools || ""}
+                    onChange={(e) => updateConfig("denied_tools", e.target.value)}
+                    placeholder="e.g., run_shell, delete_*"
+                  />
+                </div>
                 <div className="space-y-1">
                   <Label className="text-xs">Max Tokens per Request</Label>
                   <Input
@@ -358,6 +469,122 @@ export function PolicyForm({ open, onOpenChange, onSubmit, initialData, mode = "
                     </SelectContent>
                   </Select>
                 </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">System Prompt (added to every forwarded conversation)</Label>
+                  <textarea
+                    className="flex min-h-[80px] w-full rounded-md border border-input bg-transparent px-3 py-2 text-sm shadow-sm placeholder:text-muted-foreground focus-visible:outline-none focus-visible:ring-1 focus-visible:ring-ring"
+                    value={formData.config.system_prompt || ""}
+                    onChange={(e) => updateConfig("system_prompt", e.target.value)}
+                    placeholder="e.g., Never reveal internal data. You are assisting {{user_name}}."
+                  />
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">System Prompt Placement</Label>
+                  <Select
+                    value={formData.config.system_prompt_mode || "prepend"}
+                    onValueChange={(v) => updateConfig("system_prompt_mode", v)}
+                  >
+                    <SelectTrigger>
+                      <SelectValue />
+                    </SelectTrigger>
+                    <SelectContent>
+                      <SelectItem value="prepend">Separate message before the conversation</SelectItem>
+                      <SelectItem value="merge">Merged into the caller&apos;s system message</SelectItem>
+                    </SelectContent>
+                  </Select>
+                </div>
+              </div>
+            )}
+
+            {formData.type === "topic" && (
+              <div className="space-y-3 p-3 bg-muted/50 rounded-lg">
+                <Label className="text-sm font-medium">Topic Restriction Configuration</Label>
+                <div className="space-y-1">
+                  <Label className="text-xs">Blocked Topics (one per line, name: keywords)</Label>
+                  <textarea
+                    className="flex min-h-[80px] w-full rounded-md border border-input bg-transparent px-3 py-2 text-sm shadow-sm placeholder:text-muted-foreground focus-visible:outline-none focus-visible:ring-1 focus-visible:ring-ring"
+                    value={topicText.blocked}
+                    onChange={(e) => updateTopics("blocked", e.target.value)}
+                    placeholder={"e.g., legal advice: lawsuit, attorney, sue\ncompetitors: Acme, Globex"}
+                  />
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Allowed Topics (one per line; anything else is off topic)</Label>
+                  <textarea
+                    className="flex min-h-[80px] w-full rounded-md border border-input bg-transparent px-3 py-2 text-sm shadow-sm placeholder:text-muted-foreground focus-visible:outline-none focus-visible:ring-1 focus-visible:ring-ring"
+                    value={topicText.allowed}
+                    onChange={(e) => updateTopics("allowed", e.target.value)}
+                    placeholder="e.g., billing: invoice, refund, payment"
+                  />
+                </div>
+                <div className="grid grid-cols-2 gap-3">
+                  <div className="space-y-1">
+                    <Label className="text-xs">On Match</Label>
+                    <Select
+                      value={formData.actions?.action || "warn"}
+                      onValueChange={(v) => setFormData({ ...formData, actions: { ...formData.actions, action: v } })}
+                    >
+                      <SelectTrigger>
+                        <SelectValue />
+                      </SelectTrigger>
+                      <SelectContent>
+                        <SelectItem value="warn">Warn</SelectItem>
+                        <SelectItem value="deny">Deny</SelectItem>
+                      </SelectContent>
+                    </Select>
+                  </div>
+                  <div className="space-y-1">
+                    <Label className="text-xs">Check Responses</Label>
+                    <Select
+                      value={formData.config.check_responses ? "true" : "false"}
+                      onValueChange={(v) => updateConfig("check_responses", v === "true")}
+                    >
+                      <SelectTrigger>
+                        <SelectValue />
+                      </SelectTrigger>
+                      <SelectContent>
+                        <SelectItem value="true">Yes</SelectItem>
+                        <SelectItem value="false">No</SelectItem>
+                      </SelectContent>
+                    </Select>
+                  </div>
+                </div>
+                <div className="space-y-1">
+                  <Label className="text-xs">Example Similarity Threshold (0-1)</Label>
+                  <Input
+                    type="number"
+                    min={0}
+                    max={1}
+                    step={0.05}
+                    value={formData.config.topic_threshold || ""}
+                    onChange={(e) => updateConfig("topic_threshold", parseFloat(e.target.value) || 0)}
+                    placeholder="0.8"
+                  />
+                </div>
+              </div>
+            )}
+
+            {formData.type === "routing" && (
+              <div className="space-y-3 p-3 bg-muted/50 rounded-lg">
+                <Label className="text-sm font-medium">Routing Configuration</Label>
+                <div className="grid grid-cols-2 gap-3">
+                  <div className="space-y-1">
+                    <Label className="text-xs">LLM Profile</Label>
+                    <Input
+                      value={formData.config.llm_profile || ""}
+                      onChange={(e) => updateConfig("llm_profile", e.target.value)}
+                      placeholder="e.g., azure-eu"
+                    />
+                  </div>
+                  <div className="space-y-1">
+                    <Label className="text-xs">Model (replaces the requested one)</Label>
+                    <Input
+                      value={formData.config.route_model || ""}
+                      onChange={(e) => updateConfig("route_model", e.target.value)}
+                      placeholder="e.g., gpt-4o-eu"
+                    />
+                  </div>
+                </div>
               </div>
             )}
           </div>
@@ -78,8 +78,8 @@ export function SpendingLimits({ limits, onEdit, onCreate }: SpendingLimitsProps
                     <TableCell>
                       <Badge variant="outline">{limit.limit_type}</Badge>
                     </TableCell>
-                    <TableCell>{formatCurrency(limit.limit_amount)}</TableCell>
-                    <TableCell>{formatCurrency(limit.current_spend)}</TableCell>
+                    <TableCell>{formatCurrency(limit.limit_amount, limit.currency)}</TableCell>
+                    <TableCell>{formatCurrency(limit.current_spend, limit.currency)}</TableCell>
                     <TableCell>
                       <div className="flex items-center gap-2">
                         <div className="w-24 h-2 bg-muted rounded-full overflow-hidden">
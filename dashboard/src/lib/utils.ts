@@ -23,10 +23,10 @@ export async function fetchAPI<T>(endpoint: string, options?: RequestInit): Prom
   return response.json()
 }
 
-export function formatCurrency(amount: number): string {
+export function formatCurrency(amount: number, currency = "USD"): string {
   return new Intl.NumberFormat("en-US", {
     style: "currency",
-    currency: "USD",
+    currency: currency || "USD",
   }).format(amount)
 }
 
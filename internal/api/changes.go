@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/settings"
+	"github.com/epps11/goguard/internal/services/suppression"
+)
+
+// changeTimeout bounds the database reads made to apply one change
+const changeTimeout = 10 * time.Second
+
+// changeApplier brings this instance up to date with the changes other
+// instances announce, so a setting, policy or suppression saved through one
+// replica applies on all of them within moments
+type changeApplier struct {
+	repo         *database.Repository
+	settings     *settings.Service
+	engine       *policy.Engine
+	suppressions *suppression.Service
+}
+
+// apply handles one announced change
+func (a *changeApplier) apply(change database.Change) {
+	ctx, cancel := context.WithTimeout(context.Background(), changeTimeout)
+	defer cancel()
+
+	switch change.Kind {
+	case database.ChangeSettings:
+		a.settings.SettingChanged(ctx, change.ID)
+	case database.ChangePolicy:
+		a.reloadPolicy(ctx, change.ID)
+	case database.ChangeSuppressions:
+		a.suppressions.Invalidate(ctx)
+	case database.ChangeAll:
+		a.settings.SettingChanged(ctx, "llm_settings")
+		a.suppressions.Invalidate(ctx)
+		a.reloadPolicies(ctx)
+	default:
+		log.Debug().Str("kind", change.Kind).Msg("Ignoring unknown change announcement")
+	}
+}
+
+// reloadPolicy reads a policy and its history changed by another instance
+// into the policy engine
+func (a *changeApplier) reloadPolicy(ctx context.Context, id string) {
+	p, err := a.repo.GetPolicy(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("policy_id", id).Msg("Failed to reload policy changed by another instance")
+		return
+	}
+	history, err := a.repo.ListPolicyHistory(ctx, id)
+	if err != nil {
+		log.Warn().Err(err).Str("policy_id", id).Msg("Failed to reload policy history changed by another instance")
+		return
+	}
+	a.engine.ReloadPolicy(p, history)
+	log.Debug().Str("policy_id", id).Msg("Reloaded policy changed by another instance")
+}
+
+// reloadPolicies reads every policy and its history into the policy engine,
+// after changes may have been missed
+func (a *changeApplier) reloadPolicies(ctx context.Context) {
+	policies, err := a.repo.ListPolicies(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to reload policies")
+		return
+	}
+	versions, err := a.repo.ListPolicyVersions(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to reload policy versions")
+		return
+	}
+	a.engine.ImportState(&policy.State{Policies: policies, PolicyVersions: versions})
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConcurrencyError is returned when a request waited too long for a slot
+type ConcurrencyError struct {
+	Scope string // user or api_key
+	Limit int
+}
+
+func (e *ConcurrencyError) Error() string {
+	who := "user"
+	if e.Scope == "api_key" {
+		who = "API key"
+	}
+	return fmt.Sprintf("Too many requests in flight for this %s: at most %d at a time", who, e.Limit)
+}
+
+// ConcurrencyLimiter caps the LLM requests in flight per user and per API
+// key, so one runaway agent can't use up the provider's quota. Requests over
+// a cap wait for a slot, up to the queue timeout.
+type ConcurrencyLimiter struct {
+	mu       sync.Mutex
+	perUser  int
+	perKey   int
+	timeout  time.Duration
+	inFlight map[string]int
+	// freed is closed when a slot of the identity is released, waking its
+	// waiters
+	freed map[string]chan struct{}
+}
+
+// NewConcurrencyLimiter creates a limiter; a limit of 0 or less is unlimited
+func NewConcurrencyLimiter(perUser, perKey int, timeout time.Duration) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		perUser:  perUser,
+		perKey:   perKey,
+		timeout:  timeout,
+		inFlight: make(map[string]int),
+		freed:    make(map[string]chan struct{}),
+	}
+}
+
+// SetLimits changes the limits and queue timeout. Waiting requests are
+// checked against the new limits at once.
+func (l *ConcurrencyLimiter) SetLimits(perUser, perKey int, timeout time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perUser, l.perKey, l.timeout = perUser, perKey, timeout
+	for key, ch := range l.freed {
+		close(ch)
+		delete(l.freed, key)
+	}
+}
+
+// Acquire takes a slot for the user and API key, either of which may be
+// empty, waiting for one if needed. The returned release must be called when
+// the request is done.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, userID, apiKeyID string) (func(), error) {
+	var keys []string
+	if userID != "" {
+		keys = append(keys, "user:"+userID)
+	}
+	if apiKeyID != "" {
+		keys = append(keys, "api_key:"+apiKeyID)
+	}
+
+	var deadline <-chan time.Time
+	for {
+		l.mu.Lock()
+		full := l.full(keys)
+		if full == "" {
+			for _, key := range keys {
+				l.inFlight[key]++
+			}
+			l.mu.Unlock()
+			return func() { l.release(keys) }, nil
+		}
+
+		if deadline == nil {
+			if l.timeout <= 0 {
+				err := l.errorFor(full)
+				l.mu.Unlock()
+				return nil, err
+			}
+			timer := time.NewTimer(l.timeout)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		freed, ok := l.freed[full]
+		if !ok {
+			freed = make(chan struct{})
+			l.freed[full] = freed
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-deadline:
+			l.mu.Lock()
+			err := l.errorFor(full)
+			l.mu.Unlock()
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// full returns the first of the keys at its limit, or "" if a request may
+// proceed. The caller must hold l.mu.
+func (l *ConcurrencyLimiter) full(keys []string) string {
+	for _, key := range keys {
+		if limit := l.limitFor(key); limit > 0 && l.inFlight[key] >= limit {
+			return key
+		}
+	}
+	return ""
+}
+
+// limitFor returns the limit of an identity key. The caller must hold l.mu.
+func (l *ConcurrencyLimiter) limitFor(key string) int {
+	if strings.HasPrefix(key, "user:") {
+		return l.perUser
+	}
+	return l.perKey
+}
+
+// errorFor explains that key is at its limit. The caller must hold l.mu.
+func (l *ConcurrencyLimiter) errorFor(key string) error {
+	scope, _, _ := strings.Cut(key, ":")
+	return &ConcurrencyError{Scope: scope, Limit: l.limitFor(key)}
+}
+
+func (l *ConcurrencyLimiter) release(keys []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if l.inFlight[key]--; l.inFlight[key] <= 0 {
+			delete(l.inFlight, key)
+		}
+		if ch, ok := l.freed[key]; ok {
+			close(ch)
+			delete(l.freed, key)
+		}
+	}
+}
@@ -1,15 +1,52 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/cache"
 	"github.com/epps11/goguard/internal/database"
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/secretstore"
+	"github.com/epps11/goguard/internal/services/actions"
+	"github.com/epps11/goguard/internal/services/apikey"
 	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/budget"
+	"github.com/epps11/goguard/internal/services/bulk"
+	"github.com/epps11/goguard/internal/services/bundle"
+	"github.com/epps11/goguard/internal/services/canary"
+	"github.com/epps11/goguard/internal/services/capture"
+	"github.com/epps11/goguard/internal/services/conversation"
+	"github.com/epps11/goguard/internal/services/flags"
+	"github.com/epps11/goguard/internal/services/forecast"
+	"github.com/epps11/goguard/internal/services/fx"
+	"github.com/epps11/goguard/internal/services/jobs"
+	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/epps11/goguard/internal/services/moderation"
+	"github.com/epps11/goguard/internal/services/netaccess"
+	"github.com/epps11/goguard/internal/services/pii"
 	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/privacy"
+	"github.com/epps11/goguard/internal/services/quota"
+	"github.com/epps11/goguard/internal/services/reeval"
+	"github.com/epps11/goguard/internal/services/retention"
+	"github.com/epps11/goguard/internal/services/secrets"
 	"github.com/epps11/goguard/internal/services/settings"
+	"github.com/epps11/goguard/internal/services/spending"
+	"github.com/epps11/goguard/internal/services/suppression"
+	"github.com/epps11/goguard/internal/tenant"
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
 // ControlHandler handles control plane API requests
@@ -17,6 +54,36 @@ type ControlHandler struct {
 	policyEngine    *policy.Engine
 	auditLogger     *audit.Logger
 	settingsService *settings.Service
+	captureService  *capture.Service
+	retention       *retention.Service
+	caches          map[string]cache.Cache
+	llmFactory      *llm.ClientFactory
+	modelRegistry   *llm.Registry
+	apiKeys         *apikey.Service
+	quotas          *quota.Service
+	statsPrivacy    *privacy.Policy
+	bundles         *bundle.Service
+	actions         *actions.Dispatcher
+	budgets         *budget.Service
+	forecaster      *forecast.Forecaster
+	flags           *flags.Service
+	network         *netaccess.Service
+	suppressions    *suppression.Service
+	spending        *spending.Tracker
+	canary          *canary.Canary
+	reevaluations   *reeval.Service
+	jobs            *jobs.Queue
+	bulk            *bulk.Service
+	authorize       func(auth.Permission) gin.HandlerFunc
+	fx              *fx.Converter
+	moderator       *moderation.Moderator
+	conversations   *conversation.Store
+	security        *liveSecurity
+	secretStore     *secretstore.Store
+	envelope        *secretstore.Envelope
+	authenticator   *auth.Authenticator
+	sessions        *auth.OIDCProvider
+	tenants         *tenant.Service
 	repo            *database.Repository
 }
 
@@ -30,49 +97,377 @@ func NewControlHandler(engine *policy.Engine, logger *audit.Logger, settingsSvc
 	}
 }
 
+// SetModerator sets the response moderator whose settings are shown with
+// the security settings
+func (h *ControlHandler) SetModerator(moderator *moderation.Moderator) {
+	h.moderator = moderator
+}
+
+// SetLiveSecurity sets where security settings are applied to the running
+// services; without a database, updates are only applied there
+func (h *ControlHandler) SetLiveSecurity(security *liveSecurity) {
+	h.security = security
+}
+
+// SetSecretStore sets the store secret:// references are resolved through
+func (h *ControlHandler) SetSecretStore(store *secretstore.Store) {
+	h.secretStore = store
+}
+
+// SetEnvelope sets the master key stored API keys are encrypted with
+func (h *ControlHandler) SetEnvelope(envelope *secretstore.Envelope) {
+	h.envelope = envelope
+}
+
+// SetConversationStore sets the store of conversation histories
+func (h *ControlHandler) SetConversationStore(store *conversation.Store) {
+	h.conversations = store
+}
+
+// SetBundleService sets the service used to export and apply policy bundles
+func (h *ControlHandler) SetBundleService(svc *bundle.Service) {
+	h.bundles = svc
+}
+
+// SetBudgetService sets the service managing group and project budgets
+func (h *ControlHandler) SetBudgetService(svc *budget.Service) {
+	h.budgets = svc
+}
+
+// SetForecaster sets the forecaster used for month-to-date and projected spend
+func (h *ControlHandler) SetForecaster(f *forecast.Forecaster) {
+	h.forecaster = f
+}
+
+// SetSpendingTracker sets the tracker whose usage records back spending limits
+func (h *ControlHandler) SetSpendingTracker(t *spending.Tracker) {
+	h.spending = t
+}
+
+// SetCanary sets the canary whose results are reported by the control API
+func (h *ControlHandler) SetCanary(c *canary.Canary) {
+	h.canary = c
+}
+
+// SetJobQueue sets the queue long-running operations run on
+func (h *ControlHandler) SetJobQueue(queue *jobs.Queue) {
+	h.jobs = queue
+}
+
+// SetBulkService sets the service running exports, batch scans and imports
+// queued through the jobs API
+func (h *ControlHandler) SetBulkService(svc *bulk.Service) {
+	h.bulk = svc
+}
+
+// SetAuthorizer sets the middleware checking a permission, for endpoints
+// whose permissions depend on what is asked for
+func (h *ControlHandler) SetAuthorizer(authorize func(auth.Permission) gin.HandlerFunc) {
+	h.authorize = authorize
+}
+
+// SetReevaluationService sets the service re-scanning captured prompts
+func (h *ControlHandler) SetReevaluationService(svc *reeval.Service) {
+	h.reevaluations = svc
+}
+
+// SetCurrencyConverter sets the exchange rates spend is reported and limited with
+func (h *ControlHandler) SetCurrencyConverter(c *fx.Converter) {
+	h.fx = c
+}
+
+// SetFeatureFlags sets the feature flag service
+func (h *ControlHandler) SetFeatureFlags(svc *flags.Service) {
+	h.flags = svc
+}
+
+// SetNetworkAccess sets the service managing blocked client addresses
+func (h *ControlHandler) SetNetworkAccess(svc *netaccess.Service) {
+	h.network = svc
+}
+
+// SetSuppressions sets the service managing detection suppressions
+func (h *ControlHandler) SetSuppressions(svc *suppression.Service) {
+	h.suppressions = svc
+}
+
+// SetActionDispatcher sets the dispatcher whose delivery log is served
+func (h *ControlHandler) SetActionDispatcher(d *actions.Dispatcher) {
+	h.actions = d
+}
+
+// SetStatsPrivacy sets the privacy policy applied to aggregate statistics
+func (h *ControlHandler) SetStatsPrivacy(p *privacy.Policy) {
+	h.statsPrivacy = p
+}
+
+// statsPrivacyFor returns the privacy policy for a statistics request, or
+// nil when raw statistics should be returned. Callers can opt in with
+// ?privacy=true; an enforced policy cannot be opted out of.
+func (h *ControlHandler) statsPrivacyFor(c *gin.Context) *privacy.Policy {
+	if h.statsPrivacy == nil {
+		return nil
+	}
+	if h.statsPrivacy.Enforced || c.Query("privacy") == "true" {
+		return h.statsPrivacy
+	}
+	return nil
+}
+
+// SetCaptureService sets the service used to retrieve captured content
+func (h *ControlHandler) SetCaptureService(svc *capture.Service) {
+	h.captureService = svc
+}
+
+// SetRetentionService sets the service used to purge old audit logs
+func (h *ControlHandler) SetRetentionService(svc *retention.Service) {
+	h.retention = svc
+}
+
+// SetCaches sets the named caches exposed for stats and invalidation
+func (h *ControlHandler) SetCaches(caches map[string]cache.Cache) {
+	h.caches = caches
+}
+
+// SetLLMFactory sets the LLM client factory whose client pool is reported
+// and cleared along with the caches
+func (h *ControlHandler) SetLLMFactory(factory *llm.ClientFactory) {
+	h.llmFactory = factory
+}
+
+// SetModelRegistry sets the model capabilities listed by the control API
+func (h *ControlHandler) SetModelRegistry(registry *llm.Registry) {
+	h.modelRegistry = registry
+}
+
+// SetQuotaService sets the service used to report request quota usage
+func (h *ControlHandler) SetQuotaService(svc *quota.Service) {
+	h.quotas = svc
+}
+
+// SetAPIKeyService sets the services used to manage API keys and report permissions
+func (h *ControlHandler) SetAPIKeyService(svc *apikey.Service, authenticator *auth.Authenticator) {
+	h.apiKeys = svc
+	h.authenticator = authenticator
+}
+
+// SetSessions sets the provider whose login sessions users can be logged out of
+func (h *ControlHandler) SetSessions(provider *auth.OIDCProvider) {
+	h.sessions = provider
+}
+
+// SetTenantService sets the service managing the tenants of the deployment
+func (h *ControlHandler) SetTenantService(svc *tenant.Service) {
+	h.tenants = svc
+}
+
+// checkTenant refuses entries assigned to a tenant that doesn't exist.
+// Callers confined to a tenant always create entries in their own.
+func (h *ControlHandler) checkTenant(c *gin.Context, id string) bool {
+	if _, scoped := tenant.FromContext(c.Request.Context()); scoped || id == "" || h.tenants == nil {
+		return true
+	}
+	if _, err := h.tenants.Get(c.Request.Context(), id); err != nil {
+		respondError(c, http.StatusBadRequest, "unknown tenant: "+id)
+		return false
+	}
+	return true
+}
+
 // Policy Handlers
 
 // CreatePolicy creates a new policy
 func (h *ControlHandler) CreatePolicy(c *gin.Context) {
 	var policy models.Policy
-	if err := c.ShouldBindJSON(&policy); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &policy) {
+		return
+	}
+	if !h.checkTenant(c, policy.TenantID) {
 		return
 	}
 
-	created, err := h.policyEngine.CreatePolicy(c.Request.Context(), &policy)
+	created, err := h.policyEngine.CreatePolicy(h.actorContext(c), &policy)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, policyErrorStatus(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
+	h.logPolicyChange(c, created.ID)
 	c.JSON(http.StatusCreated, created)
 }
 
+// maxBatchSize caps the items of a batch create
+const maxBatchSize = 1000
+
+// BatchCreatePolicies creates an array of policies. Either all of them are
+// created or, when any is invalid, none are; the response reports each item.
+func (h *ControlHandler) BatchCreatePolicies(c *gin.Context) {
+	var policies []*models.Policy
+	if !bindBatch(c, &policies) {
+		return
+	}
+
+	results, err := h.policyEngine.CreatePolicies(h.actorContext(c), policies)
+	if !batchResponse(c, results, err) {
+		return
+	}
+
+	ids := make([]string, len(results))
+	names := make([]string, len(results))
+	for i, r := range results {
+		ids[i], names[i] = r.ID, r.Name
+	}
+	h.logBatch(c, models.EventTypePolicyChange, "policy_batch_create", "policy", map[string]interface{}{
+		"count":      len(results),
+		"policy_ids": ids,
+		"names":      names,
+	})
+}
+
+// bindBatch reads a JSON array of at most maxBatchSize items. It decodes
+// without gin's validator, which panics on null items.
+func bindBatch[T any](c *gin.Context, items *[]*T) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(items); err != nil {
+		respondError(c, http.StatusBadRequest, "body must be a JSON array: "+err.Error())
+		return false
+	}
+	if len(*items) == 0 || len(*items) > maxBatchSize {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("a batch holds 1 to %d items", maxBatchSize))
+		return false
+	}
+	for i, item := range *items {
+		if item == nil {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("item %d is null", i))
+			return false
+		}
+	}
+	return true
+}
+
+// batchResponse writes the results of a batch create, reporting whether it
+// succeeded
+func batchResponse(c *gin.Context, results []policy.BatchResult, err error) bool {
+	switch {
+	case errors.Is(err, policy.ErrBatchRejected):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error() + "; nothing was created", "code": models.ErrorCodeForStatus(http.StatusBadRequest), "results": results})
+		return false
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"results": results,
+		"created": len(results),
+		"total":   len(results),
+	})
+	return true
+}
+
+// logBatch records a batch create in a single audit entry
+func (h *ControlHandler) logBatch(c *gin.Context, eventType models.AuditEventType, action, resourceType string, details map[string]interface{}) {
+	h.audit(c, &models.AuditLog{
+		EventType:    eventType,
+		Action:       action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: resourceType,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details:      details,
+	})
+}
+
+// auditedKey marks a request whose handler wrote its own audit entry
+const auditedKey = "audited"
+
+// audit writes an audit entry for a control plane request, marking it so
+// AuditMutations doesn't log it again
+func (h *ControlHandler) audit(c *gin.Context, entry *models.AuditLog) {
+	c.Set(auditedKey, true)
+	h.auditLogger.Log(c.Request.Context(), entry)
+}
+
+// AuditMutations logs each successful control plane change that its handler
+// didn't audit itself, so that no mutation goes unrecorded
+func (h *ControlHandler) AuditMutations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		method := c.Request.Method
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions ||
+			c.Writer.Status() >= http.StatusBadRequest || c.GetBool(auditedKey) || h.auditLogger == nil {
+			return
+		}
+
+		_, route, _ := strings.Cut(c.FullPath(), "/control/")
+		resource, _, _ := strings.Cut(route, "/")
+		resource, _, _ = strings.Cut(resource, ":")
+		eventType := models.EventTypeUserAction
+		if resource == "policies" || resource == "bundle" {
+			eventType = models.EventTypePolicyChange
+		}
+		var resourceID string
+		if len(c.Params) > 0 {
+			resourceID = c.Params[0].Value
+		}
+
+		h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+			EventType:    eventType,
+			Action:       strings.ToLower(method) + " /control/" + route,
+			UserID:       c.GetString("user_id"),
+			UserEmail:    c.GetString("email"),
+			ResourceType: resource,
+			ResourceID:   resourceID,
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+			Status:       models.AuditStatusSuccess,
+			Details: map[string]interface{}{
+				"method": method,
+				"path":   c.Request.URL.Path,
+				"status": c.Writer.Status(),
+			},
+		})
+	}
+}
+
 // GetPolicy retrieves a policy by ID
 func (h *ControlHandler) GetPolicy(c *gin.Context) {
 	id := c.Param("id")
 
 	policy, err := h.policyEngine.GetPolicy(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, http.StatusNotFound, err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, policy)
 }
 
-// ListPolicies lists all policies
+// ListPolicies lists policies, filtered by status and type
 func (h *ControlHandler) ListPolicies(c *gin.Context) {
-	policies, err := h.policyEngine.ListPolicies(c.Request.Context())
+	query, ok := listQuery(c, models.PolicySortFields)
+	if !ok {
+		return
+	}
+
+	if c.Query("deleted") == "true" {
+		deleted := h.policyEngine.DeletedPolicies(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"policies": deleted, "total": len(deleted)})
+		return
+	}
+
+	policies, total, err := h.policyEngine.QueryPolicies(c.Request.Context(), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"policies": policies,
-		"total":    len(policies),
+		"total":    total,
+		"limit":    query.Limit,
+		"offset":   query.Offset,
 	})
 }
 
@@ -81,393 +476,3206 @@ func (h *ControlHandler) UpdatePolicy(c *gin.Context) {
 	id := c.Param("id")
 
 	var policy models.Policy
-	if err := c.ShouldBindJSON(&policy); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &policy) {
 		return
 	}
 
 	policy.ID = id
-	updated, err := h.policyEngine.UpdatePolicy(c.Request.Context(), &policy)
+	updated, err := h.policyEngine.UpdatePolicy(h.actorContext(c), &policy)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, policyErrorStatus(err, http.StatusNotFound), err.Error())
 		return
 	}
 
+	h.logPolicyChange(c, id)
 	c.JSON(http.StatusOK, updated)
 }
 
-// DeletePolicy deletes a policy
+// DeletePolicy soft-deletes a policy. A reason is required.
 func (h *ControlHandler) DeletePolicy(c *gin.Context) {
 	id := c.Param("id")
+	reason, ok := deleteReason(c)
+	if !ok {
+		return
+	}
 
-	if err := h.policyEngine.DeletePolicy(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := h.policyEngine.DeletePolicy(h.actorContext(c), id, reason); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
 		return
 	}
 
+	h.logPolicyChange(c, id)
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// RestorePolicy restores a soft-deleted policy
+func (h *ControlHandler) RestorePolicy(c *gin.Context) {
+	id := c.Param("id")
+
+	restored, err := h.policyEngine.RestorePolicy(h.actorContext(c), id)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.logPolicyChange(c, id)
+	c.JSON(http.StatusOK, restored)
+}
+
+// DeleteRequest is the body of a soft delete
+type DeleteRequest struct {
+	Reason string `json:"reason"` // why the entry is deleted; may be sent as ?reason= instead
+}
+
+// deleteReason reads the reason for a deletion from the JSON body or the
+// reason query parameter, responding with an error when there is none
+func deleteReason(c *gin.Context) (string, bool) {
+	var body DeleteRequest
+	if c.Request.ContentLength != 0 {
+		if err := json.NewDecoder(c.Request.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			respondError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return "", false
+		}
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		reason = strings.TrimSpace(c.Query("reason"))
+	}
+	if reason == "" {
+		respondError(c, http.StatusBadRequest, "a reason is required to delete")
+		return "", false
+	}
+	return reason, true
+}
+
+// ListPolicyVersions returns the version history of a policy, oldest first
+func (h *ControlHandler) ListPolicyVersions(c *gin.Context) {
+	id := c.Param("id")
+
+	versions, err := h.policyEngine.ListPolicyVersions(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": versions,
+		"total":    len(versions),
+	})
+}
+
+// ListActionDeliveries lists recent webhook and email deliveries of policy
+// actions, newest first
+func (h *ControlHandler) ListActionDeliveries(c *gin.Context) {
+	if h.actions == nil {
+		respondError(c, http.StatusServiceUnavailable, "policy actions are not enabled")
+		return
+	}
+
+	policyID := c.Param("id")
+	if policyID == "" {
+		policyID = c.Query("policy_id")
+	}
+	// Deliveries carry no tenant, so confined callers only see those of
+	// their own policies
+	if _, scoped := tenant.FromContext(c.Request.Context()); scoped {
+		if policyID == "" {
+			respondError(c, http.StatusBadRequest, "policy_id is required")
+			return
+		}
+		if _, err := h.policyEngine.GetPolicy(c.Request.Context(), policyID); err != nil {
+			respondError(c, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	deliveries, err := h.actions.List(c.Request.Context(), policyID, c.Query("status"), limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      len(deliveries),
+	})
+}
+
+// RollbackPolicy restores a policy to an earlier version, recording the
+// rollback as a new version
+func (h *ControlHandler) RollbackPolicy(c *gin.Context) {
+	id := c.Param("id")
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		respondError(c, http.StatusBadRequest, "version must be a positive integer")
+		return
+	}
+
+	restored, err := h.policyEngine.RollbackPolicy(h.actorContext(c), id, version)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.logPolicyChange(c, id)
+	c.JSON(http.StatusOK, restored)
+}
+
+// policyErrorStatus maps policy engine errors to HTTP status codes, using
+// fallback for errors that don't indicate invalid input
+func policyErrorStatus(err error, fallback int) int {
+	if errors.Is(err, policy.ErrInvalidPolicy) {
+		return http.StatusBadRequest
+	}
+	return fallback
+}
+
+// actorContext tags the request context with the authenticated caller so policy
+// versions record who made each change
+func (h *ControlHandler) actorContext(c *gin.Context) context.Context {
+	return policy.WithActor(c.Request.Context(), c.GetString("user_id"))
+}
+
+// logPolicyChange records the latest version of a policy in the audit log,
+// including the structured diff of what changed
+func (h *ControlHandler) logPolicyChange(c *gin.Context, policyID string) {
+	version, err := h.policyEngine.LatestPolicyVersion(c.Request.Context(), policyID)
+	if err != nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"version":     version.Version,
+		"change_type": version.ChangeType,
+		"changes":     version.Changes,
+	}
+	if version.Policy.Deleted() {
+		details["reason"] = version.Policy.DeleteReason
+	}
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypePolicyChange,
+		Action:       "policy_" + string(version.ChangeType),
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "policy",
+		ResourceID:   policyID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details:      details,
+	})
+}
+
+// ExportBundle exports all policies and spending limits as a YAML bundle
+// Pass ?format=json for JSON
+func (h *ControlHandler) ExportBundle(c *gin.Context) {
+	b, err := h.bundles.Export(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, b)
+		return
+	}
+
+	data, err := b.YAML()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml", data)
+}
+
+// ApplyBundle creates or updates policies and spending limits from a YAML or
+// JSON bundle. Pass ?dry_run=true to preview the changes and ?prune=true to
+// delete policies missing from the bundle.
+func (h *ControlHandler) ApplyBundle(c *gin.Context) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b, err := bundle.Parse(data)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := bundle.ApplyOptions{
+		DryRun: c.Query("dry_run") == "true",
+		Prune:  c.Query("prune") == "true",
+	}
+	result, err := h.bundles.Apply(h.actorContext(c), b, opts)
+	if result != nil && !opts.DryRun {
+		for _, change := range result.Changes {
+			if change.Kind == "policy" && change.Action != bundle.ActionUnchanged && change.ID != "" {
+				h.logPolicyChange(c, change.ID)
+			}
+		}
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, bundle.ErrInvalidBundle) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "code": models.ErrorCodeForStatus(status), "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetQuotaUsage reports a user's usage of each request quota that applies to them
+func (h *ControlHandler) GetQuotaUsage(c *gin.Context) {
+	userID := c.Query("user_id")
+	if userID == "" {
+		respondError(c, http.StatusBadRequest, "user_id is required")
+		return
+	}
+	if h.quotas == nil {
+		respondError(c, http.StatusServiceUnavailable, "quota service not configured")
+		return
+	}
+
+	quotas := h.policyEngine.ResolveQuotas(c.Request.Context(), userID)
+	usage := h.quotas.Usage(c.Request.Context(), userID, quotas)
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"quotas":  usage,
+		"total":   len(usage),
+	})
+}
+
 // Spending Limit Handlers
 
 // CreateSpendingLimit creates a new spending limit
 func (h *ControlHandler) CreateSpendingLimit(c *gin.Context) {
 	var limit models.SpendingLimit
-	if err := c.ShouldBindJSON(&limit); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &limit) {
+		return
+	}
+	if !h.checkLimitCurrency(c, &limit) || !h.checkTenant(c, limit.TenantID) {
 		return
 	}
 
 	// Use database if available, otherwise fall back to in-memory
 	if h.repo != nil {
+		limit.TenantID = tenant.Assign(c.Request.Context(), limit.TenantID)
 		if err := h.repo.CreateSpendingLimit(c.Request.Context(), &limit); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusCreated, limit)
+		return
+	}
+
+	created, err := h.policyEngine.CreateSpendingLimit(c.Request.Context(), &limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetSpendingLimit retrieves a spending limit by ID
+func (h *ControlHandler) GetSpendingLimit(c *gin.Context) {
+	id := c.Param("id")
+
+	// Use database if available
+	if h.repo != nil {
+		limit, err := h.repo.GetSpendingLimit(c.Request.Context(), id)
+		if err == nil && !tenant.Visible(c.Request.Context(), limit.TenantID) {
+			err = fmt.Errorf("spending limit not found: %s", id)
+		}
+		if err != nil {
+			respondError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		if !h.fillSpend(c, limit) {
 			return
 		}
-		c.JSON(http.StatusCreated, limit)
-		return
+		c.JSON(http.StatusOK, limit)
+		return
+	}
+
+	limit, err := h.policyEngine.GetSpendingLimit(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, limit)
+}
+
+// ListSpendingLimits lists spending limits, filtered by user_id and type
+func (h *ControlHandler) ListSpendingLimits(c *gin.Context) {
+	query, ok := listQuery(c, models.SpendingLimitSortFields)
+	if !ok {
+		return
+	}
+
+	// Use database if available
+	if h.repo != nil {
+		limits, total, err := h.repo.QuerySpendingLimits(c.Request.Context(), query)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !h.fillSpend(c, limits...) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"spending_limits": limits,
+			"total":           total,
+			"limit":           query.Limit,
+			"offset":          query.Offset,
+		})
+		return
+	}
+
+	limits, total, err := h.policyEngine.QuerySpendingLimits(c.Request.Context(), query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"spending_limits": limits,
+		"total":           total,
+		"limit":           query.Limit,
+		"offset":          query.Offset,
+	})
+}
+
+// UpdateSpendingLimit updates a spending limit
+func (h *ControlHandler) UpdateSpendingLimit(c *gin.Context) {
+	id := c.Param("id")
+
+	var limit models.SpendingLimit
+	if !bindJSON(c, &limit) {
+		return
+	}
+
+	if !h.checkLimitCurrency(c, &limit) {
+		return
+	}
+
+	limit.ID = id
+
+	// Use database if available
+	if h.repo != nil {
+		ctx := c.Request.Context()
+		existing, err := h.repo.GetSpendingLimit(ctx, id)
+		if err == nil && !tenant.Visible(ctx, existing.TenantID) {
+			err = fmt.Errorf("spending limit not found: %s", id)
+		}
+		if err == nil {
+			err = h.repo.UpdateSpendingLimit(ctx, &limit)
+		}
+		if err != nil {
+			respondError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		updated, err := h.repo.GetSpendingLimit(ctx, id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Keep the copy loaded at startup current, so a later migration
+		// doesn't write the old settings back
+		engineCopy := *updated
+		h.policyEngine.UpdateSpendingLimit(ctx, &engineCopy)
+		if !h.fillSpend(c, updated) {
+			return
+		}
+		c.JSON(http.StatusOK, updated)
+		return
+	}
+
+	updated, err := h.policyEngine.UpdateSpendingLimit(c.Request.Context(), &limit)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// checkLimitCurrency normalizes a limit's currency, defaulting to USD, and
+// rejects currencies without an exchange rate
+func (h *ControlHandler) checkLimitCurrency(c *gin.Context, limit *models.SpendingLimit) bool {
+	limit.Currency = fx.Normalize(limit.Currency)
+	if limit.Currency == "" {
+		limit.Currency = fx.Base
+	}
+	if limit.Currency == fx.Base || (h.fx != nil && h.fx.Supported(limit.Currency)) {
+		return true
+	}
+	respondError(c, http.StatusBadRequest, fmt.Sprintf("no exchange rate for %s: add one under currency.rates or enable the ECB feed", limit.Currency))
+	return false
+}
+
+// fillSpend derives persisted limits' current spend from usage records,
+// responding with an error and returning false if that fails
+func (h *ControlHandler) fillSpend(c *gin.Context, limits ...*models.SpendingLimit) bool {
+	if h.spending == nil {
+		return true
+	}
+	if err := h.spending.FillSpend(c.Request.Context(), limits...); err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// ListUsageRecords lists per-request usage records for reconciliation, newest
+// first, with totals over everything matching the filters
+func (h *ControlHandler) ListUsageRecords(c *gin.Context) {
+	if h.spending == nil {
+		respondError(c, http.StatusServiceUnavailable, "usage records require a database")
+		return
+	}
+
+	query := &models.UsageQuery{
+		TenantID:  c.Query("tenant_id"),
+		UserID:    c.Query("user_id"),
+		Project:   c.Query("project"),
+		Model:     c.Query("model"),
+		RequestID: c.Query("request_id"),
+		Limit:     100,
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 {
+			query.Limit = min(l, 1000)
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil && o >= 0 {
+			query.Offset = o
+		}
+	}
+	if v := c.Query("start"); v != "" {
+		t, _, err := parseReportDate(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid start: "+err.Error())
+			return
+		}
+		query.StartTime = &t
+	}
+	if v := c.Query("end"); v != "" {
+		t, dateOnly, err := parseReportDate(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid end: "+err.Error())
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		query.EndTime = &t
+	}
+
+	records, summary, err := h.spending.ListUsage(c.Request.Context(), query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"records": records,
+		"total":   summary.Count,
+		"summary": summary,
+		"limit":   query.Limit,
+		"offset":  query.Offset,
+	})
+}
+
+// Model Pricing Handlers
+
+// ListModelPrices returns the effective price table. Pass unit=1K to quote
+// prices per thousand tokens instead of per million.
+func (h *ControlHandler) ListModelPrices(c *gin.Context) {
+	if h.spending == nil {
+		respondError(c, http.StatusServiceUnavailable, "model pricing requires a database")
+		return
+	}
+
+	prices, err := h.spending.ListPrices(c.Query("unit"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"prices": prices, "total": len(prices)})
+}
+
+// GetModelPrice returns the price applied to a model, which may come from a
+// prefix match or the default entry
+func (h *ControlHandler) GetModelPrice(c *gin.Context) {
+	if h.spending == nil {
+		respondError(c, http.StatusServiceUnavailable, "model pricing requires a database")
+		return
+	}
+
+	price, err := h.spending.Price(c.Param("model"), c.Query("unit"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
+
+// SetModelPrice stores a manual price for a model
+func (h *ControlHandler) SetModelPrice(c *gin.Context) {
+	if h.spending == nil {
+		respondError(c, http.StatusServiceUnavailable, "model pricing requires a database")
+		return
+	}
+
+	var price models.ModelPrice
+	if !bindJSON(c, &price) {
+		return
+	}
+	price.Model = c.Param("model")
+
+	stored, err := h.spending.SetPrice(c.Request.Context(), &price)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, spending.ErrInvalidPrice) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, stored)
+}
+
+// DeleteModelPrice removes a stored price so the built-in one applies again
+func (h *ControlHandler) DeleteModelPrice(c *gin.Context) {
+	if h.spending == nil {
+		respondError(c, http.StatusServiceUnavailable, "model pricing requires a database")
+		return
+	}
+
+	if err := h.spending.DeletePrice(c.Request.Context(), c.Param("model")); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// SyncModelPrices pulls the pricing feed now instead of waiting for the
+// next scheduled sync
+func (h *ControlHandler) SyncModelPrices(c *gin.Context) {
+	if h.spending == nil {
+		respondError(c, http.StatusServiceUnavailable, "model pricing requires a database")
+		return
+	}
+
+	result, err := h.spending.SyncPricing(c.Request.Context())
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, spending.ErrNoPriceFeed) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Budget Handlers
+
+// CreateBudget creates a group or project budget
+func (h *ControlHandler) CreateBudget(c *gin.Context) {
+	var b models.Budget
+	if !bindJSON(c, &b) {
+		return
+	}
+	if !h.checkTenant(c, b.TenantID) {
+		return
+	}
+
+	created, err := h.budgets.Create(c.Request.Context(), &b)
+	if err != nil {
+		respondError(c, budgetErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetBudget retrieves a budget by ID
+func (h *ControlHandler) GetBudget(c *gin.Context) {
+	b, err := h.budgets.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// ListBudgets lists all budgets
+func (h *ControlHandler) ListBudgets(c *gin.Context) {
+	budgets, err := h.budgets.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"budgets": budgets,
+		"total":   len(budgets),
+	})
+}
+
+// UpdateBudget updates a budget's settings; its spend in the current period carries over
+func (h *ControlHandler) UpdateBudget(c *gin.Context) {
+	var b models.Budget
+	if !bindJSON(c, &b) {
+		return
+	}
+
+	b.ID = c.Param("id")
+	updated, err := h.budgets.Update(c.Request.Context(), &b)
+	if err != nil {
+		respondError(c, budgetErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteBudget deletes a budget
+func (h *ControlHandler) DeleteBudget(c *gin.Context) {
+	if err := h.budgets.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func budgetErrorStatus(err error) int {
+	if errors.Is(err, budget.ErrInvalidBudget) {
+		return http.StatusBadRequest
+	}
+	return http.StatusNotFound
+}
+
+// GetChargebackReport aggregates spend by project, team and model over a
+// date range. Dates are YYYY-MM-DD (end inclusive) or RFC 3339 timestamps;
+// the range defaults to the current month. Pass format=csv for a spreadsheet.
+func (h *ControlHandler) GetChargebackReport(c *gin.Context) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := now
+
+	if v := c.Query("start"); v != "" {
+		t, _, err := parseReportDate(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid start: "+err.Error())
+			return
+		}
+		start = t
+	}
+	if v := c.Query("end"); v != "" {
+		t, dateOnly, err := parseReportDate(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid end: "+err.Error())
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		end = t
+	}
+
+	report, err := h.budgets.Chargeback(c.Request.Context(), start, end, splitQueryList(c.Query("group_by")))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, budget.ErrInvalidReport) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	// Name the file after the last day included, not the exclusive end
+	filename := fmt.Sprintf("chargeback-%s-%s.csv", start.Format("20060102"), end.Add(-time.Nanosecond).Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	header := append([]string{}, report.GroupBy...)
+	w.Write(append(header, "requests", "prompt_tokens", "completion_tokens", "cost", "currency"))
+	for _, line := range report.Lines {
+		row := make([]string, 0, len(report.GroupBy)+5)
+		for _, d := range report.GroupBy {
+			switch d {
+			case budget.DimensionProject:
+				row = append(row, line.Project)
+			case budget.DimensionTeam:
+				row = append(row, line.Team)
+			case budget.DimensionModel:
+				row = append(row, line.Model)
+			}
+		}
+		row = append(row,
+			strconv.FormatInt(line.RequestCount, 10),
+			strconv.FormatInt(line.PromptTokens, 10),
+			strconv.FormatInt(line.CompletionTokens, 10),
+			strconv.FormatFloat(line.TotalCost, 'f', 6, 64),
+			report.Currency,
+		)
+		w.Write(row)
+	}
+	w.Flush()
+}
+
+// parseReportDate parses a YYYY-MM-DD date or an RFC 3339 timestamp,
+// reporting whether it was a bare date
+func parseReportDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// User Handlers
+
+// CreateUser creates a new user
+func (h *ControlHandler) CreateUser(c *gin.Context) {
+	var user models.User
+	if !bindJSON(c, &user) {
+		return
+	}
+	if !checkSuperAdmin(c, &user) || !h.checkTenant(c, user.TenantID) {
+		return
+	}
+
+	created, err := h.policyEngine.CreateUser(c.Request.Context(), &user)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !h.storeUsers(c, created) {
+		return
+	}
+
+	h.logUserChange(c, "user_create", created, nil)
+	c.JSON(http.StatusCreated, created)
+}
+
+// BatchCreateUsers creates an array of users. Either all of them are
+// created or, when any is invalid, none are; the response reports each item.
+func (h *ControlHandler) BatchCreateUsers(c *gin.Context) {
+	var users []*models.User
+	if !bindBatch(c, &users) || !checkSuperAdmin(c, users...) {
+		return
+	}
+	for _, u := range users {
+		if !h.checkTenant(c, u.TenantID) {
+			return
+		}
+	}
+
+	results, err := h.policyEngine.CreateUsers(c.Request.Context(), users)
+	if err == nil && !h.storeUsers(c, users...) {
+		return
+	}
+	if !batchResponse(c, results, err) {
+		return
+	}
+
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	h.logBatch(c, models.EventTypeUserAction, "user_batch_create", "user", map[string]interface{}{
+		"count":    len(results),
+		"user_ids": ids,
+	})
+}
+
+// GetUser retrieves a user by ID
+func (h *ControlHandler) GetUser(c *gin.Context) {
+	id := c.Param("id")
+
+	user, err := h.policyEngine.GetUser(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ListUsers lists users, filtered by status and role
+func (h *ControlHandler) ListUsers(c *gin.Context) {
+	query, ok := listQuery(c, models.UserSortFields)
+	if !ok {
+		return
+	}
+
+	if c.Query("deleted") == "true" {
+		deleted := h.policyEngine.DeletedUsers(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"users": deleted, "total": len(deleted)})
+		return
+	}
+
+	// Use database if available
+	queryUsers := h.policyEngine.QueryUsers
+	if h.repo != nil {
+		queryUsers = h.repo.QueryUsers
+	}
+	users, total, err := queryUsers(c.Request.Context(), query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":  users,
+		"total":  total,
+		"limit":  query.Limit,
+		"offset": query.Offset,
+	})
+}
+
+// UpdateUser updates a user
+func (h *ControlHandler) UpdateUser(c *gin.Context) {
+	id := c.Param("id")
+
+	var user models.User
+	if !bindJSON(c, &user) {
+		return
+	}
+
+	if !checkSuperAdmin(c, &user) {
+		return
+	}
+
+	user.ID = id
+	updated, err := h.policyEngine.UpdateUser(c.Request.Context(), &user)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if !h.storeUsers(c, updated) {
+		return
+	}
+
+	h.logUserChange(c, "user_update", updated, nil)
+	c.JSON(http.StatusOK, updated)
+}
+
+// checkSuperAdmin refuses super_admin users from callers confined to a
+// tenant, as super admins act across every tenant
+func checkSuperAdmin(c *gin.Context, users ...*models.User) bool {
+	if _, scoped := tenant.FromContext(c.Request.Context()); !scoped {
+		return true
+	}
+	for _, u := range users {
+		if u != nil && u.Role == models.RoleSuperAdmin {
+			respondError(c, http.StatusForbidden, "only callers acting across tenants can manage super_admin users")
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteUser soft-deletes a user and logs them out. A reason is required.
+func (h *ControlHandler) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	reason, ok := deleteReason(c)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.policyEngine.DeleteUser(h.actorContext(c), id, reason)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if !h.storeUsers(c, deleted) {
+		return
+	}
+
+	if h.sessions != nil {
+		if _, err := h.sessions.DeleteUserSessions(c.Request.Context(), id); err != nil {
+			log.Warn().Err(err).Str("user_id", id).Msg("Failed to delete sessions of deleted user")
+		}
+	}
+
+	h.logUserChange(c, "user_delete", deleted, map[string]interface{}{"reason": reason})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// RestoreUser restores a soft-deleted user
+func (h *ControlHandler) RestoreUser(c *gin.Context) {
+	id := c.Param("id")
+
+	restored, err := h.policyEngine.RestoreUser(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if !h.storeUsers(c, restored) {
+		return
+	}
+
+	h.logUserChange(c, "user_restore", restored, nil)
+	c.JSON(http.StatusOK, restored)
+}
+
+// storeUsers writes users changed in the policy engine through to the
+// database, so lists read from it stay complete, responding with an error
+// and returning false if that fails
+func (h *ControlHandler) storeUsers(c *gin.Context, users ...*models.User) bool {
+	if h.repo == nil {
+		return true
+	}
+	for _, u := range users {
+		if err := h.repo.SaveUser(c.Request.Context(), u); err != nil {
+			respondError(c, http.StatusInternalServerError, fmt.Sprintf("failed to store user %s: %v", u.ID, err))
+			return false
+		}
+	}
+	return true
+}
+
+// logUserChange records a change to a user in the audit log
+func (h *ControlHandler) logUserChange(c *gin.Context, action string, user *models.User, details map[string]interface{}) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["email"] = user.Email
+	details["role"] = user.Role
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details:      details,
+	})
+}
+
+// DeleteUserSessions logs a user out of all their dashboard sessions
+func (h *ControlHandler) DeleteUserSessions(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, err := h.policyEngine.GetUser(c.Request.Context(), id); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if h.sessions == nil {
+		respondError(c, http.StatusServiceUnavailable, "sessions are not enabled")
+		return
+	}
+
+	count, err := h.sessions.DeleteUserSessions(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": id, "sessions_deleted": count})
+}
+
+// Audit Log Handlers
+
+// QueryAuditLogs queries audit logs
+func (h *ControlHandler) QueryAuditLogs(c *gin.Context) {
+	query := &models.AuditQuery{}
+
+	if limit := c.Query("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil {
+			query.Limit = l
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			query.Offset = o
+		}
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query.UserID = userID
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		query.RequestID = requestID
+	}
+	if resourceType := c.Query("resource_type"); resourceType != "" {
+		query.ResourceType = resourceType
+	}
+	if status := c.Query("status"); status != "" {
+		query.Status = models.AuditStatus(status)
+	}
+	if tenantID := c.Query("tenant_id"); tenantID != "" {
+		query.TenantID = tenantID
+	}
+	for _, eventType := range splitQueryList(c.Query("event_types")) {
+		query.EventTypes = append(query.EventTypes, models.AuditEventType(eventType))
+	}
+	if v := c.Query("start_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "start_time must be an RFC 3339 timestamp")
+			return
+		}
+		query.StartTime = &t
+	}
+	if v := c.Query("end_time"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "end_time must be an RFC 3339 timestamp")
+			return
+		}
+		query.EndTime = &t
+	}
+
+	logs, total, err := h.auditLogger.Query(c.Request.Context(), query)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":   logs,
+		"total":  total,
+		"limit":  query.Limit,
+		"offset": query.Offset,
+	})
+}
+
+// GetAuditStats returns audit statistics
+func (h *ControlHandler) GetAuditStats(c *gin.Context) {
+	period := c.DefaultQuery("period", "24h")
+
+	stats, err := h.auditLogger.GetStats(c.Request.Context(), period, h.statsPrivacyFor(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// Capture Handlers
+
+// GetAuditRetention returns audit retention settings and purge statistics
+func (h *ControlHandler) GetAuditRetention(c *gin.Context) {
+	c.JSON(http.StatusOK, h.retention.Stats())
+}
+
+// RunAuditRetention runs a retention pass immediately
+// Pass ?dry_run=true to report what would be purged without deleting anything
+func (h *ControlHandler) RunAuditRetention(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	result, err := h.retention.Run(c.Request.Context(), dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": models.ErrorCodeForStatus(http.StatusInternalServerError), "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListCapturedContent lists captured (redacted) prompts and responses
+func (h *ControlHandler) ListCapturedContent(c *gin.Context) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	userID := c.Query("user_id")
+
+	contents, err := h.captureService.List(c.Request.Context(), userID, limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.logCaptureAccess(c, "list", userID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"captures": contents,
+		"total":    len(contents),
+	})
+}
+
+// GetCapturedContent retrieves captured content by capture ID or request ID
+func (h *ControlHandler) GetCapturedContent(c *gin.Context) {
+	id := c.Param("id")
+
+	content, err := h.captureService.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "captured content not found")
+		return
+	}
+
+	h.logCaptureAccess(c, "view", content.ID)
+
+	c.JSON(http.StatusOK, content)
+}
+
+// ListConversations summarizes the tracked conversations, optionally of one user
+func (h *ControlHandler) ListConversations(c *gin.Context) {
+	if h.conversations == nil {
+		respondError(c, http.StatusServiceUnavailable, "conversation tracking is not enabled")
+		return
+	}
+
+	conversations := h.conversations.List(c.Query("user_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": conversations,
+		"total":         len(conversations),
+	})
+}
+
+// GetConversation returns the turns of a user's conversation. They are
+// PII-masked prompts, so viewing them is audited like captured content.
+func (h *ControlHandler) GetConversation(c *gin.Context) {
+	if h.conversations == nil {
+		respondError(c, http.StatusServiceUnavailable, "conversation tracking is not enabled")
+		return
+	}
+
+	conv, ok := h.conversations.Get(c.Query("user_id"), c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "conversation not found")
+		return
+	}
+
+	h.logCaptureAccess(c, "conversation_view", conv.ID)
+	c.JSON(http.StatusOK, conv)
+}
+
+// DeleteConversation forgets a user's conversation, so its next request
+// starts without history
+func (h *ControlHandler) DeleteConversation(c *gin.Context) {
+	if h.conversations == nil {
+		respondError(c, http.StatusServiceUnavailable, "conversation tracking is not enabled")
+		return
+	}
+
+	if !h.conversations.Delete(c.Query("user_id"), c.Param("id")) {
+		respondError(c, http.StatusNotFound, "conversation not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted"})
+}
+
+// CreateReevaluation starts a job re-scanning recent captured prompts with a
+// candidate detection configuration
+func (h *ControlHandler) CreateReevaluation(c *gin.Context) {
+	var req struct {
+		Days int `json:"days"`
+		models.ReevaluationConfig
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	job, err := h.reevaluations.Start(c.Request.Context(), req.Days, req.ReevaluationConfig, c.GetString("user_id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, reeval.ErrInvalidJob):
+			status = http.StatusBadRequest
+		case errors.Is(err, reeval.ErrJobRunning):
+			status = http.StatusConflict
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	h.logCaptureAccess(c, "reevaluate", job.ID)
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListReevaluations lists recent re-evaluation jobs with their summaries
+func (h *ControlHandler) ListReevaluations(c *gin.Context) {
+	jobs, err := h.reevaluations.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs, "total": len(jobs)})
+}
+
+// GetReevaluation returns a re-evaluation job with the captures it changed
+func (h *ControlHandler) GetReevaluation(c *gin.Context) {
+	job, err := h.reevaluations.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, reeval.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// ListJobs lists queued, running and recent jobs, optionally filtered by type
+// and status. Results are left out; they are read through the endpoint of the
+// feature that queued the job.
+func (h *ControlHandler) ListJobs(c *gin.Context) {
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	list, err := h.jobs.List(c.Request.Context(), c.Query("type"), c.Query("status"), limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, job := range list {
+		job.Result = nil
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  list,
+		"total": len(list),
+	})
+}
+
+// GetJob returns a job's status and progress
+func (h *ControlHandler) GetJob(c *gin.Context) {
+	job, err := h.jobs.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	job.Result = nil
+
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob cancels a pending job or stops a running one
+func (h *ControlHandler) CancelJob(c *gin.Context) {
+	job, err := h.jobs.Cancel(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, jobs.ErrJobFinished):
+			status = http.StatusConflict
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	job.Result = nil
+
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "job_cancel",
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "job",
+		ResourceID:   job.ID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details: map[string]interface{}{
+			"type": job.Type,
+		},
+	})
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// jobPermissions are what queueing a job of each type and downloading its
+// result require: the permissions of the endpoint doing the same work
+var jobPermissions = map[string][]auth.Permission{
+	bulk.TypeAuditExport:  {auth.PermAuditRead},
+	bulk.TypeUsageExport:  {auth.PermSpendRead},
+	bulk.TypeBatchScan:    {auth.PermSettingsRead},
+	bulk.TypeBundleImport: {auth.PermPoliciesWrite, auth.PermSpendManage},
+	reeval.JobType:        {auth.PermCapturesRead},
+}
+
+// CreateJob queues an export, batch scan or import. It returns at once; poll
+// the job and download its result once it has completed.
+func (h *ControlHandler) CreateJob(c *gin.Context) {
+	var req models.JobRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if h.bulk == nil || !h.bulk.Handles(req.Type) {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("jobs of type %q can't be created here; use one of %s, %s, %s, %s", req.Type, bulk.TypeAuditExport, bulk.TypeUsageExport, bulk.TypeBatchScan, bulk.TypeBundleImport))
+		return
+	}
+	if !h.permitted(c, jobPermissions[req.Type]) {
+		return
+	}
+
+	job, err := h.bulk.Enqueue(c.Request.Context(), req.Type, req.Params, c.GetString("user_id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, bulk.ErrInvalidJob):
+			status = http.StatusBadRequest
+		case errors.Is(err, bulk.ErrUnavailable):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, jobs.ErrJobActive):
+			status = http.StatusConflict
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	job.Params = nil
+
+	h.logJobAccess(c, "job_create", job)
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetJobResult downloads the result of a completed job. Exports are sent as
+// the file they produced; other results as JSON.
+func (h *ControlHandler) GetJobResult(c *gin.Context) {
+	job, err := h.jobs.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	perms, ok := jobPermissions[job.Type]
+	if !ok {
+		respondError(c, http.StatusNotFound, "jobs of type "+job.Type+" have no downloadable result")
+		return
+	}
+	if !h.permitted(c, perms) {
+		return
+	}
+	if job.Status != models.JobCompleted {
+		message := "job is " + job.Status
+		if job.Error != "" {
+			message += ": " + job.Error
+		}
+		respondError(c, http.StatusConflict, message)
+		return
+	}
+
+	h.logJobAccess(c, "job_result_download", job)
+
+	var file models.JobFile
+	if json.Unmarshal(job.Result, &file) == nil && file.ContentType != "" {
+		c.Header("Content-Disposition", `attachment; filename="`+file.Filename+`"`)
+		c.Data(http.StatusOK, file.ContentType, []byte(file.Content))
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+job.Type+"-"+job.ID+`.json"`)
+	c.Data(http.StatusOK, "application/json", job.Result)
+}
+
+// permitted checks that the caller holds each of perms, responding with 401
+// or 403 if not. Captured prompts always require credentials.
+func (h *ControlHandler) permitted(c *gin.Context, perms []auth.Permission) bool {
+	for _, perm := range perms {
+		check := h.authorize
+		if perm == auth.PermCapturesRead || check == nil {
+			check = h.authenticator.Require
+		}
+		// The middleware's c.Next() is a no-op from the last handler
+		check(perm)(c)
+		if c.IsAborted() {
+			return false
+		}
+	}
+	return true
+}
+
+// logJobAccess records who queued a job or downloaded its result
+func (h *ControlHandler) logJobAccess(c *gin.Context, action string, job *models.Job) {
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "job",
+		ResourceID:   job.ID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details: map[string]interface{}{
+			"type": job.Type,
+		},
+	})
+}
+
+// logCaptureAccess records who accessed captured content
+func (h *ControlHandler) logCaptureAccess(c *gin.Context, action, resourceID string) {
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "capture_" + action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "captured_content",
+		ResourceID:   resourceID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+	})
+}
+
+// Cache Handlers
+
+// GetCacheStats returns hit rate and size statistics for each cache
+func (h *ControlHandler) GetCacheStats(c *gin.Context) {
+	stats := make(map[string]cache.Stats, len(h.caches))
+	for name, cc := range h.caches {
+		stats[name] = cc.Stats()
+	}
+
+	resp := gin.H{
+		"caches": stats,
+		"total":  len(stats),
+	}
+	if h.llmFactory != nil {
+		if pool, ok := h.llmFactory.PoolStats(); ok {
+			resp["llm_client_pool"] = pool
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetScanStats returns how long injection and PII scans take and how many
+// patterns their prefilters skip
+func (h *ControlHandler) GetScanStats(c *gin.Context) {
+	if h.security == nil {
+		respondError(c, http.StatusServiceUnavailable, "scanners not configured")
+		return
+	}
+	resp := gin.H{
+		"injection": h.security.detector.Stats(),
+		"pii":       h.security.masker.Stats(),
+	}
+	if h.suppressions != nil {
+		resp["suppressions"] = h.suppressions.Stats()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// llmClientPool names the LLM client pool for cache invalidation
+const llmClientPool = "llm_clients"
+
+// InvalidateCache clears the cache given by ?name=, or every cache when
+// omitted. The name llm_clients drops the pooled LLM clients.
+func (h *ControlHandler) InvalidateCache(c *gin.Context) {
+	name := c.Query("name")
+	if name != "" && name != llmClientPool {
+		if _, ok := h.caches[name]; !ok {
+			respondError(c, http.StatusNotFound, "cache not found")
+			return
+		}
+	}
+
+	var invalidated []string
+	for cacheName, cc := range h.caches {
+		if name != "" && cacheName != name {
+			continue
+		}
+		if err := cc.Clear(c.Request.Context()); err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		invalidated = append(invalidated, cacheName)
+	}
+	if (name == "" || name == llmClientPool) && h.llmFactory != nil {
+		h.llmFactory.ClearPool()
+		invalidated = append(invalidated, llmClientPool)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invalidated": invalidated})
+}
+
+// PII Pattern Handlers
+
+// piiSettings returns the custom PII types and actions: those saved, or
+// those in effect when there is no database
+func (h *ControlHandler) piiSettings(c *gin.Context) (*models.PIISettings, bool) {
+	if h.security == nil {
+		respondError(c, http.StatusServiceUnavailable, "PII masker not configured")
+		return nil, false
+	}
+	if h.settingsService == nil {
+		current := h.security.masker.Custom()
+		return &current, true
+	}
+	saved, err := h.settingsService.GetPIISettings(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return saved, true
+}
+
+// savePIISettings saves custom PII types and actions and applies them to the
+// masker at once; other instances pick them up when they next poll
+func (h *ControlHandler) savePIISettings(c *gin.Context, s *models.PIISettings) bool {
+	if err := pii.ValidateSettings(*s); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return false
+	}
+	if h.settingsService != nil {
+		if err := h.settingsService.UpdatePIISettings(c.Request.Context(), s); err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return false
+		}
+	}
+	if err := h.security.ApplyPII(s); err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// ListPIIPatterns returns the custom PII types, the actions set for any type
+// and the names of the built-in types
+func (h *ControlHandler) ListPIIPatterns(c *gin.Context) {
+	s, ok := h.piiSettings(c)
+	if !ok {
+		return
+	}
+	patterns := s.Patterns
+	if patterns == nil {
+		patterns = []models.PIIPattern{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patterns":      patterns,
+		"total":         len(patterns),
+		"actions":       s.Actions,
+		"builtin_types": pii.BuiltinTypes(),
+	})
+}
+
+// GetPIIPattern returns a custom PII type by name
+func (h *ControlHandler) GetPIIPattern(c *gin.Context) {
+	s, ok := h.piiSettings(c)
+	if !ok {
+		return
+	}
+	i := slices.IndexFunc(s.Patterns, func(p models.PIIPattern) bool { return p.Name == c.Param("name") })
+	if i < 0 {
+		respondError(c, http.StatusNotFound, "PII pattern not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, s.Patterns[i])
+}
+
+// UpdatePIIPattern creates or replaces a custom PII type. Its matches are
+// masked from the next request on, on every instance.
+func (h *ControlHandler) UpdatePIIPattern(c *gin.Context) {
+	var pattern models.PIIPattern
+	if !bindJSON(c, &pattern) {
+		return
+	}
+	pattern.Name = c.Param("name")
+
+	s, ok := h.piiSettings(c)
+	if !ok {
+		return
+	}
+	status := http.StatusOK
+	if i := slices.IndexFunc(s.Patterns, func(p models.PIIPattern) bool { return p.Name == pattern.Name }); i >= 0 {
+		s.Patterns[i] = pattern
+	} else {
+		s.Patterns = append(s.Patterns, pattern)
+		status = http.StatusCreated
+	}
+	if !h.savePIISettings(c, s) {
+		return
+	}
+
+	c.JSON(status, pattern)
+}
+
+// DeletePIIPattern removes a custom PII type and its action
+func (h *ControlHandler) DeletePIIPattern(c *gin.Context) {
+	s, ok := h.piiSettings(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	i := slices.IndexFunc(s.Patterns, func(p models.PIIPattern) bool { return p.Name == name })
+	if i < 0 {
+		respondError(c, http.StatusNotFound, "PII pattern not found")
+		return
+	}
+	s.Patterns = slices.Delete(s.Patterns, i, i+1)
+	delete(s.Actions, name)
+	if !h.savePIISettings(c, s) {
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// UpdatePIIAction sets what is done with the PII of a built-in or custom
+// type: mask, tokenize, block or allow
+func (h *ControlHandler) UpdatePIIAction(c *gin.Context) {
+	var req struct {
+		Action string `json:"action" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	s, ok := h.piiSettings(c)
+	if !ok {
+		return
+	}
+	piiType := c.Param("type")
+	if s.Actions == nil {
+		s.Actions = make(map[string]string)
+	}
+	s.Actions[piiType] = req.Action
+	if req.Action == pii.ActionMask {
+		// Masking is the default, so it needs no entry
+		delete(s.Actions, piiType)
+	}
+	if !h.savePIISettings(c, s) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"type": piiType, "action": req.Action})
+}
+
+// ResetPIIAction returns a PII type to being masked
+func (h *ControlHandler) ResetPIIAction(c *gin.Context) {
+	s, ok := h.piiSettings(c)
+	if !ok {
+		return
+	}
+	delete(s.Actions, c.Param("type"))
+	if !h.savePIISettings(c, s) {
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Feature Flag Handlers
+
+func flagErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, flags.ErrUnknownFlag):
+		return http.StatusNotFound
+	case errors.Is(err, flags.ErrInvalidFlag):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ListFeatureFlags lists every feature flag with its current settings
+func (h *ControlHandler) ListFeatureFlags(c *gin.Context) {
+	list, err := h.flags.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flags": list,
+		"total": len(list),
+	})
+}
+
+// GetFeatureFlag returns a feature flag by key
+func (h *ControlHandler) GetFeatureFlag(c *gin.Context) {
+	f, err := h.flags.Get(c.Request.Context(), c.Param("key"))
+	if err != nil {
+		respondError(c, flagErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, f)
+}
+
+// UpdateFeatureFlag replaces a feature flag's settings
+func (h *ControlHandler) UpdateFeatureFlag(c *gin.Context) {
+	var f models.FeatureFlag
+	if !bindJSON(c, &f) {
+		return
+	}
+
+	f.Key = c.Param("key")
+	f.UpdatedBy = ""
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		f.UpdatedBy = principal.UserID
+	}
+	updated, err := h.flags.Set(c.Request.Context(), &f)
+	if err != nil {
+		respondError(c, flagErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// ResetFeatureFlag returns a feature flag to its default, off
+func (h *ControlHandler) ResetFeatureFlag(c *gin.Context) {
+	if err := h.flags.Reset(c.Request.Context(), c.Param("key")); err != nil {
+		respondError(c, flagErrorStatus(err), err.Error())
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// EvaluateFeatureFlag reports whether a flag is on for ?user_id= and the
+// comma-separated ?tenants=, to check who a rollout reaches
+func (h *ControlHandler) EvaluateFeatureFlag(c *gin.Context) {
+	key := c.Param("key")
+	if _, err := h.flags.Get(c.Request.Context(), key); err != nil {
+		respondError(c, flagErrorStatus(err), err.Error())
+		return
+	}
+
+	subject := flags.Subject{
+		UserID:  c.Query("user_id"),
+		Tenants: splitQueryList(c.Query("tenants")),
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"key":     key,
+		"user_id": subject.UserID,
+		"tenants": subject.Tenants,
+		"enabled": h.flags.Enabled(c.Request.Context(), key, subject),
+	})
+}
+
+// IP Block Handlers
+
+// CreateIPBlockRequest is the body for blocking a client address
+type CreateIPBlockRequest struct {
+	CIDR             string `json:"cidr" binding:"required"` // address or CIDR range
+	Reason           string `json:"reason"`
+	ExpiresInMinutes int    `json:"expires_in_minutes"` // 0 blocks until removed
+}
+
+// ListIPBlocks lists the blocked addresses, including automatic blocks
+func (h *ControlHandler) ListIPBlocks(c *gin.Context) {
+	blocks, err := h.network.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ip_blocks": blocks,
+		"total":     len(blocks),
+	})
+}
+
+// CreateIPBlock refuses requests from an address or CIDR range
+func (h *ControlHandler) CreateIPBlock(c *gin.Context) {
+	var req CreateIPBlockRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.ExpiresInMinutes < 0 {
+		respondError(c, http.StatusBadRequest, "expires_in_minutes can't be negative")
+		return
+	}
+
+	block := &models.IPBlock{
+		CIDR:      req.CIDR,
+		Reason:    req.Reason,
+		CreatedBy: c.GetString("user_id"),
+	}
+	if req.ExpiresInMinutes > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+		block.ExpiresAt = &expiresAt
+	}
+	created, err := h.network.Block(c.Request.Context(), block)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, netaccess.ErrInvalidCIDR) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	h.logIPBlockAction(c, "create", created)
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeleteIPBlock lifts a block, manual or automatic
+func (h *ControlHandler) DeleteIPBlock(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.network.Unblock(c.Request.Context(), id); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.logIPBlockAction(c, "delete", &models.IPBlock{ID: id})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *ControlHandler) logIPBlockAction(c *gin.Context, action string, block *models.IPBlock) {
+	details := map[string]interface{}{}
+	if block.CIDR != "" {
+		details["cidr"] = block.CIDR
+		details["reason"] = block.Reason
+	}
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "ip_block_" + action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "ip_block",
+		ResourceID:   block.ID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details:      details,
+	})
+}
+
+// Detection Suppression Handlers
+
+// CreateSuppressionRequest is the body for suppressing a detection
+type CreateSuppressionRequest struct {
+	PatternID        string   `json:"pattern_id" binding:"required"` // pattern_id of the detection
+	Users            []string `json:"users"`
+	Groups           []string `json:"groups"`
+	Reason           string   `json:"reason"`
+	ExpiresInMinutes int      `json:"expires_in_minutes"` // 0 suppresses until removed
+}
+
+// ListSuppressions lists the detection suppressions that haven't expired
+func (h *ControlHandler) ListSuppressions(c *gin.Context) {
+	suppressions, err := h.suppressions.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suppressions": suppressions,
+		"total":        len(suppressions),
+	})
+}
+
+// CreateSuppression drops the detections of a pattern for some users or
+// groups
+func (h *ControlHandler) CreateSuppression(c *gin.Context) {
+	var req CreateSuppressionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.ExpiresInMinutes < 0 {
+		respondError(c, http.StatusBadRequest, "expires_in_minutes can't be negative")
+		return
+	}
+	if h.security != nil && !h.security.detector.HasPattern(req.PatternID) {
+		respondError(c, http.StatusBadRequest, "unknown pattern_id: "+req.PatternID)
+		return
+	}
+
+	sup := &models.DetectionSuppression{
+		PatternID: req.PatternID,
+		Users:     req.Users,
+		Groups:    req.Groups,
+		Reason:    req.Reason,
+		CreatedBy: c.GetString("user_id"),
+	}
+	if req.ExpiresInMinutes > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInMinutes) * time.Minute)
+		sup.ExpiresAt = &expiresAt
+	}
+	created, err := h.suppressions.Create(c.Request.Context(), sup)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, suppression.ErrInvalidSuppression) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	h.logSuppressionAction(c, "create", created)
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeleteSuppression removes a detection suppression
+func (h *ControlHandler) DeleteSuppression(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.suppressions.Delete(c.Request.Context(), id); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.logSuppressionAction(c, "delete", &models.DetectionSuppression{ID: id})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *ControlHandler) logSuppressionAction(c *gin.Context, action string, sup *models.DetectionSuppression) {
+	details := map[string]interface{}{}
+	if sup.PatternID != "" {
+		details["pattern_id"] = sup.PatternID
+		details["users"] = sup.Users
+		details["groups"] = sup.Groups
+		details["reason"] = sup.Reason
+	}
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "suppression_" + action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "detection_suppression",
+		ResourceID:   sup.ID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details:      details,
+	})
+}
+
+// Detection Feedback Handlers
+
+// DetectionFeedbackRequest is the body labeling a detection
+type DetectionFeedbackRequest struct {
+	Label   string `json:"label" binding:"required"` // true_positive or false_positive
+	Comment string `json:"comment"`
+}
+
+// SubmitDetectionFeedback labels a detection as right or wrong. The label
+// is kept in the audit log; labeling a detection again replaces its label.
+func (h *ControlHandler) SubmitDetectionFeedback(c *gin.Context) {
+	id := c.Param("id")
+	requestID, patternID, ok := parseDetectionID(id)
+	if !ok {
+		respondError(c, http.StatusBadRequest, "invalid detection ID: "+id)
+		return
+	}
+	var req DetectionFeedbackRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Label != models.FeedbackTruePositive && req.Label != models.FeedbackFalsePositive {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("label must be %s or %s", models.FeedbackTruePositive, models.FeedbackFalsePositive))
+		return
+	}
+
+	feedback := &models.DetectionFeedback{
+		DetectionID: id,
+		RequestID:   requestID,
+		PatternID:   patternID,
+		Label:       req.Label,
+		Comment:     req.Comment,
+		UserID:      c.GetString("user_id"),
+		CreatedAt:   time.Now(),
+	}
+	h.audit(c, &models.AuditLog{
+		Timestamp:    feedback.CreatedAt,
+		EventType:    models.EventTypeUserAction,
+		Action:       audit.ActionDetectionFeedback,
+		RequestID:    requestID,
+		UserID:       feedback.UserID,
+		UserEmail:    c.GetString("email"),
+		ResourceType: "detection",
+		ResourceID:   id,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details: map[string]interface{}{
+			"pattern_id": patternID,
+			"kind":       detectionKind(patternID),
+			"label":      req.Label,
+			"comment":    req.Comment,
+		},
+	})
+
+	c.JSON(http.StatusCreated, feedback)
+}
+
+// GetPatternPrecision returns how many detections of each pattern were
+// labeled right and wrong, noisiest first
+func (h *ControlHandler) GetPatternPrecision(c *gin.Context) {
+	patterns, err := h.auditLogger.PatternPrecision(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range patterns {
+		p := &patterns[i]
+		p.Kind = detectionKind(p.PatternID)
+		switch p.Kind {
+		case detectionInjection:
+			if h.security != nil {
+				p.Pattern, _ = h.security.detector.Pattern(p.PatternID)
+			}
+		case detectionPII:
+			p.Pattern = strings.TrimPrefix(p.PatternID, pii.PatternID(""))
+		case detectionSecret:
+			p.Pattern = strings.TrimPrefix(p.PatternID, secrets.PatternID(""))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patterns": patterns,
+		"total":    len(patterns),
+	})
+}
+
+// API Key Handlers
+
+// CreateAPIKeyRequest is the body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	UserID        string          `json:"user_id"`
+	Role          models.UserRole `json:"role"`
+	Permissions   []string        `json:"permissions"`
+	ExpiresInDays int             `json:"expires_in_days"`
+	TenantID      string          `json:"tenant_id"`
+	AllowedCIDRs  []string        `json:"allowed_cidrs"` // addresses or CIDR ranges the key may be used from
+	LLMProfile    string          `json:"llm_profile"`   // LLM profile of the key's requests that don't name one
+}
+
+// CreateAPIKey issues a new API key. The plaintext key is only returned in this response.
+func (h *ControlHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Role == "" && len(req.Permissions) == 0 {
+		respondError(c, http.StatusBadRequest, "role or permissions is required")
+		return
+	}
+	if !h.checkTenant(c, req.TenantID) {
+		return
+	}
+	// The role travels with the key, so a key can't be made a super admin by
+	// a caller confined to a tenant, whatever permissions it is limited to
+	if _, scoped := tenant.FromContext(c.Request.Context()); scoped && req.Role == models.RoleSuperAdmin {
+		respondError(c, http.StatusForbidden, "only callers acting across tenants can issue super_admin API keys")
+		return
+	}
+
+	allowedNets, err := netaccess.ParsePrefixes(req.AllowedCIDRs)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, ok := h.authenticator.Roles()[string(req.Role)]; req.Role != "" && !ok {
+		respondError(c, http.StatusBadRequest, "unknown role: "+string(req.Role))
+		return
+	}
+	if req.LLMProfile != "" && req.LLMProfile != settings.DefaultLLMProfile && h.settingsService != nil {
+		profiles, err := h.settingsService.GetLLMProfiles(c.Request.Context())
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if _, ok := profiles[req.LLMProfile]; !ok {
+			respondError(c, http.StatusBadRequest, "LLM profile not found: "+req.LLMProfile)
+			return
+		}
+	}
+
+	granted := h.authenticator.RolePermissions(string(req.Role))
+	if len(req.Permissions) > 0 {
+		granted = make([]auth.Permission, 0, len(req.Permissions))
+		for _, p := range req.Permissions {
+			if !isKnownPermission(auth.Permission(p)) {
+				respondError(c, http.StatusBadRequest, "unknown permission: "+p)
+				return
+			}
+			granted = append(granted, auth.Permission(p))
+		}
+	}
+
+	// Callers can't hand out more access than they hold themselves
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		for _, p := range granted {
+			if !principal.Has(p) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error":      "cannot grant a permission you do not hold",
+					"code":       models.ErrCodeForbidden,
+					"permission": p,
+				})
+				return
+			}
+		}
+	}
+
+	key := &models.APIKey{
+		Name:        req.Name,
+		UserID:      req.UserID,
+		Role:        req.Role,
+		Permissions: req.Permissions,
+		LLMProfile:  req.LLMProfile,
+		TenantID:    req.TenantID,
+		CreatedBy:   c.GetString("user_id"),
+	}
+	for _, n := range allowedNets {
+		key.AllowedCIDRs = append(key.AllowedCIDRs, n.String())
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	plaintext, err := h.apiKeys.Create(c.Request.Context(), key)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.logAPIKeyAction(c, "create", key.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     plaintext,
+	})
+}
+
+// ListAPIKeys lists API keys without their secret values
+func (h *ControlHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+		"total":    len(keys),
+	})
+}
+
+// RevokeAPIKey revokes an API key
+func (h *ControlHandler) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+
+	if err := h.apiKeys.Revoke(c.Request.Context(), id); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.logAPIKeyAction(c, "revoke", id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// GetPermissions lists all permissions, the grants for each role, and the caller's own permissions
+func (h *ControlHandler) GetPermissions(c *gin.Context) {
+	resp := gin.H{
+		"permissions": auth.AllPermissions,
+		"roles":       h.authenticator.Roles(),
+	}
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		resp["current"] = principal
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func isKnownPermission(perm auth.Permission) bool {
+	if perm == auth.PermAll {
+		return true
+	}
+	for _, p := range auth.AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// logAPIKeyAction records API key lifecycle events
+func (h *ControlHandler) logAPIKeyAction(c *gin.Context, action, keyID string) {
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "apikey_" + action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "api_key",
+		ResourceID:   keyID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+	})
+}
+
+// Tenant Handlers
+
+func tenantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tenant.ErrInvalidTenant):
+		return http.StatusBadRequest
+	case errors.Is(err, tenant.ErrTenantInUse):
+		return http.StatusConflict
+	}
+	return http.StatusNotFound
+}
+
+// CreateTenant adds a tenant
+func (h *ControlHandler) CreateTenant(c *gin.Context) {
+	var t models.Tenant
+	if !bindJSON(c, &t) {
+		return
+	}
+
+	created, err := h.tenants.Create(c.Request.Context(), &t)
+	if err != nil {
+		respondError(c, tenantErrorStatus(err), err.Error())
+		return
+	}
+
+	h.logTenantAction(c, "create", created.ID)
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetTenant retrieves a tenant by ID
+func (h *ControlHandler) GetTenant(c *gin.Context) {
+	t, err := h.tenants.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// ListTenants lists every tenant, oldest first
+func (h *ControlHandler) ListTenants(c *gin.Context) {
+	list, err := h.tenants.List(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenants": list,
+		"total":   len(list),
+	})
+}
+
+// UpdateTenant changes a tenant's name, description and status. Requests
+// confined to a suspended tenant are refused until it is active again.
+func (h *ControlHandler) UpdateTenant(c *gin.Context) {
+	var t models.Tenant
+	if !bindJSON(c, &t) {
+		return
+	}
+
+	t.ID = c.Param("id")
+	updated, err := h.tenants.Update(c.Request.Context(), &t)
+	if err != nil {
+		respondError(c, tenantErrorStatus(err), err.Error())
+		return
+	}
+
+	h.logTenantAction(c, "update", updated.ID)
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteTenant deletes a tenant that no longer owns users, policies,
+// limits, budgets or API keys
+func (h *ControlHandler) DeleteTenant(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.tenants.Delete(c.Request.Context(), id); err != nil {
+		respondError(c, tenantErrorStatus(err), err.Error())
+		return
+	}
+
+	h.logTenantAction(c, "delete", id)
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *ControlHandler) logTenantAction(c *gin.Context, action, tenantID string) {
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "tenant_" + action,
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "tenant",
+		ResourceID:   tenantID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+	})
+}
+
+// Storage Handlers
+
+// MigrateToDatabase copies in-memory policies, users, and spending limits into Postgres
+// so state configured while running without a database is not lost. When the server
+// started without a database it connects using the GOGUARD_DB_* environment variables;
+// the server must then be restarted to switch to database-backed storage.
+// Pass ?overwrite=true to replace rows that already exist.
+func (h *ControlHandler) MigrateToDatabase(c *gin.Context) {
+	overwrite := c.Query("overwrite") == "true"
+
+	repo := h.repo
+	restartRequired := false
+	if repo == nil {
+		db, err := database.NewFromEnv()
+		if err != nil {
+			respondError(c, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		defer db.Close()
+		repo = database.NewRepository(db)
+		restartRequired = true
+	}
+
+	state := h.policyEngine.ExportState()
+	result, err := repo.ImportState(c.Request.Context(), state.Users, state.Policies, state.SpendingLimits, overwrite)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "storage_migrate",
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "storage",
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details: map[string]interface{}{
+			"imported":  result.Imported,
+			"skipped":   result.Skipped,
+			"overwrite": overwrite,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"imported":         result.Imported,
+		"skipped":          result.Skipped,
+		"conflicts":        result.Conflicts,
+		"restart_required": restartRequired,
+	})
+}
+
+// Event Handlers
+
+// eventHeartbeatInterval keeps idle event streams alive through proxies
+const eventHeartbeatInterval = 15 * time.Second
+
+// StreamEvents pushes new audit entries, alerts, and policy triggers as server-sent events
+// Filters: ?kinds=audit,alert,policy_trigger&event_types=security_alert&user_id=...
+func (h *ControlHandler) StreamEvents(c *gin.Context) {
+	filter := audit.EventFilter{
+		Kinds:      splitQueryList(c.Query("kinds")),
+		EventTypes: splitQueryList(c.Query("event_types")),
+		UserID:     c.Query("user_id"),
+		TenantID:   c.Query("tenant_id"),
+	}
+	if scope, ok := tenant.FromContext(c.Request.Context()); ok {
+		filter.TenantID = scope
+	}
+
+	events, unsubscribe := h.auditLogger.Subscribe(filter)
+	defer unsubscribe()
+
+	// The server write timeout would otherwise cut long-lived streams
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		c.Error(err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Kind, event)
+			return true
+		case <-heartbeat.C:
+			io.WriteString(w, ": heartbeat\n\n")
+			return true
+		}
+	})
+}
+
+// maxListLimit caps the page size of policy, user and spending limit lists
+const maxListLimit = 1000
+
+// listQuery reads the filter, sort and page parameters of a policy, user or
+// spending limit list. sort names one of sortFields, prefixed with - for
+// descending order; without a limit every match is returned. Unknown sort
+// fields get a 400.
+func listQuery(c *gin.Context, sortFields []string) (*models.ListQuery, bool) {
+	query := &models.ListQuery{
+		Status: c.Query("status"),
+		Type:   c.Query("type"),
+		Role:   c.Query("role"),
+		UserID: c.Query("user_id"),
+		Tenant: c.Query("tenant_id"),
+	}
+	if scope, ok := tenant.FromContext(c.Request.Context()); ok {
+		query.Tenant = scope
+	}
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 {
+		query.Limit = min(l, maxListLimit)
+	}
+	if o, err := strconv.Atoi(c.Query("offset")); err == nil && o > 0 {
+		query.Offset = o
+	}
+	if sort := c.Query("sort"); sort != "" {
+		query.Sort, query.Desc = strings.CutPrefix(sort, "-")
+		if !slices.Contains(sortFields, query.Sort) {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("cannot sort by %q (use %s)", query.Sort, strings.Join(sortFields, ", ")))
+			return nil, false
+		}
+	}
+	return query, true
+}
+
+// splitQueryList parses a comma-separated query parameter
+func splitQueryList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Dashboard Handlers
+
+// GetDashboardMetrics returns dashboard metrics over a range, the last 24
+// hours by default
+func (h *ControlHandler) GetDashboardMetrics(c *gin.Context) {
+	query, ok := dashboardQuery(c)
+	if !ok {
+		return
+	}
+
+	p := h.statsPrivacyFor(c)
+	metrics, err := h.auditLogger.GetDashboardMetrics(c.Request.Context(), query, p)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, audit.ErrInvalidDashboardQuery) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	currency, ok := h.spendCurrency(c)
+	if !ok {
+		return
+	}
+
+	if h.forecaster != nil {
+		fc, err := h.forecaster.Forecast(c.Request.Context())
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to forecast spend for dashboard")
+		} else {
+			metrics.Spending.TotalSpendMonth = fc.MonthToDate
+			metrics.Spending.ProjectedSpend = fc.Projected
+			if p != nil {
+				metrics.Spending.TotalSpendMonth = p.Cost(fc.MonthToDate)
+				metrics.Spending.ProjectedSpend = p.Cost(fc.Projected)
+			}
+		}
+	}
+
+	convert := h.spendConverter(currency)
+	metrics.Overview.TotalSpend24h = convert(metrics.Overview.TotalSpend24h)
+	metrics.Spending.TotalSpendToday = convert(metrics.Spending.TotalSpendToday)
+	metrics.Spending.TotalSpendMonth = convert(metrics.Spending.TotalSpendMonth)
+	metrics.Spending.BudgetRemaining = convert(metrics.Spending.BudgetRemaining)
+	metrics.Spending.ProjectedSpend = convert(metrics.Spending.ProjectedSpend)
+	for user, spend := range metrics.Spending.SpendByUser {
+		metrics.Spending.SpendByUser[user] = convert(spend)
+	}
+	for model, spend := range metrics.Spending.SpendByModel {
+		metrics.Spending.SpendByModel[model] = convert(spend)
+	}
+	for i := range metrics.Timeline {
+		metrics.Timeline[i].Cost = convert(metrics.Timeline[i].Cost)
+	}
+	metrics.Spending.Currency = currency
+
+	c.JSON(http.StatusOK, metrics)
+}
+
+// dashboardQuery parses the range of dashboard metrics. Dates are
+// YYYY-MM-DD (end inclusive) or RFC 3339 timestamps; granularity=hour or
+// day sets the buckets of the timeline.
+func dashboardQuery(c *gin.Context) (models.DashboardQuery, bool) {
+	query := models.DashboardQuery{Granularity: c.Query("granularity")}
+	if v := c.Query("start"); v != "" {
+		t, _, err := parseReportDate(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid start: "+err.Error())
+			return query, false
+		}
+		query.Start = t
+	}
+	if v := c.Query("end"); v != "" {
+		t, dateOnly, err := parseReportDate(v)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid end: "+err.Error())
+			return query, false
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		query.End = t
+	}
+	return query, true
+}
+
+// GetMetricsTimeseries returns requests, blocks, tokens and cost by hour or
+// day for charting. The range is parsed like the dashboard's; user_id,
+// group, model and provider narrow the requests counted. A group counts the
+// requests of its current members.
+func (h *ControlHandler) GetMetricsTimeseries(c *gin.Context) {
+	query, ok := dashboardQuery(c)
+	if !ok {
+		return
+	}
+	currency, ok := h.spendCurrency(c)
+	if !ok {
+		return
+	}
+
+	filter := models.MetricsFilter{Model: c.Query("model"), Provider: c.Query("provider")}
+	if userID := c.Query("user_id"); userID != "" {
+		filter.UserIDs = []string{userID}
+	}
+	if group := c.Query("group"); group != "" {
+		users, err := h.policyEngine.ListUsers(c.Request.Context())
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		members := []string{}
+		for _, u := range users {
+			if slices.Contains(u.Groups, group) && (filter.UserIDs == nil || slices.Contains(filter.UserIDs, u.ID)) {
+				members = append(members, u.ID)
+			}
+		}
+		filter.UserIDs = members
+	}
+
+	series, err := h.auditLogger.Timeseries(c.Request.Context(), query, filter, h.statsPrivacyFor(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, audit.ErrInvalidDashboardQuery) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	convert := h.spendConverter(currency)
+	for i := range series.Buckets {
+		series.Buckets[i].Cost = convert(series.Buckets[i].Cost)
+	}
+	series.Currency = currency
+
+	c.JSON(http.StatusOK, series)
+}
+
+// GetPolicyMetrics returns how often a policy triggered, blocked and warned
+// over a range, in total and by hour or day. The range is parsed like the
+// dashboard's.
+func (h *ControlHandler) GetPolicyMetrics(c *gin.Context) {
+	policy, err := h.policyEngine.GetPolicy(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	query, ok := dashboardQuery(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.auditLogger.PolicyMetrics(c.Request.Context(), policy.ID, query)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, audit.ErrInvalidDashboardQuery) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+	report.PolicyName = policy.Name
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetSpendForecast returns month-to-date spend, the projected month-end
+// spend, and the daily history the projection is based on
+func (h *ControlHandler) GetSpendForecast(c *gin.Context) {
+	currency, ok := h.spendCurrency(c)
+	if !ok {
+		return
+	}
+	fc, err := h.forecaster.Forecast(c.Request.Context())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if p := h.statsPrivacyFor(c); p != nil {
+		fc.MonthToDate = p.Cost(fc.MonthToDate)
+		fc.Projected = p.Cost(fc.Projected)
+		for i := range fc.Daily {
+			fc.Daily[i].Cost = p.Cost(fc.Daily[i].Cost)
+		}
+	}
+
+	convert := h.spendConverter(currency)
+	fc.MonthToDate = convert(fc.MonthToDate)
+	fc.Projected = convert(fc.Projected)
+	for i := range fc.Daily {
+		fc.Daily[i].Cost = convert(fc.Daily[i].Cost)
+	}
+	fc.Currency = currency
+
+	c.JSON(http.StatusOK, fc)
+}
+
+// spendCurrency returns the currency to report spend in: the currency query
+// parameter, else the configured display currency. An unknown currency in
+// the query is rejected; an unknown display currency, e.g. before the first
+// rate sync, falls back to USD.
+func (h *ControlHandler) spendCurrency(c *gin.Context) (string, bool) {
+	if code := fx.Normalize(c.Query("currency")); code != "" {
+		if code == fx.Base || (h.fx != nil && h.fx.Supported(code)) {
+			return code, true
+		}
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("no exchange rate for %s", code))
+		return "", false
+	}
+	if h.fx != nil && h.fx.Supported(h.fx.Display()) {
+		return h.fx.Display(), true
+	}
+	return fx.Base, true
+}
+
+// spendConverter returns a function converting USD amounts to a currency
+// spendCurrency accepted
+func (h *ControlHandler) spendConverter(currency string) func(float64) float64 {
+	return func(amount float64) float64 {
+		if h.fx == nil {
+			return amount
+		}
+		converted, err := h.fx.Convert(amount, fx.Base, currency)
+		if err != nil {
+			return amount
+		}
+		return converted
+	}
+}
+
+// GetExchangeRates returns the exchange rates spend is converted with
+func (h *ControlHandler) GetExchangeRates(c *gin.Context) {
+	c.JSON(http.StatusOK, h.fx.Rates())
+}
+
+// SyncExchangeRates pulls the exchange rate feed now
+func (h *ControlHandler) SyncExchangeRates(c *gin.Context) {
+	if err := h.fx.Sync(c.Request.Context()); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, fx.ErrNoFeed) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, h.fx.Rates())
+}
+
+// GetCanaryStatus returns the results of the latest canary run
+func (h *ControlHandler) GetCanaryStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.canary.Status())
+}
+
+// RunCanary sends the canary requests now, e.g. right after a config change,
+// whether or not the periodic canary is enabled
+func (h *ControlHandler) RunCanary(c *gin.Context) {
+	c.JSON(http.StatusOK, h.canary.Run(c.Request.Context()))
+}
+
+// Alert Handlers
+
+// GetAlerts returns alerts
+func (h *ControlHandler) GetAlerts(c *gin.Context) {
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
 	}
 
-	created, err := h.policyEngine.CreateSpendingLimit(c.Request.Context(), &limit)
+	includeAcked := c.Query("include_acked") == "true"
+
+	alerts, err := h.auditLogger.GetAlerts(c.Request.Context(), limit, includeAcked)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusCreated, created)
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"total":  len(alerts),
+	})
 }
 
-// GetSpendingLimit retrieves a spending limit by ID
-func (h *ControlHandler) GetSpendingLimit(c *gin.Context) {
+// AckAlert acknowledges an alert
+func (h *ControlHandler) AckAlert(c *gin.Context) {
 	id := c.Param("id")
+	userID := c.GetString("user_id") // From auth middleware
 
-	// Use database if available
-	if h.repo != nil {
-		limit, err := h.repo.GetSpendingLimit(c.Request.Context(), id)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, limit)
-		return
-	}
-
-	limit, err := h.policyEngine.GetSpendingLimit(c.Request.Context(), id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := h.auditLogger.AckAlert(c.Request.Context(), id, userID); err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, limit)
+	c.JSON(http.StatusOK, gin.H{"acknowledged": true})
 }
 
-// ListSpendingLimits lists all spending limits
-func (h *ControlHandler) ListSpendingLimits(c *gin.Context) {
-	// Use database if available
-	if h.repo != nil {
-		limits, err := h.repo.ListSpendingLimits(c.Request.Context())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+// Settings Handlers
+
+// GetSettings returns all settings
+func (h *ControlHandler) GetSettings(c *gin.Context) {
+	if h.settingsService == nil {
 		c.JSON(http.StatusOK, gin.H{
-			"spending_limits": limits,
-			"total":           len(limits),
+			"llm_provider": "openai",
+			"llm_model":    "gpt-4o",
 		})
 		return
 	}
 
-	limits, err := h.policyEngine.ListSpendingLimits(c.Request.Context())
+	allSettings, err := h.settingsService.GetAllSettings(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"spending_limits": limits,
-		"total":           len(limits),
-	})
+	c.JSON(http.StatusOK, allSettings)
 }
 
-// UpdateSpendingLimit updates a spending limit
-func (h *ControlHandler) UpdateSpendingLimit(c *gin.Context) {
-	id := c.Param("id")
-
-	var limit models.SpendingLimit
-	if err := c.ShouldBindJSON(&limit); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// GetLLMSettings returns LLM configuration
+func (h *ControlHandler) GetLLMSettings(c *gin.Context) {
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"provider": "openai",
+			"model":    "gpt-4o",
+		})
 		return
 	}
 
-	limit.ID = id
-	updated, err := h.policyEngine.UpdateSpendingLimit(c.Request.Context(), &limit)
+	llmSettings, err := h.settingsService.GetLLMSettings(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, updated)
+	resp := *llmSettings
+	resp.Status = h.settingsService.GetLLMStatus(settings.DefaultLLMProfile)
+	c.JSON(http.StatusOK, resp)
 }
 
-// User Handlers
-
-// CreateUser creates a new user
-func (h *ControlHandler) CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// UpdateLLMSettings updates LLM configuration
+func (h *ControlHandler) UpdateLLMSettings(c *gin.Context) {
+	var req settings.LLMSettings
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	created, err := h.policyEngine.CreateUser(c.Request.Context(), &user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "settings updated (in-memory only)"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, created)
-}
-
-// GetUser retrieves a user by ID
-func (h *ControlHandler) GetUser(c *gin.Context) {
-	id := c.Param("id")
+	// Validate on save unless explicitly skipped; ?force=true saves failing settings anyway
+	var status *settings.LLMStatus
+	if c.Query("validate") != "false" {
+		status = h.settingsService.ValidateLLMSettings(c.Request.Context(), settings.DefaultLLMProfile, &req)
+		if status.Status == settings.LLMStatusError && c.Query("force") != "true" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "LLM settings failed validation",
+				"code":   models.ErrCodeLLMSettingsInvalid,
+				"status": status,
+			})
+			return
+		}
+	}
 
-	user, err := h.policyEngine.GetUser(c.Request.Context(), id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	if err := h.settingsService.UpdateLLMSettings(c.Request.Context(), &req); err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if status != nil {
+		h.settingsService.SetLLMStatus(settings.DefaultLLMProfile, status)
+	}
 
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, gin.H{"message": "LLM settings updated", "status": status})
 }
 
-// ListUsers lists all users
-func (h *ControlHandler) ListUsers(c *gin.Context) {
-	users, err := h.policyEngine.ListUsers(c.Request.Context())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// GetLLMStatus returns the last validation status of all LLM profiles
+func (h *ControlHandler) GetLLMStatus(c *gin.Context) {
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{"statuses": gin.H{}})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"users": users,
-		"total": len(users),
-	})
+	c.JSON(http.StatusOK, gin.H{"statuses": h.settingsService.GetAllLLMStatuses()})
 }
 
-// UpdateUser updates a user
-func (h *ControlHandler) UpdateUser(c *gin.Context) {
-	id := c.Param("id")
+// ListSecrets lists the secret references fetched so far, without their values
+func (h *ControlHandler) ListSecrets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"secrets": h.secretStore.Statuses()})
+}
 
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// RefreshSecrets fetches every secret again, so a rotated secret is used
+// without waiting for the cache to expire
+func (h *ControlHandler) RefreshSecrets(c *gin.Context) {
+	secrets := h.secretStore.Refresh(c.Request.Context())
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "secrets_refresh",
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "secrets",
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details: map[string]interface{}{
+			"count": len(secrets),
+		},
+	})
+	c.JSON(http.StatusOK, gin.H{"secrets": secrets})
+}
+
+// RotateEncryption re-encrypts stored API keys under the current master key,
+// so previous master keys can be retired
+func (h *ControlHandler) RotateEncryption(c *gin.Context) {
+	if !h.envelope.Enabled() {
+		respondError(c, http.StatusBadRequest, "no master key is set (encryption.master_key, GOGUARD_MASTER_KEY or GOGUARD_KMS_KEY_ID)")
+		return
+	}
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "nothing to rotate (in-memory only)", "rotated": 0})
 		return
 	}
 
-	user.ID = id
-	updated, err := h.policyEngine.UpdateUser(c.Request.Context(), &user)
+	rotated, err := h.settingsService.RotateEncryption(c.Request.Context())
+	status := models.AuditStatusSuccess
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		status = models.AuditStatusFailure
+	}
+	h.audit(c, &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       "encryption_rotate",
+		UserID:       c.GetString("user_id"),
+		UserEmail:    c.GetString("email"),
+		ResourceType: "settings",
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       status,
+		Details: map[string]interface{}{
+			"key_id":  h.envelope.KeyID(),
+			"rotated": rotated,
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": models.ErrorCodeForStatus(http.StatusInternalServerError), "rotated": rotated})
 		return
 	}
 
-	c.JSON(http.StatusOK, updated)
+	c.JSON(http.StatusOK, gin.H{"key_id": h.envelope.KeyID(), "rotated": rotated})
 }
 
-// DeleteUser deletes a user
-func (h *ControlHandler) DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-
-	if err := h.policyEngine.DeleteUser(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+// ValidateLLMSettings re-validates all stored LLM profiles immediately
+func (h *ControlHandler) ValidateLLMSettings(c *gin.Context) {
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{"statuses": gin.H{}})
 		return
 	}
 
-	c.JSON(http.StatusNoContent, nil)
+	statuses := h.settingsService.ValidateAllLLMProfiles(c.Request.Context())
+	c.JSON(http.StatusOK, gin.H{"statuses": statuses})
 }
 
-// Audit Log Handlers
-
-// QueryAuditLogs queries audit logs
-func (h *ControlHandler) QueryAuditLogs(c *gin.Context) {
-	query := &models.AuditQuery{}
-
-	if limit := c.Query("limit"); limit != "" {
-		if l, err := strconv.Atoi(limit); err == nil {
-			query.Limit = l
-		}
-	}
-	if offset := c.Query("offset"); offset != "" {
-		if o, err := strconv.Atoi(offset); err == nil {
-			query.Offset = o
-		}
-	}
-	if userID := c.Query("user_id"); userID != "" {
-		query.UserID = userID
-	}
-	if resourceType := c.Query("resource_type"); resourceType != "" {
-		query.ResourceType = resourceType
-	}
-	if status := c.Query("status"); status != "" {
-		query.Status = models.AuditStatus(status)
+// ListLLMProfiles returns all named LLM profiles
+func (h *ControlHandler) ListLLMProfiles(c *gin.Context) {
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"profiles": gin.H{},
+			"total":    0,
+		})
+		return
 	}
 
-	logs, total, err := h.auditLogger.Query(c.Request.Context(), query)
+	profiles, err := h.settingsService.GetLLMProfiles(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	resp := make(map[string]settings.LLMSettings, len(profiles))
+	for name, profile := range profiles {
+		p := *profile
+		p.Status = h.settingsService.GetLLMStatus(name)
+		resp[name] = p
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"logs":   logs,
-		"total":  total,
-		"limit":  query.Limit,
-		"offset": query.Offset,
+		"profiles": resp,
+		"total":    len(resp),
 	})
 }
 
-// GetAuditStats returns audit statistics
-func (h *ControlHandler) GetAuditStats(c *gin.Context) {
-	period := c.DefaultQuery("period", "24h")
+// SaveLLMProfile creates or replaces a named LLM profile
+func (h *ControlHandler) SaveLLMProfile(c *gin.Context) {
+	name := c.Param("name")
 
-	stats, err := h.auditLogger.GetStats(c.Request.Context(), period)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	var req settings.LLMSettings
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	c.JSON(http.StatusOK, stats)
-}
+	if h.settingsService == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "settings updated (in-memory only)"})
+		return
+	}
 
-// Dashboard Handlers
+	var status *settings.LLMStatus
+	if c.Query("validate") != "false" {
+		status = h.settingsService.ValidateLLMSettings(c.Request.Context(), name, &req)
+		if status.Status == settings.LLMStatusError && c.Query("force") != "true" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":  "LLM profile failed validation",
+				"code":   models.ErrCodeLLMSettingsInvalid,
+				"status": status,
+			})
+			return
+		}
+	}
 
-// GetDashboardMetrics returns dashboard metrics
-func (h *ControlHandler) GetDashboardMetrics(c *gin.Context) {
-	metrics, err := h.auditLogger.GetDashboardMetrics(c.Request.Context())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.settingsService.SaveLLMProfile(c.Request.Context(), name, &req); err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if status != nil {
+		h.settingsService.SetLLMStatus(name, status)
+	}
 
-	c.JSON(http.StatusOK, metrics)
+	c.JSON(http.StatusOK, gin.H{"message": "LLM profile saved", "profile": name, "status": status})
 }
 
-// Alert Handlers
+// DeleteLLMProfile deletes a named LLM profile
+func (h *ControlHandler) DeleteLLMProfile(c *gin.Context) {
+	name := c.Param("name")
 
-// GetAlerts returns alerts
-func (h *ControlHandler) GetAlerts(c *gin.Context) {
-	limit := 50
-	if l := c.Query("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			limit = parsed
-		}
+	if h.settingsService == nil {
+		c.JSON(http.StatusNoContent, nil)
+		return
 	}
 
-	includeAcked := c.Query("include_acked") == "true"
+	if err := h.settingsService.DeleteLLMProfile(c.Request.Context(), name); err != nil {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
 
-	alerts, err := h.auditLogger.GetAlerts(c.Request.Context(), limit, includeAcked)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ListModelCapabilities returns the context windows and capabilities
+// requests are checked against
+func (h *ControlHandler) ListModelCapabilities(c *gin.Context) {
+	if h.modelRegistry == nil {
+		c.JSON(http.StatusOK, gin.H{"models": []models.ModelCapabilities{}, "total": 0, "clamp_max_tokens": false})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"alerts": alerts,
-		"total":  len(alerts),
-	})
+	list := h.modelRegistry.List()
+	c.JSON(http.StatusOK, gin.H{"models": list, "total": len(list), "clamp_max_tokens": h.modelRegistry.Clamp()})
 }
 
-// AckAlert acknowledges an alert
-func (h *ControlHandler) AckAlert(c *gin.Context) {
-	id := c.Param("id")
-	userID := c.GetString("user_id") // From auth middleware
+// GetModelCapabilities returns the capabilities applied to a model, which
+// may come from a prefix match
+func (h *ControlHandler) GetModelCapabilities(c *gin.Context) {
+	if h.modelRegistry == nil {
+		respondError(c, http.StatusNotFound, "no capabilities known for model")
+		return
+	}
 
-	if err := h.auditLogger.AckAlert(c.Request.Context(), id, userID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	caps, ok := h.modelRegistry.Lookup(c.Param("model"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "no capabilities known for model")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"acknowledged": true})
+	c.JSON(http.StatusOK, caps)
 }
 
-// Settings Handlers
-
-// GetSettings returns all settings
-func (h *ControlHandler) GetSettings(c *gin.Context) {
+// ListModelAliases returns all model aliases
+func (h *ControlHandler) ListModelAliases(c *gin.Context) {
 	if h.settingsService == nil {
-		c.JSON(http.StatusOK, gin.H{
-			"llm_provider": "openai",
-			"llm_model":    "gpt-4o",
-		})
+		c.JSON(http.StatusOK, gin.H{"aliases": []*models.ModelAlias{}, "total": 0})
 		return
 	}
 
-	allSettings, err := h.settingsService.GetAllSettings(c.Request.Context())
+	aliases, err := h.settingsService.ListModelAliases(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, allSettings)
+	c.JSON(http.StatusOK, gin.H{"aliases": aliases, "total": len(aliases)})
 }
 
-// GetLLMSettings returns LLM configuration
-func (h *ControlHandler) GetLLMSettings(c *gin.Context) {
+// GetModelAlias returns a model alias
+func (h *ControlHandler) GetModelAlias(c *gin.Context) {
 	if h.settingsService == nil {
-		c.JSON(http.StatusOK, gin.H{
-			"provider": "openai",
-			"model":    "gpt-4o",
-		})
+		respondError(c, http.StatusNotFound, "model alias not found")
 		return
 	}
 
-	llmSettings, err := h.settingsService.GetLLMSettings(c.Request.Context())
+	aliases, err := h.settingsService.GetModelAliases(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	alias, ok := aliases[c.Param("name")]
+	if !ok {
+		respondError(c, http.StatusNotFound, "model alias not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, llmSettings)
+	c.JSON(http.StatusOK, alias)
 }
 
-// UpdateLLMSettings updates LLM configuration
-func (h *ControlHandler) UpdateLLMSettings(c *gin.Context) {
-	var req settings.LLMSettings
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+// SaveModelAlias creates or replaces a model alias, switching the model of
+// every request sending it
+func (h *ControlHandler) SaveModelAlias(c *gin.Context) {
+	var req models.ModelAlias
+	if !bindJSON(c, &req) {
 		return
 	}
+	req.Name = c.Param("name")
 
 	if h.settingsService == nil {
-		c.JSON(http.StatusOK, gin.H{"message": "settings updated (in-memory only)"})
+		respondError(c, http.StatusServiceUnavailable, "model aliases require a database")
 		return
 	}
 
-	if err := h.settingsService.UpdateLLMSettings(c.Request.Context(), &req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.settingsService.SaveModelAlias(c.Request.Context(), &req); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, settings.ErrInvalidModelAlias) {
+			status = http.StatusBadRequest
+		}
+		respondError(c, status, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, req)
+}
+
+// DeleteModelAlias deletes a model alias
+func (h *ControlHandler) DeleteModelAlias(c *gin.Context) {
+	if h.settingsService == nil {
+		respondError(c, http.StatusNotFound, "model alias not found")
+		return
+	}
+
+	if err := h.settingsService.DeleteModelAlias(c.Request.Context(), c.Param("name")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, settings.ErrModelAliasNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(c, status, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "LLM settings updated"})
+	c.JSON(http.StatusNoContent, nil)
 }
 
 // GetSecuritySettings returns security configuration
 func (h *ControlHandler) GetSecuritySettings(c *gin.Context) {
+	var moderationSettings *models.ModerationSettings
+	if h.moderator != nil {
+		effective := h.moderator.Settings(c.Request.Context())
+		moderationSettings = &effective
+	}
+
 	if h.settingsService == nil {
-		c.JSON(http.StatusOK, gin.H{
-			"injection_detection_enabled": true,
-			"pii_masking_enabled":         true,
-			"rate_limit_per_minute":       100,
-		})
+		current := h.security.Settings()
+		current.Moderation = moderationSettings
+		c.JSON(http.StatusOK, current)
 		return
 	}
 
 	secSettings, err := h.settingsService.GetSecuritySettings(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	// Without saved settings, show the config file's
+	if secSettings.Moderation == nil {
+		secSettings.Moderation = moderationSettings
+	}
 
 	c.JSON(http.StatusOK, secSettings)
 }
@@ -475,18 +3683,24 @@ func (h *ControlHandler) GetSecuritySettings(c *gin.Context) {
 // UpdateSecuritySettings updates security configuration
 func (h *ControlHandler) UpdateSecuritySettings(c *gin.Context) {
 	var req settings.SecuritySettings
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
+	if req.Moderation != nil {
+		if err := moderation.ValidateSettings(*req.Moderation); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
 
 	if h.settingsService == nil {
+		h.security.Apply(&req)
 		c.JSON(http.StatusOK, gin.H{"message": "settings updated (in-memory only)"})
 		return
 	}
 
 	if err := h.settingsService.UpdateSecuritySettings(c.Request.Context(), &req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
@@ -496,13 +3710,19 @@ func (h *ControlHandler) UpdateSecuritySettings(c *gin.Context) {
 // GetStorageInfo returns information about the storage backend
 func (h *ControlHandler) GetStorageInfo(c *gin.Context) {
 	storageType := "in-memory"
-	if h.settingsService != nil {
+	if h.repo != nil {
 		storageType = "postgresql"
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	info := gin.H{
 		"storage_type":        storageType,
 		"audit_log_retention": 10000,
-		"database_connected":  h.settingsService != nil,
-	})
+		"database_connected":  h.repo != nil,
+	}
+	if h.repo != nil {
+		persistence := h.repo.PersistenceStatus()
+		info["database_connected"] = !persistence.Degraded
+		info["persistence"] = persistence
+	}
+	c.JSON(http.StatusOK, info)
 }
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/auth"
+)
+
+// maxStackGroups bounds the goroutine stacks a runtime snapshot lists
+const maxStackGroups = 100
+
+// registerDebugRoutes serves the profiling endpoints of net/http/pprof and
+// expvar, and a runtime snapshot, to callers with the debug:read
+// permission. Profiles can show any tenant's data held in memory, so callers
+// confined to a tenant other than the default one are refused. Like captured
+// content, they always require credentials.
+func (r *Router) registerDebugRoutes() {
+	debug := r.engine.Group("/debug", r.scope(), deploymentWide(), r.authenticator.Require(auth.PermDebug))
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	// heap, goroutine, allocs, block, mutex and threadcreate
+	debug.GET("/pprof/:profile", gin.WrapF(pprof.Index))
+	debug.GET("/vars", gin.WrapH(expvar.Handler()))
+	debug.GET("/runtime", r.runtimeSnapshot)
+
+	log.Info().Msg("Debug endpoints enabled under /debug")
+}
+
+// runtimeSnapshot returns the memory and GC statistics of the process and
+// its goroutines grouped by stack, largest groups first. stacks limits the
+// groups listed (20 by default).
+func (r *Router) runtimeSnapshot(c *gin.Context) {
+	limit := 20
+	if v := c.Query("stacks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			respondError(c, http.StatusBadRequest, "stacks must be a non-negative integer")
+			return
+		}
+		limit = min(n, maxStackGroups)
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	var lastPause time.Duration
+	if mem.NumGC > 0 {
+		lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	groups := goroutineGroups()
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp":  time.Now(),
+		"uptime":     time.Since(r.handler.startTime).String(),
+		"go_version": runtime.Version(),
+		"num_cpu":    runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"goroutines": runtime.NumGoroutine(),
+		"memory": gin.H{
+			"heap_alloc_bytes":    mem.HeapAlloc,
+			"heap_inuse_bytes":    mem.HeapInuse,
+			"heap_idle_bytes":     mem.HeapIdle,
+			"heap_released_bytes": mem.HeapReleased,
+			"heap_objects":        mem.HeapObjects,
+			"stack_inuse_bytes":   mem.StackInuse,
+			"sys_bytes":           mem.Sys,
+			"total_alloc_bytes":   mem.TotalAlloc,
+			"next_gc_bytes":       mem.NextGC,
+			"num_gc":              mem.NumGC,
+			"gc_cpu_fraction":     mem.GCCPUFraction,
+			"gc_pause_total_ms":   float64(mem.PauseTotalNs) / float64(time.Millisecond),
+			"gc_last_pause_ms":    float64(lastPause) / float64(time.Millisecond),
+			"last_gc":             time.Unix(0, int64(mem.LastGC)),
+		},
+		"stack_groups": groups[:min(limit, len(groups))],
+		"total_groups": len(groups),
+	})
+}
+
+// goroutineGroup is the number of goroutines with the same stack
+type goroutineGroup struct {
+	Count int      `json:"count"`
+	Stack []string `json:"stack"` // innermost function first
+}
+
+// goroutineGroups groups the running goroutines by stack
+func goroutineGroups() []goroutineGroup {
+	// The profile can grow between the calls
+	records := make([]runtime.StackRecord, runtime.NumGoroutine()+10)
+	n, ok := runtime.GoroutineProfile(records)
+	for !ok {
+		records = make([]runtime.StackRecord, n+10)
+		n, ok = runtime.GoroutineProfile(records)
+	}
+
+	byStack := make(map[string]*goroutineGroup)
+	for _, record := range records[:n] {
+		var stack []string
+		frames := runtime.CallersFrames(record.Stack())
+		for {
+			frame, more := frames.Next()
+			stack = append(stack, frame.Function+" "+frame.File+":"+strconv.Itoa(frame.Line))
+			if !more {
+				break
+			}
+		}
+		key := strings.Join(stack, "\n")
+		if g, ok := byStack[key]; ok {
+			g.Count++
+			continue
+		}
+		byStack[key] = &goroutineGroup{Count: 1, Stack: stack}
+	}
+
+	groups := make([]goroutineGroup, 0, len(byStack))
+	for _, g := range byStack {
+		groups = append(groups, *g)
+	}
+	slices.SortFunc(groups, func(a, b goroutineGroup) int { return b.Count - a.Count })
+	return groups
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/epps11/goguard/internal/services/secrets"
+)
+
+// detectionSeparator joins the request and pattern IDs of a detection ID.
+// Pattern IDs never contain it.
+const detectionSeparator = "~"
+
+// Kinds of detections, by the prefix of their pattern IDs
+const (
+	detectionInjection = "injection"
+	detectionPII       = "pii"
+	detectionSecret    = "secret"
+)
+
+// detectionID names the findings of a pattern in a request. Findings of the
+// same pattern in one request share it, so they are labeled together.
+func detectionID(requestID, patternID string) string {
+	return requestID + detectionSeparator + patternID
+}
+
+// parseDetectionID returns the request and pattern IDs of a detection ID
+func parseDetectionID(id string) (requestID, patternID string, ok bool) {
+	i := strings.LastIndex(id, detectionSeparator)
+	if i <= 0 || detectionKind(id[i+1:]) == "" {
+		return "", "", false
+	}
+	return id[:i], id[i+1:], true
+}
+
+// detectionKind returns what made the detections of a pattern ID, or "" for
+// IDs no detector gives
+func detectionKind(patternID string) string {
+	switch {
+	case strings.HasPrefix(patternID, injection.PatternIDPrefix):
+		return detectionInjection
+	case strings.HasPrefix(patternID, pii.PatternID("")):
+		return detectionPII
+	case strings.HasPrefix(patternID, secrets.PatternID("")):
+		return detectionSecret
+	}
+	return ""
+}
+
+// setDetectionIDs gives the findings of a request's reports the IDs feedback
+// is sent for. Nil reports are skipped.
+func setDetectionIDs(requestID string, security *models.SecurityReport, piiReport *models.PIIReport, secretsReport *models.SecretsReport) {
+	if security != nil {
+		for i, det := range security.Detections {
+			security.Detections[i].DetectionID = detectionID(requestID, det.PatternID)
+		}
+		for i, det := range security.Suppressed {
+			security.Suppressed[i].DetectionID = detectionID(requestID, det.PatternID)
+		}
+	}
+	if piiReport != nil {
+		for i, match := range piiReport.PIITypes {
+			piiReport.PIITypes[i].DetectionID = detectionID(requestID, pii.PatternID(match.Type))
+		}
+	}
+	if secretsReport != nil {
+		for i, finding := range secretsReport.Findings {
+			secretsReport.Findings[i].DetectionID = detectionID(requestID, secrets.PatternID(finding.Type))
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// registerValidation makes validation errors name fields by their JSON names
+func registerValidation() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// respondError sends an ErrorResponse with the generic code of status
+func respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.ErrorResponse{Error: message, Code: models.ErrorCodeForStatus(status)})
+}
+
+// ListErrorCodes returns the catalog of codes sent in error responses
+func ListErrorCodes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"error_codes": models.ErrorCatalog,
+		"total":       len(models.ErrorCatalog),
+	})
+}
+
+// bindJSON decodes the request body into dest and checks its binding tags.
+// When that fails it responds with INVALID_REQUEST, listing the invalid
+// fields, and returns false.
+func bindJSON(c *gin.Context, dest interface{}) bool {
+	if err := c.ShouldBindJSON(dest); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest(err))
+		return false
+	}
+	return true
+}
+
+// invalidRequest describes why a body couldn't be bound
+func invalidRequest(err error) models.ErrorResponse {
+	resp := models.ErrorResponse{Error: "Invalid request body", Code: models.ErrCodeInvalidRequest}
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fe := range validationErrs {
+			resp.Fields = append(resp.Fields, models.FieldError{Field: fieldPath(fe), Message: validationMessage(fe)})
+		}
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		resp.Fields = []models.FieldError{{Field: field, Message: "must be " + jsonTypeName(typeErr.Type)}}
+	case errors.As(err, &syntaxErr):
+		resp.Details = fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.Is(err, io.EOF):
+		resp.Details = "the body is empty"
+	default:
+		resp.Details = err.Error()
+	}
+
+	if len(resp.Fields) > 0 {
+		return invalidFields(resp.Fields)
+	}
+	return resp
+}
+
+// invalidFields returns the error for a body that binds but fails checks
+// beyond its struct tags
+func invalidFields(fields []models.FieldError) models.ErrorResponse {
+	problems := make([]string, len(fields))
+	for i, f := range fields {
+		problems[i] = f.Field + " " + f.Message
+	}
+	return models.ErrorResponse{
+		Error:   "Invalid request body",
+		Code:    models.ErrCodeInvalidRequest,
+		Details: strings.Join(problems, "; "),
+		Fields:  fields,
+	}
+}
+
+// fieldPath returns the JSON path of a field, e.g. messages[0].role
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return "must have at least " + fe.Param() + " items"
+		case reflect.String:
+			return "must be at least " + fe.Param() + " characters"
+		}
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		switch fe.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return "must have at most " + fe.Param() + " items"
+		case reflect.String:
+			return "must be at most " + fe.Param() + " characters"
+		}
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "eq":
+		return "must be " + fe.Param()
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+// jsonTypeName names the JSON type a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
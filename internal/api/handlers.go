@@ -1,28 +1,75 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 
+	"github.com/epps11/goguard/internal/auth"
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/requestid"
+	"github.com/epps11/goguard/internal/services/anomaly"
 	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/budget"
+	"github.com/epps11/goguard/internal/services/canary"
+	"github.com/epps11/goguard/internal/services/capture"
+	"github.com/epps11/goguard/internal/services/conversation"
+	"github.com/epps11/goguard/internal/services/health"
+	"github.com/epps11/goguard/internal/services/history"
+	"github.com/epps11/goguard/internal/services/images"
 	"github.com/epps11/goguard/internal/services/injection"
 	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/epps11/goguard/internal/services/moderation"
+	"github.com/epps11/goguard/internal/services/netaccess"
 	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/quota"
+	"github.com/epps11/goguard/internal/services/secrets"
 	"github.com/epps11/goguard/internal/services/spending"
+	"github.com/epps11/goguard/internal/services/structured"
+	"github.com/epps11/goguard/internal/services/suppression"
+	"github.com/epps11/goguard/internal/services/topics"
 )
 
 // Handler contains all HTTP handlers
 type Handler struct {
 	injectionDetector *injection.Detector
 	piiMasker         *pii.Masker
+	secretsDetector   *secrets.Detector
 	llmClient         *llm.Client
 	llmFactory        *llm.ClientFactory
+	modelRegistry     *llm.Registry
+	compactor         *history.Compactor
 	auditLogger       *audit.Logger
 	spendingTracker   *spending.Tracker
+	policyEngine      *policy.Engine
+	captureService    *capture.Service
+	quotaService      *quota.Service
+	anomalyAnalyzer   *anomaly.Analyzer
+	budgets           *budget.Service
+	imageScanner      *images.Scanner
+	moderator         *moderation.Moderator
+	topicChecker      *topics.Checker
+	conversations     *conversation.Store
+	authenticator     *auth.Authenticator
+	concurrency       *ConcurrencyLimiter
+	network           *netaccess.Service
+	suppressions      *suppression.Service
+	health            *health.Checker
+	persistence       func() *models.PersistenceStatus
+	metrics           func(w io.Writer)
+	faultInjection    bool
+	observe           bool
 	startTime         time.Time
 	version           string
 }
@@ -53,22 +100,196 @@ func NewHandlerWithFactory(detector *injection.Detector, masker *pii.Masker, fac
 	}
 }
 
+// SetSecretsDetector sets the detector that keeps credentials from being
+// sent to providers
+func (h *Handler) SetSecretsDetector(detector *secrets.Detector) {
+	h.secretsDetector = detector
+}
+
+// SetPolicyEngine sets the policy engine used for policy-driven request routing
+func (h *Handler) SetPolicyEngine(engine *policy.Engine) {
+	h.policyEngine = engine
+}
+
+// SetCaptureService sets the service used to store redacted prompts and responses
+func (h *Handler) SetCaptureService(svc *capture.Service) {
+	h.captureService = svc
+}
+
+// SetQuotaService sets the service that enforces request quotas from rate limit policies
+func (h *Handler) SetQuotaService(svc *quota.Service) {
+	h.quotaService = svc
+}
+
+// SetAnomalyAnalyzer sets the analyzer that flags unusual per-user behavior
+func (h *Handler) SetAnomalyAnalyzer(analyzer *anomaly.Analyzer) {
+	h.anomalyAnalyzer = analyzer
+}
+
+// SetBudgetService sets the service that charges request costs to group and project budgets
+func (h *Handler) SetBudgetService(svc *budget.Service) {
+	h.budgets = svc
+}
+
+// SetImageScanner sets the scanner that handles image parts of multimodal messages
+func (h *Handler) SetImageScanner(scanner *images.Scanner) {
+	h.imageScanner = scanner
+}
+
+// SetModerator sets the moderator that checks LLM responses before delivery
+func (h *Handler) SetModerator(moderator *moderation.Moderator) {
+	h.moderator = moderator
+}
+
+// SetTopicChecker sets the checker that keeps conversations to the topics
+// policies allow
+func (h *Handler) SetTopicChecker(checker *topics.Checker) {
+	h.topicChecker = checker
+}
+
+// SetConversationStore sets the store of conversation histories analyzed
+// with requests that carry a conversation_id
+func (h *Handler) SetConversationStore(store *conversation.Store) {
+	h.conversations = store
+}
+
+// SetAuthenticator sets the authenticator checking who may set guard
+// options when data plane requests aren't otherwise authenticated
+func (h *Handler) SetAuthenticator(authenticator *auth.Authenticator) {
+	h.authenticator = authenticator
+}
+
+// SetConcurrencyLimiter caps the guard and embeddings requests in flight per
+// user and API key
+func (h *Handler) SetConcurrencyLimiter(limiter *ConcurrencyLimiter) {
+	h.concurrency = limiter
+}
+
+// SetNetworkAccess sets the service that blocks addresses sending
+// repeated blocked or critical-injection requests
+func (h *Handler) SetNetworkAccess(svc *netaccess.Service) {
+	h.network = svc
+}
+
+// SetSuppressions sets the rules dropping injection detections for some
+// users or groups
+func (h *Handler) SetSuppressions(svc *suppression.Service) {
+	h.suppressions = svc
+}
+
+// SetHealthChecker sets the dependency checks of /health and /ready
+func (h *Handler) SetHealthChecker(checker *health.Checker) {
+	h.health = checker
+}
+
+// SetPersistenceStatus reports whether the database is reachable in /health
+func (h *Handler) SetPersistenceStatus(status func() *models.PersistenceStatus) {
+	h.persistence = status
+}
+
+// SetMetricsWriter sets what /metrics writes
+func (h *Handler) SetMetricsWriter(metrics func(w io.Writer)) {
+	h.metrics = metrics
+}
+
+// SetModelRegistry sets the model capabilities requests are checked
+// against before they are forwarded
+func (h *Handler) SetModelRegistry(registry *llm.Registry) {
+	h.modelRegistry = registry
+}
+
+// SetCompactor sets the compactor fitting conversations into the context
+// budgets of policies
+func (h *Handler) SetCompactor(compactor *history.Compactor) {
+	h.compactor = compactor
+}
+
+// SetFaultInjection lets guard requests simulate upstream failures through
+// the X-GoGuard-Chaos-* headers
+func (h *Handler) SetFaultInjection(enabled bool) {
+	h.faultInjection = enabled
+}
+
+// SetObserveMode makes detection, masking and policy checks record what
+// they would have done to requests instead of blocking or changing them
+func (h *Handler) SetObserveMode(observe bool) {
+	h.observe = observe
+}
+
 // Guard processes a request through the security pipeline
 func (h *Handler) Guard(c *gin.Context) {
 	startTime := time.Now()
 
 	var req models.GuardRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var fault *llm.Fault
+	if h.faultInjection {
+		var err error
+		if fault, err = llm.ParseFault(c.Request.Header); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: err.Error(),
+				Code:  models.ErrCodeInvalidRequest,
+			})
+			return
+		}
+	}
+
+	if err := h.checkTimeout(req.TimeoutMs); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request body",
-			Code:  "INVALID_REQUEST",
+			Error: err.Error(),
+			Code:  models.ErrCodeInvalidRequest,
 		})
 		return
 	}
 
-	// Generate request ID if not provided
+	if fields := llm.ValidateProviderOptions(&req); len(fields) > 0 {
+		c.JSON(http.StatusBadRequest, invalidFields(fields))
+		return
+	}
+
+	var responseSchema *structured.Schema
+	if v := req.ResponseValidation; v != nil && len(v.Schema) > 0 {
+		schema, err := structured.Compile(v.Schema)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, invalidFields([]models.FieldError{{Field: "response_validation.schema", Message: err.Error()}}))
+			return
+		}
+		responseSchema = schema
+	}
+
+	// A token identifies the end user, so it takes precedence over user_id.
+	// API keys belong to services calling on behalf of their users.
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		if principal.APIKeyID == "" {
+			req.UserID = principal.UserID
+		}
+		req.KeyProfile = principal.LLMProfile
+	}
+
+	// Requests without an ID of their own take that of the HTTP request
 	if req.RequestID == "" {
-		req.RequestID = uuid.New().String()
+		req.RequestID = requestID(c)
+	}
+	c.Header("X-GoGuard-Request-Id", req.RequestID)
+
+	masker, err := h.guardMasker(c, &req)
+	if c.IsAborted() {
+		// The caller was refused while resolving it, and told why
+		return
+	}
+	if err != nil {
+		status, code := http.StatusBadRequest, models.ErrCodeInvalidRequest
+		if errors.Is(err, errGuardOptionsForbidden) {
+			status, code = http.StatusForbidden, models.ErrCodeGuardOptionsForbidden
+		}
+		c.JSON(status, models.ErrorResponse{
+			Error: err.Error(),
+			Code:  code,
+		})
+		return
 	}
 
 	response := &models.GuardResponse{
@@ -76,73 +297,433 @@ func (h *Handler) Guard(c *gin.Context) {
 		Allowed:   true,
 	}
 
-	// Step 1: Injection Detection
-	securityReport := h.injectionDetector.Analyze(req.Messages)
+	// Canary probes go through detection and policy checks but leave the
+	// quotas, budgets, spend and audit log of real traffic alone
+	probe := canary.IsProbe(c.Request.Context())
+
+	if err := h.checkUserActive(c, "guard", &req); err != nil {
+		response.Allowed = false
+		response.Error = err.Error()
+		response.ProcessingTime = time.Since(startTime)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	// Step 0: Concurrency limits and request quotas. Probes don't take a
+	// slot from real traffic.
+	if !probe {
+		release, err := h.acquireSlot(c, "guard", &req)
+		if err != nil {
+			response.Allowed = false
+			response.Error = err.Error()
+			response.ProcessingTime = time.Since(startTime)
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, response)
+			return
+		}
+		defer release()
+	}
+
+	if exceeded := h.enforceQuotas(c, &req); exceeded != nil {
+		if h.observe {
+			response.Observed = append(response.Observed, quotaObserved(exceeded))
+		} else {
+			response.Allowed = false
+			response.Error = quotaError(exceeded)
+			response.ProcessingTime = time.Since(startTime)
+			h.logQuotaExceeded(c, "guard", &req, exceeded)
+			c.JSON(http.StatusTooManyRequests, response)
+			return
+		}
+	}
+
+	attribution := h.attribute(c, &req)
+	if exhausted := h.checkBudgets(c, "guard", &req, attribution); exhausted != nil {
+		if h.observe {
+			response.Observed = append(response.Observed, budgetObserved(exhausted))
+		} else {
+			response.Allowed = false
+			response.Error = budgetError(exhausted)
+			response.ProcessingTime = time.Since(startTime)
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(exhausted.ResetAt).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, response)
+			return
+		}
+	}
+
+	// Behavioral anomalies are informational and never block the request
+	if h.anomalyAnalyzer != nil && !probe {
+		h.anomalyAnalyzer.Observe(c.Request.Context(), anomaly.Observation{
+			RequestID: req.RequestID,
+			UserID:    req.UserID,
+			Model:     req.Model,
+			Messages:  req.Messages,
+		})
+	}
+
+	// Images are stripped, blocked or OCR-scanned before the text is checked
+	originalMessages := req.Messages
+	if h.imageScanner != nil && models.AnyImages(req.Messages) {
+		messages, imageReport, err := h.imageScanner.Process(c.Request.Context(), req.Messages)
+		response.ImageReport = imageReport
+		switch {
+		case err != nil && h.observe:
+			response.Observed = append(response.Observed, models.ObservedAction{Stage: "image", Action: observedBlock, Reason: err.Error()})
+		case err != nil:
+			response.Allowed = false
+			response.Error = err.Error()
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusForbidden, response)
+			return
+		case imageReport.Stripped > 0 && h.observe:
+			response.Observed = append(response.Observed, models.ObservedAction{Stage: "image", Action: observedStrip, Reason: fmt.Sprintf("%d images stripped", imageReport.Stripped)})
+		}
+		req.Messages = messages
+	}
+
+	// Step 1: Injection Detection. Callers can't opt out of it when a
+	// policy blocks injections for them.
+	injectionPolicy := h.injectionThreshold(c.Request.Context(), &req)
+	observedInjectionPolicy := h.injectionThreshold(policy.WithObserved(c.Request.Context()), &req)
+	securityReport := &models.SecurityReport{ThreatLevel: "none", Detections: []models.Detection{}, Recommendations: []string{}}
+	var suppressor injection.Suppressor
+	if req.Options.DetectInjection() || injectionPolicy != nil || observedInjectionPolicy != nil {
+		suppressor = h.suppressor(c, &req)
+		securityReport = h.injectionDetector.AnalyzeUntil(req.Messages, req.Options.Threshold(), suppressor)
+		securityReport.ToolFindings = h.injectionDetector.AnalyzeToolCalls(req.Messages, nil)
+	}
+	if !probe {
+		h.trackConversation(&req, masker, securityReport, suppressor)
+		h.recordSuppressed(securityReport)
+	}
+	setDetectionIDs(req.RequestID, securityReport, nil, nil)
 	response.SecurityReport = securityReport
+	c.Header("X-GoGuard-Threat-Level", securityReport.ThreatLevel)
+	requestid.Logger(c.Request.Context()).Debug().
+		Str("threat_level", securityReport.ThreatLevel).
+		Int("detections", len(securityReport.Detections)).
+		Int("tool_findings", len(securityReport.ToolFindings)).
+		Msg("Injection detection finished")
 
-	if h.injectionDetector.ShouldBlock(securityReport) {
+	blocked := h.injectionDetector.ShouldBlock(securityReport)
+	if req.Options != nil && req.Options.BlockThreshold != "" {
+		blocked = injection.ShouldBlockAt(securityReport, req.Options.BlockThreshold)
+		securityReport.BlockedReason = ""
+		if blocked {
+			securityReport.BlockedReason = "Potential prompt injection detected"
+		}
+	}
+	if !req.Options.DetectInjection() {
+		// Detection only ran for a policy, so only the policy blocks
+		blocked = false
+		securityReport.BlockedReason = ""
+	}
+	blockedBy := ""
+	if !blocked && blockedByInjectionPolicy(injectionPolicy, securityReport) {
+		blocked = true
+		blockedBy = injectionPolicy.PolicyID
+		h.logInjectionPolicy(c, "guard", &req, injectionPolicy, securityReport)
+	}
+	if blocked && h.observe {
+		response.Observed = append(response.Observed, models.ObservedAction{Stage: "injection", Action: observedBlock, Reason: securityReport.BlockedReason, PolicyID: blockedBy})
+		securityReport.BlockedReason = ""
+	} else if blocked {
 		response.Allowed = false
 		response.ProcessingTime = time.Since(startTime)
 		c.JSON(http.StatusForbidden, response)
 		return
 	}
+	if t := observedInjectionPolicy; t != nil && injection.ShouldBlockAt(securityReport, t.Level) {
+		response.Observed = append(response.Observed, models.ObservedAction{
+			Stage:      "injection",
+			Action:     observedBlock,
+			Reason:     fmt.Sprintf("Prompt injection at %s threat level or above", t.Level),
+			PolicyID:   t.PolicyID,
+			PolicyName: t.PolicyName,
+		})
+	}
+	if securityReport.ScanTruncated && h.observe {
+		response.Observed = append(response.Observed, models.ObservedAction{Stage: "scan_limit", Action: observedBlock, Reason: scanLimitError(h.injectionDetector.MaxScanBytes())})
+	} else if securityReport.ScanTruncated {
+		response.Allowed = false
+		response.Error = scanLimitError(h.injectionDetector.MaxScanBytes())
+		response.ProcessingTime = time.Since(startTime)
+		c.JSON(http.StatusRequestEntityTooLarge, response)
+		return
+	}
+
+	// Step 1b: Secrets. A credential sent to a provider can't be recalled,
+	// so requests with them are blocked unless masking is configured.
+	if messages, secretsReport := h.scanSecrets(c, "guard", &req, req.Messages, probe); secretsReport != nil {
+		setDetectionIDs(req.RequestID, nil, nil, secretsReport)
+		response.SecretsReport = secretsReport
+		if observed := secretsObserved(secretsReport); observed != nil && h.observe {
+			response.Observed = append(response.Observed, *observed)
+		} else if secretsReport.Action == secrets.ActionBlock {
+			response.Allowed = false
+			response.Error = secretsError(secretsReport)
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+		req.Messages = messages
+	}
 
 	// Step 2: PII Masking
-	maskedMessages, piiReport := h.piiMasker.Mask(req.Messages)
+	maskedMessages, piiReport := req.Messages, &models.PIIReport{PIITypes: []models.PIIMatch{}}
+	if req.Options.MaskPII() {
+		maskedMessages, piiReport = masker.Mask(req.Messages)
+	}
+	setDetectionIDs(req.RequestID, nil, piiReport, nil)
 	response.PIIReport = piiReport
+	requestid.Logger(c.Request.Context()).Debug().
+		Int("pii_count", piiReport.PIICount).
+		Bool("pii_blocked", piiReport.Blocked).
+		Msg("PII masking finished")
 	response.ProcessedInput = &models.ProcessedInput{
-		OriginalMessages: req.Messages,
+		OriginalMessages: originalMessages,
 		MaskedMessages:   maskedMessages,
 		PIIMasked:        piiReport.PIIDetected,
 	}
+	if observed := piiObserved(piiReport); observed != nil && h.observe {
+		response.Observed = append(response.Observed, *observed)
+	} else if piiReport.Blocked {
+		response.Allowed = false
+		response.Error = piiBlockedError(piiReport)
+		response.ProcessingTime = time.Since(startTime)
+		c.JSON(http.StatusForbidden, response)
+		return
+	}
 
 	// Step 3: Forward to LLM (if client is configured)
 	// Use factory if available for per-request provider support
-	var modelUsed string
-	if h.llmFactory != nil {
-		client, shouldClose, err := h.llmFactory.GetClient(&req)
+	var modelUsed, upstreamFailure string
+	var client *llm.Client
+	if probe {
+		// Probes get a stubbed response instead of calling a provider
+	} else if h.llmFactory != nil {
+		factoryClient, shouldClose, err := h.llmFactory.GetClient(c.Request.Context(), &req)
 		if err != nil {
 			response.Error = err.Error()
 		} else {
 			if shouldClose {
-				defer client.Close()
-			}
-			llmResp, err := client.Chat(c.Request.Context(), maskedMessages)
-			if err != nil {
-				response.Error = err.Error()
-			} else {
-				response.LLMResponse = llmResp
-				modelUsed = llmResp.Model
+				defer factoryClient.Close()
 			}
+			client = factoryClient
 		}
 	} else if h.llmClient != nil && h.llmClient.IsInitialized() {
-		llmResp, err := h.llmClient.Chat(c.Request.Context(), maskedMessages)
+		client = h.llmClient
+	}
+
+	// Model and provider allow/deny lists apply to the model actually used,
+	// or to the requested one when GoGuard isn't forwarding the request
+	provider, model := req.Provider, req.Model
+	if client != nil {
+		provider, model = client.Target()
+	}
+	if denial := h.checkModelAccess(c, "guard", &req, provider, model); denial != nil {
+		if h.observe {
+			response.Observed = append(response.Observed, modelAccessObserved(denial))
+		} else {
+			response.Allowed = false
+			response.Error = fmt.Sprintf("Model access denied by policy '%s': %s", denial.PolicyName, denial.Reason)
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	if denial := h.checkToolAccess(c, "guard", &req, provider, model); denial != nil {
+		if h.observe {
+			response.Observed = append(response.Observed, toolAccessObserved(denial))
+		} else {
+			response.Allowed = false
+			response.Error = fmt.Sprintf("Tool access denied by policy '%s': %s", denial.PolicyName, denial.Reason)
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	if result := h.evaluatePolicies(c, "guard", &req, provider, model, maskedMessages); result != nil && !result.Allowed {
+		if h.observe {
+			response.Observed = append(response.Observed, policyObserved(result))
+		} else {
+			response.Allowed = false
+			response.Error = fmt.Sprintf("Request denied by policy: %s", result.BlockReason)
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	if report := h.checkTopics(c, "guard", &req, provider, model, maskedMessages); report != nil {
+		response.TopicReport = report
+		if report.Denied && h.observe {
+			response.Observed = append(response.Observed, topicObserved(report))
+		} else if report.Denied {
+			response.Allowed = false
+			response.Error = topicDenial(report)
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+	}
+
+	// Policies in observe mode only report what they would have done
+	response.Observed = append(response.Observed, h.observePolicies(c, "guard", &req, provider, model, maskedMessages)...)
+
+	// Organization-mandated system prompts are trusted, so they are added
+	// after detection and masking, and only to what is forwarded
+	var systemPrompts []policy.SystemPrompt
+	var clampedMaxTokens int
+	if probe {
+		response.LLMResponse = canary.StubResponse()
+	} else if client != nil {
+		// The request's context is cancelled when the caller disconnects,
+		// which cancels the provider call too
+		ctx := c.Request.Context()
+		if fault != nil {
+			requestid.Logger(ctx).Debug().Stringer("fault", fault).Msg("Injecting upstream fault")
+			ctx = llm.WithFault(ctx, fault)
+		}
+		if req.TimeoutMs > 0 {
+			ctx = llm.WithTimeout(ctx, time.Duration(req.TimeoutMs)*time.Millisecond)
+		}
+		ctx = llm.WithProviderOptions(ctx, req.ProviderOptions)
+		// In observe mode the request is forwarded as the caller sent it
+		forwarded := maskedMessages
+		if h.observe {
+			forwarded = originalMessages
+		}
+		if h.policyEngine != nil {
+			systemPrompts = h.policyEngine.ResolveSystemPrompts(ctx, req.UserID, provider, model)
+			forwarded = h.fitContext(c, &req, client, provider, model, forwarded, systemPrompts, attribution, response.ProcessedInput)
+			forwarded = policy.ApplySystemPrompts(forwarded, systemPrompts)
+		}
+		maxTokens, err := h.checkModelLimits(c, "guard", &req, client, model, forwarded)
+		if err != nil && h.observe {
+			response.Observed = append(response.Observed, models.ObservedAction{Stage: "model_limits", Action: observedBlock, Reason: err.Error()})
+		} else if err != nil {
+			response.Allowed = false
+			response.Error = err.Error()
+			response.ProcessingTime = time.Since(startTime)
+			c.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if maxTokens > 0 {
+			ctx = llm.WithMaxTokens(ctx, maxTokens)
+			clampedMaxTokens = maxTokens
+		}
+		llmResp, err := client.ChatWithTools(ctx, forwarded, req.Tools, req.ToolChoice)
 		if err != nil {
 			response.Error = err.Error()
+			upstreamFailure = llm.FailureKind(err)
+			response.ErrorType = upstreamFailure
+			circuitOpen(c, err)
 		} else {
+			if req.ResponseValidation != nil && len(llmResp.ToolCalls) == 0 {
+				llmResp, response.Validation = h.validateResponse(ctx, client, forwarded, &req, responseSchema, llmResp)
+			}
 			response.LLMResponse = llmResp
 			modelUsed = llmResp.Model
+			if req.Options.DetectInjection() {
+				securityReport.ToolFindings = append(securityReport.ToolFindings, h.injectionDetector.AnalyzeToolCalls(nil, llmResp.ToolCalls)...)
+			}
+		}
+	}
+
+	// Step 3b: Moderate the response. A blocked response was still paid for,
+	// so it is tracked and audited like any other.
+	status := http.StatusOK
+	received := response.LLMResponse
+	if h.moderator != nil && received != nil && h.observe {
+		// Redaction would change the response, so a copy is moderated
+		moderated := *received
+		report, err := h.moderator.Moderate(c.Request.Context(), &moderated)
+		response.Moderation = report
+		if errors.Is(err, moderation.ErrResponseBlocked) || (report != nil && report.Action == moderation.ActionRedact) {
+			response.Observed = append(response.Observed, moderationObserved(report))
+		}
+	} else if h.moderator != nil && received != nil {
+		report, err := h.moderator.Moderate(c.Request.Context(), received)
+		response.Moderation = report
+		if errors.Is(err, moderation.ErrResponseBlocked) {
+			response.LLMResponse = nil
+			response.Allowed = false
+			response.Error = err.Error()
+			status = http.StatusForbidden
+		}
+	}
+	if h.topicChecker != nil && response.LLMResponse != nil {
+		if observed, err := h.topicChecker.CheckResponse(policy.WithObserved(c.Request.Context()), req.UserID, provider, model, response.LLMResponse); errors.Is(err, topics.ErrTopicDenied) {
+			response.Observed = append(response.Observed, topicObserved(observed))
+		}
+
+		report, err := h.topicChecker.CheckResponse(c.Request.Context(), req.UserID, provider, model, response.LLMResponse)
+		if report != nil {
+			if response.TopicReport == nil {
+				response.TopicReport = report
+			} else {
+				response.TopicReport.Violations = append(response.TopicReport.Violations, report.Violations...)
+				response.TopicReport.Denied = report.Denied
+				if report.Error != "" {
+					response.TopicReport.Error = report.Error
+				}
+			}
+		}
+		if errors.Is(err, topics.ErrTopicDenied) && h.observe {
+			response.Observed = append(response.Observed, topicObserved(report))
+		} else if errors.Is(err, topics.ErrTopicDenied) {
+			response.LLMResponse = nil
+			response.Allowed = false
+			response.Error = topicDenial(report)
+			status = http.StatusForbidden
 		}
 	}
 
 	// Step 4: Track spending if we have usage data
-	if h.spendingTracker != nil && response.LLMResponse != nil && response.LLMResponse.Usage != nil {
+	usage := &requestUsage{attribution: attribution, provider: provider, model: modelUsed, systemPrompts: systemPrompts, moderation: response.Moderation, validation: response.Validation, context: response.ProcessedInput.Context, topics: response.TopicReport, secrets: response.SecretsReport, options: req.Options, conversationID: req.ConversationID, route: req.Route, modelAlias: req.ModelAlias, maxTokensClamped: clampedMaxTokens, upstreamFailure: upstreamFailure, observed: response.Observed}
+	if h.spendingTracker != nil && received != nil && received.Usage != nil {
+		usage.tokens = received.Usage
+		usage.cost = h.spendingTracker.CalculateCost(modelUsed, usage.tokens.PromptTokens, usage.tokens.CompletionTokens)
+
 		userID := req.UserID
 		if userID == "" {
 			userID = "default" // Use default user if not specified
 		}
-		if err := h.spendingTracker.RecordUsage(c.Request.Context(), userID, modelUsed, response.LLMResponse.Usage); err != nil {
+		if err := h.spendingTracker.RecordUsage(c.Request.Context(), &models.UsageRecord{
+			RequestID:        req.RequestID,
+			UserID:           userID,
+			Project:          attribution.Project,
+			Team:             attribution.Team,
+			Provider:         provider,
+			Model:            modelUsed,
+			PromptTokens:     usage.tokens.PromptTokens,
+			CompletionTokens: usage.tokens.CompletionTokens,
+			TotalTokens:      usage.tokens.TotalTokens,
+			Cost:             usage.cost,
+		}); err != nil {
 			// Log error but don't fail the request
 			c.Error(err)
 		}
+		if h.budgets != nil {
+			h.budgets.Record(c.Request.Context(), attribution, usage.cost)
+		}
 	}
 
+	// Step 5: Capture redacted content for opted-in users
+	h.captureContent(c, &req, maskedMessages, response.LLMResponse)
+
 	response.ProcessingTime = time.Since(startTime)
 
 	// Log to audit
-	h.logRequest(c, req.RequestID, "guard", response.Allowed, response.SecurityReport, response.PIIReport, time.Since(startTime))
+	if !probe {
+		h.logRequest(c, req.RequestID, "guard", response.Allowed, response.SecurityReport, response.PIIReport, time.Since(startTime), usage)
+		h.setUsageHeaders(c, req.UserID, usage)
+	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(status, response)
 }
 
 // Analyze performs security analysis without forwarding to LLM
@@ -150,32 +731,37 @@ func (h *Handler) Analyze(c *gin.Context) {
 	startTime := time.Now()
 
 	var req models.GuardRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request body",
-			Code:  "INVALID_REQUEST",
-		})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	if req.RequestID == "" {
-		req.RequestID = uuid.New().String()
+		req.RequestID = requestID(c)
 	}
 
 	response := &models.GuardResponse{
 		RequestID:      req.RequestID,
 		Allowed:        true,
-		SecurityReport: h.injectionDetector.Analyze(req.Messages),
+		SecurityReport: h.injectionDetector.AnalyzeWith(req.Messages, h.suppressor(c, &req)),
 		PIIReport:      h.piiMasker.Analyze(req.Messages),
 		ProcessingTime: time.Since(startTime),
 	}
+	h.recordSuppressed(response.SecurityReport)
+	if h.secretsDetector != nil {
+		_, response.SecretsReport = h.secretsDetector.Scan(req.Messages)
+	}
+	setDetectionIDs(req.RequestID, response.SecurityReport, response.PIIReport, response.SecretsReport)
 
-	if h.injectionDetector.ShouldBlock(response.SecurityReport) {
+	if h.injectionDetector.ShouldBlock(response.SecurityReport) ||
+		blockedByInjectionPolicy(h.injectionThreshold(c.Request.Context(), &req), response.SecurityReport) {
+		response.Allowed = false
+	}
+	if response.SecretsReport != nil && response.SecretsReport.Action == secrets.ActionBlock {
 		response.Allowed = false
 	}
 
 	// Log to audit
-	h.logRequest(c, req.RequestID, "analyze", response.Allowed, response.SecurityReport, response.PIIReport, time.Since(startTime))
+	h.logRequest(c, req.RequestID, "analyze", response.Allowed, response.SecurityReport, response.PIIReport, time.Since(startTime), nil)
 
 	c.JSON(http.StatusOK, response)
 }
@@ -185,19 +771,16 @@ func (h *Handler) MaskPII(c *gin.Context) {
 	startTime := time.Now()
 
 	var req models.GuardRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request body",
-			Code:  "INVALID_REQUEST",
-		})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	if req.RequestID == "" {
-		req.RequestID = uuid.New().String()
+		req.RequestID = requestID(c)
 	}
 
 	maskedMessages, piiReport := h.piiMasker.Mask(req.Messages)
+	setDetectionIDs(req.RequestID, nil, piiReport, nil)
 
 	response := &models.GuardResponse{
 		RequestID: req.RequestID,
@@ -209,9 +792,13 @@ func (h *Handler) MaskPII(c *gin.Context) {
 		PIIReport:      piiReport,
 		ProcessingTime: time.Since(startTime),
 	}
+	if piiReport.Blocked {
+		response.Allowed = false
+		response.Error = piiBlockedError(piiReport)
+	}
 
 	// Log to audit
-	h.logRequest(c, req.RequestID, "mask", true, nil, piiReport, time.Since(startTime))
+	h.logRequest(c, req.RequestID, "mask", true, nil, piiReport, time.Since(startTime), nil)
 
 	c.JSON(http.StatusOK, response)
 }
@@ -221,100 +808,1473 @@ func (h *Handler) DetectInjection(c *gin.Context) {
 	startTime := time.Now()
 
 	var req models.GuardRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request body",
-			Code:  "INVALID_REQUEST",
-		})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	if req.RequestID == "" {
-		req.RequestID = uuid.New().String()
+		req.RequestID = requestID(c)
 	}
 
-	securityReport := h.injectionDetector.Analyze(req.Messages)
+	securityReport := h.injectionDetector.AnalyzeWith(req.Messages, h.suppressor(c, &req))
+	h.recordSuppressed(securityReport)
+	setDetectionIDs(req.RequestID, securityReport, nil, nil)
+	blocked := h.injectionDetector.ShouldBlock(securityReport) ||
+		blockedByInjectionPolicy(h.injectionThreshold(c.Request.Context(), &req), securityReport)
 
 	response := &models.GuardResponse{
 		RequestID:      req.RequestID,
-		Allowed:        !h.injectionDetector.ShouldBlock(securityReport),
+		Allowed:        !blocked && !securityReport.ScanTruncated,
 		SecurityReport: securityReport,
 		ProcessingTime: time.Since(startTime),
 	}
+	if securityReport.ScanTruncated {
+		response.Error = scanLimitError(h.injectionDetector.MaxScanBytes())
+	}
 
 	// Log to audit
-	h.logRequest(c, req.RequestID, "detect", response.Allowed, securityReport, nil, time.Since(startTime))
+	h.logRequest(c, req.RequestID, "detect", response.Allowed, securityReport, nil, time.Since(startTime), nil)
 
 	c.JSON(http.StatusOK, response)
 }
 
-// Health returns the health status
-func (h *Handler) Health(c *gin.Context) {
-	services := map[string]string{
-		"injection_detector": "healthy",
-		"pii_masker":         "healthy",
-	}
+// Embeddings is an OpenAI-compatible embeddings endpoint. Inputs are
+// PII-masked before they reach the provider and the request is subject to the
+// same quotas, budgets, model access lists and policies as guard requests.
+// Embedded text is indexed rather than followed, so injection detection is
+// skipped.
+func (h *Handler) Embeddings(c *gin.Context) {
+	startTime := time.Now()
 
-	if h.llmClient != nil && h.llmClient.IsInitialized() {
-		services["llm_client"] = "healthy"
-	} else {
-		services["llm_client"] = "not_configured"
+	var embReq models.EmbeddingRequest
+	if !bindJSON(c, &embReq) {
+		return
+	}
+	inputs, err := embReq.Inputs()
+	if err == nil {
+		err = h.checkTimeout(embReq.TimeoutMs)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+			Code:  models.ErrCodeInvalidRequest,
+		})
+		return
 	}
 
-	c.JSON(http.StatusOK, models.HealthResponse{
-		Status:   "healthy",
-		Version:  h.version,
-		Uptime:   time.Since(h.startTime).String(),
-		Services: services,
-	})
-}
+	// The quota, budget and policy checks work on guard requests, with each
+	// input as a user message
+	messages := make([]models.Message, len(inputs))
+	for i, input := range inputs {
+		messages[i] = models.Message{Role: "user", Content: input}
+	}
+	req := models.GuardRequest{
+		RequestID:  c.GetString("request_id"),
+		UserID:     embReq.User,
+		Messages:   messages,
+		Model:      embReq.Model,
+		LLMProfile: embReq.LLMProfile,
+		Metadata:   embReq.Metadata,
+	}
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		if principal.APIKeyID == "" {
+			req.UserID = principal.UserID
+		}
+		req.KeyProfile = principal.LLMProfile
+	}
+	if req.RequestID == "" {
+		req.RequestID = requestID(c)
+	}
+	c.Header("X-GoGuard-Request-Id", req.RequestID)
 
-// Ready returns readiness status
-func (h *Handler) Ready(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"ready": true,
-	})
-}
+	if err := h.checkUserActive(c, "embeddings", &req); err != nil {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: err.Error(),
+			Code:  models.ErrCodeUserInactive,
+		})
+		return
+	}
 
-// logRequest logs a request to the audit logger
-func (h *Handler) logRequest(c *gin.Context, requestID, action string, allowed bool, secReport *models.SecurityReport, piiReport *models.PIIReport, duration time.Duration) {
-	if h.auditLogger == nil {
+	release, err := h.acquireSlot(c, "embeddings", &req)
+	if err != nil {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Error: err.Error(),
+			Code:  models.ErrCodeConcurrencyExceeded,
+		})
 		return
 	}
+	defer release()
 
-	status := models.AuditStatusSuccess
-	if !allowed {
-		status = models.AuditStatusBlocked
+	var observed []models.ObservedAction
+	if exceeded := h.enforceQuotas(c, &req); exceeded != nil {
+		if h.observe {
+			observed = append(observed, quotaObserved(exceeded))
+		} else {
+			h.logQuotaExceeded(c, "embeddings", &req, exceeded)
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error: quotaError(exceeded),
+				Code:  models.ErrCodeQuotaExceeded,
+			})
+			return
+		}
 	}
 
-	details := map[string]interface{}{
-		"action": action,
+	attribution := h.attribute(c, &req)
+	if exhausted := h.checkBudgets(c, "embeddings", &req, attribution); exhausted != nil {
+		if h.observe {
+			observed = append(observed, budgetObserved(exhausted))
+		} else {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(exhausted.ResetAt).Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error: budgetError(exhausted),
+				Code:  models.ErrCodeBudgetExhausted,
+			})
+			return
+		}
 	}
 
-	if secReport != nil {
-		details["injection_detected"] = secReport.InjectionDetected
-		details["threat_level"] = secReport.ThreatLevel
-		if secReport.InjectionDetected {
-			details["detection_count"] = len(secReport.Detections)
+	messages, secretsReport := h.scanSecrets(c, "embeddings", &req, messages, false)
+	if secretsReport != nil {
+		if action := secretsObserved(secretsReport); action != nil && h.observe {
+			observed = append(observed, *action)
+		} else if secretsReport.Action == secrets.ActionBlock {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: secretsError(secretsReport),
+				Code:  models.ErrCodeSecretsDetected,
+			})
+			return
 		}
+		c.Header("X-GoGuard-Secrets-Count", strconv.Itoa(secretsReport.SecretCount))
 	}
 
-	if piiReport != nil {
-		details["pii_detected"] = piiReport.PIIDetected
-		details["pii_count"] = piiReport.PIICount
+	maskedMessages, piiReport := h.piiMasker.Mask(messages)
+	if action := piiObserved(piiReport); action != nil && h.observe {
+		observed = append(observed, *action)
+	} else if piiReport.Blocked {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: piiBlockedError(piiReport),
+			Code:  models.ErrCodePIIBlocked,
+		})
+		return
+	}
+	// In observe mode the inputs are embedded as the caller sent them
+	masked := make([]string, len(maskedMessages))
+	for i, msg := range maskedMessages {
+		masked[i] = msg.Content
+	}
+	if h.observe {
+		masked = inputs
 	}
+	c.Header("X-GoGuard-PII-Count", strconv.Itoa(piiReport.PIICount))
 
-	entry := &models.AuditLog{
-		RequestID:    requestID,
-		EventType:    models.EventTypeRequest,
-		Action:       action,
-		ResourceType: "llm",
-		Status:       status,
-		IPAddress:    c.ClientIP(),
-		UserAgent:    c.Request.UserAgent(),
-		Duration:     duration,
-		Details:      details,
+	if h.llmFactory == nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: "no LLM client configured for embeddings",
+			Code:  models.ErrCodeLLMUnavailable,
+		})
+		return
 	}
+	// The API key's profile and routing policies pick the profile of
+	// embeddings too, but not the model
+	if req.LLMProfile == "" {
+		req.LLMProfile = req.KeyProfile
+	}
+	if req.LLMProfile == "" && h.policyEngine != nil {
+		if route := h.policyEngine.Route(c.Request.Context(), &req); route != nil && route.Profile != "" {
+			req.LLMProfile = route.Profile
+			req.Route = &models.LLMRoute{PolicyID: route.PolicyID, PolicyName: route.PolicyName, Profile: route.Profile}
+		}
+	}
+	client, err := h.llmFactory.GetEmbeddingClient(req.LLMProfile)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+			Error: err.Error(),
+			Code:  models.ErrCodeLLMUnavailable,
+		})
+		return
+	}
+
+	provider, model := client.Target()
+	if embReq.Model != "" {
+		model = embReq.Model
+	}
+	if denial := h.checkModelAccess(c, "embeddings", &req, provider, model); denial != nil {
+		if h.observe {
+			observed = append(observed, modelAccessObserved(denial))
+		} else {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: fmt.Sprintf("Model access denied by policy '%s': %s", denial.PolicyName, denial.Reason),
+				Code:  models.ErrCodeModelAccessDenied,
+			})
+			return
+		}
+	}
+	if result := h.evaluatePolicies(c, "embeddings", &req, provider, model, maskedMessages); result != nil && !result.Allowed {
+		if h.observe {
+			observed = append(observed, policyObserved(result))
+		} else {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: fmt.Sprintf("Request denied by policy: %s", result.BlockReason),
+				Code:  models.ErrCodePolicyDenied,
+			})
+			return
+		}
+	}
+	observed = append(observed, h.observePolicies(c, "embeddings", &req, provider, model, maskedMessages)...)
 
-	h.auditLogger.Log(c.Request.Context(), entry)
+	ctx := c.Request.Context()
+	if embReq.TimeoutMs > 0 {
+		ctx = llm.WithTimeout(ctx, time.Duration(embReq.TimeoutMs)*time.Millisecond)
+	}
+	resp, err := client.Embed(ctx, &embReq, masked)
+	if err != nil {
+		failure := llm.FailureKind(err)
+		h.logRequest(c, req.RequestID, "embeddings", true, nil, piiReport, time.Since(startTime), &requestUsage{attribution: attribution, route: req.Route, upstreamFailure: failure, observed: observed})
+		switch {
+		case failure == llm.FailureDisconnected:
+			// Nobody is left to answer
+			c.Abort()
+		case circuitOpen(c, err):
+			c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
+				Error: err.Error(),
+				Code:  models.ErrCodeProviderUnavailable,
+			})
+		case failure == llm.FailureTimeout:
+			c.JSON(http.StatusGatewayTimeout, models.ErrorResponse{
+				Error: err.Error(),
+				Code:  models.ErrCodeUpstreamTimeout,
+			})
+		default:
+			c.JSON(http.StatusBadGateway, models.ErrorResponse{
+				Error: err.Error(),
+				Code:  models.ErrCodeUpstreamError,
+			})
+		}
+		return
+	}
+
+	// Embeddings only have input tokens
+	usage := &requestUsage{
+		attribution: attribution,
+		provider:    provider,
+		model:       resp.Model,
+		tokens:      &models.Usage{PromptTokens: resp.Usage.PromptTokens, TotalTokens: resp.Usage.TotalTokens},
+		route:       req.Route,
+		observed:    observed,
+	}
+	if h.spendingTracker != nil {
+		usage.cost = h.spendingTracker.CalculateCost(resp.Model, resp.Usage.PromptTokens, 0)
+
+		userID := req.UserID
+		if userID == "" {
+			userID = "default"
+		}
+		if err := h.spendingTracker.RecordUsage(c.Request.Context(), &models.UsageRecord{
+			RequestID:    req.RequestID,
+			UserID:       userID,
+			Project:      attribution.Project,
+			Team:         attribution.Team,
+			Provider:     provider,
+			Model:        resp.Model,
+			PromptTokens: resp.Usage.PromptTokens,
+			TotalTokens:  resp.Usage.TotalTokens,
+			Cost:         usage.cost,
+		}); err != nil {
+			c.Error(err)
+		}
+		if h.budgets != nil {
+			h.budgets.Record(c.Request.Context(), attribution, usage.cost)
+		}
+	}
+
+	h.logRequest(c, req.RequestID, "embeddings", true, nil, piiReport, time.Since(startTime), usage)
+	h.setUsageHeaders(c, req.UserID, usage)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkTimeout validates the timeout_ms of a request; 0 keeps the configured
+// timeout
+func (h *Handler) checkTimeout(timeoutMs int) error {
+	if timeoutMs == 0 {
+		return nil
+	}
+	limit := time.Duration(math.MaxInt64)
+	if h.llmFactory != nil {
+		limit = h.llmFactory.MaxTimeout()
+	}
+	if timeoutMs < 0 || time.Duration(timeoutMs)*time.Millisecond > limit {
+		return fmt.Errorf("timeout_ms must be between 1 and %d", limit.Milliseconds())
+	}
+	return nil
+}
+
+// circuitOpen reports whether err refused an LLM call because the provider's
+// circuit is open, setting Retry-After to when it will be probed again
+func circuitOpen(c *gin.Context, err error) bool {
+	var open *llm.CircuitOpenError
+	if !errors.As(err, &open) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(max(int(time.Until(open.RetryAt).Seconds())+1, 1)))
+	return true
+}
+
+// Health returns the health status. A failing critical dependency makes the
+// instance unhealthy with a 503; other failures and open circuits degrade it.
+func (h *Handler) Health(c *gin.Context) {
+	services := map[string]string{
+		"injection_detector": "healthy",
+		"pii_masker":         "healthy",
+	}
+
+	if h.llmClient != nil && h.llmClient.IsInitialized() {
+		services["llm_client"] = "healthy"
+	} else {
+		services["llm_client"] = "not_configured"
+	}
+
+	status := health.StatusHealthy
+	var checks map[string]*models.DependencyHealth
+	if h.health != nil {
+		status, checks = h.health.Run(c.Request.Context())
+	}
+
+	// An open circuit degrades the service without making the instance
+	// unhealthy, so the status code stays 200
+	providers := llm.ProviderHealth()
+	for _, p := range providers {
+		if p.State != llm.CircuitClosed && status == health.StatusHealthy {
+			status = health.StatusDegraded
+		}
+	}
+
+	var persistence *models.PersistenceStatus
+	if h.persistence != nil {
+		persistence = h.persistence()
+		if persistence.Degraded && status == health.StatusHealthy {
+			status = health.StatusDegraded
+		}
+	}
+
+	code := http.StatusOK
+	if status == health.StatusUnhealthy {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, models.HealthResponse{
+		Status:      status,
+		Version:     h.version,
+		Uptime:      time.Since(h.startTime).String(),
+		Services:    services,
+		Providers:   providers,
+		Checks:      checks,
+		Persistence: persistence,
+	})
+}
+
+// Ready returns readiness status: not ready, with a 503, while a critical
+// dependency fails or the database schema is older than this build needs
+func (h *Handler) Ready(c *gin.Context) {
+	if h.health == nil {
+		c.JSON(http.StatusOK, gin.H{"ready": true})
+		return
+	}
+
+	status, checks := h.health.Run(c.Request.Context())
+	failing := make(map[string]*models.DependencyHealth)
+	for name, check := range checks {
+		if check.Critical && check.Status == health.StatusUnhealthy {
+			failing[name] = check
+		}
+	}
+	if status == health.StatusUnhealthy {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "checks": failing})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ready": true})
+}
+
+// Metrics returns the database query and connection metrics in the
+// Prometheus text format, or nothing without a database
+func (h *Handler) Metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if h.metrics != nil {
+		h.metrics(c.Writer)
+	}
+}
+
+// enforceQuotas counts the request against the user's quotas and sets the
+// remaining-quota headers. It returns the exceeded quota, or nil if allowed.
+func (h *Handler) enforceQuotas(c *gin.Context, req *models.GuardRequest) *quota.Status {
+	if h.quotaService == nil || h.policyEngine == nil || canary.IsProbe(c.Request.Context()) {
+		return nil
+	}
+
+	userID := req.UserID
+	if userID == "" {
+		userID = "default"
+	}
+	quotas := h.policyEngine.ResolveQuotas(c.Request.Context(), userID)
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	result := h.quotaService.Consume(c.Request.Context(), userID, quotas)
+	reported := result.Tightest
+	if result.Exceeded != nil {
+		reported = result.Exceeded
+	}
+	c.Header("X-RateLimit-Limit", strconv.Itoa(reported.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(reported.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(reported.ResetAt.Unix(), 10))
+	c.Header("X-RateLimit-Policy", reported.PolicyID)
+
+	if result.Allowed {
+		return nil
+	}
+	if !h.observe {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(reported.ResetAt).Seconds())+1))
+	}
+	return result.Exceeded
+}
+
+// attribute resolves the project and team the request is charged to
+func (h *Handler) attribute(c *gin.Context, req *models.GuardRequest) budget.Attribution {
+	if h.budgets == nil {
+		return budget.Attribution{UserID: req.UserID}
+	}
+	return h.budgets.Attribute(req.UserID, req.Metadata, h.userGroups(c, req))
+}
+
+// userGroups returns the groups of the request's user: those of the
+// caller's token, or of the user's GoGuard profile
+func (h *Handler) userGroups(c *gin.Context, req *models.GuardRequest) []string {
+	if principal, ok := auth.PrincipalFromContext(c); ok && len(principal.Groups) > 0 {
+		return principal.Groups
+	}
+	if h.policyEngine != nil && req.UserID != "" {
+		if user, err := h.policyEngine.GetUser(c.Request.Context(), req.UserID); err == nil {
+			return user.Groups
+		}
+	}
+	return nil
+}
+
+// suppressor returns the suppressor of the detections of the request's
+// user, nil when none are suppressed for them
+func (h *Handler) suppressor(c *gin.Context, req *models.GuardRequest) injection.Suppressor {
+	if h.suppressions == nil {
+		return nil
+	}
+	return h.suppressions.Suppressor(c.Request.Context(), req.UserID, h.userGroups(c, req))
+}
+
+// recordSuppressed counts the detections suppressions dropped from a report
+func (h *Handler) recordSuppressed(report *models.SecurityReport) {
+	if h.suppressions != nil {
+		h.suppressions.Record(report.Suppressed)
+	}
+}
+
+// checkBudgets returns an enforced budget covering the request that has been
+// spent, auditing the request as blocked unless in observe mode
+func (h *Handler) checkBudgets(c *gin.Context, action string, req *models.GuardRequest, attribution budget.Attribution) *models.Budget {
+	if h.budgets == nil || canary.IsProbe(c.Request.Context()) {
+		return nil
+	}
+	exhausted := h.budgets.Exhausted(c.Request.Context(), attribution)
+	if exhausted == nil || h.observe || h.auditLogger == nil {
+		return exhausted
+	}
+
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		UserID:       req.UserID,
+		ResourceType: "llm",
+		RequestID:    req.RequestID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusBlocked,
+		Details: map[string]interface{}{
+			"action":       action,
+			"blocked_by":   "budget",
+			"budget_id":    exhausted.ID,
+			"project":      attribution.Project,
+			"team":         attribution.Team,
+			"limit_amount": exhausted.LimitAmount,
+		},
+	})
+	return exhausted
+}
+
+// logQuotaExceeded records a request blocked by a quota
+func (h *Handler) logQuotaExceeded(c *gin.Context, action string, req *models.GuardRequest, exceeded *quota.Status) {
+	if h.auditLogger == nil {
+		return
+	}
+
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		UserID:       req.UserID,
+		ResourceType: "llm",
+		RequestID:    req.RequestID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusBlocked,
+		PolicyResults: []models.PolicyEvaluation{{
+			PolicyID:    exceeded.PolicyID,
+			PolicyName:  exceeded.PolicyName,
+			Matched:     true,
+			Action:      models.ActionThrottle,
+			Message:     fmt.Sprintf("%d requests per %s exceeded", exceeded.Limit, exceeded.Window),
+			EvaluatedAt: time.Now(),
+		}},
+		Details: map[string]interface{}{
+			"action":       action,
+			"blocked_by":   "quota",
+			"policy_id":    exceeded.PolicyID,
+			"quota_window": exceeded.Window,
+			"quota_limit":  exceeded.Limit,
+		},
+	})
+}
+
+// acquireSlot waits for the request's turn under the per-user and per-key
+// concurrency limits, auditing requests that time out. The caller must call
+// release once the request is done.
+func (h *Handler) acquireSlot(c *gin.Context, action string, req *models.GuardRequest) (release func(), err error) {
+	if h.concurrency == nil {
+		return func() {}, nil
+	}
+	var apiKeyID string
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		apiKeyID = principal.APIKeyID
+	}
+
+	release, err = h.concurrency.Acquire(c.Request.Context(), req.UserID, apiKeyID)
+	var exceeded *ConcurrencyError
+	if errors.As(err, &exceeded) && h.auditLogger != nil {
+		h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+			EventType:    models.EventTypeRequest,
+			Action:       action,
+			UserID:       req.UserID,
+			ResourceType: "llm",
+			RequestID:    req.RequestID,
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+			Status:       models.AuditStatusBlocked,
+			Details: map[string]interface{}{
+				"action":            action,
+				"blocked_by":        "concurrency",
+				"concurrency_scope": exceeded.Scope,
+				"concurrency_limit": exceeded.Limit,
+			},
+		})
+	}
+	return release, err
+}
+
+// checkModelAccess applies policy model and provider lists to the request,
+// auditing the request if it is blocked
+func (h *Handler) checkModelAccess(c *gin.Context, action string, req *models.GuardRequest, provider, model string) *policy.ModelDenial {
+	if h.policyEngine == nil || (provider == "" && model == "") {
+		return nil
+	}
+
+	denial := h.policyEngine.CheckModelAccess(c.Request.Context(), req.UserID, provider, model)
+	if denial == nil || h.auditLogger == nil || h.observe {
+		return denial
+	}
+
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		UserID:       req.UserID,
+		ResourceType: "llm",
+		RequestID:    req.RequestID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusBlocked,
+		PolicyResults: []models.PolicyEvaluation{{
+			PolicyID:    denial.PolicyID,
+			PolicyName:  denial.PolicyName,
+			Matched:     true,
+			Action:      models.ActionDeny,
+			Message:     denial.Reason,
+			Rollout:     denial.Rollout,
+			EvaluatedAt: time.Now(),
+		}},
+		Details: map[string]interface{}{
+			"action":     action,
+			"blocked_by": "model_access",
+			"policy_id":  denial.PolicyID,
+			"provider":   provider,
+			"model":      model,
+			"reason":     denial.Reason,
+		},
+	})
+	return denial
+}
+
+// checkUserActive refuses requests of users who are inactive or suspended,
+// such as those deactivated by their identity provider, and audits them.
+// Users GoGuard doesn't know are let through.
+func (h *Handler) checkUserActive(c *gin.Context, action string, req *models.GuardRequest) error {
+	if h.policyEngine == nil || req.UserID == "" {
+		return nil
+	}
+	user, err := h.policyEngine.GetUser(c.Request.Context(), req.UserID)
+	if err != nil || user.Status == "" || user.Status == "active" {
+		return nil
+	}
+
+	if h.auditLogger != nil {
+		h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+			EventType:    models.EventTypeRequest,
+			Action:       action,
+			UserID:       req.UserID,
+			ResourceType: "llm",
+			RequestID:    req.RequestID,
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+			Status:       models.AuditStatusBlocked,
+			Details: map[string]interface{}{
+				"action":      action,
+				"blocked_by":  "user_status",
+				"user_status": user.Status,
+			},
+		})
+	}
+	return fmt.Errorf("user %s is %s", req.UserID, user.Status)
+}
+
+// fitContext shortens a conversation longer than the context budget of the
+// policies targeting the request, reporting what was left out in input.
+// The system prompts added afterwards count against the budget. A summary
+// is paid for like any call, so its usage is recorded for the request.
+func (h *Handler) fitContext(c *gin.Context, req *models.GuardRequest, client *llm.Client, provider, model string, messages []models.Message, systemPrompts []policy.SystemPrompt, attribution budget.Attribution, input *models.ProcessedInput) []models.Message {
+	if h.compactor == nil {
+		return messages
+	}
+	ctx := c.Request.Context()
+	budget := h.policyEngine.ContextBudgetFor(ctx, req.UserID, provider, model)
+	if budget == nil {
+		return messages
+	}
+
+	reserved := llm.EstimateTokens(policy.ApplySystemPrompts(messages, systemPrompts), nil) - llm.EstimateTokens(messages, nil)
+	fitted, report := h.compactor.Fit(ctx, messages, req.Tools, reserved, budget, client)
+	if report == nil {
+		return messages
+	}
+	input.Context = report
+	requestid.Logger(ctx).Debug().
+		Str("strategy", report.Strategy).
+		Int("dropped", len(report.Dropped)).
+		Int("original_tokens", report.OriginalTokens).
+		Int("tokens", report.Tokens).
+		Msg("Conversation shortened to fit the context budget")
+
+	if h.spendingTracker != nil && report.SummaryUsage != nil {
+		cost := h.spendingTracker.CalculateCost(report.SummaryModel, report.SummaryUsage.PromptTokens, report.SummaryUsage.CompletionTokens)
+		userID := req.UserID
+		if userID == "" {
+			userID = "default"
+		}
+		if err := h.spendingTracker.RecordUsage(ctx, &models.UsageRecord{
+			RequestID:        req.RequestID,
+			UserID:           userID,
+			Project:          attribution.Project,
+			Team:             attribution.Team,
+			Model:            report.SummaryModel,
+			PromptTokens:     report.SummaryUsage.PromptTokens,
+			CompletionTokens: report.SummaryUsage.CompletionTokens,
+			TotalTokens:      report.SummaryUsage.TotalTokens,
+			Cost:             cost,
+		}); err != nil {
+			c.Error(err)
+		}
+		if h.budgets != nil {
+			h.budgets.Record(ctx, attribution, cost)
+		}
+	}
+	return fitted
+}
+
+// checkModelLimits refuses requests the model can't take, before they cost
+// an upstream call: tools or images it doesn't support, and prompts that
+// don't fit its context window. A max_tokens beyond what the model can
+// produce, or its window leaves room for, is refused too, unless
+// llm.clamp_max_tokens is set; then the max_tokens to send instead is
+// returned. Models without capabilities aren't checked. Refusals are audited
+// as blocked unless in observe mode.
+func (h *Handler) checkModelLimits(c *gin.Context, action string, req *models.GuardRequest, client *llm.Client, model string, messages []models.Message) (int, error) {
+	if h.modelRegistry == nil {
+		return 0, nil
+	}
+	caps, ok := h.modelRegistry.Lookup(model)
+	if !ok {
+		return 0, nil
+	}
+
+	prompt := llm.EstimateTokens(messages, req.Tools)
+	var reason string
+	switch {
+	case !caps.Tools && (len(req.Tools) > 0 || models.HasTools(messages)):
+		reason = fmt.Sprintf("model %s doesn't support tools", model)
+	case !caps.Vision && models.AnyImages(messages):
+		reason = fmt.Sprintf("model %s doesn't accept images", model)
+	case caps.ContextWindow > 0 && prompt >= caps.ContextWindow:
+		reason = fmt.Sprintf("prompt of about %d tokens exceeds the %d-token context window of model %s", prompt, caps.ContextWindow, model)
+	default:
+		limit := caps.MaxOutputTokens
+		if room := caps.ContextWindow - prompt; caps.ContextWindow > 0 && (limit == 0 || room < limit) {
+			limit = room
+		}
+		maxTokens := client.MaxTokens()
+		if limit <= 0 || maxTokens <= limit {
+			return 0, nil
+		}
+		if h.modelRegistry.Clamp() {
+			requestid.Logger(c.Request.Context()).Debug().
+				Str("model", model).
+				Int("max_tokens", maxTokens).
+				Int("clamped_to", limit).
+				Msg("Clamped max_tokens to fit the model")
+			return limit, nil
+		}
+		reason = fmt.Sprintf("max_tokens of %d exceeds the %d tokens model %s can return for a prompt of about %d tokens", maxTokens, limit, model, prompt)
+	}
+
+	if h.auditLogger != nil && !h.observe {
+		h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+			EventType:    models.EventTypeRequest,
+			Action:       action,
+			UserID:       req.UserID,
+			ResourceType: "llm",
+			RequestID:    req.RequestID,
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.Request.UserAgent(),
+			Status:       models.AuditStatusBlocked,
+			Details: map[string]interface{}{
+				"action":        action,
+				"blocked_by":    "model_limits",
+				"model":         model,
+				"prompt_tokens": prompt,
+				"reason":        reason,
+			},
+		})
+	}
+	return 0, errors.New(reason)
+}
+
+// toolNames returns the functions a request offers the model and those
+// already called in its conversation
+func toolNames(req *models.GuardRequest) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, tool := range req.Tools {
+		add(tool.Function.Name)
+	}
+	for _, msg := range req.Messages {
+		for _, call := range msg.ToolCalls {
+			add(call.Function.Name)
+		}
+	}
+	return names
+}
+
+// checkToolAccess applies the tool allow/deny lists of policies to the
+// request's tools and audits denials
+func (h *Handler) checkToolAccess(c *gin.Context, action string, req *models.GuardRequest, provider, model string) *policy.ToolDenial {
+	if h.policyEngine == nil {
+		return nil
+	}
+
+	denial := h.policyEngine.CheckToolAccess(c.Request.Context(), req.UserID, provider, model, toolNames(req))
+	if denial == nil || h.auditLogger == nil || h.observe {
+		return denial
+	}
+
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		UserID:       req.UserID,
+		ResourceType: "llm",
+		RequestID:    req.RequestID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusBlocked,
+		PolicyResults: []models.PolicyEvaluation{{
+			PolicyID:    denial.PolicyID,
+			PolicyName:  denial.PolicyName,
+			Matched:     true,
+			Action:      models.ActionDeny,
+			Message:     denial.Reason,
+			Rollout:     denial.Rollout,
+			EvaluatedAt: time.Now(),
+		}},
+		Details: map[string]interface{}{
+			"action":     action,
+			"blocked_by": "tool_access",
+			"policy_id":  denial.PolicyID,
+			"tool":       denial.Tool,
+			"reason":     denial.Reason,
+		},
+	})
+	return denial
+}
+
+// injectionThreshold returns the lowest threat level a policy blocks the
+// request's prompt injections at, or nil if no policy does. Policies in
+// observe mode are looked at when ctx selects them.
+func (h *Handler) injectionThreshold(ctx context.Context, req *models.GuardRequest) *policy.InjectionThreshold {
+	if h.policyEngine == nil {
+		return nil
+	}
+	return h.policyEngine.InjectionThresholdFor(ctx, req.UserID, req.Provider, req.Model)
+}
+
+// blockedByInjectionPolicy reports whether threshold blocks the injection
+// in a report, giving the policy as the report's reason if it does
+func blockedByInjectionPolicy(threshold *policy.InjectionThreshold, report *models.SecurityReport) bool {
+	if threshold == nil || !injection.ShouldBlockAt(report, threshold.Level) {
+		return false
+	}
+	report.BlockedReason = fmt.Sprintf("Prompt injection denied by policy '%s' (%s threat level or above)", threshold.PolicyName, threshold.Level)
+	return true
+}
+
+// logInjectionPolicy records a request blocked by an injection policy
+func (h *Handler) logInjectionPolicy(c *gin.Context, action string, req *models.GuardRequest, threshold *policy.InjectionThreshold, report *models.SecurityReport) {
+	if h.auditLogger == nil || h.observe {
+		return
+	}
+
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		UserID:       req.UserID,
+		ResourceType: "llm",
+		RequestID:    req.RequestID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusBlocked,
+		PolicyResults: []models.PolicyEvaluation{{
+			PolicyID:    threshold.PolicyID,
+			PolicyName:  threshold.PolicyName,
+			Matched:     true,
+			Action:      models.ActionDeny,
+			Message:     report.BlockedReason,
+			Rollout:     threshold.Rollout,
+			EvaluatedAt: time.Now(),
+		}},
+		Details: map[string]interface{}{
+			"action":       action,
+			"blocked_by":   "injection_policy",
+			"policy_id":    threshold.PolicyID,
+			"threat_level": report.ThreatLevel,
+		},
+	})
+}
+
+// trackConversation analyzes a request with the earlier turns of its
+// conversation and records it, PII-masked, as the latest turn
+func (h *Handler) trackConversation(req *models.GuardRequest, masker *pii.Masker, report *models.SecurityReport, suppressor injection.Suppressor) {
+	if h.conversations == nil || req.ConversationID == "" {
+		return
+	}
+	text := injection.LatestUserText(req.Messages)
+	if text == "" {
+		return
+	}
+
+	if req.Options.DetectInjection() {
+		earlier := h.conversations.Turns(req.UserID, req.ConversationID)
+		h.injectionDetector.AnalyzeConversation(report, earlier, req.Messages, suppressor)
+	}
+	masked, _ := masker.Mask([]models.Message{{Role: "user", Content: text}})
+	h.conversations.Record(req.UserID, req.ConversationID, models.ConversationTurn{
+		RequestID:   req.RequestID,
+		Text:        masked[0].Content,
+		ThreatLevel: report.ThreatLevel,
+		Detections:  len(report.Detections),
+	})
+}
+
+// scanLimitError explains why a prompt over the scan limit is refused
+func scanLimitError(limit int) string {
+	return fmt.Sprintf("Prompt too large: only the first %d bytes are scanned for injections", limit)
+}
+
+// errGuardOptionsForbidden is returned for guard options from callers not
+// allowed to set them
+var errGuardOptionsForbidden = fmt.Errorf("guard_options need an API key with the %s permission", auth.PermGuardOverride)
+
+// guardMasker checks a request's guard options and returns the PII masker
+// they ask for. Options from callers without the guard:override permission
+// are refused and audited, since they switch protections off.
+func (h *Handler) guardMasker(c *gin.Context, req *models.GuardRequest) (*pii.Masker, error) {
+	opts := req.Options
+	if opts == nil {
+		return h.piiMasker, nil
+	}
+
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok && h.authenticator != nil {
+		principal = h.authenticator.Resolve(c)
+		if c.IsAborted() {
+			return nil, errGuardOptionsForbidden
+		}
+	}
+	if principal == nil || principal.APIKeyID == "" || !principal.Has(auth.PermGuardOverride) {
+		if h.auditLogger != nil {
+			h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+				EventType:    models.EventTypeRequest,
+				Action:       "guard",
+				UserID:       req.UserID,
+				ResourceType: "llm",
+				RequestID:    req.RequestID,
+				IPAddress:    c.ClientIP(),
+				UserAgent:    c.Request.UserAgent(),
+				Status:       models.AuditStatusBlocked,
+				Details: map[string]interface{}{
+					"action":        "guard",
+					"blocked_by":    "guard_options",
+					"guard_options": guardOptionDetails(opts),
+				},
+			})
+		}
+		return nil, errGuardOptionsForbidden
+	}
+
+	if opts.BlockThreshold != "" && (opts.BlockThreshold == "none" || !slices.Contains(injection.ThreatLevels, opts.BlockThreshold)) {
+		return nil, fmt.Errorf("guard_options.block_threshold must be low, medium, high or critical, not %q", opts.BlockThreshold)
+	}
+	if opts.PIIMode == "" {
+		return h.piiMasker, nil
+	}
+	masker, err := h.piiMasker.WithMode(opts.PIIMode)
+	if err != nil {
+		return nil, fmt.Errorf("guard_options.pii_mode: %w", err)
+	}
+	return masker, nil
+}
+
+// guardOptionDetails lists the guard options a request set, for its audit entry
+func guardOptionDetails(opts *models.GuardOptions) map[string]interface{} {
+	details := make(map[string]interface{})
+	if opts.InjectionDetection != nil {
+		details["injection_detection"] = *opts.InjectionDetection
+	}
+	if opts.PIIMasking != nil {
+		details["pii_masking"] = *opts.PIIMasking
+	}
+	if opts.PIIMode != "" {
+		details["pii_mode"] = opts.PIIMode
+	}
+	if opts.BlockThreshold != "" {
+		details["block_threshold"] = opts.BlockThreshold
+	}
+	return details
+}
+
+// scanSecrets looks for credentials in messages, auditing requests blocked
+// for them. It returns a nil report when secret detection is off.
+func (h *Handler) scanSecrets(c *gin.Context, action string, req *models.GuardRequest, messages []models.Message, probe bool) ([]models.Message, *models.SecretsReport) {
+	if h.secretsDetector == nil {
+		return messages, nil
+	}
+
+	scanned, report := h.secretsDetector.Scan(messages)
+	if report.Action != secrets.ActionBlock || h.auditLogger == nil || probe || h.observe {
+		return scanned, report
+	}
+
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		UserID:       req.UserID,
+		ResourceType: "llm",
+		RequestID:    req.RequestID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusBlocked,
+		Details: map[string]interface{}{
+			"action":       action,
+			"blocked_by":   "secrets",
+			"secret_types": secretTypes(report),
+			"secret_count": float64(report.SecretCount),
+		},
+	})
+	return scanned, report
+}
+
+// secretTypes lists the types of secrets found, once each
+func secretTypes(report *models.SecretsReport) []string {
+	var types []string
+	for _, f := range report.Findings {
+		if !slices.Contains(types, f.Type) {
+			types = append(types, f.Type)
+		}
+	}
+	return types
+}
+
+// secretsError is the error shown for a request blocked for its secrets
+func secretsError(report *models.SecretsReport) string {
+	return fmt.Sprintf("Request blocked: it contains credentials (%s). Remove them and retry.", strings.Join(secretTypes(report), ", "))
+}
+
+// piiBlockedError tells the caller which PII types may not be sent
+func piiBlockedError(report *models.PIIReport) string {
+	return fmt.Sprintf("Request blocked: it contains PII that may not be sent (%s). Remove it and retry.", strings.Join(report.BlockedTypes, ", "))
+}
+
+// checkTopics checks the masked request against topic policies and audits
+// denials. It returns nil when no topic policy applies.
+func (h *Handler) checkTopics(c *gin.Context, action string, req *models.GuardRequest, provider, model string, messages []models.Message) *models.TopicReport {
+	if h.topicChecker == nil {
+		return nil
+	}
+
+	report, err := h.topicChecker.CheckRequest(c.Request.Context(), req.UserID, provider, model, messages)
+	if !errors.Is(err, topics.ErrTopicDenied) || h.auditLogger == nil || h.observe {
+		return report
+	}
+
+	results := make([]models.PolicyEvaluation, 0, len(report.Violations))
+	for _, v := range report.Violations {
+		results = append(results, models.PolicyEvaluation{
+			PolicyID:    v.PolicyID,
+			PolicyName:  v.PolicyName,
+			Matched:     true,
+			Action:      models.ActionType(v.Action),
+			Message:     v.Reason,
+			EvaluatedAt: time.Now(),
+		})
+	}
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:     models.EventTypeRequest,
+		Action:        action,
+		UserID:        req.UserID,
+		ResourceType:  "llm",
+		RequestID:     req.RequestID,
+		IPAddress:     c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		Status:        models.AuditStatusBlocked,
+		PolicyResults: results,
+		Details: map[string]interface{}{
+			"action":     action,
+			"blocked_by": "topic",
+			"topics":     topicDetails(report.Violations),
+		},
+	})
+	return report
+}
+
+// topicDenial is the error shown for a conversation a topic policy denied
+func topicDenial(report *models.TopicReport) string {
+	for _, v := range report.Violations {
+		if v.Action == string(models.ActionDeny) {
+			return fmt.Sprintf("Topic denied by policy '%s': %s", v.PolicyName, v.Reason)
+		}
+	}
+	return topics.ErrTopicDenied.Error()
+}
+
+// topicDetails summarizes topic violations for the audit log
+func topicDetails(violations []models.TopicViolation) []map[string]interface{} {
+	details := make([]map[string]interface{}, len(violations))
+	for i, v := range violations {
+		details[i] = map[string]interface{}{
+			"policy_id": v.PolicyID,
+			"location":  v.Location,
+			"topic":     v.Topic,
+			"match":     v.Match,
+			"action":    v.Action,
+		}
+	}
+	return details
+}
+
+// evaluatePolicies evaluates the policy types routed to OPA, merged with the
+// built-in policies of those types, auditing the request if it is denied.
+// It returns nil when no policy types are routed to OPA.
+func (h *Handler) evaluatePolicies(c *gin.Context, action string, req *models.GuardRequest, provider, model string, messages []models.Message) *policy.EvaluationResult {
+	if h.policyEngine == nil {
+		return nil
+	}
+	types := h.policyEngine.OPATypes()
+	if len(types) == 0 {
+		return nil
+	}
+
+	result, err := h.policyEngine.EvaluateRequest(c.Request.Context(), evaluationRequest(action, req, provider, model, messages, types))
+	if err != nil {
+		c.Error(err)
+		return nil
+	}
+	if result.Allowed || h.auditLogger == nil || h.observe {
+		return result
+	}
+
+	matched := make([]models.PolicyEvaluation, 0, len(result.Evaluations))
+	for _, eval := range result.Evaluations {
+		if eval.Matched {
+			matched = append(matched, eval)
+		}
+	}
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:     models.EventTypeRequest,
+		Action:        action,
+		UserID:        req.UserID,
+		ResourceType:  "llm",
+		RequestID:     req.RequestID,
+		IPAddress:     c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		Status:        models.AuditStatusBlocked,
+		PolicyResults: matched,
+		Details: map[string]interface{}{
+			"action":     action,
+			"blocked_by": "policy",
+			"policy_id":  result.BlockedBy,
+			"reason":     result.BlockReason,
+		},
+	})
+	return result
+}
+
+// evaluationRequest describes a request for the evaluation of the policies
+// of types
+func evaluationRequest(action string, req *models.GuardRequest, provider, model string, messages []models.Message, types []models.PolicyType) *policy.EvaluationRequest {
+	metadata := make(map[string]interface{}, len(req.Metadata))
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	return &policy.EvaluationRequest{
+		UserID:      req.UserID,
+		Model:       model,
+		Provider:    provider,
+		ContentType: contentType(action),
+		Metadata:    metadata,
+		Messages:    messages,
+		Tools:       toolNames(req),
+		PolicyTypes: types,
+	}
+}
+
+// contentType is the policy content type of requests to an endpoint
+func contentType(action string) string {
+	if action == "embeddings" {
+		return "embedding"
+	}
+	return "chat"
+}
+
+// validateResponse checks a response as JSON, against schema if there is
+// one. When the request asks for repair, an invalid response is sent back to
+// the model once with the errors found, and both calls are charged. A valid
+// response has any code fence around the JSON removed.
+func (h *Handler) validateResponse(ctx context.Context, client *llm.Client, messages []models.Message, req *models.GuardRequest, schema *structured.Schema, resp *models.LLMResponse) (*models.LLMResponse, *models.ValidationReport) {
+	report := &models.ValidationReport{Attempts: 1}
+	content, errs := structured.Check(resp.Content, schema)
+	if len(errs) > 0 && req.ResponseValidation.Repair {
+		report.Attempts = 2
+		repaired, err := client.ChatWithTools(ctx, structured.RepairMessages(messages, resp.Content, errs), req.Tools, req.ToolChoice)
+		if err != nil {
+			report.RepairError = err.Error()
+			requestid.Logger(ctx).Warn().Err(err).Msg("Failed to repair invalid JSON response")
+		} else {
+			repaired.Usage = addUsage(resp.Usage, repaired.Usage)
+			resp = repaired
+			content, errs = structured.Check(resp.Content, schema)
+			report.Repaired = len(errs) == 0
+		}
+	}
+
+	report.Valid = len(errs) == 0
+	report.Errors = errs
+	if report.Valid {
+		resp.Content = content
+	}
+	return resp, report
+}
+
+// addUsage returns the tokens of two calls made for one request
+func addUsage(a, b *models.Usage) *models.Usage {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+	return &models.Usage{
+		PromptTokens:     a.PromptTokens + b.PromptTokens,
+		CompletionTokens: a.CompletionTokens + b.CompletionTokens,
+		TotalTokens:      a.TotalTokens + b.TotalTokens,
+		CacheWriteTokens: a.CacheWriteTokens + b.CacheWriteTokens,
+		CacheReadTokens:  a.CacheReadTokens + b.CacheReadTokens,
+	}
+}
+
+// captureContent stores the request's redacted content if capture is enabled
+// for the user by configuration or by a compliance policy
+func (h *Handler) captureContent(c *gin.Context, req *models.GuardRequest, messages []models.Message, llmResp *models.LLMResponse) {
+	if h.captureService == nil || canary.IsProbe(c.Request.Context()) {
+		return
+	}
+
+	shouldCapture := h.captureService.ShouldCapture(req.UserID)
+	var policyID string
+	var retentionDays int
+	if h.policyEngine != nil {
+		if p := h.policyEngine.ResolveCapturePolicy(c.Request.Context(), req.UserID); p != nil {
+			shouldCapture = true
+			policyID = p.ID
+			retentionDays = p.Config.DataRetentionDays
+		}
+	}
+	if !shouldCapture {
+		return
+	}
+
+	if err := h.captureService.Capture(c.Request.Context(), req, messages, llmResp, policyID, retentionDays); err != nil {
+		// Log error but don't fail the request
+		c.Error(err)
+	}
+}
+
+// requestUsage is who a forwarded request is charged to, what it cost, the
+// mandated system prompts it was sent with and how its response was moderated
+type requestUsage struct {
+	attribution    budget.Attribution
+	provider       string
+	model          string
+	tokens         *models.Usage // nil if the request wasn't forwarded
+	cost           float64
+	systemPrompts  []policy.SystemPrompt
+	moderation     *models.ModerationReport
+	validation     *models.ValidationReport
+	context        *models.ContextReport
+	topics         *models.TopicReport
+	secrets        *models.SecretsReport
+	options        *models.GuardOptions
+	conversationID string
+	route          *models.LLMRoute
+	modelAlias     string
+	// maxTokensClamped is the max_tokens sent after lowering it to fit the
+	// model, if it was
+	maxTokensClamped int
+	// upstreamFailure is the kind of failure of the LLM call, if it failed
+	upstreamFailure string
+	// observed is what checks in observe mode would have done
+	observed []models.ObservedAction
+}
+
+// setUsageHeaders reports what a forwarded request cost and what is left of
+// the tightest spending limit or budget covering it, so callers can show
+// spend without parsing the body. Amounts are in USD.
+func (h *Handler) setUsageHeaders(c *gin.Context, userID string, usage *requestUsage) {
+	if usage.tokens != nil {
+		c.Header("X-GoGuard-Cost", strconv.FormatFloat(usage.cost, 'f', 6, 64))
+		c.Header("X-GoGuard-Tokens", strconv.Itoa(usage.tokens.TotalTokens))
+	}
+
+	if userID == "" {
+		userID = "default"
+	}
+	if remaining, found := h.remainingBudget(c, userID, usage.attribution); found {
+		c.Header("X-GoGuard-Remaining-Budget", strconv.FormatFloat(remaining, 'f', 6, 64))
+	}
+}
+
+// remainingBudget returns what is left, in USD, of the tightest spending
+// limit or budget covering a user. It reports false when none applies.
+func (h *Handler) remainingBudget(c *gin.Context, userID string, attribution budget.Attribution) (float64, bool) {
+	remaining, found := 0.0, false
+	if h.spendingTracker != nil {
+		left, ok, err := h.spendingTracker.Remaining(c.Request.Context(), userID)
+		if err != nil {
+			log.Warn().Err(err).Str("user_id", userID).Msg("Failed to compute remaining spend")
+		}
+		remaining, found = left, ok
+	}
+	if h.budgets != nil {
+		if left, ok := h.budgets.Remaining(c.Request.Context(), attribution); ok && (!found || left < remaining) {
+			remaining, found = left, true
+		}
+	}
+	return remaining, found
+}
+
+// requestID returns the ID of the HTTP request, set by the RequestID
+// middleware
+func requestID(c *gin.Context) string {
+	if id := c.GetString("request_id"); id != "" {
+		return id
+	}
+	return requestid.New()
+}
+
+// logRequest logs a request to the audit logger
+func (h *Handler) logRequest(c *gin.Context, requestID, action string, allowed bool, secReport *models.SecurityReport, piiReport *models.PIIReport, duration time.Duration, usage *requestUsage) {
+	if h.auditLogger == nil {
+		return
+	}
+
+	status := models.AuditStatusSuccess
+	if !allowed {
+		status = models.AuditStatusBlocked
+	}
+
+	details := map[string]interface{}{
+		"action": action,
+	}
+	if h.observe {
+		details["observe"] = true
+	}
+
+	if secReport != nil {
+		details["injection_detected"] = secReport.InjectionDetected
+		details["threat_level"] = secReport.ThreatLevel
+		if secReport.InjectionDetected {
+			details["detection_count"] = len(secReport.Detections)
+		}
+		if len(secReport.Suppressed) > 0 {
+			details["suppressed_count"] = len(secReport.Suppressed)
+		}
+		if len(secReport.ToolFindings) > 0 {
+			kinds := make([]string, 0, len(secReport.ToolFindings))
+			for _, f := range secReport.ToolFindings {
+				if !slices.Contains(kinds, f.Type) {
+					kinds = append(kinds, f.Type)
+				}
+			}
+			details["tool_findings"] = kinds
+		}
+	}
+
+	if piiReport != nil {
+		details["pii_detected"] = piiReport.PIIDetected
+		details["pii_count"] = piiReport.PIICount
+	}
+
+	// Numbers are stored as float64, the type they decode to from the
+	// database, so stats and chargeback reports read both alike
+	var userID string
+	if usage != nil {
+		userID = usage.attribution.UserID
+		if usage.attribution.Project != "" {
+			details["project"] = usage.attribution.Project
+		}
+		if usage.attribution.Team != "" {
+			details["team"] = usage.attribution.Team
+		}
+		if usage.tokens != nil {
+			details["provider"] = usage.provider
+			details["model"] = usage.model
+			details["prompt_tokens"] = float64(usage.tokens.PromptTokens)
+			details["completion_tokens"] = float64(usage.tokens.CompletionTokens)
+			details["total_tokens"] = float64(usage.tokens.TotalTokens)
+			details["cost"] = usage.cost
+		}
+		if len(usage.systemPrompts) > 0 {
+			prompts := make([]map[string]interface{}, len(usage.systemPrompts))
+			for i, p := range usage.systemPrompts {
+				prompts[i] = map[string]interface{}{"policy_id": p.PolicyID, "policy_name": p.PolicyName, "mode": p.Mode}
+			}
+			details["system_prompts"] = prompts
+		}
+		if m := usage.moderation; m != nil && (m.Flagged || m.Error != "") {
+			categories := make([]string, len(m.Categories))
+			for i, cat := range m.Categories {
+				categories[i] = cat.Category
+			}
+			details["moderation"] = map[string]interface{}{"categories": categories, "action": m.Action, "error": m.Error}
+		}
+		if v := usage.validation; v != nil && (!v.Valid || v.Attempts > 1) {
+			details["response_validation"] = map[string]interface{}{"valid": v.Valid, "attempts": v.Attempts, "errors": len(v.Errors)}
+		}
+		if r := usage.context; r != nil {
+			details["context"] = map[string]interface{}{"policy_id": r.PolicyID, "strategy": r.Strategy, "dropped": len(r.Dropped), "summarized": r.Summarized, "original_tokens": r.OriginalTokens, "tokens": r.Tokens}
+		}
+		if r := usage.secrets; r != nil && r.SecretsDetected {
+			details["secret_types"] = secretTypes(r)
+			details["secrets_action"] = r.Action
+		}
+		if t := usage.topics; t != nil && len(t.Violations) > 0 {
+			details["topics"] = topicDetails(t.Violations)
+		}
+		if usage.options != nil {
+			details["guard_options"] = guardOptionDetails(usage.options)
+		}
+		if usage.conversationID != "" {
+			details["conversation_id"] = usage.conversationID
+		}
+		if r := usage.route; r != nil {
+			details["route"] = map[string]interface{}{"policy_id": r.PolicyID, "policy_name": r.PolicyName, "llm_profile": r.Profile, "model": r.Model}
+		}
+		if usage.modelAlias != "" {
+			details["model_alias"] = usage.modelAlias
+		}
+		if usage.maxTokensClamped > 0 {
+			details["max_tokens_clamped"] = usage.maxTokensClamped
+		}
+		if len(usage.observed) > 0 {
+			details["would_have_been"] = wouldHaveBeen(usage.observed)
+			details["observed"] = observedDetails(usage.observed)
+		}
+		if usage.upstreamFailure != "" {
+			details["upstream_error"] = usage.upstreamFailure
+			if allowed {
+				status = models.AuditStatusFailure
+			}
+		}
+	}
+
+	entry := &models.AuditLog{
+		RequestID:    requestID,
+		UserID:       userID,
+		EventType:    models.EventTypeRequest,
+		Action:       action,
+		ResourceType: "llm",
+		Status:       status,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Duration:     duration,
+		Details:      details,
+	}
+
+	// The entry is saved even if the caller has gone away
+	ctx := context.WithoutCancel(c.Request.Context())
+	h.auditLogger.Log(ctx, entry)
+
+	// Critical injections let through in observe mode don't count against
+	// the client's address either
+	if h.network != nil && (!allowed || (secReport != nil && secReport.ThreatLevel == "critical" && !h.observe)) && !canary.IsProbe(ctx) {
+		if block := h.network.RecordOffense(ctx, c.ClientIP()); block != nil {
+			h.auditLogger.Log(ctx, &models.AuditLog{
+				RequestID:    requestID,
+				EventType:    models.EventTypeSecurityAlert,
+				Action:       "ip_auto_block",
+				ResourceType: "ip_block",
+				ResourceID:   block.ID,
+				Status:       models.AuditStatusBlocked,
+				IPAddress:    c.ClientIP(),
+				UserAgent:    c.Request.UserAgent(),
+				Details:      map[string]interface{}{"cidr": block.CIDR, "reason": block.Reason, "expires_at": block.ExpiresAt},
+			})
+		}
+	}
 }
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/requestid"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+const (
+	// IdempotencyKeyHeader names the client's key for a POST request, so a
+	// retry returns the original response instead of repeating the request
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayHeader is set on responses replayed for a repeated key
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength bounds the keys clients may send
+	maxIdempotencyKeyLength = 255
+
+	// maxIdempotentBody bounds the response bodies kept for replay; larger
+	// responses aren't kept, so a retry runs the request again
+	maxIdempotentBody = 1 << 20
+)
+
+// idempotentResponse is a response kept for replay, with the hash of the
+// request that produced it
+type idempotentResponse struct {
+	RequestHash string              `json:"request_hash"`
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+// Idempotency replays the responses of POST requests sent again with the
+// same Idempotency-Key. Keys are scoped to the caller and the route, and
+// responses are kept in a cache, so with Redis a retry reaching another
+// replica is replayed too.
+type Idempotency struct {
+	store cache.Cache
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]bool // keys of requests being handled on this instance
+}
+
+// NewIdempotency creates the middleware's state; responses are kept for
+// ttl, or a day when it isn't set
+func NewIdempotency(store cache.Cache, ttl time.Duration) *Idempotency {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Idempotency{store: store, ttl: ttl, inFlight: make(map[string]bool)}
+}
+
+// Middleware handles POST requests with an Idempotency-Key. It must run
+// after the caller is identified. A key reused with a different body is
+// refused with 422, and one whose first request is still running with 409.
+// Server errors aren't kept, so a retry after one runs the request again.
+func (i *Idempotency) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortIdempotency(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			abortIdempotency(c, http.StatusBadRequest, "failed to read request body: "+err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(hash[:])
+		storeKey := i.storeKey(c, key)
+
+		ctx := c.Request.Context()
+		var saved idempotentResponse
+		found, err := i.store.Get(ctx, storeKey, &saved)
+		if err != nil {
+			log.Warn().Err(err).Msg("Idempotency cache read failed")
+		}
+		if found {
+			if saved.RequestHash != requestHash {
+				abortIdempotency(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+				return
+			}
+			replay(c, &saved)
+			return
+		}
+
+		if !i.begin(storeKey) {
+			abortIdempotency(c, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			return
+		}
+		defer i.end(storeKey)
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || recorder.truncated {
+			return
+		}
+		saved = idempotentResponse{
+			RequestHash: requestHash,
+			Status:      status,
+			Header:      replayedHeader(recorder.Header()),
+			Body:        recorder.body.Bytes(),
+		}
+		if err := i.store.Set(ctx, storeKey, saved, i.ttl); err != nil {
+			log.Warn().Err(err).Msg("Idempotency cache write failed")
+		}
+	}
+}
+
+// storeKey scopes a client's key to its tenant, caller and route
+func (i *Idempotency) storeKey(c *gin.Context, key string) string {
+	var caller string
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		caller = principal.UserID + "/" + principal.APIKeyID
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{tenant.Filter(c.Request.Context()), caller, c.Request.URL.Path, key}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// begin marks a key as in flight, reporting false when it already is
+func (i *Idempotency) begin(key string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.inFlight[key] {
+		return false
+	}
+	i.inFlight[key] = true
+	return true
+}
+
+func (i *Idempotency) end(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.inFlight, key)
+}
+
+// replay writes a kept response again. Nothing changes, so it isn't
+// audited as a mutation.
+func replay(c *gin.Context, saved *idempotentResponse) {
+	c.Set(auditedKey, true)
+	for name, values := range saved.Header {
+		c.Writer.Header()[name] = values
+	}
+	c.Header(IdempotentReplayHeader, "true")
+	c.Data(saved.Status, c.Writer.Header().Get("Content-Type"), saved.Body)
+	c.Abort()
+}
+
+// replayedHeader copies the response headers worth replaying. The request
+// ID and length belong to the response actually sent.
+func replayedHeader(header http.Header) map[string][]string {
+	kept := make(map[string][]string, len(header))
+	for name, values := range header {
+		switch name {
+		case http.CanonicalHeaderKey(requestid.Header), "Content-Length", "Date":
+			continue
+		}
+		kept[name] = values
+	}
+	return kept
+}
+
+func abortIdempotency(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, models.ErrorResponse{Error: message, Code: models.ErrorCodeForStatus(status)})
+}
+
+// responseRecorder keeps a copy of the response body as it is written, up
+// to maxIdempotentBody
+type responseRecorder struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+// fits reports whether n more bytes can be kept, dropping the copy once the
+// body grows past the limit
+func (r *responseRecorder) fits(n int) bool {
+	if r.truncated || r.body.Len()+n > maxIdempotentBody {
+		r.truncated = true
+		r.body.Reset()
+		return false
+	}
+	return true
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if r.fits(len(data)) {
+		r.body.Write(data)
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	if r.fits(len(s)) {
+		r.body.WriteString(s)
+	}
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/canary"
+	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/epps11/goguard/internal/services/settings"
+	"github.com/rs/zerolog/log"
+)
+
+// liveSecurity applies security settings to the running detector, masker
+// and limiters, so settings saved in the dashboard take effect without a
+// restart
+type liveSecurity struct {
+	detector    *injection.Detector
+	masker      *pii.Masker
+	limiter     *RateLimiter
+	concurrency *ConcurrencyLimiter
+	canary      *canary.Canary
+
+	mu      sync.RWMutex
+	current settings.SecuritySettings
+}
+
+func newLiveSecurity(initial settings.SecuritySettings, detector *injection.Detector, masker *pii.Masker, limiter *RateLimiter, concurrency *ConcurrencyLimiter, probe *canary.Canary) *liveSecurity {
+	return &liveSecurity{
+		detector:    detector,
+		masker:      masker,
+		limiter:     limiter,
+		concurrency: concurrency,
+		canary:      probe,
+		current:     initial,
+	}
+}
+
+// Settings returns the settings in effect
+func (l *liveSecurity) Settings() settings.SecuritySettings {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.current
+}
+
+// Apply reconfigures the services with s
+func (l *liveSecurity) Apply(s *settings.SecuritySettings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.detector.SetEnabled(s.InjectionDetectionEnabled)
+	l.detector.SetBlockOnDetection(s.BlockOnDetection)
+	l.masker.SetEnabled(s.PIIMaskingEnabled)
+	l.limiter.SetLimit(s.RateLimitPerMinute)
+	l.concurrency.SetLimits(s.MaxConcurrentPerUser, s.MaxConcurrentPerKey, time.Duration(s.ConcurrencyQueueTimeoutMs)*time.Millisecond)
+	l.canary.SetExpectations(canary.Expectations{
+		InjectionDetection: s.InjectionDetectionEnabled,
+		BlockOnDetection:   s.InjectionDetectionEnabled && s.BlockOnDetection,
+		PIIMasking:         s.PIIMaskingEnabled && slices.Contains(l.masker.Types(), "email"),
+	})
+
+	previous := l.current
+	l.current = *s
+	l.current.Moderation = nil
+	if l.current != previous {
+		log.Info().
+			Bool("injection_detection", s.InjectionDetectionEnabled).
+			Bool("block_on_detection", s.BlockOnDetection).
+			Bool("pii_masking", s.PIIMaskingEnabled).
+			Int("rate_limit_per_minute", s.RateLimitPerMinute).
+			Int("max_concurrent_per_user", s.MaxConcurrentPerUser).
+			Int("max_concurrent_per_key", s.MaxConcurrentPerKey).
+			Msg("Security settings applied")
+	}
+}
+
+// ApplyPII replaces the masker's custom PII types and actions with s
+func (l *liveSecurity) ApplyPII(s *models.PIISettings) error {
+	if l.masker.Custom().Equal(*s) {
+		return nil
+	}
+	if err := l.masker.SetCustom(*s); err != nil {
+		return err
+	}
+	log.Info().
+		Int("custom_types", len(s.Patterns)).
+		Interface("actions", s.Actions).
+		Msg("PII settings applied")
+	return nil
+}
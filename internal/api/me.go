@@ -0,0 +1,130 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/quota"
+)
+
+// recentBlocksLimit is the number of blocked requests /me/usage lists
+const recentBlocksLimit = 10
+
+// MyUsage is what the caller can see of their own spend, limits and quota
+// status without access to the control plane. Amounts are in USD.
+type MyUsage struct {
+	UserID          string                  `json:"user_id"`
+	SpendToday      float64                 `json:"spend_today"`      // since midnight UTC
+	SpendMonth      float64                 `json:"spend_month"`      // since the start of the month, UTC
+	RemainingBudget *float64                `json:"remaining_budget"` // of the tightest spending limit or budget; null when none applies
+	SpendingLimits  []*models.SpendingLimit `json:"spending_limits"`
+	Quotas          []quota.Status          `json:"quotas"`
+	Requests24h     int64                   `json:"requests_24h"`
+	Blocked24h      int64                   `json:"blocked_24h"`
+	RecentBlocks    []BlockedRequest        `json:"recent_blocks"`
+}
+
+// BlockedRequest is one of the caller's requests that was blocked
+type BlockedRequest struct {
+	Timestamp  time.Time             `json:"timestamp"`
+	RequestID  string                `json:"request_id,omitempty"`
+	EventType  models.AuditEventType `json:"event_type"`
+	Action     string                `json:"action"`
+	Reason     string                `json:"reason,omitempty"`
+	PolicyID   string                `json:"policy_id,omitempty"`
+	PolicyName string                `json:"policy_name,omitempty"`
+}
+
+// GetMyUsage reports the authenticated caller's spend, what is left of
+// their limits and quotas, and their recent blocked requests
+func (h *Handler) GetMyUsage(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok || principal.UserID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized", Code: models.ErrCodeUnauthorized})
+		return
+	}
+	ctx := c.Request.Context()
+	userID := principal.UserID
+
+	usage := MyUsage{
+		UserID:         userID,
+		SpendingLimits: []*models.SpendingLimit{},
+		Quotas:         []quota.Status{},
+		RecentBlocks:   []BlockedRequest{},
+	}
+
+	now := time.Now().UTC()
+	filter := models.MetricsFilter{UserIDs: []string{userID}}
+	day := now.Truncate(24 * time.Hour)
+	for _, period := range []struct {
+		start time.Time
+		set   func(models.MetricsGroup)
+	}{
+		{day, func(g models.MetricsGroup) { usage.SpendToday = g.Cost }},
+		{day.AddDate(0, 0, 1-day.Day()), func(g models.MetricsGroup) { usage.SpendMonth = g.Cost }},
+		{now.Add(-24 * time.Hour), func(g models.MetricsGroup) { usage.Requests24h, usage.Blocked24h = g.Count, g.Blocked }},
+	} {
+		groups, err := h.auditLogger.Groups(ctx, period.start, now, models.BreakdownAll, filter)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(groups) > 0 {
+			period.set(groups[0])
+		}
+	}
+
+	if remaining, found := h.remainingBudget(c, userID, h.attribute(c, &models.GuardRequest{UserID: userID})); found {
+		usage.RemainingBudget = &remaining
+	}
+	if h.spendingTracker != nil {
+		limits, err := h.spendingTracker.UserLimits(ctx, userID)
+		if err != nil {
+			log.Warn().Err(err).Str("user_id", userID).Msg("Failed to list spending limits")
+		} else {
+			usage.SpendingLimits = limits
+		}
+	}
+	if h.quotaService != nil && h.policyEngine != nil {
+		usage.Quotas = h.quotaService.Usage(ctx, userID, h.policyEngine.ResolveQuotas(ctx, userID))
+	}
+
+	blocked, _, err := h.auditLogger.Query(ctx, &models.AuditQuery{
+		UserID: userID,
+		Status: models.AuditStatusBlocked,
+		Limit:  recentBlocksLimit,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, entry := range blocked {
+		usage.RecentBlocks = append(usage.RecentBlocks, blockedRequest(&entry))
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// blockedRequest summarizes a blocked request's audit entry, leaving out
+// its details
+func blockedRequest(entry *models.AuditLog) BlockedRequest {
+	b := BlockedRequest{
+		Timestamp: entry.Timestamp,
+		RequestID: entry.RequestID,
+		EventType: entry.EventType,
+		Action:    entry.Action,
+	}
+	b.Reason, _ = entry.Details["reason"].(string)
+	for _, result := range entry.PolicyResults {
+		if result.Matched && (result.Action == models.ActionDeny || result.Action == models.ActionThrottle) {
+			b.PolicyID, b.PolicyName = result.PolicyID, result.PolicyName
+			break
+		}
+	}
+	return b
+}
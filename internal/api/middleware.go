@@ -6,10 +6,27 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/requestid"
 )
 
+// RequestID takes the request's ID from X-Request-ID, or generates one when
+// it is missing or malformed, and returns it in the response. Logs written
+// with the request's context carry it, and so does its audit entry.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Set("request_id", id)
+		c.Header(requestid.Header, id)
+		c.Request = c.Request.WithContext(requestid.With(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
 // RequestLogger logs incoming requests
 func RequestLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -17,14 +34,6 @@ func RequestLogger() gin.HandlerFunc {
 		path := c.Request.URL.Path
 		method := c.Request.Method
 
-		// Get or generate request ID
-		requestID := c.GetHeader("X-Request-ID")
-		if requestID == "" {
-			requestID = uuid.New().String()
-		}
-		c.Set("request_id", requestID)
-		c.Header("X-Request-ID", requestID)
-
 		// Process request
 		c.Next()
 
@@ -32,8 +41,7 @@ func RequestLogger() gin.HandlerFunc {
 		latency := time.Since(start)
 		status := c.Writer.Status()
 
-		log.Info().
-			Str("request_id", requestID).
+		requestid.Logger(c.Request.Context()).Info().
 			Str("method", method).
 			Str("path", path).
 			Int("status", status).
@@ -51,7 +59,8 @@ type RateLimiter struct {
 	window   time.Duration
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates a new rate limiter; a limit of 0 or less lets every
+// request through
 func NewRateLimiter(requestsPerMinute int) *RateLimiter {
 	rl := &RateLimiter{
 		requests: make(map[string][]time.Time),
@@ -73,7 +82,7 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 		if !rl.allow(clientIP) {
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": "Rate limit exceeded",
-				"code":  "RATE_LIMIT_EXCEEDED",
+				"code":  models.ErrCodeRateLimitExceeded,
 			})
 			c.Abort()
 			return
@@ -83,10 +92,21 @@ func (rl *RateLimiter) RateLimit() gin.HandlerFunc {
 	}
 }
 
+// SetLimit changes the requests allowed per client per minute
+func (rl *RateLimiter) SetLimit(requestsPerMinute int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limit = requestsPerMinute
+}
+
 func (rl *RateLimiter) allow(key string) bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
+	if rl.limit <= 0 {
+		return true
+	}
+
 	now := time.Now()
 	windowStart := now.Add(-rl.window)
 
@@ -137,8 +157,8 @@ func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-		c.Header("Access-Control-Expose-Headers", "X-Request-ID")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID, X-GoGuard-API-Version")
+		c.Header("Access-Control-Expose-Headers", "X-Request-ID, X-GoGuard-API-Version, X-GoGuard-PII-Count, X-GoGuard-Request-Id, X-GoGuard-Threat-Level, X-GoGuard-Cost, X-GoGuard-Tokens, X-GoGuard-Remaining-Budget, Deprecation, Sunset, Link, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -154,15 +174,14 @@ func Recovery() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
 			if err := recover(); err != nil {
-				requestID, _ := c.Get("request_id")
-				log.Error().
+				requestID := c.GetString("request_id")
+				requestid.Logger(c.Request.Context()).Error().
 					Interface("error", err).
-					Interface("request_id", requestID).
 					Msg("panic recovered")
 
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error":      "Internal server error",
-					"code":       "INTERNAL_ERROR",
+					"code":       models.ErrCodeInternal,
 					"request_id": requestID,
 				})
 				c.Abort()
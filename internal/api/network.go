@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/canary"
+	"github.com/epps11/goguard/internal/services/netaccess"
+)
+
+// NetworkAccess refuses requests from addresses outside the allowlist or on
+// the denylist. Health checks pass, so load balancers outside the allowlist
+// can still probe instances, and so do the in-process canary probes.
+func NetworkAccess(svc *netaccess.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if path := c.Request.URL.Path; path == "/health" || path == "/ready" || canary.IsProbe(c.Request.Context()) {
+			c.Next()
+			return
+		}
+
+		err := svc.Check(c.Request.Context(), c.ClientIP())
+		if err == nil {
+			c.Next()
+			return
+		}
+
+		log.Debug().Err(err).Str("client_ip", c.ClientIP()).Str("path", c.Request.URL.Path).Msg("Request refused by network access rules")
+		var blocked *netaccess.BlockedError
+		if errors.As(err, &blocked) {
+			if wait := blocked.RetryAfter(time.Now()); wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{Error: "Your address is blocked", Code: models.ErrCodeIPBlocked})
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{Error: "Your address is not allowed", Code: models.ErrCodeIPNotAllowed})
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/canary"
+	"github.com/epps11/goguard/internal/services/moderation"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/quota"
+	"github.com/epps11/goguard/internal/services/secrets"
+	"github.com/epps11/goguard/internal/services/topics"
+)
+
+// What checks in observe mode would have done
+const (
+	observedBlock = "block"
+	observedMask  = "mask"
+	observedStrip = "strip"
+)
+
+// observePolicies checks a request against the policies in observe mode,
+// which never block it or audit it as blocked, and returns what they would
+// have done. Their quotas are counted like enforced ones, so they report
+// the requests they would have throttled.
+func (h *Handler) observePolicies(c *gin.Context, action string, req *models.GuardRequest, provider, model string, messages []models.Message) []models.ObservedAction {
+	if h.policyEngine == nil {
+		return nil
+	}
+	ctx := policy.WithObserved(c.Request.Context())
+
+	var observed []models.ObservedAction
+	if h.quotaService != nil && !canary.IsProbe(ctx) {
+		userID := req.UserID
+		if userID == "" {
+			userID = "default"
+		}
+		if quotas := h.policyEngine.ResolveQuotas(ctx, userID); len(quotas) > 0 {
+			if exceeded := h.quotaService.Consume(ctx, userID, quotas).Exceeded; exceeded != nil {
+				observed = append(observed, quotaObserved(exceeded))
+			}
+		}
+	}
+	if provider != "" || model != "" {
+		if denial := h.policyEngine.CheckModelAccess(ctx, req.UserID, provider, model); denial != nil {
+			observed = append(observed, modelAccessObserved(denial))
+		}
+	}
+	if denial := h.policyEngine.CheckToolAccess(ctx, req.UserID, provider, model, toolNames(req)); denial != nil {
+		observed = append(observed, toolAccessObserved(denial))
+	}
+	if types := h.policyEngine.OPATypes(); len(types) > 0 {
+		result, err := h.policyEngine.EvaluateRequest(ctx, evaluationRequest(action, req, provider, model, messages, types))
+		if err == nil && !result.Allowed {
+			observed = append(observed, policyObserved(result))
+		}
+	}
+	if h.topicChecker != nil && action == "guard" {
+		if report, err := h.topicChecker.CheckRequest(ctx, req.UserID, provider, model, messages); errors.Is(err, topics.ErrTopicDenied) {
+			observed = append(observed, topicObserved(report))
+		}
+	}
+	return observed
+}
+
+// quotaError is the error shown for a request over a quota
+func quotaError(exceeded *quota.Status) string {
+	return fmt.Sprintf("Request quota exceeded: %d requests per %s (policy '%s')",
+		exceeded.Limit, exceeded.Window, exceeded.PolicyName)
+}
+
+func quotaObserved(exceeded *quota.Status) models.ObservedAction {
+	return models.ObservedAction{
+		Stage:      "quota",
+		Action:     observedBlock,
+		Reason:     quotaError(exceeded),
+		PolicyID:   exceeded.PolicyID,
+		PolicyName: exceeded.PolicyName,
+	}
+}
+
+// budgetError is the error shown for a request covered by a spent budget
+func budgetError(exhausted *models.Budget) string {
+	return fmt.Sprintf("Budget '%s' exhausted: %.2f of %.2f %s spent this period",
+		exhausted.Name, exhausted.CurrentSpend, exhausted.LimitAmount, exhausted.Currency)
+}
+
+func budgetObserved(exhausted *models.Budget) models.ObservedAction {
+	return models.ObservedAction{Stage: "budget", Action: observedBlock, Reason: budgetError(exhausted)}
+}
+
+func modelAccessObserved(denial *policy.ModelDenial) models.ObservedAction {
+	return models.ObservedAction{
+		Stage:      "model_access",
+		Action:     observedBlock,
+		Reason:     denial.Reason,
+		PolicyID:   denial.PolicyID,
+		PolicyName: denial.PolicyName,
+	}
+}
+
+func toolAccessObserved(denial *policy.ToolDenial) models.ObservedAction {
+	return models.ObservedAction{
+		Stage:      "tool_access",
+		Action:     observedBlock,
+		Reason:     denial.Reason,
+		PolicyID:   denial.PolicyID,
+		PolicyName: denial.PolicyName,
+	}
+}
+
+func policyObserved(result *policy.EvaluationResult) models.ObservedAction {
+	return models.ObservedAction{
+		Stage:    "policy",
+		Action:   observedBlock,
+		Reason:   result.BlockReason,
+		PolicyID: result.BlockedBy,
+	}
+}
+
+// topicObserved names the first topic policy denying the conversation
+func topicObserved(report *models.TopicReport) models.ObservedAction {
+	observed := models.ObservedAction{Stage: "topic", Action: observedBlock, Reason: topicDenial(report)}
+	for _, v := range report.Violations {
+		if v.Action == string(models.ActionDeny) {
+			observed.PolicyID, observed.PolicyName = v.PolicyID, v.PolicyName
+			break
+		}
+	}
+	return observed
+}
+
+// secretsObserved returns what the secrets detector would have done to a
+// request, or nil if it would have let it through unchanged
+func secretsObserved(report *models.SecretsReport) *models.ObservedAction {
+	if !report.SecretsDetected {
+		return nil
+	}
+	reason := fmt.Sprintf("credentials found (%s)", strings.Join(secretTypes(report), ", "))
+	switch report.Action {
+	case secrets.ActionBlock:
+		return &models.ObservedAction{Stage: "secrets", Action: observedBlock, Reason: reason}
+	case secrets.ActionMask:
+		return &models.ObservedAction{Stage: "secrets", Action: observedMask, Reason: reason}
+	}
+	return nil
+}
+
+// piiObserved returns what PII masking would have done to a request, or nil
+// if it found no PII
+func piiObserved(report *models.PIIReport) *models.ObservedAction {
+	switch {
+	case report.Blocked:
+		return &models.ObservedAction{Stage: "pii", Action: observedBlock, Reason: piiBlockedError(report)}
+	case report.PIIDetected:
+		return &models.ObservedAction{Stage: "pii", Action: observedMask, Reason: fmt.Sprintf("%d PII values found", report.PIICount)}
+	}
+	return nil
+}
+
+// moderationObserved describes the response moderation would have blocked
+// or redacted
+func moderationObserved(report *models.ModerationReport) models.ObservedAction {
+	observed := models.ObservedAction{Stage: "moderation", Action: observedBlock, Reason: moderation.ErrResponseBlocked.Error()}
+	if report == nil {
+		return observed
+	}
+	if report.Action == moderation.ActionRedact {
+		observed.Action = moderation.ActionRedact
+	}
+	if report.Error != "" {
+		observed.Reason = report.Error
+	} else if len(report.Categories) > 0 {
+		categories := make([]string, len(report.Categories))
+		for i, cat := range report.Categories {
+			categories[i] = cat.Category
+		}
+		observed.Reason = "flagged for " + strings.Join(categories, ", ")
+	}
+	return observed
+}
+
+// wouldHaveBeen is the outcome observed checks would have given a request:
+// block if any would have blocked it, else the first change they would
+// have made to it
+func wouldHaveBeen(observed []models.ObservedAction) string {
+	for _, o := range observed {
+		if o.Action == observedBlock {
+			return observedBlock
+		}
+	}
+	return observed[0].Action
+}
+
+// observedDetails lists observed actions for the audit log
+func observedDetails(observed []models.ObservedAction) []map[string]interface{} {
+	details := make([]map[string]interface{}, len(observed))
+	for i, o := range observed {
+		details[i] = map[string]interface{}{
+			"stage":  o.Stage,
+			"action": o.Action,
+			"reason": o.Reason,
+		}
+		if o.PolicyID != "" {
+			details[i]["policy_id"] = o.PolicyID
+		}
+	}
+	return details
+}
@@ -0,0 +1,465 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/schema"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/gin-gonic/gin"
+)
+
+// operationDoc describes the bodies of a route for the OpenAPI spec. Routes
+// without one are documented from their handler name with a generic JSON
+// body, so the spec covers every route even before it is described.
+type operationDoc struct {
+	summary  string
+	request  interface{} // request body
+	response interface{} // response body, or the list item type when listKey is set
+	listKey  string      // field holding the list in v1 responses: {"<listKey>": [...], "total": n}
+	status   int         // success status, when not 200
+	query    []string    // string query parameters
+	path     string      // documented path, for custom methods whose gin path has a :verb parameter
+}
+
+// operationDocs are keyed by method and path below /api/<version>
+var operationDocs = map[string]operationDoc{
+	// Data plane
+	"POST /guard":      {summary: "Check a request and forward it to the LLM", request: models.GuardRequest{}, response: models.GuardResponse{}},
+	"POST /analyze":    {summary: "Check a request for injections, PII and secrets without calling the LLM", request: models.GuardRequest{}, response: models.GuardResponse{}},
+	"POST /mask":       {summary: "Mask the PII in messages", request: models.GuardRequest{}, response: models.GuardResponse{}},
+	"POST /detect":     {summary: "Check messages for prompt injections", request: models.GuardRequest{}, response: models.GuardResponse{}},
+	"POST /embeddings": {summary: "Create embeddings of PII-masked input", request: models.EmbeddingRequest{}, response: models.EmbeddingResponse{}},
+	"GET /me/usage":    {summary: "Get the caller's spend, remaining budget, quotas and recent blocks", response: MyUsage{}},
+
+	// Policies
+	"GET /control/policies":              {response: models.Policy{}, listKey: "policies", query: []string{"status", "type", "tenant_id", "deleted", "sort", "limit", "offset"}},
+	"POST /control/policies":             {request: models.Policy{}, response: models.Policy{}, status: http.StatusCreated},
+	"GET /control/policies/:id":          {response: models.Policy{}},
+	"PUT /control/policies/:id":          {request: models.Policy{}, response: models.Policy{}},
+	"DELETE /control/policies/:id":       {summary: "Soft-delete a policy, giving a reason", request: DeleteRequest{}, status: http.StatusNoContent, query: []string{"reason"}},
+	"POST /control/policies/:id/restore": {summary: "Restore a soft-deleted policy", response: models.Policy{}},
+	"POST /control/policies:verb": {
+		summary:  "Create policies in one transaction",
+		path:     "/control/policies:batch",
+		request:  []models.Policy{},
+		response: policy.BatchResult{},
+		listKey:  "results",
+		status:   http.StatusCreated,
+	},
+	"GET /control/policies/:id/versions":           {response: models.PolicyVersion{}, listKey: "versions"},
+	"POST /control/policies/:id/rollback/:version": {response: models.Policy{}},
+	"GET /control/policies/:id/metrics":            {response: models.PolicyMetricsReport{}, query: []string{"start", "end", "granularity"}},
+
+	// Spending limits and budgets
+	"GET /control/spending-limits":     {response: models.SpendingLimit{}, listKey: "spending_limits", query: []string{"user_id", "type", "tenant_id", "sort", "limit", "offset"}},
+	"POST /control/spending-limits":    {request: models.SpendingLimit{}, response: models.SpendingLimit{}, status: http.StatusCreated},
+	"GET /control/spending-limits/:id": {response: models.SpendingLimit{}},
+	"PUT /control/spending-limits/:id": {request: models.SpendingLimit{}, response: models.SpendingLimit{}},
+	"GET /control/budgets":             {response: models.Budget{}, listKey: "budgets"},
+	"POST /control/budgets":            {request: models.Budget{}, response: models.Budget{}, status: http.StatusCreated},
+	"GET /control/budgets/:id":         {response: models.Budget{}},
+	"PUT /control/budgets/:id":         {request: models.Budget{}, response: models.Budget{}},
+	"DELETE /control/budgets/:id":      {status: http.StatusNoContent},
+
+	// Users
+	"GET /control/users":                 {response: models.User{}, listKey: "users", query: []string{"status", "role", "tenant_id", "deleted", "sort", "limit", "offset"}},
+	"POST /control/users":                {request: models.User{}, response: models.User{}, status: http.StatusCreated},
+	"GET /control/users/:id":             {response: models.User{}},
+	"PUT /control/users/:id":             {request: models.User{}, response: models.User{}},
+	"DELETE /control/users/:id":          {summary: "Soft-delete a user, giving a reason", request: DeleteRequest{}, status: http.StatusNoContent, query: []string{"reason"}},
+	"POST /control/users/:id/restore":    {summary: "Restore a soft-deleted user", response: models.User{}},
+	"DELETE /control/users/:id/sessions": {summary: "Log a user out of all their dashboard sessions"},
+
+	// Tokens
+	"POST /control/tokens": {summary: "Exchange the caller's credentials for an access and a refresh token", response: auth.TokenPair{}, status: http.StatusCreated},
+	"POST /auth/token":     {summary: "Exchange a refresh token for a new access token and refresh token", request: RefreshTokenRequest{}, response: auth.TokenPair{}},
+	"POST /control/users:verb": {
+		summary:  "Create users all at once",
+		path:     "/control/users:batch",
+		request:  []models.User{},
+		response: policy.BatchResult{},
+		listKey:  "results",
+		status:   http.StatusCreated,
+	},
+
+	// Audit logs, alerts and captures
+	"GET /control/audit/logs": {
+		response: models.AuditLog{},
+		listKey:  "logs",
+		query:    []string{"event_types", "user_id", "request_id", "resource_type", "status", "tenant_id", "start_time", "end_time", "limit", "offset"},
+	},
+	"GET /control/audit/stats":  {response: models.AuditStats{}, query: []string{"period"}},
+	"GET /control/alerts":       {response: models.Alert{}, listKey: "alerts"},
+	"GET /control/captures":     {response: models.CapturedContent{}, listKey: "captures"},
+	"GET /control/captures/:id": {response: models.CapturedContent{}},
+
+	// Tenants
+	"GET /control/tenants":        {response: models.Tenant{}, listKey: "tenants"},
+	"POST /control/tenants":       {request: models.Tenant{}, response: models.Tenant{}, status: http.StatusCreated},
+	"GET /control/tenants/:id":    {response: models.Tenant{}},
+	"PUT /control/tenants/:id":    {request: models.Tenant{}, response: models.Tenant{}},
+	"DELETE /control/tenants/:id": {status: http.StatusNoContent},
+
+	// Custom PII types
+	"GET /control/pii/patterns":          {response: models.PIIPattern{}, listKey: "patterns"},
+	"GET /control/pii/patterns/:name":    {response: models.PIIPattern{}},
+	"PUT /control/pii/patterns/:name":    {request: models.PIIPattern{}, response: models.PIIPattern{}},
+	"DELETE /control/pii/patterns/:name": {status: http.StatusNoContent},
+	"PUT /control/pii/actions/:type":     {request: map[string]interface{}{}},
+	"DELETE /control/pii/actions/:type":  {status: http.StatusNoContent},
+
+	// Model aliases
+	"GET /control/settings/llm/aliases":          {response: models.ModelAlias{}, listKey: "aliases"},
+	"GET /control/settings/llm/aliases/:name":    {response: models.ModelAlias{}},
+	"PUT /control/settings/llm/aliases/:name":    {request: models.ModelAlias{}, response: models.ModelAlias{}},
+	"DELETE /control/settings/llm/aliases/:name": {status: http.StatusNoContent},
+
+	// Model capabilities
+	"GET /control/settings/llm/models":        {response: models.ModelCapabilities{}, listKey: "models"},
+	"GET /control/settings/llm/models/:model": {response: models.ModelCapabilities{}},
+
+	// Blocked client addresses
+	"GET /control/ip-blocks":        {response: models.IPBlock{}, listKey: "ip_blocks"},
+	"POST /control/ip-blocks":       {request: CreateIPBlockRequest{}, response: models.IPBlock{}, status: http.StatusCreated},
+	"DELETE /control/ip-blocks/:id": {status: http.StatusNoContent},
+
+	// Detection suppressions
+	"GET /control/suppressions":        {response: models.DetectionSuppression{}, listKey: "suppressions"},
+	"POST /control/suppressions":       {request: CreateSuppressionRequest{}, response: models.DetectionSuppression{}, status: http.StatusCreated},
+	"DELETE /control/suppressions/:id": {status: http.StatusNoContent},
+
+	// Detection feedback
+	"POST /control/detections/:id/feedback": {request: DetectionFeedbackRequest{}, response: models.DetectionFeedback{}, status: http.StatusCreated},
+	"GET /control/detections/precision":     {response: models.PatternPrecision{}, listKey: "patterns"},
+
+	// Metrics
+	"GET /control/metrics/timeseries": {response: models.Timeseries{}, query: []string{"start", "end", "granularity", "user_id", "group", "model", "provider", "currency", "privacy"}},
+
+	// Other requests with bodies; bodyless POSTs such as rollbacks and syncs
+	// need no entry
+	"POST /control/bundle":           {request: map[string]interface{}{}},
+	"POST /control/reevaluations":    {request: map[string]interface{}{}, status: http.StatusAccepted},
+	"POST /control/api-keys":         {request: CreateAPIKeyRequest{}, status: http.StatusCreated},
+	"POST /control/cache/invalidate": {query: []string{"name"}},
+
+	// Schemas
+	"GET /schemas":       {summary: "List the JSON Schemas of the API models"},
+	"GET /schemas/:name": {summary: "Get the JSON Schema of an API model"},
+	"GET /errors":        {summary: "List the error codes responses may carry"},
+}
+
+// OpenAPI serves an OpenAPI 3.0 spec of the versioned API, generated from
+// the registered routes and the API models
+type OpenAPI struct {
+	engine *gin.Engine
+	once   sync.Once
+	specs  map[APIVersion][]byte
+}
+
+// NewOpenAPI creates the spec server. The spec is generated on the first
+// request, once every route has been registered.
+func NewOpenAPI(engine *gin.Engine) *OpenAPI {
+	return &OpenAPI{engine: engine}
+}
+
+// ServeSpec serves the spec of the negotiated API version, or of v1 outside
+// the versioned routes
+func (o *OpenAPI) ServeSpec(c *gin.Context) {
+	o.once.Do(o.generate)
+	version := APIVersion1
+	if negotiated, ok := c.Get("api_version"); ok {
+		version = negotiated.(APIVersion)
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/json", o.specs[version])
+}
+
+// SwaggerUI serves an interactive explorer of the specs
+func (o *OpenAPI) SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+func (o *OpenAPI) generate() {
+	o.specs = make(map[APIVersion][]byte, len(supportedVersions))
+	for _, version := range supportedVersions {
+		spec, err := json.Marshal(o.spec(version))
+		if err != nil {
+			panic(err) // the spec holds only maps, slices and strings
+		}
+		o.specs[version] = spec
+	}
+}
+
+// ginParam matches the :name path parameters of gin routes
+var ginParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+func (o *OpenAPI) spec(version APIVersion) map[string]interface{} {
+	g := schema.NewOpenAPIGenerator()
+	registerEnums(g)
+	components := make(map[string]interface{})
+	errorSchema := g.Schema(models.ErrorResponse{}, components)
+	if version > APIVersion1 {
+		errorSchema = v2ErrorSchema()
+	}
+
+	prefix := "/api/" + version.String()
+	paths := make(map[string]interface{})
+	operationIDs := make(map[string]int)
+	routes := o.engine.Routes()
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+
+	for _, route := range routes {
+		path, ok := strings.CutPrefix(route.Path, prefix)
+		if !ok || path == "/openapi.json" {
+			continue
+		}
+		doc := operationDocs[route.Method+" "+path]
+		name := handlerName(route.Handler)
+
+		id := lowerFirst(name)
+		if n := operationIDs[id]; n > 0 {
+			id += strconv.Itoa(n + 1)
+		}
+		operationIDs[lowerFirst(name)]++
+
+		op := map[string]interface{}{
+			"operationId": id,
+			"summary":     doc.summary,
+			"tags":        []string{pathTag(path)},
+		}
+		if doc.summary == "" {
+			op["summary"] = humanize(name)
+		}
+
+		openAPIPath, pathParams := ginParam.ReplaceAllString(path, "{$1}"), ginParam.FindAllStringSubmatch(path, -1)
+		if doc.path != "" {
+			openAPIPath, pathParams = doc.path, nil
+		}
+
+		var params []interface{}
+		for _, m := range pathParams {
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range doc.query {
+			params = append(params, map[string]interface{}{
+				"name": q, "in": "query", "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if route.Method == http.MethodPost && (strings.HasPrefix(path, "/control/") || path == "/guard" || path == "/embeddings") {
+			params = append(params, map[string]interface{}{
+				"name": IdempotencyKeyHeader, "in": "header", "schema": map[string]interface{}{"type": "string", "maxLength": maxIdempotencyKeyLength},
+				"description": "Identifies the request across retries; a repeated key gets the original response",
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if doc.request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(g.Schema(doc.request, components)),
+			}
+		} else if route.Method == http.MethodPut {
+			op["requestBody"] = map[string]interface{}{
+				"content": jsonContent(map[string]interface{}{"type": "object"}),
+			}
+		}
+
+		status := doc.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if status != http.StatusNoContent {
+			success["content"] = jsonContent(responseSchema(g, components, doc, version))
+		}
+		errorResponse := map[string]interface{}{"description": "Error", "content": jsonContent(errorSchema)}
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default":            errorResponse,
+		}
+
+		item, _ := paths[openAPIPath].(map[string]interface{})
+		if item == nil {
+			item = make(map[string]interface{})
+			paths[openAPIPath] = item
+		}
+		item[strings.ToLower(route.Method)] = op
+	}
+
+	description := "GoGuard data plane and control plane API."
+	if version == APIVersion1 {
+		description += " v1 is frozen: its response shapes never change."
+	} else {
+		description += ` Lists are returned as {"data": [...], "total": n} and errors as {"error": {"code", "message", "status"}}.`
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "GoGuard API",
+			"version":     version.String(),
+			"description": description,
+		},
+		"servers": []interface{}{map[string]interface{}{"url": prefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// Data plane routes only require credentials when configured to
+		"security": []interface{}{
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{},
+		},
+	}
+}
+
+// responseSchema returns the success body of a route in the shape of version
+func responseSchema(g *schema.Generator, components map[string]interface{}, doc operationDoc, version APIVersion) map[string]interface{} {
+	if doc.response == nil {
+		return map[string]interface{}{"type": "object"}
+	}
+	item := g.Schema(doc.response, components)
+	if doc.listKey == "" {
+		return item
+	}
+
+	listKey := doc.listKey
+	if version > APIVersion1 {
+		listKey = "data"
+	}
+	properties := map[string]interface{}{
+		listKey: map[string]interface{}{"type": "array", "items": item},
+		"total": map[string]interface{}{"type": "integer"},
+	}
+	if doc.listKey == "logs" {
+		properties["limit"] = map[string]interface{}{"type": "integer"}
+		properties["offset"] = map[string]interface{}{"type": "integer"}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{listKey, "total"},
+	}
+}
+
+// v2ErrorSchema describes the v2 error envelope
+func v2ErrorSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"code":    map[string]interface{}{"type": "string", "enum": models.ErrorCodes()},
+					"message": map[string]interface{}{"type": "string"},
+					"status":  map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"code", "message", "status"},
+			},
+			"details": map[string]interface{}{"type": "object"},
+		},
+		"required": []string{"error"},
+	}
+}
+
+func jsonContent(s map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": s}}
+}
+
+// pathTag groups routes by their resource: control/policies/:id is tagged
+// policies, and data plane routes data-plane
+func pathTag(path string) string {
+	path, _, _ = strings.Cut(path, ":")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if segments[0] == "control" && len(segments) > 1 {
+		return segments[1]
+	}
+	if segments[0] == "schemas" {
+		return "schemas"
+	}
+	return "data-plane"
+}
+
+// handlerName returns the method name of a handler, e.g. CreatePolicy for
+// github.com/epps11/goguard/internal/api.(*ControlHandler).CreatePolicy-fm
+func handlerName(handler string) string {
+	name := handler[strings.LastIndex(handler, ".")+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// humanize turns a handler name into a summary: GetLLMSettings becomes
+// "Get LLM settings"
+func humanize(name string) string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		boundary := i == len(runes) ||
+			(unicode.IsUpper(runes[i]) && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]))))
+		if !boundary {
+			continue
+		}
+		word := string(runes[start:i])
+		if len(words) > 0 && strings.ToUpper(word) != word {
+			word = strings.ToLower(word)
+		}
+		words = append(words, word)
+		start = i
+	}
+	return strings.Join(words, " ")
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	runes := []rune(s)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the specs
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>GoGuard API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-standalone-preset.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({
+      urls: [
+        {url: "/api/v1/openapi.json", name: "v1"},
+        {url: "/api/v2/openapi.json", name: "v2"}
+      ],
+      dom_id: "#swagger-ui",
+      presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+      layout: "StandaloneLayout"
+    });
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/services/settings"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// reloadable lists the config fields Reload applies to the running services.
+// Any other change needs a restart.
+var reloadable = map[string]bool{
+	"logging.level":                       true,
+	"security.enable_injection_detection": true,
+	"security.block_on_detection":         true,
+	"security.rate_limit_per_minute":      true,
+	"security.max_concurrent_per_user":    true,
+	"security.max_concurrent_per_key":     true,
+	"security.concurrency_queue_timeout":  true,
+	"security.injection_patterns":         true,
+	"security.max_prompt_length":          true,
+	"security.max_scan_bytes":             true,
+	"security.scan_chunk_bytes":           true,
+	"security.early_exit":                 true,
+	"pii.enable_masking":                  true,
+	"pricing.feed_url":                    true,
+	"pricing.sync_interval":               true,
+	"pricing.refresh_interval":            true,
+}
+
+// configuredSecurity returns the security settings set in the config file
+func configuredSecurity(cfg *config.Config) settings.SecuritySettings {
+	return settings.SecuritySettings{
+		InjectionDetectionEnabled: cfg.Security.EnableInjectionDetection,
+		BlockOnDetection:          cfg.Security.BlockOnDetection,
+		PIIMaskingEnabled:         cfg.PII.EnableMasking,
+		RateLimitPerMinute:        cfg.Security.RateLimitPerMinute,
+		MaxConcurrentPerUser:      cfg.Security.MaxConcurrentPerUser,
+		MaxConcurrentPerKey:       cfg.Security.MaxConcurrentPerKey,
+		ConcurrencyQueueTimeoutMs: int(cfg.Security.ConcurrencyQueueTimeout / time.Millisecond),
+	}
+}
+
+// Reload applies a re-read configuration to the running services without
+// dropping connections. It returns the changed fields it applied and those
+// that only take effect after a restart. Fields that fail to apply are in
+// neither, and are tried again on the next reload.
+func (r *Router) Reload(cfg *config.Config) (applied, restart []string) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	running := *r.config
+	changed := make(map[string]bool)
+	for _, field := range config.Diff(r.config, cfg) {
+		if reloadable[field] {
+			changed[field] = true
+		} else {
+			restart = append(restart, field)
+		}
+	}
+
+	if changed["logging.level"] {
+		level, err := zerolog.ParseLevel(cfg.Logging.Level)
+		if err != nil {
+			level = zerolog.InfoLevel
+		}
+		zerolog.SetGlobalLevel(level)
+		running.Logging.Level = cfg.Logging.Level
+	}
+
+	if changed["security.injection_patterns"] {
+		if err := r.detector.SetCustomPatterns(cfg.Security.InjectionPatterns); err != nil {
+			log.Error().Err(err).Msg("Keeping the running injection patterns")
+			delete(changed, "security.injection_patterns")
+		} else {
+			running.Security.InjectionPatterns = cfg.Security.InjectionPatterns
+		}
+	}
+
+	if changed["security.max_prompt_length"] || changed["security.max_scan_bytes"] ||
+		changed["security.scan_chunk_bytes"] || changed["security.early_exit"] {
+		running.Security.MaxPromptLength = cfg.Security.MaxPromptLength
+		running.Security.MaxScanBytes = cfg.Security.MaxScanBytes
+		running.Security.ScanChunkBytes = cfg.Security.ScanChunkBytes
+		running.Security.EarlyExit = cfg.Security.EarlyExit
+		r.detector.SetScanLimits(cfg.Security.ScanChunkBytes, cfg.Security.ScanLimit(), cfg.Security.EarlyExit)
+	}
+
+	if changed["security.enable_injection_detection"] || changed["security.block_on_detection"] ||
+		changed["security.rate_limit_per_minute"] || changed["pii.enable_masking"] ||
+		changed["security.max_concurrent_per_user"] || changed["security.max_concurrent_per_key"] ||
+		changed["security.concurrency_queue_timeout"] {
+		running.Security.EnableInjectionDetection = cfg.Security.EnableInjectionDetection
+		running.Security.BlockOnDetection = cfg.Security.BlockOnDetection
+		running.Security.RateLimitPerMinute = cfg.Security.RateLimitPerMinute
+		running.Security.MaxConcurrentPerUser = cfg.Security.MaxConcurrentPerUser
+		running.Security.MaxConcurrentPerKey = cfg.Security.MaxConcurrentPerKey
+		running.Security.ConcurrencyQueueTimeout = cfg.Security.ConcurrencyQueueTimeout
+		running.PII.EnableMasking = cfg.PII.EnableMasking
+
+		// Saved dashboard settings still take precedence
+		defaults := configuredSecurity(&running)
+		if r.settingsSvc != nil {
+			r.settingsSvc.SetSecurityDefaults(defaults)
+		} else {
+			r.security.Apply(&defaults)
+		}
+	}
+
+	if changed["pricing.feed_url"] || changed["pricing.sync_interval"] || changed["pricing.refresh_interval"] {
+		running.Pricing = cfg.Pricing
+		if r.spending != nil {
+			r.spending.StartPricing(context.Background(), cfg.Pricing)
+		}
+	}
+
+	r.config = &running
+
+	for field := range changed {
+		applied = append(applied, field)
+	}
+	slices.Sort(applied)
+	logReload(applied, restart)
+	return applied, restart
+}
+
+// logReload reports the outcome of a reload
+func logReload(applied, restart []string) {
+	if len(applied) == 0 && len(restart) == 0 {
+		log.Info().Msg("Configuration reloaded - nothing changed")
+		return
+	}
+	if len(applied) > 0 {
+		log.Info().Str("fields", strings.Join(applied, ", ")).Msg("Configuration reloaded")
+	}
+	if len(restart) > 0 {
+		log.Warn().Str("fields", strings.Join(restart, ", ")).Msg("Changed configuration needs a restart to take effect")
+	}
+}
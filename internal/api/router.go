@@ -1,17 +1,61 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/cache"
 	"github.com/epps11/goguard/internal/config"
 	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/secretstore"
+	"github.com/epps11/goguard/internal/services/actions"
+	"github.com/epps11/goguard/internal/services/anomaly"
+	"github.com/epps11/goguard/internal/services/apikey"
 	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/budget"
+	"github.com/epps11/goguard/internal/services/bulk"
+	"github.com/epps11/goguard/internal/services/bundle"
+	"github.com/epps11/goguard/internal/services/canary"
+	"github.com/epps11/goguard/internal/services/capture"
+	"github.com/epps11/goguard/internal/services/conversation"
+	"github.com/epps11/goguard/internal/services/flags"
+	"github.com/epps11/goguard/internal/services/forecast"
+	"github.com/epps11/goguard/internal/services/fx"
+	"github.com/epps11/goguard/internal/services/health"
+	"github.com/epps11/goguard/internal/services/history"
+	"github.com/epps11/goguard/internal/services/images"
 	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/jobs"
 	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/epps11/goguard/internal/services/moderation"
+	"github.com/epps11/goguard/internal/services/netaccess"
 	"github.com/epps11/goguard/internal/services/pii"
 	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/privacy"
+	"github.com/epps11/goguard/internal/services/quota"
+	"github.com/epps11/goguard/internal/services/reeval"
+	"github.com/epps11/goguard/internal/services/retention"
+	"github.com/epps11/goguard/internal/services/scim"
+	"github.com/epps11/goguard/internal/services/secrets"
 	"github.com/epps11/goguard/internal/services/settings"
+	"github.com/epps11/goguard/internal/services/snapshot"
 	"github.com/epps11/goguard/internal/services/spending"
+	"github.com/epps11/goguard/internal/services/suppression"
+	"github.com/epps11/goguard/internal/services/topics"
+	"github.com/epps11/goguard/internal/tenant"
 )
 
 // Router manages the API routes
@@ -22,13 +66,33 @@ type Router struct {
 	config         *config.Config
 	policyEngine   *policy.Engine
 	auditLogger    *audit.Logger
+	oidcProvider   *auth.OIDCProvider
+	authenticator  *auth.Authenticator
+	snapshots      *snapshot.Manager
+	caches         map[string]cache.Cache
+	scimHandler    *SCIMHandler  // nil unless a SCIM token is set
+	tokenHandler   *TokenHandler // nil when the signing keys can't be loaded
+	idempotency    *Idempotency
+
+	// Services reconfigured by Reload
+	detector    *injection.Detector
+	settingsSvc *settings.Service
+	security    *liveSecurity
+	spending    *spending.Tracker
+	reloadMu    sync.Mutex
+
+	// stopBackground cancels background work started for the router
+	stopBackground context.CancelFunc
 }
 
 // NewRouter creates a new router with all routes configured
+// secretStore resolves secret:// references saved in settings
+// envelope encrypts API keys saved in settings
 // repo is optional - if nil, settings will use defaults from config
-func NewRouter(cfg *config.Config, llmClient *llm.Client, repo ...*database.Repository) *Router {
+func NewRouter(cfg *config.Config, llmClient *llm.Client, secretStore *secretstore.Store, envelope *secretstore.Envelope, repo ...*database.Repository) *Router {
 	// Set Gin mode
 	gin.SetMode(cfg.Server.Mode)
+	registerValidation()
 
 	// Create services
 	detector := injection.NewDetector(
@@ -36,26 +100,71 @@ func NewRouter(cfg *config.Config, llmClient *llm.Client, repo ...*database.Repo
 		cfg.Security.EnableInjectionDetection,
 		cfg.Security.BlockOnDetection,
 	)
+	detector.SetScanLimits(cfg.Security.ScanChunkBytes, cfg.Security.ScanLimit(), cfg.Security.EarlyExit)
 
+	piiTypes, err := pii.WithLocales(cfg.PII.PIITypes, cfg.PII.Locales)
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring unknown PII locale")
+	}
 	masker := pii.NewMasker(
-		cfg.PII.PIITypes,
+		piiTypes,
 		cfg.PII.MaskCharacter,
 		cfg.PII.PreserveDomain,
 		cfg.PII.EnableMasking,
 	)
+	masker.SetPseudonymKey([]byte(cfg.PII.PseudonymKey))
+	if cfg.PII.Mode != "" {
+		if err := masker.SetMode(cfg.PII.Mode); err != nil {
+			log.Warn().Err(err).Msg("Ignoring PII mode - masking PII")
+		}
+	}
+	if masker.Mode() == pii.ModePseudonymize && cfg.PII.PseudonymKey == "" {
+		log.Warn().Msg("No PII pseudonym key set - pseudonyms change when GoGuard restarts")
+	}
 
 	// Create control plane services
 	policyEngine := policy.NewEngine()
 	auditLogger := audit.NewLogger(10000)
 
-	// Initialize settings service and spending tracker with database if provided
-	var settingsSvc *settings.Service
-	var spendingTracker *spending.Tracker
+	// Get repository (may be nil if no database). Without one, settings are
+	// kept in memory, while the policy engine and audit logger already keep
+	// their own state.
+	var dbRepo *database.Repository
 	if len(repo) > 0 && repo[0] != nil {
-		settingsSvc = settings.NewService(repo[0])
-		spendingTracker = spending.NewTracker(repo[0])
+		dbRepo = repo[0]
+	}
+	var stores database.Stores
+	if dbRepo != nil {
+		stores = dbRepo.Stores()
 	}
 
+	// Initialize settings service, and spending tracker with database if provided
+	settingsStore := stores.Settings
+	if settingsStore == nil {
+		settingsStore = database.NewMemory()
+	}
+	settingsSvc := settings.NewService(settingsStore)
+	settingsSvc.SetSecretResolver(secretStore)
+	var spendingTracker *spending.Tracker
+	caches := make(map[string]cache.Cache)
+	if dbRepo != nil {
+		spendingTracker = spending.NewTracker(dbRepo)
+
+		caches["settings"] = newCache(cfg.Cache, "settings", cfg.Cache.SettingsTTL)
+		caches["pricing"] = newCache(cfg.Cache, "pricing", cfg.Cache.PricingTTL)
+		settingsSvc.SetCache(caches["settings"])
+		settingsSvc.SetEncrypter(envelope)
+		if !envelope.Enabled() {
+			log.Warn().Msg("No master key set - API keys saved in the dashboard are stored unencrypted")
+		}
+		spendingTracker.SetPricingCache(caches["pricing"])
+		spendingTracker.StartPricing(context.Background(), cfg.Pricing)
+	}
+	// Verify dashboard-configured credentials periodically when asked to,
+	// until Close
+	background, stopBackground := context.WithCancel(context.Background())
+	settingsSvc.StartLLMValidation(background, cfg.LLM.HealthCheckInterval)
+
 	// Create LLM client factory for per-request provider support
 	llmFactory, err := llm.NewClientFactory(cfg.LLM)
 	var handler *Handler
@@ -67,31 +176,295 @@ func NewRouter(cfg *config.Config, llmClient *llm.Client, repo ...*database.Repo
 		if settingsSvc != nil {
 			llmFactory.SetSettingsProvider(settingsSvc)
 		}
+		// Routing policies pick the profile and model of each request
+		llmFactory.SetRouter(policyEngine)
 		handler = NewHandlerWithFactory(detector, masker, llmFactory, auditLogger, spendingTracker)
 	}
+	handler.SetPolicyEngine(policyEngine)
+	handler.SetSecretsDetector(secrets.NewDetector(cfg.Secrets))
+	if opa := policy.NewOPA(cfg.OPA); opa != nil {
+		policyEngine.SetOPA(opa)
+		log.Info().Str("url", cfg.OPA.URL).Interface("policy_types", opa.Types()).Msg("Policy decisions routed to OPA")
+	}
 
-	// Get repository for control handler (may be nil if no database)
-	var dbRepo *database.Repository
-	if len(repo) > 0 && repo[0] != nil {
-		dbRepo = repo[0]
+	if dbRepo != nil {
+		auditLogger.SetRepository(dbRepo)
+		caches["dashboard"] = newCache(cfg.Cache, "dashboard", cfg.Cache.DashboardTTL)
+		auditLogger.SetDashboardCache(caches["dashboard"])
+		loadPersistedState(stores, dbRepo, policyEngine)
+		// Attach the store only after hydration so loaded state isn't written back
+		policyEngine.SetStore(stores.Policies)
 	}
 	controlHandler := NewControlHandler(policyEngine, auditLogger, settingsSvc, dbRepo)
+	controlHandler.SetSpendingTracker(spendingTracker)
+	controlHandler.SetSecretStore(secretStore)
+	controlHandler.SetEnvelope(envelope)
+
+	// Exchange rates for limits and dashboard spend in currencies besides USD
+	converter := fx.NewConverter(cfg.Currency)
+	converter.Start(context.Background())
+	controlHandler.SetCurrencyConverter(converter)
+	if spendingTracker != nil {
+		spendingTracker.SetConverter(converter)
+	}
+
+	// Audit log retention, archiving purged logs first when configured
+	retentionSvc := retention.NewService(cfg.Audit, stores.Audit, auditLogger, policyEngine)
+	if archiver, err := retention.NewArchiver(cfg.Audit); err != nil {
+		log.Error().Err(err).Msg("Failed to initialize audit archiver - retention disabled")
+	} else {
+		if archiver != nil {
+			retentionSvc.SetArchiver(archiver)
+		}
+		retentionSvc.Start(context.Background())
+	}
+	controlHandler.SetRetentionService(retentionSvc)
+	controlHandler.SetCaches(caches)
+	controlHandler.SetLLMFactory(handler.llmFactory)
+
+	// Requests a model can't take are refused before they are forwarded
+	modelRegistry := llm.NewRegistry(cfg.LLM)
+	handler.SetModelRegistry(modelRegistry)
+	controlHandler.SetModelRegistry(modelRegistry)
+
+	// Opt-in capture of redacted prompts/responses
+	captureSvc := capture.NewService(cfg.Capture, dbRepo)
+	captureSvc.StartRetention(context.Background(), time.Hour)
+	handler.SetCaptureService(captureSvc)
+	controlHandler.SetCaptureService(captureSvc)
+
+	// Long-running control operations, shared across instances through the database
+	jobQueue := jobs.NewQueue(dbRepo, cfg.Jobs)
+	controlHandler.SetJobQueue(jobQueue)
+	controlHandler.SetReevaluationService(reeval.NewService(cfg.Security, cfg.PII, captureSvc, jobQueue))
+	bundleSvc := bundle.NewService(policyEngine, dbRepo)
+	controlHandler.SetBulkService(bulk.NewService(jobQueue, auditLogger, spendingTracker, detector, masker, bundleSvc))
+	jobQueue.Start(context.Background())
+
+	// Request quotas from rate limit policies, shared through the database when available
+	var quotaStore quota.Store
+	if dbRepo != nil {
+		quotaStore = dbRepo
+	}
+	quotaSvc := quota.NewService(quotaStore)
+	handler.SetQuotaService(quotaSvc)
+	controlHandler.SetQuotaService(quotaSvc)
+	controlHandler.SetStatsPrivacy(privacy.NewPolicy(cfg.Stats.Privacy))
+	controlHandler.SetBundleService(bundleSvc)
+
+	// Group and project budgets, separate from per-user spending limits
+	budgetSvc := budget.NewService(cfg.Budgets, dbRepo, auditLogger)
+	handler.SetBudgetService(budgetSvc)
+	controlHandler.SetBudgetService(budgetSvc)
+
+	// Feature flags for gradual rollout, cached like settings when persisted
+	flagSvc := flags.NewService(dbRepo)
+	if dbRepo != nil {
+		caches["flags"] = newCache(cfg.Cache, "flags", cfg.Cache.SettingsTTL)
+		flagSvc.SetCache(caches["flags"])
+	}
+	controlHandler.SetFeatureFlags(flagSvc)
+
+	// Client address allowlists and denylists, and blocks of abusive
+	// addresses, cached like settings when persisted
+	network, err := netaccess.NewService(cfg.Network, dbRepo)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid network access configuration")
+	}
+	if dbRepo != nil {
+		caches["ip_blocks"] = newCache(cfg.Cache, "ip_blocks", cfg.Cache.SettingsTTL)
+		network.SetCache(caches["ip_blocks"])
+	}
+	handler.SetNetworkAccess(network)
+	controlHandler.SetNetworkAccess(network)
+
+	// False-positive detection suppressions, cached like settings when
+	// persisted
+	suppressions := suppression.NewService(dbRepo)
+	if dbRepo != nil {
+		caches["suppressions"] = newCache(cfg.Cache, "suppressions", cfg.Cache.SettingsTTL)
+		suppressions.SetCache(caches["suppressions"])
+	}
+	handler.SetSuppressions(suppressions)
+	controlHandler.SetSuppressions(suppressions)
+
+	// Month-end spend projection for the dashboard and forecast alerts
+	forecaster := forecast.NewForecaster(cfg.Forecast, dbRepo, auditLogger)
+	forecaster.Start(context.Background())
+	controlHandler.SetForecaster(forecaster)
+
+	// Webhooks and emails of triggered policies
+	dispatcher := actions.NewDispatcher(cfg.Notify, policyEngine, dbRepo)
+	dispatcher.Start(context.Background(), auditLogger)
+	controlHandler.SetActionDispatcher(dispatcher)
+
+	handler.SetFaultInjection(cfg.Server.FaultInjectionEnabled())
+	handler.SetImageScanner(images.NewScanner(cfg.Images, detector, masker))
+
+	// The moderations API is OpenAI's, so an OpenAI LLM's credentials serve both
+	moderationCfg := cfg.Moderation
+	if moderationCfg.APIKey == "" && cfg.LLM.Provider == "openai" {
+		moderationCfg.APIKey = cfg.LLM.APIKey
+		if moderationCfg.BaseURL == "" {
+			moderationCfg.BaseURL = cfg.LLM.BaseURL
+		}
+	}
+	moderator := moderation.NewModerator(moderationCfg)
+	if settingsSvc != nil {
+		moderator.SetSettingsProvider(settingsSvc)
+	}
+	handler.SetModerator(moderator)
+	controlHandler.SetModerator(moderator)
+	handler.SetTopicChecker(topics.NewChecker(policyEngine, handler.llmFactory))
+	handler.SetCompactor(history.NewCompactor(handler.llmFactory))
+	if cfg.Security.Observe() {
+		handler.SetObserveMode(true)
+		log.Warn().Msg("Security mode is observe - requests are checked and logged but not blocked or masked")
+	}
+	if cfg.Conversations.Enabled {
+		conversations := conversation.NewStore(cfg.Conversations)
+		handler.SetConversationStore(conversations)
+		controlHandler.SetConversationStore(conversations)
+	}
+
+	// Synthetic requests checking detection and latency, started once routes exist
+	canaryProbe := canary.NewCanary(cfg.Canary, canary.ExpectationsFromConfig(cfg), auditLogger)
+	controlHandler.SetCanary(canaryProbe)
+
+	// Security settings saved in the dashboard override the config file's
+	// and are applied to the running services
+	securityDefaults := configuredSecurity(cfg)
+	rateLimiter := NewRateLimiter(cfg.Security.RateLimitPerMinute)
+	concurrency := NewConcurrencyLimiter(cfg.Security.MaxConcurrentPerUser, cfg.Security.MaxConcurrentPerKey, cfg.Security.ConcurrencyQueueTimeout)
+	handler.SetConcurrencyLimiter(concurrency)
+	security := newLiveSecurity(securityDefaults, detector, masker, rateLimiter, concurrency, canaryProbe)
+	controlHandler.SetLiveSecurity(security)
+	if settingsSvc != nil {
+		settingsSvc.SetSecurityDefaults(securityDefaults)
+		settingsSvc.WatchSecuritySettings(context.Background(), cfg.Security.SettingsPollInterval, security.Apply)
+		settingsSvc.WatchPIISettings(context.Background(), cfg.Security.SettingsPollInterval, security.ApplyPII)
+	}
+
+	if cfg.Anomaly.Enabled {
+		handler.SetAnomalyAnalyzer(anomaly.NewAnalyzer(cfg.Anomaly, auditLogger))
+		anomaly.NewUsageAnalyzer(cfg.Anomaly, auditLogger).Start(context.Background())
+	}
+
+	// Without a database, optionally persist in-memory state to disk
+	var snapshots *snapshot.Manager
+	if dbRepo == nil && cfg.Snapshot.Enabled {
+		snapshots = snapshot.NewManager(cfg.Snapshot, policyEngine, auditLogger)
+		snapshots.SetQuotaService(quotaSvc)
+		if err := snapshots.Load(); err != nil {
+			log.Error().Err(err).Msg("Failed to load snapshot - starting with empty state")
+		}
+		snapshots.Start(context.Background())
+	}
+
+	oidcProvider, err := auth.NewOIDCProviderFromEnv()
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to initialize OIDC provider")
+	} else {
+		oidcProvider.SetSessionPolicy(auth.NewSessionPolicy(cfg.Auth.Session))
+		oidcProvider.SetSessionStore(newSessionStore(cfg.Auth.Session, cfg.Cache, dbRepo))
+		controlHandler.SetSessions(oidcProvider)
+	}
+
+	// Control plane credentials: JWTs, OIDC sessions, and API keys
+	apiKeySvc := apikey.NewService(dbRepo)
+	authenticator := auth.NewAuthenticator(cfg.JWT.Secret, oidcProvider, apiKeySvc, cfg.Auth.RolePermissions)
+	authenticator.SetBootstrapKey(cfg.Auth.BootstrapAPIKey)
+	jwtValidation := auth.JWTValidation{
+		Leeway:   cfg.JWT.Leeway,
+		Issuer:   cfg.JWT.Issuer,
+		Audience: cfg.JWT.Audience,
+	}
+	authenticator.SetJWTValidation(jwtValidation)
+
+	// GoGuard's own access tokens, signed with the JWT secret or signing keys
+	var tokenHandler *TokenHandler
+	if tokens, err := auth.NewTokenIssuer(cfg.JWT, jwtValidation, oidcProvider); err != nil {
+		log.Error().Err(err).Msg("Failed to load JWT signing keys - tokens can't be issued")
+	} else {
+		authenticator.SetTokenIssuer(tokens)
+		tokenHandler = NewTokenHandler(tokens, authenticator, auditLogger)
+	}
+	if len(cfg.Auth.TrustedIssuers) > 0 {
+		issuers := auth.NewTrustedIssuers(cfg.Auth.TrustedIssuers, cfg.JWT.Leeway)
+		authenticator.SetTrustedIssuers(issuers, policyEngine)
+		log.Info().Int("issuers", issuers.Len()).Msg("Trusting tokens from external identity providers")
+	}
+	handler.SetAuthenticator(authenticator)
+	controlHandler.SetAPIKeyService(apiKeySvc, authenticator)
+
+	// Tenants confine callers to their own policies, users, limits, budgets,
+	// keys and audit log
+	tenantSvc := tenant.NewService(dbRepo)
+	if dbRepo == nil {
+		tenantSvc.SetUsage(func(ctx context.Context, id string) bool {
+			ctx = tenant.WithScope(ctx, id)
+			users, _ := policyEngine.ListUsers(ctx)
+			policies, _ := policyEngine.ListPolicies(ctx)
+			limits, _ := policyEngine.ListSpendingLimits(ctx)
+			budgets, _ := budgetSvc.List(ctx)
+			keys, _ := apiKeySvc.List(ctx)
+			keys = slices.DeleteFunc(keys, func(k *models.APIKey) bool { return k.RevokedAt != nil })
+			return len(users)+len(policies)+len(limits)+len(budgets)+len(keys) > 0
+		})
+	}
+	authenticator.SetTenants(tenantSvc)
+	controlHandler.SetTenantService(tenantSvc)
+	if !cfg.Auth.Enabled {
+		log.Warn().Msg("Control plane authentication is disabled - set auth.enabled to enforce permissions")
+	}
+
+	// Identity providers provision users and groups through SCIM
+	var scimHandler *SCIMHandler
+	if cfg.Auth.SCIM.Token != "" {
+		scimSvc := scim.NewService(policyEngine, stores.Users, cfg.Auth.SCIM)
+		scimHandler = NewSCIMHandler(scimSvc, auditLogger, cfg.Auth.SCIM.Token)
+		log.Info().Str("path", scim.BasePath).Str("tenant", scimSvc.Tenant()).Msg("SCIM provisioning enabled")
+	}
+
+	// /health and /ready check the database, Redis and the provider
+	checker := newHealthChecker(cfg, dbRepo, caches, settingsSvc, handler.llmClient)
+	checker.Start(context.Background())
+	handler.SetHealthChecker(checker)
+	if dbRepo != nil {
+		dbRepo.StartReplay(context.Background())
+		handler.SetPersistenceStatus(dbRepo.PersistenceStatus)
+		handler.SetMetricsWriter(dbRepo.WriteMetrics)
+
+		// Changes saved through other instances invalidate this one's caches
+		changes := &changeApplier{repo: dbRepo, settings: settingsSvc, engine: policyEngine, suppressions: suppressions}
+		dbRepo.StartListening(context.Background(), changes.apply)
+	}
 
 	// Create engine
 	engine := gin.New()
+	// With no trusted proxies X-Forwarded-For is ignored and the peer
+	// address is used, so clients can't pick the address they are seen from
+	if err := engine.SetTrustedProxies(cfg.Network.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("Invalid network.trusted_proxies")
+	}
 
 	// Apply global middleware
+	engine.Use(RequestID())
 	engine.Use(Recovery())
 	engine.Use(RequestLogger())
 	engine.Use(CORS())
 	engine.Use(SecurityHeaders())
 	engine.Use(MaxBodySize(10 * 1024 * 1024)) // 10MB max
 
-	// Apply rate limiting if configured
-	if cfg.Security.RateLimitPerMinute > 0 {
-		rateLimiter := NewRateLimiter(cfg.Security.RateLimitPerMinute)
-		engine.Use(rateLimiter.RateLimit())
-	}
+	// Refuse denied addresses before they count towards rate limits
+	engine.Use(NetworkAccess(network))
+
+	// Rate limiting is installed even when off, as the limit can be set live
+	engine.Use(rateLimiter.RateLimit())
+
+	// Responses kept for clients retrying with an Idempotency-Key, shared by
+	// replicas with a Redis cache
+	caches["idempotency"] = newCache(cfg.Cache, "idempotency", cfg.Cache.IdempotencyTTL)
 
 	router := &Router{
 		engine:         engine,
@@ -100,9 +473,24 @@ func NewRouter(cfg *config.Config, llmClient *llm.Client, repo ...*database.Repo
 		config:         cfg,
 		policyEngine:   policyEngine,
 		auditLogger:    auditLogger,
+		oidcProvider:   oidcProvider,
+		authenticator:  authenticator,
+		snapshots:      snapshots,
+		caches:         caches,
+		scimHandler:    scimHandler,
+		tokenHandler:   tokenHandler,
+		idempotency:    NewIdempotency(caches["idempotency"], cfg.Cache.IdempotencyTTL),
+		detector:       detector,
+		settingsSvc:    settingsSvc,
+		security:       security,
+		spending:       spendingTracker,
+		stopBackground: stopBackground,
 	}
 
+	controlHandler.SetAuthorizer(router.authorize)
 	router.setupRoutes()
+	canaryProbe.SetHandler(engine, "/api/"+APIVersion1.String()+"/guard")
+	canaryProbe.Start(context.Background())
 
 	return router
 }
@@ -111,77 +499,572 @@ func (r *Router) setupRoutes() {
 	// Health endpoints
 	r.engine.GET("/health", r.handler.Health)
 	r.engine.GET("/ready", r.handler.Ready)
+	r.engine.GET("/metrics", r.handler.Metrics)
+
+	if r.config.Server.DebugEndpoints {
+		r.registerDebugRoutes()
+	}
+
+	// API versions share handlers; v2 differs only in its response envelopes
+	versioning := NewVersioning(r.config.API)
+	r.engine.GET("/api/versions", versioning.ListVersions)
 
-	// API v1 routes - Data Plane
-	v1 := r.engine.Group("/api/v1")
+	schemas := NewSchemaRegistry()
+
+	// OpenAPI specs of the routes below, for generating typed clients
+	openAPI := NewOpenAPI(r.engine)
+	r.engine.GET("/openapi.json", openAPI.ServeSpec)
+	r.engine.GET("/docs", openAPI.SwaggerUI)
+
+	for _, version := range supportedVersions {
+		group := r.engine.Group("/api/"+version.String(), versioning.Negotiate(version))
+		group.GET("/schemas", schemas.ListSchemas)
+		group.GET("/schemas/:name", schemas.GetSchema)
+		group.GET("/errors", ListErrorCodes)
+		group.GET("/openapi.json", openAPI.ServeSpec)
+		r.registerDataPlaneRoutes(group)
+		r.registerControlPlaneRoutes(group.Group("/control"))
+		if r.tokenHandler != nil {
+			group.POST("/auth/token", r.tokenHandler.Refresh)
+		}
+	}
+
+	// Public keys of GoGuard's tokens, for services validating them
+	if r.tokenHandler != nil {
+		r.engine.GET("/.well-known/jwks.json", r.tokenHandler.JWKS)
+	}
+
+	if r.scimHandler != nil {
+		r.registerSCIMRoutes(r.engine.Group(scim.BasePath, r.scimHandler.Authenticate()))
+	}
+}
+
+// registerSCIMRoutes mounts SCIM 2.0 user and group provisioning. Deleting
+// a user deactivates them.
+func (r *Router) registerSCIMRoutes(group *gin.RouterGroup) {
+	h := r.scimHandler
+	group.GET("/ServiceProviderConfig", h.ServiceProviderConfig)
+
+	group.GET("/Users", h.ListUsers)
+	group.POST("/Users", h.CreateUser)
+	group.GET("/Users/:id", h.GetUser)
+	group.PUT("/Users/:id", h.ReplaceUser)
+	group.PATCH("/Users/:id", h.PatchUser)
+	group.DELETE("/Users/:id", h.DeactivateUser)
+
+	group.GET("/Groups", h.ListGroups)
+	group.POST("/Groups", h.CreateGroup)
+	group.GET("/Groups/:id", h.GetGroup)
+	group.PUT("/Groups/:id", h.ReplaceGroup)
+	group.PATCH("/Groups/:id", h.PatchGroup)
+	group.DELETE("/Groups/:id", h.DeleteGroup)
+}
+
+// registerDataPlaneRoutes mounts the guard endpoints
+func (r *Router) registerDataPlaneRoutes(api *gin.RouterGroup) {
+	identify := r.identify()
+	// Retries with an Idempotency-Key get the original response rather than
+	// calling the LLM and recording usage again
+	idempotent := r.idempotency.Middleware()
+
+	// Main guard endpoint - full pipeline
+	api.POST("/guard", identify, idempotent, r.handler.Guard)
+
+	// OpenAI-compatible embeddings with PII masking
+	api.POST("/embeddings", identify, idempotent, r.handler.Embeddings)
+
+	// Individual service endpoints
+	api.POST("/analyze", identify, r.handler.Analyze)
+	api.POST("/mask", identify, r.handler.MaskPII)
+	api.POST("/detect", identify, r.handler.DetectInjection)
+
+	// The caller's own usage, for applications showing users their quota status
+	api.GET("/me/usage", r.authenticator.Identify(true), r.handler.GetMyUsage)
+}
+
+// registerControlPlaneRoutes mounts the control plane API
+func (r *Router) registerControlPlaneRoutes(control *gin.RouterGroup) {
+	// Confine each request to the caller's tenant before the routes below
+	control.Use(r.scope())
+	// Every change made through the control plane is audited
+	control.Use(r.controlHandler.AuditMutations())
+	// Creates retried with an Idempotency-Key return the original response
+	control.Use(r.idempotency.Middleware())
+	shared := deploymentWide()
+
+	// Policy management
+	policies := control.Group("/policies")
 	{
-		// Main guard endpoint - full pipeline
-		v1.POST("/guard", r.handler.Guard)
+		policies.POST("", r.authorize(auth.PermPoliciesWrite), r.controlHandler.CreatePolicy)
+		policies.GET("", r.authorize(auth.PermPoliciesRead), r.controlHandler.ListPolicies)
+		policies.GET("/:id", r.authorize(auth.PermPoliciesRead), r.controlHandler.GetPolicy)
+		policies.PUT("/:id", r.authorize(auth.PermPoliciesWrite), r.controlHandler.UpdatePolicy)
+		policies.DELETE("/:id", r.authorize(auth.PermPoliciesWrite), r.controlHandler.DeletePolicy)
+		policies.POST("/:id/restore", r.authorize(auth.PermPoliciesWrite), r.controlHandler.RestorePolicy)
+		policies.GET("/:id/versions", r.authorize(auth.PermPoliciesRead), r.controlHandler.ListPolicyVersions)
+		policies.POST("/:id/rollback/:version", r.authorize(auth.PermPoliciesWrite), r.controlHandler.RollbackPolicy)
+		policies.GET("/:id/deliveries", r.authorize(auth.PermPoliciesRead), r.controlHandler.ListActionDeliveries)
+		policies.GET("/:id/metrics", r.authorize(auth.PermPoliciesRead), r.controlHandler.GetPolicyMetrics)
+	}
+
+	control.POST("/policies:verb", customMethod("batch"), r.authorize(auth.PermPoliciesWrite), r.controlHandler.BatchCreatePolicies)
 
-		// Individual service endpoints
-		v1.POST("/analyze", r.handler.Analyze)
-		v1.POST("/mask", r.handler.MaskPII)
-		v1.POST("/detect", r.handler.DetectInjection)
+	// Delivery log of policy webhook and email actions
+	control.GET("/deliveries", r.authorize(auth.PermPoliciesRead), r.controlHandler.ListActionDeliveries)
+
+	// Policy-as-code bundles cover both policies and spending limits
+	control.GET("/bundle", r.authorize(auth.PermPoliciesRead), r.authorize(auth.PermSpendRead), r.controlHandler.ExportBundle)
+	control.POST("/bundle", r.authorize(auth.PermPoliciesWrite), r.authorize(auth.PermSpendManage), r.controlHandler.ApplyBundle)
+
+	// Spending limits
+	spending := control.Group("/spending-limits")
+	{
+		spending.POST("", r.authorize(auth.PermSpendManage), r.controlHandler.CreateSpendingLimit)
+		spending.GET("", r.authorize(auth.PermSpendRead), r.controlHandler.ListSpendingLimits)
+		spending.GET("/:id", r.authorize(auth.PermSpendRead), r.controlHandler.GetSpendingLimit)
+		spending.PUT("/:id", r.authorize(auth.PermSpendManage), r.controlHandler.UpdateSpendingLimit)
 	}
+	control.GET("/usage", r.authorize(auth.PermSpendRead), r.controlHandler.ListUsageRecords)
+	control.GET("/spending/forecast", r.authorize(auth.PermSpendRead), r.controlHandler.GetSpendForecast)
 
-	// Control Plane API routes
-	control := r.engine.Group("/api/v1/control")
+	// Synthetic canary requests
+	control.GET("/canary", shared, r.authorize(auth.PermSettingsRead), r.controlHandler.GetCanaryStatus)
+	control.POST("/canary/run", shared, r.authorize(auth.PermSettingsWrite), r.controlHandler.RunCanary)
+
+	// Exchange rates
+	control.GET("/currency/rates", r.authorize(auth.PermSpendRead), r.controlHandler.GetExchangeRates)
+	control.POST("/currency/sync", shared, r.authorize(auth.PermSpendManage), r.controlHandler.SyncExchangeRates)
+
+	// Model pricing
+	pricing := control.Group("/pricing")
 	{
-		// Policy management
-		policies := control.Group("/policies")
-		{
-			policies.POST("", r.controlHandler.CreatePolicy)
-			policies.GET("", r.controlHandler.ListPolicies)
-			policies.GET("/:id", r.controlHandler.GetPolicy)
-			policies.PUT("/:id", r.controlHandler.UpdatePolicy)
-			policies.DELETE("/:id", r.controlHandler.DeletePolicy)
-		}
+		pricing.GET("", r.authorize(auth.PermSpendRead), r.controlHandler.ListModelPrices)
+		pricing.POST("/sync", shared, r.authorize(auth.PermSpendManage), r.controlHandler.SyncModelPrices)
+		pricing.GET("/:model", r.authorize(auth.PermSpendRead), r.controlHandler.GetModelPrice)
+		pricing.PUT("/:model", shared, r.authorize(auth.PermSpendManage), r.controlHandler.SetModelPrice)
+		pricing.DELETE("/:model", shared, r.authorize(auth.PermSpendManage), r.controlHandler.DeleteModelPrice)
+	}
+
+	// Group and project budgets
+	budgets := control.Group("/budgets")
+	{
+		budgets.POST("", r.authorize(auth.PermSpendManage), r.controlHandler.CreateBudget)
+		budgets.GET("", r.authorize(auth.PermSpendRead), r.controlHandler.ListBudgets)
+		budgets.GET("/:id", r.authorize(auth.PermSpendRead), r.controlHandler.GetBudget)
+		budgets.PUT("/:id", r.authorize(auth.PermSpendManage), r.controlHandler.UpdateBudget)
+		budgets.DELETE("/:id", r.authorize(auth.PermSpendManage), r.controlHandler.DeleteBudget)
+	}
+	control.GET("/reports/chargeback", r.authorize(auth.PermSpendRead), r.controlHandler.GetChargebackReport)
+
+	// User management
+	users := control.Group("/users")
+	{
+		users.POST("", r.authorize(auth.PermUsersWrite), r.controlHandler.CreateUser)
+		users.GET("", r.authorize(auth.PermUsersRead), r.controlHandler.ListUsers)
+		users.GET("/:id", r.authorize(auth.PermUsersRead), r.controlHandler.GetUser)
+		users.PUT("/:id", r.authorize(auth.PermUsersWrite), r.controlHandler.UpdateUser)
+		users.DELETE("/:id", r.authorize(auth.PermUsersWrite), r.controlHandler.DeleteUser)
+		users.POST("/:id/restore", r.authorize(auth.PermUsersWrite), r.controlHandler.RestoreUser)
+		users.DELETE("/:id/sessions", r.authorize(auth.PermUsersWrite), r.controlHandler.DeleteUserSessions)
+	}
+	control.POST("/users:verb", customMethod("batch"), r.authorize(auth.PermUsersWrite), r.controlHandler.BatchCreateUsers)
+
+	// Access and refresh tokens for the caller
+	if r.tokenHandler != nil {
+		control.POST("/tokens", r.tokenHandler.Issue)
+	}
+
+	// Audit logs
+	audit := control.Group("/audit")
+	{
+		audit.GET("/logs", r.authorize(auth.PermAuditRead), r.controlHandler.QueryAuditLogs)
+		audit.GET("/stats", r.authorize(auth.PermAuditRead), r.controlHandler.GetAuditStats)
+		audit.GET("/retention", r.authorize(auth.PermAuditRead), r.controlHandler.GetAuditRetention)
+		audit.POST("/retention/run", shared, r.authorize(auth.PermAuditManage), r.controlHandler.RunAuditRetention)
+	}
+
+	// Captured content contains user prompts, so it always requires credentials
+	captures := control.Group("/captures", shared, r.authenticator.Require(auth.PermCapturesRead))
+	{
+		captures.GET("", r.controlHandler.ListCapturedContent)
+		captures.GET("/:id", r.controlHandler.GetCapturedContent)
+	}
+
+	// Conversation histories hold PII-masked prompts
+	conversations := control.Group("/conversations", shared, r.authenticator.Require(auth.PermCapturesRead))
+	{
+		conversations.GET("", r.controlHandler.ListConversations)
+		conversations.GET("/:id", r.controlHandler.GetConversation)
+		conversations.DELETE("/:id", r.controlHandler.DeleteConversation)
+	}
+
+	// Re-scans of captured prompts report which requests they identify
+	reevaluations := control.Group("/reevaluations", shared, r.authenticator.Require(auth.PermCapturesRead))
+	{
+		reevaluations.POST("", r.controlHandler.CreateReevaluation)
+		reevaluations.GET("", r.controlHandler.ListReevaluations)
+		reevaluations.GET("/:id", r.controlHandler.GetReevaluation)
+	}
+
+	// Request quota usage
+	control.GET("/quotas", shared, r.authorize(auth.PermPoliciesRead), r.controlHandler.GetQuotaUsage)
+
+	// Dashboard
+	control.GET("/dashboard", r.authorize(auth.PermDashboardRead), r.controlHandler.GetDashboardMetrics)
+	control.GET("/metrics/timeseries", r.authorize(auth.PermDashboardRead), r.controlHandler.GetMetricsTimeseries)
+
+	// Live activity feed (server-sent events)
+	control.GET("/events", r.authorize(auth.PermAuditRead), r.controlHandler.StreamEvents)
+
+	// Background jobs. Creating one and downloading its result require the
+	// permissions of its type, checked by the handlers.
+	jobsGroup := control.Group("/jobs", shared)
+	{
+		jobsGroup.POST("", r.controlHandler.CreateJob)
+		jobsGroup.GET("", r.authorize(auth.PermSettingsRead), r.controlHandler.ListJobs)
+		jobsGroup.GET("/:id", r.authorize(auth.PermSettingsRead), r.controlHandler.GetJob)
+		jobsGroup.GET("/:id/result", r.controlHandler.GetJobResult)
+		jobsGroup.POST("/:id/cancel", r.authorize(auth.PermSettingsWrite), r.controlHandler.CancelJob)
+	}
+
+	// Alerts
+	alerts := control.Group("/alerts")
+	{
+		alerts.GET("", r.authorize(auth.PermAlertsRead), r.controlHandler.GetAlerts)
+		alerts.POST("/:id/ack", r.authorize(auth.PermAlertsManage), r.controlHandler.AckAlert)
+	}
+
+	// Feedback on detections, kept in the audit log
+	detections := control.Group("/detections")
+	{
+		detections.POST("/:id/feedback", r.authorize(auth.PermAlertsManage), r.controlHandler.SubmitDetectionFeedback)
+		detections.GET("/precision", r.authorize(auth.PermAuditRead), r.controlHandler.GetPatternPrecision)
+	}
+
+	// Caches
+	caches := control.Group("/cache", shared)
+	{
+		caches.GET("", r.authorize(auth.PermSettingsRead), r.controlHandler.GetCacheStats)
+		caches.POST("/invalidate", r.authorize(auth.PermSettingsWrite), r.controlHandler.InvalidateCache)
+	}
+
+	// Scan timings
+	control.GET("/scan/stats", shared, r.authorize(auth.PermSettingsRead), r.controlHandler.GetScanStats)
+
+	// Custom PII types and per-type actions
+	piiGroup := control.Group("/pii", shared)
+	{
+		piiGroup.GET("/patterns", r.authorize(auth.PermSettingsRead), r.controlHandler.ListPIIPatterns)
+		piiGroup.GET("/patterns/:name", r.authorize(auth.PermSettingsRead), r.controlHandler.GetPIIPattern)
+		piiGroup.PUT("/patterns/:name", r.authorize(auth.PermSettingsWrite), r.controlHandler.UpdatePIIPattern)
+		piiGroup.DELETE("/patterns/:name", r.authorize(auth.PermSettingsWrite), r.controlHandler.DeletePIIPattern)
+		piiGroup.PUT("/actions/:type", r.authorize(auth.PermSettingsWrite), r.controlHandler.UpdatePIIAction)
+		piiGroup.DELETE("/actions/:type", r.authorize(auth.PermSettingsWrite), r.controlHandler.ResetPIIAction)
+	}
+
+	// Feature flags
+	featureFlags := control.Group("/flags", shared)
+	{
+		featureFlags.GET("", r.authorize(auth.PermSettingsRead), r.controlHandler.ListFeatureFlags)
+		featureFlags.GET("/:key", r.authorize(auth.PermSettingsRead), r.controlHandler.GetFeatureFlag)
+		featureFlags.PUT("/:key", r.authorize(auth.PermSettingsWrite), r.controlHandler.UpdateFeatureFlag)
+		featureFlags.DELETE("/:key", r.authorize(auth.PermSettingsWrite), r.controlHandler.ResetFeatureFlag)
+		featureFlags.GET("/:key/evaluate", r.authorize(auth.PermSettingsRead), r.controlHandler.EvaluateFeatureFlag)
+	}
+
+	// Blocked client addresses
+	ipBlocks := control.Group("/ip-blocks", shared)
+	{
+		ipBlocks.GET("", r.authorize(auth.PermSettingsRead), r.controlHandler.ListIPBlocks)
+		ipBlocks.POST("", r.authorize(auth.PermSettingsWrite), r.controlHandler.CreateIPBlock)
+		ipBlocks.DELETE("/:id", r.authorize(auth.PermSettingsWrite), r.controlHandler.DeleteIPBlock)
+	}
+
+	// Injection detections dropped for some users or groups
+	suppressions := control.Group("/suppressions", shared)
+	{
+		suppressions.GET("", r.authorize(auth.PermSettingsRead), r.controlHandler.ListSuppressions)
+		suppressions.POST("", r.authorize(auth.PermSettingsWrite), r.controlHandler.CreateSuppression)
+		suppressions.DELETE("/:id", r.authorize(auth.PermSettingsWrite), r.controlHandler.DeleteSuppression)
+	}
+
+	// API keys and permissions
+	apiKeys := control.Group("/api-keys", r.authorize(auth.PermAPIKeysManage))
+	{
+		apiKeys.GET("", r.controlHandler.ListAPIKeys)
+		apiKeys.POST("", r.controlHandler.CreateAPIKey)
+		apiKeys.DELETE("/:id", r.controlHandler.RevokeAPIKey)
+	}
+	control.GET("/permissions", r.authorize(auth.PermSettingsRead), r.controlHandler.GetPermissions)
+
+	// Tenants, managed by super admins only
+	tenants := control.Group("/tenants", r.authorize(auth.PermTenantsManage))
+	{
+		tenants.POST("", r.controlHandler.CreateTenant)
+		tenants.GET("", r.controlHandler.ListTenants)
+		tenants.GET("/:id", r.controlHandler.GetTenant)
+		tenants.PUT("/:id", r.controlHandler.UpdateTenant)
+		tenants.DELETE("/:id", r.controlHandler.DeleteTenant)
+	}
+
+	// Settings
+	settingsGroup := control.Group("/settings", shared)
+	{
+		settingsGroup.GET("", r.authorize(auth.PermSettingsRead), r.controlHandler.GetSettings)
+		settingsGroup.GET("/llm", r.authorize(auth.PermSettingsRead), r.controlHandler.GetLLMSettings)
+		settingsGroup.PUT("/llm", r.authorize(auth.PermSettingsWrite), r.controlHandler.UpdateLLMSettings)
+		settingsGroup.GET("/llm/status", r.authorize(auth.PermSettingsRead), r.controlHandler.GetLLMStatus)
+		settingsGroup.POST("/llm/validate", r.authorize(auth.PermSettingsWrite), r.controlHandler.ValidateLLMSettings)
+		settingsGroup.GET("/llm/profiles", r.authorize(auth.PermSettingsRead), r.controlHandler.ListLLMProfiles)
+		settingsGroup.PUT("/llm/profiles/:name", r.authorize(auth.PermSettingsWrite), r.controlHandler.SaveLLMProfile)
+		settingsGroup.DELETE("/llm/profiles/:name", r.authorize(auth.PermSettingsWrite), r.controlHandler.DeleteLLMProfile)
+		settingsGroup.GET("/llm/models", r.authorize(auth.PermSettingsRead), r.controlHandler.ListModelCapabilities)
+		settingsGroup.GET("/llm/models/:model", r.authorize(auth.PermSettingsRead), r.controlHandler.GetModelCapabilities)
+		settingsGroup.GET("/llm/aliases", r.authorize(auth.PermSettingsRead), r.controlHandler.ListModelAliases)
+		settingsGroup.GET("/llm/aliases/:name", r.authorize(auth.PermSettingsRead), r.controlHandler.GetModelAlias)
+		settingsGroup.PUT("/llm/aliases/:name", r.authorize(auth.PermSettingsWrite), r.controlHandler.SaveModelAlias)
+		settingsGroup.DELETE("/llm/aliases/:name", r.authorize(auth.PermSettingsWrite), r.controlHandler.DeleteModelAlias)
+		settingsGroup.GET("/security", r.authorize(auth.PermSettingsRead), r.controlHandler.GetSecuritySettings)
+		settingsGroup.PUT("/security", r.authorize(auth.PermSettingsWrite), r.controlHandler.UpdateSecuritySettings)
+		settingsGroup.GET("/secrets", r.authorize(auth.PermSettingsRead), r.controlHandler.ListSecrets)
+		settingsGroup.POST("/secrets/refresh", r.authorize(auth.PermSettingsWrite), r.controlHandler.RefreshSecrets)
+		settingsGroup.POST("/encryption/rotate", r.authorize(auth.PermSettingsWrite), r.controlHandler.RotateEncryption)
+		settingsGroup.GET("/storage", r.authorize(auth.PermSettingsRead), r.controlHandler.GetStorageInfo)
+		settingsGroup.POST("/storage/migrate", r.authorize(auth.PermSettingsWrite), r.controlHandler.MigrateToDatabase)
+	}
+}
 
-		// Spending limits
-		spending := control.Group("/spending-limits")
-		{
-			spending.POST("", r.controlHandler.CreateSpendingLimit)
-			spending.GET("", r.controlHandler.ListSpendingLimits)
-			spending.GET("/:id", r.controlHandler.GetSpendingLimit)
-			spending.PUT("/:id", r.controlHandler.UpdateSpendingLimit)
+// newCache creates a cache using the configured backend, falling back to
+// memory so a Redis outage at startup doesn't prevent serving traffic
+func newCache(cfg config.CacheConfig, name string, ttl time.Duration) cache.Cache {
+	c, err := cache.New(cfg, name, ttl)
+	if err != nil {
+		log.Warn().Err(err).Str("cache", name).Msg("Failed to initialize cache - using in-memory cache")
+		return cache.NewMemory(ttl)
+	}
+	return c
+}
+
+// newHealthChecker registers the dependency checks of /health and /ready.
+// The database and its schema are critical; Redis and the provider only
+// degrade the instance, as requests can still be served without them.
+func newHealthChecker(cfg *config.Config, repo *database.Repository, caches map[string]cache.Cache, settingsSvc *settings.Service, client *llm.Client) *health.Checker {
+	checker := health.NewChecker(cfg.Server.HealthCheckTimeout)
+	// A database outage degrades the instance rather than taking it out of
+	// service: settings are served from their last-known values and audit
+	// logs and usage records are queued until it is back
+	checker.Add(health.Check{Name: "database", Run: func(ctx context.Context) error {
+		if repo == nil {
+			return health.ErrNotConfigured
+		}
+		return repo.Ping(ctx)
+	}})
+	// Once the schema was verified, an outage leaves the instance ready;
+	// until then it isn't, so new instances wait for the database
+	var schemaVerified atomic.Bool
+	checker.Add(health.Check{Name: "schema", Critical: true, Run: func(ctx context.Context) error {
+		if repo == nil {
+			return health.ErrNotConfigured
+		}
+		version, err := repo.SchemaVersion(ctx)
+		if err != nil && repo.Unavailable(err) && schemaVerified.Load() {
+			return fmt.Errorf("%w: the database is unreachable", health.ErrUnknown)
 		}
+		if errors.Is(err, database.ErrNoSchemaVersion) {
+			return fmt.Errorf("schema version unknown, this build needs %d; apply scripts/init.sql", database.CurrentSchemaVersion)
+		}
+		if err != nil {
+			return err
+		}
+		if version < database.CurrentSchemaVersion {
+			return fmt.Errorf("schema version %d, this build needs %d; apply scripts/init.sql", version, database.CurrentSchemaVersion)
+		}
+		schemaVerified.Store(true)
+		return nil
+	}})
+	checker.Add(health.Check{Name: "redis", Run: func(ctx context.Context) error {
+		if !strings.EqualFold(cfg.Cache.Backend, "redis") || len(caches) == 0 {
+			return health.ErrNotConfigured
+		}
+		for _, c := range caches {
+			if redis, ok := c.(*cache.Redis); ok {
+				return redis.Ping(ctx)
+			}
+		}
+		return errors.New("unreachable at startup, caches are kept in memory")
+	}})
 
-		// User management
-		users := control.Group("/users")
-		{
-			users.POST("", r.controlHandler.CreateUser)
-			users.GET("", r.controlHandler.ListUsers)
-			users.GET("/:id", r.controlHandler.GetUser)
-			users.PUT("/:id", r.controlHandler.UpdateUser)
-			users.DELETE("/:id", r.controlHandler.DeleteUser)
+	// The provider is called at most once per health check interval. The
+	// result of validating dashboard settings, which happens at the same
+	// interval, is used when there is one.
+	if interval := cfg.LLM.HealthCheckInterval; interval > 0 {
+		checker.Add(health.Check{Name: "llm_provider", Interval: interval, Timeout: 30 * time.Second, Run: func(ctx context.Context) error {
+			if settingsSvc != nil {
+				switch status := settingsSvc.GetLLMStatus(settings.DefaultLLMProfile); status.Status {
+				case settings.LLMStatusOK:
+					return nil
+				case settings.LLMStatusError:
+					return errors.New(status.Error)
+				}
+			}
+			if client == nil || !client.IsInitialized() {
+				return health.ErrNotConfigured
+			}
+			return client.Ping(ctx)
+		}})
+	}
+	return checker
+}
+
+// newSessionStore creates the configured session store, falling back to
+// memory when it can't be used
+func newSessionStore(cfg config.SessionConfig, cacheCfg config.CacheConfig, repo *database.Repository) auth.SessionStore {
+	store := strings.ToLower(cfg.Store)
+	if store == "" && repo != nil {
+		store = "database"
+	}
+	switch store {
+	case "", "memory":
+		return auth.NewMemorySessionStore()
+	case "database":
+		if repo == nil {
+			log.Warn().Msg("Session store database requires a database - keeping sessions in memory")
+			return auth.NewMemorySessionStore()
+		}
+		return auth.NewDatabaseSessionStore(repo)
+	case "redis":
+		url := cfg.RedisURL
+		if url == "" {
+			url = cacheCfg.RedisURL
 		}
+		redisStore, err := auth.NewRedisSessionStore(url)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to initialize redis session store - keeping sessions in memory")
+			return auth.NewMemorySessionStore()
+		}
+		return redisStore
+	default:
+		log.Warn().Str("store", cfg.Store).Msg("Unknown session store - keeping sessions in memory")
+		return auth.NewMemorySessionStore()
+	}
+}
 
-		// Audit logs
-		audit := control.Group("/audit")
-		{
-			audit.GET("/logs", r.controlHandler.QueryAuditLogs)
-			audit.GET("/stats", r.controlHandler.GetAuditStats)
+// loadPersistedState seeds the policy engine with policies, their version
+// history, users, groups and spending limits stored in the database,
+// including any migrated from a previous in-memory deployment
+func loadPersistedState(stores database.Stores, repo *database.Repository, engine *policy.Engine) {
+	ctx := context.Background()
+
+	policies, err := stores.Policies.ListPolicies(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load policies from database")
+	}
+	users, err := stores.Users.ListUsers(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load users from database")
+	}
+	versions, err := stores.Policies.ListPolicyVersions(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load policy versions from database")
+	}
+	groups, err := stores.Users.ListGroups(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load groups from database")
+	}
+	limits, err := repo.ListSpendingLimits(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load spending limits from database")
+	}
+
+	engine.ImportState(&policy.State{Policies: policies, Users: users, Groups: groups, SpendingLimits: limits, PolicyVersions: versions})
+	log.Info().
+		Int("policies", len(policies)).
+		Int("users", len(users)).
+		Int("groups", len(groups)).
+		Int("spending_limits", len(limits)).
+		Int("policy_versions", len(versions)).
+		Msg("Loaded policies, users, groups and spending limits from database")
+}
+
+// customMethod matches custom method paths such as /users:batch. Gin reads
+// the colon as the start of a :verb parameter, so other verbs are refused.
+func customMethod(verb string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param("verb") != ":"+verb {
+			c.AbortWithStatusJSON(http.StatusNotFound, models.ErrorResponse{Error: "not found", Code: models.ErrCodeNotFound})
+			return
 		}
+		c.Next()
+	}
+}
+
+// authorize returns the permission check for a control plane route, or a
+// pass-through when control plane authentication is disabled
+func (r *Router) authorize(perm auth.Permission) gin.HandlerFunc {
+	if !r.config.Auth.Enabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return r.authenticator.Require(perm)
+}
 
-		// Dashboard
-		control.GET("/dashboard", r.controlHandler.GetDashboardMetrics)
+// scope returns the middleware confining control plane requests to the
+// caller's tenant. Without authentication every caller acts as a super
+// admin and may pick a tenant with auth.TenantHeader.
+func (r *Router) scope() gin.HandlerFunc {
+	if !r.config.Auth.Enabled {
+		return r.authenticator.ScopeFromHeader()
+	}
+	return r.authenticator.Identify(false)
+}
 
-		// Alerts
-		alerts := control.Group("/alerts")
-		{
-			alerts.GET("", r.controlHandler.GetAlerts)
-			alerts.POST("/:id/ack", r.controlHandler.AckAlert)
+// deploymentWide refuses requests confined to a tenant other than the
+// default one. Settings, PII patterns, flags, caches, jobs, captures and
+// model prices are shared by every tenant, so the default tenant and
+// super admins manage them.
+func deploymentWide() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scope, ok := tenant.FromContext(c.Request.Context()); ok && scope != tenant.Default {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.ErrorResponse{Error: "deployment-wide settings are managed by the default tenant", Code: models.ErrCodeForbidden})
+			return
 		}
+		c.Next()
+	}
+}
 
-		// Settings
-		settingsGroup := control.Group("/settings")
-		{
-			settingsGroup.GET("", r.controlHandler.GetSettings)
-			settingsGroup.GET("/llm", r.controlHandler.GetLLMSettings)
-			settingsGroup.PUT("/llm", r.controlHandler.UpdateLLMSettings)
-			settingsGroup.GET("/security", r.controlHandler.GetSecuritySettings)
-			settingsGroup.PUT("/security", r.controlHandler.UpdateSecuritySettings)
-			settingsGroup.GET("/storage", r.controlHandler.GetStorageInfo)
+// identify returns the data plane authentication middleware, or a
+// pass-through when it isn't required and no external issuers are trusted.
+// Without control plane authentication the pass-through honors
+// auth.TenantHeader.
+func (r *Router) identify() gin.HandlerFunc {
+	if !r.config.Auth.RequireDataPlane && len(r.config.Auth.TrustedIssuers) == 0 {
+		if !r.config.Auth.Enabled {
+			return r.authenticator.ScopeFromHeader()
+		}
+		return func(c *gin.Context) { c.Next() }
+	}
+	identify := r.authenticator.Identify(r.config.Auth.RequireDataPlane)
+	return func(c *gin.Context) {
+		// Canary probes are sent in-process and carry no credentials
+		if canary.IsProbe(c.Request.Context()) {
+			c.Next()
+			return
+		}
+		identify(c)
+	}
+}
+
+// Close stops background validation, flushes in-memory state and releases
+// connections before shutdown
+func (r *Router) Close() {
+	r.stopBackground()
+	if r.snapshots != nil {
+		if err := r.snapshots.Save(); err != nil {
+			log.Error().Err(err).Msg("Failed to save final snapshot")
+		}
+	}
+	for _, c := range r.caches {
+		if closer, ok := c.(io.Closer); ok {
+			closer.Close()
 		}
 	}
 }
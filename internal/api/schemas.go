@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/schema"
+	"github.com/gin-gonic/gin"
+)
+
+// SchemaRegistry serves JSON Schemas for the API models so clients in other
+// languages can generate types and validate payloads
+type SchemaRegistry struct {
+	schemas map[string]map[string]interface{}
+}
+
+// NewSchemaRegistry generates the schemas for the public request, policy and
+// audit models
+func NewSchemaRegistry() *SchemaRegistry {
+	g := schema.NewGenerator()
+	registerEnums(g)
+	types := map[string]struct {
+		title string
+		value interface{}
+	}{
+		"guard-request":      {"GuardRequest", models.GuardRequest{}},
+		"guard-response":     {"GuardResponse", models.GuardResponse{}},
+		"embedding-request":  {"EmbeddingRequest", models.EmbeddingRequest{}},
+		"embedding-response": {"EmbeddingResponse", models.EmbeddingResponse{}},
+		"error-response":     {"ErrorResponse", models.ErrorResponse{}},
+		"policy":             {"Policy", models.Policy{}},
+		"policy-version":     {"PolicyVersion", models.PolicyVersion{}},
+		"spending-limit":     {"SpendingLimit", models.SpendingLimit{}},
+		"user":               {"User", models.User{}},
+		"audit-log":          {"AuditLog", models.AuditLog{}},
+		"audit-query":        {"AuditQuery", models.AuditQuery{}},
+		"audit-stats":        {"AuditStats", models.AuditStats{}},
+		"alert":              {"Alert", models.Alert{}},
+		"captured-content":   {"CapturedContent", models.CapturedContent{}},
+	}
+
+	r := &SchemaRegistry{schemas: make(map[string]map[string]interface{}, len(types))}
+	for name, t := range types {
+		r.schemas[name] = g.Generate(t.title, t.value)
+	}
+	return r
+}
+
+// registerEnums gives the generator the values of the enum types of the API
+// models
+func registerEnums(g *schema.Generator) {
+	g.Enum(models.PolicyTypeSpending, models.PolicyTypeRateLimit, models.PolicyTypeContent, models.PolicyTypeAccess, models.PolicyTypeCompliance, models.PolicyTypeTopic, models.PolicyTypeRouting)
+	g.Enum(models.PolicyStatusActive, models.PolicyStatusInactive, models.PolicyStatusDraft)
+	g.Enum(models.RuleTypeComparison, models.RuleTypeExpression)
+	g.Enum(models.OperatorEquals, models.OperatorNotEquals, models.OperatorGreaterThan, models.OperatorLessThan,
+		models.OperatorContains, models.OperatorNotContains, models.OperatorIn, models.OperatorNotIn)
+	g.Enum(models.ConditionAnd, models.ConditionOr)
+	g.Enum(models.ActionAllow, models.ActionDeny, models.ActionWarn, models.ActionAudit, models.ActionThrottle)
+	g.Enum(models.PolicyChangeCreate, models.PolicyChangeUpdate, models.PolicyChangeRollback, models.PolicyChangeDelete)
+	g.Enum(models.EventTypeRequest, models.EventTypePolicyChange, models.EventTypeUserAction, models.EventTypeSystemEvent,
+		models.EventTypeSecurityAlert, models.EventTypeSpendingAlert, models.EventTypeAnomaly)
+	g.Enum(models.AuditStatusSuccess, models.AuditStatusFailure, models.AuditStatusBlocked, models.AuditStatusWarning)
+	g.Enum(models.ErrorCodes()...)
+
+}
+
+// ListSchemas returns the names and URLs of the available schemas
+func (r *SchemaRegistry) ListSchemas(c *gin.Context) {
+	names := make([]string, 0, len(r.schemas))
+	for name := range r.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schemas := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		schemas = append(schemas, gin.H{
+			"name":  name,
+			"title": r.schemas[name]["title"],
+			"url":   c.Request.URL.Path + "/" + name,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schemas": schemas,
+		"total":   len(schemas),
+	})
+}
+
+// GetSchema returns a single schema as application/schema+json
+func (r *SchemaRegistry) GetSchema(c *gin.Context) {
+	s, ok := r.schemas[c.Param("name")]
+	if !ok {
+		respondError(c, http.StatusNotFound, "schema not found: "+c.Param("name"))
+		return
+	}
+
+	// Identify the schema by the URL it was served from
+	body := make(map[string]interface{}, len(s)+1)
+	for k, v := range s {
+		body[k] = v
+	}
+	body["$id"] = c.Request.URL.Path
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Render(http.StatusOK, schemaRender{body})
+}
+
+// schemaRender writes JSON with the JSON Schema media type
+type schemaRender struct {
+	data interface{}
+}
+
+func (r schemaRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.data)
+}
+
+func (r schemaRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/schema+json")
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/scim"
+	"github.com/gin-gonic/gin"
+)
+
+// scimContentType is the media type of SCIM requests and responses
+const scimContentType = "application/scim+json"
+
+// SCIMHandler serves SCIM 2.0 provisioning of users and groups to an
+// identity provider, which authenticates with a static bearer token
+type SCIMHandler struct {
+	service     *scim.Service
+	auditLogger *audit.Logger
+	token       string
+}
+
+// NewSCIMHandler creates a SCIM handler accepting token
+func NewSCIMHandler(service *scim.Service, auditLogger *audit.Logger, token string) *SCIMHandler {
+	return &SCIMHandler{service: service, auditLogger: auditLogger, token: token}
+}
+
+// Authenticate refuses requests without the SCIM bearer token
+func (h *SCIMHandler) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			h.fail(c, http.StatusUnauthorized, "", "a valid SCIM bearer token is required")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ServiceProviderConfig describes the SCIM features supported
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	h.respond(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaSPConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": 1000},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "The token set as auth.scim.token",
+		}},
+	})
+}
+
+// ListUsers returns users, filtered by userName, externalId or id
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	start, count, ok := h.page(c)
+	if !ok {
+		return
+	}
+	list, err := h.service.ListUsers(c.Request.Context(), c.Query("filter"), start, count)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, list)
+}
+
+// GetUser returns a user
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.service.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, user)
+}
+
+// CreateUser provisions a user
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req scim.User
+	if !h.bind(c, &req) {
+		return
+	}
+	user, err := h.service.CreateUser(c.Request.Context(), &req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.logUser(c, "create", user)
+	c.Header("Location", user.Meta.Location)
+	h.respond(c, http.StatusCreated, user)
+}
+
+// ReplaceUser replaces a user's attributes
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var req scim.User
+	if !h.bind(c, &req) {
+		return
+	}
+	user, err := h.service.ReplaceUser(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.logUser(c, "update", user)
+	h.respond(c, http.StatusOK, user)
+}
+
+// PatchUser changes some of a user's attributes, such as deactivating them
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+	user, err := h.service.PatchUser(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.logUser(c, "update", user)
+	h.respond(c, http.StatusOK, user)
+}
+
+// DeactivateUser deactivates a user instead of deleting them, keeping their
+// usage and audit history
+func (h *SCIMHandler) DeactivateUser(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.service.DeactivateUser(c.Request.Context(), id); err != nil {
+		h.error(c, err)
+		return
+	}
+	h.log(c, "scim_user_deactivate", "user", id, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups returns groups, filtered by displayName or id
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	start, count, ok := h.page(c)
+	if !ok {
+		return
+	}
+	list, err := h.service.ListGroups(c.Request.Context(), c.Query("filter"), start, count)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, list)
+}
+
+// GetGroup returns a group and its members
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.service.GetGroup(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.respond(c, http.StatusOK, group)
+}
+
+// CreateGroup provisions a group
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var req scim.Group
+	if !h.bind(c, &req) {
+		return
+	}
+	group, err := h.service.CreateGroup(c.Request.Context(), &req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.logGroup(c, "create", group)
+	c.Header("Location", group.Meta.Location)
+	h.respond(c, http.StatusCreated, group)
+}
+
+// ReplaceGroup renames a group and replaces its members
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	var req scim.Group
+	if !h.bind(c, &req) {
+		return
+	}
+	group, err := h.service.ReplaceGroup(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.logGroup(c, "update", group)
+	h.respond(c, http.StatusOK, group)
+}
+
+// PatchGroup renames a group or adds and removes members
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req scim.PatchRequest
+	if !h.bind(c, &req) {
+		return
+	}
+	group, err := h.service.PatchGroup(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.logGroup(c, "update", group)
+	h.respond(c, http.StatusOK, group)
+}
+
+// DeleteGroup deletes a group, taking its members out of it
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.service.DeleteGroup(c.Request.Context(), id); err != nil {
+		h.error(c, err)
+		return
+	}
+	h.log(c, "scim_group_delete", "group", id, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// page reads the 1-based startIndex and count query parameters; count is
+// -1 when not given
+func (h *SCIMHandler) page(c *gin.Context) (start, count int, ok bool) {
+	start, count = 1, -1
+	for name, dest := range map[string]*int{"startIndex": &start, "count": &count} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				h.fail(c, http.StatusBadRequest, "invalidValue", name+" must be a number")
+				return 0, 0, false
+			}
+			*dest = n
+		}
+	}
+	return start, count, true
+}
+
+func (h *SCIMHandler) bind(c *gin.Context, dest interface{}) bool {
+	if err := c.ShouldBindJSON(dest); err != nil {
+		h.fail(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return false
+	}
+	return true
+}
+
+func (h *SCIMHandler) respond(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, body)
+}
+
+// error responds with the SCIM error matching err
+func (h *SCIMHandler) error(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, scim.ErrNotFound):
+		h.fail(c, http.StatusNotFound, "", err.Error())
+	case errors.Is(err, scim.ErrUniqueness):
+		h.fail(c, http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, scim.ErrInvalidFilter):
+		h.fail(c, http.StatusBadRequest, "invalidFilter", err.Error())
+	case errors.Is(err, scim.ErrInvalidValue):
+		h.fail(c, http.StatusBadRequest, "invalidValue", err.Error())
+	default:
+		h.fail(c, http.StatusInternalServerError, "", err.Error())
+	}
+}
+
+func (h *SCIMHandler) fail(c *gin.Context, status int, scimType, detail string) {
+	h.respond(c, status, scim.ErrorResponse{
+		Schemas:  []string{scim.SchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
+
+func (h *SCIMHandler) logUser(c *gin.Context, action string, user *scim.User) {
+	h.log(c, "scim_user_"+action, "user", user.ID, map[string]interface{}{
+		"user_name":   user.UserName,
+		"external_id": user.ExternalID,
+		"active":      *user.Active,
+	})
+}
+
+func (h *SCIMHandler) logGroup(c *gin.Context, action string, group *scim.Group) {
+	members := make([]string, len(group.Members))
+	for i, m := range group.Members {
+		members[i] = m.Value
+	}
+	h.log(c, "scim_group_"+action, "group", group.ID, map[string]interface{}{
+		"display_name": group.DisplayName,
+		"members":      members,
+	})
+}
+
+// log records a provisioning change in the audit log of the SCIM tenant
+func (h *SCIMHandler) log(c *gin.Context, action, resourceType, resourceID string, details map[string]interface{}) {
+	if h.auditLogger == nil {
+		return
+	}
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType:    models.EventTypeUserAction,
+		Action:       action,
+		UserID:       "scim",
+		TenantID:     h.service.Tenant(),
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.Request.UserAgent(),
+		Status:       models.AuditStatusSuccess,
+		Details:      details,
+	})
+}
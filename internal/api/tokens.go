@@ -0,0 +1,126 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+)
+
+// RefreshTokenRequest exchanges a refresh token for a new token pair
+type RefreshTokenRequest struct {
+	GrantType    string `json:"grant_type" form:"grant_type"` // refresh_token, if given
+	RefreshToken string `json:"refresh_token" form:"refresh_token" binding:"required"`
+}
+
+// TokenHandler issues and refreshes GoGuard's own access tokens and
+// publishes the keys they are signed with
+type TokenHandler struct {
+	tokens        *auth.TokenIssuer
+	authenticator *auth.Authenticator
+	auditLogger   *audit.Logger
+}
+
+// NewTokenHandler creates a token handler
+func NewTokenHandler(tokens *auth.TokenIssuer, authenticator *auth.Authenticator, auditLogger *audit.Logger) *TokenHandler {
+	return &TokenHandler{tokens: tokens, authenticator: authenticator, auditLogger: auditLogger}
+}
+
+// JWKS publishes the public keys tokens are signed with, for services
+// validating them. Tokens signed with the JWT secret have no public key.
+func (h *TokenHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
+
+// Issue exchanges the caller's credentials, such as a session or API key,
+// for an access token and a refresh token
+func (h *TokenHandler) Issue(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if principal.APIKeyID == "bootstrap" {
+		respondError(c, http.StatusForbidden, "the bootstrap API key can't be exchanged for tokens")
+		return
+	}
+	// Tokens work from anywhere, so they can't lift an API key's address limit
+	if principal.AddressLimited() {
+		respondError(c, http.StatusForbidden, "API keys limited to addresses can't be exchanged for tokens")
+		return
+	}
+	// Tokens carry a role, so callers limited to fewer permissions than
+	// their role grants, such as scoped API keys, can't widen them this way
+	for _, p := range h.authenticator.RolePermissions(principal.Role) {
+		if !principal.Has(p) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "cannot issue a token with a permission you do not hold",
+				"code":       models.ErrCodeForbidden,
+				"permission": p,
+			})
+			return
+		}
+	}
+
+	pair, err := h.tokens.Issue(c.Request.Context(), principal)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.log(c, "token_issue", principal.UserID, principal.TenantID)
+	c.JSON(http.StatusCreated, pair)
+}
+
+// Refresh rotates a refresh token, returning a new access token and the
+// refresh token to use next time
+func (h *TokenHandler) Refresh(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, invalidRequest(err))
+		return
+	}
+	if req.GrantType != "" && req.GrantType != "refresh_token" {
+		respondError(c, http.StatusBadRequest, "unsupported grant_type: "+req.GrantType)
+		return
+	}
+
+	pair, session, err := h.tokens.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		h.error(c, err)
+		return
+	}
+	h.log(c, "token_refresh", session.UserID, session.TenantID)
+	c.JSON(http.StatusOK, pair)
+}
+
+func (h *TokenHandler) error(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidRefreshToken):
+		respondError(c, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrTokensUnavailable):
+		respondError(c, http.StatusServiceUnavailable, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *TokenHandler) log(c *gin.Context, action, userID, tenantID string) {
+	if h.auditLogger == nil {
+		return
+	}
+	c.Set(auditedKey, true)
+	h.auditLogger.Log(c.Request.Context(), &models.AuditLog{
+		EventType: models.EventTypeUserAction,
+		Action:    action,
+		UserID:    userID,
+		TenantID:  tenantID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Status:    models.AuditStatusSuccess,
+	})
+}
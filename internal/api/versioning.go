@@ -0,0 +1,347 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// APIVersion is a major version of the HTTP API
+type APIVersion int
+
+const (
+	// APIVersion1 is frozen: response shapes never change, so existing
+	// dashboard and SDK integrations keep working
+	APIVersion1 APIVersion = 1
+	// APIVersion2 uses uniform list and error envelopes
+	APIVersion2 APIVersion = 2
+)
+
+// apiVersionHeader lets clients on /api/v1 paths opt into a newer version
+const apiVersionHeader = "X-GoGuard-API-Version"
+
+var supportedVersions = []APIVersion{APIVersion1, APIVersion2}
+
+func (v APIVersion) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+// MarshalText encodes the version as "v1", "v2", ...
+func (v APIVersion) MarshalText() ([]byte, error) {
+	return []byte(v.String()), nil
+}
+
+// parseAPIVersion accepts "2", "v2", or "V2"
+func parseAPIVersion(value string) (APIVersion, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "v"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid API version: %q", value)
+	}
+	for _, v := range supportedVersions {
+		if int(v) == n {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported API version: %q", value)
+}
+
+// requestedVersion returns the version asked for by the request headers, if any.
+// The explicit header takes precedence over an Accept media type such as
+// application/vnd.goguard.v2+json.
+func requestedVersion(c *gin.Context) (APIVersion, bool, error) {
+	if value := c.GetHeader(apiVersionHeader); value != "" {
+		v, err := parseAPIVersion(value)
+		return v, err == nil, err
+	}
+	for _, mediaType := range strings.Split(c.GetHeader("Accept"), ",") {
+		mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+		if rest, ok := strings.CutPrefix(mediaType, "application/vnd.goguard."); ok {
+			v, err := parseAPIVersion(strings.TrimSuffix(rest, "+json"))
+			return v, err == nil, err
+		}
+	}
+	return 0, false, nil
+}
+
+// Versioning negotiates the API version of each request and applies the
+// lifecycle headers and response shims for that version
+type Versioning struct {
+	v1DeprecatedAt time.Time
+	v1SunsetAt     time.Time
+}
+
+// NewVersioning creates the version negotiator from configuration
+func NewVersioning(cfg config.APIConfig) *Versioning {
+	return &Versioning{
+		v1DeprecatedAt: parseLifecycleDate("api.v1_deprecated_at", cfg.V1DeprecatedAt),
+		v1SunsetAt:     parseLifecycleDate("api.v1_sunset_at", cfg.V1SunsetAt),
+	}
+}
+
+func parseLifecycleDate(key, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Ignoring invalid API lifecycle date, expected YYYY-MM-DD")
+		return time.Time{}
+	}
+	return t
+}
+
+// Negotiate returns middleware for routes mounted under the given path version.
+// A v2 path always serves v2; a v1 path serves v2 only when the client asks
+// for it in the headers, so existing integrations see no change.
+func (v *Versioning) Negotiate(pathVersion APIVersion) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := pathVersion
+		requested, ok, err := requestedVersion(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error":              err.Error(),
+				"code":               models.ErrCodeInvalidRequest,
+				"supported_versions": supportedVersions,
+			})
+			return
+		}
+		if ok {
+			if pathVersion > APIVersion1 && requested != pathVersion {
+				c.AbortWithStatusJSON(http.StatusBadRequest, models.ErrorResponse{
+					Error: fmt.Sprintf("path requests API %s but headers request %s", pathVersion, requested),
+					Code:  models.ErrCodeInvalidRequest,
+				})
+				return
+			}
+			version = requested
+		}
+
+		c.Set("api_version", version)
+		c.Header(apiVersionHeader, version.String())
+		c.Writer.Header().Add("Vary", apiVersionHeader+", Accept")
+
+		if version == APIVersion1 {
+			v.setDeprecationHeaders(c)
+			c.Next()
+			return
+		}
+
+		shim := &v2ResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = shim
+		c.Next()
+		shim.finish()
+		c.Writer = shim.ResponseWriter
+	}
+}
+
+// setDeprecationHeaders advertises the v1 lifecycle using the Deprecation
+// (RFC 9745) and Sunset (RFC 8594) headers, linking to the v2 equivalent
+func (v *Versioning) setDeprecationHeaders(c *gin.Context) {
+	if v.v1DeprecatedAt.IsZero() && v.v1SunsetAt.IsZero() {
+		return
+	}
+	if !v.v1DeprecatedAt.IsZero() {
+		c.Header("Deprecation", "@"+strconv.FormatInt(v.v1DeprecatedAt.Unix(), 10))
+	}
+	if !v.v1SunsetAt.IsZero() {
+		c.Header("Sunset", v.v1SunsetAt.UTC().Format(http.TimeFormat))
+	}
+	if successor, ok := strings.CutPrefix(c.Request.URL.Path, "/api/v1/"); ok {
+		c.Header("Link", fmt.Sprintf("</api/v2/%s>; rel=\"successor-version\"", successor))
+	}
+}
+
+// ListVersions describes the supported API versions and their lifecycle
+func (v *Versioning) ListVersions(c *gin.Context) {
+	v1 := gin.H{"version": APIVersion1, "status": "frozen", "path": "/api/v1"}
+	if !v.v1DeprecatedAt.IsZero() {
+		v1["status"] = "deprecated"
+		v1["deprecated_at"] = v.v1DeprecatedAt
+	}
+	if !v.v1SunsetAt.IsZero() {
+		v1["sunset_at"] = v.v1SunsetAt
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": []gin.H{
+			v1,
+			{"version": APIVersion2, "status": "current", "path": "/api/v2"},
+		},
+		"current":        APIVersion2,
+		"default":        APIVersion1,
+		"version_header": apiVersionHeader,
+	})
+}
+
+// v2ResponseWriter is the compatibility shim between the handlers, which
+// produce v1 response shapes, and the v2 envelopes. JSON bodies are buffered
+// and rewritten when the handler finishes; streams such as server-sent events
+// pass through untouched.
+type v2ResponseWriter struct {
+	gin.ResponseWriter
+	body        bytes.Buffer
+	status      int
+	passthrough bool
+}
+
+func (w *v2ResponseWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *v2ResponseWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *v2ResponseWriter) Write(data []byte) (int, error) {
+	if !w.passthrough && !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.startPassthrough()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+func (w *v2ResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *v2ResponseWriter) Status() int {
+	if w.passthrough {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *v2ResponseWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+func (w *v2ResponseWriter) Written() bool {
+	return w.passthrough || w.body.Len() > 0
+}
+
+// Flush is only used by streaming handlers, so it switches to pass-through
+func (w *v2ResponseWriter) Flush() {
+	w.startPassthrough()
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (w *v2ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *v2ResponseWriter) startPassthrough() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// finish rewrites the buffered body into its v2 shape and sends it
+func (w *v2ResponseWriter) finish() {
+	if w.passthrough {
+		return
+	}
+	body := w.body.Bytes()
+	if len(body) > 0 {
+		if converted, ok := convertToV2(w.status, body); ok {
+			body = converted
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+	if len(body) > 0 {
+		w.ResponseWriter.Write(body)
+	}
+}
+
+// convertToV2 maps a v1 JSON body to its v2 equivalent:
+//   - errors become {"error": {"code", "message", "status"}}
+//   - lists ({"<plural>": [...], "total": n}) become {"data": [...], "total": n},
+//     with other fields such as pagination kept and null lists sent as []
+func convertToV2(status int, body []byte) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false
+	}
+
+	if status >= http.StatusBadRequest {
+		var message string
+		if err := json.Unmarshal(fields["error"], &message); err != nil {
+			return nil, false
+		}
+		var code string
+		if raw, ok := fields["code"]; ok {
+			json.Unmarshal(raw, &code)
+		}
+		if code == "" {
+			code = string(models.ErrorCodeForStatus(status))
+		}
+		delete(fields, "error")
+		delete(fields, "code")
+
+		converted := map[string]interface{}{
+			"error": gin.H{"code": code, "message": message, "status": status},
+		}
+		if len(fields) > 0 {
+			converted["details"] = fields
+		}
+		out, err := json.Marshal(converted)
+		return out, err == nil
+	}
+
+	if _, ok := fields["total"]; !ok {
+		return nil, false
+	}
+	listKey := ""
+	for key, raw := range fields {
+		if key == "total" {
+			continue
+		}
+		trimmed := bytes.TrimSpace(raw)
+		if len(trimmed) > 0 && (trimmed[0] == '[' || bytes.Equal(trimmed, []byte("null"))) {
+			if listKey != "" {
+				return nil, false // ambiguous, leave as-is
+			}
+			listKey = key
+		}
+	}
+	if listKey == "" {
+		return nil, false
+	}
+
+	list := fields[listKey]
+	if bytes.Equal(bytes.TrimSpace(list), []byte("null")) {
+		list = json.RawMessage("[]")
+	}
+	delete(fields, listKey)
+	fields["data"] = list
+
+	out, err := json.Marshal(fields)
+	return out, err == nil
+}
@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ErrUntrustedIssuer is returned for tokens whose iss claim doesn't match a
+// trusted issuer, so callers can fall back to GoGuard's own tokens
+var ErrUntrustedIssuer = errors.New("untrusted issuer")
+
+// externalSigningMethods are the asymmetric algorithms accepted from external
+// issuers. HMAC is excluded so a public key can never be used as a secret.
+var externalSigningMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Identity is the GoGuard user a token from a trusted issuer maps to
+type Identity struct {
+	Issuer    string
+	UserID    string
+	Email     string
+	Role      string
+	Groups    []string
+	TenantID  string
+	Provision bool // create or update the GoGuard user from these claims
+}
+
+// TrustedIssuers validates tokens minted by external identity providers
+// against their published signing keys
+type TrustedIssuers struct {
+	issuers map[string]*trustedIssuer
+	leeway  time.Duration
+}
+
+type trustedIssuer struct {
+	cfg config.TrustedIssuerConfig
+
+	mu           sync.Mutex
+	keys         *keySet
+	discoveredAt time.Time // last discovery attempt
+	discoveryErr error
+}
+
+// NewTrustedIssuers creates a validator for the configured issuers, filling
+// in claim defaults. Signing keys are fetched on first use.
+func NewTrustedIssuers(cfgs []config.TrustedIssuerConfig, leeway time.Duration) *TrustedIssuers {
+	t := &TrustedIssuers{
+		issuers: make(map[string]*trustedIssuer, len(cfgs)),
+		leeway:  leeway,
+	}
+	for _, cfg := range cfgs {
+		if cfg.Issuer == "" {
+			continue
+		}
+		if cfg.UserClaim == "" {
+			cfg.UserClaim = "sub"
+		}
+		if cfg.EmailClaim == "" {
+			cfg.EmailClaim = "email"
+		}
+		if cfg.DefaultRole == "" {
+			cfg.DefaultRole = string(models.RoleUser)
+		}
+		if cfg.JWKSRefresh <= 0 {
+			cfg.JWKSRefresh = time.Hour
+		}
+		t.issuers[cfg.Issuer] = &trustedIssuer{cfg: cfg}
+	}
+	return t
+}
+
+// Len returns the number of trusted issuers
+func (t *TrustedIssuers) Len() int {
+	return len(t.issuers)
+}
+
+// Validate verifies a token from a trusted issuer and maps its claims to a
+// GoGuard identity. Tokens from other issuers return ErrUntrustedIssuer.
+func (t *TrustedIssuers) Validate(ctx context.Context, tokenString string) (*Identity, error) {
+	// The issuer decides which keys verify the signature, so peek at it first
+	unverified, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return nil, ErrUntrustedIssuer
+	}
+	iss, _ := unverified.Claims.GetIssuer()
+	issuer, ok := t.issuers[iss]
+	if !ok {
+		return nil, ErrUntrustedIssuer
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(externalSigningMethods),
+		jwt.WithIssuer(iss),
+		jwt.WithLeeway(t.leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(issuer.cfg.Audience))
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		keys, err := issuer.keySet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		kid, _ := token.Header["kid"].(string)
+		return keys.key(ctx, kid)
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", iss, err)
+	}
+
+	return issuer.identity(claims)
+}
+
+// keySet returns the issuer's key set, discovering the JWKS URL from its
+// OpenID configuration when none is configured
+func (i *trustedIssuer) keySet(ctx context.Context) (*keySet, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.keys != nil {
+		return i.keys, nil
+	}
+
+	url := i.cfg.JWKSURL
+	if url == "" {
+		if i.discoveryErr != nil && time.Since(i.discoveredAt) < minJWKSRefetch {
+			return nil, i.discoveryErr
+		}
+		i.discoveredAt = time.Now()
+		url, i.discoveryErr = discoverJWKSURL(ctx, i.cfg.Issuer)
+		if i.discoveryErr != nil {
+			return nil, i.discoveryErr
+		}
+	}
+	i.keys = newKeySet(url, i.cfg.JWKSRefresh)
+	return i.keys, nil
+}
+
+func discoverJWKSURL(ctx context.Context, issuer string) (string, error) {
+	wellKnownURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnownURL, nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch OpenID configuration: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OpenID configuration returned status %d", resp.StatusCode)
+	}
+
+	var wellKnown WellKnownConfig
+	if err := json.NewDecoder(resp.Body).Decode(&wellKnown); err != nil {
+		return "", fmt.Errorf("failed to decode OpenID configuration: %w", err)
+	}
+	if wellKnown.JwksURI == "" {
+		return "", fmt.Errorf("OpenID configuration of %s has no jwks_uri", issuer)
+	}
+	return wellKnown.JwksURI, nil
+}
+
+// identity maps verified claims to a GoGuard user
+func (i *trustedIssuer) identity(claims jwt.MapClaims) (*Identity, error) {
+	userID := claimStrings(claims, i.cfg.UserClaim)
+	if len(userID) == 0 || userID[0] == "" {
+		return nil, fmt.Errorf("%s: token has no %s claim", i.cfg.Issuer, i.cfg.UserClaim)
+	}
+
+	id := &Identity{
+		Issuer:    i.cfg.Issuer,
+		UserID:    i.cfg.UserPrefix + userID[0],
+		Role:      i.cfg.DefaultRole,
+		TenantID:  i.cfg.Tenant,
+		Provision: i.cfg.ProvisionUsers,
+	}
+	if email := claimStrings(claims, i.cfg.EmailClaim); len(email) > 0 {
+		id.Email = email[0]
+	}
+	if i.cfg.GroupsClaim != "" {
+		id.Groups = claimStrings(claims, i.cfg.GroupsClaim)
+	}
+	if i.cfg.RoleClaim != "" {
+		// The first IdP role with a mapping wins
+		for _, role := range claimStrings(claims, i.cfg.RoleClaim) {
+			if mapped, ok := i.cfg.RoleMapping[role]; ok {
+				id.Role = mapped
+				break
+			}
+		}
+	}
+	return id, nil
+}
+
+// claimStrings reads a string or list claim. Dotted paths reach into nested
+// objects, e.g. "realm_access.roles".
+func claimStrings(claims jwt.MapClaims, path string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case float64:
+		// Numeric user IDs
+		return []string{fmt.Sprintf("%.0f", v)}
+	default:
+		return nil
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
@@ -8,11 +9,14 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
 )
 
 // OIDCConfig holds OIDC provider configuration
@@ -27,9 +31,11 @@ type OIDCConfig struct {
 
 // OIDCProvider represents an OIDC identity provider
 type OIDCProvider struct {
-	config       OIDCConfig
-	wellKnown    *WellKnownConfig
-	sessionStore map[string]*Session
+	config        OIDCConfig
+	wellKnown     *WellKnownConfig
+	sessionPolicy SessionPolicy
+	sessionMu     sync.Mutex // guards sessionPolicy
+	sessions      SessionStore
 }
 
 // WellKnownConfig holds OIDC discovery document data
@@ -43,17 +49,7 @@ type WellKnownConfig struct {
 }
 
 // Session represents a user session
-type Session struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	Email        string    `json:"email"`
-	Name         string    `json:"name"`
-	Role         string    `json:"role"`
-	AccessToken  string    `json:"-"`
-	RefreshToken string    `json:"-"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	CreatedAt    time.Time `json:"created_at"`
-}
+type Session = models.Session
 
 // TokenClaims represents JWT token claims
 type TokenClaims struct {
@@ -62,13 +58,18 @@ type TokenClaims struct {
 	Name   string `json:"name"`
 	Role   string `json:"role"`
 	UserID string `json:"user_id"`
+
+	// TenantID confines the holder to a tenant; tokens without one belong
+	// to the default tenant
+	TenantID string `json:"tenant_id,omitempty"`
 }
 
 // NewOIDCProvider creates a new OIDC provider
 func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
 	provider := &OIDCProvider{
-		config:       config,
-		sessionStore: make(map[string]*Session),
+		config:        config,
+		sessionPolicy: DefaultSessionPolicy(),
+		sessions:      NewMemorySessionStore(),
 	}
 
 	if config.Enabled && config.IssuerURL != "" {
@@ -142,41 +143,43 @@ func GenerateState() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-// CreateSession creates a new session for a user
-func (p *OIDCProvider) CreateSession(userID, email, name, role string) (*Session, error) {
-	sessionID := generateSessionID()
+// CreateSession creates a new session for a user acting
+// in tenantID (empty for the default tenant, or across tenants for super admins)
+func (p *OIDCProvider) CreateSession(ctx context.Context, userID, email, name, role, tenantID string) (*Session, error) {
+	policy := p.policy()
+	now := time.Now()
 	session := &Session{
-		ID:        sessionID,
-		UserID:    userID,
-		Email:     email,
-		Name:      name,
-		Role:      role,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		CreatedAt: time.Now(),
+		ID:           generateSessionID(),
+		UserID:       userID,
+		Email:        email,
+		Name:         name,
+		Role:         role,
+		TenantID:     tenantID,
+		ExpiresAt:    now.Add(policy.MaxLifetime),
+		LastActiveAt: now,
+		CreatedAt:    now,
 	}
 
-	p.sessionStore[sessionID] = session
+	if err := p.sessions.CreateSession(ctx, session, policy.idleExpiry(now)); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
 	return session, nil
 }
 
-// GetSession retrieves a session by ID
-func (p *OIDCProvider) GetSession(sessionID string) (*Session, bool) {
-	session, ok := p.sessionStore[sessionID]
-	if !ok {
-		return nil, false
-	}
-
-	if time.Now().After(session.ExpiresAt) {
-		delete(p.sessionStore, sessionID)
-		return nil, false
-	}
-
-	return session, true
+// GetSession retrieves a session by ID without counting it as activity
+func (p *OIDCProvider) GetSession(ctx context.Context, sessionID string) (*Session, bool) {
+	return p.liveSession(ctx, sessionID, p.policy(), time.Now())
 }
 
 // DeleteSession removes a session
-func (p *OIDCProvider) DeleteSession(sessionID string) {
-	delete(p.sessionStore, sessionID)
+func (p *OIDCProvider) DeleteSession(ctx context.Context, sessionID string) error {
+	return p.sessions.DeleteSession(ctx, sessionID)
+}
+
+// DeleteUserSessions removes all of a user's sessions, logging them out on
+// every device, and returns how many there were
+func (p *OIDCProvider) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	return p.sessions.DeleteUserSessions(ctx, userID)
 }
 
 // GenerateJWT generates a JWT token for a session
@@ -198,15 +201,41 @@ func (p *OIDCProvider) GenerateJWT(session *Session, secret string) (string, err
 	return token.SignedString([]byte(secret))
 }
 
+// JWTValidation controls the claim checks made on top of the signature.
+// Expiry and not-before are always enforced when present.
+type JWTValidation struct {
+	Leeway   time.Duration // tolerated clock skew between the issuer and this host
+	Issuer   string        // required "iss" claim, if set
+	Audience string        // required "aud" claim, if set
+}
+
+func (v JWTValidation) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{
+		jwt.WithLeeway(v.Leeway),
+		// Reject tokens issued in the future beyond the leeway as well
+		jwt.WithIssuedAt(),
+	}
+	if v.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.Issuer))
+	}
+	if v.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.Audience))
+	}
+	return opts
+}
+
 // ValidateJWT validates a JWT token and returns the claims
-func ValidateJWT(tokenString, secret string) (*TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+func ValidateJWT(tokenString, secret string, validation JWTValidation) (*TokenClaims, error) {
+	return parseClaims(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(secret), nil
-	})
+	}, validation)
+}
 
+func parseClaims(tokenString string, keyFunc jwt.Keyfunc, validation JWTValidation) (*TokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, keyFunc, validation.parserOptions()...)
 	if err != nil {
 		return nil, err
 	}
@@ -219,7 +248,7 @@ func ValidateJWT(tokenString, secret string) (*TokenClaims, error) {
 }
 
 // AuthMiddleware creates a Gin middleware for authentication
-func AuthMiddleware(jwtSecret string, oidcProvider *OIDCProvider) gin.HandlerFunc {
+func AuthMiddleware(jwtSecret string, validation JWTValidation, oidcProvider *OIDCProvider) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip auth for health endpoints
 		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/ready" {
@@ -231,19 +260,21 @@ func AuthMiddleware(jwtSecret string, oidcProvider *OIDCProvider) gin.HandlerFun
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			// Check for session cookie
-			sessionID, err := c.Cookie("goguard_session")
+			sessionID, err := c.Cookie(SessionCookieName)
 			if err != nil || sessionID == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized", Code: models.ErrCodeUnauthorized})
 				c.Abort()
 				return
 			}
 
-			session, ok := oidcProvider.GetSession(sessionID)
+			session, ok := oidcProvider.RenewSession(c.Request.Context(), sessionID)
 			if !ok {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "session expired"})
+				oidcProvider.ClearSessionCookie(c)
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "session expired", Code: models.ErrCodeUnauthorized})
 				c.Abort()
 				return
 			}
+			oidcProvider.SetSessionCookie(c, session)
 
 			c.Set("user_id", session.UserID)
 			c.Set("email", session.Email)
@@ -255,14 +286,15 @@ func AuthMiddleware(jwtSecret string, oidcProvider *OIDCProvider) gin.HandlerFun
 		// Parse Bearer token
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header"})
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "invalid authorization header", Code: models.ErrCodeUnauthorized})
 			c.Abort()
 			return
 		}
 
-		claims, err := ValidateJWT(parts[1], jwtSecret)
+		claims, err := ValidateJWT(parts[1], jwtSecret, validation)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			log.Debug().Err(err).Msg("Rejected bearer token")
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "invalid token", Code: models.ErrCodeUnauthorized})
 			c.Abort()
 			return
 		}
@@ -279,7 +311,7 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userRole, exists := c.Get("role")
 		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "no role found"})
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "no role found", Code: models.ErrCodeForbidden})
 			c.Abort()
 			return
 		}
@@ -298,7 +330,7 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "insufficient permissions", Code: models.ErrCodeForbidden})
 		c.Abort()
 	}
 }
@@ -337,7 +369,7 @@ func (h *AuthHandlers) HandleLogin(c *gin.Context) {
 
 	authURL, err := h.provider.GetAuthorizationURL(state)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate auth URL"})
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to generate auth URL", Code: models.ErrCodeInternal})
 		return
 	}
 
@@ -361,15 +393,35 @@ func (h *AuthHandlers) HandleCallback(c *gin.Context) {
 
 // HandleLogout handles user logout
 func (h *AuthHandlers) HandleLogout(c *gin.Context) {
-	sessionID, err := c.Cookie("goguard_session")
+	sessionID, err := c.Cookie(SessionCookieName)
 	if err == nil && sessionID != "" {
-		h.provider.DeleteSession(sessionID)
+		if err := h.provider.DeleteSession(c.Request.Context(), sessionID); err != nil {
+			log.Warn().Err(err).Msg("Failed to delete session")
+		}
 	}
 
-	c.SetCookie("goguard_session", "", -1, "/", "", false, true)
+	h.provider.ClearSessionCookie(c)
 	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 }
 
+// HandleLogoutAll logs the current user out of all their sessions
+func (h *AuthHandlers) HandleLogoutAll(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized", Code: models.ErrCodeUnauthorized})
+		return
+	}
+
+	count, err := h.provider.DeleteUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to delete sessions", Code: models.ErrCodeInternal})
+		return
+	}
+
+	h.provider.ClearSessionCookie(c)
+	c.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions", "sessions": count})
+}
+
 // HandleMe returns current user info
 func (h *AuthHandlers) HandleMe(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -0,0 +1,513 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/netaccess"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// APIKeyPrefix marks GoGuard API keys so they can be told apart from JWTs
+const APIKeyPrefix = "gg_"
+
+// TenantHeader picks the tenant a super admin's request is confined to.
+// Other callers may send it too, but only naming their own tenant.
+const TenantHeader = "X-GoGuard-Tenant"
+
+// Permission grants access to a group of control plane operations
+type Permission string
+
+const (
+	PermPoliciesRead  Permission = "policies:read"
+	PermPoliciesWrite Permission = "policies:write"
+	PermUsersRead     Permission = "users:read"
+	PermUsersWrite    Permission = "users:write"
+	PermSpendRead     Permission = "spend:read"
+	PermSpendManage   Permission = "spend:manage"
+	PermAuditRead     Permission = "audit:read"
+	PermAuditManage   Permission = "audit:manage"
+	PermAlertsRead    Permission = "alerts:read"
+	PermAlertsManage  Permission = "alerts:manage"
+	PermSettingsRead  Permission = "settings:read"
+	PermSettingsWrite Permission = "settings:write"
+	PermCapturesRead  Permission = "captures:read"
+	PermAPIKeysManage Permission = "apikeys:manage"
+	PermDashboardRead Permission = "dashboard:read"
+
+	// PermDebug lets callers profile the process through the debug
+	// endpoints, which can expose any tenant's data held in memory
+	PermDebug Permission = "debug:read"
+
+	// PermTenantsManage lets callers not confined to a tenant manage tenants.
+	// The admin role doesn't hold it; tenant admins are admins of one tenant.
+	PermTenantsManage Permission = "tenants:manage"
+
+	// PermGuardOverride lets API keys set guard_options on guard requests
+	PermGuardOverride Permission = "guard:override"
+
+	// PermAll grants every permission
+	PermAll Permission = "*"
+)
+
+// AllPermissions lists every assignable permission
+var AllPermissions = []Permission{
+	PermPoliciesRead, PermPoliciesWrite,
+	PermUsersRead, PermUsersWrite,
+	PermSpendRead, PermSpendManage,
+	PermAuditRead, PermAuditManage,
+	PermAlertsRead, PermAlertsManage,
+	PermSettingsRead, PermSettingsWrite,
+	PermCapturesRead,
+	PermAPIKeysManage,
+	PermDashboardRead,
+	PermDebug,
+	PermGuardOverride,
+	PermTenantsManage,
+}
+
+// DefaultRolePermissions are the built-in grants for each role
+var DefaultRolePermissions = map[string][]Permission{
+	string(models.RoleSuperAdmin): {PermAll},
+	string(models.RoleAdmin):      slices.DeleteFunc(slices.Clone(AllPermissions), func(p Permission) bool { return p == PermTenantsManage }),
+	string(models.RoleViewer): {
+		PermPoliciesRead, PermUsersRead, PermSpendRead, PermAuditRead,
+		PermAlertsRead, PermSettingsRead, PermDashboardRead,
+	},
+	string(models.RoleUser): {},
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	UserID      string       `json:"user_id"`
+	Email       string       `json:"email,omitempty"`
+	Role        string       `json:"role"`
+	Permissions []Permission `json:"permissions"`
+	APIKeyID    string       `json:"api_key_id,omitempty"`
+	Issuer      string       `json:"issuer,omitempty"` // external identity provider that issued the token
+	Groups      []string     `json:"groups,omitempty"`
+	TenantID    string       `json:"tenant_id,omitempty"`   // empty for super admins acting across tenants
+	LLMProfile  string       `json:"llm_profile,omitempty"` // LLM profile of the API key's requests
+
+	// allowedNets are the addresses the API key may be used from; empty
+	// allows any
+	allowedNets []netip.Prefix
+}
+
+// Has reports whether the principal holds the permission
+func (p *Principal) Has(perm Permission) bool {
+	return hasPermission(p.Permissions, perm)
+}
+
+// AddressLimited reports whether the principal's API key may only be used
+// from some addresses
+func (p *Principal) AddressLimited() bool {
+	return len(p.allowedNets) > 0
+}
+
+func hasPermission(granted []Permission, perm Permission) bool {
+	for _, g := range granted {
+		if g == perm || g == PermAll {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore validates plaintext API keys
+type APIKeyStore interface {
+	ValidateAPIKey(ctx context.Context, key string) (*models.APIKey, error)
+}
+
+// UserDirectory stores the GoGuard users that external identities are
+// provisioned into
+type UserDirectory interface {
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) (*models.User, error)
+}
+
+// TenantDirectory reports which tenants callers can act in
+type TenantDirectory interface {
+	Active(ctx context.Context, id string) bool
+}
+
+// Authenticator resolves callers from JWTs, sessions, or API keys and checks their permissions
+type Authenticator struct {
+	jwtSecret       string
+	jwtValidation   JWTValidation
+	tokens          *TokenIssuer
+	oidcProvider    *OIDCProvider
+	apiKeys         APIKeyStore
+	bootstrapKey    string
+	rolePermissions map[string][]Permission
+	issuers         *TrustedIssuers
+	users           UserDirectory
+	tenants         TenantDirectory
+}
+
+// NewAuthenticator creates an authenticator. rolePermissions overrides the
+// built-in grants for the roles it names.
+func NewAuthenticator(jwtSecret string, oidcProvider *OIDCProvider, apiKeys APIKeyStore, rolePermissions map[string][]string) *Authenticator {
+	roles := make(map[string][]Permission, len(DefaultRolePermissions))
+	for role, perms := range DefaultRolePermissions {
+		roles[role] = perms
+	}
+	for role, perms := range rolePermissions {
+		granted := make([]Permission, 0, len(perms))
+		for _, p := range perms {
+			granted = append(granted, Permission(p))
+		}
+		roles[role] = granted
+	}
+
+	return &Authenticator{
+		jwtSecret:       jwtSecret,
+		oidcProvider:    oidcProvider,
+		apiKeys:         apiKeys,
+		rolePermissions: roles,
+	}
+}
+
+// SetBootstrapKey sets a static super_admin API key used to create the first real keys
+func (a *Authenticator) SetBootstrapKey(key string) {
+	a.bootstrapKey = key
+}
+
+// SetJWTValidation sets the clock skew leeway and required issuer and
+// audience for bearer tokens
+func (a *Authenticator) SetJWTValidation(validation JWTValidation) {
+	a.jwtValidation = validation
+}
+
+// SetTokenIssuer validates bearer tokens with the issuer's signing keys as
+// well as the JWT secret
+func (a *Authenticator) SetTokenIssuer(tokens *TokenIssuer) {
+	a.tokens = tokens
+}
+
+// SetTrustedIssuers accepts tokens from external identity providers.
+// Users they identify are provisioned into users when their issuer asks for it.
+func (a *Authenticator) SetTrustedIssuers(issuers *TrustedIssuers, users UserDirectory) {
+	a.issuers = issuers
+	a.users = users
+}
+
+// SetTenants refuses requests confined to tenants that don't exist or are
+// suspended
+func (a *Authenticator) SetTenants(tenants TenantDirectory) {
+	a.tenants = tenants
+}
+
+// RolePermissions returns the permissions granted to a role
+func (a *Authenticator) RolePermissions(role string) []Permission {
+	return a.rolePermissions[role]
+}
+
+// Roles returns the effective permission grants for every role
+func (a *Authenticator) Roles() map[string][]Permission {
+	return a.rolePermissions
+}
+
+// Authenticate resolves the caller of a request, or returns nil if no valid credentials were presented
+func (a *Authenticator) Authenticate(c *gin.Context) *Principal {
+	if key := apiKeyFromRequest(c); key != "" {
+		return a.authenticateAPIKey(c.Request.Context(), key)
+	}
+
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil
+		}
+		if a.issuers != nil {
+			identity, err := a.issuers.Validate(c.Request.Context(), parts[1])
+			if err == nil {
+				return a.externalPrincipal(c.Request.Context(), identity)
+			}
+			if !errors.Is(err, ErrUntrustedIssuer) {
+				log.Debug().Err(err).Msg("Rejected token from trusted issuer")
+				return nil
+			}
+		}
+		var claims *TokenClaims
+		var err error
+		switch {
+		case a.tokens != nil:
+			claims, err = a.tokens.Validate(parts[1])
+		case a.jwtSecret != "":
+			claims, err = ValidateJWT(parts[1], a.jwtSecret, a.jwtValidation)
+		default:
+			return nil
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("Rejected bearer token")
+			return nil
+		}
+		p := a.principal(claims.UserID, claims.Email, claims.Role)
+		p.TenantID = claims.TenantID
+		return p
+	}
+
+	if a.oidcProvider != nil {
+		if sessionID, err := c.Cookie(SessionCookieName); err == nil && sessionID != "" {
+			if session, ok := a.oidcProvider.RenewSession(c.Request.Context(), sessionID); ok {
+				a.oidcProvider.SetSessionCookie(c, session)
+				p := a.principal(session.UserID, session.Email, session.Role)
+				p.TenantID = session.TenantID
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) principal(userID, email, role string) *Principal {
+	return &Principal{
+		UserID:      userID,
+		Email:       email,
+		Role:        role,
+		Permissions: a.rolePermissions[role],
+	}
+}
+
+// externalPrincipal maps an external identity to a principal, provisioning
+// the GoGuard user first if its issuer asks for it
+func (a *Authenticator) externalPrincipal(ctx context.Context, identity *Identity) *Principal {
+	if identity.Provision && a.users != nil {
+		if err := a.provisionUser(ctx, identity); err != nil {
+			log.Warn().Err(err).Str("user_id", identity.UserID).Msg("Failed to provision user from token")
+		}
+	}
+
+	p := a.principal(identity.UserID, identity.Email, identity.Role)
+	p.Issuer = identity.Issuer
+	p.Groups = identity.Groups
+	p.TenantID = identity.TenantID
+	return p
+}
+
+// provisionUser creates the user, or updates their email, role and groups
+// when the token's claims have changed
+func (a *Authenticator) provisionUser(ctx context.Context, identity *Identity) error {
+	user, err := a.users.GetUser(ctx, identity.UserID)
+	if err != nil {
+		_, err = a.users.CreateUser(ctx, &models.User{
+			ID:       identity.UserID,
+			Email:    identity.Email,
+			Role:     models.UserRole(identity.Role),
+			Groups:   identity.Groups,
+			Status:   "active",
+			Metadata: map[string]string{"issuer": identity.Issuer},
+			TenantID: identity.TenantID,
+		})
+		return err
+	}
+
+	if user.Email == identity.Email && string(user.Role) == identity.Role && slices.Equal(user.Groups, identity.Groups) {
+		return nil
+	}
+	updated := *user
+	updated.Email = identity.Email
+	updated.Role = models.UserRole(identity.Role)
+	updated.Groups = identity.Groups
+	_, err = a.users.UpdateUser(ctx, &updated)
+	return err
+}
+
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, key string) *Principal {
+	if a.bootstrapKey != "" && key == a.bootstrapKey {
+		p := a.principal("bootstrap", "", string(models.RoleSuperAdmin))
+		p.APIKeyID = "bootstrap"
+		return p
+	}
+	if a.apiKeys == nil {
+		return nil
+	}
+
+	apiKey, err := a.apiKeys.ValidateAPIKey(ctx, key)
+	if err != nil {
+		return nil
+	}
+
+	p := a.principal(apiKey.UserID, "", string(apiKey.Role))
+	p.APIKeyID = apiKey.ID
+	p.TenantID = apiKey.TenantID
+	p.LLMProfile = apiKey.LLMProfile
+	if len(apiKey.AllowedCIDRs) > 0 {
+		nets, err := netaccess.ParsePrefixes(apiKey.AllowedCIDRs)
+		if err != nil {
+			log.Warn().Err(err).Str("api_key_id", apiKey.ID).Msg("Refusing API key with invalid allowed CIDRs")
+			return nil
+		}
+		p.allowedNets = nets
+	}
+	if len(apiKey.Permissions) > 0 {
+		p.Permissions = make([]Permission, 0, len(apiKey.Permissions))
+		for _, perm := range apiKey.Permissions {
+			p.Permissions = append(p.Permissions, Permission(perm))
+		}
+	}
+	return p
+}
+
+// apiKeyFromRequest extracts an API key from X-API-Key or an Authorization bearer token
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && strings.HasPrefix(token, APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+// Require returns a middleware that authenticates the caller and checks the permission
+func (a *Authenticator) Require(perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFromContext(c)
+		if !ok {
+			principal = a.Authenticate(c)
+			if principal == nil {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized", Code: models.ErrCodeUnauthorized})
+				c.Abort()
+				return
+			}
+			if !allowedFrom(c, principal) || !a.scope(c, principal) {
+				return
+			}
+			setPrincipal(c, principal)
+		}
+
+		if !principal.Has(perm) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "insufficient permissions",
+				"code":       models.ErrCodeForbidden,
+				"permission": perm,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Identify returns a middleware that attaches the caller to data plane
+// requests. Requests without valid credentials pass through anonymously
+// unless required is set.
+func (a *Authenticator) Identify(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal := a.Authenticate(c); principal != nil {
+			if !allowedFrom(c, principal) || !a.scope(c, principal) {
+				return
+			}
+			setPrincipal(c, principal)
+		} else if required {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "unauthorized", Code: models.ErrCodeUnauthorized})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Resolve returns the caller of a request that didn't go through Identify,
+// checking its API key's allowed addresses and confining the request to its
+// tenant like Identify does. It returns nil for anonymous callers, and also
+// when the request was aborted because the caller may not make it.
+func (a *Authenticator) Resolve(c *gin.Context) *Principal {
+	if principal, ok := PrincipalFromContext(c); ok {
+		return principal
+	}
+	principal := a.Authenticate(c)
+	if principal == nil {
+		return nil
+	}
+	if !allowedFrom(c, principal) || !a.scope(c, principal) {
+		return nil
+	}
+	setPrincipal(c, principal)
+	return principal
+}
+
+// ScopeFromHeader returns a middleware confining requests to the tenant
+// named in TenantHeader, for deployments without authentication where every
+// caller acts as a super admin
+func (a *Authenticator) ScopeFromHeader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(TenantHeader) != "" && !a.scope(c, &Principal{Role: string(models.RoleSuperAdmin), Permissions: []Permission{PermAll}}) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// scope confines the request to the principal's tenant, or aborts it when
+// the principal can't act in the tenant asked for. Principals holding
+// PermTenantsManage, such as super admins, act across tenants unless they
+// pick one with TenantHeader; the role name alone grants nothing.
+func (a *Authenticator) scope(c *gin.Context, p *Principal) bool {
+	requested := c.GetHeader(TenantHeader)
+	if p.Has(PermTenantsManage) {
+		p.TenantID = requested
+		if requested == "" {
+			return true
+		}
+	} else {
+		p.TenantID = tenant.Of(p.TenantID)
+		if requested != "" && requested != p.TenantID {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "not a member of tenant " + requested, Code: models.ErrCodeForbidden})
+			c.Abort()
+			return false
+		}
+	}
+
+	if a.tenants != nil && !a.tenants.Active(c.Request.Context(), p.TenantID) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "tenant " + p.TenantID + " does not exist or is suspended", Code: models.ErrCodeForbidden})
+		c.Abort()
+		return false
+	}
+	c.Request = c.Request.WithContext(tenant.WithScope(c.Request.Context(), p.TenantID))
+	return true
+}
+
+// allowedFrom aborts the request when it comes from an address the
+// principal's API key may not be used from
+func allowedFrom(c *gin.Context, p *Principal) bool {
+	if len(p.allowedNets) == 0 {
+		return true
+	}
+	if addr, err := netip.ParseAddr(c.ClientIP()); err == nil && netaccess.Contains(p.allowedNets, addr) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "API key not allowed from this address", Code: models.ErrCodeIPNotAllowed})
+	c.Abort()
+	return false
+}
+
+// setPrincipal stores the caller on the context using the keys AuthMiddleware sets
+func setPrincipal(c *gin.Context, p *Principal) {
+	c.Set("principal", p)
+	c.Set("user_id", p.UserID)
+	c.Set("email", p.Email)
+	c.Set("role", p.Role)
+	c.Set("tenant_id", p.TenantID)
+}
+
+// PrincipalFromContext returns the caller authenticated earlier in the chain
+func PrincipalFromContext(c *gin.Context) (*Principal, bool) {
+	v, ok := c.Get("principal")
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// SessionCookieName is the cookie holding the session ID
+const SessionCookieName = "goguard_session"
+
+// SessionPolicy controls how long sessions live and how their cookie is set
+type SessionPolicy struct {
+	IdleTimeout    time.Duration // expires after this long without activity (0 = never idles out)
+	MaxLifetime    time.Duration // absolute limit from creation
+	CookieSecure   bool
+	CookieSameSite http.SameSite
+	CookieDomain   string
+}
+
+// DefaultSessionPolicy returns a one hour idle timeout within a 24 hour lifetime
+func DefaultSessionPolicy() SessionPolicy {
+	return SessionPolicy{
+		IdleTimeout:    time.Hour,
+		MaxLifetime:    24 * time.Hour,
+		CookieSecure:   true,
+		CookieSameSite: http.SameSiteLaxMode,
+	}
+}
+
+// NewSessionPolicy builds a session policy from configuration
+func NewSessionPolicy(cfg config.SessionConfig) SessionPolicy {
+	policy := DefaultSessionPolicy()
+	policy.IdleTimeout = cfg.IdleTimeout
+	if cfg.MaxLifetime > 0 {
+		policy.MaxLifetime = cfg.MaxLifetime
+	}
+	policy.CookieSecure = cfg.CookieSecure
+	policy.CookieDomain = cfg.CookieDomain
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "strict":
+		policy.CookieSameSite = http.SameSiteStrictMode
+	case "none":
+		policy.CookieSameSite = http.SameSiteNoneMode
+	}
+	return policy
+}
+
+// SetSessionPolicy sets the timeouts applied to new and existing sessions
+func (p *OIDCProvider) SetSessionPolicy(policy SessionPolicy) {
+	p.sessionMu.Lock()
+	defer p.sessionMu.Unlock()
+	p.sessionPolicy = policy
+}
+
+// SetSessionStore sets where sessions are kept. A database or Redis store
+// keeps users logged in across restarts and between replicas.
+func (p *OIDCProvider) SetSessionStore(store SessionStore) {
+	p.sessions = store
+}
+
+func (p *OIDCProvider) policy() SessionPolicy {
+	p.sessionMu.Lock()
+	defer p.sessionMu.Unlock()
+	return p.sessionPolicy
+}
+
+// idleExpiry returns when a session last active at lastActive idles out, or
+// the zero time if sessions don't idle out
+func (policy SessionPolicy) idleExpiry(lastActive time.Time) time.Time {
+	if policy.IdleTimeout <= 0 {
+		return time.Time{}
+	}
+	return lastActive.Add(policy.IdleTimeout)
+}
+
+// touchInterval is how stale a session's recorded activity may get before a
+// request writes it back to the store. Recording every request would write
+// to the store on each dashboard poll; this keeps the idle expiry accurate
+// to a tenth of the idle timeout.
+func (policy SessionPolicy) touchInterval() time.Duration {
+	if policy.IdleTimeout <= 0 {
+		return time.Minute
+	}
+	return min(time.Minute, policy.IdleTimeout/10)
+}
+
+// RenewSession retrieves a session and records activity on it, pushing back
+// its idle expiry. The absolute expiry is not extended.
+func (p *OIDCProvider) RenewSession(ctx context.Context, sessionID string) (*Session, bool) {
+	policy := p.policy()
+	now := time.Now()
+	session, ok := p.liveSession(ctx, sessionID, policy, now)
+	if !ok {
+		return nil, false
+	}
+	if now.Sub(session.LastActiveAt) >= policy.touchInterval() {
+		if err := p.sessions.TouchSession(ctx, sessionID, now, policy.idleExpiry(now)); err != nil {
+			log.Warn().Err(err).Msg("Failed to record session activity")
+		}
+		session.LastActiveAt = now
+	}
+	return session, true
+}
+
+// RotateSession replaces a session with one under a new ID, keeping its
+// user and absolute expiry, and records activity on it. The old ID stops
+// working, so a stolen copy of it can't be used after the rotation. The old
+// session is taken from the store in one step, so of concurrent rotations
+// only one succeeds.
+func (p *OIDCProvider) RotateSession(ctx context.Context, sessionID string) (*Session, error) {
+	policy := p.policy()
+	now := time.Now()
+	old, err := p.sessions.TakeSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sessionExpired(old, policy, now) {
+		return nil, ErrSessionNotFound
+	}
+
+	session := *old
+	session.ID = generateSessionID()
+	session.LastActiveAt = now
+	if err := p.sessions.CreateSession(ctx, &session, policy.idleExpiry(now)); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+	return &session, nil
+}
+
+// liveSession returns a session if it hasn't expired, deleting it otherwise
+func (p *OIDCProvider) liveSession(ctx context.Context, sessionID string, policy SessionPolicy, now time.Time) (*Session, bool) {
+	session, err := p.sessions.GetSession(ctx, sessionID)
+	if err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			log.Warn().Err(err).Msg("Failed to read session")
+		}
+		return nil, false
+	}
+	if sessionExpired(session, policy, now) {
+		if err := p.sessions.DeleteSession(ctx, sessionID); err != nil {
+			log.Warn().Err(err).Msg("Failed to delete expired session")
+		}
+		return nil, false
+	}
+	return session, true
+}
+
+// sessionExpired checks a session against the current policy, which may
+// have a shorter idle timeout than the one the store was given
+func sessionExpired(session *Session, policy SessionPolicy, now time.Time) bool {
+	if now.After(session.ExpiresAt) {
+		return true
+	}
+	idleExpiry := policy.idleExpiry(session.LastActiveAt)
+	return !idleExpiry.IsZero() && now.After(idleExpiry)
+}
+
+// SetSessionCookie writes the session cookie. Its max age follows the idle
+// timeout, capped by the session's absolute expiry, so the browser drops the
+// cookie when the server would reject it.
+func (p *OIDCProvider) SetSessionCookie(c *gin.Context, session *Session) {
+	policy := p.policy()
+
+	maxAge := time.Until(session.ExpiresAt)
+	if policy.IdleTimeout > 0 && policy.IdleTimeout < maxAge {
+		maxAge = policy.IdleTimeout
+	}
+	p.writeSessionCookie(c, policy, session.ID, int(maxAge.Seconds()))
+}
+
+// ClearSessionCookie removes the session cookie from the browser
+func (p *OIDCProvider) ClearSessionCookie(c *gin.Context) {
+	policy := p.policy()
+
+	p.writeSessionCookie(c, policy, "", -1)
+}
+
+func (p *OIDCProvider) writeSessionCookie(c *gin.Context, policy SessionPolicy, value string, maxAge int) {
+	c.SetSameSite(policy.CookieSameSite)
+	c.SetCookie(SessionCookieName, value, maxAge, "/", policy.CookieDomain, policy.CookieSecure, true)
+}
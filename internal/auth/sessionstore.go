@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/database"
+)
+
+// ErrSessionNotFound is returned for sessions that don't exist or have expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore keeps login sessions. Stores may drop a session once it
+// passes its absolute or idle expiry, but the provider checks both itself.
+type SessionStore interface {
+	// CreateSession stores a new session that idles out at idleExpiresAt
+	// (zero = never idles out)
+	CreateSession(ctx context.Context, session *Session, idleExpiresAt time.Time) error
+	// GetSession returns a session or ErrSessionNotFound
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// TouchSession records activity on a session, moving its idle expiry
+	TouchSession(ctx context.Context, id string, activeAt, idleExpiresAt time.Time) error
+	// DeleteSession removes a session
+	DeleteSession(ctx context.Context, id string) error
+	// TakeSession removes a session and returns it, or ErrSessionNotFound.
+	// Of concurrent calls for the same session, only one gets it.
+	TakeSession(ctx context.Context, id string) (*Session, error)
+	// DeleteUserSessions removes all of a user's sessions and returns how
+	// many there were
+	DeleteUserSessions(ctx context.Context, userID string) (int, error)
+}
+
+// sessionDeadline returns when a store may drop a session
+func sessionDeadline(session *Session, idleExpiresAt time.Time) time.Time {
+	if !idleExpiresAt.IsZero() && idleExpiresAt.Before(session.ExpiresAt) {
+		return idleExpiresAt
+	}
+	return session.ExpiresAt
+}
+
+// hashSessionID hashes a session ID so shared stores never hold a usable
+// session cookie
+func hashSessionID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+type memorySession struct {
+	session  Session
+	deadline time.Time
+}
+
+// MemorySessionStore keeps sessions in process. They are lost on restart
+// and not shared between replicas.
+type MemorySessionStore struct {
+	sessions map[string]*memorySession
+	mu       sync.Mutex
+}
+
+// NewMemorySessionStore creates an empty in-memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]*memorySession)}
+}
+
+// CreateSession stores a copy of session, dropping expired sessions
+func (m *MemorySessionStore) CreateSession(ctx context.Context, session *Session, idleExpiresAt time.Time) error {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, s := range m.sessions {
+		if now.After(s.deadline) {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[session.ID] = &memorySession{session: *session, deadline: sessionDeadline(session, idleExpiresAt)}
+	return nil
+}
+
+// GetSession returns a copy of a session
+func (m *MemorySessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok || time.Now().After(s.deadline) {
+		return nil, ErrSessionNotFound
+	}
+	session := s.session
+	return &session, nil
+}
+
+// TouchSession records activity on a session
+func (m *MemorySessionStore) TouchSession(ctx context.Context, id string, activeAt, idleExpiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	s.session.LastActiveAt = activeAt
+	s.deadline = sessionDeadline(&s.session, idleExpiresAt)
+	return nil
+}
+
+// DeleteSession removes a session
+func (m *MemorySessionStore) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// TakeSession removes a session and returns it
+func (m *MemorySessionStore) TakeSession(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	delete(m.sessions, id)
+	if time.Now().After(s.deadline) {
+		return nil, ErrSessionNotFound
+	}
+	session := s.session
+	return &session, nil
+}
+
+// DeleteUserSessions removes all of a user's sessions
+func (m *MemorySessionStore) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for id, s := range m.sessions {
+		if s.session.UserID == userID {
+			delete(m.sessions, id)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DatabaseSessionStore keeps sessions in the sessions table, so they survive
+// restarts and are shared by all replicas using the database
+type DatabaseSessionStore struct {
+	repo *database.Repository
+}
+
+// NewDatabaseSessionStore creates a session store backed by repo
+func NewDatabaseSessionStore(repo *database.Repository) *DatabaseSessionStore {
+	return &DatabaseSessionStore{repo: repo}
+}
+
+// CreateSession stores a session, dropping expired sessions
+func (d *DatabaseSessionStore) CreateSession(ctx context.Context, session *Session, idleExpiresAt time.Time) error {
+	if err := d.repo.DeleteExpiredSessions(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to delete expired sessions")
+	}
+	return d.repo.CreateSession(ctx, hashSessionID(session.ID), session, idleExpiresAt)
+}
+
+// GetSession returns a session
+func (d *DatabaseSessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	session, err := d.repo.GetSession(ctx, hashSessionID(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.ID = id
+	return session, nil
+}
+
+// TouchSession records activity on a session
+func (d *DatabaseSessionStore) TouchSession(ctx context.Context, id string, activeAt, idleExpiresAt time.Time) error {
+	return d.repo.TouchSession(ctx, hashSessionID(id), activeAt, idleExpiresAt)
+}
+
+// DeleteSession removes a session
+func (d *DatabaseSessionStore) DeleteSession(ctx context.Context, id string) error {
+	return d.repo.DeleteSession(ctx, hashSessionID(id))
+}
+
+// TakeSession removes a session and returns it
+func (d *DatabaseSessionStore) TakeSession(ctx context.Context, id string) (*Session, error) {
+	session, err := d.repo.TakeSession(ctx, hashSessionID(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.ID = id
+	return session, nil
+}
+
+// DeleteUserSessions removes all of a user's sessions
+func (d *DatabaseSessionStore) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	return d.repo.DeleteUserSessions(ctx, userID)
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisSessionPrefix namespaces session keys, which are followed by the
+// hash of the session ID
+const redisSessionPrefix = "goguard:session:"
+
+// RedisSessionStore keeps sessions in Redis, which expires them at their
+// idle or absolute expiry
+type RedisSessionStore struct {
+	client *redis.Client
+}
+
+// NewRedisSessionStore connects to Redis at url
+func NewRedisSessionStore(url string) (*RedisSessionStore, error) {
+	if url == "" {
+		return nil, errors.New("redis session store requires a redis URL")
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisSessionStore{client: client}, nil
+}
+
+// CreateSession stores a session until it expires
+func (r *RedisSessionStore) CreateSession(ctx context.Context, session *Session, idleExpiresAt time.Time) error {
+	return r.save(ctx, session.ID, session, idleExpiresAt)
+}
+
+// GetSession returns a session
+func (r *RedisSessionStore) GetSession(ctx context.Context, id string) (*Session, error) {
+	return decodeSession(id, r.client.Get(ctx, redisSessionPrefix+hashSessionID(id)))
+}
+
+// TakeSession removes a session and returns it, with GETDEL so only one
+// caller gets it
+func (r *RedisSessionStore) TakeSession(ctx context.Context, id string) (*Session, error) {
+	return decodeSession(id, r.client.GetDel(ctx, redisSessionPrefix+hashSessionID(id)))
+}
+
+// decodeSession reads the session a GET or GETDEL returned
+func decodeSession(id string, cmd *redis.StringCmd) (*Session, error) {
+	data, err := cmd.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	session.ID = id
+	return &session, nil
+}
+
+// TouchSession records activity on a session, resetting its key's expiry
+func (r *RedisSessionStore) TouchSession(ctx context.Context, id string, activeAt, idleExpiresAt time.Time) error {
+	session, err := r.GetSession(ctx, id)
+	if err != nil {
+		return err
+	}
+	session.LastActiveAt = activeAt
+	return r.save(ctx, id, session, idleExpiresAt)
+}
+
+// DeleteSession removes a session
+func (r *RedisSessionStore) DeleteSession(ctx context.Context, id string) error {
+	return r.client.Del(ctx, redisSessionPrefix+hashSessionID(id)).Err()
+}
+
+// DeleteUserSessions removes all of a user's sessions. It scans every
+// session, which is fine for an occasional logout of all devices.
+func (r *RedisSessionStore) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	iter := r.client.Scan(ctx, 0, redisSessionPrefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		data, err := r.client.Get(ctx, iter.Val()).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		var session Session
+		if json.Unmarshal(data, &session) == nil && session.UserID == userID {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// save writes a session without its ID, which only the cookie holds
+func (r *RedisSessionStore) save(ctx context.Context, id string, session *Session, idleExpiresAt time.Time) error {
+	ttl := time.Until(sessionDeadline(session, idleExpiresAt))
+	if ttl <= 0 {
+		return r.DeleteSession(ctx, id)
+	}
+
+	stored := *session
+	stored.ID = ""
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, redisSessionPrefix+hashSessionID(id), data, ttl).Err()
+}
+
+// Close releases the Redis connection
+func (r *RedisSessionStore) Close() error {
+	return r.client.Close()
+}
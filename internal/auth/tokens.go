@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+var (
+	// ErrTokensUnavailable is returned when neither a JWT secret nor a
+	// signing key is configured
+	ErrTokensUnavailable = errors.New("no JWT secret or signing key is configured")
+
+	// ErrInvalidRefreshToken is returned for refresh tokens that are
+	// unknown, expired, or already used
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// defaultIssuer is the iss claim of GoGuard's tokens when jwt.issuer is unset
+const defaultIssuer = "goguard"
+
+// TokenPair is an access token and the refresh token that replaces it
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int       `json:"expires_in"` // seconds until the access token expires
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"` // absolute; refreshing doesn't extend it
+}
+
+// TokenIssuer signs and validates GoGuard's own access tokens. With signing
+// keys it uses RS256 or ES256 and publishes the public keys, so downstream
+// services can validate tokens without holding a secret; otherwise it uses
+// HS256 with the JWT secret.
+//
+// Refresh tokens are sessions: each can be used once, idles out with the
+// session idle timeout, and ends with its user's other sessions.
+type TokenIssuer struct {
+	secret     []byte
+	keys       []*signingKey // keys[0] signs new tokens
+	accessTTL  time.Duration
+	validation JWTValidation
+	sessions   *OIDCProvider
+}
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// NewTokenIssuer creates an issuer from the JWT configuration. Refresh
+// tokens are kept with the sessions of provider.
+func NewTokenIssuer(cfg config.JWTConfig, validation JWTValidation, provider *OIDCProvider) (*TokenIssuer, error) {
+	t := &TokenIssuer{
+		secret:     []byte(cfg.Secret),
+		accessTTL:  cfg.Expiry,
+		validation: validation,
+		sessions:   provider,
+	}
+	if t.accessTTL <= 0 {
+		t.accessTTL = time.Hour
+	}
+
+	seen := make(map[string]bool, len(cfg.SigningKeys))
+	for i, keyCfg := range cfg.SigningKeys {
+		key, err := parseSigningKey(keyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.signing_keys[%d]: %w", i, err)
+		}
+		if seen[key.id] {
+			return nil, fmt.Errorf("jwt.signing_keys[%d]: duplicate key id %q", i, key.id)
+		}
+		seen[key.id] = true
+		t.keys = append(t.keys, key)
+	}
+	return t, nil
+}
+
+// parseSigningKey reads a PEM-encoded RSA or EC private key
+func parseSigningKey(cfg config.JWTSigningKeyConfig) (*signingKey, error) {
+	data := []byte(cfg.PrivateKey)
+	if cfg.PrivateKey == "" {
+		if cfg.PrivateKeyFile == "" {
+			return nil, errors.New("private_key or private_key_file is required")
+		}
+		var err error
+		if data, err = os.ReadFile(cfg.PrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	key := &signingKey{id: cfg.ID}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA key has %d bits; use at least 2048", k.N.BitLen())
+		}
+		key.method, key.private = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			key.method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.method = jwt.SigningMethodES384
+		case elliptic.P521():
+			key.method = jwt.SigningMethodES512
+		default:
+			return nil, errors.New("unsupported EC curve")
+		}
+		key.private = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T; use RSA or EC", parsed)
+	}
+
+	if key.id == "" {
+		der, err := x509.MarshalPKIXPublicKey(key.private.Public())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		key.id = hex.EncodeToString(sum[:8])
+	}
+	return key, nil
+}
+
+// CanIssue reports whether tokens can be signed
+func (t *TokenIssuer) CanIssue() bool {
+	return len(t.keys) > 0 || len(t.secret) > 0
+}
+
+// Issue starts a refresh token for the principal and returns it with its
+// first access token
+func (t *TokenIssuer) Issue(ctx context.Context, p *Principal) (*TokenPair, error) {
+	if !t.CanIssue() || t.sessions == nil {
+		return nil, ErrTokensUnavailable
+	}
+	session, err := t.sessions.CreateSession(ctx, p.UserID, p.Email, "", p.Role, p.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	return t.pair(session)
+}
+
+// Refresh exchanges a refresh token for a new pair, also returning the
+// session behind it. The refresh token is rotated: it stops working, and
+// the pair carries its replacement.
+func (t *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (*TokenPair, *Session, error) {
+	if !t.CanIssue() || t.sessions == nil {
+		return nil, nil, ErrTokensUnavailable
+	}
+	session, err := t.sessions.RotateSession(ctx, refreshToken)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	pair, err := t.pair(session)
+	return pair, session, err
+}
+
+func (t *TokenIssuer) pair(session *Session) (*TokenPair, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.accessTTL)
+	if session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+
+	issuer := t.validation.Issuer
+	if issuer == "" {
+		issuer = defaultIssuer
+	}
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   session.UserID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    issuer,
+		},
+		Email:    session.Email,
+		Name:     session.Name,
+		Role:     session.Role,
+		UserID:   session.UserID,
+		TenantID: session.TenantID,
+	}
+	if t.validation.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{t.validation.Audience}
+	}
+
+	access, err := t.sign(&claims)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresIn:        int(expiresAt.Sub(now).Seconds()),
+		RefreshToken:     session.ID,
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func (t *TokenIssuer) sign(claims *TokenClaims) (string, error) {
+	if len(t.keys) > 0 {
+		key := t.keys[0]
+		token := jwt.NewWithClaims(key.method, claims)
+		token.Header["kid"] = key.id
+		return token.SignedString(key.private)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(t.secret)
+}
+
+// Validate checks a token signed with the secret or any of the signing keys
+func (t *TokenIssuer) Validate(tokenString string) (*TokenClaims, error) {
+	return parseClaims(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			if len(t.secret) == 0 {
+				return nil, errors.New("no JWT secret is configured")
+			}
+			return t.secret, nil
+		}
+		key, err := t.key(token)
+		if err != nil {
+			return nil, err
+		}
+		return key.private.Public(), nil
+	}, t.validation)
+}
+
+// key finds the signing key of a token by its kid header. Its algorithm
+// must match the key's, so a token can't pick a weaker one.
+func (t *TokenIssuer) key(token *jwt.Token) (*signingKey, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range t.keys {
+		if key.id == kid || (kid == "" && len(t.keys) == 1) {
+			if key.method.Alg() != token.Method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWKS returns the public halves of the signing keys
+func (t *TokenIssuer) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(t.keys))}
+	for _, key := range t.keys {
+		k := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			k.Kty = "RSA"
+			k.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			k.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			k.Kty = "EC"
+			k.Crv = pub.Curve.Params().Name
+			k.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			k.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		}
+		set.Keys = append(set.Keys, k)
+	}
+	return set
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// Cache stores JSON-serializable values with a TTL. Values are copied on Set
+// and decoded into dest on Get, so callers never share cached state.
+type Cache interface {
+	// Get decodes the cached value into dest and reports whether it was found
+	Get(ctx context.Context, key string, dest interface{}) (bool, error)
+	// Set stores a value; ttl <= 0 uses the cache's default TTL
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	// Delete removes a single key
+	Delete(ctx context.Context, key string) error
+	// Clear removes every key owned by this cache
+	Clear(ctx context.Context) error
+	// Stats returns hit/miss counters
+	Stats() Stats
+}
+
+// Stats reports cache effectiveness
+type Stats struct {
+	Backend       string  `json:"backend"`
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRate       float64 `json:"hit_rate"`
+	Sets          int64   `json:"sets"`
+	Invalidations int64   `json:"invalidations"`
+	Entries       int     `json:"entries,omitempty"`
+	DefaultTTLSec float64 `json:"default_ttl_seconds"`
+}
+
+// counters holds the shared statistics for cache implementations
+type counters struct {
+	hits          atomic.Int64
+	misses        atomic.Int64
+	sets          atomic.Int64
+	invalidations atomic.Int64
+}
+
+func (c *counters) snapshot(backend string, ttl time.Duration) Stats {
+	stats := Stats{
+		Backend:       backend,
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Sets:          c.sets.Load(),
+		Invalidations: c.invalidations.Load(),
+		DefaultTTLSec: ttl.Seconds(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// New creates a cache for the given namespace using the configured backend
+func New(cfg config.CacheConfig, namespace string, ttl time.Duration) (Cache, error) {
+	switch strings.ToLower(cfg.Backend) {
+	case "", "memory":
+		return NewMemory(ttl), nil
+	case "redis":
+		return NewRedis(cfg.RedisURL, "goguard:"+namespace+":", ttl)
+	default:
+		return nil, fmt.Errorf("unsupported cache backend: %s", cfg.Backend)
+	}
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// sweepInterval is how often writes drop the expired entries of a memory
+// cache, which are otherwise only dropped when read again
+const sweepInterval = time.Minute
+
+// Memory is an in-process cache with per-entry expiry
+type Memory struct {
+	entries   map[string]memoryEntry
+	ttl       time.Duration
+	stats     counters
+	lastSweep time.Time
+	mu        sync.RWMutex
+}
+
+// NewMemory creates an in-memory cache with the given default TTL
+func NewMemory(ttl time.Duration) *Memory {
+	return &Memory{
+		entries: make(map[string]memoryEntry),
+		ttl:     ttl,
+	}
+}
+
+// Get decodes the cached value into dest
+func (m *Memory) Get(ctx context.Context, key string, dest interface{}) (bool, error) {
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+
+	if !ok || (!entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt)) {
+		if ok {
+			m.mu.Lock()
+			delete(m.entries, key)
+			m.mu.Unlock()
+		}
+		m.stats.misses.Add(1)
+		return false, nil
+	}
+
+	if err := json.Unmarshal(entry.data, dest); err != nil {
+		m.stats.misses.Add(1)
+		return false, err
+	}
+	m.stats.hits.Add(1)
+	return true, nil
+}
+
+// Set stores a copy of value
+func (m *Memory) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = m.ttl
+	}
+
+	now := time.Now()
+	entry := memoryEntry{data: data}
+	if ttl > 0 {
+		entry.expiresAt = now.Add(ttl)
+	}
+
+	m.mu.Lock()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+	}
+	m.entries[key] = entry
+	m.mu.Unlock()
+	m.stats.sets.Add(1)
+	return nil
+}
+
+// sweep drops expired entries, such as those of keys never read again.
+// The caller must hold m.mu.
+func (m *Memory) sweep(now time.Time) {
+	for key, entry := range m.entries {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+	m.lastSweep = now
+}
+
+// Delete removes a key
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.entries, key)
+	m.mu.Unlock()
+	m.stats.invalidations.Add(1)
+	return nil
+}
+
+// Clear removes all keys
+func (m *Memory) Clear(ctx context.Context) error {
+	m.mu.Lock()
+	m.entries = make(map[string]memoryEntry)
+	m.mu.Unlock()
+	m.stats.invalidations.Add(1)
+	return nil
+}
+
+// Stats returns cache statistics
+func (m *Memory) Stats() Stats {
+	stats := m.stats.snapshot("memory", m.ttl)
+	m.mu.RLock()
+	stats.Entries = len(m.entries)
+	m.mu.RUnlock()
+	return stats
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a cache shared between instances. Invalidating a key on one
+// instance invalidates it for all of them.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+	stats  counters
+}
+
+// NewRedis connects to Redis at url and namespaces keys with prefix
+func NewRedis(url, prefix string, ttl time.Duration) (*Redis, error) {
+	if url == "" {
+		return nil, errors.New("redis cache requires a redis URL")
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &Redis{client: client, prefix: prefix, ttl: ttl}, nil
+}
+
+// Ping checks that Redis can be reached
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// Get decodes the cached value into dest
+func (r *Redis) Get(ctx context.Context, key string, dest interface{}) (bool, error) {
+	data, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		r.stats.misses.Add(1)
+		return false, nil
+	}
+	if err != nil {
+		r.stats.misses.Add(1)
+		return false, err
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		r.stats.misses.Add(1)
+		return false, err
+	}
+	r.stats.hits.Add(1)
+	return true, nil
+}
+
+// Set stores value with the given TTL
+func (r *Redis) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = r.ttl
+	}
+	if err := r.client.Set(ctx, r.prefix+key, data, ttl).Err(); err != nil {
+		return err
+	}
+	r.stats.sets.Add(1)
+	return nil
+}
+
+// Delete removes a key
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	r.stats.invalidations.Add(1)
+	return r.client.Del(ctx, r.prefix+key).Err()
+}
+
+// Clear removes all keys under this cache's prefix
+func (r *Redis) Clear(ctx context.Context) error {
+	r.stats.invalidations.Add(1)
+
+	iter := r.client.Scan(ctx, 0, r.prefix+"*", 100).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Stats returns cache statistics for this instance
+func (r *Redis) Stats() Stats {
+	return r.stats.snapshot("redis", r.ttl)
+}
+
+// Close releases the Redis connection
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
@@ -3,17 +3,54 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	LLM      LLMConfig      `yaml:"llm"`
-	Security SecurityConfig `yaml:"security"`
-	PII      PIIConfig      `yaml:"pii"`
-	Logging  LoggingConfig  `yaml:"logging"`
+	Server        ServerConfig       `yaml:"server"`
+	Database      DatabaseConfig     `yaml:"database"`
+	LLM           LLMConfig          `yaml:"llm"`
+	Security      SecurityConfig     `yaml:"security"`
+	Network       NetworkConfig      `yaml:"network"`
+	PII           PIIConfig          `yaml:"pii"`
+	Secrets       SecretsConfig      `yaml:"secrets"`
+	Images        ImagesConfig       `yaml:"images"`
+	Moderation    ModerationConfig   `yaml:"moderation"`
+	Capture       CaptureConfig      `yaml:"capture"`
+	Snapshot      SnapshotConfig     `yaml:"snapshot"`
+	Audit         AuditConfig        `yaml:"audit"`
+	Anomaly       AnomalyConfig      `yaml:"anomaly"`
+	Conversations ConversationConfig `yaml:"conversations"`
+	Stats         StatsConfig        `yaml:"stats"`
+	Budgets       BudgetConfig       `yaml:"budgets"`
+	Forecast      ForecastConfig     `yaml:"forecast"`
+	Pricing       PricingConfig      `yaml:"pricing"`
+	Currency      CurrencyConfig     `yaml:"currency"`
+	Canary        CanaryConfig       `yaml:"canary"`
+	Jobs          JobsConfig         `yaml:"jobs"`
+	OPA           OPAConfig          `yaml:"opa"`
+	Notify        NotifyConfig       `yaml:"notifications"`
+	Cache         CacheConfig        `yaml:"cache"`
+	SecretStore   SecretStoreConfig  `yaml:"secret_store"`
+	Encryption    EncryptionConfig   `yaml:"encryption"`
+	JWT           JWTConfig          `yaml:"jwt"`
+	Auth          AuthConfig         `yaml:"auth"`
+	API           APIConfig          `yaml:"api"`
+	Logging       LoggingConfig      `yaml:"logging"`
+}
+
+// DatabaseConfig tunes the database connection. Where to connect is set
+// with the GOGUARD_DB_* environment variables.
+type DatabaseConfig struct {
+	// SlowQueryThreshold is how long a query runs before it is logged as
+	// slow; 0 logs none
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+	// StatementCacheSize is the number of prepared statements kept; 0
+	// prepares none
+	StatementCacheSize int `yaml:"statement_cache_size"`
 }
 
 type ServerConfig struct {
@@ -22,6 +59,45 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
 	Mode         string        `yaml:"mode"` // debug, release, test
+	// FaultInjection lets guard requests simulate upstream LLM failures with
+	// X-GoGuard-Chaos-* headers. It is ignored outside debug mode.
+	FaultInjection bool `yaml:"fault_injection"`
+	// ConfigWatchInterval controls how often the config file is checked for
+	// changes to reload; 0 reloads only on SIGHUP
+	ConfigWatchInterval time.Duration `yaml:"config_watch_interval"`
+	// HealthCheckTimeout bounds each dependency check of /health and /ready
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+	// DebugEndpoints serves /debug/pprof, /debug/vars and /debug/runtime to
+	// callers with the debug:read permission
+	DebugEndpoints bool `yaml:"debug_endpoints"`
+	// TLS serves HTTPS instead of HTTP, optionally requiring client
+	// certificates
+	TLS ServerTLSConfig `yaml:"tls"`
+}
+
+// ServerTLSConfig terminates TLS in GoGuard. With ClientCAFile set, clients
+// must present a certificate issued by one of its CAs (mutual TLS). The
+// files are re-read on reload, so rotated certificates apply without a
+// restart.
+type ServerTLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is "require" (the default) to refuse connections without a
+	// valid client certificate, or "verify_if_given" to only verify the
+	// certificates clients present, e.g. to let health checks through
+	ClientAuth string `yaml:"client_auth"`
+	MinVersion string `yaml:"min_version"` // 1.2 (default) or 1.3
+}
+
+// Enabled reports whether the server should serve TLS
+func (t ServerTLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// FaultInjectionEnabled reports whether simulated upstream failures are allowed
+func (s ServerConfig) FaultInjectionEnabled() bool {
+	return s.FaultInjection && s.Mode == "debug"
 }
 
 type LLMConfig struct {
@@ -31,21 +107,511 @@ type LLMConfig struct {
 	Model       string  `yaml:"model"`
 	MaxTokens   int     `yaml:"max_tokens"`
 	Temperature float64 `yaml:"temperature"`
+
+	// Timeout bounds each call to the provider. Requests may ask for another
+	// timeout up to MaxTimeout; keep both below server.write_timeout.
+	Timeout    time.Duration `yaml:"timeout"`
+	MaxTimeout time.Duration `yaml:"max_timeout"`
+
+	// EmbeddingModel is the model /embeddings requests use when they don't
+	// name one
+	EmbeddingModel string `yaml:"embedding_model"`
+
+	// Models adds to or replaces the built-in context windows and
+	// capabilities of models, by model name or name prefix
+	Models map[string]ModelCapabilitiesConfig `yaml:"models"`
+
+	// ClampMaxTokens lowers max_tokens to what a model can produce and its
+	// context window leaves room for, instead of rejecting the request
+	ClampMaxTokens bool `yaml:"clamp_max_tokens"`
+
+	// Profiles defines additional named LLM configurations (e.g. "cheap", "eu-region")
+	// that can be selected per request or by policy. Profiles stored in the database
+	// take precedence over the ones defined here.
+	Profiles map[string]LLMConfig `yaml:"profiles"`
+
+	// HealthCheckInterval controls how often dashboard-configured credentials are
+	// re-validated in the background. Each check is a paid call to every
+	// profile's provider, so it is off (0) unless set.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+
+	// FailoverProfile names the LLM profile requests are sent to while the
+	// circuit breaker of this configuration's provider is open
+	FailoverProfile string `yaml:"failover_profile"`
+
+	// CircuitBreaker stops calls to a failing provider for a while, so
+	// requests fail fast or fail over instead of waiting out timeouts
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+
+	// ClientPool keeps the clients built for dashboard settings, profiles and
+	// request overrides for reuse
+	ClientPool ClientPoolConfig `yaml:"client_pool"`
+
+	// TLS configures connections to the provider, such as the client
+	// certificate a self-hosted gateway requires
+	TLS UpstreamTLSConfig `yaml:"tls"`
+}
+
+// ModelCapabilitiesConfig describes a model. An entry replaces the built-in
+// one of the same name, so set every capability the model has.
+type ModelCapabilitiesConfig struct {
+	ContextWindow   int  `yaml:"context_window"`    // prompt and completion tokens together; 0 for unknown
+	MaxOutputTokens int  `yaml:"max_output_tokens"` // completion tokens per call; 0 for unknown
+	Vision          bool `yaml:"vision"`
+	Tools           bool `yaml:"tools"`
+	Streaming       bool `yaml:"streaming"`
+}
+
+// UpstreamTLSConfig secures connections to an LLM provider or gateway.
+// Profiles without their own TLS settings inherit the default
+// configuration's when they use its base URL.
+type UpstreamTLSConfig struct {
+	CAFile     string `yaml:"ca_file"`     // CAs to verify the provider with instead of the system ones
+	CertFile   string `yaml:"cert_file"`   // client certificate presented to the provider
+	KeyFile    string `yaml:"key_file"`    // key of the client certificate
+	ServerName string `yaml:"server_name"` // name to verify the provider's certificate against, if not the host of base_url
+}
+
+// IsZero reports whether no TLS settings are configured
+func (t UpstreamTLSConfig) IsZero() bool {
+	return t == UpstreamTLSConfig{}
+}
+
+// ClientPoolConfig bounds the LLM client pool. A size of 0 disables pooling,
+// building a client for every request.
+type ClientPoolConfig struct {
+	Size        int           `yaml:"size"`         // clients kept; the least recently used goes first
+	IdleTimeout time.Duration `yaml:"idle_timeout"` // clients unused this long are dropped; 0 keeps them
+}
+
+// CircuitBreakerConfig controls the per-provider circuit breakers. A circuit
+// opens when enough of the recent calls to a provider failed or were slow,
+// stays open for OpenDuration, then lets HalfOpenProbes calls through to
+// decide whether to close again.
+type CircuitBreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Window           int           `yaml:"window"`             // recent calls the rates are computed over
+	MinRequests      int           `yaml:"min_requests"`       // calls needed in the window before the circuit can open
+	ErrorRate        float64       `yaml:"error_rate"`         // share of failed calls that opens the circuit, 0-1
+	SlowCallDuration time.Duration `yaml:"slow_call_duration"` // calls taking longer count as slow
+	SlowCallRate     float64       `yaml:"slow_call_rate"`     // share of slow calls that opens the circuit; 0 disables
+	OpenDuration     time.Duration `yaml:"open_duration"`
+	HalfOpenProbes   int           `yaml:"half_open_probes"`
 }
 
 type SecurityConfig struct {
+	// Mode is enforce (default), or observe to run detection, masking and
+	// policy checks and log what they would have done without blocking or
+	// changing requests. Authentication, network, concurrency, budget and
+	// model limits are enforced in either mode.
+	Mode                     string   `yaml:"mode"`
 	EnableInjectionDetection bool     `yaml:"enable_injection_detection"`
 	BlockOnDetection         bool     `yaml:"block_on_detection"`
 	InjectionPatterns        []string `yaml:"injection_patterns"`
 	MaxPromptLength          int      `yaml:"max_prompt_length"`
-	RateLimitPerMinute       int      `yaml:"rate_limit_per_minute"`
+	// MaxScanBytes caps the bytes of a prompt scanned for injections;
+	// longer prompts are refused. 0 allows MaxPromptLength characters of
+	// up to 4 bytes each, or any size when that is 0 too.
+	MaxScanBytes int `yaml:"max_scan_bytes"`
+	// ScanChunkBytes is the size of the chunks large messages are scanned
+	// in, and EarlyExit stops scanning a request once it will be blocked
+	ScanChunkBytes     int  `yaml:"scan_chunk_bytes"`
+	EarlyExit          bool `yaml:"early_exit"`
+	RateLimitPerMinute int  `yaml:"rate_limit_per_minute"`
+	// MaxConcurrentPerUser and MaxConcurrentPerKey cap the guard and
+	// embeddings requests in flight per user and per API key; 0 is
+	// unlimited. Requests over a cap wait up to ConcurrencyQueueTimeout for a
+	// slot, then get a 429.
+	MaxConcurrentPerUser    int           `yaml:"max_concurrent_per_user"`
+	MaxConcurrentPerKey     int           `yaml:"max_concurrent_per_key"`
+	ConcurrencyQueueTimeout time.Duration `yaml:"concurrency_queue_timeout"`
+	// SettingsPollInterval controls how often security settings saved in the
+	// dashboard by other instances are picked up; 0 only applies local changes
+	SettingsPollInterval time.Duration `yaml:"settings_poll_interval"`
+}
+
+// NetworkConfig restricts the client addresses GoGuard accepts requests
+// from. Entries are addresses or CIDR ranges, IPv4 or IPv6.
+type NetworkConfig struct {
+	// AllowedCIDRs refuses requests from addresses outside these ranges when
+	// set. API keys can narrow it further with their own ranges.
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+	// DeniedCIDRs are always refused, besides the addresses blocked through
+	// the control plane
+	DeniedCIDRs []string `yaml:"denied_cidrs"`
+	// TrustedProxies are the proxies whose X-Forwarded-For header is believed.
+	// Unset, the header is ignored and the peer address is used.
+	TrustedProxies []string        `yaml:"trusted_proxies"`
+	AutoBlock      AutoBlockConfig `yaml:"auto_block"`
+}
+
+// AutoBlockConfig blocks an address for Duration once Threshold of its
+// requests within Window were blocked or carried a critical injection
+type AutoBlockConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Threshold int           `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	Duration  time.Duration `yaml:"duration"`
+}
+
+// Observe reports whether the security checks only log what they would
+// have done
+func (s SecurityConfig) Observe() bool {
+	return s.Mode == "observe"
+}
+
+// ScanLimit returns the most bytes of a prompt scanned for injections, 0 for
+// no limit
+func (s SecurityConfig) ScanLimit() int {
+	if s.MaxScanBytes > 0 {
+		return s.MaxScanBytes
+	}
+	return 4 * max(s.MaxPromptLength, 0)
+}
+
+// ModerationConfig controls the moderation of LLM responses before they are
+// returned. Moderation settings saved in the dashboard take precedence over
+// enabled, provider, action and thresholds.
+type ModerationConfig struct {
+	Enabled    bool                `yaml:"enabled"`
+	Provider   string              `yaml:"provider"`   // keywords (built-in rules) or openai (moderations API)
+	Action     string              `yaml:"action"`     // warn, redact or block flagged responses
+	Thresholds map[string]float64  `yaml:"thresholds"` // per category, e.g. hate: 0.4; others use 0.5
+	Keywords   map[string][]string `yaml:"keywords"`   // extra regular expressions per category for the keywords provider
+	APIKey     string              `yaml:"api_key"`    // openai provider; defaults to the LLM API key for OpenAI
+	BaseURL    string              `yaml:"base_url"`   // defaults to the LLM base URL for OpenAI, else the public API
+	Model      string              `yaml:"model"`
+	Timeout    time.Duration       `yaml:"timeout"`
+	FailOpen   bool                `yaml:"fail_open"` // deliver responses when the moderations API can't be reached
+}
+
+// SecretsConfig controls the detection of credentials in prompts, kept
+// apart from PII since a leaked key is worse than a leaked address
+type SecretsConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Action     string   `yaml:"action"`      // block (default), mask or warn
+	Types      []string `yaml:"types"`       // detectors to run; empty runs all
+	MinEntropy float64  `yaml:"min_entropy"` // bits per character a token needs to count as a secret
 }
 
 type PIIConfig struct {
 	EnableMasking  bool     `yaml:"enable_masking"`
 	MaskCharacter  string   `yaml:"mask_character"`
 	PIITypes       []string `yaml:"pii_types"`       // email, phone, ssn, credit_card, etc.
+	Locales        []string `yaml:"locales"`         // locale packs adding their types: uk, eu, ca, in
 	PreserveDomain bool     `yaml:"preserve_domain"` // for emails, keep domain visible
+	Mode           string   `yaml:"mode"`            // mask (default) or pseudonymize
+	PseudonymKey   string   `yaml:"pseudonym_key"`   // derives pseudonyms; random per start when empty
+}
+
+// ImagesConfig controls how image parts of multimodal messages are handled
+type ImagesConfig struct {
+	Mode       string        `yaml:"mode"`        // forward (unscanned), ocr, strip or block
+	OCRCommand string        `yaml:"ocr_command"` // reads an image on stdin and writes its text to stdout
+	OnFinding  string        `yaml:"on_finding"`  // with ocr: strip or block images with PII or injections, or that can't be scanned
+	MaxBytes   int           `yaml:"max_bytes"`   // largest decoded image scanned
+	OCRTimeout time.Duration `yaml:"ocr_timeout"` // per image
+}
+
+type CaptureConfig struct {
+	Enabled       bool     `yaml:"enabled"`        // capture prompts/responses for all users
+	Users         []string `yaml:"users"`          // capture only for these user IDs
+	RetentionDays int      `yaml:"retention_days"` // default retention when no policy sets one
+	RedactTypes   []string `yaml:"redact_types"`   // PII types redacted before storage (empty = all)
+	MaxEntries    int      `yaml:"max_entries"`    // in-memory cap when running without a database
+}
+
+// SnapshotConfig controls disk persistence of in-memory state when no database is available
+type SnapshotConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Path          string        `yaml:"path"`
+	Interval      time.Duration `yaml:"interval"`
+	AuditLogLimit int           `yaml:"audit_log_limit"` // most recent audit logs to keep in the snapshot
+}
+
+// AuditConfig controls retention and archival of persisted audit logs
+type AuditConfig struct {
+	RetentionDays int           `yaml:"retention_days"` // default retention; 0 keeps logs forever
+	Interval      time.Duration `yaml:"interval"`       // how often the retention job runs
+	DryRun        bool          `yaml:"dry_run"`        // report what would be purged without deleting
+	ArchiveDir    string        `yaml:"archive_dir"`    // archive purged logs here before deletion (empty = delete only)
+	BatchSize     int           `yaml:"batch_size"`
+	// At most one of ArchiveDir, S3 and GCS may be set
+	S3  S3ArchiveConfig  `yaml:"s3"`
+	GCS GCSArchiveConfig `yaml:"gcs"`
+}
+
+// S3ArchiveConfig archives purged audit logs to an S3 bucket. Credentials
+// come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3ArchiveConfig struct {
+	Bucket   string `yaml:"bucket"` // empty = don't archive to S3
+	Prefix   string `yaml:"prefix"`
+	Region   string `yaml:"region"`   // defaults to AWS_REGION
+	Endpoint string `yaml:"endpoint"` // for S3-compatible stores; buckets are then addressed by path
+}
+
+// GCSArchiveConfig archives purged audit logs to a Google Cloud Storage
+// bucket. Without an access token, one is requested from the metadata server.
+type GCSArchiveConfig struct {
+	Bucket      string `yaml:"bucket"` // empty = don't archive to GCS
+	Prefix      string `yaml:"prefix"`
+	AccessToken string `yaml:"access_token"` // defaults to GOOGLE_OAUTH_ACCESS_TOKEN
+	Endpoint    string `yaml:"endpoint"`
+}
+
+// NotifyConfig controls the webhooks and emails sent when a policy with
+// webhook_url or notify actions triggers
+type NotifyConfig struct {
+	WebhookSecret string        `yaml:"webhook_secret"` // signs webhook payloads (X-GoGuard-Signature)
+	MaxAttempts   int           `yaml:"max_attempts"`   // per delivery, including the first
+	RetryBackoff  time.Duration `yaml:"retry_backoff"`  // doubles after each failed attempt
+	Timeout       time.Duration `yaml:"timeout"`        // per webhook request
+	MaxDeliveries int           `yaml:"max_deliveries"` // delivery log size without a database
+	SMTP          SMTPConfig    `yaml:"smtp"`
+}
+
+// SMTPConfig is the mail server used for policy notification emails
+type SMTPConfig struct {
+	Host     string `yaml:"host"` // empty disables email
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// OPAConfig sends policy decisions to an Open Policy Agent instance
+type OPAConfig struct {
+	URL      string                     `yaml:"url"`       // OPA base URL, e.g. http://opa:8181 (empty disables)
+	Timeout  time.Duration              `yaml:"timeout"`   // per decision
+	FailOpen bool                       `yaml:"fail_open"` // allow requests when OPA can't be reached
+	Policies map[string]OPAPolicyConfig `yaml:"policies"`  // keyed by policy type
+}
+
+// OPAPolicyConfig routes one policy type to an OPA decision
+type OPAPolicyConfig struct {
+	Path string `yaml:"path"` // decision path under /v1/data, e.g. goguard/content
+	Mode string `yaml:"mode"` // merge (both must allow) or override (OPA replaces built-in policies)
+}
+
+// AnomalyConfig controls behavioral anomaly detection on guard requests
+type AnomalyConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	CreateAlerts        bool          `yaml:"create_alerts"`         // raise a security alert for each anomaly, not just an audit event
+	MinSamples          int           `yaml:"min_samples"`           // requests needed before a user's baseline is trusted
+	PromptLengthStdDevs float64       `yaml:"prompt_length_stddevs"` // prompt length spike threshold
+	RareHourRatio       float64       `yaml:"rare_hour_ratio"`       // hours with a smaller share of a user's requests are unusual
+	RepeatThreshold     int           `yaml:"repeat_threshold"`      // identical prompts within repeat_window to flag
+	RepeatWindow        time.Duration `yaml:"repeat_window"`
+
+	// Hourly usage and spend, checked in the background against the hours before
+	UsageInterval   time.Duration `yaml:"usage_interval"`   // how often to check for a newly completed hour; 0 disables
+	BaselineWindow  time.Duration `yaml:"baseline_window"`  // history an hour is compared with
+	SpendMultiplier float64       `yaml:"spend_multiplier"` // a user's hourly spend this many times their average is anomalous
+	MinHourlySpend  float64       `yaml:"min_hourly_spend"` // USD; smaller hourly spend is never flagged
+	BlockedStdDevs  float64       `yaml:"blocked_stddevs"`  // blocked requests spike threshold
+	MinBlocked      int64         `yaml:"min_blocked"`      // fewer blocked requests in an hour are never flagged
+}
+
+// ConversationConfig controls the history kept for requests with a
+// conversation_id, which injection detection analyzes across turns
+type ConversationConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	TTL              time.Duration `yaml:"ttl"`               // idle time after which a conversation is forgotten
+	MaxConversations int           `yaml:"max_conversations"` // least recently active are dropped beyond this
+	MaxTurns         int           `yaml:"max_turns"`         // user turns kept per conversation
+}
+
+// StatsConfig controls the aggregate statistics endpoints
+type StatsConfig struct {
+	Privacy StatsPrivacyConfig `yaml:"privacy"`
+}
+
+// StatsPrivacyConfig protects individual users in shared usage statistics
+type StatsPrivacyConfig struct {
+	Enforce          bool    `yaml:"enforce"`           // always apply; otherwise only when ?privacy=true is passed
+	MinGroupSize     int     `yaml:"min_group_size"`    // suppress groups covering fewer distinct users (k)
+	Epsilon          float64 `yaml:"epsilon"`           // Laplace noise budget; 0 disables noise
+	CostSensitivity  float64 `yaml:"cost_sensitivity"`  // noise scale for cost totals, in USD
+	TokenSensitivity float64 `yaml:"token_sensitivity"` // noise scale for token totals
+}
+
+// BudgetConfig controls how request cost is attributed to projects and teams
+// for budgets and chargeback
+type BudgetConfig struct {
+	ProjectTag string `yaml:"project_tag"` // request metadata key naming the project
+	TeamTag    string `yaml:"team_tag"`    // request metadata key naming the team; defaults to the user's first group
+}
+
+// ForecastConfig controls month-end spend projection and its alert
+type ForecastConfig struct {
+	AlertThreshold float64       `yaml:"alert_threshold"` // alert when projected monthly spend reaches this, in USD (0 disables)
+	CheckInterval  time.Duration `yaml:"check_interval"`  // how often the projection is checked against the threshold
+}
+
+// PricingConfig controls where model prices come from besides the control API
+type PricingConfig struct {
+	FeedURL         string        `yaml:"feed_url"`         // JSON price feed to sync from (empty disables syncing)
+	SyncInterval    time.Duration `yaml:"sync_interval"`    // how often the feed is pulled
+	RefreshInterval time.Duration `yaml:"refresh_interval"` // how often stored prices are reloaded, so changes reach every replica
+}
+
+// CurrencyConfig sets the exchange rates used to show spend and enforce
+// limits in currencies other than USD, which costs are recorded in
+type CurrencyConfig struct {
+	Display      string             `yaml:"display"`       // currency dashboard spend is shown in
+	Rates        map[string]float64 `yaml:"rates"`         // units per USD, e.g. EUR: 0.92; override the feed
+	Feed         string             `yaml:"feed"`          // "ecb" to pull reference rates, empty for manual rates only
+	FeedURL      string             `yaml:"feed_url"`      // ECB daily reference rates XML
+	SyncInterval time.Duration      `yaml:"sync_interval"` // how often the feed is pulled
+}
+
+// CanaryConfig controls synthetic requests sent through the guard pipeline
+// to catch detection or latency regressions
+type CanaryConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Interval   time.Duration `yaml:"interval"`    // time between canary runs
+	LatencySLO time.Duration `yaml:"latency_slo"` // slowest acceptable probe, LLM call excluded
+}
+
+// JobsConfig controls the workers running queued control plane jobs
+type JobsConfig struct {
+	Workers      int           `yaml:"workers"`       // jobs run at once per instance
+	PollInterval time.Duration `yaml:"poll_interval"` // how often workers look for queued jobs
+	Retention    time.Duration `yaml:"retention"`     // how long finished jobs are kept
+}
+
+// CacheConfig selects the backend used for settings, pricing, dashboard and
+// idempotency caches
+type CacheConfig struct {
+	Backend        string        `yaml:"backend"`   // memory, redis
+	RedisURL       string        `yaml:"redis_url"` // e.g. redis://localhost:6379/0
+	SettingsTTL    time.Duration `yaml:"settings_ttl"`
+	PricingTTL     time.Duration `yaml:"pricing_ttl"`
+	DashboardTTL   time.Duration `yaml:"dashboard_ttl"`   // how long dashboard metrics computed from the database are reused
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"` // how long responses to requests with an Idempotency-Key are kept for replay
+}
+
+// SecretStoreConfig configures where secret:// references in this file and
+// in saved settings are resolved, e.g. api_key: secret://vault/goguard/llm#api_key
+type SecretStoreConfig struct {
+	CacheTTL time.Duration    `yaml:"cache_ttl"` // how long a fetched secret is used before it is fetched again, picking up rotations
+	Vault    VaultConfig      `yaml:"vault"`
+	AWS      AWSSecretsConfig `yaml:"aws"`
+	GCP      GCPSecretsConfig `yaml:"gcp"`
+	File     SecretFileConfig `yaml:"file"`
+	EnvFile  string           `yaml:"env_file"` // KEY=value file for secret://env-file/KEY
+}
+
+// VaultConfig locates a HashiCorp Vault server; references name a KV v2
+// secret as mount/path, e.g. secret://vault/secret/goguard#api_key
+type VaultConfig struct {
+	Address   string `yaml:"address"`   // defaults to VAULT_ADDR
+	Token     string `yaml:"token"`     // defaults to VAULT_TOKEN
+	Namespace string `yaml:"namespace"` // Vault Enterprise namespace, defaults to VAULT_NAMESPACE
+}
+
+// AWSSecretsConfig configures AWS Secrets Manager. Credentials come from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type AWSSecretsConfig struct {
+	Region   string `yaml:"region"`   // defaults to AWS_REGION
+	Endpoint string `yaml:"endpoint"` // overrides the regional endpoint, e.g. for a VPC endpoint
+}
+
+// GCPSecretsConfig configures Google Cloud Secret Manager. Without an access
+// token, one is requested from the metadata server.
+type GCPSecretsConfig struct {
+	AccessToken string `yaml:"access_token"` // defaults to GOOGLE_OAUTH_ACCESS_TOKEN
+	Endpoint    string `yaml:"endpoint"`
+}
+
+// SecretFileConfig points to a file of secrets encrypted with
+// "goguard secrets encrypt", for secret://file/NAME
+type SecretFileConfig struct {
+	Path string `yaml:"path"`
+	Key  string `yaml:"key"` // base64 AES-256 key; set GOGUARD_SECRETS_FILE_KEY rather than writing it here
+}
+
+// EncryptionConfig sets the master key that sensitive settings, such as LLM
+// API keys saved in the dashboard, are encrypted with in the database. Each
+// value gets its own data key, encrypted with the master key or AWS KMS.
+type EncryptionConfig struct {
+	MasterKey    string   `yaml:"master_key"`    // base64 AES-256 key, or a secret:// reference to one
+	PreviousKeys []string `yaml:"previous_keys"` // earlier master keys, still used to decrypt until values are rotated
+	KMSKeyID     string   `yaml:"kms_key_id"`    // AWS KMS key ID or ARN wrapping data keys instead of master_key
+}
+
+type JWTConfig struct {
+	Secret   string        `yaml:"secret"`
+	Expiry   time.Duration `yaml:"expiry"`
+	Leeway   time.Duration `yaml:"leeway"`   // clock skew tolerated on exp, nbf and iat
+	Issuer   string        `yaml:"issuer"`   // required iss claim (empty = any issuer)
+	Audience string        `yaml:"audience"` // required aud claim (empty = not checked)
+
+	// SigningKeys sign GoGuard's tokens with RS256 or ES256 instead of the
+	// secret. The first signs new tokens; all are accepted and published at
+	// /.well-known/jwks.json, so keys can be rotated by adding a new one first.
+	SigningKeys []JWTSigningKeyConfig `yaml:"signing_keys"`
+}
+
+// JWTSigningKeyConfig is an RSA or EC private key that GoGuard signs tokens with
+type JWTSigningKeyConfig struct {
+	ID             string `yaml:"id"`               // kid header of the tokens it signs (default: derived from the public key)
+	PrivateKey     string `yaml:"private_key"`      // PEM, or a secret:// reference to one
+	PrivateKeyFile string `yaml:"private_key_file"` // path to a PEM file, used when private_key is empty
+}
+
+// AuthConfig controls authentication and permissions on the control plane API
+type AuthConfig struct {
+	Enabled          bool                  `yaml:"enabled"`            // require credentials on all control plane routes
+	BootstrapAPIKey  string                `yaml:"bootstrap_api_key"`  // static super_admin key for creating the first API keys
+	RolePermissions  map[string][]string   `yaml:"role_permissions"`   // overrides built-in permissions per role
+	RequireDataPlane bool                  `yaml:"require_data_plane"` // reject guard calls without a valid token or API key
+	TrustedIssuers   []TrustedIssuerConfig `yaml:"trusted_issuers"`
+	Session          SessionConfig         `yaml:"session"`
+	SCIM             SCIMConfig            `yaml:"scim"`
+}
+
+// SCIMConfig lets an identity provider such as Okta provision users and
+// groups through SCIM 2.0 at /scim/v2
+type SCIMConfig struct {
+	Token       string `yaml:"token"`        // bearer token the identity provider sends; SCIM is off when empty
+	Tenant      string `yaml:"tenant"`       // tenant provisioned users and groups belong to (default "default")
+	DefaultRole string `yaml:"default_role"` // role of provisioned users (default "user")
+}
+
+// SessionConfig controls the lifetime and cookie of dashboard login sessions
+type SessionConfig struct {
+	IdleTimeout    time.Duration `yaml:"idle_timeout"`     // expires after this long without activity (0 = no idle timeout)
+	MaxLifetime    time.Duration `yaml:"max_lifetime"`     // absolute limit, activity doesn't extend it
+	CookieSecure   bool          `yaml:"cookie_secure"`    // only send the cookie over HTTPS
+	CookieSameSite string        `yaml:"cookie_same_site"` // lax, strict, or none
+	CookieDomain   string        `yaml:"cookie_domain"`
+	Store          string        `yaml:"store"`     // memory, database, or redis (default: database when configured, else memory)
+	RedisURL       string        `yaml:"redis_url"` // redis store URL (default: cache.redis_url)
+}
+
+// TrustedIssuerConfig trusts tokens signed by an external identity provider
+// and maps their claims to a GoGuard user
+type TrustedIssuerConfig struct {
+	Issuer         string            `yaml:"issuer"`          // expected iss claim
+	JWKSURL        string            `yaml:"jwks_url"`        // signing keys; discovered from the issuer when empty
+	Audience       string            `yaml:"audience"`        // required aud claim (empty = not checked)
+	UserClaim      string            `yaml:"user_claim"`      // claim holding the user ID (default "sub")
+	EmailClaim     string            `yaml:"email_claim"`     // default "email"
+	RoleClaim      string            `yaml:"role_claim"`      // claim looked up in role_mapping
+	GroupsClaim    string            `yaml:"groups_claim"`    // string or list claim mapped to user groups
+	UserPrefix     string            `yaml:"user_prefix"`     // namespaces user IDs per issuer, e.g. "acme:"
+	RoleMapping    map[string]string `yaml:"role_mapping"`    // IdP role -> GoGuard role
+	DefaultRole    string            `yaml:"default_role"`    // role for unmapped users (default "user")
+	ProvisionUsers bool              `yaml:"provision_users"` // create and update GoGuard users from claims
+	Tenant         string            `yaml:"tenant"`          // tenant the issuer's users belong to (default "default")
+	JWKSRefresh    time.Duration     `yaml:"jwks_refresh"`    // how often keys are refetched (default 1h)
+}
+
+// APIConfig controls the lifecycle of API versions. Dates use YYYY-MM-DD.
+type APIConfig struct {
+	V1DeprecatedAt string `yaml:"v1_deprecated_at"` // sends Deprecation headers on v1 responses
+	V1SunsetAt     string `yaml:"v1_sunset_at"`     // sends Sunset headers announcing v1 removal
 }
 
 type LoggingConfig struct {
@@ -74,29 +640,184 @@ func Load(path string) (*Config, error) {
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:         "0.0.0.0",
-			Port:         8080,
-			ReadTimeout:  30 * time.Second,
-			WriteTimeout: 30 * time.Second,
-			Mode:         "release",
+			Host:                "0.0.0.0",
+			Port:                8080,
+			ReadTimeout:         30 * time.Second,
+			WriteTimeout:        30 * time.Second,
+			Mode:                "release",
+			ConfigWatchInterval: 10 * time.Second,
+			HealthCheckTimeout:  2 * time.Second,
+		},
+		Database: DatabaseConfig{
+			SlowQueryThreshold: 500 * time.Millisecond,
+			StatementCacheSize: 256,
 		},
 		LLM: LLMConfig{
-			Provider:    "openai",
-			Model:       "gpt-4o",
-			MaxTokens:   4096,
-			Temperature: 0.7,
+			Provider:       "openai",
+			Model:          "gpt-4o",
+			EmbeddingModel: "text-embedding-3-small",
+			MaxTokens:      4096,
+			Temperature:    0.7,
+			Timeout:        25 * time.Second,
+			MaxTimeout:     25 * time.Second,
+			CircuitBreaker: CircuitBreakerConfig{
+				Enabled:          true,
+				Window:           20,
+				MinRequests:      10,
+				ErrorRate:        0.5,
+				SlowCallDuration: 30 * time.Second,
+				SlowCallRate:     0.8,
+				OpenDuration:     30 * time.Second,
+				HalfOpenProbes:   1,
+			},
+			ClientPool: ClientPoolConfig{
+				Size:        64,
+				IdleTimeout: 10 * time.Minute,
+			},
 		},
 		Security: SecurityConfig{
+			Mode:                     "enforce",
 			EnableInjectionDetection: true,
 			BlockOnDetection:         true,
 			MaxPromptLength:          32000,
+			ScanChunkBytes:           64 * 1024,
+			EarlyExit:                true,
 			RateLimitPerMinute:       60,
+			ConcurrencyQueueTimeout:  10 * time.Second,
+			SettingsPollInterval:     30 * time.Second,
+		},
+		Network: NetworkConfig{
+			AutoBlock: AutoBlockConfig{
+				Threshold: 10,
+				Window:    10 * time.Minute,
+				Duration:  time.Hour,
+			},
 		},
 		PII: PIIConfig{
 			EnableMasking:  true,
 			MaskCharacter:  "*",
 			PIITypes:       []string{"email", "phone", "ssn", "credit_card", "ip_address"},
 			PreserveDomain: false,
+			Mode:           "mask",
+		},
+		Images: ImagesConfig{
+			Mode:       "forward",
+			OCRCommand: "tesseract stdin stdout",
+			OnFinding:  "strip",
+			MaxBytes:   10 << 20,
+			OCRTimeout: 10 * time.Second,
+		},
+		Secrets: SecretsConfig{
+			Enabled:    true,
+			Action:     "block",
+			MinEntropy: 3.5,
+		},
+		Moderation: ModerationConfig{
+			Provider: "keywords",
+			Action:   "warn",
+			Model:    "omni-moderation-latest",
+			Timeout:  10 * time.Second,
+			FailOpen: true,
+		},
+		Capture: CaptureConfig{
+			RetentionDays: 30,
+			MaxEntries:    1000,
+		},
+		Snapshot: SnapshotConfig{
+			Path:          "goguard-state.json",
+			Interval:      time.Minute,
+			AuditLogLimit: 1000,
+		},
+		Audit: AuditConfig{
+			RetentionDays: 90,
+			Interval:      time.Hour,
+			BatchSize:     1000,
+		},
+		Anomaly: AnomalyConfig{
+			MinSamples:          20,
+			PromptLengthStdDevs: 3,
+			RareHourRatio:       0.02,
+			RepeatThreshold:     5,
+			RepeatWindow:        time.Minute,
+			UsageInterval:       10 * time.Minute,
+			BaselineWindow:      7 * 24 * time.Hour,
+			SpendMultiplier:     10,
+			MinHourlySpend:      1,
+			BlockedStdDevs:      3,
+			MinBlocked:          10,
+		},
+		Conversations: ConversationConfig{
+			Enabled:          true,
+			TTL:              30 * time.Minute,
+			MaxConversations: 10000,
+			MaxTurns:         20,
+		},
+		Stats: StatsConfig{
+			Privacy: StatsPrivacyConfig{
+				MinGroupSize:     5,
+				Epsilon:          1,
+				CostSensitivity:  1,
+				TokenSensitivity: 4096,
+			},
+		},
+		Budgets: BudgetConfig{
+			ProjectTag: "project",
+			TeamTag:    "team",
+		},
+		Forecast: ForecastConfig{
+			CheckInterval: time.Hour,
+		},
+		Pricing: PricingConfig{
+			SyncInterval:    24 * time.Hour,
+			RefreshInterval: 5 * time.Minute,
+		},
+		Currency: CurrencyConfig{
+			Display:      "USD",
+			FeedURL:      "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml",
+			SyncInterval: 12 * time.Hour,
+		},
+		Canary: CanaryConfig{
+			Interval:   5 * time.Minute,
+			LatencySLO: 250 * time.Millisecond,
+		},
+		Jobs: JobsConfig{
+			Workers:      2,
+			PollInterval: 2 * time.Second,
+			Retention:    30 * 24 * time.Hour,
+		},
+		Notify: NotifyConfig{
+			MaxAttempts:   5,
+			RetryBackoff:  2 * time.Second,
+			Timeout:       10 * time.Second,
+			MaxDeliveries: 1000,
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		OPA: OPAConfig{
+			Timeout: 2 * time.Second,
+		},
+		Cache: CacheConfig{
+			Backend:        "memory",
+			SettingsTTL:    time.Minute,
+			PricingTTL:     10 * time.Minute,
+			DashboardTTL:   30 * time.Second,
+			IdempotencyTTL: 24 * time.Hour,
+		},
+		SecretStore: SecretStoreConfig{
+			CacheTTL: 5 * time.Minute,
+		},
+		Auth: AuthConfig{
+			Session: SessionConfig{
+				IdleTimeout:    time.Hour,
+				MaxLifetime:    24 * time.Hour,
+				CookieSecure:   true,
+				CookieSameSite: "lax",
+			},
+		},
+		JWT: JWTConfig{
+			Expiry: 24 * time.Hour,
+			Leeway: 30 * time.Second,
 		},
 		Logging: LoggingConfig{
 			Level:  "info",
@@ -105,6 +826,26 @@ func DefaultConfig() *Config {
 	}
 }
 
+// DevAPIKey is the bootstrap API key of dev mode instances, for the few
+// routes that always require credentials
+const DevAPIKey = "goguard-dev"
+
+// ApplyDevMode adjusts the configuration for evaluating GoGuard locally:
+// readable debug logs, all state in memory and no credentials required
+func (c *Config) ApplyDevMode() {
+	c.Server.Mode = "debug"
+	c.Logging.Level = "debug"
+	c.Logging.Format = "console"
+	c.Logging.OutputPath = ""
+	c.Snapshot.Enabled = false
+	c.Cache.RedisURL = ""
+	c.Auth.Enabled = false
+	c.Auth.RequireDataPlane = false
+	if c.Auth.BootstrapAPIKey == "" {
+		c.Auth.BootstrapAPIKey = DevAPIKey
+	}
+}
+
 func (c *Config) loadFromEnv() {
 	if v := os.Getenv("GOGUARD_HOST"); v != "" {
 		c.Server.Host = v
@@ -117,6 +858,43 @@ func (c *Config) loadFromEnv() {
 	if v := os.Getenv("GOGUARD_MODE"); v != "" {
 		c.Server.Mode = v
 	}
+	if v := os.Getenv("GOGUARD_FAULT_INJECTION"); v != "" {
+		c.Server.FaultInjection = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_DEBUG_ENDPOINTS"); v != "" {
+		c.Server.DebugEndpoints = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_DB_SLOW_QUERY_THRESHOLD"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Database.SlowQueryThreshold = d
+		}
+	}
+	if v := os.Getenv("GOGUARD_DB_STATEMENT_CACHE_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Database.StatementCacheSize = n
+		}
+	}
+	if v := os.Getenv("GOGUARD_TLS_CERT_FILE"); v != "" {
+		c.Server.TLS.CertFile = v
+	}
+	if v := os.Getenv("GOGUARD_TLS_KEY_FILE"); v != "" {
+		c.Server.TLS.KeyFile = v
+	}
+	if v := os.Getenv("GOGUARD_TLS_CLIENT_CA_FILE"); v != "" {
+		c.Server.TLS.ClientCAFile = v
+	}
+	if v := os.Getenv("GOGUARD_ALLOWED_CIDRS"); v != "" {
+		c.Network.AllowedCIDRs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("GOGUARD_DENIED_CIDRS"); v != "" {
+		c.Network.DeniedCIDRs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("GOGUARD_TRUSTED_PROXIES"); v != "" {
+		c.Network.TrustedProxies = strings.Split(v, ",")
+	}
+	if v := os.Getenv("GOGUARD_AUTO_BLOCK"); v != "" {
+		c.Network.AutoBlock.Enabled = v == "true"
+	}
 	if v := os.Getenv("GOGUARD_LLM_PROVIDER"); v != "" {
 		c.LLM.Provider = v
 	}
@@ -129,6 +907,149 @@ func (c *Config) loadFromEnv() {
 	if v := os.Getenv("GOGUARD_LLM_MODEL"); v != "" {
 		c.LLM.Model = v
 	}
+	if v := os.Getenv("GOGUARD_LLM_EMBEDDING_MODEL"); v != "" {
+		c.LLM.EmbeddingModel = v
+	}
+	if v := os.Getenv("GOGUARD_LLM_TLS_CA_FILE"); v != "" {
+		c.LLM.TLS.CAFile = v
+	}
+	if v := os.Getenv("GOGUARD_LLM_TLS_CERT_FILE"); v != "" {
+		c.LLM.TLS.CertFile = v
+	}
+	if v := os.Getenv("GOGUARD_LLM_TLS_KEY_FILE"); v != "" {
+		c.LLM.TLS.KeyFile = v
+	}
+	if v := os.Getenv("GOGUARD_SECURITY_MODE"); v != "" {
+		c.Security.Mode = v
+	}
+	if v := os.Getenv("GOGUARD_IMAGE_MODE"); v != "" {
+		c.Images.Mode = v
+	}
+	if v := os.Getenv("GOGUARD_CONVERSATIONS_ENABLED"); v != "" {
+		c.Conversations.Enabled = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_PII_MODE"); v != "" {
+		c.PII.Mode = v
+	}
+	if v := os.Getenv("GOGUARD_PII_PSEUDONYM_KEY"); v != "" {
+		c.PII.PseudonymKey = v
+	}
+	if v := os.Getenv("GOGUARD_SECRETS_ENABLED"); v != "" {
+		c.Secrets.Enabled = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_SECRETS_ACTION"); v != "" {
+		c.Secrets.Action = v
+	}
+	if v := os.Getenv("GOGUARD_MODERATION_ENABLED"); v != "" {
+		c.Moderation.Enabled = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_MODERATION_PROVIDER"); v != "" {
+		c.Moderation.Provider = v
+	}
+	if v := os.Getenv("GOGUARD_MODERATION_ACTION"); v != "" {
+		c.Moderation.Action = v
+	}
+	if v := os.Getenv("GOGUARD_SNAPSHOT_PATH"); v != "" {
+		c.Snapshot.Enabled = true
+		c.Snapshot.Path = v
+	}
+	if v := os.Getenv("GOGUARD_AUDIT_RETENTION_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			c.Audit.RetentionDays = days
+		}
+	}
+	if v := os.Getenv("GOGUARD_ANOMALY_DETECTION"); v != "" {
+		c.Anomaly.Enabled = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_STATS_PRIVACY"); v != "" {
+		c.Stats.Privacy.Enforce = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_PRICING_FEED_URL"); v != "" {
+		c.Pricing.FeedURL = v
+	}
+	if v := os.Getenv("GOGUARD_CURRENCY"); v != "" {
+		c.Currency.Display = v
+	}
+	if v := os.Getenv("GOGUARD_FX_FEED"); v != "" {
+		c.Currency.Feed = v
+	}
+	if v := os.Getenv("GOGUARD_CANARY_ENABLED"); v != "" {
+		c.Canary.Enabled = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_JOB_WORKERS"); v != "" {
+		if workers, err := strconv.Atoi(v); err == nil {
+			c.Jobs.Workers = workers
+		}
+	}
+	if v := os.Getenv("GOGUARD_WEBHOOK_SECRET"); v != "" {
+		c.Notify.WebhookSecret = v
+	}
+	if v := os.Getenv("GOGUARD_SMTP_HOST"); v != "" {
+		c.Notify.SMTP.Host = v
+	}
+	if v := os.Getenv("GOGUARD_SMTP_PASSWORD"); v != "" {
+		c.Notify.SMTP.Password = v
+	}
+	if v := os.Getenv("GOGUARD_OPA_URL"); v != "" {
+		c.OPA.URL = v
+	}
+	if v := os.Getenv("GOGUARD_CACHE_BACKEND"); v != "" {
+		c.Cache.Backend = v
+	}
+	if v := os.Getenv("GOGUARD_REDIS_URL"); v != "" {
+		c.Cache.RedisURL = v
+	}
+	if v := os.Getenv("GOGUARD_SECRETS_FILE_KEY"); v != "" {
+		c.SecretStore.File.Key = v
+	}
+	if v := os.Getenv("GOGUARD_MASTER_KEY"); v != "" {
+		c.Encryption.MasterKey = v
+	}
+	if v := os.Getenv("GOGUARD_MASTER_KEY_PREVIOUS"); v != "" {
+		c.Encryption.PreviousKeys = strings.Split(v, ",")
+	}
+	if v := os.Getenv("GOGUARD_KMS_KEY_ID"); v != "" {
+		c.Encryption.KMSKeyID = v
+	}
+	if v := os.Getenv("GOGUARD_JWT_SECRET"); v != "" {
+		c.JWT.Secret = v
+	}
+	if v := os.Getenv("GOGUARD_JWT_LEEWAY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.JWT.Leeway = d
+		}
+	}
+	if v := os.Getenv("GOGUARD_JWT_ISSUER"); v != "" {
+		c.JWT.Issuer = v
+	}
+	if v := os.Getenv("GOGUARD_JWT_AUDIENCE"); v != "" {
+		c.JWT.Audience = v
+	}
+	if v := os.Getenv("GOGUARD_AUTH_ENABLED"); v != "" {
+		c.Auth.Enabled = v == "true"
+	}
+	if v := os.Getenv("GOGUARD_BOOTSTRAP_API_KEY"); v != "" {
+		c.Auth.BootstrapAPIKey = v
+	}
+	if v := os.Getenv("GOGUARD_SCIM_TOKEN"); v != "" {
+		c.Auth.SCIM.Token = v
+	}
+	if v := os.Getenv("GOGUARD_SESSION_IDLE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Auth.Session.IdleTimeout = d
+		}
+	}
+	if v := os.Getenv("GOGUARD_SESSION_MAX_LIFETIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Auth.Session.MaxLifetime = d
+		}
+	}
+	if v := os.Getenv("GOGUARD_SESSION_STORE"); v != "" {
+		c.Auth.Session.Store = v
+	}
+	if v := os.Getenv("GOGUARD_AUTH_REQUIRE_DATA_PLANE"); v != "" {
+		c.Auth.RequireDataPlane = v == "true"
+	}
 	if v := os.Getenv("GOGUARD_LOG_LEVEL"); v != "" {
 		c.Logging.Level = v
 	}
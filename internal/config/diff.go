@@ -0,0 +1,43 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff returns the fields that differ between two configurations, named by
+// their dotted YAML path, e.g. "security.rate_limit_per_minute". Values are
+// left out, as many of them are credentials.
+func Diff(old, updated *Config) []string {
+	var changed []string
+	diffValue("", reflect.ValueOf(*old), reflect.ValueOf(*updated), &changed)
+	return changed
+}
+
+func diffValue(path string, a, b reflect.Value, changed *[]string) {
+	if a.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*changed = append(*changed, path)
+		}
+		return
+	}
+
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+		diffValue(name, a.Field(i), b.Field(i), changed)
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"time"
+)
+
+// Watch calls onChange whenever the file at path is changed, checking every
+// interval until ctx is cancelled. Its content is compared rather than its
+// modification time, so editors that rewrite the file unchanged, or a
+// Kubernetes ConfigMap swapping its symlink, only trigger real changes.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if path == "" || interval <= 0 {
+		return
+	}
+
+	last, _ := os.ReadFile(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// A file being written or replaced may briefly be missing
+			data, err := os.ReadFile(path)
+			if err != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			onChange()
+		}
+	}()
+}
@@ -0,0 +1,440 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultSlowQueryThreshold is how long a query runs before it is logged
+	DefaultSlowQueryThreshold = 500 * time.Millisecond
+	// DefaultStatementCacheSize is the number of prepared statements kept
+	DefaultStatementCacheSize = 256
+
+	// maxLoggedQuery bounds the SQL logged for a slow query
+	maxLoggedQuery = 500
+)
+
+// queryBuckets are the upper bounds, in seconds, of the query duration
+// histogram
+var queryBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// statementCache keeps a prepared statement for each query run with
+// arguments, up to its size. When it is full, the least recently used
+// statement is evicted and closed once no query is about to run it; queries
+// already running finish first.
+type statementCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // of *cachedStmt, most recently used first
+	stmts map[string]*list.Element
+}
+
+type cachedStmt struct {
+	query string
+	stmt  *sql.Stmt
+	users int  // callers holding the statement
+	gone  bool // evicted or dropped, to be closed once unused
+}
+
+func newStatementCache(size int) *statementCache {
+	return &statementCache{size: size, order: list.New(), stmts: make(map[string]*list.Element)}
+}
+
+// get returns the prepared statement of query, preparing it on first use,
+// or nil when it can't be prepared. The caller must call release with it
+// once the statement has run.
+func (c *statementCache) get(ctx context.Context, db *sql.DB, query string) *cachedStmt {
+	c.mu.Lock()
+	if el, ok := c.stmts[query]; ok {
+		c.order.MoveToFront(el)
+		entry := el.Value.(*cachedStmt)
+		entry.users++
+		c.mu.Unlock()
+		return entry
+	}
+	c.mu.Unlock()
+
+	// A failed preparation is left to the unprepared query to report
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.stmts[query]; ok {
+		stmt.Close()
+		c.order.MoveToFront(el)
+		entry := el.Value.(*cachedStmt)
+		entry.users++
+		return entry
+	}
+	entry := &cachedStmt{query: query, stmt: stmt, users: 1}
+	c.stmts[query] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return entry
+}
+
+// release hands back a statement returned by get, closing it if it was
+// evicted in the meantime
+func (c *statementCache) release(entry *cachedStmt) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.users--
+	if entry.gone && entry.users == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// drop forgets the prepared statement of query, closing it once unused
+func (c *statementCache) drop(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.stmts[query]; ok {
+		c.remove(el)
+	}
+}
+
+// remove evicts a statement, closing it unless a caller holds it. The
+// caller must hold c.mu.
+func (c *statementCache) remove(el *list.Element) {
+	entry := c.order.Remove(el).(*cachedStmt)
+	delete(c.stmts, entry.query)
+	entry.gone = true
+	if entry.users == 0 {
+		entry.stmt.Close()
+	}
+}
+
+func (c *statementCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// stalePlan reports whether err comes from a prepared statement whose plan a
+// schema change invalidated, so the query succeeds when prepared again
+func stalePlan(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "0A000" && strings.Contains(pqErr.Message, "cached plan")
+}
+
+// queryKey identifies a query duration series
+type queryKey struct {
+	operation string
+	status    string // ok or error
+}
+
+// queryHistogram counts query durations into queryBuckets
+type queryHistogram struct {
+	buckets []uint64 // not cumulative
+	count   uint64
+	sum     float64
+}
+
+// queryMetrics holds the durations of the queries run, by repository
+// operation, and the number that were slow
+type queryMetrics struct {
+	mu        sync.Mutex
+	durations map[queryKey]*queryHistogram
+	slow      map[string]uint64
+}
+
+func newQueryMetrics() *queryMetrics {
+	return &queryMetrics{durations: make(map[queryKey]*queryHistogram), slow: make(map[string]uint64)}
+}
+
+func (m *queryMetrics) observe(key queryKey, d time.Duration, slow bool) {
+	seconds := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.durations[key]
+	if !ok {
+		h = &queryHistogram{buckets: make([]uint64, len(queryBuckets))}
+		m.durations[key] = h
+	}
+	if i, _ := slices.BinarySearch(queryBuckets, seconds); i < len(queryBuckets) {
+		h.buckets[i]++
+	}
+	h.count++
+	h.sum += seconds
+	if slow {
+		m.slow[key.operation]++
+	}
+}
+
+// observe records a query that started at start, logging it when it was slow
+func (db *DB) observe(query string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	key := queryKey{operation: operation(), status: "ok"}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		key.status = "error"
+	}
+	slow := db.slowQuery > 0 && elapsed >= db.slowQuery
+	db.metrics.observe(key, elapsed, slow)
+	if slow {
+		log.Warn().
+			Str("operation", key.operation).
+			Dur("duration", elapsed).
+			Dur("threshold", db.slowQuery).
+			Str("query", loggedQuery(query)).
+			Msg("Slow database query")
+	}
+}
+
+// operation names the function that ran a query, usually a repository
+// method, from the first caller outside this file
+func operation() string {
+	var pcs [16]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasSuffix(frame.File, "/instrument.go") {
+			return shortFuncName(frame.Function)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// shortFuncName turns a qualified function name such as
+// pkg/database.(*Repository).RecordUsage.func1 into RecordUsage
+func shortFuncName(name string) string {
+	name = name[strings.LastIndex(name, "/")+1:]
+	parts := strings.Split(name, ".")
+	for len(parts) > 1 {
+		last := parts[len(parts)-1]
+		if !strings.HasPrefix(last, "func") && strings.Trim(last, "0123456789") != "" {
+			break
+		}
+		parts = parts[:len(parts)-1]
+	}
+	return parts[len(parts)-1]
+}
+
+// loggedQuery collapses the whitespace of a query and shortens it for the log.
+// Arguments are never logged, as they may hold personal data.
+func loggedQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedQuery {
+		query = query[:maxLoggedQuery] + "..."
+	}
+	return query
+}
+
+// prepared returns the cached statement of a query run with arguments, and
+// the function to call once it has run. Queries without arguments aren't
+// prepared, as they may hold several statements, such as the schema script.
+func (db *DB) prepared(ctx context.Context, query string, args []any) (*sql.Stmt, func()) {
+	if len(args) == 0 || db.statements == nil {
+		return nil, nil
+	}
+	entry := db.statements.get(ctx, db.DB, query)
+	if entry == nil {
+		return nil, nil
+	}
+	return entry.stmt, func() { db.statements.release(entry) }
+}
+
+// ExecContext runs a statement, prepared when it has arguments, and records
+// its duration
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	var result sql.Result
+	var err error
+	if stmt, release := db.prepared(ctx, query, args); stmt != nil {
+		result, err = stmt.ExecContext(ctx, args...)
+		release()
+		if stalePlan(err) {
+			db.statements.drop(query)
+			result, err = db.DB.ExecContext(ctx, query, args...)
+		}
+	} else {
+		result, err = db.DB.ExecContext(ctx, query, args...)
+	}
+	db.observe(query, start, err)
+	return result, err
+}
+
+// QueryContext runs a query, prepared when it has arguments, and records how
+// long it took for its rows to start arriving
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	var rows *sql.Rows
+	var err error
+	if stmt, release := db.prepared(ctx, query, args); stmt != nil {
+		rows, err = stmt.QueryContext(ctx, args...)
+		release()
+		if stalePlan(err) {
+			db.statements.drop(query)
+			rows, err = db.DB.QueryContext(ctx, query, args...)
+		}
+	} else {
+		rows, err = db.DB.QueryContext(ctx, query, args...)
+	}
+	db.observe(query, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs a query expected to return at most one row, prepared
+// when it has arguments, and records its duration
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	var row *sql.Row
+	if stmt, release := db.prepared(ctx, query, args); stmt != nil {
+		row = stmt.QueryRowContext(ctx, args...)
+		release()
+		if stalePlan(row.Err()) {
+			db.statements.drop(query)
+			row = db.DB.QueryRowContext(ctx, query, args...)
+		}
+	} else {
+		row = db.DB.QueryRowContext(ctx, query, args...)
+	}
+	db.observe(query, start, row.Err())
+	return row
+}
+
+// Tx is a transaction whose statements are prepared and instrumented like
+// those run on the DB
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+// BeginTx starts a transaction
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+// ExecContext runs a statement in the transaction. A statement whose plan
+// went stale fails the transaction, but is prepared again for the next one.
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	var result sql.Result
+	var err error
+	if stmt, release := tx.db.prepared(ctx, query, args); stmt != nil {
+		result, err = tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+		release()
+	} else {
+		result, err = tx.Tx.ExecContext(ctx, query, args...)
+	}
+	if stalePlan(err) {
+		tx.db.statements.drop(query)
+	}
+	tx.db.observe(query, start, err)
+	return result, err
+}
+
+// QueryContext runs a query in the transaction
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	var rows *sql.Rows
+	var err error
+	if stmt, release := tx.db.prepared(ctx, query, args); stmt != nil {
+		rows, err = tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+		release()
+	} else {
+		rows, err = tx.Tx.QueryContext(ctx, query, args...)
+	}
+	if stalePlan(err) {
+		tx.db.statements.drop(query)
+	}
+	tx.db.observe(query, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs a query expected to return at most one row in the
+// transaction
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	var row *sql.Row
+	if stmt, release := tx.db.prepared(ctx, query, args); stmt != nil {
+		row = tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+		release()
+	} else {
+		row = tx.Tx.QueryRowContext(ctx, query, args...)
+	}
+	if stalePlan(row.Err()) {
+		tx.db.statements.drop(query)
+	}
+	tx.db.observe(query, start, row.Err())
+	return row
+}
+
+// WriteMetrics writes the query durations, slow queries, prepared statements
+// and connection pool of the database in the Prometheus text format
+func (db *DB) WriteMetrics(w io.Writer) {
+	m := db.metrics
+	m.mu.Lock()
+	keys := make([]queryKey, 0, len(m.durations))
+	for key := range m.durations {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b queryKey) int {
+		return strings.Compare(a.operation+"\x00"+a.status, b.operation+"\x00"+b.status)
+	})
+
+	fmt.Fprintln(w, "# HELP goguard_db_query_duration_seconds Duration of database queries by repository operation.")
+	fmt.Fprintln(w, "# TYPE goguard_db_query_duration_seconds histogram")
+	for _, key := range keys {
+		h := m.durations[key]
+		labels := fmt.Sprintf("operation=%q,status=%q", key.operation, key.status)
+		var cumulative uint64
+		for i, le := range queryBuckets {
+			cumulative += h.buckets[i]
+			fmt.Fprintf(w, "goguard_db_query_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, le, cumulative)
+		}
+		fmt.Fprintf(w, "goguard_db_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "goguard_db_query_duration_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(w, "goguard_db_query_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	operations := slices.Sorted(maps.Keys(m.slow))
+	fmt.Fprintln(w, "# HELP goguard_db_slow_queries_total Database queries slower than the slow query threshold.")
+	fmt.Fprintln(w, "# TYPE goguard_db_slow_queries_total counter")
+	for _, op := range operations {
+		fmt.Fprintf(w, "goguard_db_slow_queries_total{operation=%q} %d\n", op, m.slow[op])
+	}
+	m.mu.Unlock()
+
+	var prepared int
+	if db.statements != nil {
+		prepared = db.statements.len()
+	}
+	fmt.Fprintln(w, "# HELP goguard_db_prepared_statements Prepared statements cached.")
+	fmt.Fprintln(w, "# TYPE goguard_db_prepared_statements gauge")
+	fmt.Fprintf(w, "goguard_db_prepared_statements %d\n", prepared)
+
+	stats := db.Stats()
+	fmt.Fprintln(w, "# HELP goguard_db_connections Open database connections by state.")
+	fmt.Fprintln(w, "# TYPE goguard_db_connections gauge")
+	fmt.Fprintf(w, "goguard_db_connections{state=\"in_use\"} %d\n", stats.InUse)
+	fmt.Fprintf(w, "goguard_db_connections{state=\"idle\"} %d\n", stats.Idle)
+	fmt.Fprintln(w, "# HELP goguard_db_connection_waits_total Queries that waited for a free connection.")
+	fmt.Fprintln(w, "# TYPE goguard_db_connection_waits_total counter")
+	fmt.Fprintf(w, "goguard_db_connection_waits_total %d\n", stats.WaitCount)
+	fmt.Fprintln(w, "# HELP goguard_db_connection_wait_seconds_total Time spent waiting for a free connection.")
+	fmt.Fprintln(w, "# TYPE goguard_db_connection_wait_seconds_total counter")
+	fmt.Fprintf(w, "goguard_db_connection_wait_seconds_total %g\n", stats.WaitDuration.Seconds())
+}
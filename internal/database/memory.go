@@ -0,0 +1,380 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Memory keeps policies, users, audit logs and settings in memory, for a
+// deployment without a database and for exercising handlers without one.
+// It behaves like the repository: IDs and timestamps are assigned the same
+// way, missing entries return sql.ErrNoRows and values are copied in and out
+// through JSON, so callers never share them with the store.
+type Memory struct {
+	mu       sync.RWMutex
+	policies map[string]*models.Policy
+	versions []models.PolicyVersion
+	users    map[string]*models.User
+	groups   map[string]*models.Group
+	logs     []*models.AuditLog
+	settings map[string][]byte
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		policies: make(map[string]*models.Policy),
+		users:    make(map[string]*models.User),
+		groups:   make(map[string]*models.Group),
+		settings: make(map[string][]byte),
+	}
+}
+
+// Stores returns the memory store as the store of every domain
+func (m *Memory) Stores() Stores {
+	return Stores{Policies: m, Users: m, Audit: m, Settings: m}
+}
+
+var (
+	_ PolicyStore   = (*Memory)(nil)
+	_ UserStore     = (*Memory)(nil)
+	_ AuditStore    = (*Memory)(nil)
+	_ SettingsStore = (*Memory)(nil)
+)
+
+// clone copies v through JSON, as a value stored in the database would be
+func clone[T any](v *T) *T {
+	data, _ := json.Marshal(v)
+	var copied T
+	json.Unmarshal(data, &copied)
+	return &copied
+}
+
+// memoryTenant stores entries without a tenant under the default one, like
+// the database does
+func memoryTenant(id string) string {
+	if id == "" {
+		return "default"
+	}
+	return id
+}
+
+// Policy operations
+
+func (m *Memory) GetPolicy(ctx context.Context, id string) (*models.Policy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	policy, ok := m.policies[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return clone(policy), nil
+}
+
+// ListPolicies returns the policies in priority order, newest first among
+// equal priorities
+func (m *Memory) ListPolicies(ctx context.Context) ([]*models.Policy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	policies := make([]*models.Policy, 0, len(m.policies))
+	for _, policy := range m.policies {
+		policies = append(policies, clone(policy))
+	}
+	slices.SortFunc(policies, func(a, b *models.Policy) int {
+		return cmp.Or(cmp.Compare(a.Priority, b.Priority), b.CreatedAt.Compare(a.CreatedAt))
+	})
+	return policies, nil
+}
+
+// SavePolicyVersions stores new versions of a policy, ignoring those that
+// are already stored, and inserts or replaces the policy unless it is nil. A
+// replaced policy keeps its creation time and tenant.
+func (m *Memory) SavePolicyVersions(ctx context.Context, policy *models.Policy, versions []models.PolicyVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if policy != nil {
+		saved := clone(policy)
+		saved.TenantID = memoryTenant(saved.TenantID)
+		if existing, ok := m.policies[policy.ID]; ok {
+			saved.CreatedAt = existing.CreatedAt
+			saved.TenantID = existing.TenantID
+		}
+		m.policies[policy.ID] = saved
+	}
+	for i := range versions {
+		if !slices.ContainsFunc(m.versions, func(v models.PolicyVersion) bool {
+			return v.PolicyID == versions[i].PolicyID && v.Version == versions[i].Version
+		}) {
+			m.versions = append(m.versions, *clone(&versions[i]))
+		}
+	}
+	return nil
+}
+
+// SavePolicyBatch inserts new policies and their versions, storing none of
+// them if any policy already exists
+func (m *Memory) SavePolicyBatch(ctx context.Context, policies []*models.Policy, versions []models.PolicyVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, policy := range policies {
+		if _, ok := m.policies[policy.ID]; ok {
+			return fmt.Errorf("failed to insert policy %s: policy %s already exists", policy.Name, policy.ID)
+		}
+	}
+	for _, policy := range policies {
+		saved := clone(policy)
+		saved.TenantID = memoryTenant(saved.TenantID)
+		m.policies[policy.ID] = saved
+	}
+	for i := range versions {
+		m.versions = append(m.versions, *clone(&versions[i]))
+	}
+	return nil
+}
+
+// ListPolicyVersions returns the full version history of every policy, oldest first
+func (m *Memory) ListPolicyVersions(ctx context.Context) ([]models.PolicyVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := make([]models.PolicyVersion, 0, len(m.versions))
+	for i := range m.versions {
+		versions = append(versions, *clone(&m.versions[i]))
+	}
+	slices.SortFunc(versions, func(a, b models.PolicyVersion) int {
+		return cmp.Or(cmp.Compare(a.PolicyID, b.PolicyID), cmp.Compare(a.Version, b.Version))
+	})
+	return versions, nil
+}
+
+// User operations
+
+func (m *Memory) CreateUser(ctx context.Context, user *models.User) error {
+	user.ID = uuid.New().String()
+	user.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := clone(user)
+	saved.TenantID = memoryTenant(saved.TenantID)
+	m.users[user.ID] = saved
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, id string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return clone(user), nil
+}
+
+// ListUsers returns the users, newest first
+func (m *Memory) ListUsers(ctx context.Context) ([]*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	users := make([]*models.User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, clone(user))
+	}
+	slices.SortFunc(users, func(a, b *models.User) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return users, nil
+}
+
+// UpdateUser updates a user's profile, role, status, groups and metadata
+func (m *Memory) UpdateUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.users[user.ID]
+	if !ok {
+		return nil
+	}
+	updated := clone(user)
+	existing.Email, existing.Name, existing.Role, existing.Status = updated.Email, updated.Name, updated.Role, updated.Status
+	existing.Groups, existing.Metadata = updated.Groups, updated.Metadata
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.users, id)
+	return nil
+}
+
+// Group operations
+
+func (m *Memory) CreateGroup(ctx context.Context, group *models.Group) error {
+	group.ID = uuid.New().String()
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := clone(group)
+	saved.TenantID = memoryTenant(saved.TenantID)
+	m.groups[group.ID] = saved
+	return nil
+}
+
+// ListGroups returns the groups, oldest first
+func (m *Memory) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	groups := make([]*models.Group, 0, len(m.groups))
+	for _, group := range m.groups {
+		groups = append(groups, clone(group))
+	}
+	slices.SortFunc(groups, func(a, b *models.Group) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return groups, nil
+}
+
+func (m *Memory) UpdateGroup(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	existing, ok := m.groups[group.ID]
+	if !ok {
+		return fmt.Errorf("no group found with id: %s", group.ID)
+	}
+	existing.Name, existing.Description, existing.UpdatedAt = group.Name, group.Description, group.UpdatedAt
+	return nil
+}
+
+func (m *Memory) DeleteGroup(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.groups, id)
+	return nil
+}
+
+// AuditLog operations
+
+func (m *Memory) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
+	if log.ID == "" {
+		log.ID = uuid.New().String()
+	}
+	if log.Timestamp.IsZero() {
+		log.Timestamp = time.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := clone(log)
+	saved.TenantID = memoryTenant(saved.TenantID)
+	m.logs = append(m.logs, saved)
+	return nil
+}
+
+// ListAuditLogs returns the latest audit logs, newest first
+func (m *Memory) ListAuditLogs(ctx context.Context, limit int) ([]*models.AuditLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	logs := m.sortedLogs()
+	slices.Reverse(logs)
+	return logs[:min(limit, len(logs))], nil
+}
+
+// ListAuditLogsBefore returns audit logs created before the cutoff, oldest first
+func (m *Memory) ListAuditLogsBefore(ctx context.Context, before time.Time, limit, offset int) ([]*models.AuditLog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var logs []*models.AuditLog
+	for _, log := range m.sortedLogs() {
+		if log.Timestamp.Before(before) {
+			logs = append(logs, log)
+		}
+	}
+	if offset >= len(logs) {
+		return nil, nil
+	}
+	logs = logs[offset:]
+	return logs[:min(limit, len(logs))], nil
+}
+
+// sortedLogs returns copies of the audit logs, oldest first. The caller must
+// hold m.mu.
+func (m *Memory) sortedLogs() []*models.AuditLog {
+	logs := make([]*models.AuditLog, 0, len(m.logs))
+	for _, log := range m.logs {
+		logs = append(logs, clone(log))
+	}
+	slices.SortFunc(logs, func(a, b *models.AuditLog) int {
+		return cmp.Or(a.Timestamp.Compare(b.Timestamp), cmp.Compare(a.ID, b.ID))
+	})
+	return logs
+}
+
+// DeleteAuditLogs deletes audit logs by ID
+func (m *Memory) DeleteAuditLogs(ctx context.Context, ids []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.logs)
+	m.logs = slices.DeleteFunc(m.logs, func(log *models.AuditLog) bool {
+		return slices.Contains(ids, log.ID)
+	})
+	return int64(before - len(m.logs)), nil
+}
+
+// Settings operations
+
+func (m *Memory) GetSetting(ctx context.Context, key string) (interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	valueJSON, ok := m.settings[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	var value interface{}
+	json.Unmarshal(valueJSON, &value)
+	return value, nil
+}
+
+func (m *Memory) SetSetting(ctx context.Context, key string, value interface{}) error {
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings[key] = valueJSON
+	return nil
+}
+
+func (m *Memory) GetAllSettings(ctx context.Context) (map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	settings := make(map[string]interface{}, len(m.settings))
+	for key, valueJSON := range m.settings {
+		var value interface{}
+		json.Unmarshal(valueJSON, &value)
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// Degraded is always false, as memory is always reachable
+func (m *Memory) Degraded() bool {
+	return false
+}
+
+// Unavailable is always false, as memory is always reachable
+func (m *Memory) Unavailable(err error) bool {
+	return false
+}
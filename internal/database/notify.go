@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+// changesChannel is the Postgres channel instances announce changes on
+const changesChannel = "goguard_changes"
+
+// listenerPingInterval is how often an idle change listener checks its
+// connection, which would otherwise go unnoticed until the next change
+const listenerPingInterval = 90 * time.Second
+
+// Kinds of changes announced to other instances
+const (
+	ChangeSettings     = "settings"     // ID is the setting's key
+	ChangePolicy       = "policy"       // ID is the policy's ID
+	ChangeSuppressions = "suppressions" // detection suppressions were added or removed
+	// ChangeAll is delivered after the listener reconnects, since changes
+	// announced while it was down are lost
+	ChangeAll = "all"
+)
+
+// Change announces that stored state other instances keep in memory or in
+// their caches has changed
+type Change struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id,omitempty"`
+	Origin string `json:"origin"` // the announcing instance
+}
+
+// instanceID identifies this process as the origin of its announcements, so
+// it can ignore them when they come back
+var instanceID = uuid.New().String()
+
+// announce tells the other instances about a change, on tx when it is given
+// so the change is only delivered once committed. Failures are logged: the
+// other instances then catch up when their caches expire.
+func (r *Repository) announce(ctx context.Context, tx *Tx, kind, id string) {
+	payload, _ := json.Marshal(Change{Kind: kind, ID: id, Origin: instanceID})
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, changesChannel, string(payload))
+	} else {
+		_, err = r.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, changesChannel, string(payload))
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("kind", kind).Str("id", id).Msg("Failed to announce change to other instances")
+	}
+}
+
+// StartListening calls handle with each change another instance announces,
+// until ctx is cancelled. The listener has its own connection and reconnects
+// by itself; handle gets a ChangeAll once it has, as changes may have been
+// missed in between.
+func (r *Repository) StartListening(ctx context.Context, handle func(Change)) {
+	listener := pq.NewListener(r.db.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Warn().Err(err).Msg("Change listener disconnected - reconnecting")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Warn().Err(err).Msg("Change listener failed to reconnect")
+		case pq.ListenerEventReconnected:
+			log.Info().Msg("Change listener reconnected")
+		}
+	})
+
+	go func() {
+		defer listener.Close()
+		// Listen waits for the first connection
+		if err := listener.Listen(changesChannel); err != nil {
+			log.Warn().Err(err).Msg("Failed to listen for changes from other instances - relying on cache expiry")
+			return
+		}
+		log.Info().Str("channel", changesChannel).Msg("Listening for changes from other instances")
+
+		ticker := time.NewTicker(listenerPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := listener.Ping(); err != nil {
+					log.Warn().Err(err).Msg("Change listener ping failed")
+				}
+			case n := <-listener.Notify:
+				// pq sends nil once it has reconnected
+				if n == nil {
+					handle(Change{Kind: ChangeAll})
+					continue
+				}
+				var change Change
+				if err := json.Unmarshal([]byte(n.Extra), &change); err != nil {
+					log.Warn().Err(err).Str("payload", n.Extra).Msg("Ignoring malformed change announcement")
+					continue
+				}
+				if change.Origin != instanceID {
+					handle(change)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+const (
+	// maxQueuedWrites bounds the writes kept while the database is
+	// unreachable; the oldest are dropped beyond it
+	maxQueuedWrites = 10000
+	// replayInterval is how often the database is probed while degraded
+	replayInterval = 5 * time.Second
+)
+
+// queuedWrite is a write kept for replay once the database is back
+type queuedWrite struct {
+	kind  string
+	write func(ctx context.Context) error
+}
+
+// persistence tracks whether the database is reachable and holds the writes
+// that failed while it wasn't
+type persistence struct {
+	mu       sync.Mutex
+	queue    []queuedWrite
+	degraded bool
+	since    time.Time
+	lastErr  string
+	dropped  int64
+	replayed int64
+}
+
+// Unavailable reports whether err means the database can't be reached, as
+// opposed to a query or constraint error, and marks persistence degraded
+// when it does
+func (r *Repository) Unavailable(err error) bool {
+	if !isConnectionError(err) {
+		return false
+	}
+	r.markDegraded(err)
+	return true
+}
+
+// Degraded reports whether the database was unreachable on the last attempt
+func (r *Repository) Degraded() bool {
+	r.persistence.mu.Lock()
+	defer r.persistence.mu.Unlock()
+	return r.persistence.degraded
+}
+
+// Write runs a write that may be deferred, such as an audit log or a usage
+// record. While the database is unreachable the write is queued and replayed
+// in order once it is back, and Write returns nil. Other errors are returned.
+func (r *Repository) Write(ctx context.Context, kind string, write func(ctx context.Context) error) error {
+	if !r.Degraded() {
+		err := write(ctx)
+		if err == nil || !r.Unavailable(err) {
+			return err
+		}
+	}
+
+	p := &r.persistence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queue) >= maxQueuedWrites {
+		p.queue = p.queue[1:]
+		p.dropped++
+	}
+	p.queue = append(p.queue, queuedWrite{kind: kind, write: write})
+	return nil
+}
+
+// PersistenceStatus returns whether persistence is degraded and the state of
+// the write queue
+func (r *Repository) PersistenceStatus() *models.PersistenceStatus {
+	p := &r.persistence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := &models.PersistenceStatus{
+		Degraded:       p.degraded,
+		LastError:      p.lastErr,
+		QueuedWrites:   len(p.queue),
+		DroppedWrites:  p.dropped,
+		ReplayedWrites: p.replayed,
+	}
+	if p.degraded {
+		since := p.since
+		status.Since = &since
+	}
+	return status
+}
+
+// StartReplay probes the database while persistence is degraded and replays
+// the queued writes once it answers, until ctx is cancelled
+func (r *Repository) StartReplay(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(replayInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if r.Degraded() {
+				r.replay(ctx)
+			}
+		}
+	}()
+}
+
+// replay runs the queued writes in order. It stops at the first write that
+// finds the database unreachable again; writes failing for other reasons are
+// dropped since retrying won't help.
+func (r *Repository) replay(ctx context.Context) {
+	pingCtx, cancel := context.WithTimeout(ctx, replayInterval)
+	err := r.Ping(pingCtx)
+	cancel()
+	if err != nil {
+		r.markDegraded(err)
+		return
+	}
+
+	p := &r.persistence
+	for {
+		p.mu.Lock()
+		if len(p.queue) == 0 {
+			since := p.since
+			p.degraded = false
+			p.lastErr = ""
+			replayed := p.replayed
+			p.mu.Unlock()
+			log.Info().Dur("degraded_for", time.Since(since)).Int64("replayed_writes", replayed).Msg("Database reachable again, persistence restored")
+			return
+		}
+		next := p.queue[0]
+		p.mu.Unlock()
+
+		err := next.write(ctx)
+		if err != nil && isConnectionError(err) {
+			r.markDegraded(err)
+			return
+		}
+
+		p.mu.Lock()
+		p.queue = p.queue[1:]
+		if err != nil {
+			p.dropped++
+		} else {
+			p.replayed++
+		}
+		p.mu.Unlock()
+		if err != nil {
+			log.Warn().Err(err).Str("kind", next.kind).Msg("Dropped queued write that failed on replay")
+		}
+	}
+}
+
+func (r *Repository) markDegraded(err error) {
+	p := &r.persistence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastErr = err.Error()
+	if p.degraded {
+		return
+	}
+	p.degraded = true
+	p.since = time.Now()
+	log.Error().Err(err).Msg("Database unreachable, persistence degraded: serving last-known settings and queueing writes")
+}
+
+// isConnectionError reports whether err comes from losing the connection to
+// the database rather than from the statement
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 is connection exceptions; 57P01-57P03 are the server
+		// shutting down or starting up
+		switch pqErr.Code {
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+		return pqErr.Code.Class() == "08"
+	}
+	return false
+}
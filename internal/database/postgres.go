@@ -3,14 +3,24 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/rs/zerolog/log"
 )
 
+// CurrentSchemaVersion is the version of scripts/init.sql this build
+// expects. Bump it with every schema change.
+const CurrentSchemaVersion = 14
+
+// ErrNoSchemaVersion is returned for databases created before the schema
+// was versioned
+var ErrNoSchemaVersion = errors.New("schema_version table not found")
+
 // Config holds database configuration
 type Config struct {
 	Host     string
@@ -19,43 +29,63 @@ type Config struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	// SlowQueryThreshold is how long a query runs before it is logged; 0
+	// logs none
+	SlowQueryThreshold time.Duration
+	// StatementCacheSize is the number of prepared statements kept; 0
+	// prepares none, e.g. behind a pooler that doesn't support them
+	StatementCacheSize int
 }
 
-// DB wraps the sql.DB connection
+// DB wraps the sql.DB connection, preparing and timing the queries run
+// through it
 type DB struct {
 	*sql.DB
+	dsn        string // for connections outside the pool, such as the change listener
+	slowQuery  time.Duration
+	statements *statementCache // nil when statements aren't prepared
+	metrics    *queryMetrics
 }
 
-// NewFromEnv creates a new database connection from environment variables
-func NewFromEnv() (*DB, error) {
-	cfg := Config{
+func newDB(db *sql.DB, cfg Config) *DB {
+	wrapped := &DB{DB: db, dsn: cfg.dsn(), slowQuery: cfg.SlowQueryThreshold, metrics: newQueryMetrics()}
+	if cfg.StatementCacheSize > 0 {
+		wrapped.statements = newStatementCache(cfg.StatementCacheSize)
+	}
+	return wrapped
+}
+
+// DefaultPassword is the password GOGUARD_DB_PASSWORD defaults to
+const DefaultPassword = "goguard_secret"
+
+// ConfigFromEnv reads the database configuration from environment variables
+func ConfigFromEnv() Config {
+	return Config{
 		Host:     getEnv("GOGUARD_DB_HOST", "localhost"),
 		Port:     getEnv("GOGUARD_DB_PORT", "5432"),
 		User:     getEnv("GOGUARD_DB_USER", "goguard"),
-		Password: getEnv("GOGUARD_DB_PASSWORD", "goguard_secret"),
+		Password: getEnv("GOGUARD_DB_PASSWORD", DefaultPassword),
 		DBName:   getEnv("GOGUARD_DB_NAME", "goguard"),
 		SSLMode:  getEnv("GOGUARD_DB_SSLMODE", "disable"),
+
+		SlowQueryThreshold: getEnvDuration("GOGUARD_DB_SLOW_QUERY_THRESHOLD", DefaultSlowQueryThreshold),
+		StatementCacheSize: getEnvInt("GOGUARD_DB_STATEMENT_CACHE_SIZE", DefaultStatementCacheSize),
 	}
-	return New(cfg)
+}
+
+// NewFromEnv creates a new database connection from environment variables
+func NewFromEnv() (*DB, error) {
+	return New(ConfigFromEnv())
 }
 
 // New creates a new database connection
 func New(cfg Config) (*DB, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
-	)
-
-	db, err := sql.Open("postgres", dsn)
+	db, err := open(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
-
 	// Test connection with retry
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -63,7 +93,7 @@ func New(cfg Config) (*DB, error) {
 	for i := 0; i < 5; i++ {
 		if err = db.PingContext(ctx); err == nil {
 			log.Info().Msg("Connected to PostgreSQL database")
-			return &DB{db}, nil
+			return newDB(db, cfg), nil
 		}
 		log.Warn().Err(err).Int("attempt", i+1).Msg("Failed to connect to database, retrying...")
 		time.Sleep(2 * time.Second)
@@ -72,6 +102,54 @@ func New(cfg Config) (*DB, error) {
 	return nil, fmt.Errorf("failed to connect to database after 5 attempts: %w", err)
 }
 
+// Connect opens a connection and pings it once, without New's retries
+func Connect(ctx context.Context, cfg Config) (*DB, error) {
+	db, err := open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return newDB(db, cfg), nil
+}
+
+// dsn returns the connection string of cfg
+func (cfg Config) dsn() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
+	)
+}
+
+func open(cfg Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.dsn())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Configure connection pool
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	return db, nil
+}
+
+// SchemaVersion returns the schema version recorded by scripts/init.sql
+func (db *DB) SchemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT MAX(version) FROM schema_version").Scan(&version)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" { // undefined_table
+		return 0, ErrNoSchemaVersion
+	}
+	if err == nil && !version.Valid {
+		return 0, ErrNoSchemaVersion
+	}
+	return int(version.Int64), err
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.DB.Close()
@@ -83,3 +161,29 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warn().Err(err).Str("variable", key).Dur("default", defaultValue).Msg("Invalid duration - using the default")
+		return defaultValue
+	}
+	return d
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warn().Err(err).Str("variable", key).Int("default", defaultValue).Msg("Invalid number - using the default")
+		return defaultValue
+	}
+	return n
+}
@@ -5,15 +5,19 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"slices"
 	"time"
 
 	"github.com/epps11/goguard/internal/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // Repository provides database operations
 type Repository struct {
-	db *DB
+	db          *DB
+	persistence persistence
 }
 
 // NewRepository creates a new repository
@@ -21,85 +25,133 @@ func NewRepository(db *DB) *Repository {
 	return &Repository{db: db}
 }
 
+// Ping checks that the database can be reached
+func (r *Repository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// WriteMetrics writes the database's query and connection metrics to w in
+// the Prometheus text format
+func (r *Repository) WriteMetrics(w io.Writer) {
+	r.db.WriteMetrics(w)
+}
+
+// SchemaVersion returns the schema version of the database
+func (r *Repository) SchemaVersion(ctx context.Context) (int, error) {
+	return r.db.SchemaVersion(ctx)
+}
+
 // User operations
 
 func (r *Repository) CreateUser(ctx context.Context, user *models.User) error {
 	user.ID = uuid.New().String()
 	user.CreatedAt = time.Now()
 
-	groupsJSON, _ := json.Marshal(user.Groups)
 	metadataJSON, _ := json.Marshal(user.Metadata)
 
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO users (id, email, name, role, status, groups, metadata, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, user.ID, user.Email, user.Name, user.Role, user.Status, groupsJSON, metadataJSON, user.CreatedAt)
+		INSERT INTO users (id, email, name, role, status, groups, metadata, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, `+tenantValue(9)+`)
+	`, user.ID, user.Email, user.Name, user.Role, user.Status, pq.Array(user.Groups), metadataJSON, user.CreatedAt, user.TenantID)
 	return err
 }
 
-func (r *Repository) GetUser(ctx context.Context, id string) (*models.User, error) {
+const userColumns = `id, email, name, role, status, groups, metadata, created_at, last_login_at, tenant_id, ` + deletionColumns
+
+func scanUser(row interface{ Scan(...any) error }) (*models.User, error) {
 	var user models.User
-	var groupsJSON, metadataJSON []byte
-	var lastLoginAt sql.NullTime
+	var metadataJSON []byte
+	var lastLoginAt, deletedAt sql.NullTime
 
-	err := r.db.QueryRowContext(ctx, `
-		SELECT id, email, name, role, status, groups, metadata, created_at, last_login_at
-		FROM users WHERE id = $1
-	`, id).Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status,
-		&groupsJSON, &metadataJSON, &user.CreatedAt, &lastLoginAt)
-	if err != nil {
+	if err := row.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status,
+		pq.Array(&user.Groups), &metadataJSON, &user.CreatedAt, &lastLoginAt, &user.TenantID,
+		&deletedAt, &user.DeletedBy, &user.DeleteReason); err != nil {
 		return nil, err
 	}
 
-	json.Unmarshal(groupsJSON, &user.Groups)
 	json.Unmarshal(metadataJSON, &user.Metadata)
 	if lastLoginAt.Valid {
 		user.LastLoginAt = &lastLoginAt.Time
 	}
-
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
 	return &user, nil
 }
 
-func (r *Repository) ListUsers(ctx context.Context) ([]*models.User, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, email, name, role, status, groups, metadata, created_at, last_login_at
-		FROM users ORDER BY created_at DESC
-	`)
-	if err != nil {
-		return nil, err
-	}
+// scanUsers reads user rows and closes them
+func scanUsers(rows *sql.Rows) ([]*models.User, error) {
 	defer rows.Close()
 
 	var users []*models.User
 	for rows.Next() {
-		var user models.User
-		var groupsJSON, metadataJSON []byte
-		var lastLoginAt sql.NullTime
-
-		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.Status,
-			&groupsJSON, &metadataJSON, &user.CreatedAt, &lastLoginAt); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
 
-		json.Unmarshal(groupsJSON, &user.Groups)
-		json.Unmarshal(metadataJSON, &user.Metadata)
-		if lastLoginAt.Valid {
-			user.LastLoginAt = &lastLoginAt.Time
-		}
-		users = append(users, &user)
+func (r *Repository) GetUser(ctx context.Context, id string) (*models.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (r *Repository) ListUsers(ctx context.Context) ([]*models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	return scanUsers(rows)
+}
+
+// QueryUsers returns a page of the users matching q, leaving out deleted
+// ones, and the number matching
+func (r *Repository) QueryUsers(ctx context.Context, q *models.ListQuery) ([]*models.User, int, error) {
+	where, args := listFilter(columnFilter{"tenant_id", q.Tenant}, columnFilter{"status", q.Status}, columnFilter{"role", q.Role})
+	where += " AND deleted_at IS NULL"
+	page, err := listPage(q, models.UserSortFields, "created_at DESC")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users `+where+page, args...)
+	if err != nil {
+		return nil, 0, err
 	}
-	return users, nil
+	users, err := scanUsers(rows)
+	return users, total, err
+}
+
+// SaveUser stores a user as it is, deletion included, keeping its ID
+func (r *Repository) SaveUser(ctx context.Context, user *models.User) error {
+	metadataJSON, _ := json.Marshal(user.Metadata)
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO users (id, email, name, role, status, groups, metadata, created_at, tenant_id, deleted_at, deleted_by, delete_reason)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, `+tenantValue(9)+`, $10, NULLIF($11, ''), NULLIF($12, ''))
+		ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email, name = EXCLUDED.name,
+		role = EXCLUDED.role, status = EXCLUDED.status, groups = EXCLUDED.groups,
+		metadata = EXCLUDED.metadata, updated_at = NOW(), deleted_at = EXCLUDED.deleted_at,
+		deleted_by = EXCLUDED.deleted_by, delete_reason = EXCLUDED.delete_reason
+	`, user.ID, user.Email, user.Name, user.Role, user.Status, pq.Array(user.Groups), metadataJSON, user.CreatedAt, user.TenantID,
+		user.DeletedAt, user.DeletedBy, user.DeleteReason)
+	return err
 }
 
 func (r *Repository) UpdateUser(ctx context.Context, user *models.User) error {
-	groupsJSON, _ := json.Marshal(user.Groups)
 	metadataJSON, _ := json.Marshal(user.Metadata)
 
 	_, err := r.db.ExecContext(ctx, `
 		UPDATE users SET email = $2, name = $3, role = $4, status = $5,
 		groups = $6, metadata = $7, updated_at = NOW()
 		WHERE id = $1
-	`, user.ID, user.Email, user.Name, user.Role, user.Status, groupsJSON, metadataJSON)
+	`, user.ID, user.Email, user.Name, user.Role, user.Status, pq.Array(user.Groups), metadataJSON)
 	return err
 }
 
@@ -108,6 +160,70 @@ func (r *Repository) DeleteUser(ctx context.Context, id string) error {
 	return err
 }
 
+// Group operations
+
+const groupColumns = `id, tenant_id, name, COALESCE(description, ''), created_at, updated_at`
+
+func scanGroup(row interface{ Scan(...any) error }) (*models.Group, error) {
+	var g models.Group
+	if err := row.Scan(&g.ID, &g.TenantID, &g.Name, &g.Description, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *Repository) CreateGroup(ctx context.Context, group *models.Group) error {
+	group.ID = uuid.New().String()
+	group.CreatedAt = time.Now()
+	group.UpdatedAt = group.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO groups (id, tenant_id, name, description, created_at, updated_at)
+		VALUES ($1, `+tenantValue(2)+`, $3, NULLIF($4, ''), $5, $6)
+	`, group.ID, group.TenantID, group.Name, group.Description, group.CreatedAt, group.UpdatedAt)
+	return err
+}
+
+func (r *Repository) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+groupColumns+` FROM groups ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (r *Repository) UpdateGroup(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE groups SET name = $2, description = NULLIF($3, ''), updated_at = $4
+		WHERE id = $1
+	`, group.ID, group.Name, group.Description, group.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no group found with id: %s", group.ID)
+	}
+	return nil
+}
+
+func (r *Repository) DeleteGroup(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, id)
+	return err
+}
+
 // Policy operations
 
 func (r *Repository) CreatePolicy(ctx context.Context, policy *models.Policy) error {
@@ -121,25 +237,35 @@ func (r *Repository) CreatePolicy(ctx context.Context, policy *models.Policy) er
 	actionsJSON, _ := json.Marshal(policy.Actions)
 
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO policies (id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		INSERT INTO policies (id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, `+tenantValue(13)+`)
 	`, policy.ID, policy.Name, policy.Description, policy.Type, policy.Status, policy.Priority,
-		configJSON, rulesJSON, targetsJSON, actionsJSON, policy.CreatedAt, policy.UpdatedAt)
+		configJSON, rulesJSON, targetsJSON, actionsJSON, policy.CreatedAt, policy.UpdatedAt, policy.TenantID)
 	return err
 }
 
+// deletionColumns are the soft-deletion columns of a table, in the order of
+// models.Deletion
+const deletionColumns = `deleted_at, COALESCE(deleted_by, ''), COALESCE(delete_reason, '')`
+
 func (r *Repository) GetPolicy(ctx context.Context, id string) (*models.Policy, error) {
 	var policy models.Policy
 	var configJSON, rulesJSON, targetsJSON, actionsJSON []byte
+	var deletedAt sql.NullTime
 
 	err := r.db.QueryRowContext(ctx, `
-		SELECT id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at
+		SELECT id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at, tenant_id,
+		`+deletionColumns+`
 		FROM policies WHERE id = $1
 	`, id).Scan(&policy.ID, &policy.Name, &policy.Description, &policy.Type, &policy.Status,
-		&policy.Priority, &configJSON, &rulesJSON, &targetsJSON, &actionsJSON, &policy.CreatedAt, &policy.UpdatedAt)
+		&policy.Priority, &configJSON, &rulesJSON, &targetsJSON, &actionsJSON, &policy.CreatedAt, &policy.UpdatedAt, &policy.TenantID,
+		&deletedAt, &policy.DeletedBy, &policy.DeleteReason)
 	if err != nil {
 		return nil, err
 	}
+	if deletedAt.Valid {
+		policy.DeletedAt = &deletedAt.Time
+	}
 
 	json.Unmarshal(configJSON, &policy.Config)
 	json.Unmarshal(rulesJSON, &policy.Rules)
@@ -151,7 +277,8 @@ func (r *Repository) GetPolicy(ctx context.Context, id string) (*models.Policy,
 
 func (r *Repository) ListPolicies(ctx context.Context) ([]*models.Policy, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at
+		SELECT id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at, tenant_id,
+		`+deletionColumns+`
 		FROM policies ORDER BY priority ASC, created_at DESC
 	`)
 	if err != nil {
@@ -163,11 +290,16 @@ func (r *Repository) ListPolicies(ctx context.Context) ([]*models.Policy, error)
 	for rows.Next() {
 		var policy models.Policy
 		var configJSON, rulesJSON, targetsJSON, actionsJSON []byte
+		var deletedAt sql.NullTime
 
 		if err := rows.Scan(&policy.ID, &policy.Name, &policy.Description, &policy.Type, &policy.Status,
-			&policy.Priority, &configJSON, &rulesJSON, &targetsJSON, &actionsJSON, &policy.CreatedAt, &policy.UpdatedAt); err != nil {
+			&policy.Priority, &configJSON, &rulesJSON, &targetsJSON, &actionsJSON, &policy.CreatedAt, &policy.UpdatedAt, &policy.TenantID,
+			&deletedAt, &policy.DeletedBy, &policy.DeleteReason); err != nil {
 			return nil, err
 		}
+		if deletedAt.Valid {
+			policy.DeletedAt = &deletedAt.Time
+		}
 
 		json.Unmarshal(configJSON, &policy.Config)
 		json.Unmarshal(rulesJSON, &policy.Rules)
@@ -199,29 +331,292 @@ func (r *Repository) DeletePolicy(ctx context.Context, id string) error {
 	return err
 }
 
+// SavePolicy inserts or replaces a policy, keeping the ID and timestamps
+// assigned by the policy engine. Soft-deleted policies are saved with their
+// deletion.
+// SavePolicyVersions stores new versions of a policy in one transaction,
+// along with its current state unless policy is nil, and tells the other
+// instances once when they are committed
+func (r *Repository) SavePolicyVersions(ctx context.Context, policy *models.Policy, versions []models.PolicyVersion) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if policy != nil {
+		configJSON, _ := json.Marshal(policy.Config)
+		rulesJSON, _ := json.Marshal(policy.Rules)
+		targetsJSON, _ := json.Marshal(policy.Targets)
+		actionsJSON, _ := json.Marshal(policy.Actions)
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO policies (id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at, tenant_id,
+			deleted_at, deleted_by, delete_reason)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, `+tenantValue(13)+`, $14, NULLIF($15, ''), NULLIF($16, ''))
+			ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description,
+			type = EXCLUDED.type, status = EXCLUDED.status, priority = EXCLUDED.priority, config = EXCLUDED.config,
+			rules = EXCLUDED.rules, targets = EXCLUDED.targets, actions = EXCLUDED.actions, updated_at = EXCLUDED.updated_at,
+			deleted_at = EXCLUDED.deleted_at, deleted_by = EXCLUDED.deleted_by, delete_reason = EXCLUDED.delete_reason
+		`, policy.ID, policy.Name, policy.Description, policy.Type, policy.Status, policy.Priority,
+			configJSON, rulesJSON, targetsJSON, actionsJSON, policy.CreatedAt, policy.UpdatedAt, policy.TenantID,
+			policy.DeletedAt, policy.DeletedBy, policy.DeleteReason); err != nil {
+			return err
+		}
+	}
+	for _, version := range versions {
+		changesJSON, _ := json.Marshal(version.Changes)
+		policyJSON, _ := json.Marshal(version.Policy)
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO policy_versions (policy_id, version, change_type, changed_by, changes, policy, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (policy_id, version) DO NOTHING
+		`, version.PolicyID, version.Version, version.ChangeType, version.ChangedBy, changesJSON, policyJSON, version.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if len(versions) > 0 {
+		r.announce(ctx, tx, ChangePolicy, versions[0].PolicyID)
+	}
+	return tx.Commit()
+}
+
+// SavePolicyBatch inserts new policies and their versions in one
+// transaction, so either all of them are stored or none are
+func (r *Repository) SavePolicyBatch(ctx context.Context, policies []*models.Policy, versions []models.PolicyVersion) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, policy := range policies {
+		configJSON, _ := json.Marshal(policy.Config)
+		rulesJSON, _ := json.Marshal(policy.Rules)
+		targetsJSON, _ := json.Marshal(policy.Targets)
+		actionsJSON, _ := json.Marshal(policy.Actions)
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO policies (id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at, tenant_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, `+tenantValue(13)+`)
+		`, policy.ID, policy.Name, policy.Description, policy.Type, policy.Status, policy.Priority,
+			configJSON, rulesJSON, targetsJSON, actionsJSON, policy.CreatedAt, policy.UpdatedAt, policy.TenantID); err != nil {
+			return fmt.Errorf("failed to insert policy %s: %w", policy.Name, err)
+		}
+	}
+	for _, version := range versions {
+		changesJSON, _ := json.Marshal(version.Changes)
+		policyJSON, _ := json.Marshal(version.Policy)
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO policy_versions (policy_id, version, change_type, changed_by, changes, policy, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, version.PolicyID, version.Version, version.ChangeType, version.ChangedBy, changesJSON, policyJSON, version.CreatedAt); err != nil {
+			return fmt.Errorf("failed to insert version of policy %s: %w", version.PolicyID, err)
+		}
+	}
+	for _, policy := range policies {
+		r.announce(ctx, tx, ChangePolicy, policy.ID)
+	}
+	return tx.Commit()
+}
+
+// QueryPolicyIDs returns the IDs of a page of the policies matching q, in
+// order, and the number matching
+func (r *Repository) QueryPolicyIDs(ctx context.Context, q *models.ListQuery) ([]string, int, error) {
+	where, args := listFilter(columnFilter{"tenant_id", q.Tenant}, columnFilter{"status", q.Status}, columnFilter{"type", q.Type})
+	where += " AND deleted_at IS NULL"
+	page, err := listPage(q, models.PolicySortFields, "priority ASC, created_at DESC")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM policies `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM policies `+where+page, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, 0, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, total, rows.Err()
+}
+
+// columnFilter requires a column to equal a value, unless the value is empty
+type columnFilter struct {
+	column, value string
+}
+
+// listFilter builds the WHERE clause of a list query
+func listFilter(filters ...columnFilter) (string, []interface{}) {
+	where := "WHERE true"
+	var args []interface{}
+	for _, f := range filters {
+		if f.value != "" {
+			args = append(args, f.value)
+			where += fmt.Sprintf(" AND %s = $%d", f.column, len(args))
+		}
+	}
+	return where, args
+}
+
+// listPage builds the ORDER BY, LIMIT and OFFSET clauses of a list query.
+// Only the given columns can be sorted by; ties are broken by ID so pages
+// don't overlap.
+func listPage(q *models.ListQuery, sortColumns []string, defaultOrder string) (string, error) {
+	order := defaultOrder
+	if q.Sort != "" {
+		if !slices.Contains(sortColumns, q.Sort) {
+			return "", fmt.Errorf("cannot sort by %q", q.Sort)
+		}
+		order = q.Sort + " ASC"
+		if q.Desc {
+			order = q.Sort + " DESC"
+		}
+	}
+	page := " ORDER BY " + order + ", id"
+	if q.Limit > 0 {
+		page += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+	if q.Offset > 0 {
+		page += fmt.Sprintf(" OFFSET %d", q.Offset)
+	}
+	return page, nil
+}
+
+// tenantValue is the placeholder of a tenant_id value; rows written without
+// a tenant belong to the default one
+func tenantValue(n int) string {
+	return fmt.Sprintf("COALESCE(NULLIF($%d, ''), 'default')", n)
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Quota counter operations
+
+// IncrementQuotaCounter counts a request in the counter's window, starting a
+// new count when the window has rolled over, and sets counter.Count
+func (r *Repository) IncrementQuotaCounter(ctx context.Context, counter *models.QuotaCounter) error {
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO quota_counters (policy_id, user_id, period, window_start, count)
+		VALUES ($1, $2, $3, $4, 1)
+		ON CONFLICT (policy_id, user_id, period) DO UPDATE SET
+			count = CASE WHEN quota_counters.window_start = EXCLUDED.window_start THEN quota_counters.count + 1 ELSE 1 END,
+			window_start = EXCLUDED.window_start
+		RETURNING count
+	`, counter.PolicyID, counter.UserID, counter.Period, counter.WindowStart).Scan(&counter.Count)
+}
+
+func (r *Repository) ListQuotaCounters(ctx context.Context, userID string) ([]*models.QuotaCounter, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT policy_id, user_id, period, window_start, count
+		FROM quota_counters WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counters []*models.QuotaCounter
+	for rows.Next() {
+		var counter models.QuotaCounter
+		if err := rows.Scan(&counter.PolicyID, &counter.UserID, &counter.Period, &counter.WindowStart, &counter.Count); err != nil {
+			return nil, err
+		}
+		counters = append(counters, &counter)
+	}
+	return counters, rows.Err()
+}
+
+// Policy version operations
+
+// ListPolicyVersions returns the full version history of every policy, oldest first
+func (r *Repository) ListPolicyVersions(ctx context.Context) ([]models.PolicyVersion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT policy_id, version, change_type, changed_by, changes, policy, created_at
+		FROM policy_versions ORDER BY policy_id, version ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanPolicyVersions(rows)
+}
+
+// ListPolicyHistory returns the version history of one policy, oldest first
+func (r *Repository) ListPolicyHistory(ctx context.Context, policyID string) ([]models.PolicyVersion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT policy_id, version, change_type, changed_by, changes, policy, created_at
+		FROM policy_versions WHERE policy_id = $1 ORDER BY version ASC
+	`, policyID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPolicyVersions(rows)
+}
+
+func scanPolicyVersions(rows *sql.Rows) ([]models.PolicyVersion, error) {
+	defer rows.Close()
+
+	var versions []models.PolicyVersion
+	for rows.Next() {
+		var version models.PolicyVersion
+		var changedBy sql.NullString
+		var changesJSON, policyJSON []byte
+
+		if err := rows.Scan(&version.PolicyID, &version.Version, &version.ChangeType, &changedBy,
+			&changesJSON, &policyJSON, &version.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		version.ChangedBy = changedBy.String
+		json.Unmarshal(changesJSON, &version.Changes)
+		json.Unmarshal(policyJSON, &version.Policy)
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
 // SpendingLimit operations
 
+// CreateSpendingLimit stores a new spending limit. Its spend is charged by
+// RecordUsage, starting from the usage it covers in the current period.
 func (r *Repository) CreateSpendingLimit(ctx context.Context, limit *models.SpendingLimit) error {
 	limit.ID = uuid.New().String()
 	limit.CreatedAt = time.Now()
 	limit.UpdatedAt = time.Now()
+	limit.CurrentSpend = 0
+	limit.ResetAt = time.Time{}
 
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO spending_limits (id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO spending_limits (id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, `+tenantValue(11)+`)
 	`, limit.ID, limit.UserID, limit.LimitType, limit.LimitAmount, limit.CurrentSpend,
-		limit.Currency, limit.ResetAt, limit.AlertAt, limit.CreatedAt, limit.UpdatedAt)
+		limit.Currency, limit.ResetAt, limit.AlertAt, limit.CreatedAt, limit.UpdatedAt, limit.TenantID)
 	return err
 }
 
 func (r *Repository) GetSpendingLimit(ctx context.Context, id string) (*models.SpendingLimit, error) {
 	var limit models.SpendingLimit
 	err := r.db.QueryRowContext(ctx, `
-		SELECT id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at
+		SELECT id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at, tenant_id
 		FROM spending_limits WHERE id = $1
 	`, id).Scan(&limit.ID, &limit.UserID, &limit.LimitType, &limit.LimitAmount,
 		&limit.CurrentSpend, &limit.Currency, &limit.ResetAt, &limit.AlertAt,
-		&limit.CreatedAt, &limit.UpdatedAt)
+		&limit.CreatedAt, &limit.UpdatedAt, &limit.TenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -230,12 +625,40 @@ func (r *Repository) GetSpendingLimit(ctx context.Context, id string) (*models.S
 
 func (r *Repository) ListSpendingLimits(ctx context.Context) ([]*models.SpendingLimit, error) {
 	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at
+		SELECT id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at, tenant_id
 		FROM spending_limits ORDER BY created_at DESC
 	`)
 	if err != nil {
 		return nil, err
 	}
+	return scanSpendingLimits(rows)
+}
+
+// QuerySpendingLimits returns a page of the spending limits matching q and
+// the number matching
+func (r *Repository) QuerySpendingLimits(ctx context.Context, q *models.ListQuery) ([]*models.SpendingLimit, int, error) {
+	where, args := listFilter(columnFilter{"tenant_id", q.Tenant}, columnFilter{"user_id", q.UserID}, columnFilter{"limit_type", q.Type})
+	page, err := listPage(q, models.SpendingLimitSortFields, "created_at DESC")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM spending_limits `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at, tenant_id
+		FROM spending_limits `+where+page, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	limits, err := scanSpendingLimits(rows)
+	return limits, total, err
+}
+
+// scanSpendingLimits reads spending limit rows and closes them
+func scanSpendingLimits(rows *sql.Rows) ([]*models.SpendingLimit, error) {
 	defer rows.Close()
 
 	var limits []*models.SpendingLimit
@@ -243,7 +666,7 @@ func (r *Repository) ListSpendingLimits(ctx context.Context) ([]*models.Spending
 		var limit models.SpendingLimit
 		if err := rows.Scan(&limit.ID, &limit.UserID, &limit.LimitType, &limit.LimitAmount,
 			&limit.CurrentSpend, &limit.Currency, &limit.ResetAt, &limit.AlertAt,
-			&limit.CreatedAt, &limit.UpdatedAt); err != nil {
+			&limit.CreatedAt, &limit.UpdatedAt, &limit.TenantID); err != nil {
 			return nil, err
 		}
 		limits = append(limits, &limit)
@@ -251,91 +674,1089 @@ func (r *Repository) ListSpendingLimits(ctx context.Context) ([]*models.Spending
 	return limits, nil
 }
 
+// UpdateSpendingLimit changes a spending limit's settings. Its spend is left
+// to RecordUsage, so an update can't overwrite concurrent charges; the row is
+// locked as RecordUsage locks it, so a charge waits for the update and sees
+// the new settings. Changing what the limit covers ends its period, so the
+// next charge starts over.
 func (r *Repository) UpdateSpendingLimit(ctx context.Context, limit *models.SpendingLimit) error {
-	limit.UpdatedAt = time.Now()
-	result, err := r.db.ExecContext(ctx, `
-		UPDATE spending_limits SET user_id = $2, limit_type = $3, limit_amount = $4,
-		current_spend = $5, currency = $6, reset_at = $7, alert_at = $8, updated_at = $9
-		WHERE id = $1
-	`, limit.ID, limit.UserID, limit.LimitType, limit.LimitAmount, limit.CurrentSpend,
-		limit.Currency, limit.ResetAt, limit.AlertAt, limit.UpdatedAt)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
+	defer tx.Rollback()
+
+	var userID, limitType, currency string
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, limit_type, currency FROM spending_limits WHERE id = $1 FOR UPDATE
+	`, limit.ID).Scan(&userID, &limitType, &currency)
+	if err == sql.ErrNoRows {
 		return fmt.Errorf("no spending limit found with id: %s", limit.ID)
 	}
-	return nil
+	if err != nil {
+		return err
+	}
+
+	limit.UpdatedAt = time.Now()
+	if userID != limit.UserID || limitType != limit.LimitType || currency != limit.Currency {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE spending_limits SET user_id = $2, limit_type = $3, limit_amount = $4,
+			currency = $5, alert_at = $6, updated_at = $7, reset_at = $7
+			WHERE id = $1
+		`, limit.ID, limit.UserID, limit.LimitType, limit.LimitAmount,
+			limit.Currency, limit.AlertAt, limit.UpdatedAt)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE spending_limits SET limit_amount = $2, alert_at = $3, updated_at = $4
+			WHERE id = $1
+		`, limit.ID, limit.LimitAmount, limit.AlertAt, limit.UpdatedAt)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// AuditLog operations
+// Budget operations
 
-func (r *Repository) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
-	log.ID = uuid.New().String()
-	log.Timestamp = time.Now()
+const budgetColumns = `id, name, scope, target, period, limit_amount, current_spend, currency, alert_at, enforce, reset_at, created_at, updated_at, tenant_id`
 
-	detailsJSON, _ := json.Marshal(log.Details)
-	durationMs := int(log.Duration.Milliseconds())
+func scanBudget(row interface{ Scan(...interface{}) error }) (*models.Budget, error) {
+	var b models.Budget
+	if err := row.Scan(&b.ID, &b.Name, &b.Scope, &b.Target, &b.Period, &b.LimitAmount, &b.CurrentSpend,
+		&b.Currency, &b.AlertAt, &b.Enforce, &b.ResetAt, &b.CreatedAt, &b.UpdatedAt, &b.TenantID); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
 
+func (r *Repository) CreateBudget(ctx context.Context, b *models.Budget) error {
 	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO audit_logs (id, request_id, event_type, action, user_id, user_email, resource_type, resource_id, status, ip_address, user_agent, duration_ms, details, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-	`, log.ID, log.RequestID, log.EventType, log.Action, log.UserID, log.UserEmail,
-		log.ResourceType, log.ResourceID, log.Status, log.IPAddress, log.UserAgent,
-		durationMs, detailsJSON, log.Timestamp)
+		INSERT INTO budgets (`+budgetColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, `+tenantValue(14)+`)
+	`, b.ID, b.Name, b.Scope, b.Target, b.Period, b.LimitAmount, b.CurrentSpend,
+		b.Currency, b.AlertAt, b.Enforce, b.ResetAt, b.CreatedAt, b.UpdatedAt, b.TenantID)
 	return err
 }
 
-func (r *Repository) ListAuditLogs(ctx context.Context, limit int) ([]*models.AuditLog, error) {
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT id, request_id, event_type, action, user_id, user_email, resource_type, resource_id, status, ip_address, user_agent, duration_ms, details, created_at
-		FROM audit_logs ORDER BY created_at DESC LIMIT $1
-	`, limit)
+func (r *Repository) GetBudget(ctx context.Context, id string) (*models.Budget, error) {
+	return scanBudget(r.db.QueryRowContext(ctx, `SELECT `+budgetColumns+` FROM budgets WHERE id = $1`, id))
+}
+
+func (r *Repository) ListBudgets(ctx context.Context) ([]*models.Budget, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+budgetColumns+` FROM budgets ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var logs []*models.AuditLog
+	var budgets []*models.Budget
 	for rows.Next() {
-		var log models.AuditLog
-		var detailsJSON []byte
-		var durationMs int
-
-		if err := rows.Scan(&log.ID, &log.RequestID, &log.EventType, &log.Action, &log.UserID,
-			&log.UserEmail, &log.ResourceType, &log.ResourceID, &log.Status, &log.IPAddress,
-			&log.UserAgent, &durationMs, &detailsJSON, &log.Timestamp); err != nil {
+		b, err := scanBudget(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		log.Duration = time.Duration(durationMs) * time.Millisecond
-		json.Unmarshal(detailsJSON, &log.Details)
-		logs = append(logs, &log)
+		budgets = append(budgets, b)
 	}
-	return logs, nil
+	return budgets, rows.Err()
 }
 
-// Settings operations
-
-func (r *Repository) GetSetting(ctx context.Context, key string) (interface{}, error) {
-	var valueJSON []byte
-	err := r.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = $1`, key).Scan(&valueJSON)
+func (r *Repository) UpdateBudget(ctx context.Context, b *models.Budget) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE budgets SET name = $2, scope = $3, target = $4, period = $5, limit_amount = $6,
+		current_spend = $7, currency = $8, alert_at = $9, enforce = $10, reset_at = $11, updated_at = $12
+		WHERE id = $1
+	`, b.ID, b.Name, b.Scope, b.Target, b.Period, b.LimitAmount, b.CurrentSpend,
+		b.Currency, b.AlertAt, b.Enforce, b.ResetAt, b.UpdatedAt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	var value interface{}
-	json.Unmarshal(valueJSON, &value)
-	return value, nil
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no budget found with id: %s", b.ID)
+	}
+	return nil
 }
 
-func (r *Repository) SetSetting(ctx context.Context, key string, value interface{}) error {
-	valueJSON, _ := json.Marshal(value)
-	_, err := r.db.ExecContext(ctx, `
-		INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, NOW())
-		ON CONFLICT (key) DO UPDATE SET value = $2, updated_at = NOW()
+func (r *Repository) DeleteBudget(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM budgets WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no budget found with id: %s", id)
+	}
+	return nil
+}
+
+// AddBudgetSpend adds to a budget's spend in a single statement, so
+// concurrent requests don't lose updates, and returns the new total
+func (r *Repository) AddBudgetSpend(ctx context.Context, id string, amount float64) (float64, error) {
+	var spend float64
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE budgets SET current_spend = current_spend + $2, updated_at = NOW()
+		WHERE id = $1 RETURNING current_spend
+	`, id, amount).Scan(&spend)
+	return spend, err
+}
+
+// Usage record operations
+
+const insertUsageRecord = `
+	INSERT INTO usage_records (id, request_id, user_id, project, team, provider, model,
+		prompt_tokens, completion_tokens, total_tokens, cost, currency, created_at, tenant_id)
+	VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10, $11, $12, $13, COALESCE(NULLIF($14, ''), 'default'))
+`
+
+// sumUsageCost totals the cost of a tenant's usage by a user since a time;
+// an empty user totals every user of the tenant
+const sumUsageCost = `
+	SELECT COALESCE(SUM(cost), 0)::float8 FROM usage_records
+	WHERE tenant_id = $1 AND ($2 = '' OR user_id = $2) AND created_at >= $3
+`
+
+func usageRecordArgs(u *models.UsageRecord) []interface{} {
+	return []interface{}{u.ID, u.RequestID, u.UserID, u.Project, u.Team, u.Provider, u.Model,
+		u.PromptTokens, u.CompletionTokens, u.TotalTokens, u.Cost, u.Currency, u.CreatedAt, u.TenantID}
+}
+
+func (r *Repository) CreateUsageRecord(ctx context.Context, u *models.UsageRecord) error {
+	_, err := r.db.ExecContext(ctx, insertUsageRecord, usageRecordArgs(u)...)
+	return err
+}
+
+// SpendCharge charges a usage record's cost to a spending limit
+type SpendCharge struct {
+	LimitID     string
+	TenantID    string    // the limit's tenant, whose usage it covers
+	UserID      string    // whose usage the limit covers; "" for everyone
+	Rate        float64   // converts USD to the limit's currency
+	PeriodStart time.Time // the limit's current period
+	PeriodEnd   time.Time
+}
+
+// RecordUsage inserts a usage record and charges its cost to spending limits
+// in one transaction. Each limit's row is locked while its spend is updated,
+// so concurrent requests don't lose updates. A limit whose stored period has
+// ended starts over from the usage it covers in the current one, this record
+// included. It returns each limit's spend after the charge, in its currency;
+// limits deleted meanwhile are skipped with a spend of 0.
+func (r *Repository) RecordUsage(ctx context.Context, u *models.UsageRecord, charges []SpendCharge) ([]float64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, insertUsageRecord, usageRecordArgs(u)...); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	spends := make([]float64, len(charges))
+	for i, charge := range charges {
+		var resetAt sql.NullTime
+		err := tx.QueryRowContext(ctx, `SELECT reset_at FROM spending_limits WHERE id = $1 FOR UPDATE`, charge.LimitID).Scan(&resetAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if resetAt.Valid && now.Before(resetAt.Time) {
+			err = tx.QueryRowContext(ctx, `
+				UPDATE spending_limits SET current_spend = current_spend + $2, updated_at = NOW()
+				WHERE id = $1 RETURNING current_spend::float8
+			`, charge.LimitID, u.Cost*charge.Rate).Scan(&spends[i])
+		} else {
+			var usage float64
+			if err := tx.QueryRowContext(ctx, sumUsageCost, charge.TenantID, charge.UserID, charge.PeriodStart).Scan(&usage); err != nil {
+				return nil, err
+			}
+			spends[i] = usage * charge.Rate
+			_, err = tx.ExecContext(ctx, `
+				UPDATE spending_limits SET current_spend = $2, reset_at = $3, updated_at = NOW() WHERE id = $1
+			`, charge.LimitID, spends[i], charge.PeriodEnd)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to charge spending limit %s: %w", charge.LimitID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return spends, nil
+}
+
+// usageFilter builds the WHERE clause and arguments for a usage query
+func usageFilter(q *models.UsageQuery) (string, []interface{}) {
+	where := "WHERE true"
+	var args []interface{}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if q.TenantID != "" {
+		add("tenant_id = $%d", q.TenantID)
+	}
+	if q.UserID != "" {
+		add("user_id = $%d", q.UserID)
+	}
+	if q.Project != "" {
+		add("project = $%d", q.Project)
+	}
+	if q.Model != "" {
+		add("model = $%d", q.Model)
+	}
+	if q.RequestID != "" {
+		add("request_id = $%d", q.RequestID)
+	}
+	if q.StartTime != nil {
+		add("created_at >= $%d", *q.StartTime)
+	}
+	if q.EndTime != nil {
+		add("created_at < $%d", *q.EndTime)
+	}
+	return where, args
+}
+
+// ListUsageRecords returns a page of usage records, newest first, and the
+// totals over every record matching the query
+func (r *Repository) ListUsageRecords(ctx context.Context, q *models.UsageQuery) ([]*models.UsageRecord, *models.UsageSummary, error) {
+	where, args := usageFilter(q)
+
+	var summary models.UsageSummary
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)::float8
+		FROM usage_records `+where, args...).Scan(&summary.Count, &summary.PromptTokens, &summary.CompletionTokens, &summary.TotalCost); err != nil {
+		return nil, nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	args = append(args, limit, q.Offset)
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, request_id, user_id, COALESCE(project, ''), COALESCE(team, ''), COALESCE(provider, ''), model,
+			prompt_tokens, completion_tokens, total_tokens, cost, currency, created_at, tenant_id
+		FROM usage_records %s ORDER BY created_at DESC LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var records []*models.UsageRecord
+	for rows.Next() {
+		var u models.UsageRecord
+		if err := rows.Scan(&u.ID, &u.RequestID, &u.UserID, &u.Project, &u.Team, &u.Provider, &u.Model,
+			&u.PromptTokens, &u.CompletionTokens, &u.TotalTokens, &u.Cost, &u.Currency, &u.CreatedAt, &u.TenantID); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, &u)
+	}
+	return records, &summary, rows.Err()
+}
+
+// SumUsageCost totals the cost of a tenant's usage by a user since a time;
+// an empty userID totals every user of the tenant
+func (r *Repository) SumUsageCost(ctx context.Context, tenantID, userID string, since time.Time) (float64, error) {
+	var total float64
+	err := r.db.QueryRowContext(ctx, sumUsageCost, tenantID, userID, since).Scan(&total)
+	return total, err
+}
+
+// ChargebackUsage sums a tenant's usage records in [start, end) by project,
+// team and model. An empty tenant sums every tenant's records.
+func (r *Repository) ChargebackUsage(ctx context.Context, tenantID string, start, end time.Time) ([]models.ChargebackLine, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT COALESCE(project, ''), COALESCE(team, ''), model,
+			COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)::float8
+		FROM usage_records
+		WHERE ($1 = '' OR tenant_id = $1) AND created_at >= $2 AND created_at < $3
+		GROUP BY 1, 2, 3
+	`, tenantID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []models.ChargebackLine
+	for rows.Next() {
+		var l models.ChargebackLine
+		if err := rows.Scan(&l.Project, &l.Team, &l.Model, &l.RequestCount,
+			&l.PromptTokens, &l.CompletionTokens, &l.TotalCost); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// DailySpend sums a tenant's usage records per UTC day in [start, end),
+// oldest first. Days without spend are omitted; an empty tenant sums every
+// tenant's records.
+func (r *Repository) DailySpend(ctx context.Context, tenantID string, start, end time.Time) ([]models.DailySpend, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COALESCE(SUM(cost), 0)::float8
+		FROM usage_records
+		WHERE ($1 = '' OR tenant_id = $1) AND created_at >= $2 AND created_at < $3
+		GROUP BY day ORDER BY day
+	`, tenantID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []models.DailySpend
+	for rows.Next() {
+		var d models.DailySpend
+		if err := rows.Scan(&d.Date, &d.Cost); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// Model price operations
+
+func (r *Repository) ListModelPrices(ctx context.Context) ([]*models.ModelPrice, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT model, COALESCE(provider, ''), input_per_million, output_per_million, currency, source, updated_at
+		FROM model_prices ORDER BY model
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []*models.ModelPrice
+	for rows.Next() {
+		p := models.ModelPrice{Unit: "1M"}
+		if err := rows.Scan(&p.Model, &p.Provider, &p.InputPrice, &p.OutputPrice, &p.Currency, &p.Source, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		prices = append(prices, &p)
+	}
+	return prices, rows.Err()
+}
+
+// UpsertModelPrice stores a price per million tokens
+func (r *Repository) UpsertModelPrice(ctx context.Context, p *models.ModelPrice) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO model_prices (model, provider, input_per_million, output_per_million, currency, source, updated_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7)
+		ON CONFLICT (model) DO UPDATE SET provider = NULLIF($2, ''), input_per_million = $3,
+			output_per_million = $4, currency = $5, source = $6, updated_at = $7
+	`, p.Model, p.Provider, p.InputPrice, p.OutputPrice, p.Currency, p.Source, p.UpdatedAt)
+	return err
+}
+
+func (r *Repository) DeleteModelPrice(ctx context.Context, model string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM model_prices WHERE model = $1`, model)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no price override found for model: %s", model)
+	}
+	return nil
+}
+
+// Feature flag operations
+
+func (r *Repository) ListFeatureFlags(ctx context.Context) ([]*models.FeatureFlag, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT key, enabled, rollout, tenants, COALESCE(updated_by, ''), updated_at
+		FROM feature_flags ORDER BY key
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []*models.FeatureFlag
+	for rows.Next() {
+		var f models.FeatureFlag
+		if err := rows.Scan(&f.Key, &f.Enabled, &f.Rollout, pq.Array(&f.Tenants), &f.UpdatedBy, &f.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, &f)
+	}
+	return flags, rows.Err()
+}
+
+func (r *Repository) UpsertFeatureFlag(ctx context.Context, f *models.FeatureFlag) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO feature_flags (key, enabled, rollout, tenants, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET enabled = $2, rollout = $3, tenants = $4, updated_by = $5, updated_at = $6
+	`, f.Key, f.Enabled, f.Rollout, pq.Array(f.Tenants), f.UpdatedBy, f.UpdatedAt)
+	return err
+}
+
+func (r *Repository) DeleteFeatureFlag(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM feature_flags WHERE key = $1`, key)
+	return err
+}
+
+// APIKey operations
+
+func (r *Repository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, name, key_prefix, key_hash, user_id, role, permissions, created_by, created_at, expires_at, allowed_cidrs, tenant_id, llm_profile)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, `+tenantValue(12)+`, $13)
+	`, key.ID, key.Name, key.Prefix, key.KeyHash, key.UserID, key.Role,
+		pq.Array(key.Permissions), key.CreatedBy, key.CreatedAt, key.ExpiresAt, pq.Array(key.AllowedCIDRs), key.TenantID, key.LLMProfile)
+	return err
+}
+
+const apiKeyColumns = `id, name, key_prefix, key_hash, user_id, role, permissions, created_by, created_at, expires_at, last_used_at, revoked_at, allowed_cidrs, tenant_id, llm_profile`
+
+func scanAPIKey(scan func(dest ...interface{}) error) (*models.APIKey, error) {
+	var key models.APIKey
+	var userID, role, createdBy sql.NullString
+	if err := scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &userID, &role,
+		pq.Array(&key.Permissions), &createdBy, &key.CreatedAt, &key.ExpiresAt,
+		&key.LastUsedAt, &key.RevokedAt, pq.Array(&key.AllowedCIDRs), &key.TenantID, &key.LLMProfile); err != nil {
+		return nil, err
+	}
+	key.UserID = userID.String
+	key.Role = models.UserRole(role.String)
+	key.CreatedBy = createdBy.String
+	return &key, nil
+}
+
+func (r *Repository) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, hash)
+	return scanAPIKey(row.Scan)
+}
+
+func (r *Repository) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (r *Repository) RevokeAPIKey(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no active API key found with id: %s", id)
+	}
+	return nil
+}
+
+func (r *Repository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, usedAt)
+	return err
+}
+
+// IP block operations
+
+func (r *Repository) CreateIPBlock(ctx context.Context, b *models.IPBlock) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO ip_blocks (id, cidr, reason, automatic, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, b.ID, b.CIDR, b.Reason, b.Automatic, b.CreatedBy, b.CreatedAt, b.ExpiresAt)
+	return err
+}
+
+// ListIPBlocks returns the blocks that haven't expired
+func (r *Repository) ListIPBlocks(ctx context.Context) ([]*models.IPBlock, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, cidr, COALESCE(reason, ''), automatic, COALESCE(created_by, ''), created_at, expires_at
+		FROM ip_blocks WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*models.IPBlock
+	for rows.Next() {
+		var b models.IPBlock
+		if err := rows.Scan(&b.ID, &b.CIDR, &b.Reason, &b.Automatic, &b.CreatedBy, &b.CreatedAt, &b.ExpiresAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, &b)
+	}
+	return blocks, rows.Err()
+}
+
+func (r *Repository) DeleteIPBlock(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM ip_blocks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no IP block found with id: %s", id)
+	}
+	return nil
+}
+
+// DeleteExpiredIPBlocks removes the blocks that have run out
+func (r *Repository) DeleteExpiredIPBlocks(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM ip_blocks WHERE expires_at <= NOW()`)
+	return err
+}
+
+// Detection suppression operations
+
+func (r *Repository) CreateDetectionSuppression(ctx context.Context, s *models.DetectionSuppression) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO detection_suppressions (id, pattern_id, users, groups, reason, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, s.ID, s.PatternID, pq.Array(s.Users), pq.Array(s.Groups), s.Reason, s.CreatedBy, s.CreatedAt, s.ExpiresAt)
+	if err == nil {
+		r.announce(ctx, nil, ChangeSuppressions, s.ID)
+	}
+	return err
+}
+
+// ListDetectionSuppressions returns the suppressions that haven't expired
+func (r *Repository) ListDetectionSuppressions(ctx context.Context) ([]*models.DetectionSuppression, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, pattern_id, users, groups, COALESCE(reason, ''), COALESCE(created_by, ''), created_at, expires_at
+		FROM detection_suppressions WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppressions []*models.DetectionSuppression
+	for rows.Next() {
+		var s models.DetectionSuppression
+		if err := rows.Scan(&s.ID, &s.PatternID, pq.Array(&s.Users), pq.Array(&s.Groups), &s.Reason, &s.CreatedBy, &s.CreatedAt, &s.ExpiresAt); err != nil {
+			return nil, err
+		}
+		suppressions = append(suppressions, &s)
+	}
+	return suppressions, rows.Err()
+}
+
+func (r *Repository) DeleteDetectionSuppression(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM detection_suppressions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no detection suppression found with id: %s", id)
+	}
+	r.announce(ctx, nil, ChangeSuppressions, id)
+	return nil
+}
+
+// DeleteExpiredDetectionSuppressions removes the suppressions that have run
+// out
+func (r *Repository) DeleteExpiredDetectionSuppressions(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM detection_suppressions WHERE expires_at <= NOW()`)
+	return err
+}
+
+// Session operations. Sessions are looked up by the hash of their ID, so the
+// table never holds a usable session cookie.
+
+func (r *Repository) CreateSession(ctx context.Context, tokenHash string, session *models.Session, idleExpiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO sessions (token_hash, user_id, email, name, role, tenant_id, expires_at, idle_expires_at, last_activity_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, tokenHash, session.UserID, session.Email, session.Name, session.Role, session.TenantID,
+		session.ExpiresAt, nullTime(idleExpiresAt), session.LastActiveAt, session.CreatedAt)
+	return err
+}
+
+func (r *Repository) GetSession(ctx context.Context, tokenHash string) (*models.Session, error) {
+	return scanSession(r.db.QueryRowContext(ctx, `
+		SELECT user_id, email, name, role, tenant_id, expires_at, last_activity_at, created_at
+		FROM sessions
+		WHERE token_hash = $1 AND expires_at > NOW() AND (idle_expires_at IS NULL OR idle_expires_at > NOW())
+	`, tokenHash))
+}
+
+// TakeSession deletes a live session and returns it. Of concurrent calls,
+// only the one whose DELETE removed the row gets it; the others get
+// sql.ErrNoRows.
+func (r *Repository) TakeSession(ctx context.Context, tokenHash string) (*models.Session, error) {
+	return scanSession(r.db.QueryRowContext(ctx, `
+		DELETE FROM sessions
+		WHERE token_hash = $1 AND expires_at > NOW() AND (idle_expires_at IS NULL OR idle_expires_at > NOW())
+		RETURNING user_id, email, name, role, tenant_id, expires_at, last_activity_at, created_at
+	`, tokenHash))
+}
+
+func scanSession(row *sql.Row) (*models.Session, error) {
+	var session models.Session
+	var email, name, role, tenantID sql.NullString
+	if err := row.Scan(&session.UserID, &email, &name, &role, &tenantID, &session.ExpiresAt, &session.LastActiveAt, &session.CreatedAt); err != nil {
+		return nil, err
+	}
+	session.Email = email.String
+	session.Name = name.String
+	session.Role = role.String
+	session.TenantID = tenantID.String
+	return &session, nil
+}
+
+func (r *Repository) TouchSession(ctx context.Context, tokenHash string, activeAt, idleExpiresAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sessions SET last_activity_at = $2, idle_expires_at = $3 WHERE token_hash = $1
+	`, tokenHash, activeAt, nullTime(idleExpiresAt))
+	return err
+}
+
+func (r *Repository) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = $1`, tokenHash)
+	return err
+}
+
+func (r *Repository) DeleteUserSessions(ctx context.Context, userID string) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
+
+func (r *Repository) DeleteExpiredSessions(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `
+		DELETE FROM sessions WHERE expires_at <= NOW() OR idle_expires_at <= NOW()
+	`)
+	return err
+}
+
+// Import operations
+
+// ImportResult reports how many rows of each entity an import inserted or skipped
+type ImportResult struct {
+	Imported map[string]int `json:"imported"`
+	Skipped  map[string]int `json:"skipped"`
+	// Conflicts lists the skipped users whose email belongs to another user
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// ImportState inserts users, policies, and spending limits in a single transaction,
+// preserving their IDs. Existing rows are left untouched unless overwrite is set.
+// Users whose email is taken by a user with another ID are skipped either way.
+func (r *Repository) ImportState(ctx context.Context, users []*models.User, policies []*models.Policy, limits []*models.SpendingLimit, overwrite bool) (*ImportResult, error) {
+	result := &ImportResult{
+		Imported: map[string]int{"users": 0, "policies": 0, "spending_limits": 0},
+		Skipped:  map[string]int{"users": 0, "policies": 0, "spending_limits": 0},
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	record := func(kind string, res sql.Result) {
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Imported[kind]++
+		} else {
+			result.Skipped[kind]++
+		}
+	}
+
+	userConflict := "ON CONFLICT DO NOTHING"
+	if overwrite {
+		userConflict = `ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email, name = EXCLUDED.name,
+			role = EXCLUDED.role, status = EXCLUDED.status, groups = EXCLUDED.groups,
+			metadata = EXCLUDED.metadata, updated_at = NOW(), deleted_at = EXCLUDED.deleted_at,
+			deleted_by = EXCLUDED.deleted_by, delete_reason = EXCLUDED.delete_reason`
+	}
+	for _, user := range users {
+		var owner string
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1 AND id::text <> $2`, user.Email, user.ID).Scan(&owner)
+		if err == nil {
+			result.Skipped["users"]++
+			result.Conflicts = append(result.Conflicts, fmt.Sprintf("user %s: email already belongs to user %s", user.ID, owner))
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to import user %s: %w", user.ID, err)
+		}
+
+		metadataJSON, _ := json.Marshal(user.Metadata)
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO users (id, email, name, role, status, groups, metadata, created_at, tenant_id, deleted_at, deleted_by, delete_reason)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, `+tenantValue(9)+`, $10, NULLIF($11, ''), NULLIF($12, '')) `+userConflict,
+			user.ID, user.Email, user.Name, user.Role, user.Status, pq.Array(user.Groups), metadataJSON, user.CreatedAt, user.TenantID,
+			user.DeletedAt, user.DeletedBy, user.DeleteReason)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import user %s: %w", user.ID, err)
+		}
+		record("users", res)
+	}
+
+	policyConflict := "ON CONFLICT (id) DO NOTHING"
+	if overwrite {
+		policyConflict = `ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, description = EXCLUDED.description,
+			type = EXCLUDED.type, status = EXCLUDED.status, priority = EXCLUDED.priority,
+			config = EXCLUDED.config, rules = EXCLUDED.rules, targets = EXCLUDED.targets,
+			actions = EXCLUDED.actions, updated_at = EXCLUDED.updated_at, deleted_at = EXCLUDED.deleted_at,
+			deleted_by = EXCLUDED.deleted_by, delete_reason = EXCLUDED.delete_reason`
+	}
+	for _, policy := range policies {
+		configJSON, _ := json.Marshal(policy.Config)
+		rulesJSON, _ := json.Marshal(policy.Rules)
+		targetsJSON, _ := json.Marshal(policy.Targets)
+		actionsJSON, _ := json.Marshal(policy.Actions)
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO policies (id, name, description, type, status, priority, config, rules, targets, actions, created_at, updated_at, tenant_id,
+			deleted_at, deleted_by, delete_reason)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, `+tenantValue(13)+`, $14, NULLIF($15, ''), NULLIF($16, '')) `+policyConflict,
+			policy.ID, policy.Name, policy.Description, policy.Type, policy.Status, policy.Priority,
+			configJSON, rulesJSON, targetsJSON, actionsJSON, policy.CreatedAt, policy.UpdatedAt, policy.TenantID,
+			policy.DeletedAt, policy.DeletedBy, policy.DeleteReason)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import policy %s: %w", policy.ID, err)
+		}
+		record("policies", res)
+	}
+
+	limitConflict := "ON CONFLICT (id) DO NOTHING"
+	if overwrite {
+		limitConflict = `ON CONFLICT (id) DO UPDATE SET user_id = EXCLUDED.user_id, limit_type = EXCLUDED.limit_type,
+			limit_amount = EXCLUDED.limit_amount, current_spend = EXCLUDED.current_spend,
+			currency = EXCLUDED.currency, reset_at = EXCLUDED.reset_at, alert_at = EXCLUDED.alert_at,
+			updated_at = EXCLUDED.updated_at`
+	}
+	for _, limit := range limits {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO spending_limits (id, user_id, limit_type, limit_amount, current_spend, currency, reset_at, alert_at, created_at, updated_at, tenant_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, `+tenantValue(11)+`) `+limitConflict,
+			limit.ID, limit.UserID, limit.LimitType, limit.LimitAmount, limit.CurrentSpend,
+			limit.Currency, limit.ResetAt, limit.AlertAt, limit.CreatedAt, limit.UpdatedAt, limit.TenantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import spending limit %s: %w", limit.ID, err)
+		}
+		record("spending_limits", res)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AuditLog operations
+
+func (r *Repository) CreateAuditLog(ctx context.Context, log *models.AuditLog) error {
+	if log.ID == "" {
+		log.ID = uuid.New().String()
+	}
+	if log.Timestamp.IsZero() {
+		log.Timestamp = time.Now()
+	}
+
+	detailsJSON, _ := json.Marshal(log.Details)
+	durationMs := int(log.Duration.Milliseconds())
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO audit_logs (id, request_id, event_type, action, user_id, user_email, resource_type, resource_id, status, ip_address, user_agent, duration_ms, details, created_at, tenant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, `+tenantValue(15)+`)
+	`, log.ID, log.RequestID, log.EventType, log.Action, log.UserID, log.UserEmail,
+		log.ResourceType, log.ResourceID, log.Status, log.IPAddress, log.UserAgent,
+		durationMs, detailsJSON, log.Timestamp, log.TenantID)
+	return err
+}
+
+func (r *Repository) ListAuditLogs(ctx context.Context, limit int) ([]*models.AuditLog, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, request_id, event_type, action, user_id, user_email, resource_type, resource_id, status, ip_address, user_agent, duration_ms, details, created_at, tenant_id
+		FROM audit_logs ORDER BY created_at DESC LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditLogs(rows)
+}
+
+// ListAuditLogsBefore returns audit logs created before the cutoff, oldest first
+func (r *Repository) ListAuditLogsBefore(ctx context.Context, before time.Time, limit, offset int) ([]*models.AuditLog, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, request_id, event_type, action, user_id, user_email, resource_type, resource_id, status, ip_address, user_agent, duration_ms, details, created_at, tenant_id
+		FROM audit_logs WHERE created_at < $1 ORDER BY created_at, id LIMIT $2 OFFSET $3
+	`, before, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanAuditLogs(rows)
+}
+
+// DeleteAuditLogs deletes audit logs by ID
+func (r *Repository) DeleteAuditLogs(ctx context.Context, ids []string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result, err := r.db.ExecContext(ctx, `DELETE FROM audit_logs WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountDetectionFeedback counts the latest label of each detection given
+// feedback in the audit log, by pattern. An empty tenant counts every
+// tenant's feedback.
+func (r *Repository) CountDetectionFeedback(ctx context.Context, tenantID string) ([]models.PatternPrecision, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT pattern_id,
+			COUNT(*) FILTER (WHERE label = $2),
+			COUNT(*) FILTER (WHERE label = $3)
+		FROM (
+			SELECT DISTINCT ON (tenant_id, resource_id) details->>'pattern_id' AS pattern_id, details->>'label' AS label
+			FROM audit_logs
+			WHERE action = 'detection_feedback' AND event_type = 'user_action' AND ($1 = '' OR tenant_id = $1)
+			ORDER BY tenant_id, resource_id, created_at DESC
+		) latest
+		GROUP BY pattern_id
+	`, tenantID, models.FeedbackTruePositive, models.FeedbackFalsePositive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.PatternPrecision
+	for rows.Next() {
+		var c models.PatternPrecision
+		var patternID sql.NullString
+		if err := rows.Scan(&patternID, &c.TruePositives, &c.FalsePositives); err != nil {
+			return nil, err
+		}
+		c.PatternID = patternID.String
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// dashboardBreakdowns are the key each dashboard breakdown groups audit logs
+// by and the logs it includes
+var dashboardBreakdowns = map[string]struct{ key, where string }{
+	models.BreakdownAll:       {key: "''", where: "TRUE"},
+	models.BreakdownInjection: {key: "''", where: "event_type = 'security_alert'"},
+	models.BreakdownPII:       {key: "''", where: detailNumber("pii_count") + " > 0"},
+	models.BreakdownLevel:     {key: "details->>'threat_level'", where: "event_type = 'security_alert' AND jsonb_typeof(details->'threat_level') = 'string'"},
+	models.BreakdownThreat:    {key: "details->>'threat_type'", where: "event_type = 'security_alert' AND jsonb_typeof(details->'threat_type') = 'string'"},
+	models.BreakdownModel:     {key: "details->>'model'", where: "jsonb_typeof(details->'model') = 'string'"},
+	models.BreakdownProvider:  {key: "details->>'provider'", where: "jsonb_typeof(details->'provider') = 'string'"},
+	models.BreakdownUser:      {key: "user_id", where: "COALESCE(user_id, '') <> '' AND jsonb_typeof(details->'cost') = 'number'"},
+	models.BreakdownHour:      {key: `to_char(date_trunc('hour', created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:00:00"Z"')`, where: "TRUE"},
+	models.BreakdownDay:       {key: `to_char(date_trunc('day', created_at AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"00:00:00"Z"')`, where: "TRUE"},
+}
+
+// detailNumber selects a numeric detail of an audit log, or NULL when it is
+// missing or not a number
+func detailNumber(key string) string {
+	return fmt.Sprintf("CASE WHEN jsonb_typeof(details->'%[1]s') = 'number' THEN (details->>'%[1]s')::float8 END", key)
+}
+
+// DashboardGroups aggregates a tenant's audit logs created between start
+// and end that pass filter by one of the dashboard breakdowns. An empty
+// tenant aggregates every tenant's logs.
+func (r *Repository) DashboardGroups(ctx context.Context, tenantID string, start, end time.Time, breakdown string, filter models.MetricsFilter) ([]models.MetricsGroup, error) {
+	b, ok := dashboardBreakdowns[breakdown]
+	if !ok {
+		return nil, fmt.Errorf("unknown dashboard breakdown %q", breakdown)
+	}
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %[1]s AS key,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'blocked'),
+			COUNT(DISTINCT NULLIF(user_id, '')),
+			COALESCE(SUM(TRUNC(%[3]s)), 0)::bigint,
+			COALESCE(SUM(TRUNC(%[4]s)), 0)::bigint,
+			COALESCE(SUM(TRUNC(%[5]s)), 0)::bigint,
+			COALESCE(SUM(%[6]s), 0)::float8,
+			COALESCE(SUM(TRUNC(%[7]s)) FILTER (WHERE %[7]s > 0), 0)::bigint
+		FROM audit_logs
+		WHERE ($1 = '' OR tenant_id = $1) AND created_at >= $2 AND created_at < $3 AND %[2]s
+			AND ($4::text[] IS NULL OR user_id = ANY($4))
+			AND ($5 = '' OR details->>'model' = $5)
+			AND ($6 = '' OR details->>'provider' = $6)
+		GROUP BY key
+	`, b.key, b.where, detailNumber("prompt_tokens"), detailNumber("completion_tokens"),
+		detailNumber("total_tokens"), detailNumber("cost"), detailNumber("pii_count")),
+		tenantID, start, end, pq.Array(filter.UserIDs), filter.Model, filter.Provider)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.MetricsGroup
+	for rows.Next() {
+		var g models.MetricsGroup
+		if err := rows.Scan(&g.Key, &g.Count, &g.Blocked, &g.Users, &g.PromptTokens, &g.CompletionTokens,
+			&g.TotalTokens, &g.Cost, &g.PIIDetections); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// Policy metric operations
+
+// IncrementPolicyMetrics adds to the counts of policies in the UTC hour
+// starting at hour, in one transaction so a replayed write counts once
+func (r *Repository) IncrementPolicyMetrics(ctx context.Context, tenantID string, hour time.Time, counts []models.PolicyMetric) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range counts {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO policy_metrics (tenant_id, policy_id, hour, policy_name, trigger_count, block_count, warn_count)
+			VALUES (`+tenantValue(1)+`, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (tenant_id, policy_id, hour) DO UPDATE SET
+				policy_name = EXCLUDED.policy_name,
+				trigger_count = policy_metrics.trigger_count + EXCLUDED.trigger_count,
+				block_count = policy_metrics.block_count + EXCLUDED.block_count,
+				warn_count = policy_metrics.warn_count + EXCLUDED.warn_count
+		`, tenantID, c.PolicyID, hour, c.PolicyName, c.TriggerCount, c.BlockCount, c.WarnCount); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TopPolicyMetrics returns the counts of the policies that triggered most
+// often in the hours between start and end, at most limit. An empty tenant
+// counts every tenant's policies.
+func (r *Repository) TopPolicyMetrics(ctx context.Context, tenantID string, start, end time.Time, limit int) ([]models.PolicyMetric, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT policy_id, COALESCE((array_agg(policy_name ORDER BY hour DESC))[1], ''),
+			SUM(trigger_count)::bigint, SUM(block_count)::bigint, SUM(warn_count)::bigint
+		FROM policy_metrics
+		WHERE ($1 = '' OR tenant_id = $1) AND hour > $2::timestamptz - interval '1 hour' AND hour < $3
+		GROUP BY policy_id
+		ORDER BY 3 DESC, policy_id
+		LIMIT $4
+	`, tenantID, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.PolicyMetric
+	for rows.Next() {
+		var m models.PolicyMetric
+		if err := rows.Scan(&m.PolicyID, &m.PolicyName, &m.TriggerCount, &m.BlockCount, &m.WarnCount); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, rows.Err()
+}
+
+// PolicyMetricTimeline returns the counts of a policy in the hours between
+// start and end, summed by hour or day. Buckets without triggers are left
+// out.
+func (r *Repository) PolicyMetricTimeline(ctx context.Context, tenantID, policyID string, start, end time.Time, granularity string) ([]models.PolicyMetricBucket, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT to_char(date_trunc($5, hour AT TIME ZONE 'UTC'), 'YYYY-MM-DD"T"HH24:00:00"Z"') AS bucket,
+			SUM(trigger_count)::bigint, SUM(block_count)::bigint, SUM(warn_count)::bigint
+		FROM policy_metrics
+		WHERE ($1 = '' OR tenant_id = $1) AND policy_id = $2 AND hour > $3::timestamptz - interval '1 hour' AND hour < $4
+		GROUP BY bucket ORDER BY bucket
+	`, tenantID, policyID, start, end, granularity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []models.PolicyMetricBucket
+	for rows.Next() {
+		var b models.PolicyMetricBucket
+		var key string
+		if err := rows.Scan(&key, &b.TriggerCount, &b.BlockCount, &b.WarnCount); err != nil {
+			return nil, err
+		}
+		if b.Start, err = time.Parse(time.RFC3339, key); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+func scanAuditLogs(rows *sql.Rows) ([]*models.AuditLog, error) {
+	defer rows.Close()
+
+	var logs []*models.AuditLog
+	for rows.Next() {
+		var log models.AuditLog
+		var detailsJSON []byte
+		var durationMs int
+
+		if err := rows.Scan(&log.ID, &log.RequestID, &log.EventType, &log.Action, &log.UserID,
+			&log.UserEmail, &log.ResourceType, &log.ResourceID, &log.Status, &log.IPAddress,
+			&log.UserAgent, &durationMs, &detailsJSON, &log.Timestamp, &log.TenantID); err != nil {
+			return nil, err
+		}
+
+		log.Duration = time.Duration(durationMs) * time.Millisecond
+		json.Unmarshal(detailsJSON, &log.Details)
+		logs = append(logs, &log)
+	}
+	return logs, nil
+}
+
+// Settings operations
+
+func (r *Repository) GetSetting(ctx context.Context, key string) (interface{}, error) {
+	var valueJSON []byte
+	err := r.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = $1`, key).Scan(&valueJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	json.Unmarshal(valueJSON, &value)
+	return value, nil
+}
+
+func (r *Repository) SetSetting(ctx context.Context, key string, value interface{}) error {
+	valueJSON, _ := json.Marshal(value)
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (key) DO UPDATE SET value = $2, updated_at = NOW()
 	`, key, valueJSON)
+	if err == nil {
+		r.announce(ctx, nil, ChangeSettings, key)
+	}
 	return err
 }
 
@@ -359,3 +1780,370 @@ func (r *Repository) GetAllSettings(ctx context.Context) (map[string]interface{}
 	}
 	return settings, nil
 }
+
+// ActionDelivery operations
+
+// SaveActionDelivery inserts a delivery or updates its status after an attempt
+func (r *Repository) SaveActionDelivery(ctx context.Context, d *models.ActionDelivery) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO action_deliveries (id, policy_id, policy_name, channel, target, request_id, user_id,
+			status, attempts, response_code, last_error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, attempts = EXCLUDED.attempts, response_code = EXCLUDED.response_code,
+			last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at
+	`, d.ID, d.PolicyID, d.PolicyName, d.Channel, d.Target, d.RequestID, d.UserID,
+		d.Status, d.Attempts, d.ResponseCode, d.LastError, d.CreatedAt, d.UpdatedAt)
+	return err
+}
+
+// ListActionDeliveries returns the newest deliveries, optionally filtered by policy and status
+func (r *Repository) ListActionDeliveries(ctx context.Context, policyID, status string, limit int) ([]*models.ActionDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, policy_id, COALESCE(policy_name, ''), channel, target, COALESCE(request_id, ''), COALESCE(user_id, ''),
+			status, attempts, COALESCE(response_code, 0), COALESCE(last_error, ''), created_at, updated_at
+		FROM action_deliveries
+		WHERE ($1 = '' OR policy_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC LIMIT $3
+	`, policyID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.ActionDelivery
+	for rows.Next() {
+		var d models.ActionDelivery
+		if err := rows.Scan(&d.ID, &d.PolicyID, &d.PolicyName, &d.Channel, &d.Target, &d.RequestID, &d.UserID,
+			&d.Status, &d.Attempts, &d.ResponseCode, &d.LastError, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
+
+// CapturedContent operations
+
+func (r *Repository) CreateCapturedContent(ctx context.Context, content *models.CapturedContent) error {
+	content.ID = uuid.New().String()
+	if content.CreatedAt.IsZero() {
+		content.CreatedAt = time.Now()
+	}
+
+	messagesJSON, _ := json.Marshal(content.Messages)
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO captured_content (id, request_id, user_id, model, policy_id, messages, response, redaction_count, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, content.ID, content.RequestID, content.UserID, content.Model, content.PolicyID,
+		messagesJSON, content.Response, content.RedactionCount, content.CreatedAt, content.ExpiresAt)
+	return err
+}
+
+func (r *Repository) GetCapturedContent(ctx context.Context, id string) (*models.CapturedContent, error) {
+	var content models.CapturedContent
+	var messagesJSON []byte
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, request_id, user_id, model, policy_id, messages, response, redaction_count, created_at, expires_at
+		FROM captured_content WHERE (id::text = $1 OR request_id = $1) AND expires_at > NOW()
+	`, id).Scan(&content.ID, &content.RequestID, &content.UserID, &content.Model, &content.PolicyID,
+		&messagesJSON, &content.Response, &content.RedactionCount, &content.CreatedAt, &content.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(messagesJSON, &content.Messages)
+	return &content, nil
+}
+
+func (r *Repository) ListCapturedContent(ctx context.Context, userID string, limit int) ([]*models.CapturedContent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, request_id, user_id, model, policy_id, messages, response, redaction_count, created_at, expires_at
+		FROM captured_content
+		WHERE expires_at > NOW() AND ($1 = '' OR user_id = $1)
+		ORDER BY created_at DESC LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []*models.CapturedContent
+	for rows.Next() {
+		var content models.CapturedContent
+		var messagesJSON []byte
+
+		if err := rows.Scan(&content.ID, &content.RequestID, &content.UserID, &content.Model, &content.PolicyID,
+			&messagesJSON, &content.Response, &content.RedactionCount, &content.CreatedAt, &content.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		json.Unmarshal(messagesJSON, &content.Messages)
+		contents = append(contents, &content)
+	}
+	return contents, nil
+}
+
+// ListCapturedContentSince returns unexpired captures created at or after
+// since, newest first
+func (r *Repository) ListCapturedContentSince(ctx context.Context, since time.Time, limit int) ([]*models.CapturedContent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, request_id, user_id, model, policy_id, messages, response, redaction_count, created_at, expires_at
+		FROM captured_content
+		WHERE expires_at > NOW() AND created_at >= $1
+		ORDER BY created_at DESC LIMIT $2
+	`, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contents []*models.CapturedContent
+	for rows.Next() {
+		var content models.CapturedContent
+		var messagesJSON []byte
+
+		if err := rows.Scan(&content.ID, &content.RequestID, &content.UserID, &content.Model, &content.PolicyID,
+			&messagesJSON, &content.Response, &content.RedactionCount, &content.CreatedAt, &content.ExpiresAt); err != nil {
+			return nil, err
+		}
+
+		json.Unmarshal(messagesJSON, &content.Messages)
+		contents = append(contents, &content)
+	}
+	return contents, rows.Err()
+}
+
+func (r *Repository) DeleteExpiredCapturedContent(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM captured_content WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Job operations
+
+const jobColumns = `id, type, status, params, result, COALESCE(error, ''), progress, total, cancel_requested,
+	COALESCE(created_by, ''), created_at, started_at, updated_at, completed_at`
+
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
+	var job models.Job
+	var params, result []byte
+	var startedAt, completedAt sql.NullTime
+	if err := row.Scan(&job.ID, &job.Type, &job.Status, &params, &result, &job.Error, &job.Progress, &job.Total,
+		&job.CancelRequested, &job.CreatedBy, &job.CreatedAt, &startedAt, &job.UpdatedAt, &completedAt); err != nil {
+		return nil, err
+	}
+	job.Params = params
+	job.Result = result
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
+
+// CreateJob queues a job. An exclusive job is only queued if no other job of
+// its type is pending or running; created reports whether it was.
+func (r *Repository) CreateJob(ctx context.Context, job *models.Job, exclusive bool) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO jobs (id, type, status, params, created_by, created_at, updated_at)
+		SELECT $1, $2, $3, $4, $5, $6, $6
+		WHERE NOT $7 OR NOT EXISTS (SELECT 1 FROM jobs WHERE type = $2 AND status IN ('pending', 'running'))
+	`, job.ID, job.Type, job.Status, []byte(job.Params), job.CreatedBy, job.CreatedAt, exclusive)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *Repository) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	return scanJob(r.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+}
+
+// ListJobs returns the newest jobs, optionally filtered by type and status
+func (r *Repository) ListJobs(ctx context.Context, jobType, status string, limit int) ([]*models.Job, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE ($1 = '' OR type = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC LIMIT $3
+	`, jobType, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimJob marks the oldest pending job of one of the given types as running
+// and returns it, or nil if there is none. Concurrent workers, in this
+// instance or another, never claim the same job.
+func (r *Repository) ClaimJob(ctx context.Context, types []string) (*models.Job, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, `
+		UPDATE jobs SET status = 'running', started_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs WHERE status = 'pending' AND type = ANY($1)
+			ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, pq.Array(types)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// UpdateJobProgress records a running job's progress, which also serves as
+// its heartbeat, and reports whether it has been asked to cancel
+func (r *Repository) UpdateJobProgress(ctx context.Context, id string, progress, total int) (bool, error) {
+	var cancelRequested bool
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE jobs SET progress = $2, total = $3, updated_at = NOW()
+		WHERE id = $1 RETURNING cancel_requested
+	`, id, progress, total).Scan(&cancelRequested)
+	return cancelRequested, err
+}
+
+// FinishJob records a job's outcome
+func (r *Repository) FinishJob(ctx context.Context, job *models.Job) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE jobs SET status = $2, result = $3, error = $4, progress = $5, total = $6,
+			updated_at = $7, completed_at = $7
+		WHERE id = $1
+	`, job.ID, job.Status, []byte(job.Result), job.Error, job.Progress, job.Total, job.CompletedAt)
+	return err
+}
+
+// CancelJob cancels a pending job outright and asks a running one to stop.
+// It returns sql.ErrNoRows if the job doesn't exist or has already finished.
+func (r *Repository) CancelJob(ctx context.Context, id string) (*models.Job, error) {
+	return scanJob(r.db.QueryRowContext(ctx, `
+		UPDATE jobs SET
+			cancel_requested = true,
+			status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE status END,
+			completed_at = CASE WHEN status = 'pending' THEN NOW() ELSE completed_at END,
+			updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'running')
+		RETURNING `+jobColumns, id))
+}
+
+// FailStaleJobs fails running jobs whose worker hasn't reported since before,
+// typically because its instance stopped
+func (r *Repository) FailStaleJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE jobs SET status = 'failed', error = 'worker stopped responding', completed_at = NOW(), updated_at = NOW()
+		WHERE status = 'running' AND updated_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteFinishedJobs removes jobs that finished before the cutoff
+func (r *Repository) DeleteFinishedJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM jobs WHERE status IN ('completed', 'failed', 'cancelled') AND completed_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Tenant operations
+
+const tenantColumns = `id, name, COALESCE(description, ''), status, created_at, updated_at`
+
+func scanTenant(row interface{ Scan(...any) error }) (*models.Tenant, error) {
+	var t models.Tenant
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &t.Status, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *Repository) CreateTenant(ctx context.Context, t *models.Tenant) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO tenants (id, name, description, status, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+	`, t.ID, t.Name, t.Description, t.Status, t.CreatedAt, t.UpdatedAt)
+	return err
+}
+
+func (r *Repository) GetTenant(ctx context.Context, id string) (*models.Tenant, error) {
+	return scanTenant(r.db.QueryRowContext(ctx, `SELECT `+tenantColumns+` FROM tenants WHERE id = $1`, id))
+}
+
+func (r *Repository) ListTenants(ctx context.Context) ([]*models.Tenant, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*models.Tenant
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, rows.Err()
+}
+
+func (r *Repository) UpdateTenant(ctx context.Context, t *models.Tenant) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE tenants SET name = $2, description = NULLIF($3, ''), status = $4, updated_at = $5
+		WHERE id = $1
+	`, t.ID, t.Name, t.Description, t.Status, t.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no tenant found with id: %s", t.ID)
+	}
+	return nil
+}
+
+func (r *Repository) DeleteTenant(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM tenants WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("no tenant found with id: %s", id)
+	}
+	return nil
+}
+
+// TenantInUse reports whether any user, policy, spending limit, budget or
+// unrevoked API key belongs to the tenant
+func (r *Repository) TenantInUse(ctx context.Context, id string) (bool, error) {
+	var used bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE tenant_id = $1)
+			OR EXISTS (SELECT 1 FROM policies WHERE tenant_id = $1)
+			OR EXISTS (SELECT 1 FROM spending_limits WHERE tenant_id = $1)
+			OR EXISTS (SELECT 1 FROM budgets WHERE tenant_id = $1)
+			OR EXISTS (SELECT 1 FROM api_keys WHERE tenant_id = $1 AND revoked_at IS NULL)
+	`, id).Scan(&used)
+	return used, err
+}
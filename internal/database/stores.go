@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// PolicyStore persists policies and their version history. Lookups of a
+// policy that doesn't exist return sql.ErrNoRows.
+type PolicyStore interface {
+	GetPolicy(ctx context.Context, id string) (*models.Policy, error)
+	ListPolicies(ctx context.Context) ([]*models.Policy, error)
+	SavePolicyVersions(ctx context.Context, policy *models.Policy, versions []models.PolicyVersion) error
+	SavePolicyBatch(ctx context.Context, policies []*models.Policy, versions []models.PolicyVersion) error
+	ListPolicyVersions(ctx context.Context) ([]models.PolicyVersion, error)
+}
+
+// UserStore persists users and groups. Lookups of a user that doesn't exist
+// return sql.ErrNoRows.
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, id string) (*models.User, error)
+	ListUsers(ctx context.Context) ([]*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id string) error
+
+	CreateGroup(ctx context.Context, group *models.Group) error
+	ListGroups(ctx context.Context) ([]*models.Group, error)
+	UpdateGroup(ctx context.Context, group *models.Group) error
+	DeleteGroup(ctx context.Context, id string) error
+}
+
+// AuditStore persists audit logs
+type AuditStore interface {
+	CreateAuditLog(ctx context.Context, log *models.AuditLog) error
+	// ListAuditLogs returns the latest logs, newest first
+	ListAuditLogs(ctx context.Context, limit int) ([]*models.AuditLog, error)
+	// ListAuditLogsBefore returns logs created before the cutoff, oldest first
+	ListAuditLogsBefore(ctx context.Context, before time.Time, limit, offset int) ([]*models.AuditLog, error)
+	DeleteAuditLogs(ctx context.Context, ids []string) (int64, error)
+}
+
+// SettingsStore persists settings as JSON values. Settings that were never
+// saved return sql.ErrNoRows.
+type SettingsStore interface {
+	GetSetting(ctx context.Context, key string) (interface{}, error)
+	SetSetting(ctx context.Context, key string, value interface{}) error
+	GetAllSettings(ctx context.Context) (map[string]interface{}, error)
+
+	// Degraded reports whether the store was unreachable on the last attempt
+	Degraded() bool
+	// Unavailable reports whether err means the store can't be reached
+	Unavailable(err error) bool
+}
+
+// Stores holds the store of each domain. Its zero value has none, for a
+// deployment without a database.
+type Stores struct {
+	Policies PolicyStore
+	Users    UserStore
+	Audit    AuditStore
+	Settings SettingsStore
+}
+
+// Stores returns the repository as the store of every domain
+func (r *Repository) Stores() Stores {
+	return Stores{Policies: r, Users: r, Audit: r, Settings: r}
+}
+
+var (
+	_ PolicyStore   = (*Repository)(nil)
+	_ UserStore     = (*Repository)(nil)
+	_ AuditStore    = (*Repository)(nil)
+	_ SettingsStore = (*Repository)(nil)
+)
@@ -1,10 +1,14 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // AuditLog represents an audit log entry
 type AuditLog struct {
 	ID            string                 `json:"id"`
+	TenantID      string                 `json:"tenant_id,omitempty"`
 	Timestamp     time.Time              `json:"timestamp"`
 	EventType     AuditEventType         `json:"event_type"`
 	Action        string                 `json:"action"`
@@ -31,6 +35,7 @@ const (
 	EventTypeSystemEvent   AuditEventType = "system_event"
 	EventTypeSecurityAlert AuditEventType = "security_alert"
 	EventTypeSpendingAlert AuditEventType = "spending_alert"
+	EventTypeAnomaly       AuditEventType = "anomaly"
 )
 
 // AuditStatus defines the status of an audit event
@@ -43,14 +48,124 @@ const (
 	AuditStatusWarning AuditStatus = "warning"
 )
 
+// CapturedContent holds the PII-redacted prompt and response of a captured request
+type CapturedContent struct {
+	ID             string    `json:"id"`
+	RequestID      string    `json:"request_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	Model          string    `json:"model,omitempty"`
+	PolicyID       string    `json:"policy_id,omitempty"`
+	Messages       []Message `json:"messages"`
+	Response       string    `json:"response,omitempty"`
+	RedactionCount int       `json:"redaction_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// Job statuses
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a long-running control plane operation, such as a re-evaluation,
+// queued for a background worker. Params and Result are specific to the type.
+type Job struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Status          string          `json:"status"`
+	Params          json.RawMessage `json:"params,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	Progress        int             `json:"progress"` // items done
+	Total           int             `json:"total"`    // items to do; 0 until known
+	CancelRequested bool            `json:"cancel_requested"`
+	CreatedBy       string          `json:"created_by,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	StartedAt       *time.Time      `json:"started_at,omitempty"`
+	UpdatedAt       time.Time       `json:"updated_at"` // last progress or heartbeat
+	CompletedAt     *time.Time      `json:"completed_at,omitempty"`
+}
+
+// Finished reports whether the job has stopped for good
+func (j *Job) Finished() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// JobRequest queues a job through the jobs API; Params depend on the type
+type JobRequest struct {
+	Type   string          `json:"type" binding:"required"`
+	Params json.RawMessage `json:"params"`
+}
+
+// JobFile is the result of a job that produces a file, such as an export. It
+// is downloaded as the file itself.
+type JobFile struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     string `json:"content"`
+	Rows        int    `json:"rows"`
+}
+
+// ReevaluationConfig is the detection configuration captured prompts are
+// re-scanned with; unset fields keep the running configuration
+type ReevaluationConfig struct {
+	InjectionPatterns []string `json:"injection_patterns,omitempty"` // custom patterns, used with the defaults
+	PIITypes          []string `json:"pii_types,omitempty"`
+}
+
+// ReevaluationJob re-scans captured prompts from the last Days days with a
+// candidate configuration and reports where it disagrees with the running one
+type ReevaluationJob struct {
+	ID          string              `json:"id"`
+	Status      string              `json:"status"`
+	Days        int                 `json:"days"`
+	Config      ReevaluationConfig  `json:"config"`
+	Progress    int                 `json:"progress"` // captures scanned so far
+	Total       int                 `json:"total"`
+	Summary     ReevaluationSummary `json:"summary"`
+	Changes     []ReevaluationItem  `json:"changes,omitempty"`
+	Error       string              `json:"error,omitempty"`
+	CreatedBy   string              `json:"created_by,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+}
+
+// ReevaluationSummary counts captures whose outcome changed
+type ReevaluationSummary struct {
+	Scanned                 int  `json:"scanned"`
+	Truncated               bool `json:"truncated"` // more captures matched than a job scans
+	InjectionNewlyCaught    int  `json:"injection_newly_caught"`
+	InjectionNoLongerCaught int  `json:"injection_no_longer_caught"`
+	PIINewlyCaught          int  `json:"pii_newly_caught"`
+	PIINoLongerCaught       int  `json:"pii_no_longer_caught"`
+}
+
+// ReevaluationItem is a capture the candidate configuration treats differently
+type ReevaluationItem struct {
+	CaptureID  string    `json:"capture_id"`
+	RequestID  string    `json:"request_id"`
+	UserID     string    `json:"user_id,omitempty"`
+	CapturedAt time.Time `json:"captured_at"`
+	Kind       string    `json:"kind"`   // injection or pii
+	Change     string    `json:"change"` // newly_caught or no_longer_caught
+	Before     string    `json:"before"` // threat level or PII types
+	After      string    `json:"after"`
+}
+
 // AuditQuery represents query parameters for audit logs
 type AuditQuery struct {
 	StartTime    *time.Time       `json:"start_time,omitempty"`
 	EndTime      *time.Time       `json:"end_time,omitempty"`
 	EventTypes   []AuditEventType `json:"event_types,omitempty"`
 	UserID       string           `json:"user_id,omitempty"`
+	RequestID    string           `json:"request_id,omitempty"`
 	ResourceType string           `json:"resource_type,omitempty"`
 	Status       AuditStatus      `json:"status,omitempty"`
+	TenantID     string           `json:"tenant_id,omitempty"`
 	Limit        int              `json:"limit,omitempty"`
 	Offset       int              `json:"offset,omitempty"`
 	SortBy       string           `json:"sort_by,omitempty"`
@@ -71,6 +186,99 @@ type AuditStats struct {
 	RequestsByHour  map[string]int64 `json:"requests_by_hour"`
 	EventsByType    map[string]int64 `json:"events_by_type"`
 	Period          string           `json:"period"`
+	Privacy         *StatsPrivacy    `json:"privacy,omitempty"`
+}
+
+// UsageRecord is the immutable record of one LLM call and what it cost
+type UsageRecord struct {
+	ID               string    `json:"id"`
+	RequestID        string    `json:"request_id"`
+	UserID           string    `json:"user_id"`
+	Project          string    `json:"project,omitempty"`
+	Team             string    `json:"team,omitempty"`
+	Provider         string    `json:"provider,omitempty"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Cost             float64   `json:"cost"`
+	Currency         string    `json:"currency"`
+	CreatedAt        time.Time `json:"created_at"`
+	TenantID         string    `json:"tenant_id,omitempty"`
+}
+
+// UsageQuery filters usage records
+type UsageQuery struct {
+	TenantID  string     `json:"tenant_id,omitempty"`
+	UserID    string     `json:"user_id,omitempty"`
+	Project   string     `json:"project,omitempty"`
+	Model     string     `json:"model,omitempty"`
+	RequestID string     `json:"request_id,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Limit     int        `json:"limit,omitempty"`
+	Offset    int        `json:"offset,omitempty"`
+}
+
+// UsageSummary totals the usage records matching a query
+type UsageSummary struct {
+	Count            int64   `json:"count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalCost        float64 `json:"total_cost"`
+}
+
+// ChargebackReport is spend over a date range broken down for cost
+// allocation
+type ChargebackReport struct {
+	Start      time.Time        `json:"start"`
+	End        time.Time        `json:"end"`
+	GroupBy    []string         `json:"group_by"`
+	Currency   string           `json:"currency"`
+	Lines      []ChargebackLine `json:"lines"`
+	TotalCost  float64          `json:"total_cost"`
+	TotalCount int64            `json:"total_requests"`
+}
+
+// ChargebackLine is the spend of one project, team and model combination.
+// Dimensions not grouped by are left empty.
+type ChargebackLine struct {
+	Project          string  `json:"project,omitempty"`
+	Team             string  `json:"team,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	RequestCount     int64   `json:"request_count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalCost        float64 `json:"total_cost"`
+}
+
+// SpendForecast projects the current month's spend from month-to-date
+// spend and recent daily history
+type SpendForecast struct {
+	Month       string       `json:"month"` // YYYY-MM, UTC
+	MonthToDate float64      `json:"month_to_date"`
+	Projected   float64      `json:"projected"`
+	Method      string       `json:"method"` // linear or seasonal
+	DaysElapsed float64      `json:"days_elapsed"`
+	DaysInMonth int          `json:"days_in_month"`
+	Daily       []DailySpend `json:"daily"` // history and month-to-date, oldest first
+	Currency    string       `json:"currency"`
+	GeneratedAt time.Time    `json:"generated_at"`
+}
+
+// DailySpend is the total cost of requests on one UTC day
+type DailySpend struct {
+	Date string  `json:"date"` // YYYY-MM-DD
+	Cost float64 `json:"cost"`
+}
+
+// StatsPrivacy describes how aggregate statistics were protected: groups
+// covering fewer than MinGroupSize users are omitted and values carry
+// Laplace noise when Epsilon is set
+type StatsPrivacy struct {
+	MinGroupSize     int     `json:"min_group_size"`
+	Epsilon          float64 `json:"epsilon,omitempty"`
+	SuppressedGroups int     `json:"suppressed_groups"`
 }
 
 // UserStats represents usage statistics for a user
@@ -91,14 +299,86 @@ type ModelStats struct {
 	TotalCost    float64 `json:"total_cost"`
 }
 
-// DashboardMetrics represents metrics for the dashboard
+// DashboardMetrics represents metrics for the dashboard. The "_24h" metrics
+// cover the range from Start to End, which is the last 24 hours by default;
+// changes compare it with the period of the same length before it.
 type DashboardMetrics struct {
+	Start        time.Time       `json:"start"`
+	End          time.Time       `json:"end"`
+	Granularity  string          `json:"granularity"`
 	Overview     OverviewMetrics `json:"overview"`
 	Security     SecurityMetrics `json:"security"`
 	Usage        UsageMetrics    `json:"usage"`
 	Spending     SpendingMetrics `json:"spending"`
+	Timeline     []MetricsBucket `json:"timeline"`
 	RecentAlerts []Alert         `json:"recent_alerts"`
 	TopPolicies  []PolicyMetric  `json:"top_policies"`
+	Privacy      *StatsPrivacy   `json:"privacy,omitempty"`
+}
+
+// DashboardQuery selects the range of dashboard metrics and the granularity
+// of their timeline. Zero values select the defaults.
+type DashboardQuery struct {
+	Start       time.Time
+	End         time.Time
+	Granularity string // BreakdownHour or BreakdownDay
+}
+
+// Breakdowns of dashboard metrics, each grouping audit log entries by a key
+const (
+	BreakdownAll       = "all"       // every entry, in one group
+	BreakdownInjection = "injection" // security alerts, in one group
+	BreakdownPII       = "pii"       // entries that found PII, in one group
+	BreakdownLevel     = "level"     // security alerts by threat level
+	BreakdownThreat    = "threat"    // security alerts by threat type
+	BreakdownModel     = "model"
+	BreakdownProvider  = "provider"
+	BreakdownUser      = "user" // entries with a cost, by user
+	BreakdownHour      = "hour" // by the UTC hour, as an RFC 3339 timestamp
+	BreakdownDay       = "day"  // by the UTC day, as an RFC 3339 timestamp
+)
+
+// MetricsGroup aggregates the audit log entries of one group of a dashboard
+// breakdown
+type MetricsGroup struct {
+	Key              string  `json:"key"`
+	Count            int64   `json:"count"`
+	Blocked          int64   `json:"blocked"`
+	Users            int     `json:"users"` // distinct users
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+	PIIDetections    int64   `json:"pii_detections"`
+}
+
+// MetricsFilter narrows the audit logs metrics are computed from. Empty
+// fields don't filter; neither does a nil UserIDs, while an empty one
+// matches no logs.
+type MetricsFilter struct {
+	UserIDs  []string
+	Model    string
+	Provider string
+}
+
+// Timeseries is the requests, blocks, tokens and cost of every hour or day
+// of a range
+type Timeseries struct {
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	Granularity string          `json:"granularity"`
+	Buckets     []MetricsBucket `json:"buckets"`
+	Currency    string          `json:"currency"`
+	Privacy     *StatsPrivacy   `json:"privacy,omitempty"`
+}
+
+// MetricsBucket is one hour or day of the dashboard timeline
+type MetricsBucket struct {
+	Start    time.Time `json:"start"`
+	Requests int64     `json:"requests"`
+	Blocked  int64     `json:"blocked"`
+	Tokens   int64     `json:"tokens"`
+	Cost     float64   `json:"cost"`
 }
 
 // OverviewMetrics represents high-level overview metrics
@@ -138,6 +418,7 @@ type SpendingMetrics struct {
 	SpendByUser     map[string]float64 `json:"spend_by_user"`
 	SpendByModel    map[string]float64 `json:"spend_by_model"`
 	ProjectedSpend  float64            `json:"projected_spend_month"`
+	Currency        string             `json:"currency"`
 }
 
 // Alert represents a system alert
@@ -149,12 +430,16 @@ type Alert struct {
 	Message   string     `json:"message"`
 	UserID    string     `json:"user_id,omitempty"`
 	PolicyID  string     `json:"policy_id,omitempty"`
+	TenantID  string     `json:"tenant_id,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	AckedAt   *time.Time `json:"acked_at,omitempty"`
 	AckedBy   string     `json:"acked_by,omitempty"`
+
+	Details map[string]interface{} `json:"details,omitempty"` // e.g. the baseline and observed values of an anomaly
 }
 
-// PolicyMetric represents metrics for a policy
+// PolicyMetric represents metrics for a policy: how often it matched a
+// request, and how often it blocked (denied or throttled) or warned
 type PolicyMetric struct {
 	PolicyID     string `json:"policy_id"`
 	PolicyName   string `json:"policy_name"`
@@ -162,3 +447,21 @@ type PolicyMetric struct {
 	BlockCount   int64  `json:"block_count"`
 	WarnCount    int64  `json:"warn_count"`
 }
+
+// PolicyMetricBucket counts the triggers of a policy in one hour or day
+type PolicyMetricBucket struct {
+	Start        time.Time `json:"start"`
+	TriggerCount int64     `json:"trigger_count"`
+	BlockCount   int64     `json:"block_count"`
+	WarnCount    int64     `json:"warn_count"`
+}
+
+// PolicyMetricsReport counts the triggers of a policy over a range, in
+// total and by hour or day
+type PolicyMetricsReport struct {
+	PolicyMetric
+	Start       time.Time            `json:"start"`
+	End         time.Time            `json:"end"`
+	Granularity string               `json:"granularity"`
+	Timeline    []PolicyMetricBucket `json:"timeline"`
+}
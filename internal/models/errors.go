@@ -0,0 +1,125 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ErrorCode identifies the reason a request failed, so clients can react to
+// it without parsing the message
+type ErrorCode string
+
+const (
+	// Generic codes, sent for the status when no specific code applies
+	ErrCodeInvalidRequest     ErrorCode = "INVALID_REQUEST"
+	ErrCodeUnauthorized       ErrorCode = "UNAUTHORIZED"
+	ErrCodeForbidden          ErrorCode = "FORBIDDEN"
+	ErrCodeNotFound           ErrorCode = "NOT_FOUND"
+	ErrCodeConflict           ErrorCode = "CONFLICT"
+	ErrCodeUnprocessable      ErrorCode = "UNPROCESSABLE_ENTITY"
+	ErrCodeRateLimitExceeded  ErrorCode = "RATE_LIMIT_EXCEEDED"
+	ErrCodeInternal           ErrorCode = "INTERNAL_ERROR"
+	ErrCodeServiceUnavailable ErrorCode = "SERVICE_UNAVAILABLE"
+
+	// Access
+	ErrCodeIPNotAllowed          ErrorCode = "IP_NOT_ALLOWED"
+	ErrCodeIPBlocked             ErrorCode = "IP_BLOCKED"
+	ErrCodeUserInactive          ErrorCode = "USER_INACTIVE"
+	ErrCodeGuardOptionsForbidden ErrorCode = "GUARD_OPTIONS_FORBIDDEN"
+	ErrCodeModelAccessDenied     ErrorCode = "MODEL_ACCESS_DENIED"
+	ErrCodePolicyDenied          ErrorCode = "POLICY_DENIED"
+
+	// Content
+	ErrCodePIIBlocked         ErrorCode = "PII_BLOCKED"
+	ErrCodeSecretsDetected    ErrorCode = "SECRETS_DETECTED"
+	ErrCodeLLMSettingsInvalid ErrorCode = "LLM_SETTINGS_INVALID"
+
+	// Limits
+	ErrCodeQuotaExceeded       ErrorCode = "QUOTA_EXCEEDED"
+	ErrCodeBudgetExhausted     ErrorCode = "BUDGET_EXHAUSTED"
+	ErrCodeConcurrencyExceeded ErrorCode = "CONCURRENCY_LIMIT_EXCEEDED"
+
+	// Provider
+	ErrCodeLLMUnavailable      ErrorCode = "LLM_UNAVAILABLE"
+	ErrCodeProviderUnavailable ErrorCode = "PROVIDER_UNAVAILABLE"
+	ErrCodeUpstreamTimeout     ErrorCode = "UPSTREAM_TIMEOUT"
+	ErrCodeUpstreamError       ErrorCode = "UPSTREAM_ERROR"
+)
+
+// ErrorCodeInfo documents an error code
+type ErrorCodeInfo struct {
+	Code        ErrorCode `json:"code"`
+	Status      int       `json:"status"`
+	Description string    `json:"description"`
+}
+
+// ErrorCatalog lists every code sent in ErrorResponse.Code with the status
+// it comes with
+var ErrorCatalog = []ErrorCodeInfo{
+	{ErrCodeInvalidRequest, http.StatusBadRequest, "The body is malformed or fails validation; fields lists each invalid field"},
+	{ErrCodeUnauthorized, http.StatusUnauthorized, "Credentials are missing, invalid or expired"},
+	{ErrCodeForbidden, http.StatusForbidden, "The caller lacks the permission or tenant the request needs"},
+	{ErrCodeNotFound, http.StatusNotFound, "The resource doesn't exist or belongs to another tenant"},
+	{ErrCodeConflict, http.StatusConflict, "The resource already exists or is still in use"},
+	{ErrCodeUnprocessable, http.StatusUnprocessableEntity, "The request is well-formed but can't be carried out"},
+	{ErrCodeRateLimitExceeded, http.StatusTooManyRequests, "The client sent more requests per minute than allowed"},
+	{ErrCodeInternal, http.StatusInternalServerError, "An unexpected error; retrying may help"},
+	{ErrCodeServiceUnavailable, http.StatusServiceUnavailable, "A dependency such as the database is unavailable or not configured"},
+	{ErrCodeIPNotAllowed, http.StatusForbidden, "The client address is outside the deployment's or API key's allowlist"},
+	{ErrCodeIPBlocked, http.StatusForbidden, "The client address is blocked; Retry-After is set while the block is temporary"},
+	{ErrCodeUserInactive, http.StatusForbidden, "The user is deactivated"},
+	{ErrCodeGuardOptionsForbidden, http.StatusForbidden, "guard_options turn off a check the caller may not turn off"},
+	{ErrCodeModelAccessDenied, http.StatusForbidden, "The user may not use the requested model"},
+	{ErrCodePolicyDenied, http.StatusForbidden, "A policy denied the request"},
+	{ErrCodePIIBlocked, http.StatusForbidden, "The messages contain a PII type whose action is block"},
+	{ErrCodeSecretsDetected, http.StatusForbidden, "The messages contain credentials or keys"},
+	{ErrCodeLLMSettingsInvalid, http.StatusUnprocessableEntity, "LLM settings failed validation against the provider; save with ?force=true to keep them anyway"},
+	{ErrCodeQuotaExceeded, http.StatusTooManyRequests, "The user's request quota is used up"},
+	{ErrCodeBudgetExhausted, http.StatusTooManyRequests, "A spending budget is used up"},
+	{ErrCodeConcurrencyExceeded, http.StatusTooManyRequests, "Too many requests of the user or API key are in flight"},
+	{ErrCodeLLMUnavailable, http.StatusServiceUnavailable, "No LLM provider is configured"},
+	{ErrCodeProviderUnavailable, http.StatusServiceUnavailable, "The provider's circuit is open; Retry-After says when it is probed again"},
+	{ErrCodeUpstreamTimeout, http.StatusGatewayTimeout, "The provider didn't answer in time"},
+	{ErrCodeUpstreamError, http.StatusBadGateway, "The provider returned an error"},
+}
+
+// ErrorCodes returns the codes of the catalog
+func ErrorCodes() []interface{} {
+	codes := make([]interface{}, len(ErrorCatalog))
+	for i, info := range ErrorCatalog {
+		codes[i] = info.Code
+	}
+	return codes
+}
+
+// ErrorCodeForStatus returns the generic code for an HTTP status, derived
+// from the status text for statuses without one (e.g. 504 GATEWAY_TIMEOUT)
+func ErrorCodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusUnprocessableEntity:
+		return ErrCodeUnprocessable
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimitExceeded
+	case http.StatusInternalServerError:
+		return ErrCodeInternal
+	case http.StatusServiceUnavailable:
+		return ErrCodeServiceUnavailable
+	}
+	return ErrorCode(strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_")))
+}
+
+// FieldError is a field of a request body that failed validation
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, e.g. messages[0].role
+	Message string `json:"message"`
+}
@@ -5,6 +5,7 @@ import "time"
 // Policy represents an AI governance policy
 type Policy struct {
 	ID          string            `json:"id"`
+	TenantID    string            `json:"tenant_id,omitempty"`
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	Type        PolicyType        `json:"type"`
@@ -15,13 +16,68 @@ type Policy struct {
 	Targets     PolicyTargets     `json:"targets"`
 	Actions     PolicyActions     `json:"actions"`
 	Metadata    map[string]string `json:"metadata,omitempty"`
+	Version     int               `json:"version"`
 	CreatedAt   time.Time         `json:"created_at"`
 	UpdatedAt   time.Time         `json:"updated_at"`
 	CreatedBy   string            `json:"created_by"`
+
+	Deletion
+}
+
+// Deletion records when, by whom and why an entry was soft-deleted. Deleted
+// entries are kept so they can be restored.
+type Deletion struct {
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy    string     `json:"deleted_by,omitempty"`
+	DeleteReason string     `json:"delete_reason,omitempty"`
+}
+
+// Deleted reports whether the entry is soft-deleted
+func (d Deletion) Deleted() bool {
+	return d.DeletedAt != nil
+}
+
+// PolicyVersion is an immutable snapshot of a policy after a change
+type PolicyVersion struct {
+	PolicyID   string            `json:"policy_id"`
+	Version    int               `json:"version"`
+	ChangeType PolicyChangeType  `json:"change_type"`
+	ChangedBy  string            `json:"changed_by,omitempty"`
+	Changes    []PolicyFieldDiff `json:"changes,omitempty"`
+	Policy     Policy            `json:"policy"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+// PolicyChangeType describes what produced a policy version
+type PolicyChangeType string
+
+const (
+	PolicyChangeCreate   PolicyChangeType = "create"
+	PolicyChangeUpdate   PolicyChangeType = "update"
+	PolicyChangeRollback PolicyChangeType = "rollback"
+	PolicyChangeDelete   PolicyChangeType = "delete"
+	PolicyChangeRestore  PolicyChangeType = "restore"
+)
+
+// PolicyFieldDiff is a single changed field between two policy versions,
+// addressed by a JSON path such as "rules[0].value" or "targets.users"
+type PolicyFieldDiff struct {
+	Path     string      `json:"path"`
+	OldValue interface{} `json:"old_value,omitempty"`
+	NewValue interface{} `json:"new_value,omitempty"`
 }
 
 // PolicyConfig holds type-specific configuration for policies
 type PolicyConfig struct {
+	// Observe evaluates the policy and logs what it would have done, without
+	// blocking or changing requests, to baseline it before enforcing it
+	Observe bool `json:"observe,omitempty"`
+
+	// RolloutPercent applies the policy to only this share of the users it
+	// targets, picked by a hash of the user ID so each user is consistently
+	// in or out; 0 applies it to all of them
+	RolloutPercent int `json:"rollout_percent,omitempty"`
+
 	// Spending Limit
 	DailyLimit   float64 `json:"daily_limit,omitempty"`
 	MonthlyLimit float64 `json:"monthly_limit,omitempty"`
@@ -30,13 +86,28 @@ type PolicyConfig struct {
 	// Rate Limit
 	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
 	RequestsPerHour   int `json:"requests_per_hour,omitempty"`
+	RequestsPerDay    int `json:"requests_per_day,omitempty"`
 	BurstLimit        int `json:"burst_limit,omitempty"`
 
 	// Content Filter
 	BlockedKeywords string `json:"blocked_keywords,omitempty"`
-	AllowedModels   string `json:"allowed_models,omitempty"`
 	MaxTokens       int    `json:"max_tokens,omitempty"`
 
+	// Injection; with a deny action, targeted users' requests are blocked
+	// from this threat level up (low, medium, high or critical), whatever
+	// the detector's own setting or the caller's block_threshold
+	BlockThreatLevel string `json:"block_threat_level,omitempty"`
+
+	// Model Access (comma-separated; a trailing * matches any suffix)
+	AllowedModels    string `json:"allowed_models,omitempty"`
+	DeniedModels     string `json:"denied_models,omitempty"`
+	AllowedProviders string `json:"allowed_providers,omitempty"`
+	DeniedProviders  string `json:"denied_providers,omitempty"`
+
+	// Tool Access (comma-separated function names; a trailing * matches any suffix)
+	AllowedTools string `json:"allowed_tools,omitempty"`
+	DeniedTools  string `json:"denied_tools,omitempty"`
+
 	// Access Control
 	AllowedRoles string `json:"allowed_roles,omitempty"`
 	AllowedUsers string `json:"allowed_users,omitempty"`
@@ -46,6 +117,39 @@ type PolicyConfig struct {
 	RequireAudit      bool   `json:"require_audit,omitempty"`
 	DataRetentionDays int    `json:"data_retention_days,omitempty"`
 	PIIHandling       string `json:"pii_handling,omitempty"`
+	CaptureContent    bool   `json:"capture_content,omitempty"` // store redacted prompts/responses
+
+	// Routing; routing policies send the requests their rules match to
+	// llm_profile and route_model
+	LLMProfile string `json:"llm_profile,omitempty"` // named LLM profile to use for targeted users
+	RouteModel string `json:"route_model,omitempty"` // model replacing the requested one
+
+	// System Prompt added to forwarded conversations; may use {{user_id}},
+	// {{user_name}}, {{user_email}}, {{groups}}, {{provider}}, {{model}} and {{date}}
+	SystemPrompt     string `json:"system_prompt,omitempty"`
+	SystemPromptMode string `json:"system_prompt_mode,omitempty"` // prepend (default) or merge into the caller's system message
+
+	// Context Management; conversations estimated at more than
+	// context_budget prompt tokens have their oldest turns dropped, or
+	// summarized with the model of summary_profile, before forwarding
+	ContextBudget   int    `json:"context_budget,omitempty"`
+	ContextStrategy string `json:"context_strategy,omitempty"` // trim (default) or summarize
+	SummaryProfile  string `json:"summary_profile,omitempty"`  // LLM profile writing summaries; the request's own without one
+
+	// Topic Restriction; the policy action (deny or warn) applies to
+	// conversations on a blocked topic or on none of the allowed ones
+	AllowedTopics  []Topic `json:"allowed_topics,omitempty"`
+	BlockedTopics  []Topic `json:"blocked_topics,omitempty"`
+	TopicThreshold float64 `json:"topic_threshold,omitempty"` // cosine similarity to an example that counts as a match (default 0.8)
+	CheckResponses bool    `json:"check_responses,omitempty"` // also check LLM responses
+}
+
+// Topic is a subject of conversation, recognized by keywords or, when
+// example phrases are given, by embedding similarity to them
+type Topic struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords,omitempty"` // whole words or phrases, case-insensitive
+	Examples []string `json:"examples,omitempty"` // phrases typical of the topic
 }
 
 // PolicyType defines the type of policy
@@ -57,6 +161,8 @@ const (
 	PolicyTypeContent    PolicyType = "content"
 	PolicyTypeAccess     PolicyType = "access"
 	PolicyTypeCompliance PolicyType = "compliance"
+	PolicyTypeTopic      PolicyType = "topic"
+	PolicyTypeRouting    PolicyType = "routing"
 )
 
 // PolicyStatus defines the status of a policy
@@ -70,13 +176,23 @@ const (
 
 // PolicyRule defines a single rule within a policy
 type PolicyRule struct {
-	ID        string        `json:"id"`
-	Field     string        `json:"field"`    // e.g., "user_id", "model", "token_count"
-	Operator  RuleOperator  `json:"operator"` // e.g., "equals", "greater_than"
-	Value     interface{}   `json:"value"`
-	Condition RuleCondition `json:"condition"` // AND, OR
+	ID         string        `json:"id"`
+	Type       RuleType      `json:"type,omitempty"` // defaults to a field comparison
+	Field      string        `json:"field"`          // e.g., "user_id", "model", "token_count"
+	Operator   RuleOperator  `json:"operator"`       // e.g., "equals", "greater_than"
+	Value      interface{}   `json:"value"`
+	Expression string        `json:"expression,omitempty"` // CEL expression for expression rules
+	Condition  RuleCondition `json:"condition"`            // AND, OR
 }
 
+// RuleType selects how a rule is evaluated
+type RuleType string
+
+const (
+	RuleTypeComparison RuleType = "comparison" // field/operator/value
+	RuleTypeExpression RuleType = "expression" // CEL, e.g. cost > 1.0 && (model.contains("gpt-4") || provider == "anthropic")
+)
+
 // RuleOperator defines comparison operators
 type RuleOperator string
 
@@ -117,6 +233,32 @@ type PolicyActions struct {
 	Message    string     `json:"message,omitempty"`
 }
 
+// DeliveryStatus is the state of a policy action delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending" // queued or waiting to retry
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed" // gave up after the last attempt
+)
+
+// ActionDelivery records a webhook or email sent because a policy triggered
+type ActionDelivery struct {
+	ID           string         `json:"id"`
+	PolicyID     string         `json:"policy_id"`
+	PolicyName   string         `json:"policy_name"`
+	Channel      string         `json:"channel"` // webhook, email
+	Target       string         `json:"target"`  // webhook URL or email address
+	RequestID    string         `json:"request_id,omitempty"`
+	UserID       string         `json:"user_id,omitempty"`
+	Status       DeliveryStatus `json:"status"`
+	Attempts     int            `json:"attempts"`
+	ResponseCode int            `json:"response_code,omitempty"`
+	LastError    string         `json:"last_error,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
 // ActionType defines the action to take
 type ActionType string
 
@@ -131,6 +273,7 @@ const (
 // SpendingLimit represents a spending limit policy
 type SpendingLimit struct {
 	ID           string    `json:"id"`
+	TenantID     string    `json:"tenant_id,omitempty"`
 	UserID       string    `json:"user_id,omitempty"`
 	GroupID      string    `json:"group_id,omitempty"`
 	LimitType    string    `json:"limit_type"` // daily, weekly, monthly
@@ -143,9 +286,85 @@ type SpendingLimit struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// Pricing sources, in order of precedence
+const (
+	PriceSourceManual  = "manual"  // set through the control API
+	PriceSourceFeed    = "feed"    // pulled from the pricing feed
+	PriceSourceDefault = "default" // built in
+)
+
+// ModelPrice is the token price of a model. Prices are stored per million
+// tokens; Unit says what InputPrice and OutputPrice are quoted per.
+type ModelPrice struct {
+	Model       string    `json:"model"`
+	Provider    string    `json:"provider,omitempty"`
+	InputPrice  float64   `json:"input_price"`
+	OutputPrice float64   `json:"output_price"`
+	Unit        string    `json:"unit"` // 1M or 1K tokens
+	Currency    string    `json:"currency"`
+	Source      string    `json:"source"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
+}
+
+// BudgetScope is what a budget's spend is attributed to
+type BudgetScope string
+
+const (
+	BudgetScopeGroup   BudgetScope = "group"   // requests by members of a group
+	BudgetScopeProject BudgetScope = "project" // requests tagged with a project in their metadata
+	BudgetScopeGlobal  BudgetScope = "global"  // every request
+)
+
+// Budget caps the combined spend of a group, a project or the whole
+// deployment, independently of the per-user spending limits of its members
+type Budget struct {
+	ID           string      `json:"id"`
+	TenantID     string      `json:"tenant_id,omitempty"`
+	Name         string      `json:"name"`
+	Scope        BudgetScope `json:"scope"`
+	Target       string      `json:"target"` // group name or project tag value; empty for global budgets
+	Period       string      `json:"period"` // daily, weekly, monthly
+	LimitAmount  float64     `json:"limit_amount"`
+	CurrentSpend float64     `json:"current_spend"`
+	Currency     string      `json:"currency"`
+	AlertAt      float64     `json:"alert_at"` // percentage to alert at
+	Enforce      bool        `json:"enforce"`  // block requests once the budget is spent
+	ResetAt      time.Time   `json:"reset_at"` // end of the current period
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// QuotaCounter is the number of requests a user has made in the current
+// window of a rate limit policy's quota
+type QuotaCounter struct {
+	PolicyID    string    `json:"policy_id"`
+	UserID      string    `json:"user_id"`
+	Period      string    `json:"period"` // minute, hour, day
+	WindowStart time.Time `json:"window_start"`
+	Count       int       `json:"count"`
+}
+
+// Tenant is an organization sharing the deployment. Its users, policies,
+// limits, budgets, API keys and audit log are invisible to other tenants.
+type Tenant struct {
+	ID          string    `json:"id"` // chosen at creation, e.g. "finance"
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"` // active or suspended
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Tenant statuses; the credentials of suspended tenants are refused
+const (
+	TenantStatusActive    = "active"
+	TenantStatusSuspended = "suspended"
+)
+
 // User represents a user in the system
 type User struct {
 	ID          string            `json:"id"`
+	TenantID    string            `json:"tenant_id,omitempty"`
 	Email       string            `json:"email"`
 	Name        string            `json:"name"`
 	Role        UserRole          `json:"role"`
@@ -154,6 +373,8 @@ type User struct {
 	Metadata    map[string]string `json:"metadata,omitempty"`
 	CreatedAt   time.Time         `json:"created_at"`
 	LastLoginAt *time.Time        `json:"last_login_at,omitempty"`
+
+	Deletion
 }
 
 // UserRole defines user roles with RBAC
@@ -166,9 +387,11 @@ const (
 	RoleViewer     UserRole = "viewer"      // Read-only access to dashboards and reports
 )
 
-// Group represents a group of users
+// Group represents a group of users. Members are the IDs of the users whose
+// groups include its name.
 type Group struct {
 	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	Members     []string  `json:"members"`
@@ -176,12 +399,119 @@ type Group struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ListQuery filters, sorts and pages a list of policies, users or spending
+// limits. Filters that don't apply to the resource listed are ignored.
+type ListQuery struct {
+	Status string // policies and users
+	Type   string // policy type or spending limit type
+	Role   string // users
+	UserID string // spending limits
+	Tenant string // set from the caller's tenant, not the query string
+	Sort   string // one of the resource's sort fields; empty keeps the default order
+	Desc   bool
+	Limit  int // 0 returns every match
+	Offset int
+}
+
+// Fields each list can be sorted by
+var (
+	PolicySortFields        = []string{"name", "type", "status", "priority", "created_at", "updated_at"}
+	UserSortFields          = []string{"email", "name", "role", "status", "created_at", "last_login_at"}
+	SpendingLimitSortFields = []string{"user_id", "limit_type", "limit_amount", "created_at", "updated_at"}
+)
+
 // PolicyEvaluation represents the result of evaluating a policy
 type PolicyEvaluation struct {
-	PolicyID    string     `json:"policy_id"`
-	PolicyName  string     `json:"policy_name"`
-	Matched     bool       `json:"matched"`
-	Action      ActionType `json:"action"`
-	Message     string     `json:"message,omitempty"`
-	EvaluatedAt time.Time  `json:"evaluated_at"`
+	PolicyID    string           `json:"policy_id"`
+	PolicyName  string           `json:"policy_name"`
+	Matched     bool             `json:"matched"`
+	Action      ActionType       `json:"action"`
+	Message     string           `json:"message,omitempty"`
+	Rollout     *RolloutDecision `json:"rollout,omitempty"` // set for policies rolled out to part of their users
+	EvaluatedAt time.Time        `json:"evaluated_at"`
+}
+
+// RolloutDecision says whether a user falls within a policy's rollout: the
+// policy applies when the user's bucket, from 0 to 99, is below its percent
+type RolloutDecision struct {
+	Percent  int  `json:"percent"`
+	Bucket   int  `json:"bucket"`
+	Included bool `json:"included"`
+}
+
+// APIKey is a long-lived credential for the control plane API. The plaintext
+// key is only returned once at creation; only its hash is stored.
+type APIKey struct {
+	ID          string   `json:"id"`
+	TenantID    string   `json:"tenant_id,omitempty"`
+	Name        string   `json:"name"`
+	Prefix      string   `json:"prefix"`
+	KeyHash     string   `json:"-"`
+	UserID      string   `json:"user_id,omitempty"`
+	Role        UserRole `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"` // overrides the role's permissions when set
+	LLMProfile  string   `json:"llm_profile,omitempty"` // LLM profile of data plane requests that don't name one
+	// AllowedCIDRs limits the addresses the key is accepted from, within the
+	// deployment's allowlist; empty accepts it from anywhere
+	AllowedCIDRs []string   `json:"allowed_cidrs,omitempty"`
+	CreatedBy    string     `json:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Session is a dashboard login session. Its ID is the secret held in the
+// session cookie, so shared stores key sessions by a hash of it.
+type Session struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	Email        string    `json:"email"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	TenantID     string    `json:"tenant_id,omitempty"`
+	AccessToken  string    `json:"-"`
+	RefreshToken string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"` // absolute expiry; activity doesn't extend it
+	LastActiveAt time.Time `json:"last_active_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// IPBlock refuses requests from an address or CIDR range. Blocks added
+// automatically after repeated offenses expire; manual ones may.
+type IPBlock struct {
+	ID        string     `json:"id"`
+	CIDR      string     `json:"cidr"`
+	Reason    string     `json:"reason,omitempty"`
+	Automatic bool       `json:"automatic"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// DetectionSuppression drops the injection detections of a pattern from the
+// reports of some users or groups, for patterns their legitimate prompts
+// match. Suppressions may expire.
+type DetectionSuppression struct {
+	ID        string     `json:"id"`
+	PatternID string     `json:"pattern_id"`
+	Users     []string   `json:"users,omitempty"`
+	Groups    []string   `json:"groups,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Hits      int64      `json:"hits"` // detections this instance dropped with it
+}
+
+// FeatureFlag gates a feature that is rolled out gradually. A flag that is
+// enabled applies to its tenants and to a stable percentage of other users.
+type FeatureFlag struct {
+	Key         string    `json:"key"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	Rollout     int       `json:"rollout"`           // percent of users, 0-100
+	Tenants     []string  `json:"tenants,omitempty"` // groups or projects always included
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero"`
 }
@@ -1,53 +1,405 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
 
 // GuardRequest represents an incoming request to be processed
 type GuardRequest struct {
 	RequestID   string            `json:"request_id"`
 	UserID      string            `json:"user_id,omitempty"` // Optional user ID for spending tracking
-	Messages    []Message         `json:"messages"`
+	Messages    []Message         `json:"messages" binding:"required,min=1,dive"`
 	Provider    string            `json:"provider,omitempty"` // openai, anthropic, google, bedrock, ollama, xai
 	Model       string            `json:"model,omitempty"`
-	APIKey      string            `json:"api_key,omitempty"`  // Optional per-request API key
-	BaseURL     string            `json:"base_url,omitempty"` // Optional custom base URL
-	MaxTokens   *int              `json:"max_tokens,omitempty"`
-	Temperature *float64          `json:"temperature,omitempty"`
+	APIKey      string            `json:"api_key,omitempty"`     // Optional per-request API key
+	BaseURL     string            `json:"base_url,omitempty"`    // Optional custom base URL
+	LLMProfile  string            `json:"llm_profile,omitempty"` // Optional named LLM profile (e.g. "cheap")
+	MaxTokens   *int              `json:"max_tokens,omitempty" binding:"omitempty,min=1"`
+	Temperature *float64          `json:"temperature,omitempty" binding:"omitempty,min=0,max=2"`
+	TimeoutMs   int               `json:"timeout_ms,omitempty"` // overrides the configured LLM call timeout
 	Stream      bool              `json:"stream,omitempty"`
 	Metadata    map[string]string `json:"metadata,omitempty"`
+	Tools       []Tool            `json:"tools,omitempty" binding:"dive"` // functions the model may call
+	ToolChoice  json.RawMessage   `json:"tool_choice,omitempty"`          // passed through: "auto", "none", "required" or a named function
+	Options     *GuardOptions     `json:"guard_options,omitempty"`
+
+	// ProviderOptions passes provider-specific parameters through, by
+	// provider, e.g. {"openai": {"seed": 7}}. Only those of the provider the
+	// request is sent to are used.
+	ProviderOptions map[string]map[string]interface{} `json:"provider_options,omitempty"`
+
+	// ResponseValidation asks for the response to be checked as JSON
+	ResponseValidation *ResponseValidation `json:"response_validation,omitempty"`
+
+	// ConversationID groups the requests of a multi-turn conversation, so
+	// injections split across turns can be caught
+	ConversationID string `json:"conversation_id,omitempty"`
+
+	// KeyProfile is the LLM profile of the caller's API key, used when the
+	// request doesn't name one
+	KeyProfile string `json:"-"`
+	// Route is the policy that picked the request's LLM profile or model,
+	// set when its client is chosen
+	Route *LLMRoute `json:"-"`
+	// ModelAlias is the alias the request's model was resolved from, set
+	// when its client is chosen
+	ModelAlias string `json:"-"`
+}
+
+// ResponseValidation is how a request's response is checked as JSON
+type ResponseValidation struct {
+	// Schema is a JSON Schema the response must match; without one it only
+	// has to be valid JSON
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Repair sends an invalid response back to the model once, with the
+	// errors found, asking for a corrected one
+	Repair bool `json:"repair,omitempty"`
+}
+
+// LLMRoute is where a policy sent a request
+type LLMRoute struct {
+	PolicyID   string `json:"policy_id"`
+	PolicyName string `json:"policy_name"`
+	Profile    string `json:"llm_profile,omitempty"`
+	Model      string `json:"model,omitempty"`
+}
+
+// ModelAlias is a stable model name that application teams send in place of
+// a concrete model, e.g. "default-chat" for gpt-4o-mini. Changing the model
+// it stands for switches every client at once.
+type ModelAlias struct {
+	Name        string    `json:"name"`
+	Model       string    `json:"model"`                 // concrete model requests are sent to
+	LLMProfile  string    `json:"llm_profile,omitempty"` // profile to send them through, e.g. for another provider
+	Description string    `json:"description,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ModelCapabilities is what a model accepts: the tokens it can take and
+// produce, and whether it takes images, tools and streaming. Entries apply
+// to models named like them or starting with their name and a dash.
+type ModelCapabilities struct {
+	Model           string `json:"model"`
+	ContextWindow   int    `json:"context_window,omitempty"`    // prompt and completion tokens together
+	MaxOutputTokens int    `json:"max_output_tokens,omitempty"` // completion tokens per call
+	Vision          bool   `json:"vision"`
+	Tools           bool   `json:"tools"`
+	Streaming       bool   `json:"streaming"`
+	Source          string `json:"source"` // config or builtin
+}
+
+// GuardOptions override the configured guard stages for one request. Only
+// API keys with the guard:override permission may set them.
+type GuardOptions struct {
+	InjectionDetection *bool  `json:"injection_detection,omitempty"` // false skips injection detection
+	PIIMasking         *bool  `json:"pii_masking,omitempty"`         // false forwards PII unmasked
+	PIIMode            string `json:"pii_mode,omitempty" binding:"omitempty,oneof=mask pseudonymize"`
+	BlockThreshold     string `json:"block_threshold,omitempty" binding:"omitempty,oneof=low medium high critical"` // lowest threat level blocked
 }
 
-// Message represents a chat message
+// DetectInjection reports whether injection detection runs
+func (o *GuardOptions) DetectInjection() bool {
+	return o == nil || o.InjectionDetection == nil || *o.InjectionDetection
+}
+
+// MaskPII reports whether PII is masked
+func (o *GuardOptions) MaskPII() bool {
+	return o == nil || o.PIIMasking == nil || *o.PIIMasking
+}
+
+// Threshold returns the block threshold set, or "" for the configured one
+func (o *GuardOptions) Threshold() string {
+	if o == nil {
+		return ""
+	}
+	return o.BlockThreshold
+}
+
+// Message represents a chat message. Content is either a string or, for
+// multimodal requests, an array of OpenAI-style content parts.
 type Message struct {
-	Role    string `json:"role"` // system, user, assistant
-	Content string `json:"content"`
+	Role       string        `json:"role" binding:"required,oneof=system user assistant tool"`
+	Content    string        `json:"content"` // the text; with parts, the text parts joined by newlines
+	Parts      []ContentPart `json:"-"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // calls made by an assistant message
+	ToolCallID string        `json:"tool_call_id,omitempty"` // the call a tool message answers
+	Name       string        `json:"name,omitempty"`
+}
+
+// Tool is a function definition offered to the model
+type Tool struct {
+	Type     string       `json:"type" binding:"omitempty,eq=function"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction describes a function and its JSON Schema parameters
+type ToolFunction struct {
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall is a call to a function requested by the model
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"` // function
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the function called and its JSON-encoded arguments
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// HasTools reports whether a conversation uses function calling
+func HasTools(messages []Message) bool {
+	for _, msg := range messages {
+		if len(msg.ToolCalls) > 0 || msg.ToolCallID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Content part types
+const (
+	PartText  = "text"
+	PartImage = "image_url"
+)
+
+// ContentPart is one part of a multimodal message
+type ContentPart struct {
+	Type     string    `json:"type"` // text or image_url
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL is an image given by URL or as a base64 data URL
+// (data:image/png;base64,...)
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"` // low, high or auto
+}
+
+// HasImages reports whether the message has image parts
+func (m Message) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == PartImage {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyImages reports whether any of messages carries image parts
+func AnyImages(messages []Message) bool {
+	for _, msg := range messages {
+		if msg.HasImages() {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinText joins the text of content parts the way Message.Content holds it
+func JoinText(parts []ContentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == PartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// messageJSON is the wire form of a message
+type messageJSON struct {
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+	Name       string      `json:"name,omitempty"`
+}
+
+// MarshalJSON writes content as a string, or as parts for multimodal messages
+func (m Message) MarshalJSON() ([]byte, error) {
+	wire := messageJSON{Role: m.Role, Content: m.Content, ToolCalls: m.ToolCalls, ToolCallID: m.ToolCallID, Name: m.Name}
+	if len(m.Parts) > 0 {
+		wire.Content = m.Parts
+	} else if m.Content == "" && len(m.ToolCalls) > 0 {
+		wire.Content = nil // assistant messages that only call tools
+	}
+	return json.Marshal(wire)
+}
+
+// JSONSchema describes content as a string or an array of parts
+func (Message) JSONSchema() map[string]interface{} {
+	part := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type": map[string]interface{}{"type": "string", "enum": []string{PartText, PartImage}},
+			"text": map[string]interface{}{"type": "string"},
+			"image_url": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"url":    map[string]interface{}{"type": "string"},
+					"detail": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"url"},
+			},
+		},
+		"required": []string{"type"},
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"role": map[string]interface{}{"type": "string"},
+			"content": map[string]interface{}{
+				"oneOf": []interface{}{
+					map[string]interface{}{"type": "string"},
+					map[string]interface{}{"type": "array", "items": part},
+					map[string]interface{}{"type": "null"},
+				},
+			},
+			"tool_calls": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":   map[string]interface{}{"type": "string"},
+						"type": map[string]interface{}{"type": "string"},
+						"function": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"name":      map[string]interface{}{"type": "string"},
+								"arguments": map[string]interface{}{"type": "string"},
+							},
+							"required": []string{"name", "arguments"},
+						},
+					},
+					"required": []string{"id", "function"},
+				},
+			},
+			"tool_call_id": map[string]interface{}{"type": "string"},
+			"name":         map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"content", "role"},
+	}
+}
+
+// UnmarshalJSON accepts content as a string or as an array of parts
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Role       string          `json:"role"`
+		Content    json.RawMessage `json:"content"`
+		ToolCalls  []ToolCall      `json:"tool_calls"`
+		ToolCallID string          `json:"tool_call_id"`
+		Name       string          `json:"name"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message{Role: raw.Role, ToolCalls: raw.ToolCalls, ToolCallID: raw.ToolCallID, Name: raw.Name}
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+	if raw.Content[0] != '[' {
+		return json.Unmarshal(raw.Content, &m.Content)
+	}
+
+	if err := json.Unmarshal(raw.Content, &m.Parts); err != nil {
+		return err
+	}
+	for _, part := range m.Parts {
+		switch part.Type {
+		case PartText:
+		case PartImage:
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return errors.New("image_url content part without a url")
+			}
+		default:
+			return fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	m.Content = JoinText(m.Parts)
+	return nil
 }
 
 // GuardResponse represents the response after processing
 type GuardResponse struct {
-	RequestID      string          `json:"request_id"`
-	Allowed        bool            `json:"allowed"`
-	ProcessedInput *ProcessedInput `json:"processed_input,omitempty"`
-	LLMResponse    *LLMResponse    `json:"llm_response,omitempty"`
-	SecurityReport *SecurityReport `json:"security_report,omitempty"`
-	PIIReport      *PIIReport      `json:"pii_report,omitempty"`
-	ProcessingTime time.Duration   `json:"processing_time_ms"`
-	Error          string          `json:"error,omitempty"`
+	RequestID      string            `json:"request_id"`
+	Allowed        bool              `json:"allowed"`
+	ProcessedInput *ProcessedInput   `json:"processed_input,omitempty"`
+	LLMResponse    *LLMResponse      `json:"llm_response,omitempty"`
+	SecurityReport *SecurityReport   `json:"security_report,omitempty"`
+	PIIReport      *PIIReport        `json:"pii_report,omitempty"`
+	SecretsReport  *SecretsReport    `json:"secrets_report,omitempty"`
+	ImageReport    *ImageReport      `json:"image_report,omitempty"`
+	Moderation     *ModerationReport `json:"moderation_report,omitempty"`
+	TopicReport    *TopicReport      `json:"topic_report,omitempty"`
+	Validation     *ValidationReport `json:"validation_report,omitempty"`
+	ProcessingTime time.Duration     `json:"processing_time_ms"`
+	Error          string            `json:"error,omitempty"`
+	// ErrorType says why the LLM call failed: upstream_timeout,
+	// provider_error, provider_unavailable or client_disconnected
+	ErrorType string `json:"error_type,omitempty"`
+	// Observed lists what checks in observe mode would have done to the
+	// request had they been enforced
+	Observed []ObservedAction `json:"observed,omitempty"`
+}
+
+// ObservedAction is what a check in observe mode would have done: block,
+// mask, strip or redact
+type ObservedAction struct {
+	Stage      string `json:"stage"` // the check, such as injection, pii or model_access
+	Action     string `json:"action"`
+	Reason     string `json:"reason"`
+	PolicyID   string `json:"policy_id,omitempty"`
+	PolicyName string `json:"policy_name,omitempty"`
 }
 
 // ProcessedInput contains the sanitized input
 type ProcessedInput struct {
-	OriginalMessages []Message `json:"original_messages,omitempty"`
-	MaskedMessages   []Message `json:"masked_messages"`
-	PIIMasked        bool      `json:"pii_masked"`
+	OriginalMessages []Message      `json:"original_messages,omitempty"`
+	MaskedMessages   []Message      `json:"masked_messages"`
+	PIIMasked        bool           `json:"pii_masked"`
+	Context          *ContextReport `json:"context,omitempty"` // set when the conversation was shortened
+}
+
+// ContextReport says how a conversation over a policy's context budget was
+// shortened before forwarding. Token counts are estimates.
+type ContextReport struct {
+	PolicyID       string `json:"policy_id"`
+	PolicyName     string `json:"policy_name"`
+	Strategy       string `json:"strategy"` // trim or summarize
+	Budget         int    `json:"budget"`
+	OriginalTokens int    `json:"original_tokens"`
+	Tokens         int    `json:"tokens"`
+	// Dropped are the indexes in masked_messages of the messages left out,
+	// or replaced by the summary
+	Dropped      []int  `json:"dropped"`
+	Summarized   bool   `json:"summarized"`
+	SummaryModel string `json:"summary_model,omitempty"`
+	SummaryUsage *Usage `json:"summary_usage,omitempty"`
+	// Error is why the summary couldn't be written; the turns were dropped
+	// instead
+	Error string `json:"error,omitempty"`
 }
 
 // LLMResponse contains the response from the LLM provider
 type LLMResponse struct {
-	Content      string `json:"content"`
-	Model        string `json:"model"`
-	FinishReason string `json:"finish_reason"`
-	Usage        *Usage `json:"usage,omitempty"`
+	Content      string     `json:"content"`
+	Model        string     `json:"model"`
+	FinishReason string     `json:"finish_reason"`
+	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
+	Usage        *Usage     `json:"usage,omitempty"`
 }
 
 // Usage contains token usage information
@@ -55,6 +407,127 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// Prompt tokens written to and read from the provider's prompt cache,
+	// included in PromptTokens
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+	CacheReadTokens  int `json:"cache_read_tokens,omitempty"`
+}
+
+// EmbeddingRequest is an OpenAI-compatible embeddings request. Input is a
+// string or an array of strings.
+type EmbeddingRequest struct {
+	Input          json.RawMessage   `json:"input" binding:"required"`
+	Model          string            `json:"model,omitempty"`
+	User           string            `json:"user,omitempty"` // User ID for spending tracking
+	Dimensions     *int              `json:"dimensions,omitempty" binding:"omitempty,min=1"`
+	EncodingFormat string            `json:"encoding_format,omitempty" binding:"omitempty,oneof=float base64"`
+	LLMProfile     string            `json:"llm_profile,omitempty"` // Optional named LLM profile
+	TimeoutMs      int               `json:"timeout_ms,omitempty"`  // overrides the configured LLM call timeout
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// Inputs returns the texts to embed. Token arrays are rejected since they
+// can't be checked for PII.
+func (r *EmbeddingRequest) Inputs() ([]string, error) {
+	var single string
+	if err := json.Unmarshal(r.Input, &single); err == nil {
+		return []string{single}, nil
+	}
+	var inputs []string
+	if err := json.Unmarshal(r.Input, &inputs); err != nil || len(inputs) == 0 {
+		return nil, errors.New("input must be a string or a non-empty array of strings")
+	}
+	return inputs, nil
+}
+
+// EmbeddingResponse is an OpenAI-compatible embeddings response
+type EmbeddingResponse struct {
+	Object string         `json:"object"`
+	Data   []Embedding    `json:"data"`
+	Model  string         `json:"model"`
+	Usage  EmbeddingUsage `json:"usage"`
+}
+
+// Embedding is the embedding of one input
+type Embedding struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"` // floats, or a base64 string
+}
+
+// EmbeddingUsage contains token usage of an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// ImageReport describes how the image parts of a request were handled
+type ImageReport struct {
+	Images   int            `json:"images"`
+	Scanned  int            `json:"scanned"`  // text extracted with OCR and checked
+	Stripped int            `json:"stripped"` // removed before forwarding
+	Findings []ImageFinding `json:"findings,omitempty"`
+}
+
+// ImageFinding is an image that was stripped or blocked and why
+type ImageFinding struct {
+	Location string `json:"location"` // message and part index
+	Reason   string `json:"reason"`
+}
+
+// ModerationSettings controls the moderation of LLM responses
+type ModerationSettings struct {
+	Enabled    bool               `json:"enabled"`
+	Provider   string             `json:"provider"`   // keywords or openai
+	Action     string             `json:"action"`     // warn, redact or block
+	Thresholds map[string]float64 `json:"thresholds"` // score at which a category is flagged
+}
+
+// ModerationReport is the result of moderating an LLM response
+type ModerationReport struct {
+	Provider   string               `json:"provider"`
+	Flagged    bool                 `json:"flagged"`
+	Action     string               `json:"action,omitempty"` // applied to a flagged response
+	Categories []ModerationCategory `json:"categories,omitempty"`
+	Scores     map[string]float64   `json:"scores,omitempty"`
+	Error      string               `json:"error,omitempty"` // the response couldn't be moderated
+}
+
+// ModerationCategory is a category a response was flagged for
+type ModerationCategory struct {
+	Category  string  `json:"category"`
+	Score     float64 `json:"score"`
+	Threshold float64 `json:"threshold"`
+}
+
+// ValidationReport is the result of checking an LLM response as JSON
+type ValidationReport struct {
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"` // of the response returned
+	Attempts int      `json:"attempts"`         // 2 when a repair was asked for
+	Repaired bool     `json:"repaired"`         // the repaired response is valid
+	// RepairError is why the repair call failed; the first response is
+	// returned
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// TopicReport is the result of checking a conversation against topic policies
+type TopicReport struct {
+	Violations []TopicViolation `json:"violations,omitempty"`
+	Denied     bool             `json:"denied"`
+	Error      string           `json:"error,omitempty"` // similarity couldn't be checked; keywords still were
+}
+
+// TopicViolation is a topic policy a request or response broke
+type TopicViolation struct {
+	PolicyID   string  `json:"policy_id"`
+	PolicyName string  `json:"policy_name"`
+	Location   string  `json:"location"`        // request or response
+	Topic      string  `json:"topic,omitempty"` // the blocked topic; empty when off the allowed topics
+	Match      string  `json:"match,omitempty"` // the keyword or example phrase matched
+	Similarity float64 `json:"similarity,omitempty"`
+	Action     string  `json:"action"` // deny or warn
+	Reason     string  `json:"reason"`
 }
 
 // SecurityReport contains injection detection results
@@ -64,15 +537,73 @@ type SecurityReport struct {
 	Detections        []Detection `json:"detections,omitempty"`
 	BlockedReason     string      `json:"blocked_reason,omitempty"`
 	Recommendations   []string    `json:"recommendations,omitempty"`
+	ToolFindings      []Detection `json:"tool_findings,omitempty"`      // risky tool call arguments; flagged, never blocked
+	ConversationTurns int         `json:"conversation_turns,omitempty"` // earlier turns of the conversation analyzed with the request
+	ScannedBytes      int         `json:"scanned_bytes,omitempty"`
+	ScanStopped       bool        `json:"scan_stopped,omitempty"`   // scanning stopped once the request reached its block threshold
+	ScanTruncated     bool        `json:"scan_truncated,omitempty"` // the prompt is over the scan limit, so its end wasn't scanned
+	Suppressed        []Detection `json:"suppressed,omitempty"`     // detections dropped by suppression rules; they don't count towards the threat level
+}
+
+// Conversation is the recent history of a multi-turn conversation, kept to
+// analyze each request with the turns before it
+type Conversation struct {
+	ID        string             `json:"id"`
+	UserID    string             `json:"user_id,omitempty"`
+	Turns     []ConversationTurn `json:"turns"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// ConversationTurn is one request of a conversation: its latest user
+// message, PII-masked, and how that message alone was rated
+type ConversationTurn struct {
+	RequestID   string    `json:"request_id"`
+	Text        string    `json:"text"`
+	ThreatLevel string    `json:"threat_level"`
+	Detections  int       `json:"detections"`
+	At          time.Time `json:"at"`
 }
 
 // Detection represents a single security detection
 type Detection struct {
-	Type        string  `json:"type"` // prompt_injection, jailbreak, data_exfil, etc.
-	Pattern     string  `json:"pattern"`
-	Location    string  `json:"location"`   // which message/field
-	Confidence  float64 `json:"confidence"` // 0.0 to 1.0
-	Description string  `json:"description"`
+	Type         string  `json:"type"` // prompt_injection, jailbreak, data_exfil, etc.
+	Pattern      string  `json:"pattern"`
+	Location     string  `json:"location"`   // which message/field
+	Confidence   float64 `json:"confidence"` // 0.0 to 1.0
+	Description  string  `json:"description"`
+	PatternID    string  `json:"pattern_id,omitempty"`    // stable ID of the pattern, for suppression rules
+	SuppressedBy string  `json:"suppressed_by,omitempty"` // suppression rule that dropped it
+	DetectionID  string  `json:"detection_id,omitempty"`  // for feedback on the detection
+}
+
+// Labels of detection feedback
+const (
+	FeedbackTruePositive  = "true_positive"
+	FeedbackFalsePositive = "false_positive"
+)
+
+// DetectionFeedback labels a detection as right or wrong, to tune the
+// pattern that made it. Feedback is kept in the audit log.
+type DetectionFeedback struct {
+	DetectionID string    `json:"detection_id"`
+	RequestID   string    `json:"request_id"`
+	PatternID   string    `json:"pattern_id"`
+	Label       string    `json:"label"` // true_positive or false_positive
+	Comment     string    `json:"comment,omitempty"`
+	UserID      string    `json:"user_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PatternPrecision is the share of the labeled detections of a pattern that
+// were right
+type PatternPrecision struct {
+	PatternID      string  `json:"pattern_id"`
+	Kind           string  `json:"kind"`              // injection, pii or secret
+	Pattern        string  `json:"pattern,omitempty"` // the injection pattern or keyword, or the PII or secret type
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	Precision      float64 `json:"precision"`
 }
 
 // PIIReport contains PII detection and masking results
@@ -81,6 +612,9 @@ type PIIReport struct {
 	PIICount    int        `json:"pii_count"`
 	PIITypes    []PIIMatch `json:"pii_types,omitempty"`
 	MaskedCount int        `json:"masked_count"`
+	// Blocked is set when PII of a type whose action is block was found
+	Blocked      bool     `json:"blocked,omitempty"`
+	BlockedTypes []string `json:"blocked_types,omitempty"`
 }
 
 // PIIMatch represents a detected PII instance
@@ -91,6 +625,51 @@ type PIIMatch struct {
 	Location      string `json:"location"`
 	StartPosition int    `json:"start_position"`
 	EndPosition   int    `json:"end_position"`
+	DetectionID   string `json:"detection_id,omitempty"` // for feedback on the match
+
+	// ValidationPassed is set for types with a checksum or numbering rules,
+	// such as credit cards and IBANs; matches failing them aren't reported
+	ValidationPassed *bool `json:"validation_passed,omitempty"`
+}
+
+// PIISettings holds the custom PII types registered through the control
+// plane and what is done with the PII of each type
+type PIISettings struct {
+	Patterns []PIIPattern      `json:"patterns"`
+	Actions  map[string]string `json:"actions,omitempty"` // type -> mask, tokenize, block or allow; mask when unset
+}
+
+// Equal reports whether s and o define the same types and actions. Unset
+// and empty lists are the same.
+func (s PIISettings) Equal(o PIISettings) bool {
+	return slices.Equal(s.Patterns, o.Patterns) && maps.Equal(s.Actions, o.Actions)
+}
+
+// PIIPattern is a custom PII type, such as employee IDs or internal project
+// codes
+type PIIPattern struct {
+	Name        string `json:"name"`    // type reported for matches
+	Pattern     string `json:"pattern"` // regular expression; a capture group marks the part to mask
+	Description string `json:"description,omitempty"`
+}
+
+// SecretsReport contains the credentials found in a request
+type SecretsReport struct {
+	SecretsDetected bool            `json:"secrets_detected"`
+	SecretCount     int             `json:"secret_count"`
+	Findings        []SecretFinding `json:"findings,omitempty"`
+	Action          string          `json:"action,omitempty"` // block, mask or warn; set when secrets were found
+}
+
+// SecretFinding is a detected credential. Its value is never reported.
+type SecretFinding struct {
+	Type          string  `json:"type"`    // github_token, private_key, etc.
+	Preview       string  `json:"preview"` // the first characters, to tell which key leaked
+	Location      string  `json:"location"`
+	Entropy       float64 `json:"entropy,omitempty"` // bits per character, for entropy-checked types
+	StartPosition int     `json:"start_position"`
+	EndPosition   int     `json:"end_position"`
+	DetectionID   string  `json:"detection_id,omitempty"` // for feedback on the finding
 }
 
 // HealthResponse represents the health check response
@@ -99,12 +678,53 @@ type HealthResponse struct {
 	Version  string            `json:"version"`
 	Uptime   string            `json:"uptime"`
 	Services map[string]string `json:"services"`
+	// Providers holds the circuit breaker state of every LLM provider called
+	// since startup
+	Providers map[string]*ProviderHealth `json:"providers,omitempty"`
+	// Checks holds the result of each dependency check
+	Checks map[string]*DependencyHealth `json:"checks,omitempty"`
+	// Persistence is set when a database is configured
+	Persistence *PersistenceStatus `json:"persistence,omitempty"`
+}
+
+// PersistenceStatus tells whether the database is reachable. While it is
+// degraded settings are served from their last-known values and audit logs
+// and usage records are queued for replay.
+type PersistenceStatus struct {
+	Degraded       bool       `json:"degraded"`
+	Since          *time.Time `json:"since,omitempty"` // when the database became unreachable
+	LastError      string     `json:"last_error,omitempty"`
+	QueuedWrites   int        `json:"queued_writes"`
+	DroppedWrites  int64      `json:"dropped_writes"`  // over capacity or failed on replay
+	ReplayedWrites int64      `json:"replayed_writes"` // since startup
+}
+
+// DependencyHealth is the result of checking a dependency such as the
+// database
+type DependencyHealth struct {
+	Status    string    `json:"status"`   // healthy, unhealthy, not_configured or unknown
+	Critical  bool      `json:"critical"` // whether the instance can serve requests without it
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ProviderHealth is the circuit breaker state of an LLM provider
+type ProviderHealth struct {
+	State       string     `json:"state"`    // closed, open or half_open
+	Requests    int        `json:"requests"` // calls in the window the rates cover
+	FailureRate float64    `json:"failure_rate"`
+	SlowRate    float64    `json:"slow_rate"`
+	LastError   string     `json:"last_error,omitempty"`
+	OpenedAt    *time.Time `json:"opened_at,omitempty"`
+	RetryAt     *time.Time `json:"retry_at,omitempty"` // when an open circuit lets probe calls through
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error     string `json:"error"`
-	Code      string `json:"code"`
-	RequestID string `json:"request_id,omitempty"`
-	Details   string `json:"details,omitempty"`
+	Error     string       `json:"error"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Details   string       `json:"details,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"` // the invalid fields of an INVALID_REQUEST body
 }
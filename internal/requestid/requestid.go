@@ -0,0 +1,63 @@
+// Package requestid carries the ID of an HTTP request through the work done
+// for it, so its log lines and audit entry can be found with one search
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Header is the header the ID is read from and returned in
+const Header = "X-Request-ID"
+
+// maxLength bounds IDs accepted from callers
+const maxLength = 128
+
+type idKey struct{}
+
+// New generates an ID
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether a caller's ID can be used as is: up to 128 letters,
+// digits and . _ : - characters, so it can't forge log fields or headers
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// With returns a context carrying id and a logger that adds it to every line
+func With(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, idKey{}, id)
+	return log.With().Str("request_id", id).Logger().WithContext(ctx)
+}
+
+// FromContext returns the ID of the request ctx belongs to, "" for
+// background work
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Logger returns the logger of the request ctx belongs to, or the global
+// logger for background work
+func Logger(ctx context.Context) *zerolog.Logger {
+	if FromContext(ctx) == "" {
+		return &log.Logger
+	}
+	return zerolog.Ctx(ctx)
+}
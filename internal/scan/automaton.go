@@ -0,0 +1,169 @@
+// Package scan matches many patterns against a text in few passes, for the
+// injection detector and PII masker
+package scan
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Automaton is an Aho–Corasick automaton finding which of a list of words
+// occur in a text, ignoring case, in a single pass
+type Automaton struct {
+	classes [256]uint16 // byte -> column of delta; 0 for bytes in no word
+	width   int         // columns of delta
+	delta   []int32     // state*width + class -> next state
+	out     [][]int     // words ending at each state, by index
+	words   int
+}
+
+// NewAutomaton builds an automaton finding words
+func NewAutomaton(words []string) *Automaton {
+	a := &Automaton{words: len(words)}
+	folded := make([]string, len(words))
+	for i, w := range words {
+		folded[i] = Fold(w)
+		for j := 0; j < len(folded[i]); j++ {
+			if b := folded[i][j]; a.classes[b] == 0 {
+				a.width++
+				a.classes[b] = uint16(a.width)
+			}
+		}
+	}
+	a.width++
+
+	// The trie of the words, with -1 for missing edges
+	a.delta = a.newState()
+	a.out = [][]int{nil}
+	for i, w := range folded {
+		state := int32(0)
+		for j := 0; j < len(w); j++ {
+			edge := int(state)*a.width + int(a.classes[w[j]])
+			if a.delta[edge] < 0 {
+				a.delta[edge] = int32(len(a.out))
+				a.delta = append(a.delta, a.newState()...)
+				a.out = append(a.out, nil)
+			}
+			state = a.delta[edge]
+		}
+		a.out[state] = append(a.out[state], i)
+	}
+
+	// Missing edges follow the failure links, breadth first so the failure
+	// state of each state is complete before it is used
+	fail := make([]int32, len(a.out))
+	queue := make([]int32, 0, len(a.out))
+	for c := 0; c < a.width; c++ {
+		if next := a.delta[c]; next < 0 {
+			a.delta[c] = 0
+		} else {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		a.out[state] = append(a.out[state], a.out[fail[state]]...)
+		for c := 0; c < a.width; c++ {
+			edge := int(state)*a.width + c
+			fallback := a.delta[int(fail[state])*a.width+c]
+			if next := a.delta[edge]; next < 0 {
+				a.delta[edge] = fallback
+			} else {
+				fail[next] = fallback
+				queue = append(queue, next)
+			}
+		}
+	}
+	return a
+}
+
+func (a *Automaton) newState() []int32 {
+	row := make([]int32, a.width)
+	for i := range row {
+		row[i] = -1
+	}
+	return row
+}
+
+// Find returns the indexes of the words occurring in text, in increasing
+// order
+func (a *Automaton) Find(text string) []int {
+	if a.words == 0 {
+		return nil
+	}
+	var seen []bool
+	found := 0
+	state := int32(0)
+	step := func(b byte) {
+		state = a.delta[int(state)*a.width+int(a.classes[b])]
+		for _, w := range a.out[state] {
+			if seen == nil {
+				seen = make([]bool, a.words)
+			}
+			if !seen[w] {
+				seen[w] = true
+				found++
+			}
+		}
+	}
+
+	var buf [utf8.UTFMax]byte
+	for i := 0; i < len(text) && found < a.words; {
+		if b := text[i]; b < utf8.RuneSelf {
+			step(foldASCII(b))
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		n := utf8.EncodeRune(buf[:], fold(r))
+		for _, b := range buf[:n] {
+			step(b)
+		}
+	}
+
+	if found == 0 {
+		return nil
+	}
+	words := make([]int, 0, found)
+	for w, ok := range seen {
+		if ok {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// Fold maps every rune of s to the one standing for all the runes equal to
+// it ignoring case, so texts equal ignoring case fold to the same string
+func Fold(s string) string {
+	folded := make([]rune, 0, len(s))
+	for _, r := range s {
+		folded = append(folded, fold(r))
+	}
+	return string(folded)
+}
+
+// fold maps r to the smallest rune equal to it ignoring case, or to lower
+// case for ASCII letters
+func fold(r rune) rune {
+	if r < utf8.RuneSelf {
+		return rune(foldASCII(byte(r)))
+	}
+	smallest := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		smallest = min(smallest, f)
+	}
+	if smallest < utf8.RuneSelf {
+		return rune(foldASCII(byte(smallest)))
+	}
+	return smallest
+}
+
+func foldASCII(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
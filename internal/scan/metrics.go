@@ -0,0 +1,63 @@
+package scan
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats reports the work of a scanner since it started
+type Stats struct {
+	Scans           int64   `json:"scans"`
+	Bytes           int64   `json:"bytes"`
+	Patterns        int     `json:"patterns"`
+	PatternsRun     int64   `json:"patterns_run"`
+	PatternsSkipped int64   `json:"patterns_skipped"`
+	SkipRate        float64 `json:"skip_rate"`
+	TotalMs         float64 `json:"total_ms"`
+	AvgUs           float64 `json:"avg_us"`
+	MaxUs           float64 `json:"max_us"`
+}
+
+// Metrics counts the texts a scanner looked at, the patterns it ran on them
+// and the time it took. It is safe for concurrent use.
+type Metrics struct {
+	scans, bytes, run, skipped atomic.Int64
+	nanos, maxNanos            atomic.Int64
+}
+
+// Record counts a scan of size bytes that ran some of the patterns and
+// skipped the others
+func (m *Metrics) Record(size, run, skipped int, elapsed time.Duration) {
+	m.scans.Add(1)
+	m.bytes.Add(int64(size))
+	m.run.Add(int64(run))
+	m.skipped.Add(int64(skipped))
+	m.nanos.Add(int64(elapsed))
+	for {
+		longest := m.maxNanos.Load()
+		if int64(elapsed) <= longest || m.maxNanos.CompareAndSwap(longest, int64(elapsed)) {
+			return
+		}
+	}
+}
+
+// Stats returns the counts so far, for a scanner currently running patterns
+// patterns
+func (m *Metrics) Stats(patterns int) Stats {
+	stats := Stats{
+		Scans:           m.scans.Load(),
+		Bytes:           m.bytes.Load(),
+		Patterns:        patterns,
+		PatternsRun:     m.run.Load(),
+		PatternsSkipped: m.skipped.Load(),
+		TotalMs:         float64(m.nanos.Load()) / float64(time.Millisecond),
+		MaxUs:           float64(m.maxNanos.Load()) / float64(time.Microsecond),
+	}
+	if total := stats.PatternsRun + stats.PatternsSkipped; total > 0 {
+		stats.SkipRate = float64(stats.PatternsSkipped) / float64(total)
+	}
+	if stats.Scans > 0 {
+		stats.AvgUs = float64(m.nanos.Load()) / float64(stats.Scans) / float64(time.Microsecond)
+	}
+	return stats
+}
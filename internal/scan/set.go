@@ -0,0 +1,173 @@
+package scan
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+// maxLiterals is the most literals a pattern is filtered on; one that could
+// match any of more is run on every text
+const maxLiterals = 16
+
+// Set tells which of a list of regexps may match a text without running
+// each of them. Most patterns can only match a text containing one of a few
+// literals, found for all patterns together in one pass of an Aho–Corasick
+// automaton. The patterns without such literals are merged into a single
+// alternation, run once to rule them all out.
+type Set struct {
+	patterns []*regexp.Regexp
+	literals *Automaton
+	owners   [][]int        // patterns needing each literal
+	rest     []int          // patterns needing no literal
+	merged   *regexp.Regexp // alternation of the rest, when there are several
+}
+
+// NewSet builds a set of patterns
+func NewSet(patterns []*regexp.Regexp) *Set {
+	s := &Set{patterns: patterns}
+	var words []string
+	index := make(map[string]int)
+	for i, re := range patterns {
+		var literals []string
+		if tree, err := syntax.Parse(re.String(), syntax.Perl); err == nil {
+			literals = required(tree)
+		}
+		if len(literals) == 0 {
+			s.rest = append(s.rest, i)
+			continue
+		}
+		for _, lit := range literals {
+			w, ok := index[lit]
+			if !ok {
+				w = len(words)
+				index[lit] = w
+				words = append(words, lit)
+				s.owners = append(s.owners, nil)
+			}
+			if !slices.Contains(s.owners[w], i) {
+				s.owners[w] = append(s.owners[w], i)
+			}
+		}
+	}
+	s.literals = NewAutomaton(words)
+
+	if len(s.rest) > 1 {
+		alternatives := make([]string, len(s.rest))
+		for j, i := range s.rest {
+			alternatives[j] = "(?:" + patterns[i].String() + ")"
+		}
+		// Without the merged pattern each of the rest is run instead
+		s.merged, _ = regexp.Compile(strings.Join(alternatives, "|"))
+	}
+	return s
+}
+
+// Len returns the number of patterns in the set
+func (s *Set) Len() int {
+	return len(s.patterns)
+}
+
+// Candidates returns the indexes, in increasing order, of the patterns that
+// may match text. The others are sure not to.
+func (s *Set) Candidates(text string) []int {
+	candidate := make([]bool, len(s.patterns))
+	for _, w := range s.literals.Find(text) {
+		for _, i := range s.owners[w] {
+			candidate[i] = true
+		}
+	}
+	if len(s.rest) > 0 && (s.merged == nil || s.merged.MatchString(text)) {
+		for _, i := range s.rest {
+			candidate[i] = true
+		}
+	}
+
+	var candidates []int
+	for i, ok := range candidate {
+		if ok {
+			candidates = append(candidates, i)
+		}
+	}
+	return candidates
+}
+
+// required returns literals, folded, one of which is in every match of re,
+// or nil if there are none worth looking for
+func required(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{Fold(string(re.Rune))}
+	case syntax.OpCharClass:
+		// A small class, like the digits, is as good as its characters
+		var all []string
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if lit := string(fold(r)); !slices.Contains(all, lit) {
+					if len(all) == maxLiterals {
+						return nil
+					}
+					all = append(all, lit)
+				}
+			}
+		}
+		return all
+	case syntax.OpCapture, syntax.OpPlus:
+		return required(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return required(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		// Any part's literals will do; the longest are the rarest
+		var best []string
+		for _, sub := range re.Sub {
+			if literals := required(sub); better(literals, best) {
+				best = literals
+			}
+		}
+		return best
+	case syntax.OpAlternate:
+		var all []string
+		for _, sub := range re.Sub {
+			literals := required(sub)
+			if literals == nil {
+				return nil
+			}
+			for _, lit := range literals {
+				if !slices.Contains(all, lit) {
+					all = append(all, lit)
+				}
+			}
+		}
+		if len(all) > maxLiterals {
+			return nil
+		}
+		return all
+	}
+	return nil
+}
+
+// better reports whether the literals a are likelier to rule out texts than
+// b: their shortest is longer, or as long and there are fewer of them
+func better(a, b []string) bool {
+	if len(a) == 0 {
+		return false
+	}
+	if len(b) == 0 {
+		return true
+	}
+	if shortestA, shortestB := shortest(a), shortest(b); shortestA != shortestB {
+		return shortestA > shortestB
+	}
+	return len(a) < len(b)
+}
+
+func shortest(literals []string) int {
+	n := len(literals[0])
+	for _, lit := range literals[1:] {
+		n = min(n, len(lit))
+	}
+	return n
+}
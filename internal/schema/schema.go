@@ -0,0 +1,307 @@
+// Package schema generates JSON Schemas (draft 2020-12) and OpenAPI 3.0
+// schema objects from Go types using their json struct tags, so the API
+// models stay the single source of truth.
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Draft is the JSON Schema dialect produced by the generator
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawJSONType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// Describer is implemented by types with custom JSON encoding, whose struct
+// tags don't describe their serialized form
+type Describer interface {
+	JSONSchema() map[string]interface{}
+}
+
+var describerType = reflect.TypeOf((*Describer)(nil)).Elem()
+
+// Generator builds schemas for Go types. Named string types can be given
+// enum values so generated clients get proper enums instead of plain strings.
+type Generator struct {
+	enums     map[reflect.Type][]interface{}
+	refPrefix string
+	openAPI   bool
+}
+
+// NewGenerator creates a schema generator
+func NewGenerator() *Generator {
+	return &Generator{enums: make(map[reflect.Type][]interface{}), refPrefix: "#/$defs/"}
+}
+
+// NewOpenAPIGenerator creates a generator of OpenAPI 3.0 schema objects,
+// which refer to each other under #/components/schemas
+func NewOpenAPIGenerator() *Generator {
+	return &Generator{enums: make(map[reflect.Type][]interface{}), refPrefix: "#/components/schemas/", openAPI: true}
+}
+
+// Enum registers the allowed values of a named type, e.g.
+// g.Enum(models.ActionDeny, models.ActionWarn)
+func (g *Generator) Enum(values ...interface{}) {
+	if len(values) == 0 {
+		return
+	}
+	t := reflect.TypeOf(values[0])
+	g.enums[t] = append(g.enums[t], values...)
+}
+
+// Generate returns the schema for v, with nested structs placed in $defs
+func (g *Generator) Generate(title string, v interface{}) map[string]interface{} {
+	defs := make(map[string]interface{})
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	root := g.typeSchema(t, defs)
+	if ref, ok := root["$ref"].(string); ok {
+		// Inline the root type rather than pointing at it, keeping the
+		// definition only if the type refers to itself
+		name := strings.TrimPrefix(ref, g.refPrefix)
+		root = defs[name].(map[string]interface{})
+		delete(defs, name)
+		if strings.Contains(mustMarshal(defs)+mustMarshal(root), `"`+ref+`"`) {
+			defs[name] = root
+		}
+	}
+
+	out := map[string]interface{}{
+		"$schema": Draft,
+		"title":   title,
+	}
+	for k, v := range root {
+		out[k] = v
+	}
+	if len(defs) > 0 {
+		out["$defs"] = defs
+	}
+	return out
+}
+
+// Schema returns the schema for v, adding the named structs it refers to
+// to defs. Named structs are returned as a reference to their definition.
+func (g *Generator) Schema(v interface{}, defs map[string]interface{}) map[string]interface{} {
+	return g.typeSchema(reflect.TypeOf(v), defs)
+}
+
+func (g *Generator) typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if values, ok := g.enums[t]; ok {
+		return map[string]interface{}{"type": jsonType(t.Kind()), "enum": values}
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]interface{}{"type": "integer", "description": "duration in nanoseconds"}
+	case rawJSONType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem(), defs)
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if g.openAPI {
+				return map[string]interface{}{"type": "string", "format": "byte"}
+			}
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t, defs)
+		}
+		if _, seen := defs[t.Name()]; !seen {
+			defs[t.Name()] = map[string]interface{}{} // placeholder for recursive types
+			if t.Implements(describerType) {
+				described := reflect.Zero(t).Interface().(Describer).JSONSchema()
+				if g.openAPI {
+					described = nullable(described)
+				}
+				defs[t.Name()] = described
+			} else {
+				defs[t.Name()] = g.structSchema(t, defs)
+			}
+		}
+		return map[string]interface{}{"$ref": g.refPrefix + t.Name()}
+	default:
+		return map[string]interface{}{"type": jsonType(t.Kind())}
+	}
+}
+
+func (g *Generator) structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitempty, skip := parseTag(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a tag are flattened, as encoding/json does
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := g.structSchema(embedded, defs)
+				for k, v := range inner["properties"].(map[string]interface{}) {
+					properties[k] = v
+				}
+				if r, ok := inner["required"].([]string); ok {
+					required = append(required, r...)
+				}
+				continue
+			}
+		}
+
+		prop := g.typeSchema(field.Type, defs)
+		rules := field.Tag.Get("binding")
+		constrain(prop, rules)
+		properties[name] = prop
+		if (!omitempty && field.Type.Kind() != reflect.Pointer) || slices.Contains(strings.Split(rules, ","), "required") {
+			required = append(required, name)
+		}
+	}
+
+	s := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+// constrain adds the limits of a binding tag, which gin validates request
+// bodies against, to the schema of a field
+func constrain(s map[string]interface{}, rules string) {
+	for _, rule := range strings.Split(rules, ",") {
+		if rule == "dive" {
+			break // the remaining rules apply to the elements
+		}
+		key, param, _ := strings.Cut(rule, "=")
+		switch key {
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			switch s["type"] {
+			case "array":
+				s[key+"Items"] = int(n)
+			case "string":
+				s[key+"Length"] = int(n)
+			case "integer", "number":
+				if key == "min" {
+					s["minimum"] = n
+				} else {
+					s["maximum"] = n
+				}
+			}
+		case "oneof", "eq":
+			if s["type"] == "string" {
+				s["enum"] = strings.Fields(param)
+			}
+		}
+	}
+}
+
+// nullable rewrites the null alternatives of JSON Schema oneOfs, which
+// OpenAPI 3.0 doesn't have, as nullable
+func nullable(s map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(s))
+	for k, v := range s {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			out[k] = nullable(v)
+		case []interface{}:
+			items := make([]interface{}, 0, len(v))
+			for _, item := range v {
+				m, ok := item.(map[string]interface{})
+				if !ok {
+					items = append(items, item)
+					continue
+				}
+				if k == "oneOf" && len(m) == 1 && m["type"] == "null" {
+					out["nullable"] = true
+					continue
+				}
+				items = append(items, nullable(m))
+			}
+			out[k] = items
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func mustMarshal(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// parseTag returns the JSON name of a field and whether it is omitted when empty
+func parseTag(field reflect.StructField) (name string, omitempty, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" || opt == "omitzero" {
+			omitempty = true
+		}
+	}
+	return name, omitempty, false
+}
+
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	default:
+		return "object"
+	}
+}
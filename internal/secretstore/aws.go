@@ -0,0 +1,170 @@
+package secretstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// awsSecrets reads secrets from AWS Secrets Manager
+type awsSecrets struct {
+	cfg    config.AWSSecretsConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+func newAWS(cfg config.AWSSecretsConfig) *awsSecrets {
+	cfg.Region = AWSRegion(cfg.Region)
+	if cfg.Endpoint == "" && cfg.Region != "" {
+		cfg.Endpoint = "https://secretsmanager." + cfg.Region + ".amazonaws.com"
+	}
+	return &awsSecrets{cfg: cfg, client: &http.Client{Timeout: httpTimeout}, now: time.Now}
+}
+
+// Fetch returns the current version of a secret, by name or ARN
+func (a *awsSecrets) Fetch(ctx context.Context, secretID string) (string, error) {
+	if a.cfg.Region == "" {
+		return "", errors.New("AWS region is not set (secret_store.aws.region or AWS_REGION)")
+	}
+	respBody, err := callAWS(ctx, a.client, a.cfg.Endpoint, a.cfg.Region, "secretsmanager", "secretsmanager.GetSecretValue",
+		map[string]string{"SecretId": secretID}, a.now())
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("decode Secrets Manager response: %w", err)
+	}
+	if resp.SecretString != "" {
+		return resp.SecretString, nil
+	}
+	binary, err := base64.StdEncoding.DecodeString(resp.SecretBinary)
+	if err != nil {
+		return "", fmt.Errorf("decode binary secret: %w", err)
+	}
+	return string(binary), nil
+}
+
+// AWSRegion returns region, or the region set in the environment
+func AWSRegion(region string) string {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return region
+}
+
+// callAWS sends a signed request to an AWS JSON API, with credentials from
+// the environment, and returns the response body
+func callAWS(ctx context.Context, client *http.Client, endpoint, region, service, target string, payload interface{}, now time.Time) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	if err := SignAWS(req, body, region, service, now); err != nil {
+		return nil, err
+	}
+	return do(client, req)
+}
+
+// SignAWS signs a request to an AWS service with the credentials in the
+// environment. Headers set afterwards aren't signed.
+func SignAWS(req *http.Request, body []byte, region, service string, now time.Time) error {
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return errors.New("AWS credentials are not set (AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, body, accessKey, secretKey, region, service, now)
+	return nil
+}
+
+// signV4 signs a request with AWS Signature Version 4
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.URL.Host)
+
+	// Sign every header set so far, in lower case and sorted
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	// url.Values.Encode sorts by key but escapes spaces as "+", which AWS
+	// doesn't accept
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
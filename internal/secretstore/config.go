@@ -0,0 +1,95 @@
+package secretstore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// ResolveConfig replaces the secret references in a configuration with the
+// secrets they point to. Every reference is tried; the error names each
+// field that couldn't be resolved.
+func ResolveConfig(ctx context.Context, store *Store, cfg *config.Config) error {
+	var failed []string
+	walkStrings("", reflect.ValueOf(cfg).Elem(), func(path string, v reflect.Value) {
+		if !IsRef(v.String()) {
+			return
+		}
+		secret, err := store.Resolve(ctx, v.String())
+		if err != nil {
+			failed = append(failed, path+": "+err.Error())
+			return
+		}
+		v.SetString(secret)
+	})
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to resolve secrets: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// References lists the fields of a configuration holding secret references
+func References(cfg *config.Config) map[string]string {
+	refs := make(map[string]string)
+	walkStrings("", reflect.ValueOf(cfg).Elem(), func(path string, v reflect.Value) {
+		if IsRef(v.String()) {
+			refs[path] = v.String()
+		}
+	})
+	return refs
+}
+
+// walkStrings calls fn with every settable string in v, named by its dotted
+// YAML path
+func walkStrings(path string, v reflect.Value, fn func(string, reflect.Value)) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			fn(path, v)
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			walkStrings(path, v.Elem(), fn)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			walkStrings(join(path, name), v.Field(i), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkStrings(fmt.Sprintf("%s[%d]", path, i), v.Index(i), fn)
+		}
+	case reflect.Map:
+		// Map elements can't be set in place, so each is copied, walked and
+		// stored back
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			walkStrings(join(path, fmt.Sprint(iter.Key().Interface())), elem, fn)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,253 @@
+package secretstore
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// envelopePrefix starts every value encrypted by an Envelope, followed by
+// the ID of the key that wrapped its data key
+const envelopePrefix = "enc:v1:"
+
+// kmsKeyID names data keys wrapped by AWS KMS. KMS finds the key itself when
+// decrypting, so data keys wrapped by a key that was since replaced still open.
+const kmsKeyID = "kms"
+
+// ErrNoMasterKey is returned when decrypting an encrypted value without a
+// master key configured
+var ErrNoMasterKey = errors.New("value is encrypted but no master key is set (encryption.master_key or GOGUARD_MASTER_KEY)")
+
+// keyWrapper encrypts and decrypts data keys
+type keyWrapper interface {
+	ID() string
+	Wrap(ctx context.Context, dataKey []byte) (string, error)
+	Unwrap(ctx context.Context, wrapped string) ([]byte, error)
+}
+
+// Envelope encrypts values for storage, each with a random data key that is
+// stored next to it, encrypted with the master key. Values are stored as
+// enc:v1:<key ID>:<wrapped data key>:<ciphertext>.
+type Envelope struct {
+	primary keyWrapper
+	keys    map[string]keyWrapper
+
+	// dataKeys holds unwrapped data keys, so KMS is called once per value
+	mu       sync.Mutex
+	dataKeys map[string][]byte
+}
+
+// NewEnvelope creates an envelope for the configured master key. Without a
+// master key or KMS key, values are stored as they are.
+func NewEnvelope(cfg config.EncryptionConfig, aws config.AWSSecretsConfig) (*Envelope, error) {
+	e := &Envelope{keys: make(map[string]keyWrapper), dataKeys: make(map[string][]byte)}
+
+	for i, encoded := range cfg.PreviousKeys {
+		key, err := newLocalKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption.previous_keys[%d]: %w", i, err)
+		}
+		e.keys[key.ID()] = key
+	}
+
+	switch {
+	case cfg.KMSKeyID != "":
+		e.primary = newKMSKey(cfg.KMSKeyID, aws)
+	case cfg.MasterKey != "":
+		key, err := newLocalKey(cfg.MasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("encryption.master_key: %w", err)
+		}
+		e.primary = key
+	}
+	if e.primary != nil {
+		e.keys[e.primary.ID()] = e.primary
+	}
+	return e, nil
+}
+
+// Enabled reports whether a master key is configured
+func (e *Envelope) Enabled() bool {
+	return e.primary != nil
+}
+
+// KeyID returns the ID of the key new values are encrypted with
+func (e *Envelope) KeyID() string {
+	if e.primary == nil {
+		return ""
+	}
+	return e.primary.ID()
+}
+
+// IsEncrypted reports whether a value was encrypted by an Envelope
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// Encrypt encrypts a value with a new data key. Empty values, values that
+// are already encrypted and all values without a master key are returned
+// as they are.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	if e.primary == nil || plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := e.primary.Wrap(ctx, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("wrap data key: %w", err)
+	}
+	ciphertext, err := Seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + e.primary.ID() + ":" + wrapped + ":" + ciphertext, nil
+}
+
+// Decrypt returns the plaintext of an encrypted value. Values that aren't
+// encrypted are returned as they are.
+func (e *Envelope) Decrypt(ctx context.Context, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if len(e.keys) == 0 {
+		return "", ErrNoMasterKey
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	keyID, wrapped, ciphertext := parts[0], parts[1], parts[2]
+
+	dataKey, err := e.dataKey(ctx, keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := Open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// dataKey unwraps a data key with the key that wrapped it
+func (e *Envelope) dataKey(ctx context.Context, keyID, wrapped string) ([]byte, error) {
+	e.mu.Lock()
+	dataKey, ok := e.dataKeys[wrapped]
+	e.mu.Unlock()
+	if ok {
+		return dataKey, nil
+	}
+
+	key, ok := e.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("value is encrypted with master key %s, which isn't configured; add it to encryption.previous_keys", keyID)
+	}
+	dataKey, err := key.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with %s: %w", keyID, err)
+	}
+
+	e.mu.Lock()
+	e.dataKeys[wrapped] = dataKey
+	e.mu.Unlock()
+	return dataKey, nil
+}
+
+// localKey wraps data keys with a master key held by GoGuard
+type localKey struct {
+	id  string
+	key []byte
+}
+
+func newLocalKey(encoded string) (*localKey, error) {
+	key, err := ParseKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	// The ID is a fingerprint of the key, so it can be named without
+	// revealing it
+	sum := sha256.Sum256(key)
+	return &localKey{id: hex.EncodeToString(sum[:4]), key: key}, nil
+}
+
+func (k *localKey) ID() string { return k.id }
+
+func (k *localKey) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	return Seal(k.key, dataKey)
+}
+
+func (k *localKey) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	return Open(k.key, wrapped)
+}
+
+// kmsKey wraps data keys with an AWS KMS key, so the master key never
+// leaves KMS
+type kmsKey struct {
+	keyID    string
+	region   string
+	endpoint string
+	client   *http.Client
+}
+
+func newKMSKey(keyID string, cfg config.AWSSecretsConfig) *kmsKey {
+	region := AWSRegion(cfg.Region)
+	return &kmsKey{
+		keyID:    keyID,
+		region:   region,
+		endpoint: "https://kms." + region + ".amazonaws.com",
+		client:   &http.Client{Timeout: httpTimeout},
+	}
+}
+
+func (k *kmsKey) ID() string { return kmsKeyID }
+
+func (k *kmsKey) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	var resp struct {
+		CiphertextBlob string `json:"CiphertextBlob"`
+	}
+	err := k.call(ctx, "TrentService.Encrypt", map[string]string{
+		"KeyId":     k.keyID,
+		"Plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	}, &resp)
+	return resp.CiphertextBlob, err
+}
+
+func (k *kmsKey) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var resp struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := k.call(ctx, "TrentService.Decrypt", map[string]string{"CiphertextBlob": wrapped}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+func (k *kmsKey) call(ctx context.Context, target string, payload, dest interface{}) error {
+	if k.region == "" {
+		return errors.New("AWS region is not set (secret_store.aws.region or AWS_REGION)")
+	}
+	body, err := callAWS(ctx, k.client, k.endpoint, k.region, "kms", target, payload, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, dest); err != nil {
+		return fmt.Errorf("decode KMS response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package secretstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// KeySize is the length of the AES-256 keys secrets are encrypted with
+const KeySize = 32
+
+// ErrNotFound is returned for a secret missing from a file
+var ErrNotFound = errors.New("secret not found")
+
+// encryptedFile reads secrets from a JSON object of names and values,
+// encrypted with Seal. The file is read on every fetch, so replacing it
+// rotates its secrets.
+type encryptedFile struct {
+	cfg config.SecretFileConfig
+}
+
+func newEncryptedFile(cfg config.SecretFileConfig) *encryptedFile {
+	return &encryptedFile{cfg: cfg}
+}
+
+// Fetch returns the named secret
+func (f *encryptedFile) Fetch(ctx context.Context, name string) (string, error) {
+	key, err := ParseKey(f.cfg.Key)
+	if err != nil {
+		return "", fmt.Errorf("secrets file key: %w", err)
+	}
+	data, err := os.ReadFile(f.cfg.Path)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := Open(key, string(bytes.TrimSpace(data)))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", f.cfg.Path, err)
+	}
+
+	var secrets map[string]json.RawMessage
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return "", fmt.Errorf("%s must hold a JSON object: %w", f.cfg.Path, err)
+	}
+	raw, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s in %s", ErrNotFound, name, f.cfg.Path)
+	}
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		return str, nil
+	}
+	return string(raw), nil
+}
+
+// envFile reads secrets from a file of KEY=value lines, like a .env file
+type envFile struct {
+	path string
+}
+
+func newEnvFile(path string) *envFile {
+	return &envFile{path: path}
+}
+
+// Fetch returns the value of a variable in the file
+func (f *envFile) Fetch(ctx context.Context, name string) (string, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) != name {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		return value, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%w: %s in %s", ErrNotFound, name, f.path)
+}
+
+// ParseKey decodes a base64 AES-256 key
+func ParseKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, errors.New("no key set")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// NewKey returns a random base64 AES-256 key
+func NewKey() string {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// Seal encrypts plaintext with AES-256-GCM, returning the nonce and
+// ciphertext in base64
+func Seal(key, plaintext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Open decrypts what Seal returned
+func Open(key []byte, sealed string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("not base64: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("wrong key or corrupted data")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
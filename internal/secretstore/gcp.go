@@ -0,0 +1,130 @@
+package secretstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+const (
+	gcpEndpoint = "https://secretmanager.googleapis.com"
+	// gcpTokenURL is the metadata server's token for the attached service account
+	gcpTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// gcpSecrets reads secrets from Google Cloud Secret Manager
+type gcpSecrets struct {
+	cfg    config.GCPSecretsConfig
+	client *http.Client
+	tokens *GCPTokenSource
+}
+
+func newGCP(cfg config.GCPSecretsConfig) *gcpSecrets {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = gcpEndpoint
+	}
+	client := &http.Client{Timeout: httpTimeout}
+	return &gcpSecrets{cfg: cfg, client: client, tokens: NewGCPTokenSource(cfg.AccessToken, client)}
+}
+
+// Fetch reads project/secret, or project/secret/version for a version
+// other than the latest
+func (g *gcpSecrets) Fetch(ctx context.Context, path string) (string, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 2 {
+		parts = append(parts, "latest")
+	}
+	if len(parts) != 3 {
+		return "", fmt.Errorf("gcp path %q must be project/secret or project/secret/version", path)
+	}
+
+	token, err := g.tokens.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/%s:access", strings.TrimSuffix(g.cfg.Endpoint, "/"), parts[0], parts[1], parts[2])
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	body, err := do(g.client, req)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("decode Secret Manager response: %w", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decode secret payload: %w", err)
+	}
+	return string(data), nil
+}
+
+// GCPTokenSource provides access tokens for Google Cloud APIs
+type GCPTokenSource struct {
+	static string
+	client *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewGCPTokenSource returns a source of token, else of GOOGLE_OAUTH_ACCESS_TOKEN,
+// else of tokens for the attached service account from the metadata server
+func NewGCPTokenSource(token string, client *http.Client) *GCPTokenSource {
+	if token == "" {
+		token = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	return &GCPTokenSource{static: token, client: client}
+}
+
+// Token returns the configured token, or one from the metadata server,
+// reused until shortly before it expires
+func (s *GCPTokenSource) Token(ctx context.Context) (string, error) {
+	if s.static != "" {
+		return s.static, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, err := do(s.client, req)
+	if err != nil {
+		return "", fmt.Errorf("no GCP access token set and the metadata server can't be reached: %w", err)
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("decode metadata token: %w", err)
+	}
+	s.token = resp.AccessToken
+	s.expiresAt = time.Now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
@@ -0,0 +1,249 @@
+// Package secretstore resolves secret:// references to values held in
+// HashiCorp Vault, AWS Secrets Manager, Google Cloud Secret Manager, an
+// encrypted file or an env file, so credentials don't have to be written
+// into the config file or the settings table.
+package secretstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Scheme prefixes a secret reference
+const Scheme = "secret://"
+
+// ErrUnknownProvider is returned for a reference to a provider that doesn't exist
+var ErrUnknownProvider = errors.New("unknown secret provider")
+
+// Provider fetches secrets from one backend
+type Provider interface {
+	// Fetch returns the secret at path. Secrets with several fields are
+	// returned as a JSON object.
+	Fetch(ctx context.Context, path string) (string, error)
+}
+
+// Ref is a parsed secret reference: secret://provider/path#key
+type Ref struct {
+	Provider string
+	Path     string
+	Key      string // field of a JSON secret, if any
+}
+
+// IsRef reports whether a value is a secret reference
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// ParseRef parses a secret reference
+func ParseRef(value string) (Ref, error) {
+	rest, ok := strings.CutPrefix(value, Scheme)
+	if !ok {
+		return Ref{}, fmt.Errorf("not a secret reference: must start with %s", Scheme)
+	}
+	rest, key, _ := strings.Cut(rest, "#")
+	provider, path, _ := strings.Cut(rest, "/")
+	if provider == "" || path == "" {
+		return Ref{}, fmt.Errorf("invalid secret reference %q: use %sprovider/path#key", value, Scheme)
+	}
+	return Ref{Provider: provider, Path: path, Key: key}, nil
+}
+
+// String returns the reference without its key, which is what is fetched
+// and cached
+func (r Ref) String() string {
+	return Scheme + r.Provider + "/" + r.Path
+}
+
+// Status describes a cached secret, without its value
+type Status struct {
+	Reference string    `json:"reference"`
+	FetchedAt time.Time `json:"fetched_at,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Error     string    `json:"error,omitempty"` // last failed fetch; the previous value is still used
+}
+
+// entry is a fetched secret
+type entry struct {
+	value     string
+	fetchedAt time.Time
+	checkedAt time.Time // last fetch, which failed if err is set
+	err       error
+}
+
+// Store resolves secret references through its providers, caching each
+// secret for a TTL. Once it expires the secret is fetched again, so a
+// rotated value is used without a restart. If fetching fails, the expired
+// value is kept until a fetch succeeds.
+type Store struct {
+	providers map[string]Provider
+	ttl       time.Duration
+	entries   map[string]*entry
+	mu        sync.Mutex
+	now       func() time.Time
+}
+
+// NewStore creates a store with the providers configured in cfg. The env
+// file and encrypted file providers are only available when configured.
+func NewStore(cfg config.SecretStoreConfig) *Store {
+	s := &Store{
+		providers: map[string]Provider{
+			"vault": newVault(cfg.Vault),
+			"aws":   newAWS(cfg.AWS),
+			"gcp":   newGCP(cfg.GCP),
+		},
+		ttl:     cfg.CacheTTL,
+		entries: make(map[string]*entry),
+		now:     time.Now,
+	}
+	if cfg.File.Path != "" {
+		s.providers["file"] = newEncryptedFile(cfg.File)
+	}
+	if cfg.EnvFile != "" {
+		s.providers["env-file"] = newEnvFile(cfg.EnvFile)
+	}
+	return s
+}
+
+// Resolve returns the secret a reference points to. Other values are
+// returned unchanged.
+func (s *Store) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsRef(value) {
+		return value, nil
+	}
+	ref, err := ParseRef(value)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := s.fetch(ctx, ref, false)
+	if err != nil {
+		return "", err
+	}
+	return field(ref, secret)
+}
+
+// fetch returns a secret from the cache, or from its provider once the
+// cached value expires or if force is set
+func (s *Store) fetch(ctx context.Context, ref Ref, force bool) (string, error) {
+	name := ref.String()
+
+	s.mu.Lock()
+	cached := s.entries[name]
+	provider, ok := s.providers[ref.Provider]
+	s.mu.Unlock()
+
+	if !ok {
+		return "", fmt.Errorf("%w %q in %s", ErrUnknownProvider, ref.Provider, name)
+	}
+	if !force && cached != nil && !s.expired(cached) {
+		return cached.value, nil
+	}
+
+	value, err := provider.Fetch(ctx, ref.Path)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("fetch %s: %w", name, err)
+		if cached == nil {
+			return "", err
+		}
+		// Keep serving the last value while the provider is unreachable,
+		// trying again once the TTL passes
+		log.Warn().Err(err).Msg("Using the previously fetched secret")
+		s.entries[name] = &entry{value: cached.value, fetchedAt: cached.fetchedAt, checkedAt: s.now(), err: err}
+		return cached.value, nil
+	}
+	if cached != nil && cached.value != value {
+		log.Info().Str("reference", name).Msg("Secret rotated")
+	}
+	now := s.now()
+	s.entries[name] = &entry{value: value, fetchedAt: now, checkedAt: now}
+	return value, nil
+}
+
+func (s *Store) expired(e *entry) bool {
+	return s.ttl > 0 && s.now().Sub(e.checkedAt) >= s.ttl
+}
+
+// Refresh fetches every cached secret again, e.g. right after rotating one
+func (s *Store) Refresh(ctx context.Context) []Status {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+
+	for _, name := range names {
+		ref, err := ParseRef(name)
+		if err != nil {
+			continue
+		}
+		if _, err := s.fetch(ctx, ref, true); err != nil {
+			log.Warn().Err(err).Msg("Failed to refresh secret")
+		}
+	}
+	return s.Statuses()
+}
+
+// Statuses lists the secrets fetched so far
+func (s *Store) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.entries))
+	for name, e := range s.entries {
+		status := Status{Reference: name, FetchedAt: e.fetchedAt}
+		if s.ttl > 0 {
+			status.ExpiresAt = e.checkedAt.Add(s.ttl)
+		}
+		if e.err != nil {
+			status.Error = e.err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Reference < statuses[j].Reference })
+	return statuses
+}
+
+// field picks the referenced field out of a JSON secret. Without a key, a
+// JSON object with a single field resolves to that field and anything else
+// to the whole secret.
+func field(ref Ref, secret string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		if ref.Key != "" {
+			return "", fmt.Errorf("%s is not a JSON object, so it has no field %q", ref, ref.Key)
+		}
+		return secret, nil
+	}
+
+	key := ref.Key
+	if key == "" {
+		if len(fields) != 1 {
+			return secret, nil
+		}
+		for k := range fields {
+			key = k
+		}
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%s has no field %q", ref, key)
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	raw, _ := json.Marshal(value)
+	return string(raw), nil
+}
@@ -0,0 +1,97 @@
+package secretstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// httpTimeout bounds each request to a secret provider
+const httpTimeout = 10 * time.Second
+
+// vault reads KV version 2 secrets from HashiCorp Vault
+type vault struct {
+	cfg    config.VaultConfig
+	client *http.Client
+}
+
+func newVault(cfg config.VaultConfig) *vault {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	return &vault{cfg: cfg, client: &http.Client{Timeout: httpTimeout}}
+}
+
+// Fetch reads mount/path, returning the secret's fields as a JSON object
+func (v *vault) Fetch(ctx context.Context, path string) (string, error) {
+	if v.cfg.Address == "" || v.cfg.Token == "" {
+		return "", errors.New("vault address and token are not set (secret_store.vault or VAULT_ADDR and VAULT_TOKEN)")
+	}
+	mount, secret, ok := strings.Cut(path, "/")
+	if !ok || secret == "" {
+		return "", fmt.Errorf("vault path %q must be mount/secret", path)
+	}
+
+	url := strings.TrimSuffix(v.cfg.Address, "/") + "/v1/" + mount + "/data/" + secret
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+
+	body, err := do(v.client, req)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("decode vault response: %w", err)
+	}
+	if len(resp.Data.Data) == 0 || string(resp.Data.Data) == "null" {
+		return "", fmt.Errorf("vault secret %s has no data (deleted, or not a KV v2 mount?)", path)
+	}
+	return string(resp.Data.Data), nil
+}
+
+// do sends a request and returns the body of a successful response
+func do(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > 200 {
+			msg = msg[:200] + "..."
+		}
+		return nil, fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, msg)
+	}
+	return body, nil
+}
@@ -0,0 +1,298 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/policy"
+)
+
+// Delivery channels
+const (
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+const (
+	workers   = 4
+	queueSize = 1024
+)
+
+// errPermanent marks failures that retrying won't fix
+var errPermanent = errors.New("permanent failure")
+
+// Trigger is a policy match that may need webhooks or emails sent
+type Trigger struct {
+	Policy     *models.Policy
+	Evaluation models.PolicyEvaluation
+	RequestID  string
+	UserID     string
+	AuditID    string
+	Timestamp  time.Time
+}
+
+// job is one delivery and what to send
+type job struct {
+	delivery models.ActionDelivery
+	trigger  Trigger
+}
+
+// Dispatcher sends the webhook and email actions of triggered policies,
+// retrying failed deliveries with exponential backoff. Deliveries are logged
+// to the database when one is configured, otherwise kept in memory.
+type Dispatcher struct {
+	cfg    config.NotifyConfig
+	engine *policy.Engine
+	repo   *database.Repository
+	client *http.Client
+	queue  chan *job
+	ctx    context.Context
+
+	deliveries []models.ActionDelivery
+	mu         sync.RWMutex
+}
+
+// NewDispatcher creates a dispatcher; call Start to begin delivering
+func NewDispatcher(cfg config.NotifyConfig, engine *policy.Engine, repo *database.Repository) *Dispatcher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 2 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxDeliveries <= 0 {
+		cfg.MaxDeliveries = 1000
+	}
+	if cfg.SMTP.Port == 0 {
+		cfg.SMTP.Port = 587
+	}
+	return &Dispatcher{
+		cfg:    cfg,
+		engine: engine,
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan *job, queueSize),
+		ctx:    context.Background(),
+	}
+}
+
+// Start subscribes to policy triggers recorded by the audit logger and runs
+// the delivery workers until ctx is cancelled
+func (d *Dispatcher) Start(ctx context.Context, logger *audit.Logger) {
+	d.ctx = ctx
+	events, unsubscribe := logger.Subscribe(audit.EventFilter{Kinds: []string{audit.EventKindPolicyTrigger}})
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				d.handleEvent(event)
+			}
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go d.work(ctx)
+	}
+}
+
+// handleEvent turns a policy trigger event into a Trigger for the policy
+func (d *Dispatcher) handleEvent(event audit.Event) {
+	data, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return
+	}
+	eval, ok := data["policy"].(models.PolicyEvaluation)
+	if !ok {
+		return
+	}
+	// Triggers from OPA or other sources without a stored policy have no actions
+	p, err := d.engine.GetPolicy(d.ctx, eval.PolicyID)
+	if err != nil {
+		return
+	}
+
+	requestID, _ := data["request_id"].(string)
+	auditID, _ := data["audit_id"].(string)
+	d.Dispatch(Trigger{
+		Policy:     p,
+		Evaluation: eval,
+		RequestID:  requestID,
+		UserID:     event.UserID,
+		AuditID:    auditID,
+		Timestamp:  event.Timestamp,
+	})
+}
+
+// Dispatch queues a delivery for the policy's webhook and each notify address
+func (d *Dispatcher) Dispatch(t Trigger) {
+	if t.Policy.Actions.WebhookURL != "" {
+		d.enqueue(d.newJob(t, ChannelWebhook, t.Policy.Actions.WebhookURL))
+	}
+	for _, address := range t.Policy.Actions.Notify {
+		j := d.newJob(t, ChannelEmail, address)
+		if d.cfg.SMTP.Host == "" {
+			// Log it so the missing mail server shows up in the delivery log
+			d.finish(j, 0, fmt.Errorf("%w: SMTP is not configured", errPermanent))
+			continue
+		}
+		d.enqueue(j)
+	}
+}
+
+func (d *Dispatcher) newJob(t Trigger, channel, target string) *job {
+	now := time.Now()
+	j := &job{
+		trigger: t,
+		delivery: models.ActionDelivery{
+			ID:         uuid.New().String(),
+			PolicyID:   t.Policy.ID,
+			PolicyName: t.Policy.Name,
+			Channel:    channel,
+			Target:     target,
+			RequestID:  t.RequestID,
+			UserID:     t.UserID,
+			Status:     models.DeliveryPending,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+	}
+	d.record(j.delivery)
+	return j
+}
+
+func (d *Dispatcher) enqueue(j *job) {
+	select {
+	case d.queue <- j:
+	default:
+		d.finish(j, 0, fmt.Errorf("%w: delivery queue is full", errPermanent))
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-d.queue:
+			d.attempt(j)
+		}
+	}
+}
+
+// attempt sends a delivery once and schedules a retry if it failed
+func (d *Dispatcher) attempt(j *job) {
+	j.delivery.Attempts++
+
+	var code int
+	var err error
+	switch j.delivery.Channel {
+	case ChannelWebhook:
+		code, err = d.sendWebhook(d.ctx, j)
+	case ChannelEmail:
+		err = d.sendEmail(j)
+	}
+
+	if err == nil || errors.Is(err, errPermanent) || j.delivery.Attempts >= d.cfg.MaxAttempts {
+		d.finish(j, code, err)
+		return
+	}
+
+	j.delivery.ResponseCode = code
+	j.delivery.LastError = err.Error()
+	j.delivery.UpdatedAt = time.Now()
+	d.record(j.delivery)
+
+	backoff := d.cfg.RetryBackoff << (j.delivery.Attempts - 1)
+	time.AfterFunc(backoff, func() {
+		if d.ctx.Err() == nil {
+			d.enqueue(j)
+		}
+	})
+}
+
+// finish records the final outcome of a delivery
+func (d *Dispatcher) finish(j *job, code int, err error) {
+	j.delivery.ResponseCode = code
+	j.delivery.UpdatedAt = time.Now()
+	if err != nil {
+		j.delivery.Status = models.DeliveryFailed
+		j.delivery.LastError = err.Error()
+		log.Warn().
+			Err(err).
+			Str("policy_id", j.delivery.PolicyID).
+			Str("channel", j.delivery.Channel).
+			Int("attempts", j.delivery.Attempts).
+			Msg("Policy action delivery failed")
+	} else {
+		j.delivery.Status = models.DeliveryDelivered
+		j.delivery.LastError = ""
+	}
+	d.record(j.delivery)
+}
+
+// record stores the current state of a delivery
+func (d *Dispatcher) record(delivery models.ActionDelivery) {
+	if d.repo != nil {
+		if err := d.repo.SaveActionDelivery(d.ctx, &delivery); err != nil {
+			log.Error().Err(err).Str("delivery_id", delivery.ID).Msg("Failed to save action delivery")
+		}
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Updates are for recent deliveries, so search from the end
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if d.deliveries[i].ID == delivery.ID {
+			d.deliveries[i] = delivery
+			return
+		}
+	}
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > d.cfg.MaxDeliveries {
+		d.deliveries = d.deliveries[len(d.deliveries)-d.cfg.MaxDeliveries:]
+	}
+}
+
+// List returns the newest deliveries, optionally filtered by policy and status
+func (d *Dispatcher) List(ctx context.Context, policyID, status string, limit int) ([]*models.ActionDelivery, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if d.repo != nil {
+		return d.repo.ListActionDeliveries(ctx, policyID, status, limit)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	deliveries := make([]*models.ActionDelivery, 0, limit)
+	for i := len(d.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		delivery := d.deliveries[i]
+		if (policyID == "" || delivery.PolicyID == policyID) && (status == "" || string(delivery.Status) == status) {
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	return deliveries, nil
+}
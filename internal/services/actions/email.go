@@ -0,0 +1,70 @@
+package actions
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendEmail mails a notification about the trigger to one notify address
+func (d *Dispatcher) sendEmail(j *job) error {
+	smtpCfg := d.cfg.SMTP
+	to := j.delivery.Target
+	if strings.ContainsAny(to, "\r\n") {
+		return fmt.Errorf("%w: invalid address %q", errPermanent, to)
+	}
+
+	from := smtpCfg.From
+	if from == "" {
+		from = "goguard@" + smtpCfg.Host
+	}
+
+	var auth smtp.Auth
+	if smtpCfg.Username != "" {
+		auth = smtp.PlainAuth("", smtpCfg.Username, smtpCfg.Password, smtpCfg.Host)
+	}
+
+	addr := net.JoinHostPort(smtpCfg.Host, strconv.Itoa(smtpCfg.Port))
+	return smtp.SendMail(addr, auth, from, []string{to}, d.emailMessage(j, from))
+}
+
+func (d *Dispatcher) emailMessage(j *job, from string) []byte {
+	t := j.trigger
+	// Policy names are user input, so keep them from adding headers
+	name := strings.NewReplacer("\r", " ", "\n", " ").Replace(t.Policy.Name)
+
+	action := t.Evaluation.Action
+	if action == "" {
+		action = t.Policy.Actions.Action
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", j.delivery.Target)
+	fmt.Fprintf(&b, "Subject: [GoGuard] Policy '%s' triggered (%s)\r\n", name, action)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "Policy:     %s (%s)\r\n", name, t.Policy.ID)
+	fmt.Fprintf(&b, "Type:       %s\r\n", t.Policy.Type)
+	fmt.Fprintf(&b, "Action:     %s\r\n", action)
+	if t.Evaluation.Message != "" {
+		fmt.Fprintf(&b, "Message:    %s\r\n", t.Evaluation.Message)
+	}
+	if t.UserID != "" {
+		fmt.Fprintf(&b, "User:       %s\r\n", t.UserID)
+	}
+	if t.RequestID != "" {
+		fmt.Fprintf(&b, "Request ID: %s\r\n", t.RequestID)
+	}
+	if t.AuditID != "" {
+		fmt.Fprintf(&b, "Audit ID:   %s\r\n", t.AuditID)
+	}
+	fmt.Fprintf(&b, "Time:       %s\r\n", t.Timestamp.UTC().Format(time.RFC3339))
+	return []byte(b.String())
+}
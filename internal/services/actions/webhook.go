@@ -0,0 +1,113 @@
+package actions
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// WebhookEvent is the event name sent with policy trigger webhooks
+const WebhookEvent = "policy.triggered"
+
+// Webhook headers
+const (
+	HeaderEvent     = "X-GoGuard-Event"
+	HeaderDelivery  = "X-GoGuard-Delivery"
+	HeaderSignature = "X-GoGuard-Signature"
+)
+
+// WebhookPayload is the JSON body posted to a policy's webhook URL
+type WebhookPayload struct {
+	ID         string                  `json:"id"` // delivery ID, the same across retries
+	Event      string                  `json:"event"`
+	Timestamp  time.Time               `json:"timestamp"`
+	Policy     WebhookPolicy           `json:"policy"`
+	Evaluation models.PolicyEvaluation `json:"evaluation"`
+	RequestID  string                  `json:"request_id,omitempty"`
+	UserID     string                  `json:"user_id,omitempty"`
+	AuditID    string                  `json:"audit_id,omitempty"`
+}
+
+// WebhookPolicy identifies the policy that triggered
+type WebhookPolicy struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Type   models.PolicyType `json:"type"`
+	Action models.ActionType `json:"action"`
+}
+
+// Sign returns the signature header value for a webhook body:
+// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook posts the trigger to the policy's webhook URL. Client errors
+// other than timeouts and rate limiting are not retried.
+func (d *Dispatcher) sendWebhook(ctx context.Context, j *job) (int, error) {
+	t := j.trigger
+	body, err := json.Marshal(WebhookPayload{
+		ID:        j.delivery.ID,
+		Event:     WebhookEvent,
+		Timestamp: t.Timestamp,
+		Policy: WebhookPolicy{
+			ID:     t.Policy.ID,
+			Name:   t.Policy.Name,
+			Type:   t.Policy.Type,
+			Action: t.Policy.Actions.Action,
+		},
+		Evaluation: t.Evaluation,
+		RequestID:  t.RequestID,
+		UserID:     t.UserID,
+		AuditID:    t.AuditID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.delivery.Target, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoGuard-Webhook")
+	req.Header.Set(HeaderEvent, WebhookEvent)
+	req.Header.Set(HeaderDelivery, j.delivery.ID)
+	if d.cfg.WebhookSecret != "" {
+		// Signed per attempt so receivers can reject stale replays
+		req.Header.Set(HeaderSignature, Sign(d.cfg.WebhookSecret, time.Now(), body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= 500:
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return resp.StatusCode, fmt.Errorf("%w: webhook returned status %d", errPermanent, resp.StatusCode)
+	}
+}
@@ -0,0 +1,284 @@
+package anomaly
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/rs/zerolog/log"
+)
+
+// Kind identifies a type of behavioral anomaly
+type Kind string
+
+const (
+	KindPromptLengthSpike Kind = "prompt_length_spike"
+	KindUnusualHour       Kind = "unusual_hour"
+	KindNewModel          Kind = "new_model"
+	KindRepeatedPrompt    Kind = "repeated_prompt"
+)
+
+// Anomaly is a deviation from a user's usual behavior
+type Anomaly struct {
+	Kind     Kind                   `json:"kind"`
+	UserID   string                 `json:"user_id"`
+	Severity string                 `json:"severity"`
+	Message  string                 `json:"message"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+}
+
+// Observation is a single request as seen by the analyzer
+type Observation struct {
+	RequestID string
+	UserID    string
+	Model     string
+	Messages  []models.Message
+	Time      time.Time
+}
+
+// profile is the learned baseline for one user
+type profile struct {
+	samples    int
+	meanLength float64
+	m2Length   float64 // sum of squared deviations (Welford)
+	hours      [24]int
+	models     map[string]int
+	recent     []promptSeen
+}
+
+type promptSeen struct {
+	hash [32]byte
+	at   time.Time
+}
+
+// Analyzer learns a per-user baseline from guard requests and flags
+// requests that deviate from it. Findings are informational: they are
+// recorded as audit events and never block a request.
+type Analyzer struct {
+	cfg         config.AnomalyConfig
+	auditLogger *audit.Logger
+	profiles    map[string]*profile
+	mu          sync.Mutex
+}
+
+// NewAnalyzer creates a behavioral analyzer
+func NewAnalyzer(cfg config.AnomalyConfig, logger *audit.Logger) *Analyzer {
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 20
+	}
+	if cfg.PromptLengthStdDevs <= 0 {
+		cfg.PromptLengthStdDevs = 3
+	}
+	if cfg.RareHourRatio <= 0 {
+		cfg.RareHourRatio = 0.02
+	}
+	if cfg.RepeatThreshold <= 0 {
+		cfg.RepeatThreshold = 5
+	}
+	if cfg.RepeatWindow <= 0 {
+		cfg.RepeatWindow = time.Minute
+	}
+	return &Analyzer{
+		cfg:         cfg,
+		auditLogger: logger,
+		profiles:    make(map[string]*profile),
+	}
+}
+
+// Observe checks a request against the user's baseline, records any
+// anomalies, and then folds the request into the baseline
+func (a *Analyzer) Observe(ctx context.Context, obs Observation) []Anomaly {
+	if obs.UserID == "" {
+		return nil
+	}
+	if obs.Time.IsZero() {
+		obs.Time = time.Now()
+	}
+
+	a.mu.Lock()
+	p, ok := a.profiles[obs.UserID]
+	if !ok {
+		p = &profile{models: make(map[string]int)}
+		a.profiles[obs.UserID] = p
+	}
+	anomalies := a.detect(p, obs)
+	a.learn(p, obs)
+	a.mu.Unlock()
+
+	for _, anomaly := range anomalies {
+		a.record(ctx, obs, anomaly)
+	}
+	return anomalies
+}
+
+// detect compares a request with the baseline; the caller must hold a.mu
+func (a *Analyzer) detect(p *profile, obs Observation) []Anomaly {
+	var anomalies []Anomaly
+	length := promptLength(obs.Messages)
+	hour := obs.Time.UTC().Hour()
+
+	// Repeats are judged on recent activity alone, so they apply to new users too
+	hash := promptHash(obs.Messages)
+	repeats := 1
+	cutoff := obs.Time.Add(-a.cfg.RepeatWindow)
+	for _, seen := range p.recent {
+		if seen.hash == hash && seen.at.After(cutoff) {
+			repeats++
+		}
+	}
+	if repeats == a.cfg.RepeatThreshold {
+		// Flag once when the threshold is crossed rather than on every repeat
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindRepeatedPrompt,
+			Severity: "medium",
+			Message:  fmt.Sprintf("Same prompt sent %d times within %s", repeats, a.cfg.RepeatWindow),
+			Details:  map[string]interface{}{"count": repeats, "window_seconds": a.cfg.RepeatWindow.Seconds()},
+		})
+	}
+
+	if p.samples < a.cfg.MinSamples {
+		return a.withUser(anomalies, obs.UserID)
+	}
+
+	stddev := math.Sqrt(p.m2Length / float64(p.samples-1))
+	threshold := p.meanLength + a.cfg.PromptLengthStdDevs*stddev
+	// Ignore spikes that are still small in absolute terms
+	if float64(length) > threshold && float64(length) > 2*p.meanLength {
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindPromptLengthSpike,
+			Severity: "low",
+			Message:  fmt.Sprintf("Prompt length %d is far above the usual %.0f", length, p.meanLength),
+			Details: map[string]interface{}{
+				"length":      length,
+				"mean_length": math.Round(p.meanLength),
+				"stddev":      math.Round(stddev),
+			},
+		})
+	}
+
+	if ratio := float64(p.hours[hour]) / float64(p.samples); ratio < a.cfg.RareHourRatio {
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindUnusualHour,
+			Severity: "low",
+			Message:  fmt.Sprintf("Activity at %02d:00 UTC, an hour this user rarely uses", hour),
+			Details:  map[string]interface{}{"hour_utc": hour, "share_of_requests": ratio},
+		})
+	}
+
+	if obs.Model != "" && p.models[obs.Model] == 0 {
+		known := make([]string, 0, len(p.models))
+		for m := range p.models {
+			known = append(known, m)
+		}
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindNewModel,
+			Severity: "low",
+			Message:  fmt.Sprintf("First request to model %s", obs.Model),
+			Details:  map[string]interface{}{"model": obs.Model, "known_models": known},
+		})
+	}
+
+	return a.withUser(anomalies, obs.UserID)
+}
+
+func (a *Analyzer) withUser(anomalies []Anomaly, userID string) []Anomaly {
+	for i := range anomalies {
+		anomalies[i].UserID = userID
+	}
+	return anomalies
+}
+
+// learn folds a request into the baseline; the caller must hold a.mu
+func (a *Analyzer) learn(p *profile, obs Observation) {
+	length := float64(promptLength(obs.Messages))
+	p.samples++
+	delta := length - p.meanLength
+	p.meanLength += delta / float64(p.samples)
+	p.m2Length += delta * (length - p.meanLength)
+
+	p.hours[obs.Time.UTC().Hour()]++
+	if obs.Model != "" {
+		p.models[obs.Model]++
+	}
+
+	cutoff := obs.Time.Add(-a.cfg.RepeatWindow)
+	recent := p.recent[:0]
+	for _, seen := range p.recent {
+		if seen.at.After(cutoff) {
+			recent = append(recent, seen)
+		}
+	}
+	p.recent = append(recent, promptSeen{hash: promptHash(obs.Messages), at: obs.Time})
+}
+
+// record writes an anomaly to the audit log and optionally raises an alert
+func (a *Analyzer) record(ctx context.Context, obs Observation, anomaly Anomaly) {
+	if a.auditLogger == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"kind":     anomaly.Kind,
+		"severity": anomaly.Severity,
+		"message":  anomaly.Message,
+	}
+	for k, v := range anomaly.Details {
+		details[k] = v
+	}
+
+	a.auditLogger.Log(ctx, &models.AuditLog{
+		EventType:    models.EventTypeAnomaly,
+		Action:       string(anomaly.Kind),
+		UserID:       anomaly.UserID,
+		ResourceType: "user_behavior",
+		RequestID:    obs.RequestID,
+		Status:       models.AuditStatusWarning,
+		Details:      details,
+	})
+
+	if !a.cfg.CreateAlerts {
+		return
+	}
+	if err := a.auditLogger.CreateAlert(ctx, &models.Alert{
+		Type:     "security",
+		Severity: anomaly.Severity,
+		Title:    "Unusual activity: " + strings.ReplaceAll(string(anomaly.Kind), "_", " "),
+		Message:  anomaly.Message,
+		UserID:   anomaly.UserID,
+	}); err != nil {
+		log.Warn().Err(err).Str("user_id", anomaly.UserID).Msg("Failed to create anomaly alert")
+	}
+}
+
+// promptLength is the total length of the user-supplied messages
+func promptLength(messages []models.Message) int {
+	n := 0
+	for _, m := range messages {
+		if m.Role != "assistant" {
+			n += len(m.Content)
+		}
+	}
+	return n
+}
+
+// promptHash fingerprints a prompt so repeats can be counted without keeping
+// prompt text in memory
+func promptHash(messages []models.Message) [32]byte {
+	h := sha256.New()
+	for _, m := range messages {
+		h.Write([]byte(m.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Content))
+		h.Write([]byte{0})
+	}
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
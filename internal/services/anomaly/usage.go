@@ -0,0 +1,314 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/rs/zerolog/log"
+)
+
+// Kinds of usage anomalies, found in an hour's totals rather than in a
+// single request
+const (
+	KindSpendSpike    Kind = "spend_spike"
+	KindBlockedSpike  Kind = "blocked_spike"
+	KindOffHoursModel Kind = "off_hours_model"
+)
+
+// UsageAnalyzer checks each completed hour of usage and spend against
+// simple statistics of the hours before it, and raises an alert with the
+// baseline and observed values for every anomaly
+type UsageAnalyzer struct {
+	cfg         config.AnomalyConfig
+	auditLogger *audit.Logger
+
+	mu       sync.Mutex
+	lastHour time.Time // the latest hour checked
+}
+
+// NewUsageAnalyzer creates a usage and spend analyzer
+func NewUsageAnalyzer(cfg config.AnomalyConfig, logger *audit.Logger) *UsageAnalyzer {
+	if cfg.BaselineWindow < 24*time.Hour {
+		cfg.BaselineWindow = 7 * 24 * time.Hour
+	}
+	if cfg.SpendMultiplier <= 0 {
+		cfg.SpendMultiplier = 10
+	}
+	if cfg.BlockedStdDevs <= 0 {
+		cfg.BlockedStdDevs = 3
+	}
+	if cfg.RareHourRatio <= 0 {
+		cfg.RareHourRatio = 0.02
+	}
+	return &UsageAnalyzer{cfg: cfg, auditLogger: logger}
+}
+
+// Start checks for a newly completed hour every usage interval until ctx is
+// done. It does nothing when the interval is zero.
+func (a *UsageAnalyzer) Start(ctx context.Context) {
+	if a.cfg.UsageInterval <= 0 || a.auditLogger == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(a.cfg.UsageInterval)
+		defer ticker.Stop()
+
+		a.check(ctx, time.Now())
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				a.check(ctx, time.Now())
+			}
+		}
+	}()
+}
+
+// check analyzes the last completed hour, once
+func (a *UsageAnalyzer) check(ctx context.Context, now time.Time) {
+	hour := now.UTC().Truncate(time.Hour).Add(-time.Hour)
+	a.mu.Lock()
+	if !hour.After(a.lastHour) {
+		a.mu.Unlock()
+		return
+	}
+	a.lastHour = hour
+	a.mu.Unlock()
+
+	anomalies, err := a.Analyze(ctx, hour)
+	if err != nil {
+		log.Warn().Err(err).Time("hour", hour).Msg("Failed to analyze hourly usage")
+		return
+	}
+	for _, anomaly := range anomalies {
+		a.record(ctx, anomaly)
+	}
+}
+
+// Analyze compares the hour starting at hour with the baseline window
+// before it. Nothing is flagged until there is some history to compare with.
+func (a *UsageAnalyzer) Analyze(ctx context.Context, hour time.Time) ([]Anomaly, error) {
+	hour = hour.UTC().Truncate(time.Hour)
+	end := hour.Add(time.Hour)
+	start := hour.Add(-a.cfg.BaselineWindow)
+	hours := int(a.cfg.BaselineWindow / time.Hour)
+
+	// The hourly totals of the window give the blocked requests baseline and
+	// when the deployment is usually active
+	history, err := a.auditLogger.Groups(ctx, start, hour, models.BreakdownHour, models.MetricsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	blocked := make([]float64, hours)
+	var byHour [24]int64
+	var requests int64
+	for _, g := range history {
+		t, err := time.Parse(time.RFC3339, g.Key)
+		if err != nil {
+			continue
+		}
+		if i := int(t.Sub(start) / time.Hour); i >= 0 && i < hours {
+			blocked[i] = float64(g.Blocked)
+		}
+		byHour[t.Hour()] += g.Count
+		requests += g.Count
+	}
+	if requests == 0 {
+		return nil, nil
+	}
+
+	var anomalies []Anomaly
+	spend, err := a.spendSpikes(ctx, hour, start, float64(hours))
+	if err != nil {
+		return nil, err
+	}
+	anomalies = append(anomalies, spend...)
+
+	current, err := a.auditLogger.Groups(ctx, hour, end, models.BreakdownAll, models.MetricsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	if len(current) > 0 {
+		mean, stddev := meanStdDev(blocked)
+		observed := current[0].Blocked
+		if observed >= a.cfg.MinBlocked && float64(observed) > mean+a.cfg.BlockedStdDevs*stddev {
+			anomalies = append(anomalies, Anomaly{
+				Kind:     KindBlockedSpike,
+				Severity: "high",
+				Message: fmt.Sprintf("%d requests blocked in the hour from %s UTC, against a usual %.1f per hour",
+					observed, hour.Format("2006-01-02 15:04"), mean),
+				Details: map[string]interface{}{
+					"hour":     hour,
+					"observed": observed,
+					"baseline": round(mean),
+					"stddev":   round(stddev),
+				},
+			})
+		}
+	}
+
+	if share := float64(byHour[hour.Hour()]) / float64(requests); share < a.cfg.RareHourRatio {
+		found, err := a.offHoursModels(ctx, hour, start, share)
+		if err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, found...)
+	}
+	return anomalies, nil
+}
+
+// spendSpikes flags users whose spend in the hour is many times their
+// average hourly spend over the window
+func (a *UsageAnalyzer) spendSpikes(ctx context.Context, hour, start time.Time, hours float64) ([]Anomaly, error) {
+	observed, err := a.auditLogger.Groups(ctx, hour, hour.Add(time.Hour), models.BreakdownUser, models.MetricsFilter{})
+	if err != nil || len(observed) == 0 {
+		return nil, err
+	}
+	history, err := a.auditLogger.Groups(ctx, start, hour, models.BreakdownUser, models.MetricsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	spent := make(map[string]float64, len(history))
+	for _, g := range history {
+		spent[g.Key] = g.Cost
+	}
+
+	var anomalies []Anomaly
+	for _, g := range observed {
+		baseline := spent[g.Key] / hours
+		if baseline <= 0 || g.Cost < a.cfg.MinHourlySpend || g.Cost < a.cfg.SpendMultiplier*baseline {
+			continue
+		}
+		anomalies = append(anomalies, Anomaly{
+			Kind:     KindSpendSpike,
+			UserID:   g.Key,
+			Severity: "high",
+			Message: fmt.Sprintf("Spent $%.2f in the hour from %s UTC, %.0fx the usual $%.4f per hour",
+				g.Cost, hour.Format("2006-01-02 15:04"), g.Cost/baseline, baseline),
+			Details: map[string]interface{}{
+				"hour":     hour,
+				"observed": round(g.Cost),
+				"baseline": round(baseline),
+				"requests": g.Count,
+			},
+		})
+	}
+	return anomalies, nil
+}
+
+// offHoursModels flags models first used in the window during an hour the
+// deployment is rarely active, naming the users who spent on them
+func (a *UsageAnalyzer) offHoursModels(ctx context.Context, hour, start time.Time, share float64) ([]Anomaly, error) {
+	observed, err := a.auditLogger.Groups(ctx, hour, hour.Add(time.Hour), models.BreakdownModel, models.MetricsFilter{})
+	if err != nil || len(observed) == 0 {
+		return nil, err
+	}
+	history, err := a.auditLogger.Groups(ctx, start, hour, models.BreakdownModel, models.MetricsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	known := make([]string, 0, len(history))
+	for _, g := range history {
+		known = append(known, g.Key)
+	}
+
+	var anomalies []Anomaly
+	for _, g := range observed {
+		if slices.Contains(known, g.Key) {
+			continue
+		}
+		spenders, err := a.auditLogger.Groups(ctx, hour, hour.Add(time.Hour), models.BreakdownUser, models.MetricsFilter{Model: g.Key})
+		if err != nil {
+			return nil, err
+		}
+		users := make([]string, 0, len(spenders))
+		for _, s := range spenders {
+			users = append(users, s.Key)
+		}
+		slices.Sort(users)
+
+		anomaly := Anomaly{
+			Kind:     KindOffHoursModel,
+			Severity: "medium",
+			Message: fmt.Sprintf("Model %s, unused in the last %.0f days, was called %d times at %02d:00 UTC, an hour with %.1f%% of usual requests",
+				g.Key, a.cfg.BaselineWindow.Hours()/24, g.Count, hour.Hour(), share*100),
+			Details: map[string]interface{}{
+				"hour":         hour,
+				"model":        g.Key,
+				"observed":     g.Count,
+				"baseline":     round(share),
+				"known_models": known,
+				"users":        users,
+			},
+		}
+		if len(users) == 1 {
+			anomaly.UserID = users[0]
+		}
+		anomalies = append(anomalies, anomaly)
+	}
+	return anomalies, nil
+}
+
+// record writes a usage anomaly to the audit log and raises an alert for it
+func (a *UsageAnalyzer) record(ctx context.Context, anomaly Anomaly) {
+	details := map[string]interface{}{
+		"kind":     anomaly.Kind,
+		"severity": anomaly.Severity,
+		"message":  anomaly.Message,
+	}
+	for k, v := range anomaly.Details {
+		details[k] = v
+	}
+
+	a.auditLogger.Log(ctx, &models.AuditLog{
+		EventType:    models.EventTypeAnomaly,
+		Action:       string(anomaly.Kind),
+		UserID:       anomaly.UserID,
+		ResourceType: "usage",
+		Status:       models.AuditStatusWarning,
+		Details:      details,
+	})
+
+	alertType := "security"
+	if anomaly.Kind == KindSpendSpike {
+		alertType = "spending"
+	}
+	if err := a.auditLogger.CreateAlert(ctx, &models.Alert{
+		Type:     alertType,
+		Severity: anomaly.Severity,
+		Title:    "Unusual usage: " + strings.ReplaceAll(string(anomaly.Kind), "_", " "),
+		Message:  anomaly.Message,
+		UserID:   anomaly.UserID,
+		Details:  anomaly.Details,
+	}); err != nil {
+		log.Warn().Err(err).Str("kind", string(anomaly.Kind)).Msg("Failed to create usage anomaly alert")
+	}
+}
+
+// meanStdDev returns the mean and population standard deviation of values
+func meanStdDev(values []float64) (mean, stddev float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		stddev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(values)))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
@@ -0,0 +1,175 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/auth"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidKey is returned for unknown, revoked, or expired keys
+var ErrInvalidKey = errors.New("invalid API key")
+
+// Service issues and validates control plane API keys
+type Service struct {
+	repo *database.Repository
+	keys map[string]*models.APIKey // by hash, used without a database
+	mu   sync.RWMutex
+}
+
+// NewService creates a new API key service
+// repo is optional - without it keys are kept in memory
+func NewService(repo *database.Repository) *Service {
+	return &Service{
+		repo: repo,
+		keys: make(map[string]*models.APIKey),
+	}
+}
+
+// Create issues a new key and returns its plaintext value, which is not stored
+func (s *Service) Create(ctx context.Context, key *models.APIKey) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plaintext := auth.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key.ID = uuid.New().String()
+	key.TenantID = tenant.Assign(ctx, key.TenantID)
+	key.Prefix = plaintext[:len(auth.APIKeyPrefix)+8]
+	key.KeyHash = hashKey(plaintext)
+	key.CreatedAt = time.Now()
+	key.LastUsedAt = nil
+	key.RevokedAt = nil
+
+	if s.repo != nil {
+		if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+			return "", err
+		}
+	} else {
+		s.mu.Lock()
+		s.keys[key.KeyHash] = key
+		s.mu.Unlock()
+	}
+
+	log.Info().Str("api_key_id", key.ID).Str("name", key.Name).Msg("API key created")
+	return plaintext, nil
+}
+
+// List returns all keys of the tenant ctx is confined to, including
+// revoked ones
+func (s *Service) List(ctx context.Context) ([]*models.APIKey, error) {
+	if s.repo != nil {
+		keys, err := s.repo.ListAPIKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(keys, func(k *models.APIKey) bool { return !tenant.Visible(ctx, k.TenantID) }), nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*models.APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		if !tenant.Visible(ctx, k.TenantID) {
+			continue
+		}
+		copied := *k
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+// Revoke disables a key immediately
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	if _, scoped := tenant.FromContext(ctx); scoped {
+		keys, err := s.List(ctx)
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(keys, func(k *models.APIKey) bool { return k.ID == id }) {
+			return fmt.Errorf("no active API key found with id: %s", id)
+		}
+	}
+	if s.repo != nil {
+		return s.repo.RevokeAPIKey(ctx, id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.ID == id && k.RevokedAt == nil {
+			now := time.Now()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("no active API key found with id: %s", id)
+}
+
+// ValidateAPIKey implements auth.APIKeyStore
+func (s *Service) ValidateAPIKey(ctx context.Context, plaintext string) (*models.APIKey, error) {
+	hash := hashKey(plaintext)
+
+	var key *models.APIKey
+	if s.repo != nil {
+		found, err := s.repo.GetAPIKeyByHash(ctx, hash)
+		if err != nil {
+			return nil, ErrInvalidKey
+		}
+		key = found
+	} else {
+		s.mu.RLock()
+		found, ok := s.keys[hash]
+		s.mu.RUnlock()
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		copied := *found
+		key = &copied
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+
+	s.touch(ctx, key, now)
+	return key, nil
+}
+
+// touch records when a key was last used
+func (s *Service) touch(ctx context.Context, key *models.APIKey, now time.Time) {
+	if s.repo != nil {
+		if err := s.repo.TouchAPIKey(ctx, key.ID, now); err != nil {
+			log.Warn().Err(err).Str("api_key_id", key.ID).Msg("Failed to update API key last use")
+		}
+		return
+	}
+
+	s.mu.Lock()
+	if k, ok := s.keys[key.KeyHash]; ok {
+		k.LastUsedAt = &now
+	}
+	s.mu.Unlock()
+}
+
+func hashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,397 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/privacy"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// ErrInvalidDashboardQuery is returned for empty dashboard ranges, unknown
+// granularities and timelines with too many buckets
+var ErrInvalidDashboardQuery = errors.New("invalid dashboard query")
+
+// maxDashboardBuckets bounds the timeline, e.g. to 41 days by the hour
+const maxDashboardBuckets = 1000
+
+// defaultDashboardTTL is how long dashboard metrics are reused by default
+const defaultDashboardTTL = 30 * time.Second
+
+// dashboardBreakdowns are computed for the range of every dashboard, besides
+// its timeline
+var dashboardBreakdowns = []string{
+	models.BreakdownAll,
+	models.BreakdownInjection,
+	models.BreakdownPII,
+	models.BreakdownLevel,
+	models.BreakdownThreat,
+	models.BreakdownModel,
+	models.BreakdownProvider,
+	models.BreakdownUser,
+}
+
+// dashboardData is what dashboard metrics are computed from
+type dashboardData struct {
+	Groups      map[string][]models.MetricsGroup `json:"groups"`   // by breakdown
+	Previous    []models.MetricsGroup            `json:"previous"` // all logs of the period before
+	TopPolicies []models.PolicyMetric            `json:"top_policies"`
+}
+
+// SetDashboardCache replaces the default in-memory cache of dashboard
+// metrics computed from the database, e.g. with a Redis cache shared by
+// every replica
+func (l *Logger) SetDashboardCache(c cache.Cache) {
+	l.dashboardCache = c
+}
+
+// GetDashboardMetrics returns metrics for the dashboard, protected by the
+// privacy policy when one is given. With a database they are computed from
+// every persisted audit log and reused briefly; otherwise from the logs
+// kept in memory.
+func (l *Logger) GetDashboardMetrics(ctx context.Context, q models.DashboardQuery, p *privacy.Policy) (*models.DashboardMetrics, error) {
+	q, err := resolveDashboardQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	data, err := l.dashboardData(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := newDashboardMetrics(q, data)
+	l.mu.RLock()
+	metrics.RecentAlerts = l.getRecentAlerts(ctx, 10)
+	l.mu.RUnlock()
+
+	if p != nil {
+		groupSizes(data.Groups).protectDashboard(metrics, p)
+	}
+	return metrics, nil
+}
+
+// resolveDashboardQuery fills in the defaults of a query: the last 24 hours
+// by the hour, or by the day for ranges over a week
+func resolveDashboardQuery(q models.DashboardQuery) (models.DashboardQuery, error) {
+	if q.End.IsZero() {
+		// Rounded up to the minute, so reloads within it hit the cache
+		q.End = time.Now().UTC().Truncate(time.Minute).Add(time.Minute)
+	}
+	if q.Start.IsZero() {
+		q.Start = q.End.Add(-24 * time.Hour)
+	}
+	if !q.Start.Before(q.End) {
+		return q, fmt.Errorf("%w: start must be before end", ErrInvalidDashboardQuery)
+	}
+	if q.Granularity == "" {
+		q.Granularity = models.BreakdownHour
+		if q.End.Sub(q.Start) > 7*24*time.Hour {
+			q.Granularity = models.BreakdownDay
+		}
+	}
+	if q.Granularity != models.BreakdownHour && q.Granularity != models.BreakdownDay {
+		return q, fmt.Errorf("%w: granularity must be hour or day", ErrInvalidDashboardQuery)
+	}
+	if q.End.Sub(bucketStart(q.Start, q.Granularity)) > maxDashboardBuckets*bucketStep(q.Granularity) {
+		return q, fmt.Errorf("%w: the range has more than %d %ss", ErrInvalidDashboardQuery, maxDashboardBuckets, q.Granularity)
+	}
+	return q, nil
+}
+
+func bucketStep(granularity string) time.Duration {
+	if granularity == models.BreakdownDay {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// bucketStart returns the start of the UTC hour or day t is in
+func bucketStart(t time.Time, granularity string) time.Time {
+	return t.UTC().Truncate(bucketStep(granularity))
+}
+
+// dashboardData aggregates the logs of a dashboard. When the database
+// can't be queried the logs in memory are used instead.
+func (l *Logger) dashboardData(ctx context.Context, q models.DashboardQuery) (*dashboardData, error) {
+	if l.repo == nil {
+		return l.groupLogs(ctx, q), nil
+	}
+
+	key := fmt.Sprintf("dashboard:%s:%d:%d:%s", tenant.Filter(ctx), q.Start.UnixNano(), q.End.UnixNano(), q.Granularity)
+	var data dashboardData
+	found, err := l.dashboardCache.Get(ctx, key, &data)
+	if err != nil {
+		log.Warn().Err(err).Msg("Dashboard cache read failed")
+	}
+	if found {
+		return &data, nil
+	}
+
+	if err := l.queryDashboard(ctx, q, &data); err != nil {
+		log.Warn().Err(err).Msg("Failed to query dashboard metrics - using in-memory audit logs")
+		return l.groupLogs(ctx, q), nil
+	}
+	if err := l.dashboardCache.Set(ctx, key, &data, 0); err != nil {
+		log.Warn().Err(err).Msg("Dashboard cache write failed")
+	}
+	return &data, nil
+}
+
+func (l *Logger) queryDashboard(ctx context.Context, q models.DashboardQuery, data *dashboardData) error {
+	tenantID := tenant.Filter(ctx)
+	data.Groups = make(map[string][]models.MetricsGroup)
+	for _, breakdown := range append(dashboardBreakdowns, q.Granularity) {
+		groups, err := l.repo.DashboardGroups(ctx, tenantID, q.Start, q.End, breakdown, models.MetricsFilter{})
+		if err != nil {
+			return err
+		}
+		data.Groups[breakdown] = groups
+	}
+	previous, err := l.repo.DashboardGroups(ctx, tenantID, q.Start.Add(-q.End.Sub(q.Start)), q.Start, models.BreakdownAll, models.MetricsFilter{})
+	if err != nil {
+		return err
+	}
+	data.Previous = previous
+	data.TopPolicies, err = l.repo.TopPolicyMetrics(ctx, tenantID, q.Start, q.End, topPoliciesLimit)
+	return err
+}
+
+// groupLogs aggregates the logs in memory like the database does
+func (l *Logger) groupLogs(ctx context.Context, q models.DashboardQuery) *dashboardData {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	breakdowns := append(dashboardBreakdowns, q.Granularity)
+	previousStart := q.Start.Add(-q.End.Sub(q.Start))
+	current, previous := make(groupTotals), make(groupTotals)
+	policies := make(policyTotals)
+	for i := range l.logs {
+		entry := &l.logs[i]
+		if !tenant.Visible(ctx, entry.TenantID) {
+			continue
+		}
+		switch {
+		case !entry.Timestamp.Before(q.Start) && entry.Timestamp.Before(q.End):
+			for _, breakdown := range breakdowns {
+				if key, ok := breakdownKey(entry, breakdown); ok {
+					current.add(breakdown, key, entry)
+				}
+			}
+			policies.add(policyCounts(entry))
+		case !entry.Timestamp.Before(previousStart) && entry.Timestamp.Before(q.Start):
+			previous.add(models.BreakdownAll, "", entry)
+		}
+	}
+	return &dashboardData{
+		Groups:      current.groups(),
+		Previous:    previous.groups()[models.BreakdownAll],
+		TopPolicies: policies.top(topPoliciesLimit),
+	}
+}
+
+// breakdownKey returns the group of a breakdown an entry is in, if any
+func breakdownKey(entry *models.AuditLog, breakdown string) (string, bool) {
+	alert := entry.EventType == models.EventTypeSecurityAlert
+	switch breakdown {
+	case models.BreakdownAll:
+		return "", true
+	case models.BreakdownInjection:
+		return "", alert
+	case models.BreakdownPII:
+		n, _ := entry.Details["pii_count"].(float64)
+		return "", n > 0
+	case models.BreakdownLevel:
+		level, ok := entry.Details["threat_level"].(string)
+		return level, ok && alert
+	case models.BreakdownThreat:
+		threatType, ok := entry.Details["threat_type"].(string)
+		return threatType, ok && alert
+	case models.BreakdownModel:
+		model, ok := entry.Details["model"].(string)
+		return model, ok
+	case models.BreakdownProvider:
+		provider, ok := entry.Details["provider"].(string)
+		return provider, ok
+	case models.BreakdownUser:
+		_, ok := entry.Details["cost"].(float64)
+		return entry.UserID, ok && entry.UserID != ""
+	case models.BreakdownHour, models.BreakdownDay:
+		return bucketStart(entry.Timestamp, breakdown).Format(time.RFC3339), true
+	}
+	return "", false
+}
+
+// groupTotals accumulates the groups of breakdowns, by breakdown and key
+type groupTotals map[string]map[string]*groupTotal
+
+type groupTotal struct {
+	models.MetricsGroup
+	users map[string]struct{}
+}
+
+func (t groupTotals) add(breakdown, key string, entry *models.AuditLog) {
+	groups, ok := t[breakdown]
+	if !ok {
+		groups = make(map[string]*groupTotal)
+		t[breakdown] = groups
+	}
+	g, ok := groups[key]
+	if !ok {
+		g = &groupTotal{MetricsGroup: models.MetricsGroup{Key: key}, users: make(map[string]struct{})}
+		groups[key] = g
+	}
+
+	g.Count++
+	if entry.Status == models.AuditStatusBlocked {
+		g.Blocked++
+	}
+	if entry.UserID != "" {
+		g.users[entry.UserID] = struct{}{}
+	}
+	if v, ok := entry.Details["prompt_tokens"].(float64); ok {
+		g.PromptTokens += int64(v)
+	}
+	if v, ok := entry.Details["completion_tokens"].(float64); ok {
+		g.CompletionTokens += int64(v)
+	}
+	if v, ok := entry.Details["total_tokens"].(float64); ok {
+		g.TotalTokens += int64(v)
+	}
+	if v, ok := entry.Details["cost"].(float64); ok {
+		g.Cost += v
+	}
+	if v, ok := entry.Details["pii_count"].(float64); ok && v > 0 {
+		g.PIIDetections += int64(v)
+	}
+}
+
+func (t groupTotals) groups() map[string][]models.MetricsGroup {
+	groups := make(map[string][]models.MetricsGroup, len(t))
+	for breakdown, totals := range t {
+		for _, g := range totals {
+			g.Users = len(g.users)
+			groups[breakdown] = append(groups[breakdown], g.MetricsGroup)
+		}
+	}
+	return groups
+}
+
+// newDashboardMetrics lays out the groups of a dashboard as its metrics
+func newDashboardMetrics(q models.DashboardQuery, data *dashboardData) *models.DashboardMetrics {
+	metrics := &models.DashboardMetrics{
+		Start:       q.Start,
+		End:         q.End,
+		Granularity: q.Granularity,
+		Security: models.SecurityMetrics{
+			ThreatsByLevel: make(map[string]int64),
+			TopThreatTypes: make(map[string]int64),
+		},
+		Usage: models.UsageMetrics{
+			RequestsByModel:    make(map[string]int64),
+			RequestsByProvider: make(map[string]int64),
+		},
+		Spending: models.SpendingMetrics{
+			SpendByUser:  make(map[string]float64),
+			SpendByModel: make(map[string]float64),
+		},
+		Timeline:     timeline(q, data.Groups[q.Granularity]),
+		RecentAlerts: []models.Alert{},
+		TopPolicies:  append([]models.PolicyMetric{}, data.TopPolicies...),
+	}
+
+	all, previous := firstGroup(data.Groups[models.BreakdownAll]), firstGroup(data.Previous)
+	metrics.Overview = models.OverviewMetrics{
+		TotalRequests24h:   all.Count,
+		RequestsChange:     percentChange(float64(all.Count), float64(previous.Count)),
+		ActiveUsers24h:     int64(all.Users),
+		UsersChange:        percentChange(float64(all.Users), float64(previous.Users)),
+		BlockedRequests24h: all.Blocked,
+		BlockedChange:      percentChange(float64(all.Blocked), float64(previous.Blocked)),
+		TotalSpend24h:      all.Cost,
+		SpendChange:        percentChange(all.Cost, previous.Cost),
+	}
+	metrics.Spending.TotalSpendToday = all.Cost
+
+	metrics.Security.InjectionAttempts24h = firstGroup(data.Groups[models.BreakdownInjection]).Count
+	metrics.Security.PIIDetections24h = all.PIIDetections
+	for _, g := range data.Groups[models.BreakdownLevel] {
+		metrics.Security.ThreatsByLevel[g.Key] = g.Count
+	}
+	for _, g := range data.Groups[models.BreakdownThreat] {
+		metrics.Security.TopThreatTypes[g.Key] = g.Count
+	}
+
+	metrics.Usage.TotalTokens24h = all.TotalTokens
+	metrics.Usage.PromptTokens24h = all.PromptTokens
+	metrics.Usage.CompletionTokens24h = all.CompletionTokens
+	for _, g := range data.Groups[models.BreakdownModel] {
+		metrics.Usage.RequestsByModel[g.Key] = g.Count
+		metrics.Spending.SpendByModel[g.Key] = g.Cost
+	}
+	for _, g := range data.Groups[models.BreakdownProvider] {
+		metrics.Usage.RequestsByProvider[g.Key] = g.Count
+	}
+	for _, g := range data.Groups[models.BreakdownUser] {
+		metrics.Spending.SpendByUser[g.Key] = g.Cost
+	}
+
+	return metrics
+}
+
+// timeline lists every hour or day of a range with the totals of its group
+// in an hour or day breakdown, including those without logs
+func timeline(q models.DashboardQuery, groups []models.MetricsGroup) []models.MetricsBucket {
+	byKey := make(map[string]models.MetricsGroup, len(groups))
+	for _, g := range groups {
+		byKey[g.Key] = g
+	}
+	buckets := []models.MetricsBucket{}
+	for start := bucketStart(q.Start, q.Granularity); start.Before(q.End); start = start.Add(bucketStep(q.Granularity)) {
+		g := byKey[start.Format(time.RFC3339)]
+		buckets = append(buckets, models.MetricsBucket{
+			Start:    start,
+			Requests: g.Count,
+			Blocked:  g.Blocked,
+			Tokens:   g.TotalTokens,
+			Cost:     g.Cost,
+		})
+	}
+	return buckets
+}
+
+func firstGroup(groups []models.MetricsGroup) models.MetricsGroup {
+	if len(groups) == 0 {
+		return models.MetricsGroup{}
+	}
+	return groups[0]
+}
+
+func percentChange(current, previous float64) float64 {
+	if previous <= 0 {
+		return 0
+	}
+	return (current - previous) / previous * 100
+}
+
+// groupSizes returns the sizes of groups by breakdown for their privacy
+// protection, keyed like the groups of the audit statistics
+func groupSizes(byBreakdown map[string][]models.MetricsGroup) *statsGroups {
+	g := &statsGroups{sizes: make(map[string]int)}
+	for breakdown, groups := range byBreakdown {
+		for _, group := range groups {
+			switch breakdown {
+			case models.BreakdownAll, models.BreakdownInjection, models.BreakdownPII:
+				g.sizes[breakdown] = group.Users
+			default:
+				g.sizes[breakdown+":"+group.Key] = group.Users
+			}
+		}
+	}
+	return g
+}
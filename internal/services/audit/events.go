@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Event kinds published to live subscribers
+const (
+	EventKindAudit         = "audit"
+	EventKindAlert         = "alert"
+	EventKindPolicyTrigger = "policy_trigger"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before events are dropped
+const subscriberBuffer = 256
+
+// Event is a real-time notification of a new audit entry, alert, or policy trigger
+type Event struct {
+	Kind      string      `json:"kind"`
+	EventType string      `json:"event_type,omitempty"` // audit event type or alert type
+	UserID    string      `json:"user_id,omitempty"`
+	TenantID  string      `json:"tenant_id,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// EventFilter selects which events a subscriber receives; empty fields match everything
+type EventFilter struct {
+	Kinds      []string
+	EventTypes []string
+	UserID     string
+	TenantID   string
+}
+
+// Matches reports whether the event passes the filter
+func (f EventFilter) Matches(e *Event) bool {
+	if f.UserID != "" && e.UserID != f.UserID {
+		return false
+	}
+	if f.TenantID != "" && e.TenantID != f.TenantID {
+		return false
+	}
+	if len(f.Kinds) > 0 && !contains(f.Kinds, e.Kind) {
+		return false
+	}
+	if len(f.EventTypes) > 0 && !contains(f.EventTypes, e.EventType) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriber struct {
+	ch     chan Event
+	filter EventFilter
+}
+
+// eventHub fans out events to subscribers without ever blocking the publisher
+type eventHub struct {
+	subscribers map[*subscriber]struct{}
+	dropped     atomic.Int64
+	mu          sync.RWMutex
+}
+
+// Subscribe registers for live events matching filter. The returned function
+// unsubscribes and closes the channel.
+func (l *Logger) Subscribe(filter EventFilter) (<-chan Event, func()) {
+	sub := &subscriber{
+		ch:     make(chan Event, subscriberBuffer),
+		filter: filter,
+	}
+
+	l.events.mu.Lock()
+	l.events.subscribers[sub] = struct{}{}
+	l.events.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			l.events.mu.Lock()
+			delete(l.events.subscribers, sub)
+			l.events.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// DroppedEvents returns how many events were dropped because subscribers fell behind
+func (l *Logger) DroppedEvents() int64 {
+	return l.events.dropped.Load()
+}
+
+func (l *Logger) publish(e Event) {
+	l.events.mu.RLock()
+	defer l.events.mu.RUnlock()
+
+	for sub := range l.events.subscribers {
+		if !sub.filter.Matches(&e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			l.events.dropped.Add(1)
+		}
+	}
+}
+
+// publishAuditLog sends the entry and any policy triggers it records
+func (l *Logger) publishAuditLog(entry models.AuditLog) {
+	l.publish(Event{
+		Kind:      EventKindAudit,
+		EventType: string(entry.EventType),
+		UserID:    entry.UserID,
+		TenantID:  entry.TenantID,
+		Timestamp: entry.Timestamp,
+		Data:      entry,
+	})
+
+	for _, result := range entry.PolicyResults {
+		if !result.Matched {
+			continue
+		}
+		l.publish(Event{
+			Kind:      EventKindPolicyTrigger,
+			EventType: string(result.Action),
+			UserID:    entry.UserID,
+			TenantID:  entry.TenantID,
+			Timestamp: entry.Timestamp,
+			Data: map[string]interface{}{
+				"policy":     result,
+				"request_id": entry.RequestID,
+				"audit_id":   entry.ID,
+			},
+		})
+	}
+}
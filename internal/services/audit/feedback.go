@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// ActionDetectionFeedback is the action of the audit entries labeling a
+// detection, whose resource is the detection
+const ActionDetectionFeedback = "detection_feedback"
+
+// PatternPrecision counts the detections labeled right and wrong for each
+// pattern, noisiest first. Only the latest label of a detection counts.
+// Feedback is read from the database when there is one, so it isn't limited
+// to the entries kept in memory.
+func (l *Logger) PatternPrecision(ctx context.Context) ([]models.PatternPrecision, error) {
+	var counts []models.PatternPrecision
+	if l.repo != nil {
+		var err error
+		if counts, err = l.repo.CountDetectionFeedback(ctx, tenant.Filter(ctx)); err != nil {
+			return nil, err
+		}
+	} else {
+		counts = l.countFeedback(ctx)
+	}
+
+	for i := range counts {
+		if labeled := counts[i].TruePositives + counts[i].FalsePositives; labeled > 0 {
+			counts[i].Precision = float64(counts[i].TruePositives) / float64(labeled)
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Precision != counts[j].Precision {
+			return counts[i].Precision < counts[j].Precision
+		}
+		if counts[i].FalsePositives != counts[j].FalsePositives {
+			return counts[i].FalsePositives > counts[j].FalsePositives
+		}
+		return counts[i].PatternID < counts[j].PatternID
+	})
+	return counts, nil
+}
+
+// countFeedback counts the labels of the feedback entries kept in memory
+func (l *Logger) countFeedback(ctx context.Context) []models.PatternPrecision {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// Entries are in the order they were logged, so later labels replace
+	// earlier ones
+	type labeled struct{ patternID, label string }
+	latest := make(map[[2]string]labeled)
+	for _, entry := range l.logs {
+		if entry.Action != ActionDetectionFeedback || entry.EventType != models.EventTypeUserAction ||
+			!tenant.Visible(ctx, entry.TenantID) {
+			continue
+		}
+		patternID, _ := entry.Details["pattern_id"].(string)
+		label, _ := entry.Details["label"].(string)
+		latest[[2]string{tenant.Of(entry.TenantID), entry.ResourceID}] = labeled{patternID, label}
+	}
+
+	byPattern := make(map[string]*models.PatternPrecision)
+	for _, fb := range latest {
+		counts, ok := byPattern[fb.patternID]
+		if !ok {
+			counts = &models.PatternPrecision{PatternID: fb.patternID}
+			byPattern[fb.patternID] = counts
+		}
+		switch fb.label {
+		case models.FeedbackTruePositive:
+			counts.TruePositives++
+		case models.FeedbackFalsePositive:
+			counts.FalsePositives++
+		}
+	}
+	result := make([]models.PatternPrecision, 0, len(byPattern))
+	for _, counts := range byPattern {
+		result = append(result, *counts)
+	}
+	return result
+}
@@ -2,10 +2,16 @@ package audit
 
 import (
 	"context"
+	"maps"
 	"sync"
 	"time"
 
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/database"
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/requestid"
+	"github.com/epps11/goguard/internal/services/privacy"
+	"github.com/epps11/goguard/internal/tenant"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
@@ -16,6 +22,10 @@ type Logger struct {
 	alerts  []models.Alert
 	mu      sync.RWMutex
 	maxLogs int
+	repo    *database.Repository
+	events  eventHub
+
+	dashboardCache cache.Cache
 }
 
 // NewLogger creates a new audit logger
@@ -27,27 +37,62 @@ func NewLogger(maxLogs int) *Logger {
 		logs:    make([]models.AuditLog, 0),
 		alerts:  make([]models.Alert, 0),
 		maxLogs: maxLogs,
+		events: eventHub{
+			subscribers: make(map[*subscriber]struct{}),
+		},
+		dashboardCache: cache.NewMemory(defaultDashboardTTL),
 	}
 }
 
-// Log creates a new audit log entry
-func (l *Logger) Log(ctx context.Context, entry *models.AuditLog) error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// SetRepository enables write-through persistence of audit logs to the database
+func (l *Logger) SetRepository(repo *database.Repository) {
+	l.repo = repo
+}
 
+// Log creates a new audit log entry in the tenant ctx is confined to. The
+// lock is only held to keep the entry in memory; it is persisted and
+// published after, so callers don't wait on each other's writes.
+func (l *Logger) Log(ctx context.Context, entry *models.AuditLog) error {
 	if entry.ID == "" {
 		entry.ID = uuid.New().String()
 	}
+	entry.TenantID = tenant.Assign(ctx, entry.TenantID)
+	// Entries are linked to the HTTP request they were made for, keeping the
+	// request ID a caller gave in the body when it differs
+	if id := requestid.FromContext(ctx); id != "" && id != entry.RequestID {
+		if entry.RequestID == "" {
+			entry.RequestID = id
+		} else {
+			details := make(map[string]interface{}, len(entry.Details)+1)
+			maps.Copy(details, entry.Details)
+			details["http_request_id"] = id
+			entry.Details = details
+		}
+	}
 	if entry.Timestamp.IsZero() {
 		entry.Timestamp = time.Now()
 	}
 
+	l.mu.Lock()
 	l.logs = append(l.logs, *entry)
-
 	// Trim old logs if exceeding max
 	if len(l.logs) > l.maxLogs {
 		l.logs = l.logs[len(l.logs)-l.maxLogs:]
 	}
+	l.mu.Unlock()
+
+	if l.repo != nil {
+		// Queued for replay while the database is unreachable
+		persisted := *entry
+		if err := l.repo.Write(ctx, "audit_log", func(ctx context.Context) error {
+			return l.repo.CreateAuditLog(ctx, &persisted)
+		}); err != nil {
+			log.Warn().Err(err).Str("audit_id", entry.ID).Msg("Failed to persist audit log")
+		}
+		l.recordPolicyMetrics(ctx, entry)
+	}
+
+	l.publishAuditLog(*entry)
 
 	log.Debug().
 		Str("audit_id", entry.ID).
@@ -59,11 +104,63 @@ func (l *Logger) Log(ctx context.Context, entry *models.AuditLog) error {
 	return nil
 }
 
-// Query retrieves audit logs based on query parameters
+// Export returns copies of the most recent audit logs (up to limit) and all alerts
+func (l *Logger) Export(limit int) ([]models.AuditLog, []models.Alert) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	start := 0
+	if limit > 0 && len(l.logs) > limit {
+		start = len(l.logs) - limit
+	}
+
+	logs := make([]models.AuditLog, len(l.logs)-start)
+	copy(logs, l.logs[start:])
+	alerts := make([]models.Alert, len(l.alerts))
+	copy(alerts, l.alerts)
+	return logs, alerts
+}
+
+// Import prepends previously exported logs and alerts, e.g. after a restart
+func (l *Logger) Import(logs []models.AuditLog, alerts []models.Alert) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.logs = append(append(make([]models.AuditLog, 0, len(logs)+len(l.logs)), logs...), l.logs...)
+	if len(l.logs) > l.maxLogs {
+		l.logs = l.logs[len(l.logs)-l.maxLogs:]
+	}
+	l.alerts = append(append(make([]models.Alert, 0, len(alerts)+len(l.alerts)), alerts...), l.alerts...)
+}
+
+// Remove deletes in-memory logs matching the predicate and returns them
+func (l *Logger) Remove(match func(*models.AuditLog) bool) []models.AuditLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var removed []models.AuditLog
+	kept := l.logs[:0]
+	for i := range l.logs {
+		if match(&l.logs[i]) {
+			removed = append(removed, l.logs[i])
+		} else {
+			kept = append(kept, l.logs[i])
+		}
+	}
+	l.logs = kept
+	return removed
+}
+
+// Query retrieves audit logs based on query parameters. Callers confined to
+// a tenant only see its logs.
 func (l *Logger) Query(ctx context.Context, query *models.AuditQuery) ([]models.AuditLog, int, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
+	if scope, ok := tenant.FromContext(ctx); ok {
+		query.TenantID = scope
+	}
+
 	var filtered []models.AuditLog
 
 	for _, entry := range l.logs {
@@ -106,9 +203,15 @@ func (l *Logger) matchesQuery(entry *models.AuditLog, query *models.AuditQuery)
 	if query.EndTime != nil && entry.Timestamp.After(*query.EndTime) {
 		return false
 	}
+	if query.TenantID != "" && tenant.Of(entry.TenantID) != query.TenantID {
+		return false
+	}
 	if query.UserID != "" && entry.UserID != query.UserID {
 		return false
 	}
+	if query.RequestID != "" && entry.RequestID != query.RequestID && entry.Details["http_request_id"] != query.RequestID {
+		return false
+	}
 	if query.ResourceType != "" && entry.ResourceType != query.ResourceType {
 		return false
 	}
@@ -130,8 +233,9 @@ func (l *Logger) matchesQuery(entry *models.AuditLog, query *models.AuditQuery)
 	return true
 }
 
-// GetStats returns aggregated statistics
-func (l *Logger) GetStats(ctx context.Context, period string) (*models.AuditStats, error) {
+// GetStats returns aggregated statistics. When a privacy policy is given,
+// per-user breakdowns are dropped and small groups are suppressed.
+func (l *Logger) GetStats(ctx context.Context, period string, p *privacy.Policy) (*models.AuditStats, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
@@ -160,11 +264,13 @@ func (l *Logger) GetStats(ctx context.Context, period string) (*models.AuditStat
 
 	userStats := make(map[string]*models.UserStats)
 	modelStats := make(map[string]*models.ModelStats)
+	groups := newStatsGroups()
 
 	for _, entry := range l.logs {
-		if entry.Timestamp.Before(startTime) {
+		if entry.Timestamp.Before(startTime) || !tenant.Visible(ctx, entry.TenantID) {
 			continue
 		}
+		groups.addStatsEntry(&entry)
 
 		stats.TotalRequests++
 		stats.EventsByType[string(entry.EventType)]++
@@ -231,133 +337,11 @@ func (l *Logger) GetStats(ctx context.Context, period string) (*models.AuditStat
 		stats.TopModels = append(stats.TopModels, *ms)
 	}
 
-	return stats, nil
-}
-
-// GetDashboardMetrics returns metrics for the dashboard
-func (l *Logger) GetDashboardMetrics(ctx context.Context) (*models.DashboardMetrics, error) {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-
-	now := time.Now()
-	last24h := now.Add(-24 * time.Hour)
-	prev24h := now.Add(-48 * time.Hour)
-
-	metrics := &models.DashboardMetrics{
-		Overview: models.OverviewMetrics{},
-		Security: models.SecurityMetrics{
-			ThreatsByLevel: make(map[string]int64),
-			TopThreatTypes: make(map[string]int64),
-		},
-		Usage: models.UsageMetrics{
-			RequestsByModel:    make(map[string]int64),
-			RequestsByProvider: make(map[string]int64),
-		},
-		Spending: models.SpendingMetrics{
-			SpendByUser:  make(map[string]float64),
-			SpendByModel: make(map[string]float64),
-		},
-		RecentAlerts: l.getRecentAlerts(10),
-		TopPolicies:  []models.PolicyMetric{},
+	if p != nil {
+		groups.protectStats(stats, p)
 	}
 
-	var current24h, prev24hCount int64
-	var currentUsers, prevUsers = make(map[string]bool), make(map[string]bool)
-	var currentBlocked, prevBlocked int64
-	var currentSpend, prevSpend float64
-
-	for _, entry := range l.logs {
-		if entry.Timestamp.After(last24h) {
-			current24h++
-			if entry.UserID != "" {
-				currentUsers[entry.UserID] = true
-			}
-			if entry.Status == models.AuditStatusBlocked {
-				currentBlocked++
-			}
-
-			// Security metrics
-			if entry.EventType == models.EventTypeSecurityAlert {
-				metrics.Security.InjectionAttempts24h++
-				if entry.Details != nil {
-					if level, ok := entry.Details["threat_level"].(string); ok {
-						metrics.Security.ThreatsByLevel[level]++
-					}
-					if threatType, ok := entry.Details["threat_type"].(string); ok {
-						metrics.Security.TopThreatTypes[threatType]++
-					}
-				}
-			}
-
-			// Usage metrics
-			if entry.Details != nil {
-				if tokens, ok := entry.Details["total_tokens"].(float64); ok {
-					metrics.Usage.TotalTokens24h += int64(tokens)
-				}
-				if promptTokens, ok := entry.Details["prompt_tokens"].(float64); ok {
-					metrics.Usage.PromptTokens24h += int64(promptTokens)
-				}
-				if completionTokens, ok := entry.Details["completion_tokens"].(float64); ok {
-					metrics.Usage.CompletionTokens24h += int64(completionTokens)
-				}
-				if model, ok := entry.Details["model"].(string); ok {
-					metrics.Usage.RequestsByModel[model]++
-				}
-				if provider, ok := entry.Details["provider"].(string); ok {
-					metrics.Usage.RequestsByProvider[provider]++
-				}
-				if cost, ok := entry.Details["cost"].(float64); ok {
-					currentSpend += cost
-					if entry.UserID != "" {
-						metrics.Spending.SpendByUser[entry.UserID] += cost
-					}
-					if model, ok := entry.Details["model"].(string); ok {
-						metrics.Spending.SpendByModel[model] += cost
-					}
-				}
-				if piiCount, ok := entry.Details["pii_count"].(float64); ok && piiCount > 0 {
-					metrics.Security.PIIDetections24h += int64(piiCount)
-				}
-			}
-		} else if entry.Timestamp.After(prev24h) {
-			prev24hCount++
-			if entry.UserID != "" {
-				prevUsers[entry.UserID] = true
-			}
-			if entry.Status == models.AuditStatusBlocked {
-				prevBlocked++
-			}
-			if entry.Details != nil {
-				if cost, ok := entry.Details["cost"].(float64); ok {
-					prevSpend += cost
-				}
-			}
-		}
-	}
-
-	// Calculate overview metrics
-	metrics.Overview.TotalRequests24h = current24h
-	metrics.Overview.ActiveUsers24h = int64(len(currentUsers))
-	metrics.Overview.BlockedRequests24h = currentBlocked
-	metrics.Overview.TotalSpend24h = currentSpend
-
-	// Calculate percentage changes
-	if prev24hCount > 0 {
-		metrics.Overview.RequestsChange = float64(current24h-prev24hCount) / float64(prev24hCount) * 100
-	}
-	if len(prevUsers) > 0 {
-		metrics.Overview.UsersChange = float64(len(currentUsers)-len(prevUsers)) / float64(len(prevUsers)) * 100
-	}
-	if prevBlocked > 0 {
-		metrics.Overview.BlockedChange = float64(currentBlocked-prevBlocked) / float64(prevBlocked) * 100
-	}
-	if prevSpend > 0 {
-		metrics.Overview.SpendChange = (currentSpend - prevSpend) / prevSpend * 100
-	}
-
-	metrics.Spending.TotalSpendToday = currentSpend
-
-	return metrics, nil
+	return stats, nil
 }
 
 // CreateAlert creates a new alert
@@ -371,9 +355,19 @@ func (l *Logger) CreateAlert(ctx context.Context, alert *models.Alert) error {
 	if alert.CreatedAt.IsZero() {
 		alert.CreatedAt = time.Now()
 	}
+	alert.TenantID = tenant.Assign(ctx, alert.TenantID)
 
 	l.alerts = append(l.alerts, *alert)
 
+	l.publish(Event{
+		Kind:      EventKindAlert,
+		EventType: alert.Type,
+		UserID:    alert.UserID,
+		TenantID:  alert.TenantID,
+		Timestamp: alert.CreatedAt,
+		Data:      *alert,
+	})
+
 	log.Warn().
 		Str("alert_id", alert.ID).
 		Str("type", alert.Type).
@@ -392,7 +386,7 @@ func (l *Logger) GetAlerts(ctx context.Context, limit int, includeAcked bool) ([
 	var filtered []models.Alert
 	for i := len(l.alerts) - 1; i >= 0 && len(filtered) < limit; i-- {
 		alert := l.alerts[i]
-		if includeAcked || alert.AckedAt == nil {
+		if (includeAcked || alert.AckedAt == nil) && tenant.Visible(ctx, alert.TenantID) {
 			filtered = append(filtered, alert)
 		}
 	}
@@ -400,10 +394,12 @@ func (l *Logger) GetAlerts(ctx context.Context, limit int, includeAcked bool) ([
 	return filtered, nil
 }
 
-func (l *Logger) getRecentAlerts(limit int) []models.Alert {
+func (l *Logger) getRecentAlerts(ctx context.Context, limit int) []models.Alert {
 	var recent []models.Alert
 	for i := len(l.alerts) - 1; i >= 0 && len(recent) < limit; i-- {
-		recent = append(recent, l.alerts[i])
+		if tenant.Visible(ctx, l.alerts[i].TenantID) {
+			recent = append(recent, l.alerts[i])
+		}
 	}
 	return recent
 }
@@ -414,7 +410,7 @@ func (l *Logger) AckAlert(ctx context.Context, alertID, userID string) error {
 	defer l.mu.Unlock()
 
 	for i := range l.alerts {
-		if l.alerts[i].ID == alertID {
+		if l.alerts[i].ID == alertID && tenant.Visible(ctx, l.alerts[i].TenantID) {
 			now := time.Now()
 			l.alerts[i].AckedAt = &now
 			l.alerts[i].AckedBy = userID
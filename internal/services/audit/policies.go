@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// topPoliciesLimit is the number of policies the dashboard lists
+const topPoliciesLimit = 5
+
+// policyCounts returns what an entry adds to the counts of the policies
+// that triggered on it
+func policyCounts(entry *models.AuditLog) []models.PolicyMetric {
+	var counts []models.PolicyMetric
+	for _, result := range entry.PolicyResults {
+		if !result.Matched || result.PolicyID == "" {
+			continue
+		}
+		m := models.PolicyMetric{PolicyID: result.PolicyID, PolicyName: result.PolicyName, TriggerCount: 1}
+		switch result.Action {
+		case models.ActionDeny, models.ActionThrottle:
+			m.BlockCount = 1
+		case models.ActionWarn:
+			m.WarnCount = 1
+		}
+		counts = append(counts, m)
+	}
+	return counts
+}
+
+// recordPolicyMetrics persists the policy counts of an entry, by the hour.
+// Without a database they are derived from the logs in memory instead.
+func (l *Logger) recordPolicyMetrics(ctx context.Context, entry *models.AuditLog) {
+	counts := policyCounts(entry)
+	if l.repo == nil || len(counts) == 0 {
+		return
+	}
+	tenantID, hour := entry.TenantID, entry.Timestamp.UTC().Truncate(time.Hour)
+	if err := l.repo.Write(ctx, "policy_metrics", func(ctx context.Context) error {
+		return l.repo.IncrementPolicyMetrics(ctx, tenantID, hour, counts)
+	}); err != nil {
+		log.Warn().Err(err).Str("audit_id", entry.ID).Msg("Failed to persist policy metrics")
+	}
+}
+
+// policyTotals sums policy counts by policy
+type policyTotals map[string]*models.PolicyMetric
+
+func (t policyTotals) add(counts []models.PolicyMetric) {
+	for _, c := range counts {
+		total, ok := t[c.PolicyID]
+		if !ok {
+			total = &models.PolicyMetric{PolicyID: c.PolicyID}
+			t[c.PolicyID] = total
+		}
+		// Entries are in order, so the latest name is kept
+		total.PolicyName = c.PolicyName
+		total.TriggerCount += c.TriggerCount
+		total.BlockCount += c.BlockCount
+		total.WarnCount += c.WarnCount
+	}
+}
+
+// top returns the policies that triggered most often, at most limit
+func (t policyTotals) top(limit int) []models.PolicyMetric {
+	top := make([]models.PolicyMetric, 0, len(t))
+	for _, m := range t {
+		top = append(top, *m)
+	}
+	slices.SortFunc(top, func(a, b models.PolicyMetric) int {
+		if c := cmp.Compare(b.TriggerCount, a.TriggerCount); c != 0 {
+			return c
+		}
+		return strings.Compare(a.PolicyID, b.PolicyID)
+	})
+	return top[:min(limit, len(top))]
+}
+
+// PolicyMetrics returns how often a policy triggered over the range of q,
+// in total and by hour or day. With a database the counts are kept by the
+// hour, so hours partly in the range count in full.
+func (l *Logger) PolicyMetrics(ctx context.Context, policyID string, q models.DashboardQuery) (*models.PolicyMetricsReport, error) {
+	q, err := resolveDashboardQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []models.PolicyMetricBucket
+	if l.repo != nil {
+		if buckets, err = l.repo.PolicyMetricTimeline(ctx, tenant.Filter(ctx), policyID, q.Start, q.End, q.Granularity); err != nil {
+			return nil, err
+		}
+	} else {
+		buckets = l.policyTimeline(ctx, policyID, q)
+	}
+
+	report := &models.PolicyMetricsReport{
+		PolicyMetric: models.PolicyMetric{PolicyID: policyID},
+		Start:        q.Start,
+		End:          q.End,
+		Granularity:  q.Granularity,
+		Timeline:     []models.PolicyMetricBucket{},
+	}
+	// Every bucket of the range is listed, including those without triggers
+	byStart := make(map[int64]models.PolicyMetricBucket, len(buckets))
+	for _, b := range buckets {
+		byStart[b.Start.Unix()] = b
+	}
+	for start := bucketStart(q.Start, q.Granularity); start.Before(q.End); start = start.Add(bucketStep(q.Granularity)) {
+		b := byStart[start.Unix()]
+		b.Start = start
+		report.Timeline = append(report.Timeline, b)
+		report.TriggerCount += b.TriggerCount
+		report.BlockCount += b.BlockCount
+		report.WarnCount += b.WarnCount
+	}
+	return report, nil
+}
+
+// policyTimeline counts a policy's triggers in the logs in memory
+func (l *Logger) policyTimeline(ctx context.Context, policyID string, q models.DashboardQuery) []models.PolicyMetricBucket {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	byStart := make(map[int64]*models.PolicyMetricBucket)
+	var buckets []models.PolicyMetricBucket
+	for i := range l.logs {
+		entry := &l.logs[i]
+		if !tenant.Visible(ctx, entry.TenantID) || entry.Timestamp.Before(q.Start) || !entry.Timestamp.Before(q.End) {
+			continue
+		}
+		for _, c := range policyCounts(entry) {
+			if c.PolicyID != policyID {
+				continue
+			}
+			start := bucketStart(entry.Timestamp, q.Granularity)
+			b, ok := byStart[start.Unix()]
+			if !ok {
+				b = &models.PolicyMetricBucket{Start: start}
+				byStart[start.Unix()] = b
+			}
+			b.TriggerCount += c.TriggerCount
+			b.BlockCount += c.BlockCount
+			b.WarnCount += c.WarnCount
+		}
+	}
+	for _, b := range byStart {
+		buckets = append(buckets, *b)
+	}
+	return buckets
+}
@@ -0,0 +1,201 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/privacy"
+)
+
+// statsGroups records which users contribute to each breakdown in the
+// statistics so small groups can be suppressed. Keys are prefixed with the
+// breakdown they belong to, e.g. "model:gpt-4o" or "hour:2024-01-01T10".
+type statsGroups struct {
+	privacy.Groups
+	sizes map[string]int // users by group when counted by the database instead
+}
+
+const groupAll = "all"
+
+func newStatsGroups() *statsGroups {
+	return &statsGroups{Groups: make(privacy.Groups)}
+}
+
+// users returns the number of distinct users contributing to a group
+func (g *statsGroups) users(group string) int {
+	if g.sizes != nil {
+		return g.sizes[group]
+	}
+	return g.Users(group)
+}
+
+func (g *statsGroups) addStatsEntry(entry *models.AuditLog) {
+	g.Add(groupAll, entry.UserID)
+	g.Add("hour:"+entry.Timestamp.Format("2006-01-02T15"), entry.UserID)
+	g.Add("event:"+string(entry.EventType), entry.UserID)
+	if model, ok := entry.Details["model"].(string); ok && model != "" {
+		g.Add("model:"+model, entry.UserID)
+	}
+}
+
+// protectCounts suppresses the keys of a breakdown whose group is too small
+// and adds noise to the rest, returning the number of suppressed keys
+func (g *statsGroups) protectCounts(counts map[string]int64, prefix string, p *privacy.Policy) int {
+	suppressed := 0
+	for key, n := range counts {
+		if !p.Allows(g.users(prefix + key)) {
+			delete(counts, key)
+			suppressed++
+			continue
+		}
+		counts[key] = p.Count(n)
+	}
+	return suppressed
+}
+
+func (g *statsGroups) protectCosts(costs map[string]float64, prefix string, p *privacy.Policy) int {
+	suppressed := 0
+	for key, v := range costs {
+		if !p.Allows(g.users(prefix + key)) {
+			delete(costs, key)
+			suppressed++
+			continue
+		}
+		costs[key] = p.Cost(v)
+	}
+	return suppressed
+}
+
+// protectStats applies a privacy policy to audit statistics in place
+func (g *statsGroups) protectStats(stats *models.AuditStats, p *privacy.Policy) {
+	// Every per-user row is a group of one
+	suppressed := len(stats.TopUsers)
+	stats.TopUsers = []models.UserStats{}
+
+	if !p.Allows(g.users(groupAll)) {
+		*stats = models.AuditStats{
+			Period:         stats.Period,
+			RequestsByHour: map[string]int64{},
+			EventsByType:   map[string]int64{},
+			TopUsers:       []models.UserStats{},
+			TopModels:      []models.ModelStats{},
+			Privacy:        p.Info(suppressed + 1),
+		}
+		return
+	}
+
+	stats.TotalRequests = p.Count(stats.TotalRequests)
+	stats.BlockedRequests = p.Count(stats.BlockedRequests)
+	stats.AllowedRequests = p.Count(stats.AllowedRequests)
+	stats.WarningRequests = p.Count(stats.WarningRequests)
+	stats.UniqueUsers = p.Count(stats.UniqueUsers)
+	stats.TotalTokensUsed = p.Tokens(stats.TotalTokensUsed)
+	stats.TotalCost = p.Cost(stats.TotalCost)
+
+	suppressed += g.protectCounts(stats.RequestsByHour, "hour:", p)
+	suppressed += g.protectCounts(stats.EventsByType, "event:", p)
+
+	topModels := make([]models.ModelStats, 0, len(stats.TopModels))
+	for _, ms := range stats.TopModels {
+		if !p.Allows(g.users("model:" + ms.Model)) {
+			suppressed++
+			continue
+		}
+		ms.RequestCount = p.Count(ms.RequestCount)
+		ms.TokensUsed = p.Tokens(ms.TokensUsed)
+		ms.TotalCost = p.Cost(ms.TotalCost)
+		topModels = append(topModels, ms)
+	}
+	stats.TopModels = topModels
+
+	stats.Privacy = p.Info(suppressed)
+}
+
+// protectDashboard applies a privacy policy to dashboard metrics in place
+func (g *statsGroups) protectDashboard(metrics *models.DashboardMetrics, p *privacy.Policy) {
+	// Policy counts don't record their users, so no policy is known to
+	// trigger for enough of them
+	suppressed := len(metrics.Spending.SpendByUser) + len(metrics.TopPolicies)
+	metrics.Spending.SpendByUser = map[string]float64{}
+	metrics.TopPolicies = []models.PolicyMetric{}
+	for i := range metrics.RecentAlerts {
+		metrics.RecentAlerts[i].UserID = ""
+	}
+
+	if !p.Allows(g.users(groupAll)) {
+		metrics.Overview = models.OverviewMetrics{}
+		metrics.Security = models.SecurityMetrics{
+			ThreatsByLevel: map[string]int64{},
+			TopThreatTypes: map[string]int64{},
+		}
+		metrics.Usage = models.UsageMetrics{
+			RequestsByModel:    map[string]int64{},
+			RequestsByProvider: map[string]int64{},
+		}
+		metrics.Spending = models.SpendingMetrics{
+			SpendByUser:  map[string]float64{},
+			SpendByModel: map[string]float64{},
+		}
+		for i, b := range metrics.Timeline {
+			metrics.Timeline[i] = models.MetricsBucket{Start: b.Start}
+		}
+		metrics.Privacy = p.Info(suppressed + 1)
+		return
+	}
+
+	o := &metrics.Overview
+	o.TotalRequests24h = p.Count(o.TotalRequests24h)
+	o.ActiveUsers24h = p.Count(o.ActiveUsers24h)
+	o.BlockedRequests24h = p.Count(o.BlockedRequests24h)
+	o.TotalSpend24h = p.Cost(o.TotalSpend24h)
+	metrics.Spending.TotalSpendToday = o.TotalSpend24h
+
+	sec := &metrics.Security
+	if p.Allows(g.users("injection")) {
+		sec.InjectionAttempts24h = p.Count(sec.InjectionAttempts24h)
+	} else if sec.InjectionAttempts24h > 0 {
+		sec.InjectionAttempts24h = 0
+		suppressed++
+	}
+	if p.Allows(g.users("pii")) {
+		sec.PIIDetections24h = p.Count(sec.PIIDetections24h)
+	} else if sec.PIIDetections24h > 0 {
+		sec.PIIDetections24h = 0
+		suppressed++
+	}
+	suppressed += g.protectCounts(sec.ThreatsByLevel, "level:", p)
+	suppressed += g.protectCounts(sec.TopThreatTypes, "threat:", p)
+
+	usage := &metrics.Usage
+	usage.TotalTokens24h = p.Tokens(usage.TotalTokens24h)
+	usage.PromptTokens24h = p.Tokens(usage.PromptTokens24h)
+	usage.CompletionTokens24h = p.Tokens(usage.CompletionTokens24h)
+	suppressed += g.protectCounts(usage.RequestsByModel, "model:", p)
+	suppressed += g.protectCounts(usage.RequestsByProvider, "provider:", p)
+
+	suppressed += g.protectCosts(metrics.Spending.SpendByModel, "model:", p)
+
+	suppressed += g.protectTimeline(metrics.Timeline, metrics.Granularity, p)
+
+	metrics.Privacy = p.Info(suppressed)
+}
+
+// protectTimeline suppresses the hours or days whose group is too small,
+// zeroing them so the timeline stays complete, and adds noise to the rest
+func (g *statsGroups) protectTimeline(buckets []models.MetricsBucket, granularity string, p *privacy.Policy) int {
+	suppressed := 0
+	for i, b := range buckets {
+		if !p.Allows(g.users(granularity + ":" + b.Start.Format(time.RFC3339))) {
+			if b.Requests > 0 {
+				suppressed++
+			}
+			buckets[i] = models.MetricsBucket{Start: b.Start}
+			continue
+		}
+		buckets[i].Requests = p.Count(b.Requests)
+		buckets[i].Blocked = p.Count(b.Blocked)
+		buckets[i].Tokens = p.Tokens(b.Tokens)
+		buckets[i].Cost = p.Cost(b.Cost)
+	}
+	return suppressed
+}
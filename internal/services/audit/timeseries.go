@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/privacy"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// Timeseries returns the requests, blocks, tokens and cost of every hour or
+// day of the range of q, counting the logs that pass filter. Like the
+// dashboard, it is computed from the database and reused briefly when
+// there is one, and protected by the privacy policy when one is given.
+func (l *Logger) Timeseries(ctx context.Context, q models.DashboardQuery, filter models.MetricsFilter, p *privacy.Policy) (*models.Timeseries, error) {
+	q, err := resolveDashboardQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	groups := l.timeseriesGroups(ctx, q, filter)
+
+	series := &models.Timeseries{
+		Start:       q.Start,
+		End:         q.End,
+		Granularity: q.Granularity,
+		Buckets:     timeline(q, groups),
+	}
+	if p != nil {
+		sizes := groupSizes(map[string][]models.MetricsGroup{q.Granularity: groups})
+		series.Privacy = p.Info(sizes.protectTimeline(series.Buckets, q.Granularity, p))
+	}
+	return series, nil
+}
+
+// timeseriesGroups aggregates the logs of a time series by hour or day.
+// When the database can't be queried the logs in memory are used instead.
+func (l *Logger) timeseriesGroups(ctx context.Context, q models.DashboardQuery, filter models.MetricsFilter) []models.MetricsGroup {
+	if l.repo == nil {
+		return l.groupMemory(ctx, q.Start, q.End, q.Granularity, filter)
+	}
+
+	users := "*"
+	if filter.UserIDs != nil {
+		sorted := slices.Sorted(slices.Values(filter.UserIDs))
+		users = strings.Join(sorted, ",")
+	}
+	key := fmt.Sprintf("timeseries:%s:%d:%d:%s:%q:%q:%q", tenant.Filter(ctx), q.Start.UnixNano(), q.End.UnixNano(),
+		q.Granularity, users, filter.Model, filter.Provider)
+	var groups []models.MetricsGroup
+	found, err := l.dashboardCache.Get(ctx, key, &groups)
+	if err != nil {
+		log.Warn().Err(err).Msg("Dashboard cache read failed")
+	}
+	if found {
+		return groups
+	}
+
+	groups, err = l.repo.DashboardGroups(ctx, tenant.Filter(ctx), q.Start, q.End, q.Granularity, filter)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to query metrics time series - using in-memory audit logs")
+		return l.groupMemory(ctx, q.Start, q.End, q.Granularity, filter)
+	}
+	if err := l.dashboardCache.Set(ctx, key, groups, 0); err != nil {
+		log.Warn().Err(err).Msg("Dashboard cache write failed")
+	}
+	return groups
+}
+
+// Groups aggregates the audit logs created between start and end that pass
+// filter by a dashboard breakdown, from the database when there is one
+func (l *Logger) Groups(ctx context.Context, start, end time.Time, breakdown string, filter models.MetricsFilter) ([]models.MetricsGroup, error) {
+	if l.repo != nil {
+		return l.repo.DashboardGroups(ctx, tenant.Filter(ctx), start, end, breakdown, filter)
+	}
+	return l.groupMemory(ctx, start, end, breakdown, filter), nil
+}
+
+// groupMemory aggregates the logs in memory that pass filter by a
+// breakdown, like the database does
+func (l *Logger) groupMemory(ctx context.Context, start, end time.Time, breakdown string, filter models.MetricsFilter) []models.MetricsGroup {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	totals := make(groupTotals)
+	for i := range l.logs {
+		entry := &l.logs[i]
+		if !tenant.Visible(ctx, entry.TenantID) || entry.Timestamp.Before(start) || !entry.Timestamp.Before(end) ||
+			!passesFilter(entry, filter) {
+			continue
+		}
+		if key, ok := breakdownKey(entry, breakdown); ok {
+			totals.add(breakdown, key, entry)
+		}
+	}
+	return totals.groups()[breakdown]
+}
+
+func passesFilter(entry *models.AuditLog, filter models.MetricsFilter) bool {
+	if filter.UserIDs != nil && !slices.Contains(filter.UserIDs, entry.UserID) {
+		return false
+	}
+	if model, _ := entry.Details["model"].(string); filter.Model != "" && model != filter.Model {
+		return false
+	}
+	if provider, _ := entry.Details["provider"].(string); filter.Provider != "" && provider != filter.Provider {
+		return false
+	}
+	return true
+}
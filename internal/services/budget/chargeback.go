@@ -0,0 +1,166 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// Chargeback dimensions
+const (
+	DimensionProject = "project"
+	DimensionTeam    = "team"
+	DimensionModel   = "model"
+)
+
+// ErrInvalidReport is returned for an invalid date range or dimension
+var ErrInvalidReport = errors.New("invalid report")
+
+// Dimensions lists the dimensions a chargeback report can group by
+var Dimensions = []string{DimensionProject, DimensionTeam, DimensionModel}
+
+// Chargeback sums request costs in [start, end) grouped by the given
+// dimensions, most expensive first. Costs come from usage records; without
+// a database, from the in-memory audit log.
+func (s *Service) Chargeback(ctx context.Context, start, end time.Time, groupBy []string) (*models.ChargebackReport, error) {
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: end must be after start", ErrInvalidReport)
+	}
+	if len(groupBy) == 0 {
+		groupBy = Dimensions
+	}
+	keep := make(map[string]bool, len(groupBy))
+	for _, d := range groupBy {
+		switch d {
+		case DimensionProject, DimensionTeam, DimensionModel:
+			keep[d] = true
+		default:
+			return nil, fmt.Errorf("%w: unknown dimension %q (use project, team, or model)", ErrInvalidReport, d)
+		}
+	}
+
+	var usage []models.ChargebackLine
+	var err error
+	if s.repo != nil {
+		usage, err = s.repo.ChargebackUsage(ctx, tenant.Filter(ctx), start, end)
+	} else {
+		usage, err = s.memoryUsage(ctx, start, end)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ChargebackReport{
+		Start:    start,
+		End:      end,
+		GroupBy:  groupBy,
+		Currency: "USD",
+		Lines:    []models.ChargebackLine{},
+	}
+	lines := make(map[models.ChargebackLine]*models.ChargebackLine)
+	for _, u := range usage {
+		key := models.ChargebackLine{}
+		if keep[DimensionProject] {
+			key.Project = u.Project
+		}
+		if keep[DimensionTeam] {
+			key.Team = u.Team
+		}
+		if keep[DimensionModel] {
+			key.Model = u.Model
+		}
+
+		line, ok := lines[key]
+		if !ok {
+			copied := key
+			line = &copied
+			lines[key] = line
+		}
+		line.RequestCount += u.RequestCount
+		line.PromptTokens += u.PromptTokens
+		line.CompletionTokens += u.CompletionTokens
+		line.TotalCost += u.TotalCost
+
+		report.TotalCount += u.RequestCount
+		report.TotalCost += u.TotalCost
+	}
+
+	for _, line := range lines {
+		line.TotalCost = roundCost(line.TotalCost)
+		report.Lines = append(report.Lines, *line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		a, b := report.Lines[i], report.Lines[j]
+		if a.TotalCost != b.TotalCost {
+			return a.TotalCost > b.TotalCost
+		}
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Team != b.Team {
+			return a.Team < b.Team
+		}
+		return a.Model < b.Model
+	})
+	report.TotalCost = roundCost(report.TotalCost)
+	return report, nil
+}
+
+// memoryUsage aggregates the in-memory audit log when running without a database
+func (s *Service) memoryUsage(ctx context.Context, start, end time.Time) ([]models.ChargebackLine, error) {
+	if s.auditLogger == nil {
+		return nil, nil
+	}
+	entries, _, err := s.auditLogger.Query(ctx, &models.AuditQuery{
+		StartTime:  &start,
+		EndTime:    &end,
+		EventTypes: []models.AuditEventType{models.EventTypeRequest},
+		Limit:      math.MaxInt32,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[[3]string]*models.ChargebackLine)
+	for _, entry := range entries {
+		cost, ok := entry.Details["cost"].(float64)
+		if !ok || !entry.Timestamp.Before(end) {
+			continue
+		}
+		project, _ := entry.Details["project"].(string)
+		team, _ := entry.Details["team"].(string)
+		model, _ := entry.Details["model"].(string)
+
+		key := [3]string{project, team, model}
+		line, ok := lines[key]
+		if !ok {
+			line = &models.ChargebackLine{Project: project, Team: team, Model: model}
+			lines[key] = line
+		}
+		line.RequestCount++
+		if tokens, ok := entry.Details["prompt_tokens"].(float64); ok {
+			line.PromptTokens += int64(tokens)
+		}
+		if tokens, ok := entry.Details["completion_tokens"].(float64); ok {
+			line.CompletionTokens += int64(tokens)
+		}
+		line.TotalCost += cost
+	}
+
+	usage := make([]models.ChargebackLine, 0, len(lines))
+	for _, line := range lines {
+		usage = append(usage, *line)
+	}
+	return usage, nil
+}
+
+// roundCost rounds to the precision costs are stored with
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e6) / 1e6
+}
@@ -0,0 +1,394 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// ErrInvalidBudget is returned for budgets with missing or invalid fields
+var ErrInvalidBudget = errors.New("invalid budget")
+
+// Attribution is the project and team a request's cost is charged to
+type Attribution struct {
+	UserID  string
+	Project string
+	Team    string
+	Groups  []string
+}
+
+// covers reports whether a budget applies to the attribution
+func covers(b *models.Budget, a Attribution) bool {
+	switch b.Scope {
+	case models.BudgetScopeProject:
+		return a.Project != "" && b.Target == a.Project
+	case models.BudgetScopeGroup:
+		return b.Target == a.Team || slices.Contains(a.Groups, b.Target)
+	case models.BudgetScopeGlobal:
+		return true
+	}
+	return false
+}
+
+// periodEnd returns when the period containing t ends. Periods are aligned
+// to UTC; weeks start on Monday.
+func periodEnd(period string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "daily":
+		return day.AddDate(0, 0, 1)
+	case "weekly":
+		return day.AddDate(0, 0, 7-(int(day.Weekday())+6)%7)
+	default:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Service manages group, project and global budgets and charges request costs to them
+type Service struct {
+	cfg         config.BudgetConfig
+	repo        *database.Repository
+	auditLogger *audit.Logger
+	budgets     map[string]*models.Budget
+	mu          sync.Mutex
+}
+
+// NewService creates a budget service; budgets are kept in memory when repo is nil
+func NewService(cfg config.BudgetConfig, repo *database.Repository, logger *audit.Logger) *Service {
+	return &Service{
+		cfg:         cfg,
+		repo:        repo,
+		auditLogger: logger,
+		budgets:     make(map[string]*models.Budget),
+	}
+}
+
+// Attribute resolves the project and team of a request from its metadata
+// tags. Without a team tag the request is charged to the user's first group.
+func (s *Service) Attribute(userID string, metadata map[string]string, groups []string) Attribution {
+	a := Attribution{
+		UserID:  userID,
+		Project: metadata[s.cfg.ProjectTag],
+		Team:    metadata[s.cfg.TeamTag],
+		Groups:  groups,
+	}
+	if a.Team == "" && len(groups) > 0 {
+		a.Team = groups[0]
+	}
+	return a
+}
+
+// validate checks a budget and fills in defaults
+func validate(b *models.Budget) error {
+	if b.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidBudget)
+	}
+	switch b.Scope {
+	case models.BudgetScopeGroup, models.BudgetScopeProject:
+		if b.Target == "" {
+			return fmt.Errorf("%w: target is required", ErrInvalidBudget)
+		}
+	case models.BudgetScopeGlobal:
+		if b.Target != "" {
+			return fmt.Errorf("%w: global budgets take no target", ErrInvalidBudget)
+		}
+	default:
+		return fmt.Errorf("%w: scope must be %q, %q or %q", ErrInvalidBudget,
+			models.BudgetScopeGroup, models.BudgetScopeProject, models.BudgetScopeGlobal)
+	}
+	switch b.Period {
+	case "":
+		b.Period = "monthly"
+	case "daily", "weekly", "monthly":
+	default:
+		return fmt.Errorf("%w: period must be daily, weekly, or monthly", ErrInvalidBudget)
+	}
+	if b.LimitAmount <= 0 {
+		return fmt.Errorf("%w: limit_amount must be positive", ErrInvalidBudget)
+	}
+	if b.Currency == "" {
+		b.Currency = "USD"
+	}
+	return nil
+}
+
+// Create adds a budget starting in the current period with nothing spent
+func (s *Service) Create(ctx context.Context, b *models.Budget) (*models.Budget, error) {
+	if err := validate(b); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	b.ID = uuid.New().String()
+	b.TenantID = tenant.Assign(ctx, b.TenantID)
+	b.CurrentSpend = 0
+	b.ResetAt = periodEnd(b.Period, now)
+	b.CreatedAt = now
+	b.UpdatedAt = now
+
+	if s.repo != nil {
+		if err := s.repo.CreateBudget(ctx, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *b
+	s.budgets[b.ID] = &copied
+	return b, nil
+}
+
+// Get retrieves a budget by ID
+func (s *Service) Get(ctx context.Context, id string) (*models.Budget, error) {
+	if s.repo != nil {
+		b, err := s.repo.GetBudget(ctx, id)
+		if err != nil || !tenant.Visible(ctx, b.TenantID) {
+			return nil, fmt.Errorf("budget not found: %s", id)
+		}
+		return b, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.budgets[id]
+	if !ok || !tenant.Visible(ctx, b.TenantID) {
+		return nil, fmt.Errorf("budget not found: %s", id)
+	}
+	copied := *b
+	return &copied, nil
+}
+
+// List returns all budgets of the tenant ctx is confined to
+func (s *Service) List(ctx context.Context) ([]*models.Budget, error) {
+	if s.repo != nil {
+		budgets, err := s.repo.ListBudgets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(budgets, func(b *models.Budget) bool { return !tenant.Visible(ctx, b.TenantID) }), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	budgets := make([]*models.Budget, 0, len(s.budgets))
+	for _, b := range s.budgets {
+		if !tenant.Visible(ctx, b.TenantID) {
+			continue
+		}
+		copied := *b
+		budgets = append(budgets, &copied)
+	}
+	slices.SortFunc(budgets, func(a, b *models.Budget) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return budgets, nil
+}
+
+// Update changes a budget's settings. Spend carries over unless the period
+// changes, which starts a new period.
+func (s *Service) Update(ctx context.Context, b *models.Budget) (*models.Budget, error) {
+	if err := validate(b); err != nil {
+		return nil, err
+	}
+	existing, err := s.Get(ctx, b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	b.TenantID = existing.TenantID
+	b.CurrentSpend = existing.CurrentSpend
+	b.ResetAt = existing.ResetAt
+	if b.Period != existing.Period {
+		b.CurrentSpend = 0
+		b.ResetAt = periodEnd(b.Period, time.Now())
+	}
+	b.CreatedAt = existing.CreatedAt
+	b.UpdatedAt = time.Now()
+
+	if err := s.save(ctx, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Delete removes a budget
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	if s.repo != nil {
+		return s.repo.DeleteBudget(ctx, id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.budgets[id]; !ok {
+		return fmt.Errorf("budget not found: %s", id)
+	}
+	delete(s.budgets, id)
+	return nil
+}
+
+func (s *Service) save(ctx context.Context, b *models.Budget) error {
+	if s.repo != nil {
+		return s.repo.UpdateBudget(ctx, b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.budgets[b.ID]; !ok {
+		return fmt.Errorf("budget not found: %s", b.ID)
+	}
+	copied := *b
+	s.budgets[b.ID] = &copied
+	return nil
+}
+
+// covering returns the budgets of the request's tenant that apply to the
+// attribution, starting a new period for any whose period has ended
+func (s *Service) covering(ctx context.Context, a Attribution) ([]*models.Budget, error) {
+	budgets, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	current := tenant.Current(ctx)
+	matched := budgets[:0]
+	for _, b := range budgets {
+		if tenant.Of(b.TenantID) != current || !covers(b, a) {
+			continue
+		}
+		if !now.Before(b.ResetAt) {
+			b.CurrentSpend = 0
+			b.ResetAt = periodEnd(b.Period, now)
+			b.UpdatedAt = now
+			if err := s.save(ctx, b); err != nil {
+				log.Warn().Err(err).Str("budget_id", b.ID).Msg("Failed to reset budget")
+			}
+		}
+		matched = append(matched, b)
+	}
+	return matched, nil
+}
+
+// Exhausted returns the first enforced budget covering the attribution that
+// has been spent, or nil if the request may proceed
+func (s *Service) Exhausted(ctx context.Context, a Attribution) *models.Budget {
+	budgets, err := s.covering(ctx, a)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to check budgets")
+		return nil
+	}
+	for _, b := range budgets {
+		if b.Enforce && b.CurrentSpend >= b.LimitAmount {
+			return b
+		}
+	}
+	return nil
+}
+
+// Remaining returns what is left of the budget covering the attribution
+// that has the least left. It reports false when no budget applies.
+func (s *Service) Remaining(ctx context.Context, a Attribution) (float64, bool) {
+	budgets, err := s.covering(ctx, a)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to check budgets")
+		return 0, false
+	}
+	if len(budgets) == 0 {
+		return 0, false
+	}
+	least := budgets[0].LimitAmount - budgets[0].CurrentSpend
+	for _, b := range budgets[1:] {
+		least = min(least, b.LimitAmount-b.CurrentSpend)
+	}
+	return max(least, 0), true
+}
+
+// Record charges a request's cost to every budget covering it
+func (s *Service) Record(ctx context.Context, a Attribution, cost float64) {
+	if cost <= 0 {
+		return
+	}
+	budgets, err := s.covering(ctx, a)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to record budget spend")
+		return
+	}
+
+	for _, b := range budgets {
+		spend, err := s.addSpend(ctx, b.ID, cost)
+		if err != nil {
+			log.Warn().Err(err).Str("budget_id", b.ID).Msg("Failed to record budget spend")
+			continue
+		}
+		b.CurrentSpend = spend
+		// Only the request that crosses the threshold alerts
+		if b.AlertAt > 0 {
+			threshold := b.LimitAmount * b.AlertAt / 100
+			if spend-cost < threshold && spend >= threshold {
+				s.alert(ctx, b, a, threshold)
+			}
+		}
+	}
+}
+
+func (s *Service) addSpend(ctx context.Context, id string, cost float64) (float64, error) {
+	if s.repo != nil {
+		return s.repo.AddBudgetSpend(ctx, id, cost)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.budgets[id]
+	if !ok {
+		return 0, fmt.Errorf("budget not found: %s", id)
+	}
+	b.CurrentSpend += cost
+	b.UpdatedAt = time.Now()
+	return b.CurrentSpend, nil
+}
+
+// alert records that a budget crossed its alert threshold
+func (s *Service) alert(ctx context.Context, b *models.Budget, a Attribution, threshold float64) {
+	log.Warn().
+		Str("budget_id", b.ID).
+		Str("scope", string(b.Scope)).
+		Str("target", b.Target).
+		Float64("current_spend", b.CurrentSpend).
+		Float64("alert_threshold", threshold).
+		Msg("Budget alert threshold reached")
+
+	if s.auditLogger == nil {
+		return
+	}
+	s.auditLogger.Log(ctx, &models.AuditLog{
+		EventType:    models.EventTypeSpendingAlert,
+		Action:       "budget_threshold",
+		UserID:       a.UserID,
+		ResourceType: "budget",
+		ResourceID:   b.ID,
+		Status:       models.AuditStatusWarning,
+		Details: map[string]interface{}{
+			"budget":        b.Name,
+			"scope":         b.Scope,
+			"target":        b.Target,
+			"current_spend": b.CurrentSpend,
+			"limit_amount":  b.LimitAmount,
+			"alert_at":      b.AlertAt,
+		},
+	})
+}
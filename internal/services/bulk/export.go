@@ -0,0 +1,249 @@
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/jobs"
+)
+
+const (
+	// maxExportRows bounds the rows one export writes
+	maxExportRows = 100000
+	// exportPage is how many rows are read at a time
+	exportPage = 1000
+)
+
+// auditExportParams filters the audit entries exported, like the query
+// parameters of the audit log endpoint
+type auditExportParams struct {
+	Format       string     `json:"format,omitempty"`
+	UserID       string     `json:"user_id,omitempty"`
+	RequestID    string     `json:"request_id,omitempty"`
+	ResourceType string     `json:"resource_type,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	TenantID     string     `json:"tenant_id,omitempty"`
+	EventTypes   []string   `json:"event_types,omitempty"`
+	StartTime    *time.Time `json:"start_time,omitempty"`
+	EndTime      *time.Time `json:"end_time,omitempty"`
+}
+
+// usageExportParams filters the usage records exported
+type usageExportParams struct {
+	Format    string     `json:"format,omitempty"`
+	UserID    string     `json:"user_id,omitempty"`
+	Project   string     `json:"project,omitempty"`
+	Model     string     `json:"model,omitempty"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+func validateFormat(format string) error {
+	switch format {
+	case "", FormatNDJSON, FormatCSV:
+		return nil
+	}
+	return fmt.Errorf("%w: format must be %s or %s", ErrInvalidJob, FormatNDJSON, FormatCSV)
+}
+
+func validateAuditExport(params json.RawMessage) error {
+	var p auditExportParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	return validateFormat(p.Format)
+}
+
+func validateUsageExport(params json.RawMessage) error {
+	var p usageExportParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	return validateFormat(p.Format)
+}
+
+// runAuditExport writes the audit entries matching the job's filters, newest
+// first
+func (s *Service) runAuditExport(ctx context.Context, job *models.Job, progress jobs.Progress) (interface{}, error) {
+	var p auditExportParams
+	ctx, err := open(ctx, job, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.AuditQuery{
+		UserID:       p.UserID,
+		RequestID:    p.RequestID,
+		ResourceType: p.ResourceType,
+		Status:       models.AuditStatus(p.Status),
+		TenantID:     p.TenantID,
+		StartTime:    p.StartTime,
+		EndTime:      p.EndTime,
+	}
+	for _, t := range p.EventTypes {
+		query.EventTypes = append(query.EventTypes, models.AuditEventType(t))
+	}
+	// Entries logged while the export runs would shift the pages
+	if query.EndTime == nil {
+		now := time.Now()
+		query.EndTime = &now
+	}
+
+	out := newExport(p.Format, "audit-logs", []string{"timestamp", "id", "tenant_id", "event_type", "action", "status", "user_id", "user_email", "resource_type", "resource_id", "request_id", "ip_address", "duration_ms", "details"})
+	for out.rows < maxExportRows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		query.Offset, query.Limit = out.rows, min(exportPage, maxExportRows-out.rows)
+		logs, total, err := s.audit.Query(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for i := range logs {
+			entry := &logs[i]
+			details, _ := json.Marshal(entry.Details)
+			out.write(entry, []string{
+				entry.Timestamp.UTC().Format(time.RFC3339Nano),
+				entry.ID,
+				entry.TenantID,
+				string(entry.EventType),
+				entry.Action,
+				string(entry.Status),
+				entry.UserID,
+				entry.UserEmail,
+				entry.ResourceType,
+				entry.ResourceID,
+				entry.RequestID,
+				entry.IPAddress,
+				strconv.FormatInt(entry.Duration.Milliseconds(), 10),
+				string(details),
+			})
+		}
+		progress(out.rows, min(total, maxExportRows))
+		if len(logs) < query.Limit {
+			break
+		}
+	}
+	return out.file()
+}
+
+// runUsageExport writes the usage records matching the job's filters,
+// newest first
+func (s *Service) runUsageExport(ctx context.Context, job *models.Job, progress jobs.Progress) (interface{}, error) {
+	var p usageExportParams
+	ctx, err := open(ctx, job, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &models.UsageQuery{
+		UserID:    p.UserID,
+		Project:   p.Project,
+		Model:     p.Model,
+		StartTime: p.StartTime,
+		EndTime:   p.EndTime,
+	}
+	if query.EndTime == nil {
+		now := time.Now()
+		query.EndTime = &now
+	}
+
+	out := newExport(p.Format, "usage", []string{"created_at", "id", "request_id", "user_id", "project", "team", "provider", "model", "prompt_tokens", "completion_tokens", "total_tokens", "cost", "currency"})
+	for out.rows < maxExportRows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		query.Offset, query.Limit = out.rows, min(exportPage, maxExportRows-out.rows)
+		records, summary, err := s.spending.ListUsage(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			out.write(r, []string{
+				r.CreatedAt.UTC().Format(time.RFC3339Nano),
+				r.ID,
+				r.RequestID,
+				r.UserID,
+				r.Project,
+				r.Team,
+				r.Provider,
+				r.Model,
+				strconv.Itoa(r.PromptTokens),
+				strconv.Itoa(r.CompletionTokens),
+				strconv.Itoa(r.TotalTokens),
+				strconv.FormatFloat(r.Cost, 'f', 6, 64),
+				r.Currency,
+			})
+		}
+		progress(out.rows, min(int(summary.Count), maxExportRows))
+		if len(records) < query.Limit {
+			break
+		}
+	}
+	return out.file()
+}
+
+// export accumulates the rows of an export as JSON lines or CSV
+type export struct {
+	format string
+	name   string
+	buf    bytes.Buffer
+	csv    *csv.Writer
+	rows   int
+	err    error
+}
+
+func newExport(format, name string, header []string) *export {
+	e := &export{format: format, name: name}
+	if e.format == "" {
+		e.format = FormatNDJSON
+	}
+	if e.format == FormatCSV {
+		e.csv = csv.NewWriter(&e.buf)
+		e.csv.Write(header)
+	}
+	return e
+}
+
+// write adds a row: v as a JSON line, or columns as a CSV record
+func (e *export) write(v interface{}, columns []string) {
+	e.rows++
+	if e.csv != nil {
+		e.csv.Write(columns)
+		return
+	}
+	line, err := json.Marshal(v)
+	if err != nil && e.err == nil {
+		e.err = err
+	}
+	e.buf.Write(line)
+	e.buf.WriteByte('\n')
+}
+
+func (e *export) file() (*models.JobFile, error) {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return nil, err
+		}
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	f := &models.JobFile{
+		Filename:    e.name + "-" + time.Now().UTC().Format("20060102-150405") + "." + e.format,
+		ContentType: "application/x-ndjson",
+		Content:     e.buf.String(),
+		Rows:        e.rows,
+	}
+	if e.format == FormatCSV {
+		f.ContentType = "text/csv; charset=utf-8"
+	}
+	return f, nil
+}
@@ -0,0 +1,85 @@
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/bundle"
+	"github.com/epps11/goguard/internal/services/jobs"
+	"github.com/epps11/goguard/internal/services/policy"
+)
+
+// bundleImportParams is a bundle to apply, as a JSON object or as YAML in a
+// string, with the options of the bundle endpoint
+type bundleImportParams struct {
+	Bundle json.RawMessage `json:"bundle"`
+	DryRun bool            `json:"dry_run,omitempty"`
+	Prune  bool            `json:"prune,omitempty"`
+}
+
+// parse returns the bundle of the params
+func (p *bundleImportParams) parse() (*bundle.Bundle, error) {
+	data := []byte(p.Bundle)
+	var text string
+	if json.Unmarshal(p.Bundle, &text) == nil {
+		data = []byte(text)
+	}
+	return bundle.Parse(data)
+}
+
+func validateBundleImport(params json.RawMessage) error {
+	var p bundleImportParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	if len(p.Bundle) == 0 {
+		return fmt.Errorf("%w: bundle is required", ErrInvalidJob)
+	}
+	b, err := p.parse()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	if err := b.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	return nil
+}
+
+// runBundleImport applies a bundle as the caller who queued the job, and
+// records the changes in the audit log
+func (s *Service) runBundleImport(ctx context.Context, job *models.Job, progress jobs.Progress) (interface{}, error) {
+	var p bundleImportParams
+	ctx, err := open(ctx, job, &p)
+	if err != nil {
+		return nil, err
+	}
+	b, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	progress(0, len(b.Policies)+len(b.SpendingLimits))
+	result, err := s.bundles.Apply(policy.WithActor(ctx, job.CreatedBy), b, bundle.ApplyOptions{DryRun: p.DryRun, Prune: p.Prune})
+	if result != nil && !p.DryRun && len(result.Changes) > 0 {
+		status := models.AuditStatusSuccess
+		if err != nil {
+			status = models.AuditStatusFailure
+		}
+		s.audit.Log(ctx, &models.AuditLog{
+			EventType:    models.EventTypePolicyChange,
+			Action:       "bundle_import",
+			UserID:       job.CreatedBy,
+			ResourceType: "job",
+			ResourceID:   job.ID,
+			Status:       status,
+			Details:      map[string]interface{}{"summary": result.Summary, "changes": result.Changes},
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	progress(len(b.Policies)+len(b.SpendingLimits), len(b.Policies)+len(b.SpendingLimits))
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/jobs"
+)
+
+// maxScanItems bounds the items of one batch scan
+const maxScanItems = 10000
+
+// scanItem is a prompt to scan: a text, taken as a user message, or messages
+type scanItem struct {
+	ID       string           `json:"id"`
+	Text     string           `json:"text,omitempty"`
+	Messages []models.Message `json:"messages,omitempty"`
+}
+
+type batchScanParams struct {
+	Items []scanItem `json:"items"`
+}
+
+// scanResult is what was found in one item; PII values are never reported
+type scanResult struct {
+	ID                string   `json:"id"`
+	InjectionDetected bool     `json:"injection_detected"`
+	ThreatLevel       string   `json:"threat_level"`
+	Detections        int      `json:"detections"`
+	PIIDetected       bool     `json:"pii_detected"`
+	PIICount          int      `json:"pii_count"`
+	PIITypes          []string `json:"pii_types,omitempty"`
+}
+
+// scanSummary counts the findings of a batch scan
+type scanSummary struct {
+	Scanned           int            `json:"scanned"`
+	InjectionDetected int            `json:"injection_detected"`
+	ThreatLevels      map[string]int `json:"threat_levels"`
+	PIIDetected       int            `json:"pii_detected"`
+	PIITypes          map[string]int `json:"pii_types"`
+}
+
+type batchScanResult struct {
+	Summary scanSummary  `json:"summary"`
+	Items   []scanResult `json:"items"`
+}
+
+func validateBatchScan(params json.RawMessage) error {
+	var p batchScanParams
+	if err := decode(params, &p); err != nil {
+		return err
+	}
+	if len(p.Items) == 0 || len(p.Items) > maxScanItems {
+		return fmt.Errorf("%w: items must have between 1 and %d entries", ErrInvalidJob, maxScanItems)
+	}
+	for i, item := range p.Items {
+		if item.Text == "" && len(item.Messages) == 0 {
+			return fmt.Errorf("%w: items[%d] needs text or messages", ErrInvalidJob, i)
+		}
+	}
+	return nil
+}
+
+// runBatchScan checks each item for injections and PII with the running
+// configuration, like the analyze endpoint
+func (s *Service) runBatchScan(ctx context.Context, job *models.Job, progress jobs.Progress) (interface{}, error) {
+	var p batchScanParams
+	ctx, err := open(ctx, job, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := batchScanResult{
+		Summary: scanSummary{ThreatLevels: make(map[string]int), PIITypes: make(map[string]int)},
+		Items:   make([]scanResult, 0, len(p.Items)),
+	}
+	for i, item := range p.Items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		messages := item.Messages
+		if len(messages) == 0 {
+			messages = []models.Message{{Role: "user", Content: item.Text}}
+		}
+		id := item.ID
+		if id == "" {
+			id = fmt.Sprint(i)
+		}
+
+		security := s.detector.Analyze(messages)
+		found := s.masker.Analyze(messages)
+		r := scanResult{
+			ID:                id,
+			InjectionDetected: security.InjectionDetected,
+			ThreatLevel:       security.ThreatLevel,
+			Detections:        len(security.Detections),
+			PIIDetected:       found.PIIDetected,
+			PIICount:          found.PIICount,
+		}
+		seen := make(map[string]bool)
+		for _, match := range found.PIITypes {
+			if !seen[match.Type] {
+				seen[match.Type] = true
+				r.PIITypes = append(r.PIITypes, match.Type)
+				result.Summary.PIITypes[match.Type]++
+			}
+		}
+		sort.Strings(r.PIITypes)
+
+		result.Summary.Scanned++
+		result.Summary.ThreatLevels[r.ThreatLevel]++
+		if r.InjectionDetected {
+			result.Summary.InjectionDetected++
+		}
+		if r.PIIDetected {
+			result.Summary.PIIDetected++
+		}
+		result.Items = append(result.Items, r)
+		progress(i+1, len(p.Items))
+	}
+	return result, nil
+}
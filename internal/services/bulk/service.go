@@ -0,0 +1,146 @@
+// Package bulk runs exports, batch scans and imports on the job queue, so
+// they don't hold a request open past the server's write timeout
+package bulk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/bundle"
+	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/jobs"
+	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/epps11/goguard/internal/services/spending"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// Job types created through the jobs API
+const (
+	TypeAuditExport  = "audit_export"
+	TypeUsageExport  = "usage_export"
+	TypeBatchScan    = "batch_scan"
+	TypeBundleImport = "bundle_import"
+)
+
+// Export formats
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+// ErrInvalidJob is returned for jobs with invalid params
+var ErrInvalidJob = errors.New("invalid job")
+
+// ErrUnavailable is returned for job types whose service isn't configured
+var ErrUnavailable = errors.New("job type not available")
+
+// envelope is what every job of this package is queued with: its own params
+// and the tenant of the caller who queued it, which the job is confined to
+type envelope struct {
+	Tenant string          `json:"tenant,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Service queues and runs exports, batch scans and imports
+type Service struct {
+	queue    *jobs.Queue
+	audit    *audit.Logger
+	spending *spending.Tracker
+	detector *injection.Detector
+	masker   *pii.Masker
+	bundles  *bundle.Service
+}
+
+// NewService creates the service and registers its job types with the
+// queue. Usage exports need spending, backed by a database; bundle imports
+// need bundles. Without them their jobs can't be queued.
+func NewService(queue *jobs.Queue, logger *audit.Logger, tracker *spending.Tracker, detector *injection.Detector, masker *pii.Masker, bundles *bundle.Service) *Service {
+	s := &Service{
+		queue:    queue,
+		audit:    logger,
+		spending: tracker,
+		detector: detector,
+		masker:   masker,
+		bundles:  bundles,
+	}
+	queue.Register(jobs.Type{Name: TypeAuditExport, Run: s.runAuditExport})
+	queue.Register(jobs.Type{Name: TypeUsageExport, Run: s.runUsageExport})
+	queue.Register(jobs.Type{Name: TypeBatchScan, Run: s.runBatchScan})
+	// Imports of one tenant would race each other's prunes
+	queue.Register(jobs.Type{Name: TypeBundleImport, Run: s.runBundleImport, Exclusive: true})
+	return s
+}
+
+// Handles reports whether jobType is one the service queues
+func (s *Service) Handles(jobType string) bool {
+	switch jobType {
+	case TypeAuditExport, TypeUsageExport, TypeBatchScan, TypeBundleImport:
+		return true
+	}
+	return false
+}
+
+// Enqueue validates a job's params and queues it, confined to the tenant ctx
+// is confined to
+func (s *Service) Enqueue(ctx context.Context, jobType string, params json.RawMessage, createdBy string) (*models.Job, error) {
+	var err error
+	switch jobType {
+	case TypeAuditExport:
+		err = validateAuditExport(params)
+	case TypeUsageExport:
+		if s.spending == nil {
+			return nil, fmt.Errorf("%w: usage exports require a database", ErrUnavailable)
+		}
+		err = validateUsageExport(params)
+	case TypeBatchScan:
+		err = validateBatchScan(params)
+	case TypeBundleImport:
+		if s.bundles == nil {
+			return nil, fmt.Errorf("%w: bundle imports aren't configured", ErrUnavailable)
+		}
+		err = validateBundleImport(params)
+	default:
+		return nil, fmt.Errorf("%w: %s", jobs.ErrUnknownType, jobType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.queue.Enqueue(ctx, jobType, envelope{Tenant: tenant.Filter(ctx), Params: params}, createdBy)
+}
+
+// open decodes a job's params into v and returns the context the job runs
+// with, confined to the tenant of the caller who queued it
+func open(ctx context.Context, job *models.Job, v interface{}) (context.Context, error) {
+	var env envelope
+	if err := json.Unmarshal(job.Params, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	if len(env.Params) > 0 {
+		if err := json.Unmarshal(env.Params, v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+		}
+	}
+	if env.Tenant != "" {
+		ctx = tenant.WithScope(ctx, env.Tenant)
+	}
+	return ctx, nil
+}
+
+// decode decodes the params of a job being queued, rejecting unknown fields
+// so misspelled filters don't silently export everything
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: params: %v", ErrInvalidJob, err)
+	}
+	return nil
+}
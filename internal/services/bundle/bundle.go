@@ -0,0 +1,215 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// APIVersion identifies the bundle format
+const APIVersion = "goguard/v1"
+
+// ErrInvalidBundle is returned for bundles that can't be parsed or fail validation
+var ErrInvalidBundle = errors.New("invalid bundle")
+
+// Bundle is a portable set of governance rules that can be kept in version
+// control and applied to any instance. Policies are identified by name and
+// spending limits by their user and limit type, so server-assigned
+// IDs and timestamps are left out.
+type Bundle struct {
+	APIVersion     string          `json:"api_version"`
+	Policies       []Policy        `json:"policies"`
+	SpendingLimits []SpendingLimit `json:"spending_limits,omitempty"`
+}
+
+// Policy is the declarative part of a policy
+type Policy struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description,omitempty"`
+	Type        models.PolicyType    `json:"type"`
+	Status      models.PolicyStatus  `json:"status,omitempty"`
+	Priority    int                  `json:"priority,omitempty"`
+	Config      models.PolicyConfig  `json:"config"`
+	Rules       []models.PolicyRule  `json:"rules,omitempty"`
+	Targets     models.PolicyTargets `json:"targets"`
+	Actions     models.PolicyActions `json:"actions"`
+	Metadata    map[string]string    `json:"metadata,omitempty"`
+}
+
+// SpendingLimit is the declarative part of a spending limit
+type SpendingLimit struct {
+	UserID      string  `json:"user_id"`
+	LimitType   string  `json:"limit_type"`
+	LimitAmount float64 `json:"limit_amount"`
+	Currency    string  `json:"currency,omitempty"`
+	AlertAt     float64 `json:"alert_at,omitempty"`
+}
+
+// key identifies a spending limit across instances
+func (l SpendingLimit) key() string {
+	return l.UserID + "/" + l.LimitType
+}
+
+func policySpec(p *models.Policy) Policy {
+	return Policy{
+		Name:        p.Name,
+		Description: p.Description,
+		Type:        p.Type,
+		Status:      p.Status,
+		Priority:    p.Priority,
+		Config:      p.Config,
+		Rules:       p.Rules,
+		Targets:     p.Targets,
+		Actions:     p.Actions,
+		Metadata:    p.Metadata,
+	}
+}
+
+func limitSpec(l *models.SpendingLimit) SpendingLimit {
+	return SpendingLimit{
+		UserID:      l.UserID,
+		LimitType:   l.LimitType,
+		LimitAmount: l.LimitAmount,
+		Currency:    l.Currency,
+		AlertAt:     l.AlertAt,
+	}
+}
+
+// normalize fills in the defaults the server would apply, so a bundle that
+// omits them compares equal to what is stored
+func (p *Policy) normalize() {
+	if p.Status == "" {
+		p.Status = models.PolicyStatusActive
+	}
+}
+
+func (l *SpendingLimit) normalize() {
+	if l.Currency == "" {
+		l.Currency = "USD"
+	}
+}
+
+// Validate checks a bundle before anything is applied
+func (b *Bundle) Validate() error {
+	if b.APIVersion != "" && b.APIVersion != APIVersion {
+		return fmt.Errorf("%w: unsupported bundle api_version %q (expected %q)", ErrInvalidBundle, b.APIVersion, APIVersion)
+	}
+
+	names := make(map[string]bool, len(b.Policies))
+	for i, p := range b.Policies {
+		if p.Name == "" {
+			return fmt.Errorf("%w: policies[%d]: name is required", ErrInvalidBundle, i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("%w: policies[%d]: duplicate policy name %q", ErrInvalidBundle, i, p.Name)
+		}
+		names[p.Name] = true
+		switch p.Type {
+		case models.PolicyTypeSpending, models.PolicyTypeRateLimit, models.PolicyTypeContent,
+			models.PolicyTypeAccess, models.PolicyTypeCompliance, models.PolicyTypeTopic, models.PolicyTypeRouting:
+		default:
+			return fmt.Errorf("%w: policy %q: invalid type %q", ErrInvalidBundle, p.Name, p.Type)
+		}
+	}
+
+	keys := make(map[string]bool, len(b.SpendingLimits))
+	for i, l := range b.SpendingLimits {
+		if l.UserID == "" {
+			return fmt.Errorf("%w: spending_limits[%d]: user_id is required", ErrInvalidBundle, i)
+		}
+		switch l.LimitType {
+		case "daily", "weekly", "monthly":
+		default:
+			return fmt.Errorf("%w: spending_limits[%d]: invalid limit_type %q", ErrInvalidBundle, i, l.LimitType)
+		}
+		if keys[l.key()] {
+			return fmt.Errorf("%w: spending_limits[%d]: duplicate limit %s", ErrInvalidBundle, i, l.key())
+		}
+		keys[l.key()] = true
+	}
+	return nil
+}
+
+// Parse reads a bundle from YAML or JSON. Unknown fields are rejected so
+// typos in hand-written bundles don't silently drop settings.
+func Parse(data []byte) (*Bundle, error) {
+	// Go through JSON so the models' json tags define the field names
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	var b Bundle
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&b); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+	return &b, nil
+}
+
+// YAML renders a bundle as block-style YAML, keeping fields in
+// declaration order
+func (b *Bundle) YAML() ([]byte, error) {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML; decoding it into a node keeps the key order
+	var node yaml.Node
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return nil, err
+	}
+	resetStyle(&node)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resetStyle drops the flow and quoting styles inherited from JSON and
+// removes empty values, which the models don't all mark omitempty
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str" && yaml11Bool[strings.ToLower(node.Value)] {
+		// Plain yes/no/on/off read back as booleans in YAML 1.1 parsers
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	if node.Kind == yaml.MappingNode {
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if isEmptyScalar(node.Content[i+1]) {
+				continue
+			}
+			content = append(content, node.Content[i], node.Content[i+1])
+		}
+		node.Content = content
+	}
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+var yaml11Bool = map[string]bool{"y": true, "n": true, "yes": true, "no": true, "on": true, "off": true}
+
+func isEmptyScalar(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && (node.ShortTag() == "!!null" || (node.ShortTag() == "!!str" && node.Value == ""))
+}
@@ -0,0 +1,308 @@
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// Change actions reported by Apply
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionDelete    = "delete"
+)
+
+// Change is the effect of applying one bundle entry
+type Change struct {
+	Kind   string `json:"kind"` // policy, spending_limit
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+}
+
+// ApplyOptions controls how a bundle is applied
+type ApplyOptions struct {
+	DryRun bool // report changes without making them
+	Prune  bool // delete policies that are not in the bundle
+}
+
+// ApplyResult reports what applying a bundle changed
+type ApplyResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Changes []Change       `json:"changes"`
+	Summary map[string]int `json:"summary"`
+}
+
+func (r *ApplyResult) add(change Change) {
+	r.Changes = append(r.Changes, change)
+	r.Summary[change.Action]++
+}
+
+// Service exports and applies bundles. Policies always go through the policy
+// engine so versions are recorded; spending limits are read from and written
+// to the database when one is configured.
+type Service struct {
+	engine *policy.Engine
+	repo   *database.Repository
+}
+
+// NewService creates a bundle service
+func NewService(engine *policy.Engine, repo *database.Repository) *Service {
+	return &Service{engine: engine, repo: repo}
+}
+
+// Export returns the current policies and spending limits as a bundle
+func (s *Service) Export(ctx context.Context) (*Bundle, error) {
+	policies, err := s.engine.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := s.listLimits(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		APIVersion:     APIVersion,
+		Policies:       make([]Policy, 0, len(policies)),
+		SpendingLimits: make([]SpendingLimit, 0, len(limits)),
+	}
+	for _, p := range policies {
+		b.Policies = append(b.Policies, policySpec(p))
+	}
+	for _, l := range limits {
+		b.SpendingLimits = append(b.SpendingLimits, limitSpec(l))
+	}
+
+	// Stable ordering keeps exported bundles diff-friendly in git
+	sort.Slice(b.Policies, func(i, j int) bool {
+		if b.Policies[i].Priority != b.Policies[j].Priority {
+			return b.Policies[i].Priority < b.Policies[j].Priority
+		}
+		return b.Policies[i].Name < b.Policies[j].Name
+	})
+	sort.Slice(b.SpendingLimits, func(i, j int) bool {
+		return b.SpendingLimits[i].key() < b.SpendingLimits[j].key()
+	})
+	return b, nil
+}
+
+// Apply makes the instance match the bundle: entries are created or updated
+// by name, and entries already matching are left alone, so applying the same
+// bundle twice changes nothing
+func (s *Service) Apply(ctx context.Context, b *Bundle, opts ApplyOptions) (*ApplyResult, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	// Check every rule up front so a bad bundle is rejected before any change
+	for _, p := range b.Policies {
+		if err := policy.ValidateRules(p.Rules); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+		if err := policy.ValidateSystemPrompt(p.Config); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+		if err := policy.ValidateTopics(p.Type, p.Config, p.Actions); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+		if err := policy.ValidateInjection(p.Config); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+		if err := policy.ValidateContext(p.Config); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+		if err := policy.ValidateRollout(p.Config); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+		if err := policy.ValidateRouting(p.Type, p.Config); err != nil {
+			return nil, fmt.Errorf("%w: policy %q: %v", ErrInvalidBundle, p.Name, err)
+		}
+	}
+
+	result := &ApplyResult{DryRun: opts.DryRun, Changes: []Change{}, Summary: map[string]int{}}
+	if err := s.applyPolicies(ctx, b.Policies, opts, result); err != nil {
+		return result, err
+	}
+	if err := s.applyLimits(ctx, b.SpendingLimits, opts, result); err != nil {
+		return result, err
+	}
+
+	log.Info().
+		Bool("dry_run", opts.DryRun).
+		Int("created", result.Summary[ActionCreate]).
+		Int("updated", result.Summary[ActionUpdate]).
+		Int("deleted", result.Summary[ActionDelete]).
+		Msg("Policy bundle applied")
+	return result, nil
+}
+
+func (s *Service) applyPolicies(ctx context.Context, specs []Policy, opts ApplyOptions, result *ApplyResult) error {
+	existing, err := s.engine.ListPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*models.Policy, len(existing))
+	for _, p := range existing {
+		byName[p.Name] = p
+	}
+
+	for _, spec := range specs {
+		spec.normalize()
+		current, found := byName[spec.Name]
+		delete(byName, spec.Name)
+		var currentSpec Policy
+		if found {
+			currentSpec = policySpec(current)
+			currentSpec.normalize()
+		}
+
+		change := Change{Kind: "policy", Name: spec.Name}
+		switch {
+		case !found:
+			change.Action = ActionCreate
+		case sameSpec(currentSpec, spec):
+			change.Action = ActionUnchanged
+			change.ID = current.ID
+		default:
+			change.Action = ActionUpdate
+			change.ID = current.ID
+		}
+
+		if !opts.DryRun && change.Action != ActionUnchanged {
+			p := &models.Policy{
+				ID:          change.ID,
+				Name:        spec.Name,
+				Description: spec.Description,
+				Type:        spec.Type,
+				Status:      spec.Status,
+				Priority:    spec.Priority,
+				Config:      spec.Config,
+				Rules:       spec.Rules,
+				Targets:     spec.Targets,
+				Actions:     spec.Actions,
+				Metadata:    spec.Metadata,
+			}
+			if change.Action == ActionCreate {
+				_, err = s.engine.CreatePolicy(ctx, p)
+			} else {
+				_, err = s.engine.UpdatePolicy(ctx, p)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to %s policy %q: %w", change.Action, spec.Name, err)
+			}
+			change.ID = p.ID
+		}
+		result.add(change)
+	}
+
+	if !opts.Prune {
+		return nil
+	}
+	for name, p := range byName {
+		if !opts.DryRun {
+			if err := s.engine.DeletePolicy(ctx, p.ID, "pruned by bundle apply"); err != nil {
+				return fmt.Errorf("failed to delete policy %q: %w", name, err)
+			}
+		}
+		result.add(Change{Kind: "policy", Name: name, Action: ActionDelete, ID: p.ID})
+	}
+	return nil
+}
+
+func (s *Service) applyLimits(ctx context.Context, specs []SpendingLimit, opts ApplyOptions, result *ApplyResult) error {
+	existing, err := s.listLimits(ctx)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]*models.SpendingLimit, len(existing))
+	for _, l := range existing {
+		byKey[limitSpec(l).key()] = l
+	}
+
+	for _, spec := range specs {
+		spec.normalize()
+		current, found := byKey[spec.key()]
+		var currentSpec SpendingLimit
+		if found {
+			currentSpec = limitSpec(current)
+			currentSpec.normalize()
+		}
+
+		change := Change{Kind: "spending_limit", Name: spec.key()}
+		switch {
+		case !found:
+			change.Action = ActionCreate
+		case sameSpec(currentSpec, spec):
+			change.Action = ActionUnchanged
+			change.ID = current.ID
+		default:
+			change.Action = ActionUpdate
+			change.ID = current.ID
+		}
+
+		if !opts.DryRun && change.Action != ActionUnchanged {
+			id, err := s.saveLimit(ctx, current, spec)
+			if err != nil {
+				return fmt.Errorf("failed to %s spending limit %s: %w", change.Action, spec.key(), err)
+			}
+			change.ID = id
+		}
+		result.add(change)
+	}
+	return nil
+}
+
+// sameSpec compares two specs by their JSON form, so nil and empty values and
+// numbers decoded from YAML compare equal to what the server stored
+func sameSpec(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+func (s *Service) listLimits(ctx context.Context) ([]*models.SpendingLimit, error) {
+	if s.repo != nil {
+		limits, _, err := s.repo.QuerySpendingLimits(ctx, &models.ListQuery{Tenant: tenant.Filter(ctx)})
+		return limits, err
+	}
+	return s.engine.ListSpendingLimits(ctx)
+}
+
+// saveLimit creates a limit, or updates current in place so its spend so far
+// and reset time carry over
+func (s *Service) saveLimit(ctx context.Context, current *models.SpendingLimit, spec SpendingLimit) (string, error) {
+	limit := &models.SpendingLimit{}
+	if current != nil {
+		copied := *current
+		limit = &copied
+	}
+	limit.UserID = spec.UserID
+	limit.LimitType = spec.LimitType
+	limit.LimitAmount = spec.LimitAmount
+	limit.Currency = spec.Currency
+	limit.AlertAt = spec.AlertAt
+
+	var err error
+	switch {
+	case s.repo != nil && current == nil:
+		limit.TenantID = tenant.Assign(ctx, "")
+		err = s.repo.CreateSpendingLimit(ctx, limit)
+	case s.repo != nil:
+		err = s.repo.UpdateSpendingLimit(ctx, limit)
+	case current == nil:
+		_, err = s.engine.CreateSpendingLimit(ctx, limit)
+	default:
+		_, err = s.engine.UpdateSpendingLimit(ctx, limit)
+	}
+	return limit.ID, err
+}
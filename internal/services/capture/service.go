@@ -0,0 +1,224 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Service stores PII-redacted prompts and responses for opted-in users
+type Service struct {
+	repo     *database.Repository
+	redactor *pii.Masker
+	cfg      config.CaptureConfig
+	users    map[string]bool
+	entries  []models.CapturedContent
+	mu       sync.RWMutex
+}
+
+// NewService creates a new capture service
+// repo is optional - without it captures are kept in memory up to cfg.MaxEntries
+func NewService(cfg config.CaptureConfig, repo *database.Repository) *Service {
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = 30
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 1000
+	}
+
+	s := &Service{
+		repo: repo,
+		// Redaction is always on regardless of the data-plane masking settings
+		redactor: pii.NewMasker(cfg.RedactTypes, "*", false, true),
+		cfg:      cfg,
+		users:    make(map[string]bool),
+		entries:  make([]models.CapturedContent, 0),
+	}
+	for _, u := range cfg.Users {
+		s.users[u] = true
+	}
+	return s
+}
+
+// ShouldCapture reports whether static configuration opts this user into capture
+func (s *Service) ShouldCapture(userID string) bool {
+	return s.cfg.Enabled || (userID != "" && s.users[userID])
+}
+
+// Capture redacts and stores a request's messages and LLM response
+// retentionDays overrides the configured default when > 0
+func (s *Service) Capture(ctx context.Context, req *models.GuardRequest, messages []models.Message, resp *models.LLMResponse, policyID string, retentionDays int) error {
+	if retentionDays <= 0 {
+		retentionDays = s.cfg.RetentionDays
+	}
+
+	redacted, report := s.redactor.Mask(messages)
+	omitImages(redacted)
+	content := &models.CapturedContent{
+		RequestID:      req.RequestID,
+		UserID:         req.UserID,
+		PolicyID:       policyID,
+		Messages:       redacted,
+		RedactionCount: report.MaskedCount,
+		CreatedAt:      time.Now(),
+		ExpiresAt:      time.Now().Add(time.Duration(retentionDays) * 24 * time.Hour),
+	}
+
+	if resp != nil {
+		content.Model = resp.Model
+		redactedResp, respReport := s.redactor.Mask([]models.Message{{Role: "assistant", Content: resp.Content}})
+		content.Response = redactedResp[0].Content
+		content.RedactionCount += respReport.MaskedCount
+	}
+
+	if s.repo != nil {
+		if err := s.repo.CreateCapturedContent(ctx, content); err != nil {
+			return fmt.Errorf("failed to store captured content: %w", err)
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content.ID = uuid.New().String()
+	s.entries = append(s.entries, *content)
+	if len(s.entries) > s.cfg.MaxEntries {
+		s.entries = s.entries[len(s.entries)-s.cfg.MaxEntries:]
+	}
+	return nil
+}
+
+// imagePlaceholder replaces image URLs in captured messages. Images can
+// carry PII the redactor can't see, so their data is never stored.
+const imagePlaceholder = "[image omitted]"
+
+// omitImages replaces the image URLs of messages in place; the parts
+// belong to the redactor's copies, not the request
+func omitImages(messages []models.Message) {
+	for i := range messages {
+		for j, part := range messages[i].Parts {
+			if part.Type == models.PartImage {
+				messages[i].Parts[j].ImageURL = &models.ImageURL{URL: imagePlaceholder}
+			}
+		}
+	}
+}
+
+// Get retrieves captured content by capture ID or request ID
+func (s *Service) Get(ctx context.Context, id string) (*models.CapturedContent, error) {
+	if s.repo != nil {
+		return s.repo.GetCapturedContent(ctx, id)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		entry := s.entries[i]
+		if (entry.ID == id || entry.RequestID == id) && entry.ExpiresAt.After(now) {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("captured content not found: %s", id)
+}
+
+// List returns the newest captures, optionally filtered by user
+func (s *Service) List(ctx context.Context, userID string, limit int) ([]*models.CapturedContent, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if s.repo != nil {
+		return s.repo.ListCapturedContent(ctx, userID, limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	result := []*models.CapturedContent{}
+	for i := len(s.entries) - 1; i >= 0 && len(result) < limit; i-- {
+		entry := s.entries[i]
+		if entry.ExpiresAt.Before(now) || (userID != "" && entry.UserID != userID) {
+			continue
+		}
+		result = append(result, &entry)
+	}
+	return result, nil
+}
+
+// Since returns up to limit captures created at or after since, newest first
+func (s *Service) Since(ctx context.Context, since time.Time, limit int) ([]*models.CapturedContent, error) {
+	if s.repo != nil {
+		return s.repo.ListCapturedContentSince(ctx, since, limit)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	result := []*models.CapturedContent{}
+	for i := len(s.entries) - 1; i >= 0 && len(result) < limit; i-- {
+		entry := s.entries[i]
+		if entry.CreatedAt.Before(since) {
+			break
+		}
+		if entry.ExpiresAt.Before(now) {
+			continue
+		}
+		result = append(result, &entry)
+	}
+	return result, nil
+}
+
+// PurgeExpired deletes captures past their retention period
+func (s *Service) PurgeExpired(ctx context.Context) (int64, error) {
+	if s.repo != nil {
+		return s.repo.DeleteExpiredCapturedContent(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	kept := s.entries[:0]
+	for _, entry := range s.entries {
+		if entry.ExpiresAt.After(now) {
+			kept = append(kept, entry)
+		}
+	}
+	purged := int64(len(s.entries) - len(kept))
+	s.entries = kept
+	return purged, nil
+}
+
+// StartRetention purges expired captures periodically until ctx is cancelled
+func (s *Service) StartRetention(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := s.PurgeExpired(ctx)
+				if err != nil {
+					log.Warn().Err(err).Msg("Failed to purge expired captured content")
+				} else if purged > 0 {
+					log.Info().Int64("purged", purged).Msg("Purged expired captured content")
+				}
+			}
+		}
+	}()
+}
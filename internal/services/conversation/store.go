@@ -0,0 +1,196 @@
+package conversation
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Store keeps the recent turns of conversations in memory. Conversations are
+// scoped to their user, so one user can't read or add to another's history
+// by reusing its ID. Idle conversations expire, and the least recently
+// active are dropped when the store is full.
+type Store struct {
+	cfg           config.ConversationConfig
+	mu            sync.Mutex
+	conversations map[key]*models.Conversation
+	now           func() time.Time
+}
+
+type key struct {
+	userID string
+	id     string
+}
+
+// Summary describes a conversation without its text
+type Summary struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id,omitempty"`
+	Turns        int       `json:"turns"`
+	FlaggedTurns int       `json:"flagged_turns"`
+	ThreatLevel  string    `json:"threat_level"` // of the latest turn
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// NewStore creates a conversation store
+func NewStore(cfg config.ConversationConfig) *Store {
+	if cfg.TTL <= 0 {
+		cfg.TTL = 30 * time.Minute
+	}
+	if cfg.MaxConversations <= 0 {
+		cfg.MaxConversations = 10000
+	}
+	if cfg.MaxTurns <= 0 {
+		cfg.MaxTurns = 20
+	}
+	return &Store{
+		cfg:           cfg,
+		conversations: make(map[key]*models.Conversation),
+		now:           time.Now,
+	}
+}
+
+// Turns returns the turns recorded for a user's conversation, oldest first
+func (s *Store) Turns(userID, id string) []models.ConversationTurn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv := s.get(key{userID, id})
+	if conv == nil {
+		return nil
+	}
+	turns := make([]models.ConversationTurn, len(conv.Turns))
+	copy(turns, conv.Turns)
+	return turns
+}
+
+// Record adds a turn to a user's conversation, starting it if needed
+func (s *Store) Record(userID, id string, turn models.ConversationTurn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if turn.At.IsZero() {
+		turn.At = now
+	}
+	k := key{userID, id}
+	conv := s.get(k)
+	if conv == nil {
+		if len(s.conversations) >= s.cfg.MaxConversations {
+			s.evict()
+		}
+		conv = &models.Conversation{ID: id, UserID: userID, CreatedAt: now}
+		s.conversations[k] = conv
+	}
+	conv.Turns = append(conv.Turns, turn)
+	if extra := len(conv.Turns) - s.cfg.MaxTurns; extra > 0 {
+		conv.Turns = append([]models.ConversationTurn(nil), conv.Turns[extra:]...)
+	}
+	conv.UpdatedAt = now
+}
+
+// Get returns a copy of a user's conversation
+func (s *Store) Get(userID, id string) (*models.Conversation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv := s.get(key{userID, id})
+	if conv == nil {
+		return nil, false
+	}
+	copied := *conv
+	copied.Turns = append([]models.ConversationTurn(nil), conv.Turns...)
+	return &copied, true
+}
+
+// List summarizes the active conversations, most recently active first,
+// optionally only those of one user
+func (s *Store) List(userID string) []Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	summaries := []Summary{}
+	for k, conv := range s.conversations {
+		if userID != "" && k.userID != userID {
+			continue
+		}
+		summary := Summary{
+			ID:        conv.ID,
+			UserID:    conv.UserID,
+			Turns:     len(conv.Turns),
+			CreatedAt: conv.CreatedAt,
+			UpdatedAt: conv.UpdatedAt,
+		}
+		for _, t := range conv.Turns {
+			if t.Detections > 0 {
+				summary.FlaggedTurns++
+			}
+		}
+		if len(conv.Turns) > 0 {
+			summary.ThreatLevel = conv.Turns[len(conv.Turns)-1].ThreatLevel
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+	return summaries
+}
+
+// Delete forgets a user's conversation
+func (s *Store) Delete(userID, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key{userID, id}
+	if s.get(k) == nil {
+		return false
+	}
+	delete(s.conversations, k)
+	return true
+}
+
+// get returns a conversation that hasn't expired. The lock must be held.
+func (s *Store) get(k key) *models.Conversation {
+	conv, ok := s.conversations[k]
+	if !ok {
+		return nil
+	}
+	if s.now().Sub(conv.UpdatedAt) > s.cfg.TTL {
+		delete(s.conversations, k)
+		return nil
+	}
+	return conv
+}
+
+// expire drops idle conversations. The lock must be held.
+func (s *Store) expire() {
+	cutoff := s.now().Add(-s.cfg.TTL)
+	for k, conv := range s.conversations {
+		if conv.UpdatedAt.Before(cutoff) {
+			delete(s.conversations, k)
+		}
+	}
+}
+
+// evict makes room for a conversation, dropping the idle ones or else the
+// least recently active. The lock must be held.
+func (s *Store) evict() {
+	s.expire()
+	if len(s.conversations) < s.cfg.MaxConversations {
+		return
+	}
+	var oldest key
+	var oldestAt time.Time
+	for k, conv := range s.conversations {
+		if oldestAt.IsZero() || conv.UpdatedAt.Before(oldestAt) {
+			oldest, oldestAt = k, conv.UpdatedAt
+		}
+	}
+	delete(s.conversations, oldest)
+}
@@ -0,0 +1,249 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Flags gating behaviour that is rolled out gradually
+const (
+	FlagOutputScanning = "output_scanning"
+	FlagSemanticCache  = "semantic_cache"
+	FlagAutoSuspend    = "auto_suspend"
+)
+
+// Definition describes a flag known to this version
+type Definition struct {
+	Key         string
+	Description string
+}
+
+// Definitions lists the flags this version understands. Flags are off until
+// configured, so adding one needs no migration, and stored settings for flags
+// a version doesn't know are kept but ignored.
+var Definitions = []Definition{
+	{FlagOutputScanning, "Scan LLM responses for injection and PII before returning them"},
+	{FlagSemanticCache, "Serve responses for semantically similar prompts from cache"},
+	{FlagAutoSuspend, "Suspend users automatically after repeated policy violations"},
+}
+
+// ErrUnknownFlag is returned for keys that are not in Definitions
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// ErrInvalidFlag is returned for flags with invalid settings
+var ErrInvalidFlag = errors.New("invalid feature flag")
+
+const cacheKeyFlags = "feature_flags"
+
+// Subject is who a flag is evaluated for
+type Subject struct {
+	UserID  string
+	Tenants []string // the user's groups and the request's project
+}
+
+// Service stores feature flag settings and evaluates flags
+type Service struct {
+	repo  *database.Repository
+	cache cache.Cache
+	flags map[string]*models.FeatureFlag
+	mu    sync.RWMutex
+}
+
+// NewService creates a flag service; settings are kept in memory when repo is nil
+func NewService(repo *database.Repository) *Service {
+	return &Service{
+		repo:  repo,
+		cache: cache.NewMemory(time.Minute),
+		flags: make(map[string]*models.FeatureFlag),
+	}
+}
+
+// SetCache replaces the default in-memory cache of stored flag settings, e.g.
+// with a Redis cache so changes reach every replica
+func (s *Service) SetCache(c cache.Cache) {
+	s.cache = c
+}
+
+func definition(key string) (Definition, bool) {
+	for _, d := range Definitions {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// stored returns flag settings by key, read through the cache
+func (s *Service) stored(ctx context.Context) (map[string]*models.FeatureFlag, error) {
+	if s.repo == nil {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		flags := make(map[string]*models.FeatureFlag, len(s.flags))
+		for key, f := range s.flags {
+			copied := *f
+			flags[key] = &copied
+		}
+		return flags, nil
+	}
+
+	var flags map[string]*models.FeatureFlag
+	found, err := s.cache.Get(ctx, cacheKeyFlags, &flags)
+	if err != nil {
+		log.Warn().Err(err).Msg("Feature flag cache read failed")
+	}
+	if found {
+		return flags, nil
+	}
+
+	list, err := s.repo.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flags = make(map[string]*models.FeatureFlag, len(list))
+	for _, f := range list {
+		flags[f.Key] = f
+	}
+	if err := s.cache.Set(ctx, cacheKeyFlags, flags, 0); err != nil {
+		log.Warn().Err(err).Msg("Feature flag cache write failed")
+	}
+	return flags, nil
+}
+
+// List returns every known flag with its current settings
+func (s *Service) List(ctx context.Context) ([]*models.FeatureFlag, error) {
+	stored, err := s.stored(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]*models.FeatureFlag, 0, len(Definitions))
+	for _, d := range Definitions {
+		f, ok := stored[d.Key]
+		if !ok {
+			f = &models.FeatureFlag{Key: d.Key}
+		}
+		f.Description = d.Description
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// Get returns a known flag with its current settings
+func (s *Service) Get(ctx context.Context, key string) (*models.FeatureFlag, error) {
+	d, ok := definition(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFlag, key)
+	}
+	stored, err := s.stored(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := stored[key]
+	if !ok {
+		f = &models.FeatureFlag{Key: key}
+	}
+	f.Description = d.Description
+	return f, nil
+}
+
+// Set replaces a flag's settings
+func (s *Service) Set(ctx context.Context, f *models.FeatureFlag) (*models.FeatureFlag, error) {
+	d, ok := definition(f.Key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFlag, f.Key)
+	}
+	if f.Rollout < 0 || f.Rollout > 100 {
+		return nil, fmt.Errorf("%w: rollout must be between 0 and 100", ErrInvalidFlag)
+	}
+	f.Description = d.Description
+	f.UpdatedAt = time.Now()
+
+	if s.repo != nil {
+		if err := s.repo.UpsertFeatureFlag(ctx, f); err != nil {
+			return nil, err
+		}
+		s.invalidate(ctx)
+		return f, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *f
+	s.flags[f.Key] = &copied
+	return f, nil
+}
+
+// Reset returns a flag to its default, off
+func (s *Service) Reset(ctx context.Context, key string) error {
+	if _, ok := definition(key); !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, key)
+	}
+
+	if s.repo != nil {
+		if err := s.repo.DeleteFeatureFlag(ctx, key); err != nil {
+			return err
+		}
+		s.invalidate(ctx)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.flags, key)
+	return nil
+}
+
+func (s *Service) invalidate(ctx context.Context) {
+	if err := s.cache.Delete(ctx, cacheKeyFlags); err != nil {
+		log.Warn().Err(err).Msg("Feature flag cache invalidation failed")
+	}
+}
+
+// Enabled reports whether a flag is on for the subject. Flags that can't be
+// read are treated as off, so a storage outage never turns a feature on.
+func (s *Service) Enabled(ctx context.Context, key string, subject Subject) bool {
+	if _, ok := definition(key); !ok {
+		return false
+	}
+	stored, err := s.stored(ctx)
+	if err != nil {
+		log.Warn().Err(err).Str("flag", key).Msg("Failed to read feature flags")
+		return false
+	}
+	f, ok := stored[key]
+	if !ok || !f.Enabled {
+		return false
+	}
+	for _, tenant := range subject.Tenants {
+		if tenant != "" && slices.Contains(f.Tenants, tenant) {
+			return true
+		}
+	}
+	if f.Rollout >= 100 {
+		return true
+	}
+	if f.Rollout <= 0 || subject.UserID == "" {
+		return false
+	}
+	return bucket(key, subject.UserID) < f.Rollout
+}
+
+// bucket places a user in one of 100 buckets per flag, so raising a flag's
+// rollout only ever adds users and each flag samples a different set
+func bucket(key, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,255 @@
+package forecast
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// Projection methods
+const (
+	MethodLinear   = "linear"
+	MethodSeasonal = "seasonal"
+)
+
+const (
+	// lookbackDays is how much history before today the seasonal method reads
+	lookbackDays = 28
+	// minSeasonalDays is the history needed to estimate day-of-week factors
+	minSeasonalDays = 14
+)
+
+// Forecaster projects month-end spend from usage records, or the in-memory
+// audit log without a database, and alerts when the projection reaches a
+// threshold
+type Forecaster struct {
+	cfg          config.ForecastConfig
+	repo         *database.Repository
+	auditLogger  *audit.Logger
+	alertedMonth string
+	mu           sync.Mutex
+}
+
+// NewForecaster creates a forecaster; spend is read from the in-memory audit
+// log when repo is nil
+func NewForecaster(cfg config.ForecastConfig, repo *database.Repository, logger *audit.Logger) *Forecaster {
+	return &Forecaster{
+		cfg:         cfg,
+		repo:        repo,
+		auditLogger: logger,
+	}
+}
+
+// Forecast returns month-to-date spend and the projected spend for the
+// current UTC month
+func (f *Forecaster) Forecast(ctx context.Context) (*models.SpendForecast, error) {
+	return f.forecastAt(ctx, time.Now())
+}
+
+func (f *Forecaster) forecastAt(ctx context.Context, now time.Time) (*models.SpendForecast, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	start := today.AddDate(0, 0, -lookbackDays)
+	if monthStart.Before(start) {
+		start = monthStart
+	}
+	spend, err := f.dailySpend(ctx, start, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &models.SpendForecast{
+		Month:       monthStart.Format("2006-01"),
+		DaysElapsed: math.Round(now.Sub(monthStart).Hours()/24*100) / 100,
+		DaysInMonth: int(monthEnd.Sub(monthStart).Hours() / 24),
+		Daily:       []models.DailySpend{},
+		Currency:    "USD",
+		GeneratedAt: now,
+	}
+	for d := start; !d.After(today); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		fc.Daily = append(fc.Daily, models.DailySpend{Date: date, Cost: roundCost(spend[date])})
+		if !d.Before(monthStart) {
+			fc.MonthToDate += spend[date]
+		}
+	}
+
+	if projected, ok := seasonal(spend, now, monthEnd, fc.MonthToDate); ok {
+		fc.Projected = projected
+		fc.Method = MethodSeasonal
+	} else {
+		fc.Projected = fc.MonthToDate
+		if elapsed := now.Sub(monthStart); elapsed > 0 {
+			fc.Projected = fc.MonthToDate / elapsed.Hours() * monthEnd.Sub(monthStart).Hours()
+		}
+		fc.Method = MethodLinear
+	}
+	fc.MonthToDate = roundCost(fc.MonthToDate)
+	fc.Projected = roundCost(fc.Projected)
+	return fc, nil
+}
+
+// seasonal projects the rest of the month from the mean of the last seven
+// complete days, scaled by a day-of-week factor estimated over the lookback
+// window. It reports false until there is enough history to estimate the
+// factors.
+func seasonal(spend map[string]float64, now, monthEnd time.Time, monthToDate float64) (float64, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	// History starts at the first day with spend so a new deployment is not
+	// averaged against days before it was in use
+	first := today
+	for d := today.AddDate(0, 0, -lookbackDays); d.Before(today); d = d.AddDate(0, 0, 1) {
+		if spend[d.Format("2006-01-02")] > 0 {
+			first = d
+			break
+		}
+	}
+	days := int(today.Sub(first).Hours() / 24)
+	if days < minSeasonalDays {
+		return 0, false
+	}
+
+	var total float64
+	var weekdayTotal [7]float64
+	var weekdayDays [7]int
+	for d := first; d.Before(today); d = d.AddDate(0, 0, 1) {
+		cost := spend[d.Format("2006-01-02")]
+		total += cost
+		weekdayTotal[d.Weekday()] += cost
+		weekdayDays[d.Weekday()]++
+	}
+	mean := total / float64(days)
+	if mean <= 0 {
+		return 0, false
+	}
+	var factor [7]float64
+	for wd := range factor {
+		factor[wd] = weekdayTotal[wd] / float64(weekdayDays[wd]) / mean
+	}
+
+	var level float64
+	for d := today.AddDate(0, 0, -7); d.Before(today); d = d.AddDate(0, 0, 1) {
+		level += spend[d.Format("2006-01-02")]
+	}
+	level /= 7
+
+	remainingToday := 1 - now.Sub(today).Hours()/24
+	projected := monthToDate + level*factor[today.Weekday()]*remainingToday
+	for d := today.AddDate(0, 0, 1); d.Before(monthEnd); d = d.AddDate(0, 0, 1) {
+		projected += level * factor[d.Weekday()]
+	}
+	return projected, true
+}
+
+// dailySpend returns request cost per UTC day (YYYY-MM-DD) in [start, end)
+func (f *Forecaster) dailySpend(ctx context.Context, start, end time.Time) (map[string]float64, error) {
+	spend := make(map[string]float64)
+	if f.repo != nil {
+		days, err := f.repo.DailySpend(ctx, tenant.Filter(ctx), start, end)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range days {
+			spend[d.Date] = d.Cost
+		}
+		return spend, nil
+	}
+
+	if f.auditLogger == nil {
+		return spend, nil
+	}
+	entries, _, err := f.auditLogger.Query(ctx, &models.AuditQuery{
+		StartTime:  &start,
+		EndTime:    &end,
+		EventTypes: []models.AuditEventType{models.EventTypeRequest},
+		Limit:      math.MaxInt32,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if cost, ok := entry.Details["cost"].(float64); ok {
+			spend[entry.Timestamp.UTC().Format("2006-01-02")] += cost
+		}
+	}
+	return spend, nil
+}
+
+// Start checks the projection against the alert threshold periodically until
+// ctx is cancelled. It does nothing when no threshold is configured.
+func (f *Forecaster) Start(ctx context.Context) {
+	if f.cfg.AlertThreshold <= 0 || f.cfg.CheckInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(f.cfg.CheckInterval)
+		defer ticker.Stop()
+
+		f.check(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				f.check(ctx)
+			}
+		}
+	}()
+}
+
+// check raises a spending alert the first time in a month that the
+// projection reaches the threshold
+func (f *Forecaster) check(ctx context.Context) {
+	fc, err := f.Forecast(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to forecast spend")
+		return
+	}
+	if fc.Projected < f.cfg.AlertThreshold {
+		return
+	}
+
+	f.mu.Lock()
+	if f.alertedMonth == fc.Month {
+		f.mu.Unlock()
+		return
+	}
+	f.alertedMonth = fc.Month
+	f.mu.Unlock()
+
+	if f.auditLogger == nil {
+		return
+	}
+	severity := "medium"
+	if fc.MonthToDate >= f.cfg.AlertThreshold {
+		severity = "high"
+	}
+	if err := f.auditLogger.CreateAlert(ctx, &models.Alert{
+		Type:     "spending",
+		Severity: severity,
+		Title:    "Projected monthly spend exceeds threshold",
+		Message: fmt.Sprintf("Spend for %s is projected to reach $%.2f (%s), above the $%.2f threshold; $%.2f spent so far",
+			fc.Month, fc.Projected, fc.Method, f.cfg.AlertThreshold, fc.MonthToDate),
+	}); err != nil {
+		log.Warn().Err(err).Msg("Failed to create spend forecast alert")
+	}
+}
+
+// roundCost rounds to the precision costs are stored with
+func roundCost(cost float64) float64 {
+	return math.Round(cost*1e6) / 1e6
+}
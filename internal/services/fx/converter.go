@@ -0,0 +1,271 @@
+package fx
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// Base is the currency costs are recorded in
+const Base = "USD"
+
+// FeedECB pulls the European Central Bank's daily reference rates
+const FeedECB = "ecb"
+
+// Rate sources
+const (
+	SourceManual = "manual"
+	SourceECB    = "ecb"
+)
+
+// maxFeedSize bounds how much of the rate feed is read
+const maxFeedSize = 1 << 20
+
+// ErrUnknownCurrency is returned for currencies without a rate
+var ErrUnknownCurrency = errors.New("unknown currency")
+
+// ErrNoFeed is returned when syncing without a rate feed configured
+var ErrNoFeed = errors.New("no exchange rate feed configured")
+
+// Rate is how many units of a currency one USD buys
+type Rate struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+	Source   string  `json:"source"`
+}
+
+// Rates is the current rate table
+type Rates struct {
+	Base      string          `json:"base"`
+	Display   string          `json:"display"`
+	Rates     map[string]Rate `json:"rates"`
+	SyncedAt  time.Time       `json:"synced_at,omitzero"`
+	SyncError string          `json:"sync_error,omitempty"`
+}
+
+// Converter converts amounts between currencies using manual rates and,
+// optionally, rates pulled from the ECB
+type Converter struct {
+	cfg       config.CurrencyConfig
+	manual    map[string]float64
+	feed      map[string]float64
+	syncedAt  time.Time
+	syncError string
+	client    *http.Client
+	mu        sync.RWMutex
+}
+
+// NewConverter creates a converter with the configured manual rates
+func NewConverter(cfg config.CurrencyConfig) *Converter {
+	manual := make(map[string]float64, len(cfg.Rates))
+	for code, rate := range cfg.Rates {
+		if rate <= 0 {
+			log.Warn().Str("currency", code).Float64("rate", rate).Msg("Ignoring non-positive exchange rate")
+			continue
+		}
+		manual[Normalize(code)] = rate
+	}
+	cfg.Display = Normalize(cfg.Display)
+	if cfg.Display == "" {
+		cfg.Display = Base
+	}
+	return &Converter{
+		cfg:    cfg,
+		manual: manual,
+		feed:   make(map[string]float64),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Normalize upper-cases a currency code
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Display returns the currency dashboard spend is shown in by default
+func (c *Converter) Display() string {
+	return c.cfg.Display
+}
+
+// rate returns units of code per USD. The caller must hold c.mu.
+func (c *Converter) rate(code string) (float64, bool) {
+	if code == Base {
+		return 1, true
+	}
+	if rate, ok := c.manual[code]; ok {
+		return rate, true
+	}
+	rate, ok := c.feed[code]
+	return rate, ok
+}
+
+// Supported reports whether amounts can be converted to and from a currency
+func (c *Converter) Supported(code string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.rate(Normalize(code))
+	return ok
+}
+
+// Convert converts an amount between currencies. An empty currency is USD.
+func (c *Converter) Convert(amount float64, from, to string) (float64, error) {
+	from, to = Normalize(from), Normalize(to)
+	if from == "" {
+		from = Base
+	}
+	if to == "" {
+		to = Base
+	}
+	if from == to {
+		return amount, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fromRate, ok := c.rate(from)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, from)
+	}
+	toRate, ok := c.rate(to)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCurrency, to)
+	}
+	return math.Round(amount/fromRate*toRate*1e6) / 1e6, nil
+}
+
+// Rates returns the rate table
+func (c *Converter) Rates() *Rates {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rates := &Rates{
+		Base:      Base,
+		Display:   c.cfg.Display,
+		Rates:     map[string]Rate{Base: {Currency: Base, Rate: 1, Source: SourceManual}},
+		SyncedAt:  c.syncedAt,
+		SyncError: c.syncError,
+	}
+	for code, rate := range c.feed {
+		rates.Rates[code] = Rate{Currency: code, Rate: rate, Source: SourceECB}
+	}
+	for code, rate := range c.manual {
+		rates.Rates[code] = Rate{Currency: code, Rate: rate, Source: SourceManual}
+	}
+	return rates
+}
+
+// ecbEnvelope is the part of the ECB daily rates document that matters
+type ecbEnvelope struct {
+	Cube struct {
+		Cube struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// Sync pulls the ECB reference rates. They are quoted per EUR and are
+// rebased on USD.
+func (c *Converter) Sync(ctx context.Context) error {
+	if c.cfg.Feed != FeedECB {
+		return ErrNoFeed
+	}
+	rates, err := c.fetchECB(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.syncError = err.Error()
+		return err
+	}
+	c.feed = rates
+	c.syncedAt = time.Now()
+	c.syncError = ""
+	return nil
+}
+
+func (c *Converter) fetchECB(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.FeedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch exchange rates: unexpected status %d", resp.StatusCode)
+	}
+
+	var doc ecbEnvelope
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxFeedSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse exchange rates: %w", err)
+	}
+
+	perEUR := map[string]float64{"EUR": 1}
+	for _, r := range doc.Cube.Cube.Rates {
+		if r.Rate > 0 {
+			perEUR[Normalize(r.Currency)] = r.Rate
+		}
+	}
+	usdPerEUR, ok := perEUR[Base]
+	if !ok {
+		return nil, errors.New("parse exchange rates: no USD rate in feed")
+	}
+
+	rates := make(map[string]float64, len(perEUR))
+	for code, rate := range perEUR {
+		if code != Base {
+			rates[code] = rate / usdPerEUR
+		}
+	}
+	return rates, nil
+}
+
+// Start pulls the feed now and every sync interval until ctx is cancelled.
+// It does nothing without a feed.
+func (c *Converter) Start(ctx context.Context) {
+	if c.cfg.Feed == "" {
+		return
+	}
+	if c.cfg.Feed != FeedECB {
+		log.Warn().Str("feed", c.cfg.Feed).Msg("Unknown exchange rate feed - using manual rates only")
+		return
+	}
+	go func() {
+		sync := func() {
+			if err := c.Sync(ctx); err != nil {
+				log.Warn().Err(err).Msg("Exchange rate sync failed")
+			}
+		}
+		sync()
+		if c.cfg.SyncInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(c.cfg.SyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sync()
+			}
+		}
+	}()
+}
@@ -0,0 +1,164 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Statuses of a dependency and of the instance
+const (
+	StatusHealthy       = "healthy"
+	StatusDegraded      = "degraded"
+	StatusUnhealthy     = "unhealthy"
+	StatusNotConfigured = "not_configured"
+	StatusUnknown       = "unknown" // a background check hasn't finished yet, or the check couldn't tell
+)
+
+// ErrNotConfigured is returned by checks of dependencies that aren't set up,
+// which don't count against the instance
+var ErrNotConfigured = errors.New("not configured")
+
+// ErrUnknown is returned by checks that can't tell, e.g. because another
+// dependency is down; it doesn't count against the instance either
+var ErrUnknown = errors.New("unknown")
+
+// Check verifies that a dependency works
+type Check struct {
+	Name string
+	// Critical dependencies make the instance unhealthy and not ready when
+	// they fail; the others only degrade it
+	Critical bool
+	// Interval runs the check in the background at this interval instead of
+	// on every health request, for checks that are slow or cost money such
+	// as calling a provider. Requests report the latest result.
+	Interval time.Duration
+	// Timeout overrides the checker's timeout
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Checker runs the dependency checks of an instance
+type Checker struct {
+	timeout time.Duration
+	checks  []Check
+
+	mu     sync.Mutex
+	latest map[string]*models.DependencyHealth // results of background checks
+}
+
+// NewChecker creates a checker that gives each check timeout to finish
+func NewChecker(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{timeout: timeout, latest: make(map[string]*models.DependencyHealth)}
+}
+
+// Add registers a check
+func (c *Checker) Add(check Check) {
+	c.checks = append(c.checks, check)
+}
+
+// Start runs the background checks until ctx is cancelled
+func (c *Checker) Start(ctx context.Context) {
+	for _, check := range c.checks {
+		if check.Interval <= 0 {
+			continue
+		}
+		go func() {
+			ticker := time.NewTicker(check.Interval)
+			defer ticker.Stop()
+			for {
+				result := c.run(ctx, check)
+				c.mu.Lock()
+				c.latest[check.Name] = result
+				c.mu.Unlock()
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+// Run returns the status of the instance with the result of each check.
+// Checks without an interval run now, concurrently.
+func (c *Checker) Run(ctx context.Context) (string, map[string]*models.DependencyHealth) {
+	results := make(map[string]*models.DependencyHealth, len(c.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		if check.Interval > 0 {
+			results[check.Name] = c.background(check)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check)
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := StatusHealthy
+	for _, r := range results {
+		if r.Status != StatusUnhealthy {
+			continue
+		}
+		if r.Critical {
+			return StatusUnhealthy, results
+		}
+		status = StatusDegraded
+	}
+	return status, results
+}
+
+// background returns the latest result of a background check
+func (c *Checker) background(check Check) *models.DependencyHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if latest, ok := c.latest[check.Name]; ok {
+		copied := *latest
+		return &copied
+	}
+	return &models.DependencyHealth{Status: StatusUnknown, Critical: check.Critical}
+}
+
+func (c *Checker) run(ctx context.Context, check Check) *models.DependencyHealth {
+	timeout := c.timeout
+	if check.Timeout > 0 {
+		timeout = check.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := &models.DependencyHealth{
+		Status:    StatusHealthy,
+		Critical:  check.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start,
+	}
+	switch {
+	case errors.Is(err, ErrNotConfigured):
+		result.Status = StatusNotConfigured
+	case errors.Is(err, ErrUnknown):
+		result.Status = StatusUnknown
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = StatusUnhealthy
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,185 @@
+// Package history shortens long conversations to fit the context budget of
+// a policy, by dropping their oldest turns or replacing them with a summary
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/epps11/goguard/internal/services/policy"
+)
+
+const (
+	// maxSummaryTokens bounds the summary of the dropped turns
+	maxSummaryTokens = 1024
+	// summaryShare is the share of the budget a summary may take
+	summaryShare = 4
+)
+
+// summaryInstructions asks for the summary of the dropped turns
+const summaryInstructions = "Summarize the following earlier part of a conversation between a user and an assistant, in at most %d words. " +
+	"Keep the facts, decisions, names, numbers and instructions the user gave, and any open questions. " +
+	"Reply with the summary only."
+
+// summaryPrefix introduces the summary in the forwarded conversation
+const summaryPrefix = "[Summary of the earlier conversation, shortened to fit the context budget]\n"
+
+// Compactor fits conversations into context budgets
+type Compactor struct {
+	factory *llm.ClientFactory
+}
+
+// NewCompactor creates a compactor. factory supplies the clients of summary
+// profiles; with a nil factory summaries are written by the request's own
+// client.
+func NewCompactor(factory *llm.ClientFactory) *Compactor {
+	return &Compactor{factory: factory}
+}
+
+// Fit shortens messages to budget, counting tools and reserved tokens, such
+// as those of system prompts added later, against it. System messages and
+// the latest turn are always kept; older turns, each starting at a user
+// message, go oldest first. Summaries are written by client unless the
+// budget names a profile. It returns messages unchanged, with a nil report,
+// when they fit.
+func (c *Compactor) Fit(ctx context.Context, messages []models.Message, tools []models.Tool, reserved int, budget *policy.ContextBudget, client *llm.Client) ([]models.Message, *models.ContextReport) {
+	original := llm.EstimateTokens(messages, tools) + reserved
+	if original <= budget.Tokens {
+		return messages, nil
+	}
+
+	report := &models.ContextReport{
+		PolicyID:       budget.PolicyID,
+		PolicyName:     budget.PolicyName,
+		Strategy:       budget.Strategy,
+		Budget:         budget.Tokens,
+		OriginalTokens: original,
+		Dropped:        []int{},
+	}
+
+	summaryTokens := 0
+	if budget.Strategy == policy.ContextSummarize {
+		summaryTokens = min(budget.Tokens/summaryShare, maxSummaryTokens)
+	}
+	keep := dropTurns(messages, tools, reserved+summaryTokens, budget.Tokens)
+	for i, kept := range keep {
+		if !kept {
+			report.Dropped = append(report.Dropped, i)
+		}
+	}
+
+	var summary string
+	if summaryTokens > 0 && len(report.Dropped) > 0 {
+		var err error
+		summary, err = c.summarize(ctx, messages, report, summaryTokens, budget.SummaryProfile, client)
+		if err != nil {
+			report.Error = err.Error()
+		}
+	}
+
+	fitted := make([]models.Message, 0, len(messages)-len(report.Dropped)+1)
+	for i, msg := range messages {
+		// The summary takes the place of the first dropped turn, after the
+		// system messages before it
+		if summary != "" && i == report.Dropped[0] {
+			fitted = append(fitted, models.Message{Role: "user", Content: summaryPrefix + summary})
+			report.Summarized = true
+		}
+		if keep[i] {
+			fitted = append(fitted, msg)
+		}
+	}
+	report.Tokens = llm.EstimateTokens(fitted, tools) + reserved
+	return fitted, report
+}
+
+// dropTurns marks the messages kept when the oldest turns are dropped until
+// the rest, with reserved tokens, fit in budget
+func dropTurns(messages []models.Message, tools []models.Tool, reserved, budget int) []bool {
+	keep := make([]bool, len(messages))
+	for i := range keep {
+		keep[i] = true
+	}
+
+	// Turns start at user messages; what comes before the first one is a
+	// turn too. The latest turn is never dropped.
+	var starts []int
+	for i, msg := range messages {
+		if msg.Role == "user" || (i == 0 && msg.Role != "system") {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) < 2 {
+		return keep
+	}
+
+	tokens := llm.EstimateTokens(messages, tools) + reserved
+	for t := 0; t < len(starts)-1 && tokens > budget; t++ {
+		for i := starts[t]; i < starts[t+1]; i++ {
+			if messages[i].Role == "system" {
+				continue
+			}
+			keep[i] = false
+			tokens -= llm.EstimateTokens(messages[i:i+1], nil)
+		}
+	}
+	return keep
+}
+
+// summarize asks the summary profile's model, or client's, for a summary of
+// the dropped messages
+func (c *Compactor) summarize(ctx context.Context, messages []models.Message, report *models.ContextReport, maxTokens int, profile string, client *llm.Client) (string, error) {
+	if profile != "" {
+		if c.factory == nil {
+			return "", fmt.Errorf("summary profile %s: no LLM profiles configured", profile)
+		}
+		profileClient, shouldClose, err := c.factory.GetClient(ctx, &models.GuardRequest{LLMProfile: profile})
+		if err != nil {
+			return "", fmt.Errorf("summary profile %s: %w", profile, err)
+		}
+		if shouldClose {
+			defer profileClient.Close()
+		}
+		client = profileClient
+	}
+	if client == nil {
+		return "", errors.New("no LLM client to write the summary with")
+	}
+
+	var transcript strings.Builder
+	for _, i := range report.Dropped {
+		msg := messages[i]
+		content := msg.Content
+		if content == "" && len(msg.ToolCalls) > 0 {
+			var calls []string
+			for _, call := range msg.ToolCalls {
+				calls = append(calls, call.Function.Name+"("+call.Function.Arguments+")")
+			}
+			content = "called " + strings.Join(calls, ", ")
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, content)
+	}
+
+	resp, err := client.Chat(llm.WithMaxTokens(ctx, maxTokens), []models.Message{
+		{Role: "system", Content: fmt.Sprintf(summaryInstructions, maxTokens*3/4)},
+		{Role: "user", Content: transcript.String()},
+	})
+	if err != nil {
+		return "", fmt.Errorf("summarizing failed: %w", err)
+	}
+	_, report.SummaryModel = client.Target()
+	if resp.Model != "" {
+		report.SummaryModel = resp.Model
+	}
+	report.SummaryUsage = resp.Usage
+
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", errors.New("summarizing failed: empty summary")
+	}
+	return summary, nil
+}
@@ -0,0 +1,202 @@
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/pii"
+)
+
+// Modes for handling image parts
+const (
+	ModeForward = "forward" // pass images through unscanned
+	ModeOCR     = "ocr"     // extract text and scan it like the rest of the prompt
+	ModeStrip   = "strip"   // drop images, forward the text
+	ModeBlock   = "block"   // reject requests with images
+)
+
+// ErrImagesBlocked is returned when a request's images may not be forwarded
+var ErrImagesBlocked = errors.New("request blocked by image policy")
+
+// Scanner applies the configured image handling to multimodal messages
+type Scanner struct {
+	cfg      config.ImagesConfig
+	command  []string
+	detector *injection.Detector
+	masker   *pii.Masker
+}
+
+// NewScanner creates a scanner that checks OCR'd image text with the
+// request pipeline's injection detector and PII masker
+func NewScanner(cfg config.ImagesConfig, detector *injection.Detector, masker *pii.Masker) *Scanner {
+	switch cfg.Mode {
+	case ModeForward, ModeOCR, ModeStrip, ModeBlock:
+	default:
+		log.Warn().Str("mode", cfg.Mode).Msg("Unknown image mode - forwarding images unscanned")
+		cfg.Mode = ModeForward
+	}
+	if cfg.OnFinding != ModeBlock {
+		cfg.OnFinding = ModeStrip
+	}
+	return &Scanner{
+		cfg:      cfg,
+		command:  strings.Fields(cfg.OCRCommand),
+		detector: detector,
+		masker:   masker,
+	}
+}
+
+// Process returns messages with the image parts that may be forwarded and a
+// report of what was done. It returns ErrImagesBlocked, with the report, when
+// the request has to be rejected. Messages left without images are collapsed
+// to plain text.
+func (s *Scanner) Process(ctx context.Context, messages []models.Message) ([]models.Message, *models.ImageReport, error) {
+	report := &models.ImageReport{}
+	result := make([]models.Message, len(messages))
+	blocked := false
+
+	for i, msg := range messages {
+		result[i] = msg
+		if !msg.HasImages() {
+			continue
+		}
+
+		parts := make([]models.ContentPart, 0, len(msg.Parts))
+		for j, part := range msg.Parts {
+			if part.Type != models.PartImage {
+				parts = append(parts, part)
+				continue
+			}
+			report.Images++
+			location := fmt.Sprintf("message[%d].content[%d]", i, j)
+
+			reason := ""
+			switch s.cfg.Mode {
+			case ModeForward:
+			case ModeStrip:
+				reason = "images are stripped"
+			case ModeBlock:
+				reason = "images are not allowed"
+				blocked = true
+			case ModeOCR:
+				var scanned bool
+				reason, scanned = s.scan(ctx, msg.Role, part.ImageURL.URL)
+				if scanned {
+					report.Scanned++
+				}
+				if reason != "" && s.cfg.OnFinding == ModeBlock {
+					blocked = true
+				}
+			}
+
+			if reason == "" {
+				parts = append(parts, part)
+				continue
+			}
+			report.Findings = append(report.Findings, models.ImageFinding{Location: location, Reason: reason})
+			report.Stripped++
+		}
+
+		result[i].Parts = parts
+		result[i].Content = models.JoinText(parts)
+		if !result[i].HasImages() {
+			result[i].Parts = nil
+		}
+	}
+
+	if blocked {
+		report.Stripped = 0
+		return messages, report, ErrImagesBlocked
+	}
+	return result, report, nil
+}
+
+// scan OCRs an image and checks its text. It returns why the image can't be
+// forwarded, if it can't, and whether its text was scanned.
+func (s *Scanner) scan(ctx context.Context, role, url string) (string, bool) {
+	data, err := s.decode(url)
+	if err != nil {
+		return err.Error(), false
+	}
+
+	text, err := s.ocr(ctx, data)
+	if err != nil {
+		log.Warn().Err(err).Msg("Image OCR failed")
+		return "text extraction failed", false
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", true
+	}
+
+	extracted := []models.Message{{Role: role, Content: text}}
+	if report := s.detector.Analyze(extracted); report.InjectionDetected {
+		return fmt.Sprintf("prompt injection in image text (%s threat)", report.ThreatLevel), true
+	}
+	if report := s.masker.Analyze(extracted); report.PIIDetected {
+		types := make([]string, 0, len(report.PIITypes))
+		seen := make(map[string]bool)
+		for _, match := range report.PIITypes {
+			if !seen[match.Type] {
+				seen[match.Type] = true
+				types = append(types, match.Type)
+			}
+		}
+		return "PII in image text: " + strings.Join(types, ", "), true
+	}
+	return "", true
+}
+
+// decode returns the bytes of a base64 data URL. Remote images aren't fetched,
+// so they can't be scanned.
+func (s *Scanner) decode(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "data:") {
+		return nil, errors.New("remote images can't be scanned")
+	}
+	header, payload, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, errors.New("image is not base64 encoded")
+	}
+	if s.cfg.MaxBytes > 0 && base64.StdEncoding.DecodedLen(len(payload)) > s.cfg.MaxBytes {
+		return nil, fmt.Errorf("image is larger than %d bytes", s.cfg.MaxBytes)
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("image is not valid base64")
+	}
+	return data, nil
+}
+
+// ocr runs the configured command with the image on stdin
+func (s *Scanner) ocr(ctx context.Context, data []byte) (string, error) {
+	if len(s.command) == 0 {
+		return "", errors.New("no OCR command configured")
+	}
+	if s.cfg.OCRTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.OCRTimeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,120 @@
+package injection
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// EscalationTurns is how many flagged turns, the current one included, make
+// a conversation an escalating attempt
+const EscalationTurns = 3
+
+// conversationLocation is where detections spanning turns are reported
+const conversationLocation = "conversation"
+
+// LatestUserText returns the last user message of a request, the turn it
+// adds to its conversation
+func LatestUserText(messages []models.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// AnalyzeConversation adds to report what only shows across the turns of a
+// conversation: patterns split between earlier turns and this request, and
+// repeated or escalating attempts. report must be the request's own
+// analysis. A report whose scan stopped early is left as it is: the request
+// is blocked anyway, and its missing detections would look new. Detections
+// suppressor drops are moved to the report's suppressed ones.
+func (d *Detector) AnalyzeConversation(report *models.SecurityReport, earlier []models.ConversationTurn, messages []models.Message, suppressor Suppressor) {
+	if !d.enabled.Load() || len(earlier) == 0 || report.ScanStopped {
+		return
+	}
+	report.ConversationTurns = len(earlier)
+
+	history := make([]string, len(earlier))
+	for i, t := range earlier {
+		history[i] = t.Text
+	}
+	current := LatestUserText(messages)
+
+	// Patterns matched by the earlier turns were reported with them, and
+	// those the request matches alone are already in its report, so only
+	// patterns completed by this turn are new
+	seen := make(map[string]bool)
+	for _, det := range append(slices.Clip(report.Detections), report.Suppressed...) {
+		seen[det.Pattern] = true
+	}
+	for _, text := range []string{strings.Join(history, "\n"), current} {
+		for _, det := range d.Analyze([]models.Message{{Role: "user", Content: text}}).Detections {
+			seen[det.Pattern] = true
+		}
+	}
+	joined := d.Analyze([]models.Message{{Role: "user", Content: strings.Join(append(history, current), "\n")}})
+	for _, det := range joined.Detections {
+		if seen[det.Pattern] {
+			continue
+		}
+		seen[det.Pattern] = true
+		det.Location = conversationLocation
+		det.Description = "Pattern split across conversation turns"
+		found, suppressed := suppress([]models.Detection{det}, suppressor)
+		report.Detections = append(report.Detections, found...)
+		report.Suppressed = append(report.Suppressed, suppressed...)
+	}
+
+	// A flagged turn counts towards escalation, the current one included
+	if len(report.Detections) > 0 {
+		levels := make([]string, 0, len(earlier)+1)
+		flagged := 1
+		for _, t := range earlier {
+			levels = append(levels, t.ThreatLevel)
+			if t.Detections > 0 {
+				flagged++
+			}
+		}
+		levels = append(levels, calculateThreatLevel(report.Detections))
+		if flagged >= EscalationTurns || rising(levels) {
+			found, suppressed := suppress([]models.Detection{{
+				Type:        "escalation",
+				Pattern:     "multi_turn",
+				Location:    conversationLocation,
+				Confidence:  0.85,
+				Description: fmt.Sprintf("%d of %d conversation turns flagged", flagged, len(levels)),
+				PatternID:   PatternID("multi_turn"),
+			}}, suppressor)
+			report.Detections = append(report.Detections, found...)
+			report.Suppressed = append(report.Suppressed, suppressed...)
+		}
+	}
+
+	report.InjectionDetected = len(report.Detections) > 0
+	report.ThreatLevel = calculateThreatLevel(report.Detections)
+	if report.InjectionDetected {
+		report.Recommendations = generateRecommendations(report.Detections)
+		if d.blockOnDetection.Load() && report.ThreatLevel != "low" {
+			report.BlockedReason = "Potential prompt injection detected"
+		}
+	}
+}
+
+// rising reports whether the threat level went up with each of the last
+// EscalationTurns turns
+func rising(levels []string) bool {
+	if len(levels) < EscalationTurns {
+		return false
+	}
+	last := levels[len(levels)-EscalationTurns:]
+	for i := 1; i < len(last); i++ {
+		if slices.Index(ThreatLevels, last[i]) <= slices.Index(ThreatLevels, last[i-1]) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,26 +1,55 @@
 package injection
 
 import (
+	"fmt"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/scan"
+)
+
+// Scan limits
+const (
+	// DefaultChunkBytes is the size of the chunks large messages are scanned
+	// in, unless set with SetScanLimits
+	DefaultChunkBytes = 64 * 1024
+	// chunkOverlap is how far each chunk reaches back into the previous one.
+	// Matches longer than this can be missed where chunks meet.
+	chunkOverlap = 1024
+	// minChunkBytes keeps chunks well above the overlap
+	minChunkBytes = 4 * chunkOverlap
 )
 
 // Detector handles prompt injection detection
 type Detector struct {
-	patterns         []*regexp.Regexp
+	builtin          []*regexp.Regexp
+	patterns         []*regexp.Regexp // builtin followed by custom patterns
+	set              *scan.Set        // of patterns
+	patternsMu       sync.RWMutex
 	keywordPatterns  []string
-	enabled          bool
-	blockOnDetection bool
+	keywords         *scan.Automaton // of keywordPatterns
+	enabled          atomic.Bool
+	blockOnDetection atomic.Bool
+	metrics          scan.Metrics
+
+	chunkBytes   atomic.Int64
+	maxScanBytes atomic.Int64 // 0 is unlimited
+	earlyExit    atomic.Bool
 }
 
 // NewDetector creates a new injection detector
 func NewDetector(customPatterns []string, enabled, blockOnDetection bool) *Detector {
-	d := &Detector{
-		enabled:          enabled,
-		blockOnDetection: blockOnDetection,
-	}
+	d := &Detector{}
+	d.enabled.Store(enabled)
+	d.blockOnDetection.Store(blockOnDetection)
+	d.chunkBytes.Store(DefaultChunkBytes)
+	d.earlyExit.Store(true)
 
 	// Default injection patterns
 	defaultPatterns := []string{
@@ -75,9 +104,10 @@ func NewDetector(customPatterns []string, enabled, blockOnDetection bool) *Detec
 	// Compile default patterns
 	for _, p := range defaultPatterns {
 		if re, err := regexp.Compile(p); err == nil {
-			d.patterns = append(d.patterns, re)
+			d.builtin = append(d.builtin, re)
 		}
 	}
+	d.patterns = slices.Clip(d.builtin)
 
 	// Compile custom patterns
 	for _, p := range customPatterns {
@@ -85,6 +115,7 @@ func NewDetector(customPatterns []string, enabled, blockOnDetection bool) *Detec
 			d.patterns = append(d.patterns, re)
 		}
 	}
+	d.set = scan.NewSet(d.patterns)
 
 	// Keyword-based detection (case-insensitive substring matching)
 	d.keywordPatterns = []string{
@@ -100,12 +131,94 @@ func NewDetector(customPatterns []string, enabled, blockOnDetection bool) *Detec
 		"human:",
 		"user:",
 	}
+	d.keywords = scan.NewAutomaton(d.keywordPatterns)
 
 	return d
 }
 
+// SetEnabled turns injection detection on or off while requests are served
+func (d *Detector) SetEnabled(enabled bool) {
+	d.enabled.Store(enabled)
+}
+
+// SetBlockOnDetection sets whether detected injections are blocked
+func (d *Detector) SetBlockOnDetection(block bool) {
+	d.blockOnDetection.Store(block)
+}
+
+// SetScanLimits sets the size of the chunks large messages are scanned in,
+// the most bytes of a request scanned, 0 for no limit, and whether
+// AnalyzeUntil stops once a request reaches its block threshold
+func (d *Detector) SetScanLimits(chunkBytes, maxBytes int, earlyExit bool) {
+	if chunkBytes <= 0 {
+		chunkBytes = DefaultChunkBytes
+	}
+	d.chunkBytes.Store(int64(max(chunkBytes, minChunkBytes)))
+	d.maxScanBytes.Store(int64(max(maxBytes, 0)))
+	d.earlyExit.Store(earlyExit)
+}
+
+// MaxScanBytes returns the most bytes of a request scanned, 0 for no limit
+func (d *Detector) MaxScanBytes() int {
+	return int(d.maxScanBytes.Load())
+}
+
+// SetCustomPatterns replaces the patterns detected besides the built-in
+// ones. If any pattern doesn't compile, none are replaced.
+func (d *Detector) SetCustomPatterns(customPatterns []string) error {
+	patterns := slices.Clip(d.builtin)
+	for _, p := range customPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid injection pattern %q: %w", p, err)
+		}
+		patterns = append(patterns, re)
+	}
+	set := scan.NewSet(patterns)
+
+	d.patternsMu.Lock()
+	defer d.patternsMu.Unlock()
+	d.patterns, d.set = patterns, set
+	return nil
+}
+
+// Stats returns the time spent scanning messages and how many patterns the
+// prefilter spared
+func (d *Detector) Stats() scan.Stats {
+	d.patternsMu.RLock()
+	patterns := len(d.patterns)
+	d.patternsMu.RUnlock()
+	return d.metrics.Stats(patterns)
+}
+
 // Analyze checks messages for injection attempts
 func (d *Detector) Analyze(messages []models.Message) *models.SecurityReport {
+	return d.analyze(messages, "", nil)
+}
+
+// AnalyzeWith checks messages like Analyze, moving the detections suppressor
+// drops to the report's suppressed ones before the threat level is set. A
+// nil suppressor keeps every detection.
+func (d *Detector) AnalyzeWith(messages []models.Message, suppressor Suppressor) *models.SecurityReport {
+	return d.analyze(messages, "", suppressor)
+}
+
+// AnalyzeUntil checks messages like AnalyzeWith, but stops once the report
+// reaches threshold, the lowest threat level blocked, since later findings
+// can't change the outcome. An empty threshold is the detector's own. The
+// report is then marked as cut short.
+func (d *Detector) AnalyzeUntil(messages []models.Message, threshold string, suppressor Suppressor) *models.SecurityReport {
+	if !d.earlyExit.Load() {
+		threshold = ""
+	} else if threshold == "" && d.blockOnDetection.Load() {
+		threshold = "high"
+	}
+	return d.analyze(messages, threshold, suppressor)
+}
+
+// analyze checks messages, stopping once the report reaches stopAt, if set.
+// Suppressed detections don't count towards it.
+func (d *Detector) analyze(messages []models.Message, stopAt string, suppressor Suppressor) *models.SecurityReport {
 	report := &models.SecurityReport{
 		InjectionDetected: false,
 		ThreatLevel:       "none",
@@ -113,10 +226,15 @@ func (d *Detector) Analyze(messages []models.Message) *models.SecurityReport {
 		Recommendations:   []string{},
 	}
 
-	if !d.enabled {
+	if !d.enabled.Load() {
 		return report
 	}
 
+	d.patternsMu.RLock()
+	patterns, set := d.patterns, d.set
+	d.patternsMu.RUnlock()
+	chunkBytes, budget := int(d.chunkBytes.Load()), int(d.maxScanBytes.Load())
+
 	for i, msg := range messages {
 		// Skip system messages - they're trusted
 		if msg.Role == "system" {
@@ -124,47 +242,60 @@ func (d *Detector) Analyze(messages []models.Message) *models.SecurityReport {
 		}
 
 		content := msg.Content
+		if budget > 0 && report.ScannedBytes+len(content) > budget {
+			content = content[:runeStart(content, budget-report.ScannedBytes)]
+			report.ScanTruncated = true
+		}
 		location := formatLocation(i, msg.Role)
-
-		// Check regex patterns
-		for _, pattern := range d.patterns {
-			if matches := pattern.FindStringSubmatch(content); len(matches) > 0 {
-				detection := models.Detection{
-					Type:        categorizePattern(pattern.String()),
-					Pattern:     pattern.String(),
-					Location:    location,
-					Confidence:  0.85,
-					Description: "Regex pattern match detected",
+		start := time.Now()
+
+		// Each pattern and keyword is reported once per message, whichever
+		// chunks it was found in
+		matched := make([]bool, len(patterns))
+		keywords := make([]bool, len(d.keywordPatterns))
+		suspicious := false
+		run, skipped, scanned := 0, 0, 0
+		for _, bounds := range chunks(content, chunkBytes) {
+			chunk := content[bounds[0]:bounds[1]]
+			scanned = bounds[1]
+
+			// Check the regex patterns that could match
+			candidates := set.Candidates(chunk)
+			run, skipped = run+len(candidates), skipped+len(patterns)-len(candidates)
+			for _, p := range candidates {
+				if !matched[p] && patterns[p].MatchString(chunk) {
+					matched[p] = true
 				}
-				report.Detections = append(report.Detections, detection)
 			}
-		}
 
-		// Check keyword patterns
-		lowerContent := strings.ToLower(content)
-		for _, keyword := range d.keywordPatterns {
-			if strings.Contains(lowerContent, keyword) {
-				detection := models.Detection{
-					Type:        "keyword_match",
-					Pattern:     keyword,
-					Location:    location,
-					Confidence:  0.7,
-					Description: "Suspicious keyword detected",
-				}
-				report.Detections = append(report.Detections, detection)
+			// Check keyword patterns, ignoring case
+			for _, k := range d.keywords.Find(chunk) {
+				keywords[k] = true
 			}
-		}
 
-		// Check for suspicious character sequences
-		if hasSuspiciousSequences(content) {
-			detection := models.Detection{
-				Type:        "suspicious_encoding",
-				Pattern:     "special_characters",
-				Location:    location,
-				Confidence:  0.6,
-				Description: "Suspicious character sequences detected",
+			// Check for suspicious character sequences
+			suspicious = suspicious || hasSuspiciousSequences(chunk)
+
+			if stopAt != "" && scanned < len(content) {
+				found, _ := suppress(d.detections(location, patterns, matched, keywords, suspicious), suppressor)
+				if reaches(append(slices.Clip(report.Detections), found...), stopAt) {
+					report.ScanStopped = true
+					break
+				}
 			}
-			report.Detections = append(report.Detections, detection)
+		}
+		found, suppressed := suppress(d.detections(location, patterns, matched, keywords, suspicious), suppressor)
+		report.Detections = append(report.Detections, found...)
+		report.Suppressed = append(report.Suppressed, suppressed...)
+		report.ScannedBytes += scanned
+		d.metrics.Record(scanned, run, skipped, time.Since(start))
+
+		if report.ScanTruncated || report.ScanStopped {
+			break
+		}
+		if stopAt != "" && i < len(messages)-1 && reaches(report.Detections, stopAt) {
+			report.ScanStopped = true
+			break
 		}
 	}
 
@@ -174,7 +305,7 @@ func (d *Detector) Analyze(messages []models.Message) *models.SecurityReport {
 
 	if report.InjectionDetected {
 		report.Recommendations = generateRecommendations(report.Detections)
-		if d.blockOnDetection && report.ThreatLevel != "low" {
+		if d.blockOnDetection.Load() && report.ThreatLevel != "low" {
 			report.BlockedReason = "Potential prompt injection detected"
 		}
 	}
@@ -182,14 +313,112 @@ func (d *Detector) Analyze(messages []models.Message) *models.SecurityReport {
 	return report
 }
 
+// detections reports the patterns, keywords and suspicious characters found
+// in a message
+func (d *Detector) detections(location string, patterns []*regexp.Regexp, matched, keywords []bool, suspicious bool) []models.Detection {
+	var detections []models.Detection
+	for p, ok := range matched {
+		if !ok {
+			continue
+		}
+		detections = append(detections, models.Detection{
+			Type:        categorizePattern(patterns[p].String()),
+			Pattern:     patterns[p].String(),
+			Location:    location,
+			Confidence:  0.85,
+			Description: "Regex pattern match detected",
+			PatternID:   PatternID(patterns[p].String()),
+		})
+	}
+	for k, ok := range keywords {
+		if !ok {
+			continue
+		}
+		detections = append(detections, models.Detection{
+			Type:        "keyword_match",
+			Pattern:     d.keywordPatterns[k],
+			Location:    location,
+			Confidence:  0.7,
+			Description: "Suspicious keyword detected",
+			PatternID:   PatternID(d.keywordPatterns[k]),
+		})
+	}
+	if suspicious {
+		detections = append(detections, models.Detection{
+			Type:        "suspicious_encoding",
+			Pattern:     "special_characters",
+			Location:    location,
+			Confidence:  0.6,
+			Description: "Suspicious character sequences detected",
+			PatternID:   PatternID("special_characters"),
+		})
+	}
+	return detections
+}
+
+// reaches reports whether detections make a threat level of at least
+// threshold
+func reaches(detections []models.Detection, threshold string) bool {
+	return slices.Index(ThreatLevels, calculateThreatLevel(detections)) >= slices.Index(ThreatLevels, threshold)
+}
+
+// chunks splits content into chunks of about size bytes, returning the
+// start and end of each. Each chunk but the first starts at least
+// chunkOverlap bytes before the previous one ended, so a short match across
+// the boundary is whole in one of them. Chunks end and start after
+// whitespace where they can, so they don't split words.
+func chunks(content string, size int) [][2]int {
+	if len(content) <= size {
+		return [][2]int{{0, len(content)}}
+	}
+	var bounds [][2]int
+	for start := 0; ; {
+		end := start + size
+		if end >= len(content) {
+			return append(bounds, [2]int{start, len(content)})
+		}
+		if ws := strings.LastIndexAny(content[end-chunkOverlap:end], " \t\r\n"); ws >= 0 {
+			end = end - chunkOverlap + ws + 1
+		} else {
+			end = runeStart(content, end)
+		}
+		bounds = append(bounds, [2]int{start, end})
+
+		next := end - chunkOverlap
+		if ws := strings.LastIndexAny(content[next-chunkOverlap:next], " \t\r\n"); ws >= 0 {
+			next = next - chunkOverlap + ws + 1
+		} else {
+			next = runeStart(content, next)
+		}
+		start = next
+	}
+}
+
+// runeStart moves i back to the start of the rune it falls in
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
 // ShouldBlock returns true if the request should be blocked
 func (d *Detector) ShouldBlock(report *models.SecurityReport) bool {
-	if !d.blockOnDetection {
+	if !d.blockOnDetection.Load() {
 		return false
 	}
 	return report.ThreatLevel == "high" || report.ThreatLevel == "critical"
 }
 
+// ThreatLevels are the threat levels of reports, from least to most severe
+var ThreatLevels = []string{"none", "low", "medium", "high", "critical"}
+
+// ShouldBlockAt reports whether a report reaches threshold, the lowest
+// threat level to block, whatever the detector's own setting
+func ShouldBlockAt(report *models.SecurityReport, threshold string) bool {
+	return report.InjectionDetected && slices.Index(ThreatLevels, report.ThreatLevel) >= slices.Index(ThreatLevels, threshold)
+}
+
 func formatLocation(index int, role string) string {
 	return strings.ToLower(role) + "_message_" + string(rune('0'+index))
 }
@@ -288,6 +517,8 @@ func generateRecommendations(detections []models.Detection) []string {
 			recommendations = append(recommendations, "Special delimiter tokens detected - potential injection")
 		case "data_exfiltration":
 			recommendations = append(recommendations, "Potential data exfiltration attempt detected")
+		case "escalation":
+			recommendations = append(recommendations, "Repeated injection attempts in this conversation - review the whole session")
 		}
 	}
 
@@ -0,0 +1,70 @@
+package injection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// PatternIDPrefix starts the pattern IDs of injection detections
+const PatternIDPrefix = "inj_"
+
+// PatternID returns the stable ID of a pattern, keyword or detection marker:
+// a short hash of its text, so it survives restarts and reordering but
+// changes when a custom pattern is edited
+func PatternID(pattern string) string {
+	sum := sha256.Sum256([]byte(pattern))
+	return PatternIDPrefix + hex.EncodeToString(sum[:6])
+}
+
+// Suppressor returns the ID of the suppression rule that drops a detection
+// from a report, or "" to keep it
+type Suppressor func(models.Detection) string
+
+// suppress splits detections into those kept and those a suppression rule
+// drops, which are marked with the rule
+func suppress(detections []models.Detection, suppressor Suppressor) (kept, suppressed []models.Detection) {
+	if suppressor == nil {
+		return detections, nil
+	}
+	kept = detections[:0:0]
+	for _, det := range detections {
+		if id := suppressor(det); id != "" {
+			det.SuppressedBy = id
+			suppressed = append(suppressed, det)
+			continue
+		}
+		kept = append(kept, det)
+	}
+	return kept, suppressed
+}
+
+// HasPattern reports whether id is the pattern ID of one of the detector's
+// patterns or keywords, or of a suspicious-character or multi-turn finding
+func (d *Detector) HasPattern(id string) bool {
+	_, ok := d.Pattern(id)
+	return ok
+}
+
+// Pattern returns the pattern, keyword or finding whose pattern ID is id
+func (d *Detector) Pattern(id string) (string, bool) {
+	for _, marker := range []string{"special_characters", "multi_turn"} {
+		if PatternID(marker) == id {
+			return marker, true
+		}
+	}
+	d.patternsMu.RLock()
+	defer d.patternsMu.RUnlock()
+	for _, p := range d.patterns {
+		if PatternID(p.String()) == id {
+			return p.String(), true
+		}
+	}
+	for _, k := range d.keywordPatterns {
+		if PatternID(k) == id {
+			return k, true
+		}
+	}
+	return "", false
+}
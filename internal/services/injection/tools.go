@@ -0,0 +1,89 @@
+package injection
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// toolArgumentPattern flags a risky kind of tool call argument
+type toolArgumentPattern struct {
+	kind        string
+	re          *regexp.Regexp
+	confidence  float64
+	description string
+}
+
+// toolArgumentPatterns are checked against the JSON arguments of tool
+// calls, most confident first within each kind. Agents execute these
+// arguments, so shell commands, internal URLs and credential paths in them
+// are worth a second look even when the prompt was clean.
+var toolArgumentPatterns = []toolArgumentPattern{
+	{"shell_command", regexp.MustCompile(`(?i)(curl|wget)\s[^|]*\|\s*(ba|z)?sh\b`),
+		0.95, "Downloads and executes a script"},
+	{"shell_command", regexp.MustCompile(`(?i)\b(nc|ncat|netcat)\s+(-[a-z]*e|.*\s-e\s)|/dev/tcp/|\bbash\s+-i\b`),
+		0.95, "Reverse shell"},
+	{"shell_command", regexp.MustCompile(`(?i)\b(rm\s+-[a-z]*[rf]|sudo\s|chmod\s+[0-7]{3,4}|chown\s|mkfs|dd\s+if=|shutdown\b|kill\s+-9)`),
+		0.85, "Destructive or privileged shell command"},
+	{"shell_command", regexp.MustCompile(`\$\([^)]+\)|` + "`[^`]+`" + `|;\s*(rm|curl|wget|bash|sh|python|nc)\b|&&\s*(rm|curl|wget|bash|sh|nc)\b`),
+		0.7, "Command substitution or chained command"},
+	{"internal_url", regexp.MustCompile(`(?i)\b(https?|gopher|file)://(localhost|127\.\d+\.\d+\.\d+|0\.0\.0\.0|10\.\d+\.\d+\.\d+|192\.168\.\d+\.\d+|172\.(1[6-9]|2\d|3[01])\.\d+\.\d+|169\.254\.\d+\.\d+|metadata\.google\.internal|\[::1\])`),
+		0.9, "URL pointing at an internal or cloud metadata address"},
+	{"url", regexp.MustCompile(`(?i)\b(https?|ftp)://[^\s"']+`),
+		0.4, "External URL"},
+	{"sensitive_path", regexp.MustCompile(`(?i)(/etc/(passwd|shadow|sudoers)|\.ssh/|\.aws/credentials|\.kube/config|\.env\b|id_rsa)`),
+		0.8, "Path to credentials or system files"},
+}
+
+// AnalyzeToolCalls flags risky arguments of the tool calls in a conversation
+// and in a model's response. Findings are informational: they don't affect
+// the threat level or blocking.
+func (d *Detector) AnalyzeToolCalls(messages []models.Message, response []models.ToolCall) []models.Detection {
+	if !d.enabled.Load() {
+		return nil
+	}
+
+	var findings []models.Detection
+	for i, msg := range messages {
+		for _, call := range msg.ToolCalls {
+			findings = append(findings, scanToolCall(call, fmt.Sprintf("message[%d].tool_calls[%s]", i, call.Function.Name))...)
+		}
+	}
+	for _, call := range response {
+		findings = append(findings, scanToolCall(call, fmt.Sprintf("llm_response.tool_calls[%s]", call.Function.Name))...)
+	}
+	return findings
+}
+
+// scanToolCall reports each kind of risky argument once per call, with the
+// highest-confidence match
+func scanToolCall(call models.ToolCall, location string) []models.Detection {
+	var findings []models.Detection
+	seen := make(map[string]bool)
+	for _, p := range toolArgumentPatterns {
+		if seen[p.kind] || (p.kind == "url" && seen["internal_url"]) {
+			continue
+		}
+		match := p.re.FindString(call.Function.Arguments)
+		if match == "" {
+			continue
+		}
+		seen[p.kind] = true
+		findings = append(findings, models.Detection{
+			Type:        p.kind,
+			Pattern:     truncate(match, 100),
+			Location:    location,
+			Confidence:  p.confidence,
+			Description: p.description,
+		})
+	}
+	return findings
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
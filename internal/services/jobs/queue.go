@@ -0,0 +1,473 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// maxMemoryJobs is how many finished jobs are kept without a database
+const maxMemoryJobs = 100
+
+// ErrUnknownType is returned when queueing a job of an unregistered type
+var ErrUnknownType = errors.New("unknown job type")
+
+// ErrJobActive is returned when queueing an exclusive job while another of
+// its type is pending or running
+var ErrJobActive = errors.New("a job of this type is already pending or running")
+
+// ErrJobNotFound is returned for unknown job IDs
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobFinished is returned when cancelling a job that has already stopped
+var ErrJobFinished = errors.New("job has already finished")
+
+// Progress reports how many of a job's items are done. Total may be 0 until
+// it is known.
+type Progress func(done, total int)
+
+// Runner runs a job and returns its result, which is stored as JSON. It
+// should return promptly once ctx is cancelled.
+type Runner func(ctx context.Context, job *models.Job, progress Progress) (interface{}, error)
+
+// Type is a kind of job the queue can run
+type Type struct {
+	Name string
+	Run  Runner
+	// Exclusive types run one job at a time; queueing another while one is
+	// pending or running fails with ErrJobActive
+	Exclusive bool
+}
+
+// Queue stores jobs in the database, or in memory without one, and runs them
+// on a pool of workers. With a database, jobs queued on one instance may run
+// on another.
+type Queue struct {
+	repo    *database.Repository
+	cfg     config.JobsConfig
+	types   map[string]Type
+	jobs    []*models.Job // without a database, oldest first
+	cancels map[string]context.CancelFunc
+	wake    chan struct{}
+	mu      sync.Mutex
+}
+
+// NewQueue creates a job queue; jobs run once Start is called
+func NewQueue(repo *database.Repository, cfg config.JobsConfig) *Queue {
+	return &Queue{
+		repo:    repo,
+		cfg:     cfg,
+		types:   make(map[string]Type),
+		cancels: make(map[string]context.CancelFunc),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Register adds a job type. Types must be registered before Start.
+func (q *Queue) Register(t Type) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.types[t.Name] = t
+}
+
+// Enqueue queues a job of the given type with params, which are stored as JSON
+func (q *Queue) Enqueue(ctx context.Context, jobType string, params interface{}, createdBy string) (*models.Job, error) {
+	q.mu.Lock()
+	t, ok := q.types[jobType]
+	q.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, jobType)
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encode job params: %w", err)
+	}
+	now := time.Now()
+	job := &models.Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		Status:    models.JobPending,
+		Params:    raw,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if q.repo != nil {
+		created, err := q.repo.CreateJob(ctx, job, t.Exclusive)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			return nil, ErrJobActive
+		}
+	} else {
+		q.mu.Lock()
+		if t.Exclusive && slices.ContainsFunc(q.jobs, func(j *models.Job) bool { return j.Type == jobType && !j.Finished() }) {
+			q.mu.Unlock()
+			return nil, ErrJobActive
+		}
+		q.jobs = append(q.jobs, job)
+		q.pruneLocked()
+		job = copyJob(job)
+		q.mu.Unlock()
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get returns a job with its params and result
+func (q *Queue) Get(ctx context.Context, id string) (*models.Job, error) {
+	if q.repo != nil {
+		job, err := q.repo.GetJob(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		return job, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job := q.findLocked(id); job != nil {
+		return copyJob(job), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+}
+
+// List returns the newest jobs, optionally filtered by type and status
+func (q *Queue) List(ctx context.Context, jobType, status string, limit int) ([]*models.Job, error) {
+	if q.repo != nil {
+		return q.repo.ListJobs(ctx, jobType, status, limit)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := []*models.Job{}
+	for i := len(q.jobs) - 1; i >= 0 && len(jobs) < limit; i-- {
+		job := q.jobs[i]
+		if (jobType == "" || job.Type == jobType) && (status == "" || job.Status == status) {
+			jobs = append(jobs, copyJob(job))
+		}
+	}
+	return jobs, nil
+}
+
+// Cancel cancels a pending job, or asks a running one to stop. A running job
+// on another instance stops at its next heartbeat.
+func (q *Queue) Cancel(ctx context.Context, id string) (*models.Job, error) {
+	var job *models.Job
+	if q.repo != nil {
+		var err error
+		job, err = q.repo.CancelJob(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, getErr := q.Get(ctx, id); getErr != nil {
+				return nil, getErr
+			}
+			return nil, ErrJobFinished
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		q.mu.Lock()
+		stored := q.findLocked(id)
+		switch {
+		case stored == nil:
+			q.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		case stored.Finished():
+			q.mu.Unlock()
+			return nil, ErrJobFinished
+		}
+		stored.CancelRequested = true
+		if stored.Status == models.JobPending {
+			now := time.Now()
+			stored.Status = models.JobCancelled
+			stored.CompletedAt = &now
+		}
+		job = copyJob(stored)
+		q.mu.Unlock()
+	}
+
+	q.mu.Lock()
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+	}
+	q.mu.Unlock()
+	return job, nil
+}
+
+// Start runs the workers and the cleanup of stale and old jobs until ctx is
+// cancelled
+func (q *Queue) Start(ctx context.Context) {
+	workers := q.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go q.work(ctx)
+	}
+	if q.repo != nil {
+		go q.cleanup(ctx)
+	}
+}
+
+// work runs queued jobs one after another
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.pollInterval())
+	defer ticker.Stop()
+	for {
+		for {
+			job, err := q.claim(ctx)
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to claim job")
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.execute(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim marks the oldest pending job of a registered type as running
+func (q *Queue) claim(ctx context.Context) (*models.Job, error) {
+	q.mu.Lock()
+	if q.repo != nil {
+		types := make([]string, 0, len(q.types))
+		for name := range q.types {
+			types = append(types, name)
+		}
+		q.mu.Unlock()
+		return q.repo.ClaimJob(ctx, types)
+	}
+	defer q.mu.Unlock()
+
+	for _, job := range q.jobs {
+		if job.Status == models.JobPending {
+			now := time.Now()
+			job.Status = models.JobRunning
+			job.StartedAt = &now
+			job.UpdatedAt = now
+			return copyJob(job), nil
+		}
+	}
+	return nil, nil
+}
+
+// execute runs a claimed job, reporting its progress as a heartbeat, and
+// records the outcome
+func (q *Queue) execute(ctx context.Context, job *models.Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q.mu.Lock()
+	t := q.types[job.Type]
+	q.cancels[job.ID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.cancels, job.ID)
+		q.mu.Unlock()
+	}()
+
+	var progressMu sync.Mutex
+	done, total := 0, 0
+	progress := func(d, n int) {
+		progressMu.Lock()
+		done, total = d, n
+		progressMu.Unlock()
+	}
+	heartbeat := func() {
+		progressMu.Lock()
+		d, n := done, total
+		progressMu.Unlock()
+		if cancelRequested := q.heartbeat(ctx, job.ID, d, n); cancelRequested {
+			cancel()
+		}
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(q.pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				heartbeat()
+			}
+		}
+	}()
+
+	log.Info().Str("job_id", job.ID).Str("type", job.Type).Msg("Job started")
+	result, err := q.run(jobCtx, t, job, progress)
+	close(stop)
+
+	now := time.Now()
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	job.Progress, job.Total = done, total
+	switch {
+	case err != nil && jobCtx.Err() != nil && ctx.Err() == nil:
+		job.Status = models.JobCancelled
+	case err != nil:
+		job.Status = models.JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = models.JobCompleted
+		if job.Result, err = json.Marshal(result); err != nil {
+			job.Status = models.JobFailed
+			job.Error = fmt.Sprintf("encode job result: %v", err)
+		}
+	}
+	q.finish(job)
+
+	logEvent := log.Info()
+	if job.Status == models.JobFailed {
+		logEvent = log.Warn().Str("error", job.Error)
+	}
+	logEvent.Str("job_id", job.ID).Str("type", job.Type).Str("status", job.Status).Msg("Job finished")
+}
+
+// run calls the runner, turning a panic into a failed job
+func (q *Queue) run(ctx context.Context, t Type, job *models.Job, progress Progress) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return t.Run(ctx, job, progress)
+}
+
+// heartbeat stores a running job's progress and reports whether it has been
+// asked to cancel
+func (q *Queue) heartbeat(ctx context.Context, id string, done, total int) bool {
+	if q.repo != nil {
+		cancelRequested, err := q.repo.UpdateJobProgress(ctx, id, done, total)
+		if err != nil {
+			log.Warn().Err(err).Str("job_id", id).Msg("Failed to record job progress")
+		}
+		return cancelRequested
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.findLocked(id)
+	if job == nil {
+		return true
+	}
+	job.Progress, job.Total = done, total
+	job.UpdatedAt = time.Now()
+	return job.CancelRequested
+}
+
+// finish records a job's outcome
+func (q *Queue) finish(job *models.Job) {
+	if q.repo != nil {
+		// The job's own context may be cancelled; the outcome must still be saved
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := q.repo.FinishJob(ctx, job); err != nil {
+			log.Error().Err(err).Str("job_id", job.ID).Msg("Failed to record job outcome")
+		}
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if stored := q.findLocked(job.ID); stored != nil {
+		cancelRequested := stored.CancelRequested
+		*stored = *copyJob(job)
+		stored.CancelRequested = cancelRequested
+	}
+}
+
+// cleanup fails running jobs whose instance stopped and deletes old finished
+// jobs
+func (q *Queue) cleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Running jobs report at every poll interval; allow for a few misses
+		stale := max(10*q.pollInterval(), time.Minute)
+		if n, err := q.repo.FailStaleJobs(ctx, time.Now().Add(-stale)); err != nil {
+			log.Warn().Err(err).Msg("Failed to fail stale jobs")
+		} else if n > 0 {
+			log.Warn().Int64("jobs", n).Msg("Failed jobs whose worker stopped responding")
+		}
+		if q.cfg.Retention > 0 {
+			if _, err := q.repo.DeleteFinishedJobs(ctx, time.Now().Add(-q.cfg.Retention)); err != nil {
+				log.Warn().Err(err).Msg("Failed to delete old jobs")
+			}
+		}
+	}
+}
+
+func (q *Queue) pollInterval() time.Duration {
+	if q.cfg.PollInterval > 0 {
+		return q.cfg.PollInterval
+	}
+	return 2 * time.Second
+}
+
+func (q *Queue) findLocked(id string) *models.Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// pruneLocked drops the oldest finished jobs beyond maxMemoryJobs
+func (q *Queue) pruneLocked() {
+	excess := len(q.jobs) - maxMemoryJobs
+	if excess <= 0 {
+		return
+	}
+	q.jobs = slices.DeleteFunc(q.jobs, func(j *models.Job) bool {
+		if excess > 0 && j.Finished() {
+			excess--
+			return true
+		}
+		return false
+	})
+}
+
+func copyJob(job *models.Job) *models.Job {
+	copied := *job
+	return &copied
+}
@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// anthropicVersion is the version of the Messages API requests are made for
+const anthropicVersion = "2023-06-01"
+
+// anthropicMaxTokens is sent when no max_tokens is configured, since the
+// Messages API requires one
+const anthropicMaxTokens = 4096
+
+type anthropicBlock struct {
+	Type         string      `json:"type"`
+	Text         string      `json:"text"`
+	CacheControl interface{} `json:"cache_control,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      []anthropicBlock   `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature *float64           `json:"temperature,omitempty"`
+}
+
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
+}
+
+// chatAnthropic sends text messages to Anthropic's Messages API, which takes
+// options its OpenAI-compatible API ignores, prompt caching in particular.
+// With cache_control, the system prompt and the conversation up to the last
+// message are marked as cacheable prefixes.
+func (c *Client) chatAnthropic(ctx context.Context, messages []models.Message, options map[string]interface{}) (*models.LLMResponse, error) {
+	baseURL := BaseURL(c.config)
+	if baseURL == "" {
+		baseURL = compatibleBaseURLs["anthropic"]
+	}
+
+	req := anthropicRequest{Model: c.config.Model, MaxTokens: c.maxTokens(ctx)}
+	if req.MaxTokens <= 0 {
+		req.MaxTokens = anthropicMaxTokens
+	}
+	if c.config.Temperature > 0 {
+		req.Temperature = &c.config.Temperature
+	}
+	for _, m := range messages {
+		block := anthropicBlock{Type: "text", Text: m.Content}
+		if m.Role == "system" {
+			req.System = append(req.System, block)
+			continue
+		}
+		// Consecutive messages of a role are merged, as the API requires
+		// user and assistant turns to alternate
+		if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == m.Role {
+			req.Messages[n-1].Content = append(req.Messages[n-1].Content, block)
+			continue
+		}
+		req.Messages = append(req.Messages, anthropicMessage{Role: m.Role, Content: []anthropicBlock{block}})
+	}
+
+	rest := make(map[string]interface{}, len(options))
+	for name, value := range options {
+		if name != "cache_control" {
+			rest[name] = value
+			continue
+		}
+		if n := len(req.System); n > 0 {
+			req.System[n-1].CacheControl = value
+		}
+		if n := len(req.Messages); n > 0 {
+			last := req.Messages[n-1].Content
+			last[len(last)-1].CacheControl = value
+		}
+	}
+	body, err := withOptions(req, rest)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("x-api-key", c.config.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChatResponse))
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LLM request failed: %w", &StatusError{StatusCode: resp.StatusCode, Message: providerError(data)})
+	}
+
+	var result anthropicResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("LLM request failed: unreadable response: %w", err)
+	}
+
+	llmResp := &models.LLMResponse{Model: result.Model, FinishReason: anthropicFinishReason(result.StopReason)}
+	if llmResp.Model == "" {
+		llmResp.Model = c.config.Model
+	}
+	var text []string
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text = append(text, block.Text)
+		}
+	}
+	llmResp.Content = strings.Join(text, "")
+
+	u := result.Usage
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	llmResp.Usage = &models.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+	}
+	return llmResp, nil
+}
+
+// anthropicFinishReason maps a stop reason to its OpenAI name
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	}
+	return reason
+}
@@ -0,0 +1,376 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/agentplexus/omnillm"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Circuit states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is matched by the errors of calls refused because the
+// provider's circuit is open
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is returned instead of calling a provider whose circuit
+// is open
+type CircuitOpenError struct {
+	Provider string
+	RetryAt  time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("LLM provider %s is unavailable after repeated failures; retrying it after %s",
+		e.Provider, e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// StatusError is an error response from a provider's HTTP API
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+// circuits holds a breaker per provider, shared by all clients since most
+// are created per request
+var circuits = &circuitSet{
+	cfg:      config.DefaultConfig().LLM.CircuitBreaker,
+	breakers: make(map[string]*breaker),
+}
+
+// ConfigureCircuitBreakers replaces the circuit breaker settings, resetting
+// every circuit
+func ConfigureCircuitBreakers(cfg config.CircuitBreakerConfig) {
+	circuits.mu.Lock()
+	defer circuits.mu.Unlock()
+	circuits.cfg = cfg
+	circuits.breakers = make(map[string]*breaker)
+}
+
+// ProviderHealth returns the circuit state of every provider called since
+// the breakers were configured, by provider
+func ProviderHealth() map[string]*models.ProviderHealth {
+	circuits.mu.Lock()
+	breakers := make([]*breaker, 0, len(circuits.breakers))
+	for _, b := range circuits.breakers {
+		breakers = append(breakers, b)
+	}
+	circuits.mu.Unlock()
+
+	health := make(map[string]*models.ProviderHealth, len(breakers))
+	for _, b := range breakers {
+		health[b.name] = b.health(time.Now())
+	}
+	return health
+}
+
+type circuitSet struct {
+	mu       sync.Mutex
+	cfg      config.CircuitBreakerConfig
+	breakers map[string]*breaker
+}
+
+// get returns the breaker of cfg's provider, or nil when breakers are
+// disabled. Providers behind a custom base URL get a breaker per host.
+func (s *circuitSet) get(cfg config.LLMConfig) *breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.cfg.Enabled {
+		return nil
+	}
+	name := circuitName(cfg)
+	b, ok := s.breakers[name]
+	if !ok {
+		b = newBreaker(name, s.cfg)
+		s.breakers[name] = b
+	}
+	return b
+}
+
+// circuitName names the circuit of cfg's provider
+func circuitName(cfg config.LLMConfig) string {
+	if cfg.BaseURL == "" {
+		return cfg.Provider
+	}
+	if u, err := url.Parse(cfg.BaseURL); err == nil && u.Host != "" {
+		return cfg.Provider + "@" + u.Host
+	}
+	return cfg.Provider + "@" + cfg.BaseURL
+}
+
+// outcome is the result of one call in a breaker's window
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+// breaker tracks the recent calls to one provider
+type breaker struct {
+	name string
+	cfg  config.CircuitBreakerConfig
+
+	mu        sync.Mutex
+	state     string
+	window    []outcome // ring of the last cfg.Window calls
+	next      int
+	openedAt  time.Time
+	probing   int // half-open calls in flight
+	succeeded int // half-open calls that succeeded
+	lastError string
+}
+
+func newBreaker(name string, cfg config.CircuitBreakerConfig) *breaker {
+	if cfg.Window <= 0 {
+		cfg.Window = 20
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &breaker{
+		name:   name,
+		cfg:    cfg,
+		state:  CircuitClosed,
+		window: make([]outcome, 0, cfg.Window),
+	}
+}
+
+// allow reports whether a call may be made now. A half-open circuit lets
+// through a limited number of probe calls; probe tells the caller its call
+// is one of them. A nil breaker allows everything.
+func (b *breaker) allow(now time.Time) (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && !now.Before(b.retryAt()) {
+		b.transition(CircuitHalfOpen, now)
+	}
+	switch b.state {
+	case CircuitOpen:
+		return false, &CircuitOpenError{Provider: b.name, RetryAt: b.retryAt()}
+	case CircuitHalfOpen:
+		if b.probing >= b.cfg.HalfOpenProbes-b.succeeded {
+			return false, &CircuitOpenError{Provider: b.name, RetryAt: now.Add(time.Second)}
+		}
+		b.probing++
+		return true, nil
+	}
+	return false, nil
+}
+
+// available reports whether a call would be allowed, without taking a probe
+// slot
+func (b *breaker) available(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		return !now.Before(b.retryAt())
+	case CircuitHalfOpen:
+		return b.probing < b.cfg.HalfOpenProbes-b.succeeded
+	}
+	return true
+}
+
+// record counts the result of a call allowed by allow; status is the HTTP
+// status of the provider's response, if known. Calls the caller cancelled say
+// nothing about the provider and aren't counted.
+func (b *breaker) record(probe bool, err error, status int, elapsed time.Duration) {
+	if b == nil {
+		return
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing--
+	}
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	o := outcome{
+		failed: isProviderFailure(err, status),
+		slow:   b.cfg.SlowCallDuration > 0 && elapsed >= b.cfg.SlowCallDuration,
+	}
+	if o.failed {
+		b.lastError = err.Error()
+	}
+
+	switch b.state {
+	case CircuitHalfOpen:
+		if !probe {
+			return
+		}
+		if o.failed || o.slow {
+			b.transition(CircuitOpen, now)
+			return
+		}
+		if b.succeeded++; b.succeeded >= b.cfg.HalfOpenProbes {
+			b.transition(CircuitClosed, now)
+		}
+	case CircuitClosed:
+		if len(b.window) < b.cfg.Window {
+			b.window = append(b.window, o)
+		} else {
+			b.window[b.next] = o
+		}
+		b.next = (b.next + 1) % b.cfg.Window
+
+		if len(b.window) < b.cfg.MinRequests {
+			return
+		}
+		failureRate, slowRate := b.rates()
+		if (b.cfg.ErrorRate > 0 && failureRate >= b.cfg.ErrorRate) ||
+			(b.cfg.SlowCallRate > 0 && slowRate >= b.cfg.SlowCallRate) {
+			b.transition(CircuitOpen, now)
+		}
+	}
+	// Calls that were in flight when the circuit opened are ignored
+}
+
+// transition changes the state, starting a fresh window or probe count. The
+// caller must hold b.mu.
+func (b *breaker) transition(state string, now time.Time) {
+	from := b.state
+	b.state = state
+	b.succeeded = 0
+	switch state {
+	case CircuitOpen:
+		b.openedAt = now
+		failureRate, slowRate := b.rates()
+		log.Warn().
+			Str("provider", b.name).
+			Str("from", from).
+			Float64("failure_rate", failureRate).
+			Float64("slow_rate", slowRate).
+			Str("last_error", b.lastError).
+			Time("retry_at", b.retryAt()).
+			Msg("LLM provider circuit opened")
+	case CircuitHalfOpen:
+		log.Info().Str("provider", b.name).Msg("LLM provider circuit half-open - probing")
+	case CircuitClosed:
+		b.window, b.next, b.lastError = b.window[:0], 0, ""
+		log.Info().Str("provider", b.name).Msg("LLM provider circuit closed")
+	}
+}
+
+// rates returns the shares of failed and slow calls in the window. The
+// caller must hold b.mu.
+func (b *breaker) rates() (failureRate, slowRate float64) {
+	if len(b.window) == 0 {
+		return 0, 0
+	}
+	var failed, slow int
+	for _, o := range b.window {
+		if o.failed {
+			failed++
+		}
+		if o.slow {
+			slow++
+		}
+	}
+	n := float64(len(b.window))
+	return float64(failed) / n, float64(slow) / n
+}
+
+// retryAt is when an open circuit starts probing. The caller must hold b.mu.
+func (b *breaker) retryAt() time.Time {
+	return b.openedAt.Add(b.cfg.OpenDuration)
+}
+
+func (b *breaker) health(now time.Time) *models.ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failureRate, slowRate := b.rates()
+	h := &models.ProviderHealth{
+		State:       b.state,
+		Requests:    len(b.window),
+		FailureRate: failureRate,
+		SlowRate:    slowRate,
+		LastError:   b.lastError,
+	}
+	if b.state != CircuitClosed {
+		openedAt, retryAt := b.openedAt, b.retryAt()
+		h.OpenedAt, h.RetryAt = &openedAt, &retryAt
+		if b.state == CircuitOpen && !now.Before(retryAt) {
+			h.State = CircuitHalfOpen
+		}
+	}
+	return h
+}
+
+// isProviderFailure reports whether err says the provider is unwell. Requests
+// the provider rejected as invalid or unauthorized are the caller's problem,
+// except for timeouts and rate limiting.
+func isProviderFailure(err error, status int) bool {
+	if err == nil || errors.Is(err, ErrUnsupportedInput) {
+		return false
+	}
+	var apiErr *omnillm.APIError
+	var statusErr *StatusError
+	if errors.As(err, &apiErr) {
+		status = apiErr.StatusCode
+	} else if errors.As(err, &statusErr) {
+		status = statusErr.StatusCode
+	}
+	if status >= 400 && status < 500 {
+		return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// statusKey holds where statusTransport records the status of a call
+type statusKey struct{}
+
+// withStatusRecorder returns a context under which the status of the last
+// provider response is recorded in *status
+func withStatusRecorder(ctx context.Context) (context.Context, *int) {
+	status := new(int)
+	return context.WithValue(ctx, statusKey{}, status), status
+}
+
+// statusTransport records response statuses for withStatusRecorder
+type statusTransport struct {
+	base http.RoundTripper
+}
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if status, ok := req.Context().Value(statusKey{}).(*int); ok && resp != nil {
+		*status = resp.StatusCode
+	}
+	return resp, err
+}
@@ -0,0 +1,177 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Sources of model capabilities
+const (
+	CapabilitiesConfig  = "config"
+	CapabilitiesBuiltin = "builtin"
+)
+
+// builtinCapabilities are the published limits of common models. Models
+// that aren't listed, and don't start with a listed name and a dash, aren't
+// checked.
+var builtinCapabilities = map[string]config.ModelCapabilitiesConfig{
+	// OpenAI models
+	"gpt-4o":        {ContextWindow: 128000, MaxOutputTokens: 16384, Vision: true, Tools: true, Streaming: true},
+	"gpt-4o-mini":   {ContextWindow: 128000, MaxOutputTokens: 16384, Vision: true, Tools: true, Streaming: true},
+	"gpt-4.1":       {ContextWindow: 1047576, MaxOutputTokens: 32768, Vision: true, Tools: true, Streaming: true},
+	"gpt-4.1-mini":  {ContextWindow: 1047576, MaxOutputTokens: 32768, Vision: true, Tools: true, Streaming: true},
+	"gpt-4.1-nano":  {ContextWindow: 1047576, MaxOutputTokens: 32768, Vision: true, Tools: true, Streaming: true},
+	"gpt-4-turbo":   {ContextWindow: 128000, MaxOutputTokens: 4096, Vision: true, Tools: true, Streaming: true},
+	"gpt-4":         {ContextWindow: 8192, MaxOutputTokens: 8192, Tools: true, Streaming: true},
+	"gpt-3.5-turbo": {ContextWindow: 16385, MaxOutputTokens: 4096, Tools: true, Streaming: true},
+	"o1":            {ContextWindow: 200000, MaxOutputTokens: 100000, Vision: true, Tools: true, Streaming: true},
+	"o3-mini":       {ContextWindow: 200000, MaxOutputTokens: 100000, Tools: true, Streaming: true},
+
+	// Anthropic models
+	"claude-3-5-sonnet": {ContextWindow: 200000, MaxOutputTokens: 8192, Vision: true, Tools: true, Streaming: true},
+	"claude-3-5-haiku":  {ContextWindow: 200000, MaxOutputTokens: 8192, Tools: true, Streaming: true},
+	"claude-3-opus":     {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, Streaming: true},
+	"claude-3-sonnet":   {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, Streaming: true},
+	"claude-3-haiku":    {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, Streaming: true},
+
+	// Google models
+	"gemini-1.5-pro":   {ContextWindow: 2097152, MaxOutputTokens: 8192, Vision: true, Tools: true, Streaming: true},
+	"gemini-1.5-flash": {ContextWindow: 1048576, MaxOutputTokens: 8192, Vision: true, Tools: true, Streaming: true},
+	"gemini-pro":       {ContextWindow: 32760, MaxOutputTokens: 8192, Tools: true, Streaming: true},
+
+	// AWS Bedrock Claude models
+	"anthropic.claude-3-5-sonnet": {ContextWindow: 200000, MaxOutputTokens: 8192, Vision: true, Tools: true, Streaming: true},
+	"anthropic.claude-3-sonnet":   {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, Streaming: true},
+	"anthropic.claude-3-haiku":    {ContextWindow: 200000, MaxOutputTokens: 4096, Vision: true, Tools: true, Streaming: true},
+
+	// X.AI models
+	"grok-beta": {ContextWindow: 131072, Tools: true, Streaming: true},
+}
+
+// Registry resolves the capabilities of models from the configured entries
+// and the built-in ones
+type Registry struct {
+	entries map[string]models.ModelCapabilities
+	clamp   bool
+}
+
+// NewRegistry creates a registry of the built-in capabilities overlaid with
+// those of cfg.Models
+func NewRegistry(cfg config.LLMConfig) *Registry {
+	r := &Registry{entries: make(map[string]models.ModelCapabilities), clamp: cfg.ClampMaxTokens}
+	for name, caps := range builtinCapabilities {
+		r.entries[name] = capabilities(name, caps, CapabilitiesBuiltin)
+	}
+	for name, caps := range cfg.Models {
+		r.entries[name] = capabilities(name, caps, CapabilitiesConfig)
+	}
+	return r
+}
+
+func capabilities(name string, caps config.ModelCapabilitiesConfig, source string) models.ModelCapabilities {
+	return models.ModelCapabilities{
+		Model:           name,
+		ContextWindow:   caps.ContextWindow,
+		MaxOutputTokens: caps.MaxOutputTokens,
+		Vision:          caps.Vision,
+		Tools:           caps.Tools,
+		Streaming:       caps.Streaming,
+		Source:          source,
+	}
+}
+
+// Clamp reports whether max_tokens is lowered to fit a model rather than
+// rejected
+func (r *Registry) Clamp() bool {
+	return r.clamp
+}
+
+// Lookup returns the capabilities of model: those of its own entry, else
+// of the longest entry it starts with followed by a dash, such as gpt-4o
+// for gpt-4o-2024-08-06. A bare prefix isn't enough, so gpt-4.5 doesn't
+// take the limits of gpt-4.
+func (r *Registry) Lookup(model string) (models.ModelCapabilities, bool) {
+	if caps, ok := r.entries[model]; ok {
+		return caps, true
+	}
+	var found models.ModelCapabilities
+	best := 0
+	for name, caps := range r.entries {
+		if len(name) > best && strings.HasPrefix(model, name+"-") {
+			found, best = caps, len(name)
+		}
+	}
+	return found, best > 0
+}
+
+// List returns every entry, sorted by model name
+func (r *Registry) List() []models.ModelCapabilities {
+	list := make([]models.ModelCapabilities, 0, len(r.entries))
+	for _, caps := range r.entries {
+		list = append(list, caps)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Model < list[j].Model })
+	return list
+}
+
+const (
+	// charsPerToken is about what tokenizers average over English text;
+	// code and most other languages take more tokens, so estimates err low
+	charsPerToken = 4
+	// messageTokens is what a message costs beyond its content
+	messageTokens = 4
+	// imageTokens is the least an image costs, at low detail
+	imageTokens = 85
+)
+
+// EstimateTokens estimates the prompt tokens of messages and tools without
+// the model's tokenizer. It errs low, so requests it puts over a context
+// window are over it.
+func EstimateTokens(messages []models.Message, tools []models.Tool) int {
+	chars, tokens := 0, 0
+	for _, msg := range messages {
+		tokens += messageTokens
+		chars += utf8.RuneCountInString(msg.Content) + utf8.RuneCountInString(msg.Name)
+		for _, part := range msg.Parts {
+			if part.Type == models.PartImage {
+				tokens += imageTokens
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			chars += utf8.RuneCountInString(call.Function.Name) + utf8.RuneCountInString(call.Function.Arguments)
+		}
+	}
+	if len(tools) > 0 {
+		if data, err := json.Marshal(tools); err == nil {
+			chars += utf8.RuneCount(data)
+		}
+	}
+	return tokens + chars/charsPerToken
+}
+
+type maxTokensKey struct{}
+
+// WithMaxTokens overrides the configured max_tokens of the LLM calls made
+// with ctx
+func WithMaxTokens(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxTokensKey{}, n)
+}
+
+// maxTokens returns the max_tokens of a call made with ctx
+func (c *Client) maxTokens(ctx context.Context) int {
+	if n, ok := ctx.Value(maxTokensKey{}).(int); ok && n > 0 {
+		return n
+	}
+	return c.config.MaxTokens
+}
+
+// MaxTokens returns the max_tokens the client sends, 0 when it sends none
+func (c *Client) MaxTokens() int {
+	return c.config.MaxTokens
+}
@@ -0,0 +1,175 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Request headers that inject upstream faults when fault injection is enabled
+const (
+	HeaderChaosLatency   = "X-GoGuard-Chaos-Latency"   // delay before the upstream call, e.g. 2s
+	HeaderChaosError     = "X-GoGuard-Chaos-Error"     // HTTP status to fail with, or "reset" to drop the connection
+	HeaderChaosMalformed = "X-GoGuard-Chaos-Malformed" // "true" to answer with a truncated JSON body
+	HeaderChaosRate      = "X-GoGuard-Chaos-Rate"      // probability the error or malformed response applies, 0-1
+)
+
+// faultInjection is set once at startup; clients created afterwards route
+// provider calls through faultTransport
+var faultInjection atomic.Bool
+
+// EnableFaultInjection makes clients honour faults attached with WithFault.
+// It is meant for debug builds and integration tests only.
+func EnableFaultInjection() {
+	faultInjection.Store(true)
+}
+
+// Fault is a simulated upstream failure for one request
+type Fault struct {
+	Latency   time.Duration
+	Status    int  // respond with this status instead of calling the provider
+	Reset     bool // fail as if the connection was dropped
+	Malformed bool // respond 200 with a body providers can't parse
+	Rate      float64
+}
+
+type faultKey struct{}
+
+// WithFault attaches a fault to the context of an LLM call
+func WithFault(ctx context.Context, f *Fault) context.Context {
+	return context.WithValue(ctx, faultKey{}, f)
+}
+
+// ParseFault reads a fault from request headers. It returns nil when no
+// chaos headers are set.
+func ParseFault(h http.Header) (*Fault, error) {
+	f := &Fault{Rate: 1}
+	set := false
+
+	if v := h.Get(HeaderChaosLatency); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid %s: %q", HeaderChaosLatency, v)
+		}
+		f.Latency = d
+		set = true
+	}
+	if v := h.Get(HeaderChaosError); v != "" {
+		if strings.EqualFold(v, "reset") {
+			f.Reset = true
+		} else {
+			status, err := strconv.Atoi(v)
+			if err != nil || status < 400 || status > 599 {
+				return nil, fmt.Errorf("invalid %s: %q (use a 4xx/5xx status or \"reset\")", HeaderChaosError, v)
+			}
+			f.Status = status
+		}
+		set = true
+	}
+	if v := h.Get(HeaderChaosMalformed); v != "" {
+		malformed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %q", HeaderChaosMalformed, v)
+		}
+		f.Malformed = malformed
+		set = set || malformed
+	}
+	if v := h.Get(HeaderChaosRate); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid %s: %q (use 0-1)", HeaderChaosRate, v)
+		}
+		f.Rate = rate
+	}
+
+	if !set {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// String describes the fault for logs
+func (f *Fault) String() string {
+	var parts []string
+	if f.Latency > 0 {
+		parts = append(parts, "latency="+f.Latency.String())
+	}
+	switch {
+	case f.Reset:
+		parts = append(parts, "error=reset")
+	case f.Status != 0:
+		parts = append(parts, "error="+strconv.Itoa(f.Status))
+	}
+	if f.Malformed {
+		parts = append(parts, "malformed")
+	}
+	if f.Rate < 1 {
+		parts = append(parts, "rate="+strconv.FormatFloat(f.Rate, 'g', -1, 64))
+	}
+	return strings.Join(parts, " ")
+}
+
+// faultTransport applies the fault in a request's context before, or instead
+// of, sending it to the provider
+type faultTransport struct {
+	base http.RoundTripper
+}
+
+func (t faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f, _ := req.Context().Value(faultKey{}).(*Fault)
+	if f == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	if f.Rate < 1 && rand.Float64() >= f.Rate {
+		return t.base.RoundTrip(req)
+	}
+	switch {
+	case f.Reset:
+		return nil, errors.New("simulated upstream failure: connection reset by peer")
+	case f.Status != 0:
+		resp := syntheticResponse(req, f.Status, fmt.Sprintf(
+			`{"error":{"message":"simulated upstream failure","type":"goguard_chaos","code":%d}}`, f.Status))
+		if f.Status == http.StatusTooManyRequests || f.Status == http.StatusServiceUnavailable {
+			resp.Header.Set("Retry-After", "1")
+		}
+		return resp, nil
+	case f.Malformed:
+		return syntheticResponse(req, http.StatusOK, `{"id":"chaos","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"trunc`), nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+func syntheticResponse(req *http.Request, status int, body string) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
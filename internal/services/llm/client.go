@@ -2,12 +2,17 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/agentplexus/omnillm"
 	"github.com/epps11/goguard/internal/config"
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/requestid"
+	"github.com/rs/zerolog/log"
 )
 
 // Ensure context is used (for settings provider)
@@ -16,6 +21,7 @@ var _ = context.Background
 // Client wraps the OmniLLM client for LLM interactions
 type Client struct {
 	client      *omnillm.ChatClient
+	httpClient  *http.Client
 	config      config.LLMConfig
 	initialized bool
 }
@@ -35,6 +41,14 @@ func NewClient(cfg config.LLMConfig) (*Client, error) {
 	if cfg.BaseURL != "" {
 		clientConfig.BaseURL = cfg.BaseURL
 	}
+	// OmniLLM keeps only the message of provider errors, so the status is
+	// recorded on the way for the circuit breaker
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = statusTransport{base: httpClient.Transport}
+	clientConfig.HTTPClient = httpClient
 
 	client, err := omnillm.NewClient(clientConfig)
 	if err != nil {
@@ -43,6 +57,7 @@ func NewClient(cfg config.LLMConfig) (*Client, error) {
 
 	return &Client{
 		client:      client,
+		httpClient:  httpClient,
 		config:      cfg,
 		initialized: true,
 	}, nil
@@ -50,9 +65,54 @@ func NewClient(cfg config.LLMConfig) (*Client, error) {
 
 // Chat sends a chat completion request
 func (c *Client) Chat(ctx context.Context, messages []models.Message) (*models.LLMResponse, error) {
+	return c.ChatWithTools(ctx, messages, nil, nil)
+}
+
+// ChatWithTools sends a chat completion request offering the model tools to
+// call. toolChoice is passed to the provider as-is. Calls fail fast while the
+// provider's circuit is open, and are cancelled when ctx is or their timeout
+// runs out.
+func (c *Client) ChatWithTools(ctx context.Context, messages []models.Message, tools []models.Tool, toolChoice json.RawMessage) (*models.LLMResponse, error) {
 	if !c.initialized {
 		return nil, errors.New("LLM client not initialized")
 	}
+	circuit := circuits.get(c.config)
+	probe, err := circuit.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	callCtx, cancel, timeout := callContext(ctx, c.config)
+	defer cancel()
+	callCtx, status := withStatusRecorder(callCtx)
+	start := time.Now()
+	resp, err := c.chat(callCtx, messages, tools, toolChoice)
+	err = callError(ctx, callCtx, timeout, err)
+	circuit.record(probe, err, *status, time.Since(start))
+	logCall(ctx, c.config, "chat", start, err)
+	return resp, err
+}
+
+// logCall logs a provider call at debug level, with the ID of the request
+// it was made for
+func logCall(ctx context.Context, cfg config.LLMConfig, call string, start time.Time, err error) {
+	requestid.Logger(ctx).Debug().Err(err).
+		Str("call", call).
+		Str("provider", circuitName(cfg)).
+		Str("model", cfg.Model).
+		Dur("latency", time.Since(start)).
+		Msg("LLM call finished")
+}
+
+// chat makes the call for ChatWithTools
+func (c *Client) chat(ctx context.Context, messages []models.Message, tools []models.Tool, toolChoice json.RawMessage) (*models.LLMResponse, error) {
+	// OmniLLM has no room for provider options either
+	options := providerOptions(ctx, c.config.Provider)
+	if len(options) > 0 && providerFamily(c.config.Provider) == "anthropic" {
+		return c.chatAnthropic(ctx, messages, options)
+	}
+	if len(options) > 0 || len(tools) > 0 || models.HasTools(messages) || models.AnyImages(messages) {
+		return c.chatCompatible(ctx, messages, tools, toolChoice, options)
+	}
 
 	// Convert messages to OmniLLM format
 	omnillmMessages := make([]omnillm.Message, len(messages))
@@ -69,8 +129,8 @@ func (c *Client) Chat(ctx context.Context, messages []models.Message) (*models.L
 		Messages: omnillmMessages,
 	}
 
-	if c.config.MaxTokens > 0 {
-		req.MaxTokens = &c.config.MaxTokens
+	if maxTokens := c.maxTokens(ctx); maxTokens > 0 {
+		req.MaxTokens = &maxTokens
 	}
 
 	if c.config.Temperature > 0 {
@@ -111,6 +171,9 @@ func (c *Client) ChatStream(ctx context.Context, messages []models.Message, hand
 	if !c.initialized {
 		return nil, errors.New("LLM client not initialized")
 	}
+	if models.AnyImages(messages) || models.HasTools(messages) {
+		return nil, errors.New("image input and tool calls can't be streamed")
+	}
 
 	// Convert messages to OmniLLM format
 	omnillmMessages := make([]omnillm.Message, len(messages))
@@ -127,16 +190,30 @@ func (c *Client) ChatStream(ctx context.Context, messages []models.Message, hand
 		Messages: omnillmMessages,
 	}
 
-	if c.config.MaxTokens > 0 {
-		req.MaxTokens = &c.config.MaxTokens
+	if maxTokens := c.maxTokens(ctx); maxTokens > 0 {
+		req.MaxTokens = &maxTokens
 	}
 
 	if c.config.Temperature > 0 {
 		req.Temperature = &c.config.Temperature
 	}
 
-	// Create stream
-	stream, err := c.client.CreateChatCompletionStream(ctx, req)
+	// Create stream. Streams take as long as the answer, so only whether
+	// they could be opened counts towards the provider's circuit.
+	circuit := circuits.get(c.config)
+	probe, err := circuit.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// The timeout covers the whole stream
+	callCtx, cancel, timeout := callContext(ctx, c.config)
+	defer cancel()
+	callCtx, status := withStatusRecorder(callCtx)
+	start := time.Now()
+	stream, err := c.client.CreateChatCompletionStream(callCtx, req)
+	err = callError(ctx, callCtx, timeout, err)
+	circuit.record(probe, err, *status, 0)
+	logCall(ctx, c.config, "stream", start, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create stream: %w", err)
 	}
@@ -173,6 +250,41 @@ func (c *Client) ChatStream(ctx context.Context, messages []models.Message, hand
 	}, nil
 }
 
+// Ping verifies the client's credentials and model with a minimal completion request
+func (c *Client) Ping(ctx context.Context) error {
+	if !c.initialized {
+		return errors.New("LLM client not initialized")
+	}
+
+	maxTokens := 1
+	req := &omnillm.ChatCompletionRequest{
+		Model: c.config.Model,
+		Messages: []omnillm.Message{
+			{Role: omnillm.RoleUser, Content: "ping"},
+		},
+		MaxTokens: &maxTokens,
+	}
+
+	if _, err := c.client.CreateChatCompletion(ctx, req); err != nil {
+		return fmt.Errorf("LLM validation request failed: %w", err)
+	}
+	return nil
+}
+
+// ValidateConfig creates a temporary client for cfg and pings the provider
+func ValidateConfig(ctx context.Context, cfg config.LLMConfig) error {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	return client.Ping(ctx)
+}
+
 // Close closes the LLM client
 func (c *Client) Close() error {
 	if c.client != nil {
@@ -181,6 +293,11 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Target returns the provider and model this client sends requests to
+func (c *Client) Target() (provider, model string) {
+	return c.config.Provider, c.config.Model
+}
+
 // IsInitialized returns whether the client is ready
 func (c *Client) IsInitialized() bool {
 	return c.initialized
@@ -211,6 +328,14 @@ func mapProviderName(provider string) (omnillm.ProviderName, error) {
 // SettingsProvider interface for fetching dynamic LLM settings
 type SettingsProvider interface {
 	GetLLMConfig(ctx context.Context) (provider, model, apiKey, baseURL string, err error)
+	GetLLMProfile(ctx context.Context, name string) (*config.LLMConfig, error)
+	IsLLMProfileHealthy(name string) bool
+	LookupModelAlias(ctx context.Context, name string) (*models.ModelAlias, bool)
+}
+
+// Router picks the LLM profile and model of requests from routing policies
+type Router interface {
+	Route(ctx context.Context, req *models.GuardRequest) *models.LLMRoute
 }
 
 // ClientFactory creates LLM clients dynamically based on request parameters
@@ -218,6 +343,8 @@ type ClientFactory struct {
 	defaultConfig    config.LLMConfig
 	defaultClient    *Client
 	settingsProvider SettingsProvider
+	router           Router
+	pool             *clientPool // nil when pooling is disabled
 }
 
 // NewClientFactory creates a new client factory with default configuration
@@ -233,10 +360,14 @@ func NewClientFactory(cfg config.LLMConfig) (*ClientFactory, error) {
 		}
 	}
 
-	return &ClientFactory{
+	factory := &ClientFactory{
 		defaultConfig: cfg,
 		defaultClient: defaultClient,
-	}, nil
+	}
+	if cfg.ClientPool.Size > 0 {
+		factory.pool = newClientPool(cfg.ClientPool)
+	}
+	return factory, nil
 }
 
 // NewClientFactoryWithSettings creates a factory that can fetch settings dynamically
@@ -254,17 +385,83 @@ func (f *ClientFactory) SetSettingsProvider(provider SettingsProvider) {
 	f.settingsProvider = provider
 }
 
+// SetRouter sets the routing policies applied to requests that don't name
+// an LLM profile
+func (f *ClientFactory) SetRouter(router Router) {
+	f.router = router
+}
+
 // GetClient returns an LLM client based on request parameters
-// If request specifies provider/model/apikey, creates a new client
+// If request names an LLM profile, uses a client for that profile, and
+// otherwise the profile of the caller's API key
+// Without either, a routing policy may pick its profile and model, recorded in req.Route
+// A model naming an alias is replaced by the alias's model, and its profile
+// applies unless one was named or routed to; the alias is kept in req.ModelAlias
+// If request specifies provider/model/apikey, uses a client for those
 // Otherwise checks settings provider, then falls back to default client
-func (f *ClientFactory) GetClient(req *models.GuardRequest) (*Client, bool, error) {
+// Clients are taken from the pool when pooling is enabled; the bool reports
+// whether the caller must close the client after use
+func (f *ClientFactory) GetClient(ctx context.Context, req *models.GuardRequest) (*Client, bool, error) {
+	if req.LLMProfile == "" {
+		req.LLMProfile = req.KeyProfile
+	}
+	if req.LLMProfile == "" && f.router != nil {
+		if route := f.router.Route(ctx, req); route != nil {
+			req.Route = route
+			req.LLMProfile = route.Profile
+			if route.Model != "" {
+				req.Model = route.Model
+			}
+		}
+	}
+	if f.settingsProvider != nil && req.Provider == "" {
+		if alias, ok := f.settingsProvider.LookupModelAlias(ctx, req.Model); ok {
+			req.ModelAlias = alias.Name
+			req.Model = alias.Model
+			if req.LLMProfile == "" {
+				req.LLMProfile = alias.LLMProfile
+			}
+		}
+	}
+
+	if req.LLMProfile != "" && req.LLMProfile != "default" {
+		cfg, err := f.profileConfig(req.LLMProfile)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// Request-level parameters still apply on top of the profile
+		if req.Model != "" {
+			cfg.Model = req.Model
+		}
+		if req.MaxTokens != nil {
+			cfg.MaxTokens = *req.MaxTokens
+		}
+		if req.Temperature != nil {
+			cfg.Temperature = *req.Temperature
+		}
+		cfg, _ = f.failover(cfg)
+
+		client, shouldClose, err := f.client(cfg)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create client for profile %s: %w", req.LLMProfile, err)
+		}
+		return client, shouldClose, nil
+	}
+
 	// If no override specified in request, check settings provider
 	if req.Provider == "" && req.APIKey == "" && req.BaseURL == "" {
 		// Try to get dynamic settings from database
 		if f.settingsProvider != nil {
-			ctx := context.Background()
 			provider, model, apiKey, baseURL, err := f.settingsProvider.GetLLMConfig(ctx)
 			if err == nil && apiKey != "" {
+				// Fail over to the statically configured client while the dashboard
+				// credentials are failing validation
+				if !f.settingsProvider.IsLLMProfileHealthy("default") && f.defaultClient != nil && pinnedModel(req) == "" {
+					requestid.Logger(ctx).Warn().Msg("Dashboard LLM settings failing validation - using configured default client")
+					return f.defaultClient, false, nil
+				}
+
 				// Use settings from database
 				cfg := config.LLMConfig{
 					Provider:    provider,
@@ -273,12 +470,20 @@ func (f *ClientFactory) GetClient(req *models.GuardRequest) (*Client, bool, erro
 					BaseURL:     baseURL,
 					MaxTokens:   f.defaultConfig.MaxTokens,
 					Temperature: f.defaultConfig.Temperature,
+					Timeout:     f.defaultConfig.Timeout,
+
+					FailoverProfile: f.defaultConfig.FailoverProfile,
+				}
+				f.inheritTLS(&cfg)
+				if model := pinnedModel(req); model != "" {
+					cfg.Model = model
 				}
-				client, err := NewClient(cfg)
+				cfg, _ = f.failover(cfg)
+				client, shouldClose, err := f.client(cfg)
 				if err != nil {
 					return nil, false, fmt.Errorf("failed to create client from settings: %w", err)
 				}
-				return client, true, nil // true = close after use
+				return client, shouldClose, nil
 			}
 		}
 
@@ -286,6 +491,22 @@ func (f *ClientFactory) GetClient(req *models.GuardRequest) (*Client, bool, erro
 		if f.defaultClient == nil {
 			return nil, false, errors.New("no LLM client configured and no provider specified in request")
 		}
+		if cfg, ok := f.failover(f.defaultConfig); ok {
+			client, shouldClose, err := f.client(cfg)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to create failover client: %w", err)
+			}
+			return client, shouldClose, nil
+		}
+		if model := pinnedModel(req); model != "" && model != f.defaultConfig.Model {
+			cfg := f.defaultConfig
+			cfg.Model = model
+			client, shouldClose, err := f.client(cfg)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to create client for model %s: %w", model, err)
+			}
+			return client, shouldClose, nil
+		}
 		return f.defaultClient, false, nil // false = don't close after use
 	}
 
@@ -297,6 +518,7 @@ func (f *ClientFactory) GetClient(req *models.GuardRequest) (*Client, bool, erro
 		Model:       req.Model,
 		MaxTokens:   f.defaultConfig.MaxTokens,
 		Temperature: f.defaultConfig.Temperature,
+		Timeout:     f.defaultConfig.Timeout,
 	}
 
 	// Use defaults if not specified in request
@@ -318,14 +540,135 @@ func (f *ClientFactory) GetClient(req *models.GuardRequest) (*Client, bool, erro
 	if req.Temperature != nil {
 		cfg.Temperature = *req.Temperature
 	}
+	f.inheritTLS(&cfg)
 
-	// Create new client for this request
-	client, err := NewClient(cfg)
+	client, shouldClose, err := f.client(cfg)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to create LLM client for request: %w", err)
 	}
+	return client, shouldClose, nil
+}
+
+// pinnedModel returns the model a routing policy or model alias sent req to,
+// if any. The request's own model only applies with its own provider or
+// credentials.
+func pinnedModel(req *models.GuardRequest) string {
+	if req.ModelAlias != "" {
+		return req.Model
+	}
+	if req.Route == nil {
+		return ""
+	}
+	return req.Route.Model
+}
+
+// client returns the pooled client for cfg, or a new one to close after use
+// when pooling is disabled
+func (f *ClientFactory) client(cfg config.LLMConfig) (*Client, bool, error) {
+	if f.pool == nil {
+		client, err := NewClient(cfg)
+		return client, err == nil, err
+	}
+	client, err := f.pool.get(cfg)
+	return client, false, err
+}
+
+// PoolStats reports the reuse of pooled clients; ok is false when pooling is
+// disabled
+func (f *ClientFactory) PoolStats() (stats ClientPoolStats, ok bool) {
+	if f.pool == nil {
+		return ClientPoolStats{}, false
+	}
+	return f.pool.stats(), true
+}
+
+// ClearPool drops every pooled client, e.g. after credentials are rotated
+func (f *ClientFactory) ClearPool() {
+	if f.pool != nil {
+		f.pool.clear()
+	}
+}
+
+// profileConfig resolves a named profile from the settings provider, then from static config
+func (f *ClientFactory) profileConfig(name string) (config.LLMConfig, error) {
+	if f.settingsProvider != nil {
+		if cfg, err := f.settingsProvider.GetLLMProfile(context.Background(), name); err == nil && cfg != nil {
+			profile := *cfg
+			if profile.Timeout == 0 {
+				profile.Timeout = f.defaultConfig.Timeout
+			}
+			f.inheritTLS(&profile)
+			return profile, nil
+		}
+	}
+
+	cfg, ok := f.defaultConfig.Profiles[name]
+	if !ok {
+		return config.LLMConfig{}, fmt.Errorf("unknown LLM profile: %s", name)
+	}
+
+	// Unset profile fields inherit from the default configuration
+	if cfg.Provider == "" {
+		cfg.Provider = f.defaultConfig.Provider
+	}
+	if cfg.APIKey == "" && cfg.Provider == f.defaultConfig.Provider {
+		cfg.APIKey = f.defaultConfig.APIKey
+	}
+	if cfg.Model == "" {
+		cfg.Model = f.defaultConfig.Model
+	}
+	if cfg.MaxTokens == 0 {
+		cfg.MaxTokens = f.defaultConfig.MaxTokens
+	}
+	if cfg.Temperature == 0 {
+		cfg.Temperature = f.defaultConfig.Temperature
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = f.defaultConfig.Timeout
+	}
+	f.inheritTLS(&cfg)
+	return cfg, nil
+}
+
+// inheritTLS gives cfg the default configuration's TLS settings when it has
+// none of its own and calls the same endpoint, so client certificates for a
+// self-hosted gateway needn't be repeated for every profile
+func (f *ClientFactory) inheritTLS(cfg *config.LLMConfig) {
+	if !cfg.TLS.IsZero() || f.defaultConfig.TLS.IsZero() {
+		return
+	}
+	if cfg.Provider == f.defaultConfig.Provider && BaseURL(*cfg) == BaseURL(f.defaultConfig) {
+		cfg.TLS = f.defaultConfig.TLS
+	}
+}
+
+// failover returns the configuration of cfg's failover profile while the
+// circuit of cfg's provider is open, following the failover profile of the
+// failover profile if it is open too. ok is false when cfg should be used.
+// The failover profile's own model and settings replace the request's.
+func (f *ClientFactory) failover(cfg config.LLMConfig) (_ config.LLMConfig, ok bool) {
+	tried := make(map[string]bool)
+	for !circuits.get(cfg).available(time.Now()) {
+		name := cfg.FailoverProfile
+		if name == "" || tried[name] {
+			break
+		}
+		tried[name] = true
+
+		next, err := f.profileConfig(name)
+		if err != nil {
+			log.Warn().Err(err).Str("provider", circuitName(cfg)).Msg("LLM provider circuit open - failover profile unavailable")
+			break
+		}
+		log.Warn().Str("provider", circuitName(cfg)).Str("profile", name).Msg("LLM provider circuit open - failing over")
+		cfg, ok = next, true
+	}
+	return cfg, ok
+}
 
-	return client, true, nil // true = close after use
+// MaxTimeout returns the longest timeout a request may ask for
+func (f *ClientFactory) MaxTimeout() time.Duration {
+	return max(f.defaultConfig.MaxTimeout, f.defaultConfig.Timeout)
 }
 
 // GetDefaultClient returns the default client
@@ -333,8 +676,9 @@ func (f *ClientFactory) GetDefaultClient() *Client {
 	return f.defaultClient
 }
 
-// Close closes the default client
+// Close closes the default client and the pooled ones
 func (f *ClientFactory) Close() error {
+	f.ClearPool()
 	if f.defaultClient != nil {
 		return f.defaultClient.Close()
 	}
@@ -0,0 +1,160 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// maxChatResponse bounds how much of a provider's chat response is read
+const maxChatResponse = 16 << 20
+
+// ErrUnsupportedInput is returned for image input or tools the client can't forward
+var ErrUnsupportedInput = errors.New("provider does not accept image input or tools")
+
+// compatibleBaseURLs are the OpenAI-compatible chat endpoints used for
+// messages with images and for function calling. OmniLLM messages only carry
+// text and its providers drop tools, so these requests bypass it.
+var compatibleBaseURLs = map[string]string{
+	"openai":    "https://api.openai.com/v1",
+	"anthropic": "https://api.anthropic.com/v1",
+	"claude":    "https://api.anthropic.com/v1",
+	"gemini":    "https://generativelanguage.googleapis.com/v1beta/openai",
+	"google":    "https://generativelanguage.googleapis.com/v1beta/openai",
+	"ollama":    "http://localhost:11434/v1",
+	"xai":       "https://api.x.ai/v1",
+	"grok":      "https://api.x.ai/v1",
+}
+
+// BaseURL returns the OpenAI-compatible endpoint for cfg: its base_url, or
+// the provider's public API when unset. It is empty for unknown providers.
+func BaseURL(cfg config.LLMConfig) string {
+	if cfg.BaseURL != "" {
+		return cfg.BaseURL
+	}
+	return compatibleBaseURLs[cfg.Provider]
+}
+
+// compatibleRequest is an OpenAI-style chat completion body; messages
+// marshal their content parts and tool calls as-is
+type compatibleRequest struct {
+	Model       string           `json:"model"`
+	Messages    []models.Message `json:"messages"`
+	MaxTokens   *int             `json:"max_tokens,omitempty"`
+	Temperature *float64         `json:"temperature,omitempty"`
+	Tools       []models.Tool    `json:"tools,omitempty"`
+	ToolChoice  json.RawMessage  `json:"tool_choice,omitempty"`
+}
+
+type compatibleResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content   string            `json:"content"`
+			ToolCalls []models.ToolCall `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		TotalTokens         int `json:"total_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	} `json:"usage"`
+}
+
+// chatCompatible sends messages with image parts or tool calls, and tool
+// definitions, to the provider's OpenAI-compatible chat completions endpoint,
+// with the provider options added to the body
+func (c *Client) chatCompatible(ctx context.Context, messages []models.Message, tools []models.Tool, toolChoice json.RawMessage, options map[string]interface{}) (*models.LLMResponse, error) {
+	baseURL := BaseURL(c.config)
+	if baseURL == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedInput, c.config.Provider)
+	}
+
+	req := compatibleRequest{Model: c.config.Model, Messages: messages, Tools: tools, ToolChoice: toolChoice}
+	if maxTokens := c.maxTokens(ctx); maxTokens > 0 {
+		req.MaxTokens = &maxTokens
+	}
+	if c.config.Temperature > 0 {
+		req.Temperature = &c.config.Temperature
+	}
+	body, err := withOptions(req, options)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChatResponse))
+	if err != nil {
+		return nil, fmt.Errorf("LLM request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LLM request failed: %w", &StatusError{StatusCode: resp.StatusCode, Message: providerError(data)})
+	}
+
+	var result compatibleResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("LLM request failed: unreadable response: %w", err)
+	}
+
+	llmResp := &models.LLMResponse{Model: result.Model}
+	if llmResp.Model == "" {
+		llmResp.Model = c.config.Model
+	}
+	if len(result.Choices) > 0 {
+		llmResp.Content = result.Choices[0].Message.Content
+		llmResp.FinishReason = result.Choices[0].FinishReason
+		llmResp.ToolCalls = result.Choices[0].Message.ToolCalls
+	}
+	if result.Usage.TotalTokens > 0 {
+		llmResp.Usage = &models.Usage{
+			PromptTokens:     result.Usage.PromptTokens,
+			CompletionTokens: result.Usage.CompletionTokens,
+			TotalTokens:      result.Usage.TotalTokens,
+			CacheReadTokens:  result.Usage.PromptTokensDetails.CachedTokens,
+		}
+	}
+	return llmResp, nil
+}
+
+// withOptions marshals a request body with the provider options added. The
+// options were validated, so they can't replace the request's own fields.
+func withOptions(req interface{}, options map[string]interface{}) ([]byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil || len(options) == 0 {
+		return body, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range options {
+		fields[name] = value
+	}
+	return json.Marshal(fields)
+}
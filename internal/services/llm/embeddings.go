@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// maxEmbeddingResponse bounds how much of a provider's embeddings response is
+// read; a batch of large vectors runs to a few MB
+const maxEmbeddingResponse = 64 << 20
+
+// embeddingBaseURLs are the OpenAI-compatible endpoints of the providers that
+// serve embeddings. OmniLLM only covers chat, so embeddings go through a
+// plain HTTP client.
+var embeddingBaseURLs = map[string]string{
+	"openai": "https://api.openai.com/v1",
+	"gemini": "https://generativelanguage.googleapis.com/v1beta/openai",
+	"google": "https://generativelanguage.googleapis.com/v1beta/openai",
+	"ollama": "http://localhost:11434/v1",
+	"xai":    "https://api.x.ai/v1",
+	"grok":   "https://api.x.ai/v1",
+}
+
+// EmbeddingClient calls a provider's OpenAI-compatible embeddings endpoint
+type EmbeddingClient struct {
+	config     config.LLMConfig
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewEmbeddingClient creates an embeddings client for cfg. Providers without
+// an embeddings API, like Anthropic, need a base_url pointing at an
+// OpenAI-compatible one.
+func NewEmbeddingClient(cfg config.LLMConfig) (*EmbeddingClient, error) {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = embeddingBaseURLs[cfg.Provider]
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("provider %s has no embeddings API; set base_url to an OpenAI-compatible endpoint", cfg.Provider)
+	}
+
+	httpClient, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &EmbeddingClient{
+		config:     cfg,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}, nil
+}
+
+// Target returns the provider and the model requests without one are sent to
+func (c *EmbeddingClient) Target() (provider, model string) {
+	return c.config.Provider, c.config.EmbeddingModel
+}
+
+// embeddingRequest is the body sent to the provider
+type embeddingRequest struct {
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	Dimensions     *int     `json:"dimensions,omitempty"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
+}
+
+// Embed embeds inputs with the request's model, or the configured embedding
+// model. The inputs replace the request's own, so callers can pass masked text.
+// Embedding calls share the circuit of the provider's chat calls.
+func (c *EmbeddingClient) Embed(ctx context.Context, req *models.EmbeddingRequest, inputs []string) (*models.EmbeddingResponse, error) {
+	if req.Model == "" && c.config.EmbeddingModel == "" {
+		return nil, errors.New("no embedding model configured and none specified in request")
+	}
+	circuit := circuits.get(c.config)
+	probe, err := circuit.allow(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	callCtx, cancel, timeout := callContext(ctx, c.config)
+	defer cancel()
+	start := time.Now()
+	resp, err := c.embed(callCtx, req, inputs)
+	err = callError(ctx, callCtx, timeout, err)
+	circuit.record(probe, err, 0, time.Since(start))
+	logCall(ctx, c.config, "embeddings", start, err)
+	return resp, err
+}
+
+// embed makes the call for Embed
+func (c *EmbeddingClient) embed(ctx context.Context, req *models.EmbeddingRequest, inputs []string) (*models.EmbeddingResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = c.config.EmbeddingModel
+	}
+
+	body, err := json.Marshal(embeddingRequest{
+		Model:          model,
+		Input:          inputs,
+		Dimensions:     req.Dimensions,
+		EncodingFormat: req.EncodingFormat,
+	})
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxEmbeddingResponse))
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings request failed: %w", &StatusError{StatusCode: resp.StatusCode, Message: providerError(data)})
+	}
+
+	var result models.EmbeddingResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("embeddings request failed: unreadable response: %w", err)
+	}
+	if len(result.Data) != len(inputs) {
+		return nil, fmt.Errorf("embeddings request failed: got %d embeddings for %d inputs", len(result.Data), len(inputs))
+	}
+	if result.Model == "" {
+		result.Model = model
+	}
+	return &result, nil
+}
+
+// providerError extracts the message of an OpenAI-style error body
+func providerError(body []byte) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	if len(body) > 200 {
+		body = body[:200]
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// GetEmbeddingClient returns an embeddings client for the named LLM profile,
+// or for the dashboard or configured default settings
+func (f *ClientFactory) GetEmbeddingClient(profile string) (*EmbeddingClient, error) {
+	if profile != "" && profile != "default" {
+		cfg, err := f.profileConfig(profile)
+		if err != nil {
+			return nil, err
+		}
+		cfg, _ = f.failover(cfg)
+		if cfg.EmbeddingModel == "" {
+			cfg.EmbeddingModel = f.defaultConfig.EmbeddingModel
+		}
+		return NewEmbeddingClient(cfg)
+	}
+
+	cfg := f.defaultConfig
+	if f.settingsProvider != nil && f.settingsProvider.IsLLMProfileHealthy("default") {
+		provider, model, apiKey, baseURL, err := f.settingsProvider.GetLLMConfig(context.Background())
+		if err == nil && apiKey != "" {
+			cfg.Provider, cfg.Model, cfg.APIKey, cfg.BaseURL = provider, model, apiKey, baseURL
+		}
+	}
+	if cfg.APIKey == "" && cfg.Provider != "ollama" {
+		return nil, errors.New("no LLM client configured for embeddings")
+	}
+	if failover, ok := f.failover(cfg); ok {
+		cfg = failover
+		if cfg.EmbeddingModel == "" {
+			cfg.EmbeddingModel = f.defaultConfig.EmbeddingModel
+		}
+	}
+	return NewEmbeddingClient(cfg)
+}
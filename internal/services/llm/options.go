@@ -0,0 +1,294 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// optionCheck returns why an option's value is invalid, or ""
+type optionCheck func(value interface{}) string
+
+// providerOptionChecks lists the options each provider accepts in
+// provider_options. OpenAI-compatible providers get them in the chat
+// completions body; Anthropic's are sent to its Messages API.
+var providerOptionChecks = map[string]map[string]optionCheck{
+	"openai": {
+		"seed":                anyInteger,
+		"logit_bias":          logitBias,
+		"response_format":     responseFormat,
+		"top_p":               number(0, 1),
+		"stop":                stopSequences(4),
+		"presence_penalty":    number(-2, 2),
+		"frequency_penalty":   number(-2, 2),
+		"parallel_tool_calls": boolean,
+		"logprobs":            boolean,
+		"top_logprobs":        integer(0, 20),
+		"user":                str,
+		"service_tier":        oneOf("auto", "default", "flex", "priority"),
+		"reasoning_effort":    oneOf("minimal", "low", "medium", "high"),
+	},
+	"anthropic": {
+		"cache_control":  cacheControl,
+		"top_k":          integer(0, math.MaxInt32),
+		"top_p":          number(0, 1),
+		"stop_sequences": stringArray,
+		"metadata":       anthropicMetadata,
+	},
+	"gemini": {
+		"seed":             anyInteger,
+		"response_format":  responseFormat,
+		"top_p":            number(0, 1),
+		"stop":             stopSequences(5),
+		"reasoning_effort": oneOf("none", "low", "medium", "high"),
+	},
+	"xai": {
+		"seed":              anyInteger,
+		"response_format":   responseFormat,
+		"top_p":             number(0, 1),
+		"stop":              stopSequences(0),
+		"presence_penalty":  number(-2, 2),
+		"frequency_penalty": number(-2, 2),
+		"logprobs":          boolean,
+		"top_logprobs":      integer(0, 8),
+		"reasoning_effort":  oneOf("low", "high"),
+	},
+	"ollama": {
+		"seed":              anyInteger,
+		"response_format":   responseFormat,
+		"top_p":             number(0, 1),
+		"stop":              stopSequences(0),
+		"presence_penalty":  number(-2, 2),
+		"frequency_penalty": number(-2, 2),
+	},
+}
+
+// providerFamily maps provider names to the name their options are given
+// under, e.g. claude to anthropic
+func providerFamily(provider string) string {
+	switch provider = strings.ToLower(provider); provider {
+	case "claude":
+		return "anthropic"
+	case "google":
+		return "gemini"
+	case "grok":
+		return "xai"
+	}
+	return provider
+}
+
+// ValidateProviderOptions checks the provider_options of a request: each
+// provider must take options and each option must be one it accepts, with
+// a valid value. Options for providers other than the one the request ends
+// up at are checked too, since routing and failover can send it anywhere.
+func ValidateProviderOptions(req *models.GuardRequest) []models.FieldError {
+	var errs []models.FieldError
+	for _, provider := range sortedKeys(req.ProviderOptions) {
+		field := "provider_options." + provider
+		checks, ok := providerOptionChecks[providerFamily(provider)]
+		if !ok {
+			errs = append(errs, models.FieldError{Field: field, Message: "is not a provider that takes options; use one of " + strings.Join(sortedKeys(providerOptionChecks), ", ")})
+			continue
+		}
+		options := req.ProviderOptions[provider]
+		for _, name := range sortedKeys(options) {
+			check, ok := checks[name]
+			if !ok {
+				errs = append(errs, models.FieldError{Field: field + "." + name, Message: "is not an option " + provider + " accepts; use one of " + strings.Join(sortedKeys(checks), ", ")})
+				continue
+			}
+			if msg := check(options[name]); msg != "" {
+				errs = append(errs, models.FieldError{Field: field + "." + name, Message: msg})
+			}
+		}
+		// The Messages API is called directly, without the conversion of
+		// tools and images the compatible API does
+		if providerFamily(provider) == "anthropic" && len(options) > 0 &&
+			(len(req.Tools) > 0 || models.HasTools(req.Messages) || models.AnyImages(req.Messages)) {
+			errs = append(errs, models.FieldError{Field: field, Message: "can't be combined with tools or images"})
+		}
+	}
+	return errs
+}
+
+type providerOptionsKey struct{}
+
+// WithProviderOptions attaches the provider_options of a request to the LLM
+// calls made with ctx; each call uses those of its provider
+func WithProviderOptions(ctx context.Context, options map[string]map[string]interface{}) context.Context {
+	if len(options) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, providerOptionsKey{}, options)
+}
+
+// providerOptions returns the options attached to ctx for provider
+func providerOptions(ctx context.Context, provider string) map[string]interface{} {
+	all, _ := ctx.Value(providerOptionsKey{}).(map[string]map[string]interface{})
+	family := providerFamily(provider)
+	for name, options := range all {
+		if providerFamily(name) == family && len(options) > 0 {
+			return options
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func number(lo, hi float64) optionCheck {
+	return func(v interface{}) string {
+		n, ok := v.(float64)
+		if !ok || n < lo || n > hi {
+			return fmt.Sprintf("must be a number between %g and %g", lo, hi)
+		}
+		return ""
+	}
+}
+
+func integer(lo, hi int64) optionCheck {
+	return func(v interface{}) string {
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) || n < float64(lo) || n > float64(hi) {
+			return fmt.Sprintf("must be an integer between %d and %d", lo, hi)
+		}
+		return ""
+	}
+}
+
+func anyInteger(v interface{}) string {
+	if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+		return "must be an integer"
+	}
+	return ""
+}
+
+func boolean(v interface{}) string {
+	if _, ok := v.(bool); !ok {
+		return "must be a boolean"
+	}
+	return ""
+}
+
+func str(v interface{}) string {
+	if _, ok := v.(string); !ok {
+		return "must be a string"
+	}
+	return ""
+}
+
+func oneOf(values ...string) optionCheck {
+	return func(v interface{}) string {
+		if s, ok := v.(string); !ok || !slices.Contains(values, s) {
+			return "must be one of " + strings.Join(values, ", ")
+		}
+		return ""
+	}
+}
+
+// stopSequences accepts a string or an array of up to limit strings; 0
+// doesn't limit the array
+func stopSequences(limit int) optionCheck {
+	return func(v interface{}) string {
+		if _, ok := v.(string); ok {
+			return ""
+		}
+		list, ok := v.([]interface{})
+		if ok {
+			for _, s := range list {
+				if _, ok = s.(string); !ok {
+					break
+				}
+			}
+		}
+		switch {
+		case !ok:
+			return "must be a string or an array of strings"
+		case limit > 0 && len(list) > limit:
+			return fmt.Sprintf("must have at most %d items", limit)
+		}
+		return ""
+	}
+}
+
+func stringArray(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return "must be an array of strings"
+	}
+	for _, s := range list {
+		if _, ok := s.(string); !ok {
+			return "must be an array of strings"
+		}
+	}
+	return ""
+}
+
+func logitBias(v interface{}) string {
+	biases, ok := v.(map[string]interface{})
+	if !ok {
+		return "must be an object of token IDs to biases"
+	}
+	for token, bias := range biases {
+		if number(-100, 100)(bias) != "" {
+			return "bias of token " + token + " must be a number between -100 and 100"
+		}
+	}
+	return ""
+}
+
+func responseFormat(v interface{}) string {
+	format, ok := v.(map[string]interface{})
+	if !ok {
+		return "must be an object with a type"
+	}
+	switch format["type"] {
+	case "text", "json_object":
+		return ""
+	case "json_schema":
+		if _, ok := format["json_schema"].(map[string]interface{}); !ok {
+			return "of type json_schema must have a json_schema object"
+		}
+		return ""
+	}
+	return "type must be one of text, json_object, json_schema"
+}
+
+func cacheControl(v interface{}) string {
+	cc, ok := v.(map[string]interface{})
+	if !ok || cc["type"] != "ephemeral" {
+		return `must be {"type": "ephemeral"}, optionally with a ttl of 5m or 1h`
+	}
+	if ttl, set := cc["ttl"]; set && ttl != "5m" && ttl != "1h" {
+		return "ttl must be 5m or 1h"
+	}
+	return ""
+}
+
+func anthropicMetadata(v interface{}) string {
+	metadata, ok := v.(map[string]interface{})
+	if !ok {
+		return "must be an object"
+	}
+	for key, value := range metadata {
+		if key != "user_id" {
+			return "only takes user_id"
+		}
+		if str(value) != "" {
+			return "user_id must be a string"
+		}
+	}
+	return ""
+}
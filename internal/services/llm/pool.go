@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// ClientPoolStats reports how well pooled clients are reused
+type ClientPoolStats struct {
+	Clients        int     `json:"clients"`
+	Capacity       int     `json:"capacity"`
+	Hits           int64   `json:"hits"`
+	Misses         int64   `json:"misses"`
+	Evictions      int64   `json:"evictions"`
+	ReuseRate      float64 `json:"reuse_rate"`
+	IdleTimeoutSec float64 `json:"idle_timeout_seconds"`
+}
+
+// clientPool keeps the clients built for dashboard settings, profiles and
+// request overrides, so they aren't built for every request. The least
+// recently used client goes when the pool is full, and clients unused for
+// the idle timeout go on the next lookup.
+type clientPool struct {
+	mu      sync.Mutex
+	size    int
+	idle    time.Duration
+	order   *list.List // of *pooledClient, most recently used first
+	clients map[string]*list.Element
+
+	hits, misses, evictions int64
+}
+
+type pooledClient struct {
+	key      string
+	client   *Client
+	lastUsed time.Time
+}
+
+func newClientPool(cfg config.ClientPoolConfig) *clientPool {
+	return &clientPool{
+		size:    cfg.Size,
+		idle:    cfg.IdleTimeout,
+		order:   list.New(),
+		clients: make(map[string]*list.Element),
+	}
+}
+
+// get returns the pooled client for cfg, creating it if needed
+func (p *clientPool) get(cfg config.LLMConfig) (*Client, error) {
+	key := clientKey(cfg)
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evictIdle(now)
+
+	if el, ok := p.clients[key]; ok {
+		p.hits++
+		entry := el.Value.(*pooledClient)
+		entry.lastUsed = now
+		p.order.MoveToFront(el)
+		return entry.client, nil
+	}
+
+	p.misses++
+	client, err := NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.clients[key] = p.order.PushFront(&pooledClient{key: key, client: client, lastUsed: now})
+	for p.order.Len() > p.size {
+		p.remove(p.order.Back())
+	}
+	return client, nil
+}
+
+// evictIdle removes the clients unused for the idle timeout. The caller must
+// hold p.mu.
+func (p *clientPool) evictIdle(now time.Time) {
+	if p.idle <= 0 {
+		return
+	}
+	for el := p.order.Back(); el != nil && now.Sub(el.Value.(*pooledClient).lastUsed) > p.idle; el = p.order.Back() {
+		p.remove(el)
+	}
+}
+
+// remove evicts a client. Clients hold no connections of their own, so one
+// still in use by a request keeps working. The caller must hold p.mu.
+func (p *clientPool) remove(el *list.Element) {
+	entry := p.order.Remove(el).(*pooledClient)
+	delete(p.clients, entry.key)
+	p.evictions++
+	if err := entry.client.Close(); err != nil {
+		log.Warn().Err(err).Msg("Failed to close evicted LLM client")
+	}
+}
+
+// clear evicts every client
+func (p *clientPool) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.order.Len() > 0 {
+		p.remove(p.order.Back())
+	}
+}
+
+func (p *clientPool) stats() ClientPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := ClientPoolStats{
+		Clients:        p.order.Len(),
+		Capacity:       p.size,
+		Hits:           p.hits,
+		Misses:         p.misses,
+		Evictions:      p.evictions,
+		IdleTimeoutSec: p.idle.Seconds(),
+	}
+	if total := p.hits + p.misses; total > 0 {
+		stats.ReuseRate = float64(p.hits) / float64(total)
+	}
+	return stats
+}
+
+// clientKey identifies the client for cfg. The API key is part of it, so the
+// key is hashed rather than kept in the pool's index.
+func clientKey(cfg config.LLMConfig) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d\x00%g\x00%s\x00%s\x00%s\x00%s\x00%s",
+		cfg.Provider, cfg.BaseURL, cfg.APIKey, cfg.Model, cfg.MaxTokens, cfg.Temperature, cfg.Timeout,
+		cfg.TLS.CAFile, cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ServerName)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/agentplexus/omnillm"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// ErrTimeout is matched by the errors of LLM calls that ran out of time
+var ErrTimeout = errors.New("LLM request timed out")
+
+// Kinds of failed LLM calls, as reported in guard responses and the audit log
+const (
+	FailureTimeout      = "upstream_timeout"
+	FailureProvider     = "provider_error"
+	FailureUnavailable  = "provider_unavailable" // the provider's circuit is open
+	FailureDisconnected = "client_disconnected"
+)
+
+// FailureKind classifies the error of an LLM call
+func FailureKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrTimeout):
+		return FailureTimeout
+	case errors.Is(err, ErrCircuitOpen):
+		return FailureUnavailable
+	case errors.Is(err, context.Canceled):
+		return FailureDisconnected
+	}
+	return FailureProvider
+}
+
+type timeoutKey struct{}
+
+// WithTimeout overrides the configured timeout of the LLM calls made with ctx
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// callContext bounds a call by the timeout attached to ctx, or else the one
+// configured
+func callContext(ctx context.Context, cfg config.LLMConfig) (context.Context, context.CancelFunc, time.Duration) {
+	timeout, ok := ctx.Value(timeoutKey{}).(time.Duration)
+	if !ok || timeout <= 0 {
+		timeout = cfg.Timeout
+	}
+	if timeout <= 0 {
+		timeout = defaultProviderTimeout(cfg.Provider)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	return callCtx, cancel, timeout
+}
+
+// callError tells apart calls that failed because the caller went away or
+// because the timeout ran out, which providers report in many ways, from
+// other failures
+func callError(ctx, callCtx context.Context, timeout time.Duration, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("LLM request cancelled: %w", context.Canceled)
+	case errors.Is(callCtx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w after %s: %w", ErrTimeout, timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// defaultProviderTimeout is the timeout of calls to a provider whose
+// configuration sets none, the one OmniLLM gives it
+func defaultProviderTimeout(provider string) time.Duration {
+	switch omnillm.ProviderName(provider) {
+	case omnillm.ProviderNameOllama, omnillm.ProviderNameXAI, "grok":
+		return 60 * time.Second
+	}
+	return 30 * time.Second
+}
@@ -0,0 +1,60 @@
+package llm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/epps11/goguard/internal/config"
+)
+
+// newHTTPClient returns the HTTP client provider calls for cfg are made
+// with. Calls are bounded by their context rather than a client timeout, so
+// requests can set their own.
+func newHTTPClient(cfg config.LLMConfig) (*http.Client, error) {
+	var base http.RoundTripper = http.DefaultTransport
+	if !cfg.TLS.IsZero() {
+		tlsConfig, err := upstreamTLS(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		base = transport
+	}
+	if faultInjection.Load() {
+		base = faultTransport{base: base}
+	}
+	return &http.Client{Transport: base}, nil
+}
+
+// upstreamTLS builds the TLS configuration for connections to a provider
+func upstreamTLS(cfg config.UpstreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("llm tls needs both cert_file and key_file for a client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load LLM client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LLM CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,294 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Providers that score responses
+const (
+	ProviderKeywords = "keywords" // built-in and configured regular expressions
+	ProviderOpenAI   = "openai"   // OpenAI moderations API
+)
+
+// Actions taken on flagged responses
+const (
+	ActionWarn   = "warn"   // deliver the response with the report
+	ActionRedact = "redact" // remove the flagged text
+	ActionBlock  = "block"  // withhold the response
+)
+
+// defaultBaseURL is the moderations API used when none is configured
+const defaultBaseURL = "https://api.openai.com/v1"
+
+// DefaultThreshold is the score at which categories without a configured
+// threshold are flagged
+const DefaultThreshold = 0.5
+
+// redactedNotice replaces responses that can't be redacted in part
+const redactedNotice = "[Response removed by content moderation]"
+
+// maxModerationResponse bounds how much of a moderations API response is read
+const maxModerationResponse = 1 << 20
+
+// ErrResponseBlocked is returned when a flagged response must be withheld
+var ErrResponseBlocked = errors.New("response blocked by content moderation")
+
+// ErrInvalidSettings is returned for moderation settings that can't be applied
+var ErrInvalidSettings = errors.New("invalid moderation settings")
+
+// SettingsProvider supplies moderation settings saved in the dashboard
+type SettingsProvider interface {
+	GetModerationSettings(ctx context.Context) (*models.ModerationSettings, error)
+}
+
+// Moderator checks LLM responses for harmful content
+type Moderator struct {
+	cfg      config.ModerationConfig
+	rules    []rule
+	http     *http.Client
+	settings SettingsProvider
+}
+
+// NewModerator creates a moderator. Settings saved with SetSettingsProvider
+// take precedence over cfg.
+func NewModerator(cfg config.ModerationConfig) *Moderator {
+	rules, err := compileRules(cfg.Keywords)
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring invalid moderation keywords")
+		rules, _ = compileRules(nil)
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL
+	}
+	if err := ValidateSettings(models.ModerationSettings{Provider: cfg.Provider, Action: cfg.Action, Thresholds: cfg.Thresholds}); err != nil {
+		log.Warn().Err(err).Msg("Invalid moderation config - using keyword rules and warnings")
+		cfg.Provider, cfg.Action, cfg.Thresholds = ProviderKeywords, ActionWarn, nil
+	}
+	return &Moderator{
+		cfg:   cfg,
+		rules: rules,
+		http:  &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// SetSettingsProvider lets dashboard settings override the config file
+func (m *Moderator) SetSettingsProvider(p SettingsProvider) {
+	m.settings = p
+}
+
+// Settings returns the settings in effect
+func (m *Moderator) Settings(ctx context.Context) models.ModerationSettings {
+	if m.settings != nil {
+		saved, err := m.settings.GetModerationSettings(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to load moderation settings - using config file")
+		} else if saved != nil {
+			return *saved
+		}
+	}
+	return models.ModerationSettings{
+		Enabled:    m.cfg.Enabled,
+		Provider:   m.cfg.Provider,
+		Action:     m.cfg.Action,
+		Thresholds: m.cfg.Thresholds,
+	}
+}
+
+// ValidateSettings checks a provider, action and thresholds
+func ValidateSettings(s models.ModerationSettings) error {
+	switch s.Provider {
+	case ProviderKeywords, ProviderOpenAI:
+	default:
+		return fmt.Errorf("%w: provider must be %s or %s", ErrInvalidSettings, ProviderKeywords, ProviderOpenAI)
+	}
+	switch s.Action {
+	case ActionWarn, ActionRedact, ActionBlock:
+	default:
+		return fmt.Errorf("%w: action must be %s, %s or %s", ErrInvalidSettings, ActionWarn, ActionRedact, ActionBlock)
+	}
+	for category, threshold := range s.Thresholds {
+		if !isCategory(category) {
+			return fmt.Errorf("%w: unknown category %q (use %s)", ErrInvalidSettings, category, strings.Join(Categories, ", "))
+		}
+		if threshold < 0 {
+			return fmt.Errorf("%w: threshold for %s must not be negative", ErrInvalidSettings, category)
+		}
+	}
+	return nil
+}
+
+// Moderate scores a response and applies the configured action to it. It
+// returns nil when moderation is off, and ErrResponseBlocked, with the
+// report, when the response must be withheld. Redaction changes resp in place.
+func (m *Moderator) Moderate(ctx context.Context, resp *models.LLMResponse) (*models.ModerationReport, error) {
+	settings := m.Settings(ctx)
+	if !settings.Enabled || resp == nil || strings.TrimSpace(resp.Content) == "" {
+		return nil, nil
+	}
+
+	report := &models.ModerationReport{Provider: settings.Provider}
+	var matches []match
+	var err error
+	if settings.Provider == ProviderOpenAI {
+		report.Scores, err = m.scoreOpenAI(ctx, resp.Content)
+	} else {
+		report.Provider = ProviderKeywords
+		report.Scores, matches = m.scoreKeywords(resp.Content)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		log.Warn().Err(err).Msg("Response moderation failed")
+		if m.cfg.FailOpen {
+			return report, nil
+		}
+		report.Action = ActionBlock
+		return report, ErrResponseBlocked
+	}
+
+	flagged := make(map[string]bool)
+	for _, category := range sortedCategories(report.Scores) {
+		score := report.Scores[category]
+		threshold := DefaultThreshold
+		if t, ok := settings.Thresholds[category]; ok {
+			threshold = t
+		}
+		if score > 0 && score >= threshold {
+			flagged[category] = true
+			report.Categories = append(report.Categories, models.ModerationCategory{
+				Category:  category,
+				Score:     score,
+				Threshold: threshold,
+			})
+		}
+	}
+	if len(flagged) == 0 {
+		return report, nil
+	}
+
+	report.Flagged = true
+	report.Action = settings.Action
+	switch settings.Action {
+	case ActionBlock:
+		return report, ErrResponseBlocked
+	case ActionRedact:
+		resp.Content = redact(resp.Content, matches, flagged)
+	default:
+		report.Action = ActionWarn
+	}
+	return report, nil
+}
+
+// redact removes the flagged matches from content. Providers that don't
+// locate what they flag, like the moderations API, have the whole response
+// replaced.
+func redact(content string, matches []match, flagged map[string]bool) string {
+	var spans []match
+	for _, mt := range matches {
+		if flagged[mt.category] {
+			spans = append(spans, mt)
+		}
+	}
+	if len(spans) == 0 {
+		return redactedNotice
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.start < last {
+			if s.end > last {
+				last = s.end
+			}
+			continue
+		}
+		b.WriteString(content[last:s.start])
+		b.WriteString("[REDACTED:" + strings.ToUpper(s.category) + "]")
+		last = s.end
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+// scoreOpenAI scores content with the moderations API, folding
+// subcategories such as hate/threatening into their category
+func (m *Moderator) scoreOpenAI(ctx context.Context, content string) (map[string]float64, error) {
+	if m.cfg.APIKey == "" {
+		return nil, errors.New("no API key configured for the moderations API")
+	}
+
+	body, _ := json.Marshal(map[string]string{"model": m.cfg.Model, "input": content})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(m.cfg.BaseURL, "/")+"/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.cfg.APIKey)
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("moderations request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxModerationResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderations response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("moderations API returned HTTP %d: %s", resp.StatusCode, truncate(string(data), 200))
+	}
+
+	var result struct {
+		Results []struct {
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || len(result.Results) == 0 {
+		return nil, errors.New("unreadable moderations response")
+	}
+
+	scores := make(map[string]float64)
+	for name, score := range result.Results[0].CategoryScores {
+		category := normalizeCategory(name)
+		if isCategory(category) && score > scores[category] {
+			scores[category] = score
+		}
+	}
+	return scores, nil
+}
+
+// normalizeCategory maps an OpenAI category such as self-harm/intent to
+// its GoGuard category, self_harm
+func normalizeCategory(name string) string {
+	name, _, _ = strings.Cut(name, "/")
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+func sortedCategories(scores map[string]float64) []string {
+	categories := make([]string, 0, len(scores))
+	for c := range scores {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
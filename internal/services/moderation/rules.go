@@ -0,0 +1,96 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// Categories are the kinds of harmful content responses are scored for
+var Categories = []string{"harassment", "hate", "illicit", "self_harm", "sexual", "violence"}
+
+// rule scores a response for a category when its pattern matches
+type rule struct {
+	category string
+	re       *regexp.Regexp
+	score    float64
+}
+
+// builtinRules catch unambiguous phrasings. They are deliberately narrow:
+// a response explaining or refusing a harmful request must not be flagged,
+// so single words are weighted below the default threshold.
+var builtinRules = []struct {
+	category string
+	pattern  string
+	score    float64
+}{
+	{"self_harm", `(?i)\b(you|u) should (just )?(kill|hurt|harm|cut) yourself\b`, 0.95},
+	{"self_harm", `(?i)\b(best|easiest|painless|quickest) (way|method)s? (to|of) (kill(ing)? (yourself|myself)|suicide|end(ing)? (your|my) life)\b`, 0.95},
+	{"self_harm", `(?i)\b(lethal|fatal) (dose|amount) (of|for)\b`, 0.6},
+	{"self_harm", `(?i)\bsuicide\b`, 0.2},
+	{"harassment", `(?i)\bkill yourself\b|\bkys\b`, 0.9},
+	{"harassment", `(?i)\byou('re| are) (a |an )?(worthless|pathetic|disgusting|useless) (piece of|loser|idiot|moron)`, 0.8},
+	{"harassment", `(?i)\b(nobody|no one) (would|will) (ever )?(miss|love|care about) you\b`, 0.75},
+	{"harassment", `(?i)\b(idiot|moron|loser)\b`, 0.3},
+	{"hate", `(?i)\b(are|is) (all )?(vermin|subhuman|parasites|animals|a disease)\b`, 0.85},
+	{"hate", `(?i)\b(should|must|deserve to) (all )?be (exterminated|eradicated|wiped out|gassed)\b`, 0.95},
+	{"hate", `(?i)\b(inferior|superior) (race|races|people)\b`, 0.7},
+	{"violence", `(?i)\b(i|we)('ll| will| am going to|'m going to) (kill|shoot|stab|murder|hurt) (you|him|her|them)\b`, 0.9},
+	{"violence", `(?i)\b(how to|steps to|instructions for|guide to) (make|build|assemble) (a |an )?(pipe )?(bomb|explosive|ied)\b`, 0.95},
+	{"violence", `(?i)\b(maximi[sz]e|most) (casualties|deaths|damage)\b`, 0.8},
+	{"illicit", `(?i)\b(how to|steps to|recipe for|synthesi[sz]e|cook) (make |making )?(meth(amphetamine)?|fentanyl|heroin|ricin|sarin)\b`, 0.95},
+	{"illicit", `(?i)\b(launder|laundering) (the )?money\b`, 0.6},
+	{"sexual", `(?i)\b(explicit|graphic) sex(ual)? (scene|content|act)s?\b`, 0.7},
+	{"sexual", `(?i)\b(porn|pornographic|nudes)\b`, 0.4},
+}
+
+// compileRules returns the built-in rules and, scoring 1, the extra
+// patterns configured per category
+func compileRules(keywords map[string][]string) ([]rule, error) {
+	rules := make([]rule, 0, len(builtinRules))
+	for _, r := range builtinRules {
+		rules = append(rules, rule{category: r.category, re: regexp.MustCompile(r.pattern), score: r.score})
+	}
+	for category, patterns := range keywords {
+		if !isCategory(category) {
+			return nil, fmt.Errorf("unknown category %q", category)
+		}
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s pattern %q: %w", category, p, err)
+			}
+			rules = append(rules, rule{category: category, re: re, score: 1})
+		}
+	}
+	return rules, nil
+}
+
+// match is where a rule matched, for redaction
+type match struct {
+	category   string
+	start, end int
+}
+
+// scoreKeywords scores each category by its highest-scoring matching rule
+func (m *Moderator) scoreKeywords(content string) (map[string]float64, []match) {
+	scores := make(map[string]float64)
+	var matches []match
+	for _, r := range m.rules {
+		locs := r.re.FindAllStringIndex(content, -1)
+		if len(locs) == 0 {
+			continue
+		}
+		if r.score > scores[r.category] {
+			scores[r.category] = r.score
+		}
+		for _, loc := range locs {
+			matches = append(matches, match{category: r.category, start: loc[0], end: loc[1]})
+		}
+	}
+	return scores, matches
+}
+
+func isCategory(name string) bool {
+	return slices.Contains(Categories, name)
+}
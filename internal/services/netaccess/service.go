@@ -0,0 +1,329 @@
+package netaccess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ErrInvalidCIDR is returned for entries that are neither an address nor a
+// CIDR range
+var ErrInvalidCIDR = errors.New("invalid address or CIDR range")
+
+// ErrNotAllowed is returned for addresses outside the allowlist
+var ErrNotAllowed = errors.New("address not allowed")
+
+// ErrBlockNotFound is returned when removing an unknown block
+var ErrBlockNotFound = errors.New("IP block not found")
+
+const cacheKeyBlocks = "ip_blocks"
+
+// BlockedError is returned for addresses on the denylist
+type BlockedError struct {
+	Block *models.IPBlock // nil for ranges denied in the configuration
+}
+
+func (e *BlockedError) Error() string {
+	if e.Block != nil && e.Block.ExpiresAt != nil {
+		return "address blocked until " + e.Block.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return "address blocked"
+}
+
+// RetryAfter returns how long until the block expires, 0 if it doesn't
+func (e *BlockedError) RetryAfter(now time.Time) time.Duration {
+	if e.Block == nil || e.Block.ExpiresAt == nil {
+		return 0
+	}
+	return max(e.Block.ExpiresAt.Sub(now), 0)
+}
+
+// ParsePrefixes parses addresses and CIDR ranges; an address is a range of
+// one host
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		prefix, err := ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// ParsePrefix parses an address or a CIDR range
+func ParsePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%w: %s", ErrInvalidCIDR, value)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%w: %s", ErrInvalidCIDR, value)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Contains reports whether addr lies in any of the prefixes
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Service decides which client addresses may call GoGuard: the configured
+// allowlist and denylist, blocks managed through the control plane, and
+// temporary blocks of addresses that keep sending requests that get blocked
+type Service struct {
+	repo      *database.Repository
+	cache     cache.Cache
+	allowed   []netip.Prefix
+	denied    []netip.Prefix
+	autoBlock config.AutoBlockConfig
+
+	mu       sync.Mutex
+	blocks   map[string]*models.IPBlock // by ID, used without a database
+	offenses map[netip.Addr][]time.Time
+}
+
+// NewService creates the service; blocks are kept in memory when repo is nil
+func NewService(cfg config.NetworkConfig, repo *database.Repository) (*Service, error) {
+	allowed, err := ParsePrefixes(cfg.AllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("network.allowed_cidrs: %w", err)
+	}
+	denied, err := ParsePrefixes(cfg.DeniedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("network.denied_cidrs: %w", err)
+	}
+	if cfg.AutoBlock.Enabled && (cfg.AutoBlock.Threshold <= 0 || cfg.AutoBlock.Window <= 0 || cfg.AutoBlock.Duration <= 0) {
+		return nil, errors.New("network.auto_block needs a positive threshold, window and duration")
+	}
+	return &Service{
+		repo:      repo,
+		cache:     cache.NewMemory(time.Minute),
+		allowed:   allowed,
+		denied:    denied,
+		autoBlock: cfg.AutoBlock,
+		blocks:    make(map[string]*models.IPBlock),
+		offenses:  make(map[netip.Addr][]time.Time),
+	}, nil
+}
+
+// SetCache replaces the default in-memory cache of stored blocks, e.g. with
+// a Redis cache so blocks reach every replica at once
+func (s *Service) SetCache(c cache.Cache) {
+	s.cache = c
+}
+
+// Check returns ErrNotAllowed or a *BlockedError when requests from ip must
+// be refused. Addresses that can't be parsed are refused only while an
+// allowlist is set.
+func (s *Service) Check(ctx context.Context, ip string) error {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		if len(s.allowed) > 0 {
+			return ErrNotAllowed
+		}
+		return nil
+	}
+	addr = addr.Unmap()
+
+	if len(s.allowed) > 0 && !Contains(s.allowed, addr) {
+		return ErrNotAllowed
+	}
+	if Contains(s.denied, addr) {
+		return &BlockedError{}
+	}
+	blocks, err := s.List(ctx)
+	if err != nil {
+		// The configured lists still apply; a database outage shouldn't
+		// refuse every request
+		log.Warn().Err(err).Msg("Failed to load IP blocks")
+		return nil
+	}
+	for _, b := range blocks {
+		prefix, err := ParsePrefix(b.CIDR)
+		if err == nil && prefix.Contains(addr) {
+			return &BlockedError{Block: b}
+		}
+	}
+	return nil
+}
+
+// List returns the blocks that haven't expired, newest first
+func (s *Service) List(ctx context.Context) ([]*models.IPBlock, error) {
+	now := time.Now()
+	if s.repo == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		blocks := make([]*models.IPBlock, 0, len(s.blocks))
+		for id, b := range s.blocks {
+			if b.ExpiresAt != nil && !now.Before(*b.ExpiresAt) {
+				delete(s.blocks, id)
+				continue
+			}
+			copied := *b
+			blocks = append(blocks, &copied)
+		}
+		slices.SortFunc(blocks, func(a, b *models.IPBlock) int { return b.CreatedAt.Compare(a.CreatedAt) })
+		return blocks, nil
+	}
+
+	var blocks []*models.IPBlock
+	found, err := s.cache.Get(ctx, cacheKeyBlocks, &blocks)
+	if err != nil {
+		log.Warn().Err(err).Msg("IP block cache read failed")
+	}
+	if !found {
+		if blocks, err = s.repo.ListIPBlocks(ctx); err != nil {
+			return nil, err
+		}
+		if err := s.cache.Set(ctx, cacheKeyBlocks, blocks, 0); err != nil {
+			log.Warn().Err(err).Msg("IP block cache write failed")
+		}
+	}
+	// Cached blocks may have run out since
+	active := blocks[:0]
+	for _, b := range blocks {
+		if b.ExpiresAt == nil || now.Before(*b.ExpiresAt) {
+			active = append(active, b)
+		}
+	}
+	return active, nil
+}
+
+// Block refuses requests from b.CIDR, until b.ExpiresAt when set
+func (s *Service) Block(ctx context.Context, b *models.IPBlock) (*models.IPBlock, error) {
+	prefix, err := ParsePrefix(b.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	b.ID = uuid.New().String()
+	b.CIDR = prefix.String()
+	b.CreatedAt = time.Now()
+
+	if s.repo != nil {
+		if err := s.repo.DeleteExpiredIPBlocks(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to delete expired IP blocks")
+		}
+		if err := s.repo.CreateIPBlock(ctx, b); err != nil {
+			return nil, err
+		}
+		s.invalidate(ctx)
+	} else {
+		s.mu.Lock()
+		copied := *b
+		s.blocks[b.ID] = &copied
+		s.mu.Unlock()
+	}
+
+	log.Info().Str("cidr", b.CIDR).Bool("automatic", b.Automatic).Str("reason", b.Reason).Msg("IP address blocked")
+	return b, nil
+}
+
+// Unblock removes a block
+func (s *Service) Unblock(ctx context.Context, id string) error {
+	if s.repo != nil {
+		if err := s.repo.DeleteIPBlock(ctx, id); err != nil {
+			return fmt.Errorf("%w: %s", ErrBlockNotFound, id)
+		}
+		s.invalidate(ctx)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blocks[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrBlockNotFound, id)
+	}
+	delete(s.blocks, id)
+	return nil
+}
+
+// RecordOffense counts a blocked or critical-injection request from ip. It
+// returns the block added when the address reached the auto-block threshold.
+// Offenses are counted per instance.
+func (s *Service) RecordOffense(ctx context.Context, ip string) *models.IPBlock {
+	if !s.autoBlock.Enabled {
+		return nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	now := time.Now()
+	s.mu.Lock()
+	recent := s.offenses[addr][:0]
+	for _, t := range s.offenses[addr] {
+		if now.Sub(t) < s.autoBlock.Window {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	reached := len(recent) >= s.autoBlock.Threshold
+	if reached {
+		delete(s.offenses, addr)
+	} else {
+		s.offenses[addr] = recent
+	}
+	s.pruneOffenses(now)
+	s.mu.Unlock()
+	if !reached {
+		return nil
+	}
+
+	expiresAt := now.Add(s.autoBlock.Duration)
+	block, err := s.Block(ctx, &models.IPBlock{
+		CIDR:      addr.String(),
+		Reason:    fmt.Sprintf("%d blocked requests within %s", s.autoBlock.Threshold, s.autoBlock.Window),
+		Automatic: true,
+		ExpiresAt: &expiresAt,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("ip", addr.String()).Msg("Failed to block IP address")
+		return nil
+	}
+	return block
+}
+
+// pruneOffenses drops the addresses whose offenses are all older than the
+// window, so one-off offenders don't accumulate. The caller must hold s.mu.
+func (s *Service) pruneOffenses(now time.Time) {
+	for addr, times := range s.offenses {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= s.autoBlock.Window {
+			delete(s.offenses, addr)
+		}
+	}
+}
+
+func (s *Service) invalidate(ctx context.Context) {
+	if err := s.cache.Delete(ctx, cacheKeyBlocks); err != nil {
+		log.Warn().Err(err).Msg("IP block cache invalidation failed")
+	}
+}
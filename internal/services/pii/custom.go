@@ -0,0 +1,192 @@
+package pii
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/scan"
+)
+
+// Actions taken on the PII of a type
+const (
+	ActionMask     = "mask"     // replace it as the masking mode says
+	ActionTokenize = "tokenize" // replace it with an opaque token, the same for every occurrence
+	ActionBlock    = "block"    // mask it and refuse the request
+	ActionAllow    = "allow"    // leave it in place; the type isn't looked for
+)
+
+// Limits on custom PII types, each of which is run on every prompt its
+// literals don't rule out
+const (
+	maxCustomPatterns = 100
+	maxPatternLength  = 1000
+)
+
+// ErrInvalidSettings is returned for custom PII types or actions that can't
+// be applied
+var ErrInvalidSettings = errors.New("invalid PII settings")
+
+// customName is the form of custom type names, which are reported like the
+// built-in ones and become part of their masks, e.g. [MASKED_EMPLOYEE_ID]
+var customName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// ruleset is what a masker looks for and what it does with each type. It is
+// replaced whole when custom types or actions change.
+type ruleset struct {
+	patterns map[string]*regexp.Regexp
+	types    []string          // of patterns, sorted
+	set      *scan.Set         // of patterns, in the order of types
+	actions  map[string]string // of the types not masked
+	settings models.PIISettings
+}
+
+// newRuleset combines the enabled built-in types with the settings
+func newRuleset(builtin map[string]*regexp.Regexp, s models.PIISettings) (*ruleset, error) {
+	custom, err := compileSettings(s)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ruleset{
+		patterns: maps.Clone(builtin),
+		actions:  make(map[string]string),
+		settings: models.PIISettings{Patterns: slices.Clone(s.Patterns), Actions: maps.Clone(s.Actions)},
+	}
+	maps.Copy(r.patterns, custom)
+	for piiType, action := range s.Actions {
+		switch action {
+		case ActionAllow:
+			delete(r.patterns, piiType)
+		case ActionTokenize, ActionBlock:
+			r.actions[piiType] = action
+		}
+	}
+
+	for name := range r.patterns {
+		r.types = append(r.types, name)
+	}
+	sort.Strings(r.types)
+	compiled := make([]*regexp.Regexp, len(r.types))
+	for i, name := range r.types {
+		compiled[i] = r.patterns[name]
+	}
+	r.set = scan.NewSet(compiled)
+	return r, nil
+}
+
+// compileSettings checks custom types and actions and returns the compiled
+// custom patterns by type
+func compileSettings(s models.PIISettings) (map[string]*regexp.Regexp, error) {
+	if len(s.Patterns) > maxCustomPatterns {
+		return nil, fmt.Errorf("%w: at most %d custom types", ErrInvalidSettings, maxCustomPatterns)
+	}
+
+	compiled := make(map[string]*regexp.Regexp, len(s.Patterns))
+	for _, p := range s.Patterns {
+		switch {
+		case !customName.MatchString(p.Name):
+			return nil, fmt.Errorf("%w: type name %q must be lower case letters, digits and underscores", ErrInvalidSettings, p.Name)
+		case isBuiltin(p.Name):
+			return nil, fmt.Errorf("%w: %s is a built-in type", ErrInvalidSettings, p.Name)
+		case compiled[p.Name] != nil:
+			return nil, fmt.Errorf("%w: type %s is defined twice", ErrInvalidSettings, p.Name)
+		case len(p.Pattern) > maxPatternLength:
+			return nil, fmt.Errorf("%w: pattern of %s is longer than %d characters", ErrInvalidSettings, p.Name, maxPatternLength)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: pattern of %s: %v", ErrInvalidSettings, p.Name, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("%w: pattern of %s matches empty text", ErrInvalidSettings, p.Name)
+		}
+		compiled[p.Name] = re
+	}
+
+	for piiType, action := range s.Actions {
+		if !isBuiltin(piiType) && compiled[piiType] == nil {
+			return nil, fmt.Errorf("%w: unknown PII type %q", ErrInvalidSettings, piiType)
+		}
+		if !IsAction(action) {
+			return nil, fmt.Errorf("%w: unknown action %q for %s (use %s, %s, %s or %s)",
+				ErrInvalidSettings, action, piiType, ActionMask, ActionTokenize, ActionBlock, ActionAllow)
+		}
+	}
+	return compiled, nil
+}
+
+// ValidateSettings checks custom PII types and actions before they are saved
+func ValidateSettings(s models.PIISettings) error {
+	_, err := compileSettings(s)
+	return err
+}
+
+// IsAction reports whether action is one of the PII actions
+func IsAction(action string) bool {
+	switch action {
+	case ActionMask, ActionTokenize, ActionBlock, ActionAllow:
+		return true
+	}
+	return false
+}
+
+func isBuiltin(piiType string) bool {
+	_, ok := builtinPatterns[piiType]
+	if !ok {
+		_, ok = localePatterns[piiType]
+	}
+	return ok
+}
+
+// BuiltinTypes returns the names of the built-in PII types, sorted
+func BuiltinTypes() []string {
+	types := slices.Collect(maps.Keys(builtinPatterns))
+	for name := range localePatterns {
+		if !slices.Contains(types, name) {
+			types = append(types, name)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// SetCustom replaces the custom PII types and the actions of every type.
+// Requests already being masked finish with the previous ones.
+func (m *Masker) SetCustom(s models.PIISettings) error {
+	r, err := newRuleset(m.builtin, s)
+	if err != nil {
+		return err
+	}
+	m.rules.Store(r)
+	return nil
+}
+
+// Custom returns the custom PII types and actions in effect
+func (m *Masker) Custom() models.PIISettings {
+	s := m.rules.Load().settings
+	return models.PIISettings{Patterns: slices.Clone(s.Patterns), Actions: maps.Clone(s.Actions)}
+}
+
+// replace returns the stand-in for a value of a type handled by action
+func (m *Masker) replace(action, piiType, original string) string {
+	if action == ActionTokenize {
+		return m.pseudonyms.token(piiType, original)
+	}
+	return m.generateMask(piiType, original)
+}
+
+// block marks the report blocked if it holds PII of a type whose action is
+// block
+func (r *ruleset) block(report *models.PIIReport) {
+	for _, match := range report.PIITypes {
+		if r.actions[match.Type] == ActionBlock && !slices.Contains(report.BlockedTypes, match.Type) {
+			report.BlockedTypes = append(report.BlockedTypes, match.Type)
+		}
+	}
+	report.Blocked = len(report.BlockedTypes) > 0
+}
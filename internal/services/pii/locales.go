@@ -0,0 +1,72 @@
+package pii
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Locales are packs of PII types for countries and regions outside the US.
+// International phone numbers and passports appear in every pack.
+var Locales = map[string][]string{
+	"uk": {"uk_nino", "iban", "intl_phone", "intl_passport"},
+	"eu": {"iban", "eu_vat", "intl_phone", "intl_passport"},
+	"ca": {"ca_sin", "intl_phone", "intl_passport"},
+	"in": {"aadhaar", "intl_phone", "intl_passport"},
+}
+
+// localePatterns are the patterns of the locale PII types. A capture group
+// marks the part to mask when the pattern needs context to match.
+var localePatterns = map[string]string{
+	// IBANs, with or without spaces every four characters
+	"iban": `\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`,
+
+	// UK National Insurance numbers
+	"uk_nino": `\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`,
+
+	// Canadian Social Insurance Numbers
+	"ca_sin": `\b\d{3}[ -]?\d{3}[ -]?\d{3}\b`,
+
+	// Indian Aadhaar numbers
+	"aadhaar": `\b[2-9]\d{3}[ -]?\d{4}[ -]?\d{4}\b`,
+
+	// EU VAT identification numbers, in each member state's format
+	"eu_vat": `\b(?:ATU\d{8}|BE[01]\d{9}|BG\d{9,10}|CY\d{8}[A-Z]|CZ\d{8,10}|DE\d{9}|DK\d{8}|EE\d{9}|EL\d{9}|ES[A-Z0-9]\d{7}[A-Z0-9]|FI\d{8}|FR[A-HJ-NP-Z0-9]{2}\d{9}|HR\d{11}|HU\d{8}|IE\d{7}[A-W][A-I]?|IT\d{11}|LT(?:\d{9}|\d{12})|LU\d{8}|LV\d{11}|MT\d{8}|NL\d{9}B\d{2}|PL\d{10}|PT\d{9}|RO\d{2,10}|SE\d{12}|SI\d{8}|SK\d{10})\b`,
+
+	// Phone numbers with a country code
+	"intl_phone": `\+[1-9]\d{0,2}(?:[ .-]?\(?\d{1,4}\)?){2,6}`,
+
+	// Passport numbers of any country, when labelled as such
+	"intl_passport": `(?i)\bpassport(?: (?:no\.?|number|#))?[:# ]*([A-Z0-9]{6,9})\b`,
+}
+
+// WithLocales adds the PII types of locale packs to types. No types means
+// every type, locale ones included, so types are only added to a list.
+func WithLocales(types, locales []string) ([]string, error) {
+	for _, l := range locales {
+		pack, ok := Locales[strings.ToLower(l)]
+		if !ok {
+			return types, fmt.Errorf("unknown PII locale %q (use %s)", l, strings.Join(LocaleNames(), ", "))
+		}
+		if len(types) == 0 {
+			continue
+		}
+		for _, t := range pack {
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types, nil
+}
+
+// LocaleNames returns the locale packs in alphabetical order
+func LocaleNames() []string {
+	names := make([]string, 0, len(Locales))
+	for name := range Locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,106 +1,189 @@
 package pii
 
 import (
+	"crypto/rand"
+	"fmt"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/scan"
 )
 
 // Masker handles PII detection and masking
 type Masker struct {
-	patterns       map[string]*regexp.Regexp
-	enabled        bool
+	builtin        map[string]*regexp.Regexp // enabled built-in types
+	rules          *atomic.Pointer[ruleset]  // shared with copies made by WithMode
+	metrics        *scan.Metrics
+	enabled        *atomic.Bool // shared with copies made by WithMode
 	maskChar       string
 	preserveDomain bool
 	enabledTypes   map[string]bool
+	mode           string
+	pseudonyms     *pseudonymizer
 }
 
 // NewMasker creates a new PII masker
 func NewMasker(piiTypes []string, maskChar string, preserveDomain, enabled bool) *Masker {
 	m := &Masker{
-		patterns:       make(map[string]*regexp.Regexp),
-		enabled:        enabled,
+		builtin:        make(map[string]*regexp.Regexp),
+		rules:          new(atomic.Pointer[ruleset]),
+		enabled:        new(atomic.Bool),
+		metrics:        new(scan.Metrics),
 		maskChar:       maskChar,
 		preserveDomain: preserveDomain,
 		enabledTypes:   make(map[string]bool),
+		mode:           ModeMask,
 	}
+	m.enabled.Store(enabled)
+
+	// Pseudonyms are derived from a random key unless one is configured
+	key := make([]byte, 32)
+	rand.Read(key)
+	m.pseudonyms = &pseudonymizer{key: key, preserveDomain: preserveDomain}
 
 	// Enable specified PII types
 	for _, t := range piiTypes {
 		m.enabledTypes[t] = true
 	}
 
-	// Define PII patterns
-	piiPatterns := map[string]string{
-		// Email addresses
-		"email": `[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`,
+	// Compile enabled patterns
+	for _, patterns := range []map[string]string{builtinPatterns, localePatterns} {
+		for name, pattern := range patterns {
+			if m.enabledTypes[name] || len(piiTypes) == 0 {
+				if re, err := regexp.Compile(pattern); err == nil {
+					m.builtin[name] = re
+				}
+			}
+		}
+	}
+	rules, _ := newRuleset(m.builtin, models.PIISettings{})
+	m.rules.Store(rules)
+
+	return m
+}
 
-		// Phone numbers (various formats)
-		"phone": `(?:\+?1[-.\s]?)?\(?[0-9]{3}\)?[-.\s]?[0-9]{3}[-.\s]?[0-9]{4}`,
+// builtinPatterns are the patterns of the built-in PII types, besides those
+// of the locale packs
+var builtinPatterns = map[string]string{
+	// Email addresses
+	"email": `[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`,
 
-		// Social Security Numbers
-		"ssn": `\b\d{3}[-\s]?\d{2}[-\s]?\d{4}\b`,
+	// Phone numbers (various formats)
+	"phone": `(?:\+?1[-.\s]?)?\(?[0-9]{3}\)?[-.\s]?[0-9]{3}[-.\s]?[0-9]{4}`,
 
-		// Credit card numbers (major providers)
-		"credit_card": `\b(?:4[0-9]{12}(?:[0-9]{3})?|5[1-5][0-9]{14}|3[47][0-9]{13}|6(?:011|5[0-9]{2})[0-9]{12})\b`,
+	// Social Security Numbers
+	"ssn": `\b\d{3}[-\s]?\d{2}[-\s]?\d{4}\b`,
 
-		// IP addresses (IPv4)
-		"ip_address": `\b(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\b`,
+	// Credit card numbers (major providers)
+	"credit_card": `\b(?:4[0-9]{12}(?:[0-9]{3})?|5[1-5][0-9]{14}|3[47][0-9]{13}|6(?:011|5[0-9]{2})[0-9]{12})\b`,
 
-		// IPv6 addresses
-		"ipv6_address": `\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`,
+	// IP addresses (IPv4)
+	"ip_address": `\b(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\b`,
 
-		// Dates of birth (various formats)
-		"date_of_birth": `\b(?:0?[1-9]|1[0-2])[/\-](?:0?[1-9]|[12][0-9]|3[01])[/\-](?:19|20)\d{2}\b`,
+	// IPv6 addresses
+	"ipv6_address": `\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`,
 
-		// US Passport numbers
-		"passport": `\b[A-Z]{1,2}[0-9]{6,9}\b`,
+	// Dates of birth (various formats)
+	"date_of_birth": `\b(?:0?[1-9]|1[0-2])[/\-](?:0?[1-9]|[12][0-9]|3[01])[/\-](?:19|20)\d{2}\b`,
 
-		// Driver's license (generic pattern)
-		"drivers_license": `\b[A-Z]{1,2}[0-9]{5,8}\b`,
+	// US Passport numbers
+	"passport": `\b[A-Z]{1,2}[0-9]{6,9}\b`,
 
-		// Bank account numbers (generic)
-		"bank_account": `\b[0-9]{8,17}\b`,
+	// Driver's license (generic pattern)
+	"drivers_license": `\b[A-Z]{1,2}[0-9]{5,8}\b`,
 
-		// Routing numbers
-		"routing_number": `\b[0-9]{9}\b`,
+	// Bank account numbers (generic)
+	"bank_account": `\b[0-9]{8,17}\b`,
 
-		// AWS access keys
-		"aws_key": `\bAKIA[0-9A-Z]{16}\b`,
+	// Routing numbers
+	"routing_number": `\b[0-9]{9}\b`,
 
-		// AWS secret keys
-		"aws_secret": `\b[A-Za-z0-9/+=]{40}\b`,
+	// AWS access keys. The secrets detector finds these, and the two
+	// patterns below, with fewer false positives.
+	"aws_key": `\bAKIA[0-9A-Z]{16}\b`,
 
-		// API keys (generic pattern)
-		"api_key": `\b[a-zA-Z0-9_\-]{32,64}\b`,
+	// AWS secret keys
+	"aws_secret": `\b[A-Za-z0-9/+=]{40}\b`,
 
-		// Names (basic pattern - first last)
-		"name": `\b[A-Z][a-z]+\s+[A-Z][a-z]+\b`,
+	// API keys (generic pattern)
+	"api_key": `\b[a-zA-Z0-9_\-]{32,64}\b`,
 
-		// Street addresses
-		"address": `\b\d{1,5}\s+[A-Za-z]+\s+(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Drive|Dr|Lane|Ln|Court|Ct|Way|Circle|Cir)\b`,
+	// Names (basic pattern - first last)
+	"name": `\b[A-Z][a-z]+\s+[A-Z][a-z]+\b`,
 
-		// ZIP codes
-		"zip_code": `\b\d{5}(?:-\d{4})?\b`,
+	// Street addresses
+	"address": `\b\d{1,5}\s+[A-Za-z]+\s+(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Drive|Dr|Lane|Ln|Court|Ct|Way|Circle|Cir)\b`,
 
-		// Medical record numbers (generic)
-		"medical_record": `\bMRN[:\s]?[0-9]{6,10}\b`,
+	// ZIP codes
+	"zip_code": `\b\d{5}(?:-\d{4})?\b`,
 
-		// Health insurance IDs
-		"health_insurance_id": `\b[A-Z]{3}[0-9]{9}\b`,
+	// Medical record numbers (generic)
+	"medical_record": `\bMRN[:\s]?[0-9]{6,10}\b`,
+
+	// Health insurance IDs
+	"health_insurance_id": `\b[A-Z]{3}[0-9]{9}\b`,
+}
+
+// SetPseudonymKey sets the key pseudonyms are derived from. The same value
+// always gets the same pseudonym under the same key.
+func (m *Masker) SetPseudonymKey(key []byte) {
+	if len(key) > 0 {
+		m.pseudonyms = &pseudonymizer{key: key, preserveDomain: m.preserveDomain}
 	}
+}
 
-	// Compile enabled patterns
-	for name, pattern := range piiPatterns {
-		if m.enabledTypes[name] || len(piiTypes) == 0 {
-			if re, err := regexp.Compile(pattern); err == nil {
-				m.patterns[name] = re
-			}
-		}
+// SetEnabled turns PII masking on or off while requests are served
+func (m *Masker) SetEnabled(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// SetMode sets how PII is replaced: masked, or with realistic fake values
+func (m *Masker) SetMode(mode string) error {
+	switch mode {
+	case ModeMask, ModePseudonymize:
+		m.mode = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown PII mode %q (use %s or %s)", mode, ModeMask, ModePseudonymize)
+	}
+}
+
+// WithMode returns a copy of the masker replacing PII in the given mode
+func (m *Masker) WithMode(mode string) (*Masker, error) {
+	masker := *m
+	if err := masker.SetMode(mode); err != nil {
+		return nil, err
 	}
+	return &masker, nil
+}
 
-	return m
+// Mode returns how PII is replaced
+func (m *Masker) Mode() string {
+	return m.mode
+}
+
+// Types returns the PII types the masker detects, custom ones included.
+// Configured types without a pattern are ignored, so they are missing here,
+// as are types whose action is allow.
+func (m *Masker) Types() []string {
+	return slices.Clone(m.rules.Load().types)
+}
+
+// PatternID returns the pattern ID of a PII type, under which feedback on
+// its matches is counted
+func PatternID(piiType string) string {
+	return "pii_" + piiType
+}
+
+// Stats returns the time spent scanning texts for PII and how many patterns
+// the prefilter spared
+func (m *Masker) Stats() scan.Stats {
+	return m.metrics.Stats(len(m.rules.Load().types))
 }
 
 // Mask processes messages and masks detected PII
@@ -112,69 +195,177 @@ func (m *Masker) Mask(messages []models.Message) ([]models.Message, *models.PIIR
 		MaskedCount: 0,
 	}
 
-	if !m.enabled {
+	if !m.enabled.Load() {
 		return messages, report
 	}
 
+	// Custom patterns may change meanwhile; the request is masked with one set
+	r := m.rules.Load()
 	maskedMessages := make([]models.Message, len(messages))
 
 	for i, msg := range messages {
-		maskedContent, matches := m.maskContent(msg.Content, formatLocation(i, msg.Role))
+		location := formatLocation(i, msg.Role)
+		toolCalls := m.maskToolCalls(r, msg.ToolCalls, location, report)
+		if len(msg.Parts) == 0 {
+			maskedContent, matches := m.maskContent(r, msg.Content, location)
+			maskedMessages[i] = models.Message{
+				Role:       msg.Role,
+				Content:    maskedContent,
+				ToolCalls:  toolCalls,
+				ToolCallID: msg.ToolCallID,
+				Name:       msg.Name,
+			}
+			report.PIITypes = append(report.PIITypes, matches...)
+			continue
+		}
+
+		// Text parts are masked one by one; image parts pass through
+		parts := make([]models.ContentPart, len(msg.Parts))
+		for j, part := range msg.Parts {
+			if part.Type == models.PartText {
+				var matches []models.PIIMatch
+				part.Text, matches = m.maskContent(r, part.Text, location)
+				report.PIITypes = append(report.PIITypes, matches...)
+			}
+			parts[j] = part
+		}
 		maskedMessages[i] = models.Message{
-			Role:    msg.Role,
-			Content: maskedContent,
+			Role:       msg.Role,
+			Content:    models.JoinText(parts),
+			Parts:      parts,
+			ToolCalls:  toolCalls,
+			ToolCallID: msg.ToolCallID,
+			Name:       msg.Name,
 		}
-		report.PIITypes = append(report.PIITypes, matches...)
 	}
 
 	report.PIICount = len(report.PIITypes)
 	report.PIIDetected = report.PIICount > 0
 	report.MaskedCount = report.PIICount
+	r.block(report)
 
 	return maskedMessages, report
 }
 
-// maskContent masks PII in a single content string
-func (m *Masker) maskContent(content, location string) (string, []models.PIIMatch) {
-	matches := []models.PIIMatch{}
-	result := content
-
-	for piiType, pattern := range m.patterns {
-		allMatches := pattern.FindAllStringIndex(result, -1)
+// maskToolCalls masks the arguments of an assistant message's tool calls
+func (m *Masker) maskToolCalls(r *ruleset, calls []models.ToolCall, location string, report *models.PIIReport) []models.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	masked := make([]models.ToolCall, len(calls))
+	for i, call := range calls {
+		var matches []models.PIIMatch
+		call.Function.Arguments, matches = m.maskContent(r, call.Function.Arguments, location+".tool_calls["+call.Function.Name+"]")
+		report.PIITypes = append(report.PIITypes, matches...)
+		masked[i] = call
+	}
+	return masked
+}
 
-		// Process matches in reverse order to maintain positions
-		for i := len(allMatches) - 1; i >= 0; i-- {
-			match := allMatches[i]
+// maskContent masks PII in a single content string
+func (m *Masker) maskContent(r *ruleset, content, location string) (string, []models.PIIMatch) {
+	start := time.Now()
+	candidates := r.set.Candidates(content)
+	defer func() {
+		m.metrics.Record(len(content), len(candidates), len(r.types)-len(candidates), time.Since(start))
+	}()
+
+	// Every type that could match is matched against the original text, and
+	// where matches overlap one is kept, so no replacement is itself matched
+	// again
+	var found []span
+	for _, t := range candidates {
+		piiType := r.types[t]
+		for _, match := range r.patterns[piiType].FindAllStringSubmatchIndex(content, -1) {
 			start, end := match[0], match[1]
-			originalValue := result[start:end]
+			if len(match) >= 4 && match[2] >= 0 {
+				// Only the captured part is PII; the rest is context
+				start, end = match[2], match[3]
+			}
+			value := content[start:end]
 
 			// Skip if it looks like a false positive
-			if m.isFalsePositive(piiType, originalValue) {
+			if m.isFalsePositive(piiType, value) {
 				continue
 			}
 
-			maskedValue := m.generateMask(piiType, originalValue)
-
-			piiMatch := models.PIIMatch{
-				Type:          piiType,
-				OriginalValue: originalValue,
-				MaskedValue:   maskedValue,
-				Location:      location,
-				StartPosition: start,
-				EndPosition:   end,
+			// Types with a checksum must pass it to be reported
+			var validated *bool
+			if valid, ok := validators[piiType]; ok {
+				if !valid(value) {
+					continue
+				}
+				validated = &ok
 			}
-			matches = append(matches, piiMatch)
+			found = append(found, span{piiType: piiType, start: start, end: end, validated: validated})
+		}
+	}
+	if len(found) == 0 {
+		return content, []models.PIIMatch{}
+	}
 
-			// Replace in result
-			result = result[:start] + maskedValue + result[end:]
+	// Checksummed matches win over the looser patterns, then longer ones
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if (a.validated != nil) != (b.validated != nil) {
+			return a.validated != nil
 		}
+		return a.end-a.start > b.end-b.start
+	})
+	var kept []span
+	for _, s := range found {
+		if !overlaps(kept, s) {
+			kept = append(kept, s)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].start < kept[j].start })
+
+	matches := make([]models.PIIMatch, 0, len(kept))
+	var b strings.Builder
+	last := 0
+	for _, s := range kept {
+		originalValue := content[s.start:s.end]
+		maskedValue := m.replace(r.actions[s.piiType], s.piiType, originalValue)
+		matches = append(matches, models.PIIMatch{
+			Type:             s.piiType,
+			OriginalValue:    originalValue,
+			MaskedValue:      maskedValue,
+			Location:         location,
+			StartPosition:    s.start,
+			EndPosition:      s.end,
+			ValidationPassed: s.validated,
+		})
+		b.WriteString(content[last:s.start])
+		b.WriteString(maskedValue)
+		last = s.end
 	}
+	b.WriteString(content[last:])
+
+	return b.String(), matches
+}
+
+// span is a PII match in a text
+type span struct {
+	piiType    string
+	start, end int
+	validated  *bool
+}
 
-	return result, matches
+func overlaps(spans []span, s span) bool {
+	for _, o := range spans {
+		if s.start < o.end && o.start < s.end {
+			return true
+		}
+	}
+	return false
 }
 
 // generateMask creates a masked version of the PII
 func (m *Masker) generateMask(piiType, original string) string {
+	if m.mode == ModePseudonymize {
+		return m.pseudonyms.pseudonym(piiType, original)
+	}
+
 	maskChar := m.maskChar
 	if maskChar == "" {
 		maskChar = "*"
@@ -288,17 +479,19 @@ func (m *Masker) Analyze(messages []models.Message) *models.PIIReport {
 		PIITypes:    []models.PIIMatch{},
 	}
 
-	if !m.enabled {
+	if !m.enabled.Load() {
 		return report
 	}
 
+	r := m.rules.Load()
 	for i, msg := range messages {
-		_, matches := m.maskContent(msg.Content, formatLocation(i, msg.Role))
+		_, matches := m.maskContent(r, msg.Content, formatLocation(i, msg.Role))
 		report.PIITypes = append(report.PIITypes, matches...)
 	}
 
 	report.PIICount = len(report.PIITypes)
 	report.PIIDetected = report.PIICount > 0
+	r.block(report)
 
 	return report
 }
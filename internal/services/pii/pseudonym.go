@@ -0,0 +1,213 @@
+package pii
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// Masking modes
+const (
+	ModeMask         = "mask"         // replace PII with mask characters or [MASKED_<TYPE>]
+	ModePseudonymize = "pseudonymize" // replace PII with realistic fake values
+)
+
+// pseudonymizer replaces PII with fake values of the same shape. Each fake is
+// drawn from a generator seeded with an HMAC of the original value, so under
+// one key a value always gets the same pseudonym: in every message of a
+// conversation and in every later turn. Without the key the fakes can't be
+// traced back.
+type pseudonymizer struct {
+	key            []byte
+	preserveDomain bool
+}
+
+var (
+	firstNames = []string{
+		"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+		"David", "Elizabeth", "William", "Barbara", "Richard", "Susan", "Joseph", "Jessica",
+		"Thomas", "Sarah", "Daniel", "Karen", "Matthew", "Nancy", "Anthony", "Lisa",
+	}
+	lastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+		"Rodriguez", "Martinez", "Wilson", "Anderson", "Taylor", "Thomas", "Moore", "Jackson",
+		"Martin", "Lee", "Thompson", "White", "Harris", "Clark", "Lewis", "Walker",
+	}
+	streetNames = []string{
+		"Oak", "Maple", "Cedar", "Pine", "Elm", "Lake", "Hill", "Park",
+		"Sunset", "River", "Willow", "Church", "Meadow", "Forest", "Spring", "Highland",
+	}
+
+	// Domains and address ranges reserved for documentation (RFC 2606,
+	// RFC 5737, RFC 3849), so a fake never reaches a real mailbox or host
+	fakeDomains = []string{"example.com", "example.org", "example.net"}
+	fakeIPv4    = []string{"192.0.2", "198.51.100", "203.0.113"}
+)
+
+// maxAttempts bounds the draws for a fake that passes its type's checksum
+const maxAttempts = 1000
+
+// rand returns the generator for one value
+func (p *pseudonymizer) rand(piiType, original string) *rand.Rand {
+	var seed [32]byte
+	copy(seed[:], p.mac(piiType, original))
+	return rand.New(rand.NewChaCha8(seed))
+}
+
+// mac returns the HMAC of a value under the key. Emails are
+// case-insensitive, so they are hashed in lower case.
+func (p *pseudonymizer) mac(piiType, original string) []byte {
+	if piiType == "email" {
+		original = strings.ToLower(original)
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(piiType))
+	mac.Write([]byte{0})
+	mac.Write([]byte(original))
+	return mac.Sum(nil)
+}
+
+// token returns an opaque stand-in for original, the same for every
+// occurrence of the value under one key, such as [TOKEN_EMAIL_3f9a1c2b7d4e]
+func (p *pseudonymizer) token(piiType, original string) string {
+	return "[TOKEN_" + strings.ToUpper(piiType) + "_" + hex.EncodeToString(p.mac(piiType, original)[:6]) + "]"
+}
+
+// pseudonym returns the fake value standing in for original
+func (p *pseudonymizer) pseudonym(piiType, original string) string {
+	r := p.rand(piiType, original)
+
+	switch piiType {
+	case "email":
+		first, last := pick(r, firstNames), pick(r, lastNames)
+		domain := pick(r, fakeDomains)
+		if _, d, ok := strings.Cut(original, "@"); ok && p.preserveDomain {
+			domain = d
+		}
+		return strings.ToLower(first+"."+last) + "@" + domain
+
+	case "name":
+		return pick(r, firstNames) + " " + pick(r, lastNames)
+
+	case "address":
+		// Keep the house number's length and the street suffix
+		fields := strings.Fields(original)
+		return reshape(r, fields[0], false) + " " + pick(r, streetNames) + " " + fields[len(fields)-1]
+
+	case "ip_address":
+		return fmt.Sprintf("%s.%d", pick(r, fakeIPv4), 1+r.IntN(254))
+
+	case "ipv6_address":
+		groups := []string{"2001", "db8"}
+		for range 6 {
+			groups = append(groups, fmt.Sprintf("%x", r.IntN(0x10000)))
+		}
+		return strings.Join(groups, ":")
+
+	case "date_of_birth":
+		return fakeDate(r, original)
+
+	case "iban":
+		return fakeIBAN(r, original)
+
+	case "credit_card":
+		// Keep the issuer prefix so the card network stays the same
+		keep := 2
+		if strings.HasPrefix(original, "6011") {
+			keep = 4
+		}
+		return checked(r, piiType, original, func() string {
+			return original[:keep] + reshape(r, original[keep:], false)
+		})
+
+	case "aws_key":
+		return original[:4] + reshape(r, original[4:], true)
+
+	case "aws_secret", "api_key":
+		return reshape(r, original, true)
+
+	default:
+		// Identifiers keep their letters, which are mostly prefixes such as
+		// country codes, and get new digits
+		return checked(r, piiType, original, func() string {
+			return reshape(r, original, false)
+		})
+	}
+}
+
+// checked draws fakes until one passes the type's checksum, if it has one,
+// so fakes look as real to the LLM as the values they replace
+func checked(r *rand.Rand, piiType, original string, draw func() string) string {
+	valid, ok := validators[piiType]
+	if !ok {
+		return draw()
+	}
+	for range maxAttempts {
+		if fake := draw(); valid(fake) {
+			return fake
+		}
+	}
+	return "[MASKED_" + strings.ToUpper(piiType) + "]"
+}
+
+// reshape replaces the digits of s with random ones, and its letters too if
+// asked, keeping case, separators and length. The first digit stays nonzero
+// so numbers don't look truncated.
+func reshape(r *rand.Rand, s string, letters bool) string {
+	b := []byte(s)
+	first := true
+	for i, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			if first {
+				b[i] = byte('1' + r.IntN(9))
+				first = false
+			} else {
+				b[i] = byte('0' + r.IntN(10))
+			}
+		case letters && c >= 'a' && c <= 'z':
+			b[i] = byte('a' + r.IntN(26))
+		case letters && c >= 'A' && c <= 'Z':
+			b[i] = byte('A' + r.IntN(26))
+		}
+	}
+	return string(b)
+}
+
+// fakeDate returns a real date within two years of original, written the
+// same way
+func fakeDate(r *rand.Rand, original string) string {
+	sep := "/"
+	if strings.Contains(original, "-") {
+		sep = "-"
+	}
+	parts := strings.Split(original, sep)
+	if len(parts) != 3 {
+		return reshape(r, original, false)
+	}
+	year := 0
+	fmt.Sscanf(parts[2], "%d", &year)
+	month, day := 1+r.IntN(12), 1+r.IntN(28)
+	year += r.IntN(5) - 2
+	return fmt.Sprintf("%0*d%s%0*d%s%d", len(parts[0]), month, sep, len(parts[1]), day, sep, year)
+}
+
+// fakeIBAN keeps an IBAN's country and spacing, replaces the digits of its
+// account number and recomputes the check digits
+func fakeIBAN(r *rand.Rand, original string) string {
+	bban := reshape(r, original[4:], false)
+	for check := 2; check <= 98; check++ {
+		fake := fmt.Sprintf("%s%02d%s", original[:2], check, bban)
+		if validIBAN(fake) {
+			return fake
+		}
+	}
+	return "[MASKED_IBAN]"
+}
+
+func pick(r *rand.Rand, values []string) string {
+	return values[r.IntN(len(values))]
+}
@@ -0,0 +1,168 @@
+package pii
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// validators reject matches of a pattern that fail the type's checksum or
+// numbering rules. Matches of these types are reported with
+// validation_passed set.
+var validators = map[string]func(string) bool{
+	"credit_card":    validCard,
+	"ssn":            validSSN,
+	"routing_number": validRoutingNumber,
+	"iban":           validIBAN,
+	"uk_nino":        validNINO,
+	"ca_sin":         validSIN,
+	"aadhaar":        validAadhaar,
+	"intl_phone":     validIntlPhone,
+}
+
+// validCard checks a card number's Luhn digit
+func validCard(value string) bool {
+	return luhn(onlyDigits(value))
+}
+
+// validSSN rejects numbers the SSA never issues: area 000, 666 or 900-999,
+// group 00 and serial 0000
+func validSSN(value string) bool {
+	digits := onlyDigits(value)
+	if len(digits) != 9 {
+		return false
+	}
+	area, group, serial := digits[:3], digits[3:5], digits[5:]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validRoutingNumber checks an ABA routing number's check digit: digits
+// weighted 3, 7, 1 repeating sum to a multiple of 10
+func validRoutingNumber(value string) bool {
+	digits := onlyDigits(value)
+	if len(digits) != 9 {
+		return false
+	}
+	weights := [3]int{3, 7, 1}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(digits[i]-'0') * weights[i%3]
+	}
+	return sum%10 == 0
+}
+
+// ibanLengths are the IBAN lengths of the countries using them
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24,
+	"FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28, "HR": 21,
+	"HU": 28, "IE": 22, "IL": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LI": 21,
+	"LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19, "MR": 27, "MT": 31, "MU": 30,
+	"NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24,
+	"SE": 24, "SI": 19, "SK": 24, "SM": 27, "TN": 24, "TR": 26, "UA": 29, "VG": 24, "XK": 20,
+}
+
+// validIBAN checks an IBAN's length for its country and its mod-97 check
+// digits
+func validIBAN(value string) bool {
+	iban := strings.ReplaceAll(value, " ", "")
+	if n, ok := ibanLengths[iban[:2]]; !ok || len(iban) != n {
+		return false
+	}
+
+	// Move the country and check digits to the end and turn letters into
+	// numbers, A = 10 to Z = 35
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validNINO rejects the prefixes HMRC never issues
+func validNINO(value string) bool {
+	switch strings.ToUpper(value[:2]) {
+	case "BG", "GB", "KN", "NK", "NT", "TN", "ZZ":
+		return false
+	}
+	return true
+}
+
+// validSIN checks a SIN's Luhn digit. SINs starting with 0 or 8 aren't issued
+// to people.
+func validSIN(value string) bool {
+	digits := onlyDigits(value)
+	return len(digits) == 9 && digits[0] != '0' && digits[0] != '8' && luhn(digits)
+}
+
+// validAadhaar checks an Aadhaar number's Verhoeff check digit
+func validAadhaar(value string) bool {
+	digits := onlyDigits(value)
+	return len(digits) == 12 && verhoeff(digits)
+}
+
+// validIntlPhone checks that a number has as many digits as E.164 allows
+func validIntlPhone(value string) bool {
+	n := len(onlyDigits(value))
+	return n >= 8 && n <= 15
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// luhn checks the Luhn (mod 10) check digit of a digit string
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Verhoeff's dihedral group tables
+var (
+	verhoeffD = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, {1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6}, {3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8}, {5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2}, {7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4}, {9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffP = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, {1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2}, {8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0}, {4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5}, {7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// verhoeff checks the Verhoeff check digit of a digit string
+func verhoeff(digits string) bool {
+	c := 0
+	for i := 0; i < len(digits); i++ {
+		d := int(digits[len(digits)-1-i] - '0')
+		c = verhoeffD[c][verhoeffP[i%8][d]]
+	}
+	return c == 0
+}
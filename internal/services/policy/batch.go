@@ -0,0 +1,202 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// ErrBatchRejected is returned when an item of a batch is invalid. Nothing
+// of the batch is created.
+var ErrBatchRejected = errors.New("batch rejected")
+
+// Batch item statuses
+const (
+	BatchCreated = "created"
+	BatchInvalid = "invalid"
+	BatchValid   = "valid" // valid, but not created as other items are invalid
+)
+
+// BatchResult is the outcome of one item of a batch, in request order
+type BatchResult struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"` // policy name or user email
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchStore is implemented by stores that can save several new policies
+// and their versions in one transaction
+type BatchStore interface {
+	SavePolicyBatch(ctx context.Context, policies []*models.Policy, versions []models.PolicyVersion) error
+}
+
+// CreatePolicies creates all of the policies or none of them. Invalid
+// policies are reported in the results along with ErrBatchRejected. With a
+// batch store the policies are saved in one transaction before they take
+// effect.
+func (e *Engine) CreatePolicies(ctx context.Context, policies []*models.Policy) ([]BatchResult, error) {
+	results := make([]BatchResult, len(policies))
+	seen := make(map[string]int, len(policies))
+	invalid := 0
+
+	e.mu.RLock()
+	for i, p := range policies {
+		results[i] = BatchResult{Index: i, ID: p.ID, Name: p.Name, Status: BatchValid}
+		err := validatePolicy(p)
+		if err == nil && p.ID != "" {
+			if _, exists := e.policies[p.ID]; exists {
+				err = fmt.Errorf("policy %s already exists", p.ID)
+			} else if first, dup := seen[p.ID]; dup {
+				err = fmt.Errorf("duplicate of item %d", first)
+			}
+			seen[p.ID] = i
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = BatchInvalid, err.Error()
+			invalid++
+		}
+	}
+	e.mu.RUnlock()
+	if invalid > 0 {
+		return results, fmt.Errorf("%w: %d of %d policies are invalid", ErrBatchRejected, invalid, len(policies))
+	}
+
+	now := time.Now()
+	actor := actorFromContext(ctx)
+	versions := make([]models.PolicyVersion, len(policies))
+	for i, p := range policies {
+		if p.ID == "" {
+			p.ID = uuid.New().String()
+		}
+		if p.CreatedBy == "" {
+			p.CreatedBy = actor
+		}
+		p.TenantID = tenant.Assign(ctx, p.TenantID)
+		p.CreatedAt, p.UpdatedAt, p.Version = now, now, 1
+		versions[i] = models.PolicyVersion{
+			PolicyID:   p.ID,
+			Version:    1,
+			ChangeType: models.PolicyChangeCreate,
+			ChangedBy:  actor,
+			Policy:     *p,
+			CreatedAt:  now,
+		}
+	}
+
+	batchStore, atomic := e.store.(BatchStore)
+	if atomic {
+		if err := batchStore.SavePolicyBatch(ctx, policies, versions); err != nil {
+			return nil, fmt.Errorf("save policies: %w", err)
+		}
+	}
+
+	e.mu.Lock()
+	for i, p := range policies {
+		e.policies[p.ID] = p
+		e.versions[p.ID] = []models.PolicyVersion{versions[i]}
+		results[i].ID, results[i].Status = p.ID, BatchCreated
+	}
+	e.mu.Unlock()
+
+	if !atomic {
+		for i := range versions {
+			e.persist(ctx, versions[i:i+1])
+		}
+	}
+
+	log.Info().Int("policies", len(policies)).Msg("Policies created in batch")
+	return results, nil
+}
+
+// validatePolicy runs the checks CreatePolicy applies
+func validatePolicy(p *models.Policy) error {
+	if err := ValidateRules(p.Rules); err != nil {
+		return err
+	}
+	if err := ValidateSystemPrompt(p.Config); err != nil {
+		return err
+	}
+	if err := ValidateTopics(p.Type, p.Config, p.Actions); err != nil {
+		return err
+	}
+	if err := ValidateInjection(p.Config); err != nil {
+		return err
+	}
+	if err := ValidateContext(p.Config); err != nil {
+		return err
+	}
+	if err := ValidateRollout(p.Config); err != nil {
+		return err
+	}
+	return ValidateRouting(p.Type, p.Config)
+}
+
+// CreateUsers creates all of the users or none of them. Every user needs an
+// email that no other user has; invalid users are reported in the results
+// along with ErrBatchRejected.
+func (e *Engine) CreateUsers(ctx context.Context, users []*models.User) ([]BatchResult, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	emails := make(map[string]string, len(e.users)+len(users))
+	for _, u := range e.users {
+		emails[strings.ToLower(u.Email)] = "user " + u.ID
+	}
+	ids := make(map[string]int, len(users))
+
+	results := make([]BatchResult, len(users))
+	invalid := 0
+	for i, u := range users {
+		results[i] = BatchResult{Index: i, ID: u.ID, Name: u.Email, Status: BatchValid}
+		email := strings.ToLower(strings.TrimSpace(u.Email))
+		var err error
+		switch {
+		case email == "":
+			err = errors.New("email is required")
+		case emails[email] != "":
+			err = fmt.Errorf("email is already used by %s", emails[email])
+		case u.ID != "" && e.users[u.ID] != nil:
+			err = fmt.Errorf("user %s already exists", u.ID)
+		}
+		if u.ID != "" {
+			if first, dup := ids[u.ID]; dup && err == nil {
+				err = fmt.Errorf("duplicate of item %d", first)
+			}
+			ids[u.ID] = i
+		}
+		if email != "" && emails[email] == "" {
+			emails[email] = fmt.Sprintf("item %d", i)
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = BatchInvalid, err.Error()
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return results, fmt.Errorf("%w: %d of %d users are invalid", ErrBatchRejected, invalid, len(users))
+	}
+
+	now := time.Now()
+	for i, u := range users {
+		if u.ID == "" {
+			u.ID = uuid.New().String()
+		}
+		u.TenantID = tenant.Assign(ctx, u.TenantID)
+		u.CreatedAt = now
+		e.users[u.ID] = u
+		results[i].ID, results[i].Status = u.ID, BatchCreated
+	}
+
+	log.Info().Int("users", len(users)).Msg("Users created in batch")
+	return results, nil
+}
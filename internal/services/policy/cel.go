@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidPolicy is returned when a policy fails validation, such as a rule
+// expression that does not compile
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// celCostLimit bounds the work a single expression may do per evaluation so
+// a pathological rule can't stall the request path
+const celCostLimit = 100000
+
+// celEnv declares the variables available to expression rules:
+//
+//	user_id, model, provider, content_type  string
+//	token_count                              int
+//	cost                                     double
+//	metadata                                 map(string, dyn)
+//	aggregates                               map(string, double), e.g. aggregates.spend_daily
+//	now                                      timestamp
+//	hour, day_of_week                        int (UTC; Sunday is 0)
+var celEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("user_id", cel.StringType),
+		cel.Variable("model", cel.StringType),
+		cel.Variable("provider", cel.StringType),
+		cel.Variable("content_type", cel.StringType),
+		cel.Variable("token_count", cel.IntType),
+		cel.Variable("cost", cel.DoubleType),
+		cel.Variable("metadata", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("aggregates", cel.MapType(cel.StringType, cel.DoubleType)),
+		cel.Variable("now", cel.TimestampType),
+		cel.Variable("hour", cel.IntType),
+		cel.Variable("day_of_week", cel.IntType),
+		ext.Strings(),
+	)
+})
+
+// celPrograms caches compiled expressions; rules are evaluated on every
+// request but change rarely
+type celPrograms struct {
+	programs map[string]cel.Program
+	mu       sync.RWMutex
+}
+
+func newCELPrograms() *celPrograms {
+	return &celPrograms{programs: make(map[string]cel.Program)}
+}
+
+// get returns the compiled program for an expression, compiling it on first use
+func (p *celPrograms) get(expression string) (cel.Program, error) {
+	p.mu.RLock()
+	prg, ok := p.programs[expression]
+	p.mu.RUnlock()
+	if ok {
+		return prg, nil
+	}
+
+	prg, err := compileExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.programs[expression] = prg
+	p.mu.Unlock()
+	return prg, nil
+}
+
+// compileExpression type-checks an expression and ensures it yields a bool
+func compileExpression(expression string) (cel.Program, error) {
+	env, err := celEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must evaluate to bool, got %s", ast.OutputType())
+	}
+
+	return env.Program(ast, cel.CostLimit(celCostLimit))
+}
+
+// ValidateRules checks that every rule in a policy can be evaluated
+func ValidateRules(rules []models.PolicyRule) error {
+	for i, rule := range rules {
+		if rule.Type != models.RuleTypeExpression {
+			continue
+		}
+		if rule.Expression == "" {
+			return fmt.Errorf("%w: rules[%d]: expression is required", ErrInvalidPolicy, i)
+		}
+		if _, err := compileExpression(rule.Expression); err != nil {
+			return fmt.Errorf("%w: rules[%d]: %v", ErrInvalidPolicy, i, err)
+		}
+	}
+	return nil
+}
+
+// evaluateExpression runs an expression rule against a request. Evaluation
+// errors, such as reading a missing metadata key, count as no match.
+func (e *Engine) evaluateExpression(rule models.PolicyRule, req *EvaluationRequest) bool {
+	prg, err := e.celPrograms.get(rule.Expression)
+	if err != nil {
+		log.Warn().Err(err).Str("rule_id", rule.ID).Msg("Skipping rule with invalid expression")
+		return false
+	}
+
+	out, _, err := prg.Eval(e.expressionVariables(req))
+	if err != nil {
+		log.Debug().Err(err).Str("rule_id", rule.ID).Msg("Expression rule evaluation failed")
+		return false
+	}
+
+	matched, ok := out.Value().(bool)
+	return ok && matched
+}
+
+// expressionVariables builds the activation for an expression rule; the
+// caller must hold e.mu
+func (e *Engine) expressionVariables(req *EvaluationRequest) map[string]interface{} {
+	now := time.Now().UTC()
+
+	metadata := req.Metadata
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	// Current spend per limit window, overridable by caller-supplied aggregates
+	aggregates := make(map[string]float64)
+	for _, limit := range e.spendingLimits {
+		if limit.UserID == req.UserID {
+			aggregates["spend_"+limit.LimitType] = limit.CurrentSpend
+		}
+	}
+	for k, v := range req.Aggregates {
+		aggregates[k] = v
+	}
+
+	return map[string]interface{}{
+		"user_id":      req.UserID,
+		"model":        req.Model,
+		"provider":     req.Provider,
+		"content_type": req.ContentType,
+		"token_count":  req.TokenCount,
+		"cost":         req.Cost,
+		"metadata":     metadata,
+		"aggregates":   aggregates,
+		"now":          now,
+		"hour":         now.Hour(),
+		"day_of_week":  int(now.Weekday()),
+	}
+}
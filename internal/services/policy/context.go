@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Context strategies, for conversations over a policy's context budget
+const (
+	ContextTrim      = "trim"      // drop the oldest turns
+	ContextSummarize = "summarize" // replace the oldest turns with a summary
+)
+
+// ContextBudget is the most prompt tokens a policy lets a conversation be
+// forwarded with, and how it is shortened to fit
+type ContextBudget struct {
+	PolicyID       string `json:"policy_id"`
+	PolicyName     string `json:"policy_name"`
+	Tokens         int    `json:"tokens"`
+	Strategy       string `json:"strategy"`
+	SummaryProfile string `json:"summary_profile,omitempty"`
+}
+
+// ValidateContext checks a policy's context budget and strategy
+func ValidateContext(cfg models.PolicyConfig) error {
+	if cfg.ContextBudget < 0 {
+		return fmt.Errorf("%w: context_budget must be positive", ErrInvalidPolicy)
+	}
+	switch cfg.ContextStrategy {
+	case "", ContextTrim, ContextSummarize:
+	default:
+		return fmt.Errorf("%w: context_strategy must be %s or %s", ErrInvalidPolicy, ContextTrim, ContextSummarize)
+	}
+	if cfg.ContextBudget == 0 && (cfg.ContextStrategy != "" || cfg.SummaryProfile != "") {
+		return fmt.Errorf("%w: context_strategy and summary_profile need a context_budget", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// ContextBudgetFor returns the smallest context budget of the active
+// policies targeting the user and model, or nil if none of them sets one. Of
+// policies setting the same budget, the first in priority order is used.
+func (e *Engine) ContextBudgetFor(ctx context.Context, userID, provider, model string) *ContextBudget {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	var smallest *ContextBudget
+	for _, policy := range activePolicies {
+		tokens := policy.Config.ContextBudget
+		if tokens <= 0 || (smallest != nil && tokens >= smallest.Tokens) {
+			continue
+		}
+		if !e.policyTargetsUser(policy, userID) || !policyTargetsModel(policy, provider, model) {
+			continue
+		}
+		strategy := policy.Config.ContextStrategy
+		if strategy == "" {
+			strategy = ContextTrim
+		}
+		smallest = &ContextBudget{
+			PolicyID:       policy.ID,
+			PolicyName:     policy.Name,
+			Tokens:         tokens,
+			Strategy:       strategy,
+			SummaryProfile: policy.Config.SummaryProfile,
+		}
+	}
+	return smallest
+}
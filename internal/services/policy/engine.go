@@ -3,10 +3,15 @@ package policy
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/quota"
+	"github.com/epps11/goguard/internal/tenant"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
@@ -17,31 +22,82 @@ type Engine struct {
 	spendingLimits map[string]*models.SpendingLimit
 	users          map[string]*models.User
 	groups         map[string]*models.Group
+	versions       map[string][]models.PolicyVersion
+	store          Store
+	celPrograms    *celPrograms
+	opa            *OPA
 	mu             sync.RWMutex
+
+	// Soft-deleted policies and users are kept apart until restored, so
+	// they are never evaluated or listed
+	deletedPolicies map[string]*models.Policy
+	deletedUsers    map[string]*models.User
+
+	// persistMu orders the writes of policy changes to the store, which
+	// happen after mu is released. persisted holds the latest version of
+	// each policy written, so a change that loses the race to be written
+	// can't overwrite a newer one.
+	persistMu sync.Mutex
+	persisted map[string]int
 }
 
 // NewEngine creates a new policy engine
 func NewEngine() *Engine {
 	return &Engine{
-		policies:       make(map[string]*models.Policy),
-		spendingLimits: make(map[string]*models.SpendingLimit),
-		users:          make(map[string]*models.User),
-		groups:         make(map[string]*models.Group),
+		policies:        make(map[string]*models.Policy),
+		spendingLimits:  make(map[string]*models.SpendingLimit),
+		users:           make(map[string]*models.User),
+		groups:          make(map[string]*models.Group),
+		versions:        make(map[string][]models.PolicyVersion),
+		celPrograms:     newCELPrograms(),
+		deletedPolicies: make(map[string]*models.Policy),
+		deletedUsers:    make(map[string]*models.User),
+		persisted:       make(map[string]int),
 	}
 }
 
 // CreatePolicy creates a new policy
 func (e *Engine) CreatePolicy(ctx context.Context, policy *models.Policy) (*models.Policy, error) {
+	if err := ValidateRules(policy.Rules); err != nil {
+		return nil, err
+	}
+	if err := ValidateSystemPrompt(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateTopics(policy.Type, policy.Config, policy.Actions); err != nil {
+		return nil, err
+	}
+	if err := ValidateInjection(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateContext(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateRollout(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateRouting(policy.Type, policy.Config); err != nil {
+		return nil, err
+	}
+
 	e.mu.Lock()
-	defer e.mu.Unlock()
 
 	if policy.ID == "" {
 		policy.ID = uuid.New().String()
 	}
+	if policy.CreatedBy == "" {
+		policy.CreatedBy = actorFromContext(ctx)
+	}
+	policy.TenantID = tenant.Assign(ctx, policy.TenantID)
 	policy.CreatedAt = time.Now()
 	policy.UpdatedAt = time.Now()
+	policy.Deletion = models.Deletion{}
 
+	versions := e.recordVersion(ctx, policy, nil, models.PolicyChangeCreate)
 	e.policies[policy.ID] = policy
+	e.mu.Unlock()
+
+	e.persist(ctx, versions)
 
 	log.Info().
 		Str("policy_id", policy.ID).
@@ -58,37 +114,69 @@ func (e *Engine) GetPolicy(ctx context.Context, id string) (*models.Policy, erro
 	defer e.mu.RUnlock()
 
 	policy, exists := e.policies[id]
-	if !exists {
+	if !exists || !tenant.Visible(ctx, policy.TenantID) {
 		return nil, fmt.Errorf("policy not found: %s", id)
 	}
 	return policy, nil
 }
 
-// ListPolicies returns all policies
+// ListPolicies returns all policies of the tenant ctx is confined to
 func (e *Engine) ListPolicies(ctx context.Context) ([]*models.Policy, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	policies := make([]*models.Policy, 0, len(e.policies))
 	for _, p := range e.policies {
-		policies = append(policies, p)
+		if tenant.Visible(ctx, p.TenantID) {
+			policies = append(policies, p)
+		}
 	}
 	return policies, nil
 }
 
 // UpdatePolicy updates an existing policy
 func (e *Engine) UpdatePolicy(ctx context.Context, policy *models.Policy) (*models.Policy, error) {
+	if err := ValidateRules(policy.Rules); err != nil {
+		return nil, err
+	}
+	if err := ValidateSystemPrompt(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateTopics(policy.Type, policy.Config, policy.Actions); err != nil {
+		return nil, err
+	}
+	if err := ValidateInjection(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateContext(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateRollout(policy.Config); err != nil {
+		return nil, err
+	}
+	if err := ValidateRouting(policy.Type, policy.Config); err != nil {
+		return nil, err
+	}
+
 	e.mu.Lock()
-	defer e.mu.Unlock()
 
 	existing, exists := e.policies[policy.ID]
-	if !exists {
+	if !exists || !tenant.Visible(ctx, existing.TenantID) {
+		e.mu.Unlock()
 		return nil, fmt.Errorf("policy not found: %s", policy.ID)
 	}
 
+	policy.TenantID = existing.TenantID
 	policy.CreatedAt = existing.CreatedAt
+	policy.CreatedBy = existing.CreatedBy
 	policy.UpdatedAt = time.Now()
+	policy.Deletion = models.Deletion{}
+
+	versions := e.recordVersion(ctx, policy, existing, models.PolicyChangeUpdate)
 	e.policies[policy.ID] = policy
+	e.mu.Unlock()
+
+	e.persist(ctx, versions)
 
 	log.Info().
 		Str("policy_id", policy.ID).
@@ -98,49 +186,221 @@ func (e *Engine) UpdatePolicy(ctx context.Context, policy *models.Policy) (*mode
 	return policy, nil
 }
 
-// DeletePolicy deletes a policy
-func (e *Engine) DeletePolicy(ctx context.Context, id string) error {
+// DeletePolicy soft-deletes a policy, recording who deleted it and why. It
+// stops being evaluated but is kept, with its history, until restored.
+func (e *Engine) DeletePolicy(ctx context.Context, id, reason string) error {
 	e.mu.Lock()
-	defer e.mu.Unlock()
 
-	if _, exists := e.policies[id]; !exists {
+	existing, exists := e.policies[id]
+	if !exists || !tenant.Visible(ctx, existing.TenantID) {
+		e.mu.Unlock()
 		return fmt.Errorf("policy not found: %s", id)
 	}
 
+	now := time.Now()
+	deleted := *existing
+	deleted.UpdatedAt = now
+	deleted.Deletion = models.Deletion{DeletedAt: &now, DeletedBy: actorFromContext(ctx), DeleteReason: reason}
+	versions := e.recordVersion(ctx, &deleted, existing, models.PolicyChangeDelete)
 	delete(e.policies, id)
+	e.deletedPolicies[id] = &deleted
+	e.mu.Unlock()
+
+	e.persist(ctx, versions)
 
-	log.Info().Str("policy_id", id).Msg("Policy deleted")
+	log.Info().Str("policy_id", id).Str("reason", reason).Msg("Policy deleted")
 	return nil
 }
 
-// EvaluateRequest evaluates all policies against a request
-func (e *Engine) EvaluateRequest(ctx context.Context, req *EvaluationRequest) (*EvaluationResult, error) {
+// RestorePolicy brings back a soft-deleted policy as it was when deleted.
+// The restore is recorded as a new version.
+func (e *Engine) RestorePolicy(ctx context.Context, id string) (*models.Policy, error) {
+	e.mu.Lock()
+
+	deleted, exists := e.deletedPolicies[id]
+	if !exists || !tenant.Visible(ctx, deleted.TenantID) {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("deleted policy not found: %s", id)
+	}
+
+	restored := *deleted
+	restored.UpdatedAt = time.Now()
+	restored.Deletion = models.Deletion{}
+	versions := e.recordVersion(ctx, &restored, deleted, models.PolicyChangeRestore)
+	delete(e.deletedPolicies, id)
+	e.policies[id] = &restored
+	e.mu.Unlock()
+
+	e.persist(ctx, versions)
+
+	log.Info().Str("policy_id", id).Msg("Policy restored")
+	return &restored, nil
+}
+
+// DeletedPolicies returns the soft-deleted policies of the tenant ctx is
+// confined to, most recently deleted first
+func (e *Engine) DeletedPolicies(ctx context.Context) []*models.Policy {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
+	policies := make([]*models.Policy, 0, len(e.deletedPolicies))
+	for _, p := range e.deletedPolicies {
+		if tenant.Visible(ctx, p.TenantID) {
+			policies = append(policies, p)
+		}
+	}
+	slices.SortFunc(policies, func(a, b *models.Policy) int { return b.DeletedAt.Compare(*a.DeletedAt) })
+	return policies
+}
+
+// State holds the engine's stored entities for export and import
+type State struct {
+	Policies       []*models.Policy        `json:"policies"`
+	SpendingLimits []*models.SpendingLimit `json:"spending_limits"`
+	Users          []*models.User          `json:"users"`
+	Groups         []*models.Group         `json:"groups"`
+	PolicyVersions []models.PolicyVersion  `json:"policy_versions,omitempty"`
+}
+
+// ExportState returns a copy of all policies, spending limits, users, and groups
+func (e *Engine) ExportState() *State {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	state := &State{
+		Policies:       make([]*models.Policy, 0, len(e.policies)),
+		SpendingLimits: make([]*models.SpendingLimit, 0, len(e.spendingLimits)),
+		Users:          make([]*models.User, 0, len(e.users)),
+		Groups:         make([]*models.Group, 0, len(e.groups)),
+	}
+	for _, p := range e.policies {
+		copied := *p
+		state.Policies = append(state.Policies, &copied)
+	}
+	for _, p := range e.deletedPolicies {
+		copied := *p
+		state.Policies = append(state.Policies, &copied)
+	}
+	for _, l := range e.spendingLimits {
+		copied := *l
+		state.SpendingLimits = append(state.SpendingLimits, &copied)
+	}
+	for _, u := range e.users {
+		copied := *u
+		state.Users = append(state.Users, &copied)
+	}
+	for _, u := range e.deletedUsers {
+		copied := *u
+		state.Users = append(state.Users, &copied)
+	}
+	for _, g := range e.groups {
+		copied := *g
+		state.Groups = append(state.Groups, &copied)
+	}
+	for _, history := range e.versions {
+		state.PolicyVersions = append(state.PolicyVersions, history...)
+	}
+	return state
+}
+
+// ImportState loads entities into the engine, replacing any with the same ID
+func (e *Engine) ImportState(state *State) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, p := range state.Policies {
+		if p.Deleted() {
+			e.deletedPolicies[p.ID] = p
+			delete(e.policies, p.ID)
+		} else {
+			e.policies[p.ID] = p
+			delete(e.deletedPolicies, p.ID)
+		}
+	}
+	for _, l := range state.SpendingLimits {
+		e.spendingLimits[l.ID] = l
+	}
+	for _, u := range state.Users {
+		if u.Deleted() {
+			e.deletedUsers[u.ID] = u
+			delete(e.users, u.ID)
+		} else {
+			e.users[u.ID] = u
+			delete(e.deletedUsers, u.ID)
+		}
+	}
+	for _, g := range state.Groups {
+		e.groups[g.ID] = g
+	}
+	if len(state.PolicyVersions) > 0 {
+		imported := make(map[string][]models.PolicyVersion)
+		for _, v := range state.PolicyVersions {
+			imported[v.PolicyID] = append(imported[v.PolicyID], v)
+		}
+		for id, history := range imported {
+			sort.Slice(history, func(i, j int) bool { return history[i].Version < history[j].Version })
+			e.versions[id] = history
+			if p, ok := e.policies[id]; ok {
+				p.Version = history[len(history)-1].Version
+			} else if p, ok := e.deletedPolicies[id]; ok {
+				p.Version = history[len(history)-1].Version
+			}
+		}
+	}
+
+	log.Info().
+		Int("policies", len(state.Policies)).
+		Int("spending_limits", len(state.SpendingLimits)).
+		Int("users", len(state.Users)).
+		Msg("Policy engine state imported")
+}
+
+// SetOPA routes the policy types it decides to an Open Policy Agent instance
+func (e *Engine) SetOPA(opa *OPA) {
+	e.opa = opa
+}
+
+// OPATypes returns the policy types decided by OPA, if it is configured
+func (e *Engine) OPATypes() []models.PolicyType {
+	if e.opa == nil {
+		return nil
+	}
+	return e.opa.Types()
+}
+
+// EvaluateRequest evaluates all policies against a request, merging in the
+// decisions of OPA for the policy types routed to it
+func (e *Engine) EvaluateRequest(ctx context.Context, req *EvaluationRequest) (*EvaluationResult, error) {
+	e.mu.RLock()
 	result := &EvaluationResult{
 		Allowed:     true,
 		Evaluations: []models.PolicyEvaluation{},
 	}
 
 	// Get active policies sorted by priority
-	activePolicies := e.getActivePolicies()
+	activePolicies := e.activePolicies(ctx)
 
 	for _, policy := range activePolicies {
-		eval := e.evaluatePolicy(policy, req)
-		result.Evaluations = append(result.Evaluations, eval)
-
-		if eval.Matched {
-			switch eval.Action {
-			case models.ActionDeny:
-				result.Allowed = false
-				result.BlockedBy = policy.ID
-				result.BlockReason = eval.Message
-			case models.ActionWarn:
-				result.Warnings = append(result.Warnings, eval.Message)
-			case models.ActionThrottle:
-				result.Throttled = true
+		if !req.includes(policy.Type) || (e.opa != nil && e.opa.overrides(policy.Type)) {
+			continue
+		}
+		result.apply(e.evaluatePolicy(policy, req))
+	}
+
+	var groups []string
+	if user, ok := e.users[req.UserID]; ok {
+		groups = user.Groups
+	}
+	e.mu.RUnlock()
+
+	// OPA is queried without holding the lock. Its policies have no observe
+	// mode, so it only takes part in enforcing.
+	if e.opa != nil && !Observed(ctx) {
+		for _, policyType := range e.opa.Types() {
+			if !req.includes(policyType) {
+				continue
 			}
+			result.apply(e.opa.Evaluate(ctx, policyType, req, groups))
 		}
 	}
 
@@ -149,13 +409,23 @@ func (e *Engine) EvaluateRequest(ctx context.Context, req *EvaluationRequest) (*
 
 // EvaluationRequest represents a request to be evaluated
 type EvaluationRequest struct {
-	UserID      string
-	Model       string
-	Provider    string
-	TokenCount  int
-	Cost        float64
-	ContentType string
-	Metadata    map[string]interface{}
+	UserID      string                 `json:"user_id"`
+	Model       string                 `json:"model"`
+	Provider    string                 `json:"provider"`
+	TokenCount  int                    `json:"token_count"`
+	Cost        float64                `json:"cost"`
+	ContentType string                 `json:"content_type"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Aggregates  map[string]float64     `json:"aggregates,omitempty"` // e.g. requests_last_hour, available to expression rules
+	Messages    []models.Message       `json:"messages,omitempty"`   // PII-masked prompt, for external policies
+	Tools       []string               `json:"tools,omitempty"`      // functions offered to or called by the model
+
+	// PolicyTypes limits evaluation to these types (empty = all types)
+	PolicyTypes []models.PolicyType `json:"-"`
+}
+
+func (r *EvaluationRequest) includes(policyType models.PolicyType) bool {
+	return len(r.PolicyTypes) == 0 || slices.Contains(r.PolicyTypes, policyType)
 }
 
 // EvaluationResult represents the result of policy evaluation
@@ -168,10 +438,122 @@ type EvaluationResult struct {
 	Evaluations []models.PolicyEvaluation
 }
 
-func (e *Engine) getActivePolicies() []*models.Policy {
+// apply records an evaluation and the effect of its action if it matched
+func (r *EvaluationResult) apply(eval models.PolicyEvaluation) {
+	r.Evaluations = append(r.Evaluations, eval)
+	if !eval.Matched {
+		return
+	}
+	switch eval.Action {
+	case models.ActionDeny:
+		r.Allowed = false
+		r.BlockedBy = eval.PolicyID
+		r.BlockReason = eval.Message
+	case models.ActionWarn:
+		r.Warnings = append(r.Warnings, eval.Message)
+	case models.ActionThrottle:
+		r.Throttled = true
+	}
+}
+
+// ResolveCapturePolicy returns the highest-priority active policy that enables
+// content capture for the user, or nil if none applies
+func (e *Engine) ResolveCapturePolicy(ctx context.Context, userID string) *models.Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	for _, policy := range activePolicies {
+		if policy.Config.CaptureContent && e.policyTargetsUser(policy, userID) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// ResolveRetentionDays returns the data retention period set by the
+// highest-priority active policy targeting the user, or 0 if none sets one
+func (e *Engine) ResolveRetentionDays(ctx context.Context, userID string) int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	for _, policy := range activePolicies {
+		if policy.Config.DataRetentionDays > 0 && e.policyTargetsUser(policy, userID) {
+			return policy.Config.DataRetentionDays
+		}
+	}
+	return 0
+}
+
+// ResolveQuotas returns the request quotas that apply to a user, one per
+// window set on each active rate limit policy targeting them
+func (e *Engine) ResolveQuotas(ctx context.Context, userID string) []quota.Quota {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	var quotas []quota.Quota
+	for _, policy := range activePolicies {
+		if policy.Type != models.PolicyTypeRateLimit || !e.policyTargetsUser(policy, userID) {
+			continue
+		}
+		limits := []struct {
+			window quota.Window
+			limit  int
+		}{
+			{quota.WindowMinute, policy.Config.RequestsPerMinute},
+			{quota.WindowHour, policy.Config.RequestsPerHour},
+			{quota.WindowDay, policy.Config.RequestsPerDay},
+		}
+		for _, l := range limits {
+			if l.limit > 0 {
+				quotas = append(quotas, quota.Quota{
+					PolicyID:   policy.ID,
+					PolicyName: policy.Name,
+					Window:     l.window,
+					Limit:      l.limit,
+				})
+			}
+		}
+	}
+	return quotas
+}
+
+// MinRetentionDays returns the shortest data retention period set by any
+// active policy of any tenant, or 0 if none sets one
+func (e *Engine) MinRetentionDays() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	shortest := 0
+	for _, policy := range e.getActivePolicies("") {
+		days := policy.Config.DataRetentionDays
+		if days > 0 && (shortest == 0 || days < shortest) {
+			shortest = days
+		}
+	}
+	return shortest
+}
+
+// getActivePolicies returns the active policies of a tenant, or of every
+// tenant when tenantID is empty
+func (e *Engine) getActivePolicies(tenantID string) []*models.Policy {
 	var active []*models.Policy
 	for _, p := range e.policies {
-		if p.Status == models.PolicyStatusActive {
+		if p.Status == models.PolicyStatusActive && (tenantID == "" || tenant.Of(p.TenantID) == tenantID) {
 			active = append(active, p)
 		}
 	}
@@ -187,8 +569,9 @@ func (e *Engine) evaluatePolicy(policy *models.Policy, req *EvaluationRequest) m
 		EvaluatedAt: time.Now(),
 	}
 
-	// Check if policy targets this user
-	if !e.policyTargetsUser(policy, req.UserID) {
+	// Check if policy targets this user and model
+	eval.Rollout = rollout(policy, req.UserID)
+	if !e.policyTargetsUser(policy, req.UserID) || !policyTargetsModel(policy, req.Provider, req.Model) {
 		return eval
 	}
 
@@ -206,7 +589,13 @@ func (e *Engine) evaluatePolicy(policy *models.Policy, req *EvaluationRequest) m
 	return eval
 }
 
+// policyTargetsUser reports whether a policy applies to a user: whether
+// its targets include them and, if it is rolled out to part of its users,
+// whether they are within the rollout
 func (e *Engine) policyTargetsUser(policy *models.Policy, userID string) bool {
+	if r := rollout(policy, userID); r != nil && !r.Included {
+		return false
+	}
 	if policy.Targets.AllUsers {
 		return true
 	}
@@ -263,6 +652,10 @@ func (e *Engine) evaluateRules(rules []models.PolicyRule, req *EvaluationRequest
 }
 
 func (e *Engine) evaluateRule(rule models.PolicyRule, req *EvaluationRequest) bool {
+	if rule.Type == models.RuleTypeExpression {
+		return e.evaluateExpression(rule, req)
+	}
+
 	var fieldValue interface{}
 
 	switch rule.Field {
@@ -343,6 +736,7 @@ func (e *Engine) CreateSpendingLimit(ctx context.Context, limit *models.Spending
 	if limit.ID == "" {
 		limit.ID = uuid.New().String()
 	}
+	limit.TenantID = tenant.Assign(ctx, limit.TenantID)
 	limit.CreatedAt = time.Now()
 	limit.UpdatedAt = time.Now()
 	limit.CurrentSpend = 0
@@ -364,7 +758,7 @@ func (e *Engine) GetSpendingLimit(ctx context.Context, id string) (*models.Spend
 	defer e.mu.RUnlock()
 
 	limit, exists := e.spendingLimits[id]
-	if !exists {
+	if !exists || !tenant.Visible(ctx, limit.TenantID) {
 		return nil, fmt.Errorf("spending limit not found: %s", id)
 	}
 	return limit, nil
@@ -384,14 +778,17 @@ func (e *Engine) GetUserSpendingLimits(ctx context.Context, userID string) ([]*m
 	return limits, nil
 }
 
-// ListSpendingLimits returns all spending limits
+// ListSpendingLimits returns all spending limits of the tenant ctx is
+// confined to
 func (e *Engine) ListSpendingLimits(ctx context.Context) ([]*models.SpendingLimit, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	limits := make([]*models.SpendingLimit, 0, len(e.spendingLimits))
 	for _, l := range e.spendingLimits {
-		limits = append(limits, l)
+		if tenant.Visible(ctx, l.TenantID) {
+			limits = append(limits, l)
+		}
 	}
 	return limits, nil
 }
@@ -402,10 +799,11 @@ func (e *Engine) UpdateSpendingLimit(ctx context.Context, limit *models.Spending
 	defer e.mu.Unlock()
 
 	existing, exists := e.spendingLimits[limit.ID]
-	if !exists {
+	if !exists || !tenant.Visible(ctx, existing.TenantID) {
 		return nil, fmt.Errorf("spending limit not found: %s", limit.ID)
 	}
 
+	limit.TenantID = existing.TenantID
 	limit.CreatedAt = existing.CreatedAt
 	limit.UpdatedAt = time.Now()
 	e.spendingLimits[limit.ID] = limit
@@ -468,7 +866,9 @@ func (e *Engine) CreateUser(ctx context.Context, user *models.User) (*models.Use
 	if user.ID == "" {
 		user.ID = uuid.New().String()
 	}
+	user.TenantID = tenant.Assign(ctx, user.TenantID)
 	user.CreatedAt = time.Now()
+	user.Deletion = models.Deletion{}
 
 	e.users[user.ID] = user
 
@@ -486,20 +886,22 @@ func (e *Engine) GetUser(ctx context.Context, id string) (*models.User, error) {
 	defer e.mu.RUnlock()
 
 	user, exists := e.users[id]
-	if !exists {
+	if !exists || !tenant.Visible(ctx, user.TenantID) {
 		return nil, fmt.Errorf("user not found: %s", id)
 	}
 	return user, nil
 }
 
-// ListUsers returns all users
+// ListUsers returns all users of the tenant ctx is confined to
 func (e *Engine) ListUsers(ctx context.Context) ([]*models.User, error) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
 	users := make([]*models.User, 0, len(e.users))
 	for _, u := range e.users {
-		users = append(users, u)
+		if tenant.Visible(ctx, u.TenantID) {
+			users = append(users, u)
+		}
 	}
 	return users, nil
 }
@@ -510,25 +912,176 @@ func (e *Engine) UpdateUser(ctx context.Context, user *models.User) (*models.Use
 	defer e.mu.Unlock()
 
 	existing, exists := e.users[user.ID]
-	if !exists {
+	if !exists || !tenant.Visible(ctx, existing.TenantID) {
 		return nil, fmt.Errorf("user not found: %s", user.ID)
 	}
 
+	user.TenantID = existing.TenantID
 	user.CreatedAt = existing.CreatedAt
+	user.Deletion = models.Deletion{}
 	e.users[user.ID] = user
 
 	return user, nil
 }
 
-// DeleteUser deletes a user
-func (e *Engine) DeleteUser(ctx context.Context, id string) error {
+// DeleteUser soft-deletes a user, recording who deleted them and why. They
+// are kept until restored.
+func (e *Engine) DeleteUser(ctx context.Context, id, reason string) (*models.User, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if _, exists := e.users[id]; !exists {
-		return fmt.Errorf("user not found: %s", id)
+	existing, exists := e.users[id]
+	if !exists || !tenant.Visible(ctx, existing.TenantID) {
+		return nil, fmt.Errorf("user not found: %s", id)
 	}
 
+	now := time.Now()
+	deleted := *existing
+	deleted.Deletion = models.Deletion{DeletedAt: &now, DeletedBy: actorFromContext(ctx), DeleteReason: reason}
 	delete(e.users, id)
+	e.deletedUsers[id] = &deleted
+
+	log.Info().Str("user_id", id).Str("reason", reason).Msg("User deleted")
+	return &deleted, nil
+}
+
+// RestoreUser brings back a soft-deleted user as they were when deleted
+func (e *Engine) RestoreUser(ctx context.Context, id string) (*models.User, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	deleted, exists := e.deletedUsers[id]
+	if !exists || !tenant.Visible(ctx, deleted.TenantID) {
+		return nil, fmt.Errorf("deleted user not found: %s", id)
+	}
+
+	restored := *deleted
+	restored.Deletion = models.Deletion{}
+	delete(e.deletedUsers, id)
+	e.users[id] = &restored
+
+	log.Info().Str("user_id", id).Msg("User restored")
+	return &restored, nil
+}
+
+// DeletedUsers returns the soft-deleted users of the tenant ctx is confined
+// to, most recently deleted first
+func (e *Engine) DeletedUsers(ctx context.Context) []*models.User {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	users := make([]*models.User, 0, len(e.deletedUsers))
+	for _, u := range e.deletedUsers {
+		if tenant.Visible(ctx, u.TenantID) {
+			users = append(users, u)
+		}
+	}
+	slices.SortFunc(users, func(a, b *models.User) int { return b.DeletedAt.Compare(*a.DeletedAt) })
+	return users
+}
+
+// Group Management Methods
+
+// CreateGroup creates a new group
+func (e *Engine) CreateGroup(ctx context.Context, group *models.Group) (*models.Group, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if group.ID == "" {
+		group.ID = uuid.New().String()
+	}
+	group.TenantID = tenant.Assign(ctx, group.TenantID)
+	if group.CreatedAt.IsZero() {
+		group.CreatedAt = time.Now()
+		group.UpdatedAt = group.CreatedAt
+	}
+	group.Members = nil
+
+	e.groups[group.ID] = group
+
+	log.Info().
+		Str("group_id", group.ID).
+		Str("name", group.Name).
+		Msg("Group created")
+
+	return e.withMembers(group), nil
+}
+
+// GetGroup retrieves a group by ID
+func (e *Engine) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	group, exists := e.groups[id]
+	if !exists || !tenant.Visible(ctx, group.TenantID) {
+		return nil, fmt.Errorf("group not found: %s", id)
+	}
+	return e.withMembers(group), nil
+}
+
+// ListGroups returns all groups of the tenant ctx is confined to, by name
+func (e *Engine) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	groups := make([]*models.Group, 0, len(e.groups))
+	for _, g := range e.groups {
+		if tenant.Visible(ctx, g.TenantID) {
+			groups = append(groups, e.withMembers(g))
+		}
+	}
+	slices.SortFunc(groups, func(a, b *models.Group) int {
+		if a.Name != b.Name {
+			return strings.Compare(a.Name, b.Name)
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return groups, nil
+}
+
+// UpdateGroup updates a group's name and description. Renaming a group
+// doesn't change the groups of its members.
+func (e *Engine) UpdateGroup(ctx context.Context, group *models.Group) (*models.Group, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	existing, exists := e.groups[group.ID]
+	if !exists || !tenant.Visible(ctx, existing.TenantID) {
+		return nil, fmt.Errorf("group not found: %s", group.ID)
+	}
+
+	group.TenantID = existing.TenantID
+	group.CreatedAt = existing.CreatedAt
+	group.UpdatedAt = time.Now()
+	group.Members = nil
+	e.groups[group.ID] = group
+
+	return e.withMembers(group), nil
+}
+
+// DeleteGroup deletes a group. Its members keep its name in their groups.
+func (e *Engine) DeleteGroup(ctx context.Context, id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if group, exists := e.groups[id]; !exists || !tenant.Visible(ctx, group.TenantID) {
+		return fmt.Errorf("group not found: %s", id)
+	}
+
+	delete(e.groups, id)
 	return nil
 }
+
+// withMembers returns a copy of group listing the users of its tenant whose
+// groups include its name. The caller must hold e.mu.
+func (e *Engine) withMembers(group *models.Group) *models.Group {
+	copied := *group
+	copied.Members = []string{}
+	for _, u := range e.users {
+		if tenant.Of(u.TenantID) == tenant.Of(group.TenantID) && slices.Contains(u.Groups, group.Name) {
+			copied.Members = append(copied.Members, u.ID)
+		}
+	}
+	slices.Sort(copied.Members)
+	return &copied
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/injection"
+)
+
+// InjectionThreshold is the lowest prompt injection threat level a policy
+// blocks
+type InjectionThreshold struct {
+	PolicyID   string                  `json:"policy_id"`
+	PolicyName string                  `json:"policy_name"`
+	Level      string                  `json:"level"`
+	Rollout    *models.RolloutDecision `json:"rollout,omitempty"`
+}
+
+// ValidateInjection checks a policy's block_threat_level
+func ValidateInjection(cfg models.PolicyConfig) error {
+	level := cfg.BlockThreatLevel
+	if level != "" && (level == "none" || !slices.Contains(injection.ThreatLevels, level)) {
+		return fmt.Errorf("%w: block_threat_level must be low, medium, high or critical", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// InjectionThresholdFor returns the lowest threat level blocked by the
+// active deny policies targeting the user and model, or nil if none of them
+// sets one. Of policies setting the same level, the first in priority order
+// is named.
+func (e *Engine) InjectionThresholdFor(ctx context.Context, userID, provider, model string) *InjectionThreshold {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	var lowest *InjectionThreshold
+	for _, policy := range activePolicies {
+		level := policy.Config.BlockThreatLevel
+		if level == "" || policy.Actions.Action != models.ActionDeny {
+			continue
+		}
+		if !e.policyTargetsUser(policy, userID) || !policyTargetsModel(policy, provider, model) {
+			continue
+		}
+		if lowest == nil || slices.Index(injection.ThreatLevels, level) < slices.Index(injection.ThreatLevels, lowest.Level) {
+			lowest = &InjectionThreshold{PolicyID: policy.ID, PolicyName: policy.Name, Level: level, Rollout: rollout(policy, userID)}
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ModelDenial explains why a policy blocked a model or provider
+type ModelDenial struct {
+	PolicyID   string                  `json:"policy_id"`
+	PolicyName string                  `json:"policy_name"`
+	Provider   string                  `json:"provider,omitempty"`
+	Model      string                  `json:"model,omitempty"`
+	Reason     string                  `json:"reason"`
+	Rollout    *models.RolloutDecision `json:"rollout,omitempty"`
+}
+
+// CheckModelAccess applies the model and provider allow/deny lists of every
+// active policy targeting the user and the requested model. It returns the
+// first denial in priority order, or nil if the model may be used.
+func (e *Engine) CheckModelAccess(ctx context.Context, userID, provider, model string) *ModelDenial {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	for _, policy := range activePolicies {
+		if !e.policyTargetsUser(policy, userID) || !policyTargetsModel(policy, provider, model) {
+			continue
+		}
+		if reason := modelListViolation(&policy.Config, provider, model); reason != "" {
+			return &ModelDenial{
+				PolicyID:   policy.ID,
+				PolicyName: policy.Name,
+				Provider:   provider,
+				Model:      model,
+				Reason:     reason,
+				Rollout:    rollout(policy, userID),
+			}
+		}
+	}
+	return nil
+}
+
+// policyTargetsModel reports whether a policy applies to a model and
+// provider. Policies without model or provider targets apply to all of them.
+func policyTargetsModel(policy *models.Policy, provider, model string) bool {
+	if len(policy.Targets.Models) > 0 && !matchesAny(policy.Targets.Models, model) {
+		return false
+	}
+	if len(policy.Targets.Providers) > 0 && !matchesAny(policy.Targets.Providers, provider) {
+		return false
+	}
+	return true
+}
+
+// modelListViolation checks a model and provider against a policy's lists
+// and returns a reason if either is not allowed
+func modelListViolation(cfg *models.PolicyConfig, provider, model string) string {
+	if model != "" {
+		if denied := splitList(cfg.DeniedModels); matchesAny(denied, model) {
+			return fmt.Sprintf("model %s is denied", model)
+		}
+		if allowed := splitList(cfg.AllowedModels); len(allowed) > 0 && !matchesAny(allowed, model) {
+			return fmt.Sprintf("model %s is not in the allowed models (%s)", model, strings.Join(allowed, ", "))
+		}
+	}
+	if provider != "" {
+		if denied := splitList(cfg.DeniedProviders); matchesAny(denied, provider) {
+			return fmt.Sprintf("provider %s is denied", provider)
+		}
+		if allowed := splitList(cfg.AllowedProviders); len(allowed) > 0 && !matchesAny(allowed, provider) {
+			return fmt.Sprintf("provider %s is not in the allowed providers (%s)", provider, strings.Join(allowed, ", "))
+		}
+	}
+	return ""
+}
+
+// splitList parses a comma-separated policy config list
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// matchesAny reports whether name matches one of the patterns. Matching is
+// case-insensitive and a trailing "*" matches any suffix, so "gpt-4o*"
+// covers both gpt-4o and gpt-4o-mini.
+func matchesAny(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
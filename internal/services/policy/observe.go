@@ -0,0 +1,36 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+type observeKey struct{}
+
+// WithObserved returns a context in which the engine resolves the active
+// policies in observe mode instead of the enforced ones, so callers can tell
+// what those policies would have done
+func WithObserved(ctx context.Context) context.Context {
+	return context.WithValue(ctx, observeKey{}, true)
+}
+
+// Observed reports whether ctx selects the policies in observe mode
+func Observed(ctx context.Context) bool {
+	observed, _ := ctx.Value(observeKey{}).(bool)
+	return observed
+}
+
+// activePolicies returns the active policies of the tenant of ctx that are
+// enforced, or those in observe mode when ctx selects them
+func (e *Engine) activePolicies(ctx context.Context) []*models.Policy {
+	observed := Observed(ctx)
+	var selected []*models.Policy
+	for _, p := range e.getActivePolicies(tenant.Current(ctx)) {
+		if p.Config.Observe == observed {
+			selected = append(selected, p)
+		}
+	}
+	return selected
+}
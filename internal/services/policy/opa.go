@@ -0,0 +1,169 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// How an OPA decision combines with built-in policies of the same type
+const (
+	OPAModeMerge    = "merge"    // the request must pass both
+	OPAModeOverride = "override" // built-in policies of the type are skipped
+)
+
+// OPA evaluates requests against decisions served by an Open Policy Agent
+// instance, one decision path per policy type
+type OPA struct {
+	baseURL  string
+	client   *http.Client
+	failOpen bool
+	routes   map[models.PolicyType]config.OPAPolicyConfig
+}
+
+// NewOPA creates an OPA backend, or returns nil if no URL or policy types
+// are configured
+func NewOPA(cfg config.OPAConfig) *OPA {
+	if cfg.URL == "" || len(cfg.Policies) == 0 {
+		return nil
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	o := &OPA{
+		baseURL:  strings.TrimSuffix(cfg.URL, "/"),
+		client:   &http.Client{Timeout: timeout},
+		failOpen: cfg.FailOpen,
+		routes:   make(map[models.PolicyType]config.OPAPolicyConfig, len(cfg.Policies)),
+	}
+	for policyType, route := range cfg.Policies {
+		if route.Path == "" {
+			continue
+		}
+		route.Path = strings.Trim(strings.ReplaceAll(route.Path, ".", "/"), "/")
+		if route.Mode != OPAModeOverride {
+			route.Mode = OPAModeMerge
+		}
+		o.routes[models.PolicyType(policyType)] = route
+	}
+	return o
+}
+
+// Types returns the policy types decided by OPA
+func (o *OPA) Types() []models.PolicyType {
+	types := make([]models.PolicyType, 0, len(o.routes))
+	for policyType := range o.routes {
+		types = append(types, policyType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// overrides reports whether OPA replaces the built-in policies of a type
+func (o *OPA) overrides(policyType models.PolicyType) bool {
+	route, ok := o.routes[policyType]
+	return ok && route.Mode == OPAModeOverride
+}
+
+// opaInput is the input document of a decision: the evaluation request plus
+// the policy type being decided and the user's groups
+type opaInput struct {
+	*EvaluationRequest
+	PolicyType models.PolicyType `json:"policy_type"`
+	Groups     []string          `json:"groups,omitempty"`
+}
+
+// opaDecision is the result document of a decision. A plain boolean result
+// is read as allow.
+type opaDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// Evaluate asks OPA for the decision on one policy type and returns it as a
+// deny evaluation that matches when the request isn't allowed
+func (o *OPA) Evaluate(ctx context.Context, policyType models.PolicyType, req *EvaluationRequest, groups []string) models.PolicyEvaluation {
+	route := o.routes[policyType]
+	eval := models.PolicyEvaluation{
+		PolicyID:    "opa:" + route.Path,
+		PolicyName:  "OPA " + route.Path,
+		Action:      models.ActionDeny,
+		EvaluatedAt: time.Now(),
+	}
+
+	decision, err := o.query(ctx, route.Path, opaInput{EvaluationRequest: req, PolicyType: policyType, Groups: groups})
+	if err != nil {
+		log.Warn().Err(err).Str("path", route.Path).Bool("fail_open", o.failOpen).Msg("OPA decision failed")
+		if !o.failOpen {
+			eval.Matched = true
+			eval.Message = "Policy decision unavailable"
+		}
+		return eval
+	}
+
+	if !decision.Allow {
+		eval.Matched = true
+		eval.Message = decision.Reason
+		if eval.Message == "" {
+			eval.Message = fmt.Sprintf("Denied by OPA policy %s", route.Path)
+		}
+	}
+	return eval
+}
+
+// query posts the input to OPA's data API
+func (o *OPA) query(ctx context.Context, path string, input opaInput) (*opaDecision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/v1/data/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OPA returned status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode OPA response: %w", err)
+	}
+	// OPA omits the result when the decision is undefined, which usually
+	// means the path is wrong
+	if len(doc.Result) == 0 {
+		return nil, fmt.Errorf("decision %s is undefined", path)
+	}
+
+	var allow bool
+	if err := json.Unmarshal(doc.Result, &allow); err == nil {
+		return &opaDecision{Allow: allow}, nil
+	}
+	var decision opaDecision
+	if err := json.Unmarshal(doc.Result, &decision); err != nil {
+		return nil, fmt.Errorf("decision %s is neither a boolean nor an object: %w", path, err)
+	}
+	return &decision, nil
+}
@@ -0,0 +1,166 @@
+package policy
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+// PolicyQuerier is implemented by stores that can filter, sort and page
+// policies themselves. It returns the IDs of the page in order and the number
+// of policies matching.
+type PolicyQuerier interface {
+	QueryPolicyIDs(ctx context.Context, q *models.ListQuery) ([]string, int, error)
+}
+
+// QueryPolicies returns a page of the policies matching q and the number
+// matching. By default policies are ordered by priority, newest first within
+// a priority. A store that implements PolicyQuerier picks the page, so large
+// lists aren't filtered in memory.
+func (e *Engine) QueryPolicies(ctx context.Context, q *models.ListQuery) ([]*models.Policy, int, error) {
+	if querier, ok := e.store.(PolicyQuerier); ok {
+		ids, total, err := querier.QueryPolicyIDs(ctx, q)
+		if err != nil {
+			return nil, 0, err
+		}
+		e.mu.RLock()
+		defer e.mu.RUnlock()
+		policies := make([]*models.Policy, 0, len(ids))
+		for _, id := range ids {
+			if p, exists := e.policies[id]; exists {
+				policies = append(policies, p)
+			}
+		}
+		return policies, total, nil
+	}
+
+	e.mu.RLock()
+	policies := make([]*models.Policy, 0, len(e.policies))
+	for _, p := range e.policies {
+		if inTenant(q, p.TenantID) && (q.Status == "" || string(p.Status) == q.Status) && (q.Type == "" || string(p.Type) == q.Type) {
+			policies = append(policies, p)
+		}
+	}
+	e.mu.RUnlock()
+
+	compare := func(a, b *models.Policy) int {
+		if c := cmp.Compare(a.Priority, b.Priority); c != 0 {
+			return c
+		}
+		return b.CreatedAt.Compare(a.CreatedAt)
+	}
+	switch q.Sort {
+	case "name":
+		compare = func(a, b *models.Policy) int { return cmp.Compare(a.Name, b.Name) }
+	case "type":
+		compare = func(a, b *models.Policy) int { return cmp.Compare(a.Type, b.Type) }
+	case "status":
+		compare = func(a, b *models.Policy) int { return cmp.Compare(a.Status, b.Status) }
+	case "priority":
+		compare = func(a, b *models.Policy) int { return cmp.Compare(a.Priority, b.Priority) }
+	case "created_at":
+		compare = func(a, b *models.Policy) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "updated_at":
+		compare = func(a, b *models.Policy) int { return a.UpdatedAt.Compare(b.UpdatedAt) }
+	}
+	return sortPage(policies, q, compare, func(p *models.Policy) string { return p.ID })
+}
+
+// QueryUsers returns a page of the users matching q, newest first by
+// default, and the number matching
+func (e *Engine) QueryUsers(ctx context.Context, q *models.ListQuery) ([]*models.User, int, error) {
+	e.mu.RLock()
+	users := make([]*models.User, 0, len(e.users))
+	for _, u := range e.users {
+		if inTenant(q, u.TenantID) && (q.Status == "" || u.Status == q.Status) && (q.Role == "" || string(u.Role) == q.Role) {
+			users = append(users, u)
+		}
+	}
+	e.mu.RUnlock()
+
+	compare := func(a, b *models.User) int { return b.CreatedAt.Compare(a.CreatedAt) }
+	switch q.Sort {
+	case "email":
+		compare = func(a, b *models.User) int { return cmp.Compare(a.Email, b.Email) }
+	case "name":
+		compare = func(a, b *models.User) int { return cmp.Compare(a.Name, b.Name) }
+	case "role":
+		compare = func(a, b *models.User) int { return cmp.Compare(a.Role, b.Role) }
+	case "status":
+		compare = func(a, b *models.User) int { return cmp.Compare(a.Status, b.Status) }
+	case "created_at":
+		compare = func(a, b *models.User) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "last_login_at":
+		compare = func(a, b *models.User) int { return loginTime(a).Compare(loginTime(b)) }
+	}
+	return sortPage(users, q, compare, func(u *models.User) string { return u.ID })
+}
+
+// QuerySpendingLimits returns a page of the spending limits matching q,
+// newest first by default, and the number matching
+func (e *Engine) QuerySpendingLimits(ctx context.Context, q *models.ListQuery) ([]*models.SpendingLimit, int, error) {
+	e.mu.RLock()
+	limits := make([]*models.SpendingLimit, 0, len(e.spendingLimits))
+	for _, l := range e.spendingLimits {
+		if inTenant(q, l.TenantID) && (q.UserID == "" || l.UserID == q.UserID) && (q.Type == "" || l.LimitType == q.Type) {
+			limits = append(limits, l)
+		}
+	}
+	e.mu.RUnlock()
+
+	compare := func(a, b *models.SpendingLimit) int { return b.CreatedAt.Compare(a.CreatedAt) }
+	switch q.Sort {
+	case "user_id":
+		compare = func(a, b *models.SpendingLimit) int { return cmp.Compare(a.UserID, b.UserID) }
+	case "limit_type":
+		compare = func(a, b *models.SpendingLimit) int { return cmp.Compare(a.LimitType, b.LimitType) }
+	case "limit_amount":
+		compare = func(a, b *models.SpendingLimit) int { return cmp.Compare(a.LimitAmount, b.LimitAmount) }
+	case "created_at":
+		compare = func(a, b *models.SpendingLimit) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	case "updated_at":
+		compare = func(a, b *models.SpendingLimit) int { return a.UpdatedAt.Compare(b.UpdatedAt) }
+	}
+	return sortPage(limits, q, compare, func(l *models.SpendingLimit) string { return l.ID })
+}
+
+// inTenant reports whether an entry of tenantID matches q's tenant filter
+func inTenant(q *models.ListQuery, tenantID string) bool {
+	return q.Tenant == "" || tenant.Of(tenantID) == q.Tenant
+}
+
+// sortPage sorts items, reversing compare when q asks for descending order,
+// and returns the page q asks for along with the number of items. Ties are
+// broken by ID so pages don't overlap.
+func sortPage[T any](items []T, q *models.ListQuery, compare func(a, b T) int, id func(T) string) ([]T, int, error) {
+	slices.SortFunc(items, func(a, b T) int {
+		c := compare(a, b)
+		if q.Desc {
+			c = -c
+		}
+		if c == 0 {
+			c = cmp.Compare(id(a), id(b))
+		}
+		return c
+	})
+
+	total := len(items)
+	start := min(q.Offset, total)
+	end := total
+	if q.Limit > 0 {
+		end = min(start+q.Limit, total)
+	}
+	return items[start:end], total, nil
+}
+
+// loginTime is when a user last logged in, or the zero time if never
+func loginTime(u *models.User) time.Time {
+	if u.LastLoginAt == nil {
+		return time.Time{}
+	}
+	return *u.LastLoginAt
+}
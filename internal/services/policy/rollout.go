@@ -0,0 +1,33 @@
+package policy
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ValidateRollout checks a policy's rollout_percent
+func ValidateRollout(cfg models.PolicyConfig) error {
+	if cfg.RolloutPercent < 0 || cfg.RolloutPercent > 100 {
+		return fmt.Errorf("%w: rollout_percent must be between 0 and 100", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// rollout decides whether a user is within a policy's rollout, or returns
+// nil if the policy applies to all of its users. Buckets are hashed from the
+// policy ID as well as the user ID, so the users in a 5% rollout aren't the
+// same for every policy, and raising the percent only adds users.
+func rollout(policy *models.Policy, userID string) *models.RolloutDecision {
+	percent := policy.Config.RolloutPercent
+	if percent <= 0 || percent >= 100 {
+		return nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(policy.ID))
+	h.Write([]byte{0})
+	h.Write([]byte(userID))
+	bucket := int(h.Sum32() % 100)
+	return &models.RolloutDecision{Percent: percent, Bucket: bucket, Included: bucket < percent}
+}
@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ValidateRouting checks that a routing policy says where requests go
+func ValidateRouting(policyType models.PolicyType, cfg models.PolicyConfig) error {
+	if policyType != models.PolicyTypeRouting {
+		return nil
+	}
+	if cfg.LLMProfile == "" && cfg.RouteModel == "" {
+		return fmt.Errorf("%w: a routing policy needs llm_profile or route_model", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// Route returns where the highest-priority active policy routing the
+// request sends it, or nil if the request keeps its own provider and model.
+// Routing policies apply to the users and groups they target when their
+// rules match the request's model, provider and metadata; other policies
+// setting llm_profile route every request of the users they target.
+func (e *Engine) Route(ctx context.Context, req *models.GuardRequest) *models.LLMRoute {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	metadata := make(map[string]interface{}, len(req.Metadata))
+	for k, v := range req.Metadata {
+		metadata[k] = v
+	}
+	evalReq := &EvaluationRequest{
+		UserID:   req.UserID,
+		Model:    req.Model,
+		Provider: req.Provider,
+		Metadata: metadata,
+	}
+
+	for _, policy := range activePolicies {
+		if !e.policyTargetsUser(policy, req.UserID) {
+			continue
+		}
+		if policy.Type == models.PolicyTypeRouting {
+			if !policyTargetsModel(policy, req.Provider, req.Model) || !e.evaluateRules(policy.Rules, evalReq) {
+				continue
+			}
+		} else if policy.Config.LLMProfile == "" {
+			continue
+		}
+		return &models.LLMRoute{
+			PolicyID:   policy.ID,
+			PolicyName: policy.Name,
+			Profile:    policy.Config.LLMProfile,
+			Model:      policy.Config.RouteModel,
+		}
+	}
+	return nil
+}
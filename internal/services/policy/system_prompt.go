@@ -0,0 +1,137 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// System prompt modes
+const (
+	SystemPromptPrepend = "prepend" // a system message of its own, before the conversation
+	SystemPromptMerge   = "merge"   // placed at the start of the caller's first system message
+)
+
+// promptVariable matches {{name}} placeholders in system prompts
+var promptVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// promptVariables are the placeholders a system prompt may use
+var promptVariables = []string{"user_id", "user_name", "user_email", "groups", "provider", "model", "date"}
+
+// SystemPrompt is a mandated system prompt, rendered for one request
+type SystemPrompt struct {
+	PolicyID   string `json:"policy_id"`
+	PolicyName string `json:"policy_name"`
+	Mode       string `json:"mode"`
+	Text       string `json:"text"`
+}
+
+// ValidateSystemPrompt checks a policy's system prompt mode and placeholders
+func ValidateSystemPrompt(cfg models.PolicyConfig) error {
+	switch cfg.SystemPromptMode {
+	case "", SystemPromptPrepend, SystemPromptMerge:
+	default:
+		return fmt.Errorf("%w: system_prompt_mode must be %s or %s", ErrInvalidPolicy, SystemPromptPrepend, SystemPromptMerge)
+	}
+	for _, m := range promptVariable.FindAllStringSubmatch(cfg.SystemPrompt, -1) {
+		if !slices.Contains(promptVariables, m[1]) {
+			return fmt.Errorf("%w: system_prompt: unknown variable {{%s}} (use %s)", ErrInvalidPolicy, m[1], strings.Join(promptVariables, ", "))
+		}
+	}
+	return nil
+}
+
+// ResolveSystemPrompts returns the system prompts of every active policy
+// targeting the user and model, in priority order, with their placeholders
+// filled in
+func (e *Engine) ResolveSystemPrompts(ctx context.Context, userID, provider, model string) []SystemPrompt {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	vars := map[string]string{
+		"user_id":  userID,
+		"provider": provider,
+		"model":    model,
+		"date":     time.Now().UTC().Format("2006-01-02"),
+	}
+	if user, ok := e.users[userID]; ok {
+		vars["user_name"] = user.Name
+		vars["user_email"] = user.Email
+		vars["groups"] = strings.Join(user.Groups, ", ")
+	}
+
+	var prompts []SystemPrompt
+	for _, policy := range activePolicies {
+		if strings.TrimSpace(policy.Config.SystemPrompt) == "" {
+			continue
+		}
+		if !e.policyTargetsUser(policy, userID) || !policyTargetsModel(policy, provider, model) {
+			continue
+		}
+		mode := policy.Config.SystemPromptMode
+		if mode == "" {
+			mode = SystemPromptPrepend
+		}
+		prompts = append(prompts, SystemPrompt{
+			PolicyID:   policy.ID,
+			PolicyName: policy.Name,
+			Mode:       mode,
+			Text: promptVariable.ReplaceAllStringFunc(policy.Config.SystemPrompt, func(m string) string {
+				return vars[promptVariable.FindStringSubmatch(m)[1]]
+			}),
+		})
+	}
+	return prompts
+}
+
+// ApplySystemPrompts adds mandated system prompts to a conversation. Prepended
+// prompts come first, highest priority first; merged prompts are joined to
+// the start of the first system message, or become one if there is none.
+func ApplySystemPrompts(messages []models.Message, prompts []SystemPrompt) []models.Message {
+	if len(prompts) == 0 {
+		return messages
+	}
+
+	var prepended []models.Message
+	var merged []string
+	for _, p := range prompts {
+		if p.Mode == SystemPromptMerge {
+			merged = append(merged, p.Text)
+		} else {
+			prepended = append(prepended, models.Message{Role: "system", Content: p.Text})
+		}
+	}
+
+	out := make([]models.Message, 0, len(messages)+len(prepended)+1)
+	out = append(out, prepended...)
+	if len(merged) == 0 {
+		return append(out, messages...)
+	}
+
+	mergedText := strings.Join(merged, "\n\n")
+	for i, msg := range messages {
+		if msg.Role != "system" {
+			continue
+		}
+		rest := make([]models.Message, len(messages))
+		copy(rest, messages)
+		rest[i].Content = mergedText + "\n\n" + msg.Content
+		if msg.Parts != nil {
+			rest[i].Parts = append([]models.ContentPart{{Type: models.PartText, Text: mergedText}}, msg.Parts...)
+		}
+		return append(out, rest...)
+	}
+	out = append(out, models.Message{Role: "system", Content: mergedText})
+	return append(out, messages...)
+}
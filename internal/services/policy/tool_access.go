@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ToolDenial explains why a policy blocked a tool
+type ToolDenial struct {
+	PolicyID   string                  `json:"policy_id"`
+	PolicyName string                  `json:"policy_name"`
+	Tool       string                  `json:"tool"`
+	Reason     string                  `json:"reason"`
+	Rollout    *models.RolloutDecision `json:"rollout,omitempty"`
+}
+
+// CheckToolAccess applies the tool allow/deny lists of every active policy
+// targeting the user and model to the named tools. It returns the first
+// denial in priority order, or nil if all of the tools may be used.
+func (e *Engine) CheckToolAccess(ctx context.Context, userID, provider, model string, tools []string) *ToolDenial {
+	if len(tools) == 0 {
+		return nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	for _, policy := range activePolicies {
+		if !e.policyTargetsUser(policy, userID) || !policyTargetsModel(policy, provider, model) {
+			continue
+		}
+		denied := splitList(policy.Config.DeniedTools)
+		allowed := splitList(policy.Config.AllowedTools)
+		for _, tool := range tools {
+			reason := ""
+			if matchesAny(denied, tool) {
+				reason = fmt.Sprintf("tool %s is denied", tool)
+			} else if len(allowed) > 0 && !matchesAny(allowed, tool) {
+				reason = fmt.Sprintf("tool %s is not in the allowed tools (%s)", tool, strings.Join(allowed, ", "))
+			}
+			if reason != "" {
+				return &ToolDenial{
+					PolicyID:   policy.ID,
+					PolicyName: policy.Name,
+					Tool:       tool,
+					Reason:     reason,
+					Rollout:    rollout(policy, userID),
+				}
+			}
+		}
+	}
+	return nil
+}
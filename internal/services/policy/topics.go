@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// ValidateTopics checks a topic policy's topics and similarity threshold
+func ValidateTopics(policyType models.PolicyType, cfg models.PolicyConfig, actions models.PolicyActions) error {
+	if policyType != models.PolicyTypeTopic {
+		return nil
+	}
+	if len(cfg.AllowedTopics) == 0 && len(cfg.BlockedTopics) == 0 {
+		return fmt.Errorf("%w: a topic policy needs allowed_topics or blocked_topics", ErrInvalidPolicy)
+	}
+	if t := cfg.TopicThreshold; t < 0 || t > 1 {
+		return fmt.Errorf("%w: topic_threshold must be between 0 and 1", ErrInvalidPolicy)
+	}
+	switch actions.Action {
+	case "", models.ActionDeny, models.ActionWarn:
+	default:
+		return fmt.Errorf("%w: topic policies take a %s or %s action", ErrInvalidPolicy, models.ActionDeny, models.ActionWarn)
+	}
+
+	lists := []struct {
+		field  string
+		topics []models.Topic
+	}{
+		{"allowed_topics", cfg.AllowedTopics},
+		{"blocked_topics", cfg.BlockedTopics},
+	}
+	for _, list := range lists {
+		for i, topic := range list.topics {
+			if strings.TrimSpace(topic.Name) == "" {
+				return fmt.Errorf("%w: %s[%d]: name is required", ErrInvalidPolicy, list.field, i)
+			}
+			if len(topic.Keywords) == 0 && len(topic.Examples) == 0 {
+				return fmt.Errorf("%w: %s: topic %q needs keywords or examples", ErrInvalidPolicy, list.field, topic.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// TopicPolicies returns copies of the active topic policies targeting the
+// user and model, in priority order
+func (e *Engine) TopicPolicies(ctx context.Context, userID, provider, model string) []models.Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	activePolicies := e.activePolicies(ctx)
+	sort.SliceStable(activePolicies, func(i, j int) bool {
+		return activePolicies[i].Priority < activePolicies[j].Priority
+	})
+
+	var policies []models.Policy
+	for _, policy := range activePolicies {
+		if policy.Type != models.PolicyTypeTopic {
+			continue
+		}
+		if !e.policyTargetsUser(policy, userID) || !policyTargetsModel(policy, provider, model) {
+			continue
+		}
+		policies = append(policies, *policy)
+	}
+	return policies
+}
@@ -0,0 +1,283 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/tenant"
+	"github.com/rs/zerolog/log"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context recording who is making policy changes
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// Store persists policies and their versions. The engine keeps serving from
+// memory; the store is written through so history survives restarts.
+type Store interface {
+	// SavePolicyVersions stores new versions of a policy, and its current
+	// state unless policy is nil, all at once
+	SavePolicyVersions(ctx context.Context, policy *models.Policy, versions []models.PolicyVersion) error
+}
+
+// SetStore enables write-through persistence of policies and versions
+func (e *Engine) SetStore(store Store) {
+	e.store = store
+}
+
+// recordVersion appends a new version for the policy and returns the versions
+// added. A policy loaded without history gets a baseline version of its previous
+// contents first so the change can still be rolled back. The caller must hold e.mu.
+func (e *Engine) recordVersion(ctx context.Context, policy *models.Policy, previous *models.Policy, changeType models.PolicyChangeType) []models.PolicyVersion {
+	var added []models.PolicyVersion
+
+	history := e.versions[policy.ID]
+	if len(history) == 0 && previous != nil {
+		baseline := models.PolicyVersion{
+			PolicyID:   previous.ID,
+			Version:    max(previous.Version, 1),
+			ChangeType: models.PolicyChangeCreate,
+			ChangedBy:  previous.CreatedBy,
+			Policy:     *previous,
+			CreatedAt:  previous.UpdatedAt,
+		}
+		baseline.Policy.Version = baseline.Version
+		history = append(history, baseline)
+		added = append(added, baseline)
+	}
+
+	next := 1
+	if len(history) > 0 {
+		next = history[len(history)-1].Version + 1
+	}
+	policy.Version = next
+
+	version := models.PolicyVersion{
+		PolicyID:   policy.ID,
+		Version:    next,
+		ChangeType: changeType,
+		ChangedBy:  actorFromContext(ctx),
+		Policy:     *policy,
+		CreatedAt:  time.Now(),
+	}
+	if previous != nil {
+		version.Changes = DiffPolicies(previous, policy)
+	}
+
+	e.versions[policy.ID] = append(history, version)
+	return append(added, version)
+}
+
+// persist writes policy versions through to the store, if configured. The
+// last version determines the policy's current stored state, unless a
+// later version was written first; deleted policies are stored with their
+// deletion.
+func (e *Engine) persist(ctx context.Context, versions []models.PolicyVersion) {
+	if e.store == nil || len(versions) == 0 {
+		return
+	}
+	e.persistMu.Lock()
+	defer e.persistMu.Unlock()
+
+	latest := versions[len(versions)-1]
+	var policy *models.Policy
+	if latest.Version > e.persisted[latest.PolicyID] {
+		current := latest.Policy
+		policy = &current
+	}
+	if err := e.store.SavePolicyVersions(ctx, policy, versions); err != nil {
+		log.Warn().Err(err).Str("policy_id", latest.PolicyID).Msg("Failed to persist policy change")
+		return
+	}
+	e.persisted[latest.PolicyID] = max(e.persisted[latest.PolicyID], latest.Version)
+}
+
+// ReloadPolicy replaces a policy and its history with those another
+// instance stored, without persisting them again
+func (e *Engine) ReloadPolicy(policy *models.Policy, history []models.PolicyVersion) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(history) > 0 {
+		e.versions[policy.ID] = history
+		policy.Version = history[len(history)-1].Version
+
+		e.persistMu.Lock()
+		e.persisted[policy.ID] = max(e.persisted[policy.ID], policy.Version)
+		e.persistMu.Unlock()
+	}
+	if policy.Deleted() {
+		e.deletedPolicies[policy.ID] = policy
+		delete(e.policies, policy.ID)
+	} else {
+		e.policies[policy.ID] = policy
+		delete(e.deletedPolicies, policy.ID)
+	}
+}
+
+// ListPolicyVersions returns a policy's history, oldest first
+func (e *Engine) ListPolicyVersions(ctx context.Context, id string) ([]models.PolicyVersion, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	history, ok := e.versions[id]
+	if !ok || !historyVisible(ctx, history) {
+		return nil, fmt.Errorf("policy not found: %s", id)
+	}
+	versions := make([]models.PolicyVersion, len(history))
+	copy(versions, history)
+	return versions, nil
+}
+
+// LatestPolicyVersion returns the most recent version of a policy
+func (e *Engine) LatestPolicyVersion(ctx context.Context, id string) (*models.PolicyVersion, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	history := e.versions[id]
+	if len(history) == 0 || !historyVisible(ctx, history) {
+		return nil, fmt.Errorf("policy not found: %s", id)
+	}
+	latest := history[len(history)-1]
+	return &latest, nil
+}
+
+// RollbackPolicy restores a policy to the contents of an earlier version.
+// The rollback is recorded as a new version; history is never rewritten.
+func (e *Engine) RollbackPolicy(ctx context.Context, id string, version int) (*models.Policy, error) {
+	e.mu.Lock()
+
+	if !historyVisible(ctx, e.versions[id]) {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("policy not found: %s", id)
+	}
+	var target *models.PolicyVersion
+	for i := range e.versions[id] {
+		if e.versions[id][i].Version == version {
+			target = &e.versions[id][i]
+			break
+		}
+	}
+	if target == nil {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("version %d not found for policy %s", version, id)
+	}
+	if target.ChangeType == models.PolicyChangeDelete {
+		e.mu.Unlock()
+		return nil, fmt.Errorf("version %d records a deletion and cannot be restored", version)
+	}
+
+	restored := target.Policy
+	previous := e.policies[id]
+	if previous == nil {
+		// Rolling back a deleted policy restores it
+		previous = e.deletedPolicies[id]
+	}
+	if previous != nil {
+		restored.CreatedAt = previous.CreatedAt
+	}
+	restored.UpdatedAt = time.Now()
+	restored.Deletion = models.Deletion{}
+
+	recorded := e.recordVersion(ctx, &restored, previous, models.PolicyChangeRollback)
+	delete(e.deletedPolicies, id)
+	e.policies[id] = &restored
+	e.mu.Unlock()
+
+	e.persist(ctx, recorded)
+
+	log.Info().
+		Str("policy_id", id).
+		Int("restored_version", version).
+		Int("version", restored.Version).
+		Msg("Policy rolled back")
+
+	return &restored, nil
+}
+
+// historyVisible reports whether a policy's history can be seen with ctx.
+// A policy never changes tenant, so its first version tells which it is in.
+func historyVisible(ctx context.Context, history []models.PolicyVersion) bool {
+	return len(history) == 0 || tenant.Visible(ctx, history[0].Policy.TenantID)
+}
+
+// DiffPolicies returns the fields that differ between two policies. Timestamps
+// and the version number are ignored.
+func DiffPolicies(old, new *models.Policy) []models.PolicyFieldDiff {
+	oldFields := flattenPolicy(old)
+	newFields := flattenPolicy(new)
+
+	paths := make(map[string]struct{}, len(oldFields)+len(newFields))
+	for p := range oldFields {
+		paths[p] = struct{}{}
+	}
+	for p := range newFields {
+		paths[p] = struct{}{}
+	}
+
+	var diffs []models.PolicyFieldDiff
+	for p := range paths {
+		oldValue, newValue := oldFields[p], newFields[p]
+		if !reflect.DeepEqual(oldValue, newValue) {
+			diffs = append(diffs, models.PolicyFieldDiff{Path: p, OldValue: oldValue, NewValue: newValue})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+// flattenPolicy maps each leaf of the policy's JSON form to its path
+func flattenPolicy(p *models.Policy) map[string]interface{} {
+	copied := *p
+	copied.Version = 0
+	copied.CreatedAt = time.Time{}
+	copied.UpdatedAt = time.Time{}
+
+	raw, _ := json.Marshal(copied)
+	var doc map[string]interface{}
+	json.Unmarshal(raw, &doc)
+
+	fields := make(map[string]interface{})
+	flatten("", doc, fields)
+	return fields
+}
+
+func flatten(prefix string, value interface{}, out map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flatten(path, child, out)
+		}
+	case []interface{}:
+		// Lists of objects (rules) are diffed per element; scalar lists (user IDs) as a whole
+		if len(v) > 0 {
+			if _, ok := v[0].(map[string]interface{}); ok {
+				for i, child := range v {
+					flatten(prefix+"["+strconv.Itoa(i)+"]", child, out)
+				}
+				return
+			}
+		}
+		out[prefix] = v
+	default:
+		out[prefix] = v
+	}
+}
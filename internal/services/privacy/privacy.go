@@ -0,0 +1,105 @@
+package privacy
+
+import (
+	"math"
+	"math/rand/v2"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Policy protects individual users in aggregate statistics. Any group
+// (a model, an hour, an event type, ...) that covers fewer than MinGroupSize
+// distinct users is suppressed, and the remaining counts and sums get
+// Laplace noise calibrated to Epsilon.
+type Policy struct {
+	Enforced         bool
+	MinGroupSize     int
+	Epsilon          float64
+	CostSensitivity  float64
+	TokenSensitivity float64
+}
+
+// NewPolicy creates a policy from configuration, filling in defaults
+func NewPolicy(cfg config.StatsPrivacyConfig) *Policy {
+	p := &Policy{
+		Enforced:         cfg.Enforce,
+		MinGroupSize:     cfg.MinGroupSize,
+		Epsilon:          cfg.Epsilon,
+		CostSensitivity:  cfg.CostSensitivity,
+		TokenSensitivity: cfg.TokenSensitivity,
+	}
+	if p.MinGroupSize <= 0 {
+		p.MinGroupSize = 5
+	}
+	if p.CostSensitivity <= 0 {
+		p.CostSensitivity = 1
+	}
+	if p.TokenSensitivity <= 0 {
+		p.TokenSensitivity = 4096
+	}
+	return p
+}
+
+// Allows reports whether a group covering the given number of users may be shown
+func (p *Policy) Allows(users int) bool {
+	return users >= p.MinGroupSize
+}
+
+// Count returns a noisy, non-negative count
+func (p *Policy) Count(n int64) int64 {
+	return max(int64(math.Round(float64(n)+p.noise(1))), 0)
+}
+
+// Cost returns a noisy, non-negative cost total
+func (p *Policy) Cost(v float64) float64 {
+	return math.Max(v+p.noise(p.CostSensitivity), 0)
+}
+
+// Tokens returns a noisy, non-negative token total
+func (p *Policy) Tokens(n int64) int64 {
+	return max(int64(math.Round(float64(n)+p.noise(p.TokenSensitivity))), 0)
+}
+
+// noise draws from a Laplace distribution with scale sensitivity/epsilon;
+// an epsilon of zero disables noise and leaves only thresholding
+func (p *Policy) noise(sensitivity float64) float64 {
+	if p.Epsilon <= 0 {
+		return 0
+	}
+	u := rand.Float64() - 0.5
+	for u == -0.5 {
+		u = rand.Float64() - 0.5
+	}
+	return -sensitivity / p.Epsilon * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// Info returns the response metadata for this policy
+func (p *Policy) Info(suppressed int) *models.StatsPrivacy {
+	return &models.StatsPrivacy{
+		MinGroupSize:     p.MinGroupSize,
+		Epsilon:          p.Epsilon,
+		SuppressedGroups: suppressed,
+	}
+}
+
+// Groups tracks the distinct users contributing to each group of a breakdown
+type Groups map[string]map[string]struct{}
+
+// Add records that a user contributed to a group
+func (g Groups) Add(group, userID string) {
+	users, ok := g[group]
+	if !ok {
+		users = make(map[string]struct{})
+		g[group] = users
+	}
+	// Entries without a user still count towards the group but add no user
+	if userID != "" {
+		users[userID] = struct{}{}
+	}
+}
+
+// Users returns the number of distinct users in a group
+func (g Groups) Users(group string) int {
+	return len(g[group])
+}
@@ -0,0 +1,238 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+// Window is the period a quota counts requests over. Windows are fixed and
+// aligned to UTC, so a daily quota resets at midnight UTC.
+type Window string
+
+const (
+	WindowMinute Window = "minute"
+	WindowHour   Window = "hour"
+	WindowDay    Window = "day"
+)
+
+// Start returns the beginning of the window containing t
+func (w Window) Start(t time.Time) time.Time {
+	t = t.UTC()
+	switch w {
+	case WindowMinute:
+		return t.Truncate(time.Minute)
+	case WindowHour:
+		return t.Truncate(time.Hour)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Duration returns the length of the window
+func (w Window) Duration() time.Duration {
+	switch w {
+	case WindowMinute:
+		return time.Minute
+	case WindowHour:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// Quota is a request-count limit for a user, set by a rate limit policy
+type Quota struct {
+	PolicyID   string `json:"policy_id"`
+	PolicyName string `json:"policy_name"`
+	Window     Window `json:"window"`
+	Limit      int    `json:"limit"`
+}
+
+// Status is a user's usage of a quota in the current window
+type Status struct {
+	Quota
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// Result is the outcome of consuming a request against a user's quotas
+type Result struct {
+	Allowed bool
+	// Exceeded is the first quota over its limit, if any
+	Exceeded *Status
+	// Tightest is the quota with the fewest remaining requests, reported in
+	// response headers
+	Tightest *Status
+}
+
+// Store persists quota counters so quotas survive restarts and are shared
+// between replicas
+type Store interface {
+	IncrementQuotaCounter(ctx context.Context, counter *models.QuotaCounter) error
+	ListQuotaCounters(ctx context.Context, userID string) ([]*models.QuotaCounter, error)
+}
+
+// Service counts requests per user against policy quotas
+type Service struct {
+	store    Store
+	counters map[string]*models.QuotaCounter
+	mu       sync.Mutex
+}
+
+// NewService creates a quota service; counters are kept in memory when store is nil
+func NewService(store Store) *Service {
+	return &Service{
+		store:    store,
+		counters: make(map[string]*models.QuotaCounter),
+	}
+}
+
+func counterKey(policyID, userID string, window Window) string {
+	return policyID + "|" + userID + "|" + string(window)
+}
+
+// Consume records a request for the user against each quota and reports
+// whether any quota has been exceeded. Requests over the limit still count,
+// so clients that keep retrying stay blocked until the window resets.
+func (s *Service) Consume(ctx context.Context, userID string, quotas []Quota) *Result {
+	result := &Result{Allowed: true}
+	now := time.Now()
+
+	for _, q := range quotas {
+		counter := &models.QuotaCounter{
+			PolicyID:    q.PolicyID,
+			UserID:      userID,
+			Period:      string(q.Window),
+			WindowStart: q.Window.Start(now),
+		}
+		s.increment(ctx, counter)
+
+		status := newStatus(q, counter)
+		if result.Tightest == nil || status.Remaining < result.Tightest.Remaining {
+			result.Tightest = status
+		}
+		if counter.Count > q.Limit && result.Exceeded == nil {
+			result.Allowed = false
+			result.Exceeded = status
+		}
+	}
+	return result
+}
+
+// increment bumps a counter in the store, falling back to memory if the
+// store is unavailable so a database outage doesn't disable quotas
+func (s *Service) increment(ctx context.Context, counter *models.QuotaCounter) {
+	if s.store != nil {
+		err := s.store.IncrementQuotaCounter(ctx, counter)
+		if err == nil {
+			s.remember(counter)
+			return
+		}
+		log.Warn().Err(err).Str("policy_id", counter.PolicyID).Msg("Failed to persist quota counter, counting in memory")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := counterKey(counter.PolicyID, counter.UserID, Window(counter.Period))
+	existing, ok := s.counters[key]
+	if !ok || !existing.WindowStart.Equal(counter.WindowStart) {
+		existing = &models.QuotaCounter{
+			PolicyID:    counter.PolicyID,
+			UserID:      counter.UserID,
+			Period:      counter.Period,
+			WindowStart: counter.WindowStart,
+		}
+		s.counters[key] = existing
+	}
+	existing.Count++
+	counter.Count = existing.Count
+}
+
+func (s *Service) remember(counter *models.QuotaCounter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *counter
+	s.counters[counterKey(counter.PolicyID, counter.UserID, Window(counter.Period))] = &copied
+}
+
+// Usage reports a user's current usage of each quota without counting a request
+func (s *Service) Usage(ctx context.Context, userID string, quotas []Quota) []Status {
+	counts := make(map[string]*models.QuotaCounter)
+	if s.store != nil {
+		stored, err := s.store.ListQuotaCounters(ctx, userID)
+		if err != nil {
+			log.Warn().Err(err).Str("user_id", userID).Msg("Failed to load quota counters")
+		}
+		for _, c := range stored {
+			counts[counterKey(c.PolicyID, c.UserID, Window(c.Period))] = c
+		}
+	}
+	if len(counts) == 0 {
+		s.mu.Lock()
+		for key, c := range s.counters {
+			if c.UserID == userID {
+				copied := *c
+				counts[key] = &copied
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	now := time.Now()
+	statuses := make([]Status, 0, len(quotas))
+	for _, q := range quotas {
+		counter := &models.QuotaCounter{
+			PolicyID:    q.PolicyID,
+			UserID:      userID,
+			Period:      string(q.Window),
+			WindowStart: q.Window.Start(now),
+		}
+		if c, ok := counts[counterKey(q.PolicyID, userID, q.Window)]; ok && c.WindowStart.Equal(counter.WindowStart) {
+			counter.Count = c.Count
+		}
+		statuses = append(statuses, *newStatus(q, counter))
+	}
+	return statuses
+}
+
+func newStatus(q Quota, counter *models.QuotaCounter) *Status {
+	return &Status{
+		Quota:     q,
+		Used:      counter.Count,
+		Remaining: max(q.Limit-counter.Count, 0),
+		ResetAt:   counter.WindowStart.Add(q.Window.Duration()),
+	}
+}
+
+// Export returns the counters for windows that are still open, for snapshots
+func (s *Service) Export() []models.QuotaCounter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	counters := make([]models.QuotaCounter, 0, len(s.counters))
+	for _, c := range s.counters {
+		if now.Before(c.WindowStart.Add(Window(c.Period).Duration())) {
+			counters = append(counters, *c)
+		}
+	}
+	return counters
+}
+
+// Import restores counters from a snapshot
+func (s *Service) Import(counters []models.QuotaCounter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range counters {
+		c := counters[i]
+		s.counters[counterKey(c.PolicyID, c.UserID, Window(c.Period))] = &c
+	}
+}
@@ -0,0 +1,287 @@
+package reeval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/capture"
+	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/jobs"
+	"github.com/epps11/goguard/internal/services/pii"
+)
+
+// JobType is the job queue type re-evaluations run as
+const JobType = "reevaluation"
+
+const (
+	// DefaultDays is how far back a job looks when no window is given
+	DefaultDays = 7
+	// MaxDays bounds the window; captures rarely outlive it anyway
+	MaxDays = 90
+	// maxScanned bounds the captures one job reads
+	maxScanned = 10000
+	// maxChanges bounds the changed captures a job lists; all are counted
+	maxChanges = 500
+	// maxJobs is how many recent jobs are listed
+	maxJobs = 20
+)
+
+// Kinds and directions of a change
+const (
+	KindInjection  = "injection"
+	KindPII        = "pii"
+	NewlyCaught    = "newly_caught"
+	NoLongerCaught = "no_longer_caught"
+)
+
+// ErrInvalidJob is returned for jobs with invalid settings
+var ErrInvalidJob = errors.New("invalid re-evaluation job")
+
+// ErrJobRunning is returned when a job is started while another is queued or
+// running
+var ErrJobRunning = errors.New("a re-evaluation job is already running")
+
+// ErrJobNotFound is returned for unknown job IDs
+var ErrJobNotFound = errors.New("re-evaluation job not found")
+
+// jobParams is what a re-evaluation job is queued with
+type jobParams struct {
+	Days   int                       `json:"days"`
+	Config models.ReevaluationConfig `json:"config"`
+}
+
+// jobResult is what a completed re-evaluation job stores
+type jobResult struct {
+	Summary models.ReevaluationSummary `json:"summary"`
+	Changes []models.ReevaluationItem  `json:"changes"`
+}
+
+// Service runs re-evaluation jobs on the job queue, one at a time
+type Service struct {
+	security config.SecurityConfig
+	pii      config.PIIConfig
+	captures *capture.Service
+	queue    *jobs.Queue
+}
+
+// NewService creates a service comparing candidate configurations with the
+// running security and PII settings, and registers its jobs with the queue
+func NewService(security config.SecurityConfig, piiCfg config.PIIConfig, captures *capture.Service, queue *jobs.Queue) *Service {
+	s := &Service{
+		security: security,
+		pii:      piiCfg,
+		captures: captures,
+		queue:    queue,
+	}
+	queue.Register(jobs.Type{Name: JobType, Run: s.run, Exclusive: true})
+	return s
+}
+
+// Start validates a job and queues it
+func (s *Service) Start(ctx context.Context, days int, candidate models.ReevaluationConfig, createdBy string) (*models.ReevaluationJob, error) {
+	if days == 0 {
+		days = DefaultDays
+	}
+	if days < 0 || days > MaxDays {
+		return nil, fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidJob, MaxDays)
+	}
+	for _, p := range candidate.InjectionPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("%w: injection pattern %q: %v", ErrInvalidJob, p, err)
+		}
+	}
+	if candidate.InjectionPatterns == nil && candidate.PIITypes == nil {
+		return nil, fmt.Errorf("%w: set injection_patterns or pii_types to compare against", ErrInvalidJob)
+	}
+
+	job, err := s.queue.Enqueue(ctx, JobType, jobParams{Days: days, Config: candidate}, createdBy)
+	if errors.Is(err, jobs.ErrJobActive) {
+		return nil, ErrJobRunning
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reevaluationJob(job, true), nil
+}
+
+// Get returns a job with its changed captures
+func (s *Service) Get(ctx context.Context, id string) (*models.ReevaluationJob, error) {
+	job, err := s.queue.Get(ctx, id)
+	if errors.Is(err, jobs.ErrJobNotFound) || err == nil && job.Type != JobType {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reevaluationJob(job, true), nil
+}
+
+// List returns recent jobs, newest first, without their changed captures
+func (s *Service) List(ctx context.Context) ([]*models.ReevaluationJob, error) {
+	queued, err := s.queue.List(ctx, JobType, "", maxJobs)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*models.ReevaluationJob, 0, len(queued))
+	for _, job := range queued {
+		list = append(list, reevaluationJob(job, false))
+	}
+	return list, nil
+}
+
+// reevaluationJob is the re-evaluation view of a queued job
+func reevaluationJob(job *models.Job, changes bool) *models.ReevaluationJob {
+	var params jobParams
+	json.Unmarshal(job.Params, &params)
+	var result jobResult
+	if job.Result != nil {
+		json.Unmarshal(job.Result, &result)
+	}
+	view := &models.ReevaluationJob{
+		ID:          job.ID,
+		Status:      job.Status,
+		Days:        params.Days,
+		Config:      params.Config,
+		Progress:    job.Progress,
+		Total:       job.Total,
+		Summary:     result.Summary,
+		Error:       job.Error,
+		CreatedBy:   job.CreatedBy,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+	}
+	if changes {
+		view.Changes = result.Changes
+	}
+	return view
+}
+
+// run is the job queue runner for re-evaluations
+func (s *Service) run(ctx context.Context, job *models.Job, progress jobs.Progress) (interface{}, error) {
+	var params jobParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+
+	summary, changes, err := s.evaluate(ctx, params.Days, params.Config, progress)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().
+		Str("job_id", job.ID).
+		Int("scanned", summary.Scanned).
+		Int("injection_newly_caught", summary.InjectionNewlyCaught).
+		Int("injection_no_longer_caught", summary.InjectionNoLongerCaught).
+		Int("pii_newly_caught", summary.PIINewlyCaught).
+		Int("pii_no_longer_caught", summary.PIINoLongerCaught).
+		Msg("Re-evaluation job completed")
+	return jobResult{Summary: summary, Changes: changes}, nil
+}
+
+// evaluate scans the captured prompts of the last days days with the running
+// and the candidate configuration. Detection is compared even when it is
+// switched off in the running configuration, since the patterns are what
+// changed.
+func (s *Service) evaluate(ctx context.Context, days int, candidate models.ReevaluationConfig, progress jobs.Progress) (models.ReevaluationSummary, []models.ReevaluationItem, error) {
+	var summary models.ReevaluationSummary
+
+	captures, err := s.captures.Since(ctx, time.Now().AddDate(0, 0, -days), maxScanned+1)
+	if err != nil {
+		return summary, nil, err
+	}
+	if len(captures) > maxScanned {
+		captures = captures[:maxScanned]
+		summary.Truncated = true
+	}
+	progress(0, len(captures))
+
+	// Unknown locales are reported when the server starts
+	baseTypes, _ := pii.WithLocales(s.pii.PIITypes, s.pii.Locales)
+	patterns, piiTypes := s.security.InjectionPatterns, baseTypes
+	if candidate.InjectionPatterns != nil {
+		patterns = candidate.InjectionPatterns
+	}
+	if candidate.PIITypes != nil {
+		piiTypes = candidate.PIITypes
+	}
+	baseDetector := injection.NewDetector(s.security.InjectionPatterns, true, false)
+	baseMasker := pii.NewMasker(baseTypes, "*", false, true)
+	newDetector := injection.NewDetector(patterns, true, false)
+	newMasker := pii.NewMasker(piiTypes, "*", false, true)
+
+	changes := []models.ReevaluationItem{}
+	record := func(content *models.CapturedContent, kind, change, before, after string) {
+		switch {
+		case kind == KindInjection && change == NewlyCaught:
+			summary.InjectionNewlyCaught++
+		case kind == KindInjection:
+			summary.InjectionNoLongerCaught++
+		case change == NewlyCaught:
+			summary.PIINewlyCaught++
+		default:
+			summary.PIINoLongerCaught++
+		}
+		if len(changes) < maxChanges {
+			changes = append(changes, models.ReevaluationItem{
+				CaptureID:  content.ID,
+				RequestID:  content.RequestID,
+				UserID:     content.UserID,
+				CapturedAt: content.CreatedAt,
+				Kind:       kind,
+				Change:     change,
+				Before:     before,
+				After:      after,
+			})
+		}
+	}
+
+	for _, content := range captures {
+		if err := ctx.Err(); err != nil {
+			return summary, nil, err
+		}
+		summary.Scanned++
+		progress(summary.Scanned, len(captures))
+
+		before := baseDetector.Analyze(content.Messages)
+		after := newDetector.Analyze(content.Messages)
+		switch {
+		case !before.InjectionDetected && after.InjectionDetected:
+			record(content, KindInjection, NewlyCaught, before.ThreatLevel, after.ThreatLevel)
+		case before.InjectionDetected && !after.InjectionDetected:
+			record(content, KindInjection, NoLongerCaught, before.ThreatLevel, after.ThreatLevel)
+		}
+
+		_, beforePII := baseMasker.Mask(content.Messages)
+		_, afterPII := newMasker.Mask(content.Messages)
+		beforeTypes, afterTypes := foundTypes(beforePII), foundTypes(afterPII)
+		if slices.ContainsFunc(afterTypes, func(t string) bool { return !slices.Contains(beforeTypes, t) }) {
+			record(content, KindPII, NewlyCaught, strings.Join(beforeTypes, ","), strings.Join(afterTypes, ","))
+		}
+		if slices.ContainsFunc(beforeTypes, func(t string) bool { return !slices.Contains(afterTypes, t) }) {
+			record(content, KindPII, NoLongerCaught, strings.Join(beforeTypes, ","), strings.Join(afterTypes, ","))
+		}
+	}
+	return summary, changes, nil
+}
+
+// foundTypes lists the PII types found, sorted
+func foundTypes(report *models.PIIReport) []string {
+	types := []string{}
+	for _, match := range report.PIITypes {
+		if !slices.Contains(types, match.Type) {
+			types = append(types, match.Type)
+		}
+	}
+	slices.Sort(types)
+	return types
+}
@@ -0,0 +1,89 @@
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Archiver stores audit logs before they are purged. A batch must not be
+// considered archived until Archive returns nil.
+type Archiver interface {
+	Name() string
+	Archive(ctx context.Context, logs []models.AuditLog) error
+}
+
+// FileArchiver writes each batch as a gzipped JSON-lines file in a directory
+type FileArchiver struct {
+	dir string
+}
+
+// NewFileArchiver creates an archiver writing to dir, creating it if needed
+func NewFileArchiver(dir string) (*FileArchiver, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &FileArchiver{dir: dir}, nil
+}
+
+// Name identifies the archiver in stats and logs
+func (a *FileArchiver) Name() string {
+	return "file:" + a.dir
+}
+
+// Archive writes the logs to a new file named after the current time
+func (a *FileArchiver) Archive(ctx context.Context, logs []models.AuditLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	data, err := encodeBatch(logs)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(a.dir, batchName())
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	return f.Close()
+}
+
+// batchName names an archived batch after the current time
+func batchName() string {
+	return fmt.Sprintf("audit-%s.jsonl.gz", time.Now().UTC().Format("20060102T150405.000000000Z"))
+}
+
+// encodeBatch returns the logs as gzipped JSON lines
+func encodeBatch(logs []models.AuditLog) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for i := range logs {
+		if err := enc.Encode(&logs[i]); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,167 @@
+package retention
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/secretstore"
+)
+
+// uploadTimeout bounds each upload of an archived batch
+const uploadTimeout = time.Minute
+
+// NewArchiver returns the archiver the audit config asks for, or nil when
+// purged logs are only deleted
+func NewArchiver(cfg config.AuditConfig) (Archiver, error) {
+	targets := 0
+	for _, set := range []bool{cfg.ArchiveDir != "", cfg.S3.Bucket != "", cfg.GCS.Bucket != ""} {
+		if set {
+			targets++
+		}
+	}
+	switch {
+	case targets > 1:
+		return nil, errors.New("set only one of audit.archive_dir, audit.s3.bucket and audit.gcs.bucket")
+	case cfg.S3.Bucket != "":
+		return NewS3Archiver(cfg.S3)
+	case cfg.GCS.Bucket != "":
+		return NewGCSArchiver(cfg.GCS), nil
+	case cfg.ArchiveDir != "":
+		return NewFileArchiver(cfg.ArchiveDir)
+	}
+	return nil, nil
+}
+
+// S3Archiver uploads each batch as a gzipped JSON-lines object to an S3
+// bucket, or to a bucket of an S3-compatible store
+type S3Archiver struct {
+	cfg    config.S3ArchiveConfig
+	client *http.Client
+}
+
+// NewS3Archiver creates an archiver uploading to cfg.Bucket
+func NewS3Archiver(cfg config.S3ArchiveConfig) (*S3Archiver, error) {
+	cfg.Region = secretstore.AWSRegion(cfg.Region)
+	if cfg.Region == "" {
+		return nil, errors.New("AWS region is not set (audit.s3.region or AWS_REGION)")
+	}
+	return &S3Archiver{cfg: cfg, client: &http.Client{Timeout: uploadTimeout}}, nil
+}
+
+// Name identifies the archiver in stats and logs
+func (a *S3Archiver) Name() string {
+	return "s3://" + a.cfg.Bucket + "/" + a.cfg.Prefix
+}
+
+// objectURL returns the URL of an object: virtual-hosted on AWS, and
+// addressed by path on a custom endpoint
+func (a *S3Archiver) objectURL(key string) string {
+	if a.cfg.Endpoint != "" {
+		return strings.TrimSuffix(a.cfg.Endpoint, "/") + "/" + a.cfg.Bucket + "/" + escapeKey(key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", a.cfg.Bucket, a.cfg.Region, escapeKey(key))
+}
+
+// Archive uploads the logs to a new object named after the current time
+func (a *S3Archiver) Archive(ctx context.Context, logs []models.AuditLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	data, err := encodeBatch(logs)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.objectURL(a.cfg.Prefix+batchName()), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	sum := sha256.Sum256(data)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	if err := secretstore.SignAWS(req, data, a.cfg.Region, "s3", time.Now()); err != nil {
+		return err
+	}
+	return upload(a.client, req)
+}
+
+// GCSArchiver uploads each batch as a gzipped JSON-lines object to a Google
+// Cloud Storage bucket
+type GCSArchiver struct {
+	cfg    config.GCSArchiveConfig
+	client *http.Client
+	tokens *secretstore.GCPTokenSource
+}
+
+// NewGCSArchiver creates an archiver uploading to cfg.Bucket
+func NewGCSArchiver(cfg config.GCSArchiveConfig) *GCSArchiver {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://storage.googleapis.com"
+	}
+	client := &http.Client{Timeout: uploadTimeout}
+	return &GCSArchiver{cfg: cfg, client: client, tokens: secretstore.NewGCPTokenSource(cfg.AccessToken, client)}
+}
+
+// Name identifies the archiver in stats and logs
+func (a *GCSArchiver) Name() string {
+	return "gs://" + a.cfg.Bucket + "/" + a.cfg.Prefix
+}
+
+// Archive uploads the logs to a new object named after the current time
+func (a *GCSArchiver) Archive(ctx context.Context, logs []models.AuditLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	data, err := encodeBatch(logs)
+	if err != nil {
+		return err
+	}
+	token, err := a.tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		strings.TrimSuffix(a.cfg.Endpoint, "/"), url.PathEscape(a.cfg.Bucket), url.QueryEscape(a.cfg.Prefix+batchName()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return upload(a.client, req)
+}
+
+// upload sends an object upload and fails unless it was stored
+func upload(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to upload archive: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// escapeKey escapes each segment of an object key, keeping its slashes
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
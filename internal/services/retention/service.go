@@ -0,0 +1,284 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/rs/zerolog/log"
+)
+
+// RunResult describes a single retention pass
+type RunResult struct {
+	DryRun       bool             `json:"dry_run"`
+	StartedAt    time.Time        `json:"started_at"`
+	DurationMs   int64            `json:"duration_ms"`
+	Scanned      int64            `json:"scanned"`
+	Purged       int64            `json:"purged"`
+	Archived     int64            `json:"archived"`
+	PurgedByUser map[string]int64 `json:"purged_by_user,omitempty"`
+	Error        string           `json:"error,omitempty"`
+}
+
+// Stats summarizes retention activity since startup
+type Stats struct {
+	RetentionDays int        `json:"retention_days"`
+	DryRun        bool       `json:"dry_run"`
+	Archiver      string     `json:"archiver,omitempty"`
+	Runs          int64      `json:"runs"`
+	TotalPurged   int64      `json:"total_purged"`
+	TotalArchived int64      `json:"total_archived"`
+	LastRun       *RunResult `json:"last_run,omitempty"`
+}
+
+// Service deletes (and optionally archives) audit logs past their retention period.
+// Users targeted by a policy with DataRetentionDays use that period instead of the default.
+type Service struct {
+	cfg          config.AuditConfig
+	store        database.AuditStore
+	auditLogger  *audit.Logger
+	policyEngine *policy.Engine
+	archiver     Archiver
+	stats        Stats
+	runMu        sync.Mutex
+	mu           sync.RWMutex
+}
+
+// NewService creates a new retention service
+// store is optional - without it only the in-memory audit log is pruned
+func NewService(cfg config.AuditConfig, store database.AuditStore, logger *audit.Logger, engine *policy.Engine) *Service {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	return &Service{
+		cfg:          cfg,
+		store:        store,
+		auditLogger:  logger,
+		policyEngine: engine,
+		stats: Stats{
+			RetentionDays: cfg.RetentionDays,
+			DryRun:        cfg.DryRun,
+		},
+	}
+}
+
+// SetArchiver sets where purged logs are archived before deletion
+func (s *Service) SetArchiver(a Archiver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.archiver = a
+	if a != nil {
+		s.stats.Archiver = a.Name()
+	}
+}
+
+// Stats returns retention statistics
+func (s *Service) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats
+}
+
+// Run performs a retention pass. With dryRun set nothing is archived or deleted
+// and the result reports what would have been purged.
+func (s *Service) Run(ctx context.Context, dryRun bool) (*RunResult, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	result := &RunResult{
+		DryRun:       dryRun,
+		StartedAt:    time.Now(),
+		PurgedByUser: make(map[string]int64),
+	}
+
+	var err error
+	if cutoff, ok := s.earliestCutoff(result.StartedAt); ok {
+		expired := s.expiryCheck(ctx, result.StartedAt)
+		if s.store != nil {
+			err = s.purgeDatabase(ctx, cutoff, expired, dryRun, result)
+			if err == nil && !dryRun {
+				// Keep the in-memory buffer consistent with the database
+				s.auditLogger.Remove(expired)
+			}
+		} else {
+			err = s.purgeMemory(ctx, expired, dryRun, result)
+		}
+	}
+
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	s.stats.Runs++
+	if !dryRun {
+		s.stats.TotalPurged += result.Purged
+		s.stats.TotalArchived += result.Archived
+	}
+	s.stats.LastRun = result
+	s.mu.Unlock()
+
+	return result, err
+}
+
+// earliestCutoff returns the time before which logs may be expired for at least one user
+func (s *Service) earliestCutoff(now time.Time) (time.Time, bool) {
+	days := s.cfg.RetentionDays
+	if p := s.policyEngine.MinRetentionDays(); p > 0 && (days == 0 || p < days) {
+		days = p
+	}
+	if days <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -days), true
+}
+
+// expiryCheck returns a predicate reporting whether a log is past its user's retention period
+func (s *Service) expiryCheck(ctx context.Context, now time.Time) func(*models.AuditLog) bool {
+	retentionByUser := make(map[string]int)
+	return func(entry *models.AuditLog) bool {
+		days, ok := retentionByUser[entry.UserID]
+		if !ok {
+			days = s.policyEngine.ResolveRetentionDays(ctx, entry.UserID)
+			if days == 0 {
+				days = s.cfg.RetentionDays
+			}
+			retentionByUser[entry.UserID] = days
+		}
+		return days > 0 && entry.Timestamp.Before(now.AddDate(0, 0, -days))
+	}
+}
+
+func (s *Service) purgeDatabase(ctx context.Context, cutoff time.Time, expired func(*models.AuditLog) bool, dryRun bool, result *RunResult) error {
+	offset := 0
+	for {
+		batch, err := s.store.ListAuditLogsBefore(ctx, cutoff, s.cfg.BatchSize, offset)
+		if err != nil {
+			return err
+		}
+		result.Scanned += int64(len(batch))
+
+		var toPurge []models.AuditLog
+		for _, entry := range batch {
+			if expired(entry) {
+				toPurge = append(toPurge, *entry)
+			}
+		}
+
+		purged := 0
+		if !dryRun {
+			ids, err := s.archiveAndCollect(ctx, toPurge, result)
+			if err != nil {
+				return err
+			}
+			n, err := s.store.DeleteAuditLogs(ctx, ids)
+			if err != nil {
+				return err
+			}
+			purged = int(n)
+		}
+		s.countPurged(toPurge, result)
+
+		// Deleted rows drop out of the result set, so only skip past the kept ones
+		offset += len(batch) - purged
+		if len(batch) < s.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *Service) purgeMemory(ctx context.Context, expired func(*models.AuditLog) bool, dryRun bool, result *RunResult) error {
+	logs, _ := s.auditLogger.Export(0)
+	result.Scanned = int64(len(logs))
+
+	var toPurge []models.AuditLog
+	for i := range logs {
+		if expired(&logs[i]) {
+			toPurge = append(toPurge, logs[i])
+		}
+	}
+	s.countPurged(toPurge, result)
+	if dryRun || len(toPurge) == 0 {
+		return nil
+	}
+
+	ids, err := s.archiveAndCollect(ctx, toPurge, result)
+	if err != nil {
+		return err
+	}
+	idSet := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		idSet[id] = true
+	}
+	s.auditLogger.Remove(func(entry *models.AuditLog) bool {
+		return idSet[entry.ID]
+	})
+	return nil
+}
+
+// archiveAndCollect archives the logs (if an archiver is set) and returns their IDs.
+// Nothing is returned on failure so that unarchived logs are never deleted.
+func (s *Service) archiveAndCollect(ctx context.Context, logs []models.AuditLog, result *RunResult) ([]string, error) {
+	if len(logs) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	archiver := s.archiver
+	s.mu.RUnlock()
+
+	if archiver != nil {
+		if err := archiver.Archive(ctx, logs); err != nil {
+			return nil, err
+		}
+		result.Archived += int64(len(logs))
+	}
+
+	ids := make([]string, len(logs))
+	for i := range logs {
+		ids[i] = logs[i].ID
+	}
+	return ids, nil
+}
+
+func (s *Service) countPurged(logs []models.AuditLog, result *RunResult) {
+	for i := range logs {
+		result.Purged++
+		result.PurgedByUser[logs[i].UserID]++
+	}
+}
+
+// Start runs retention periodically until ctx is cancelled
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := s.Run(ctx, s.cfg.DryRun)
+				if err != nil {
+					log.Warn().Err(err).Msg("Audit retention run failed")
+				} else if result.Purged > 0 {
+					log.Info().
+						Bool("dry_run", result.DryRun).
+						Int64("purged", result.Purged).
+						Int64("archived", result.Archived).
+						Msg("Audit retention run completed")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// filterPattern matches the equality filters identity providers send to
+// find a resource before creating it, e.g. userName eq "ada@example.com"
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// filter is a parsed equality filter; the zero filter matches everything
+type filter struct {
+	attr  string // lower case
+	value string
+}
+
+// parseFilter parses an equality filter on one of attrs
+func parseFilter(expr string, attrs ...string) (filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return filter{}, nil
+	}
+	m := filterPattern.FindStringSubmatch(expr)
+	if m == nil {
+		return filter{}, fmt.Errorf("%w: only attribute eq \"value\" filters are supported", ErrInvalidFilter)
+	}
+	f := filter{attr: strings.ToLower(m[1])}
+	if err := json.Unmarshal([]byte(m[2]), &f.value); err != nil {
+		return filter{}, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	for _, attr := range attrs {
+		if strings.ToLower(attr) == f.attr {
+			return f, nil
+		}
+	}
+	return filter{}, fmt.Errorf("%w: can't filter on %s; use %s", ErrInvalidFilter, m[1], strings.Join(attrs, ", "))
+}
+
+// matches reports whether the value of the filter's attribute, looked up
+// with get, equals the filter's value. Values are compared ignoring case,
+// as the attributes filtered on aren't case exact, except IDs.
+func (f filter) matches(get func(attr string) string) bool {
+	if f.attr == "" {
+		return true
+	}
+	if f.attr == "id" {
+		return get(f.attr) == f.value
+	}
+	return strings.EqualFold(get(f.attr), f.value)
+}
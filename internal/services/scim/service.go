@@ -0,0 +1,804 @@
+package scim
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/tenant"
+)
+
+var (
+	// ErrNotFound is returned for users and groups that don't exist
+	ErrNotFound = errors.New("resource not found")
+
+	// ErrUniqueness is returned when a userName or group displayName is taken
+	ErrUniqueness = errors.New("resource exists")
+
+	// ErrInvalidValue is returned for resources and patches with missing or
+	// invalid values
+	ErrInvalidValue = errors.New("invalid value")
+
+	// ErrInvalidFilter is returned for filters that aren't supported
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+// Metadata keys of provisioned users
+const (
+	metadataExternalID  = "scim_external_id"
+	metadataProvisioner = "provisioned_by"
+)
+
+// BasePath is where the SCIM endpoints are served, used in resource locations
+const BasePath = "/scim/v2"
+
+// maxCount caps the page size of list queries
+const maxCount = 1000
+
+// Service maps SCIM users and groups to GoGuard users and groups. Changes
+// go to the policy engine, which applies them to requests at once, and to
+// the database when there is one.
+type Service struct {
+	engine *policy.Engine
+	users  database.UserStore
+	tenant string
+	role   models.UserRole
+
+	// mu serializes changes, as group membership is kept on users
+	mu sync.Mutex
+}
+
+// NewService creates a SCIM service provisioning into cfg's tenant. Without
+// a database, users is nil.
+func NewService(engine *policy.Engine, users database.UserStore, cfg config.SCIMConfig) *Service {
+	role := models.UserRole(cfg.DefaultRole)
+	if role == "" {
+		role = models.RoleUser
+	}
+	return &Service{
+		engine: engine,
+		users:  users,
+		tenant: tenant.Of(cfg.Tenant),
+		role:   role,
+	}
+}
+
+// Tenant returns the tenant users and groups are provisioned into
+func (s *Service) Tenant() string {
+	return s.tenant
+}
+
+// scoped confines ctx to the service's tenant
+func (s *Service) scoped(ctx context.Context) context.Context {
+	return tenant.WithScope(ctx, s.tenant)
+}
+
+// Users
+
+// ListUsers returns a page of the users matching filter, which may compare
+// userName, externalId or id. startIndex is 1-based.
+func (s *Service) ListUsers(ctx context.Context, expr string, startIndex, count int) (*ListResponse, error) {
+	f, err := parseFilter(expr, "userName", "externalId", "id")
+	if err != nil {
+		return nil, err
+	}
+	ctx = s.scoped(ctx)
+	users, err := s.engine.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupsByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users = slices.DeleteFunc(users, func(u *models.User) bool {
+		return !f.matches(func(attr string) string {
+			switch attr {
+			case "username":
+				return u.Email
+			case "externalid":
+				return u.Metadata[metadataExternalID]
+			default:
+				return u.ID
+			}
+		})
+	})
+	slices.SortFunc(users, func(a, b *models.User) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	page, start := paginate(users, startIndex, count)
+	resources := make([]*User, len(page))
+	for i, u := range page {
+		resources[i] = toUser(u, groups)
+	}
+	return &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(users),
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+// GetUser returns a user
+func (s *Service) GetUser(ctx context.Context, id string) (*User, error) {
+	ctx = s.scoped(ctx)
+	u, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.groupsByName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return toUser(u, groups), nil
+}
+
+// CreateUser provisions a user with the default role
+func (s *Service) CreateUser(ctx context.Context, in *User) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &models.User{Role: s.role, Status: "active", Groups: []string{}, Metadata: map[string]string{metadataProvisioner: "scim"}}
+	if err := fromUser(in, u); err != nil {
+		return nil, err
+	}
+	if err := s.checkUserName(u.Email, ""); err != nil {
+		return nil, err
+	}
+
+	ctx = s.scoped(ctx)
+	u.TenantID = s.tenant
+	if s.users != nil {
+		if err := s.users.CreateUser(ctx, u); err != nil {
+			return nil, fmt.Errorf("failed to store user: %w", err)
+		}
+	}
+	created, err := s.engine.CreateUser(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, created.ID)
+}
+
+// ReplaceUser replaces a user's userName, name, externalId and active flag.
+// Their role and groups are kept.
+func (s *Service) ReplaceUser(ctx context.Context, id string, in *User) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	existing, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateUser(ctx, existing, in); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, id)
+}
+
+// PatchUser applies add, remove and replace operations to a user's
+// userName, name, displayName, externalId and active flag. Other attributes
+// are ignored.
+func (s *Service) PatchUser(ctx context.Context, id string, patch *PatchRequest) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	existing, err := s.user(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	in := toUser(existing, nil)
+	for _, op := range patch.Operations {
+		if err := patchUser(in, op); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.updateUser(ctx, existing, in); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, id)
+}
+
+// DeactivateUser marks a user inactive, which denies their requests. The
+// user and their usage history are kept.
+func (s *Service) DeactivateUser(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	existing, err := s.user(ctx, id)
+	if err != nil {
+		return err
+	}
+	updated := *existing
+	updated.Status = "inactive"
+	return s.saveUser(ctx, &updated)
+}
+
+func (s *Service) user(ctx context.Context, id string) (*models.User, error) {
+	u, err := s.engine.GetUser(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: user %s", ErrNotFound, id)
+	}
+	return u, nil
+}
+
+// updateUser applies in to a copy of existing and saves it
+func (s *Service) updateUser(ctx context.Context, existing *models.User, in *User) error {
+	updated := *existing
+	updated.Metadata = make(map[string]string, len(existing.Metadata)+1)
+	for k, v := range existing.Metadata {
+		updated.Metadata[k] = v
+	}
+	if err := fromUser(in, &updated); err != nil {
+		return err
+	}
+	if err := s.checkUserName(updated.Email, existing.ID); err != nil {
+		return err
+	}
+	return s.saveUser(ctx, &updated)
+}
+
+// saveUser stores a changed user
+func (s *Service) saveUser(ctx context.Context, u *models.User) error {
+	if s.users != nil {
+		if err := s.users.UpdateUser(ctx, u); err != nil {
+			return fmt.Errorf("failed to store user: %w", err)
+		}
+	}
+	_, err := s.engine.UpdateUser(ctx, u)
+	return err
+}
+
+// checkUserName refuses emails taken by another user of any tenant, as
+// the database keeps them unique
+func (s *Service) checkUserName(email, id string) error {
+	users, err := s.engine.ListUsers(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.ID != id && strings.EqualFold(u.Email, email) {
+			return fmt.Errorf("%w: userName %s is taken", ErrUniqueness, email)
+		}
+	}
+	return nil
+}
+
+// fromUser copies the attributes of a SCIM user to u
+func fromUser(in *User, u *models.User) error {
+	if in.UserName == "" {
+		return fmt.Errorf("%w: userName is required", ErrInvalidValue)
+	}
+	u.Email = in.UserName
+
+	switch {
+	case in.Name != nil && in.Name.Formatted != "":
+		u.Name = in.Name.Formatted
+	case in.Name != nil && (in.Name.GivenName != "" || in.Name.FamilyName != ""):
+		u.Name = strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+	case in.DisplayName != "":
+		u.Name = in.DisplayName
+	case u.Name == "":
+		u.Name = in.UserName
+	}
+
+	if in.Active != nil {
+		u.Status = "inactive"
+		if *in.Active {
+			u.Status = "active"
+		}
+	}
+
+	if u.Metadata == nil {
+		u.Metadata = make(map[string]string)
+	}
+	if in.ExternalID != "" {
+		u.Metadata[metadataExternalID] = in.ExternalID
+	} else {
+		delete(u.Metadata, metadataExternalID)
+	}
+	return nil
+}
+
+// toUser returns the SCIM representation of u. Its groups are listed when
+// groups, keyed by name, is given.
+func toUser(u *models.User, groups map[string]*models.Group) *User {
+	active := u.Status == "" || u.Status == "active"
+	out := &User{
+		Schemas:     []string{SchemaUser},
+		ID:          u.ID,
+		ExternalID:  u.Metadata[metadataExternalID],
+		UserName:    u.Email,
+		Name:        &Name{Formatted: u.Name},
+		DisplayName: u.Name,
+		Emails:      []Email{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			Location:     BasePath + "/Users/" + u.ID,
+		},
+	}
+	for _, name := range u.Groups {
+		if g, ok := groups[name]; ok {
+			out.Groups = append(out.Groups, MemberRef{Value: g.ID, Display: g.Name, Ref: BasePath + "/Groups/" + g.ID})
+		}
+	}
+	return out
+}
+
+// patchUser applies one patch operation to in
+func patchUser(in *User, op PatchOp) error {
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		return setUserAttr(in, op.Path, nil)
+	default:
+		return fmt.Errorf("%w: unknown patch op %q", ErrInvalidValue, op.Op)
+	}
+	if op.Path != "" {
+		return setUserAttr(in, op.Path, op.Value)
+	}
+	values, ok := op.Value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: patch without a path needs an object value", ErrInvalidValue)
+	}
+	for attr, value := range values {
+		if err := setUserAttr(in, attr, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setUserAttr sets or, for a nil value, clears an attribute of in.
+// Attributes GoGuard doesn't keep are ignored.
+func setUserAttr(in *User, attr string, value interface{}) error {
+	str, _ := value.(string)
+	name := func() *Name {
+		if in.Name == nil {
+			in.Name = &Name{}
+		}
+		return in.Name
+	}
+
+	switch strings.ToLower(attr) {
+	case "active":
+		active, err := boolValue(value)
+		if err != nil {
+			return err
+		}
+		in.Active = &active
+	case "username":
+		in.UserName = str
+	case "externalid":
+		in.ExternalID = str
+	case "displayname":
+		in.DisplayName = str
+		if in.Name != nil {
+			in.Name.Formatted = ""
+		}
+	case "name":
+		fields, _ := value.(map[string]interface{})
+		in.Name = &Name{}
+		for k, v := range fields {
+			if err := setUserAttr(in, "name."+k, v); err != nil {
+				return err
+			}
+		}
+	case "name.formatted":
+		name().Formatted = str
+	case "name.givenname":
+		name().GivenName = str
+		name().Formatted = ""
+	case "name.familyname":
+		name().FamilyName = str
+		name().Formatted = ""
+	}
+	return nil
+}
+
+// boolValue reads a boolean sent as a JSON boolean or, by some identity
+// providers, as a string
+func boolValue(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%w: active must be true or false", ErrInvalidValue)
+}
+
+// Groups
+
+// ListGroups returns a page of the groups matching filter, which may
+// compare displayName or id. startIndex is 1-based.
+func (s *Service) ListGroups(ctx context.Context, expr string, startIndex, count int) (*ListResponse, error) {
+	f, err := parseFilter(expr, "displayName", "id")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.engine.ListGroups(s.scoped(ctx))
+	if err != nil {
+		return nil, err
+	}
+	groups = slices.DeleteFunc(groups, func(g *models.Group) bool {
+		return !f.matches(func(attr string) string {
+			if attr == "displayname" {
+				return g.Name
+			}
+			return g.ID
+		})
+	})
+
+	page, start := paginate(groups, startIndex, count)
+	resources := make([]*Group, len(page))
+	for i, g := range page {
+		resources[i] = toGroup(g)
+	}
+	return &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(groups),
+		StartIndex:   start,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, nil
+}
+
+// GetGroup returns a group and its members
+func (s *Service) GetGroup(ctx context.Context, id string) (*Group, error) {
+	g, err := s.group(s.scoped(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	return toGroup(g), nil
+}
+
+// CreateGroup provisions a group, adding its members to it
+func (s *Service) CreateGroup(ctx context.Context, in *Group) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	if in.DisplayName == "" {
+		return nil, fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+	}
+	if err := s.checkDisplayName(ctx, in.DisplayName, ""); err != nil {
+		return nil, err
+	}
+	members, err := s.memberIDs(ctx, in.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &models.Group{Name: in.DisplayName, TenantID: s.tenant}
+	if s.users != nil {
+		if err := s.users.CreateGroup(ctx, g); err != nil {
+			return nil, fmt.Errorf("failed to store group: %w", err)
+		}
+	}
+	created, err := s.engine.CreateGroup(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setMembers(ctx, created.Name, created.Members, members); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, created.ID)
+}
+
+// ReplaceGroup renames a group and replaces its members
+func (s *Service) ReplaceGroup(ctx context.Context, id string, in *Group) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	existing, err := s.group(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.memberIDs(ctx, in.Members)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateGroup(ctx, existing, in.DisplayName, members); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, id)
+}
+
+// PatchGroup applies add, remove and replace operations to a group's
+// displayName and members
+func (s *Service) PatchGroup(ctx context.Context, id string, patch *PatchRequest) (*Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	existing, err := s.group(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	name, members := existing.Name, slices.Clone(existing.Members)
+	for _, op := range patch.Operations {
+		if name, members, err = s.patchGroup(ctx, name, members, op); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.updateGroup(ctx, existing, name, members); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, id)
+}
+
+// DeleteGroup removes a group and takes its members out of it
+func (s *Service) DeleteGroup(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx = s.scoped(ctx)
+	existing, err := s.group(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.setMembers(ctx, existing.Name, existing.Members, nil); err != nil {
+		return err
+	}
+	if s.users != nil {
+		if err := s.users.DeleteGroup(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete group: %w", err)
+		}
+	}
+	return s.engine.DeleteGroup(ctx, id)
+}
+
+func (s *Service) group(ctx context.Context, id string) (*models.Group, error) {
+	g, err := s.engine.GetGroup(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: group %s", ErrNotFound, id)
+	}
+	return g, nil
+}
+
+// groupsByName returns the groups of the service's tenant by name
+func (s *Service) groupsByName(ctx context.Context) (map[string]*models.Group, error) {
+	groups, err := s.engine.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*models.Group, len(groups))
+	for _, g := range groups {
+		byName[g.Name] = g
+	}
+	return byName, nil
+}
+
+// checkDisplayName refuses names taken by another group of the tenant
+func (s *Service) checkDisplayName(ctx context.Context, name, id string) error {
+	groups, err := s.groupsByName(ctx)
+	if err != nil {
+		return err
+	}
+	if g, ok := groups[name]; ok && g.ID != id {
+		return fmt.Errorf("%w: displayName %s is taken", ErrUniqueness, name)
+	}
+	return nil
+}
+
+// memberIDs returns the user IDs of refs, which must be users of the tenant
+func (s *Service) memberIDs(ctx context.Context, refs []MemberRef) ([]string, error) {
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if _, err := s.engine.GetUser(ctx, ref.Value); err != nil {
+			return nil, fmt.Errorf("%w: member %s is not a user", ErrInvalidValue, ref.Value)
+		}
+		if !slices.Contains(ids, ref.Value) {
+			ids = append(ids, ref.Value)
+		}
+	}
+	return ids, nil
+}
+
+// updateGroup renames existing to name, moving its members along, and
+// then makes members its members
+func (s *Service) updateGroup(ctx context.Context, existing *models.Group, name string, members []string) error {
+	if name == "" {
+		return fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+	}
+	current := existing.Members
+	if name != existing.Name {
+		if err := s.checkDisplayName(ctx, name, existing.ID); err != nil {
+			return err
+		}
+		for _, id := range current {
+			if err := s.renameMembership(ctx, id, existing.Name, name); err != nil {
+				return err
+			}
+		}
+		updated := *existing
+		updated.Name = name
+		if s.users != nil {
+			if err := s.users.UpdateGroup(ctx, &updated); err != nil {
+				return fmt.Errorf("failed to store group: %w", err)
+			}
+		}
+		if _, err := s.engine.UpdateGroup(ctx, &updated); err != nil {
+			return err
+		}
+	}
+	return s.setMembers(ctx, name, current, members)
+}
+
+// setMembers makes the users of want, and no longer those of current,
+// members of the group name
+func (s *Service) setMembers(ctx context.Context, name string, current, want []string) error {
+	for _, id := range want {
+		if !slices.Contains(current, id) {
+			if err := s.renameMembership(ctx, id, "", name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range current {
+		if !slices.Contains(want, id) {
+			if err := s.renameMembership(ctx, id, name, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renameMembership replaces the group from in a user's groups with to.
+// An empty from adds to, an empty to removes from.
+func (s *Service) renameMembership(ctx context.Context, userID, from, to string) error {
+	u, err := s.user(ctx, userID)
+	if err != nil {
+		return err
+	}
+	updated := *u
+	updated.Groups = slices.DeleteFunc(slices.Clone(u.Groups), func(g string) bool { return g == from || g == to })
+	if to != "" {
+		updated.Groups = append(updated.Groups, to)
+	}
+	return s.saveUser(ctx, &updated)
+}
+
+// patchGroup applies one patch operation to a group's name and members
+func (s *Service) patchGroup(ctx context.Context, name string, members []string, op PatchOp) (string, []string, error) {
+	path := strings.ToLower(strings.TrimSpace(op.Path))
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+		replace := strings.EqualFold(op.Op, "replace")
+		switch path {
+		case "":
+			values, ok := op.Value.(map[string]interface{})
+			if !ok {
+				return "", nil, fmt.Errorf("%w: patch without a path needs an object value", ErrInvalidValue)
+			}
+			var err error
+			for attr, value := range values {
+				if name, members, err = s.patchGroup(ctx, name, members, PatchOp{Op: op.Op, Path: attr, Value: value}); err != nil {
+					return "", nil, err
+				}
+			}
+			return name, members, nil
+		case "displayname":
+			str, ok := op.Value.(string)
+			if !ok {
+				return "", nil, fmt.Errorf("%w: displayName must be a string", ErrInvalidValue)
+			}
+			return str, members, nil
+		case "members":
+			ids, err := s.memberIDs(ctx, memberRefs(op.Value))
+			if err != nil {
+				return "", nil, err
+			}
+			if replace {
+				return name, ids, nil
+			}
+			for _, id := range ids {
+				if !slices.Contains(members, id) {
+					members = append(members, id)
+				}
+			}
+			return name, members, nil
+		}
+		// Attributes GoGuard doesn't keep, such as externalId, are ignored
+		return name, members, nil
+	case "remove":
+		switch {
+		case path == "members" && op.Value == nil:
+			return name, nil, nil
+		case path == "members":
+			for _, ref := range memberRefs(op.Value) {
+				members = slices.DeleteFunc(members, func(id string) bool { return id == ref.Value })
+			}
+			return name, members, nil
+		case strings.HasPrefix(path, "members["):
+			expr := strings.TrimSuffix(strings.TrimSpace(op.Path)[len("members["):], "]")
+			f, err := parseFilter(expr, "value")
+			if err != nil {
+				return "", nil, err
+			}
+			return name, slices.DeleteFunc(members, func(id string) bool { return id == f.value }), nil
+		case path == "displayname":
+			return "", nil, fmt.Errorf("%w: displayName is required", ErrInvalidValue)
+		}
+		return name, members, nil
+	}
+	return "", nil, fmt.Errorf("%w: unknown patch op %q", ErrInvalidValue, op.Op)
+}
+
+// memberRefs reads the member references of a patch value, a list of
+// {"value": id} objects
+func memberRefs(value interface{}) []MemberRef {
+	items, _ := value.([]interface{})
+	refs := make([]MemberRef, 0, len(items))
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			if id, ok := m["value"].(string); ok {
+				refs = append(refs, MemberRef{Value: id})
+			}
+		}
+	}
+	return refs
+}
+
+// toGroup returns the SCIM representation of g
+func toGroup(g *models.Group) *Group {
+	updated := g.UpdatedAt
+	out := &Group{
+		Schemas:     []string{SchemaGroup},
+		ID:          g.ID,
+		DisplayName: g.Name,
+		Members:     make([]MemberRef, 0, len(g.Members)),
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: &updated,
+			Location:     BasePath + "/Groups/" + g.ID,
+		},
+	}
+	for _, id := range g.Members {
+		out.Members = append(out.Members, MemberRef{Value: id, Ref: BasePath + "/Users/" + id})
+	}
+	return out
+}
+
+// paginate returns the page of items starting at the 1-based startIndex,
+// of at most count items, and the start index used. A negative count, for
+// requests without one, returns up to maxCount items.
+func paginate[T any](items []T, startIndex, count int) ([]T, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 || count > maxCount {
+		count = maxCount
+	}
+	from := min(startIndex-1, len(items))
+	to := min(from+count, len(items))
+	return items[from:to], startIndex
+}
@@ -0,0 +1,187 @@
+package secrets
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Actions taken on requests with secrets
+const (
+	ActionBlock = "block" // refuse the request
+	ActionMask  = "mask"  // replace each secret with [SECRET:<TYPE>]
+	ActionWarn  = "warn"  // forward the request with the report
+)
+
+// previewLength is how much of a secret the report shows
+const previewLength = 4
+
+// Detector finds credentials in messages
+type Detector struct {
+	enabled    bool
+	action     string
+	minEntropy float64
+	rules      []rule
+}
+
+// NewDetector creates a detector running the configured types
+func NewDetector(cfg config.SecretsConfig) *Detector {
+	switch cfg.Action {
+	case ActionBlock, ActionMask, ActionWarn:
+	default:
+		log.Warn().Str("action", cfg.Action).Msg("Unknown secrets action - blocking requests with secrets")
+		cfg.Action = ActionBlock
+	}
+
+	d := &Detector{enabled: cfg.Enabled, action: cfg.Action, minEntropy: cfg.MinEntropy}
+	for _, t := range cfg.Types {
+		if !slices.Contains(Types(), t) {
+			log.Warn().Str("type", t).Strs("types", Types()).Msg("Ignoring unknown secret type")
+		}
+	}
+	for _, r := range rules {
+		if len(cfg.Types) == 0 || slices.Contains(cfg.Types, r.name) {
+			d.rules = append(d.rules, r)
+		}
+	}
+	return d
+}
+
+// Action returns what is done with requests containing secrets
+func (d *Detector) Action() string {
+	return d.action
+}
+
+// Scan looks for secrets in the text and tool call arguments of messages.
+// With the mask action the returned messages have them replaced; otherwise
+// they are the messages given.
+func (d *Detector) Scan(messages []models.Message) ([]models.Message, *models.SecretsReport) {
+	report := &models.SecretsReport{}
+	if !d.enabled {
+		return messages, report
+	}
+
+	scanned := make([]models.Message, len(messages))
+	for i, msg := range messages {
+		location := strings.ToLower(msg.Role) + "_message_" + strconv.Itoa(i)
+		if len(msg.Parts) == 0 {
+			msg.Content = d.scanText(msg.Content, location, report)
+		} else {
+			parts := make([]models.ContentPart, len(msg.Parts))
+			for j, part := range msg.Parts {
+				if part.Type == models.PartText {
+					part.Text = d.scanText(part.Text, location, report)
+				}
+				parts[j] = part
+			}
+			msg.Parts = parts
+			msg.Content = models.JoinText(parts)
+		}
+		if len(msg.ToolCalls) > 0 {
+			calls := make([]models.ToolCall, len(msg.ToolCalls))
+			for j, call := range msg.ToolCalls {
+				call.Function.Arguments = d.scanText(call.Function.Arguments, location+".tool_calls["+call.Function.Name+"]", report)
+				calls[j] = call
+			}
+			msg.ToolCalls = calls
+		}
+		scanned[i] = msg
+	}
+
+	report.SecretCount = len(report.Findings)
+	report.SecretsDetected = report.SecretCount > 0
+	if !report.SecretsDetected {
+		return messages, report
+	}
+	report.Action = d.action
+	if d.action != ActionMask {
+		return messages, report
+	}
+	return scanned, report
+}
+
+// span is a secret found in a text
+type span struct {
+	rule       string
+	start, end int
+	entropy    float64
+}
+
+// scanText adds the secrets in text to the report and returns text with
+// them masked
+func (d *Detector) scanText(text, location string, report *models.SecretsReport) string {
+	if text == "" {
+		return text
+	}
+
+	var spans []span
+	for _, r := range d.rules {
+		for _, loc := range r.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			value := text[start:end]
+			if r.valid != nil && !r.valid(value) {
+				continue
+			}
+			s := span{rule: r.name, start: start, end: end}
+			if r.entropy {
+				s.entropy = entropy(value)
+				if s.entropy < d.minEntropy {
+					continue
+				}
+			}
+			if !overlaps(spans, s) {
+				spans = append(spans, s)
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return text
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		report.Findings = append(report.Findings, models.SecretFinding{
+			Type:          s.rule,
+			Preview:       preview(text[s.start:s.end]),
+			Location:      location,
+			Entropy:       math.Round(s.entropy*100) / 100,
+			StartPosition: s.start,
+			EndPosition:   s.end,
+		})
+		b.WriteString(text[last:s.start])
+		b.WriteString("[SECRET:" + strings.ToUpper(s.rule) + "]")
+		last = s.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func overlaps(spans []span, s span) bool {
+	for _, o := range spans {
+		if s.start < o.end && o.start < s.end {
+			return true
+		}
+	}
+	return false
+}
+
+// preview shows the start of a secret, enough to identify a key without
+// making it usable
+func preview(value string) string {
+	if len(value) <= previewLength*2 {
+		return strings.Repeat("*", len(value))
+	}
+	return value[:previewLength] + strings.Repeat("*", 8)
+}
@@ -0,0 +1,96 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// rule finds one type of secret. When the pattern has a capture group, the
+// group is the secret and the rest is context, such as the user name of a
+// connection string, which is left alone.
+type rule struct {
+	name    string
+	re      *regexp.Regexp
+	entropy bool                    // the secret must look random
+	valid   func(value string) bool // extra check against false positives
+}
+
+// rules are tried in order; a later rule's match overlapping an earlier
+// one's is dropped, so specific patterns come before generic ones
+var rules = []rule{
+	{name: "private_key", re: regexp.MustCompile(`(?s)-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----.*?(?:-----END (?:[A-Z0-9]+ )*PRIVATE KEY-----|$)`)},
+	{name: "gcp_service_account", re: regexp.MustCompile(`"private_key_id"\s*:\s*"([a-f0-9]{40})"`)},
+	{name: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "aws_secret_key", re: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|key).{0,20}?[:=]\s*["']?([A-Za-z0-9/+]{40})\b`), entropy: true},
+	{name: "github_token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,251}|github_pat_[A-Za-z0-9_]{22,242})\b`), entropy: true},
+	{name: "slack_token", re: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}\b`)},
+	{name: "slack_webhook", re: regexp.MustCompile(`https://hooks\.slack\.com/services/T[A-Z0-9]+/B[A-Z0-9]+/[A-Za-z0-9]+`)},
+	{name: "gcp_api_key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{name: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`), valid: isJWT},
+	{name: "connection_string", re: regexp.MustCompile(`\b(?:postgres(?:ql)?|mysql|mariadb|mongodb(?:\+srv)?|rediss?|amqps?|mssql|sqlserver)://[^\s:/@]+:([^\s@/]+)@[^\s/]+`), valid: notPlaceholder},
+	{name: "generic_secret", re: regexp.MustCompile(`(?i)\b(?:api[_-]?key|secret[_-]?key|client[_-]?secret|access[_-]?token|auth[_-]?token|private[_-]?token|secret)["']?\s*[:=]\s*["']?([A-Za-z0-9_\-/+=.]{16,})`), entropy: true, valid: notPlaceholder},
+}
+
+// Types are the detectors, in the order they run
+func Types() []string {
+	names := make([]string, len(rules))
+	for i, r := range rules {
+		names[i] = r.name
+	}
+	return names
+}
+
+// PatternID returns the pattern ID of a secret type, under which feedback on
+// its findings is counted
+func PatternID(secretType string) string {
+	return "secret_" + secretType
+}
+
+// isJWT checks that a token's header decodes to JSON naming an algorithm
+func isJWT(token string) bool {
+	header, _, _ := strings.Cut(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(data, &h) == nil && h.Alg != ""
+}
+
+// placeholders are words that mark a value as an example to fill in
+var placeholders = []string{"example", "placeholder", "changeme", "your", "xxxx", "****", "<", "${", "{{", "$("}
+
+func notPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return false
+		}
+	}
+	return lower != "password" && lower != "pass" && lower != "secret"
+}
+
+// entropy is the Shannon entropy of s in bits per character. Random
+// base64 runs to about 5; words and repeated characters stay well below 3.5.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,157 @@
+package settings
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrInvalidModelAlias is returned for aliases with missing or invalid fields
+	ErrInvalidModelAlias = errors.New("invalid model alias")
+
+	// ErrModelAliasNotFound is returned for aliases that don't exist
+	ErrModelAliasNotFound = errors.New("model alias not found")
+)
+
+// aliasPattern is the form of alias names, which clients send as the model
+// of their requests
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/-]{0,127}$`)
+
+// GetModelAliases returns all model aliases by name
+func (s *Service) GetModelAliases(ctx context.Context) (map[string]*models.ModelAlias, error) {
+	var cached map[string]*models.ModelAlias
+	if s.getCached(ctx, cacheKeyAliases, &cached) {
+		return cached, nil
+	}
+
+	aliases := make(map[string]*models.ModelAlias)
+
+	if s.store != nil {
+		if val, err := s.getSetting(ctx, "model_aliases"); err == nil && val != nil {
+			raw, _ := json.Marshal(val)
+			if err := json.Unmarshal(raw, &aliases); err != nil {
+				return nil, fmt.Errorf("failed to decode model aliases: %w", err)
+			}
+		}
+	}
+
+	s.setCached(ctx, cacheKeyAliases, aliases)
+
+	return aliases, nil
+}
+
+// ListModelAliases returns all model aliases sorted by name
+func (s *Service) ListModelAliases(ctx context.Context) ([]*models.ModelAlias, error) {
+	aliases, err := s.GetModelAliases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*models.ModelAlias, 0, len(aliases))
+	for _, a := range aliases {
+		list = append(list, a)
+	}
+	slices.SortFunc(list, func(a, b *models.ModelAlias) int { return cmp.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+// LookupModelAlias implements the llm.SettingsProvider interface
+// Returns the alias a request's model names, if it names one
+func (s *Service) LookupModelAlias(ctx context.Context, name string) (*models.ModelAlias, bool) {
+	if name == "" {
+		return nil, false
+	}
+	aliases, err := s.GetModelAliases(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read model aliases")
+		return nil, false
+	}
+	alias, ok := aliases[name]
+	return alias, ok
+}
+
+// SaveModelAlias creates or replaces a model alias. The model can't be
+// another alias, and the profile, if any, must exist.
+func (s *Service) SaveModelAlias(ctx context.Context, alias *models.ModelAlias) error {
+	if !aliasPattern.MatchString(alias.Name) {
+		return fmt.Errorf("%w: name must be 1 to 128 letters, digits and . _ : / -", ErrInvalidModelAlias)
+	}
+	if alias.Model == "" {
+		return fmt.Errorf("%w: model is required", ErrInvalidModelAlias)
+	}
+	aliases, err := s.GetModelAliases(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[alias.Model]; ok || alias.Model == alias.Name {
+		return fmt.Errorf("%w: model %s is an alias", ErrInvalidModelAlias, alias.Model)
+	}
+	for _, other := range aliases {
+		if other.Model == alias.Name && other.Name != alias.Name {
+			return fmt.Errorf("%w: alias %s stands for model %s", ErrInvalidModelAlias, other.Name, alias.Name)
+		}
+	}
+	if alias.LLMProfile != "" && alias.LLMProfile != DefaultLLMProfile {
+		profiles, err := s.GetLLMProfiles(ctx)
+		if err != nil {
+			return err
+		}
+		if _, ok := profiles[alias.LLMProfile]; !ok {
+			return fmt.Errorf("%w: LLM profile not found: %s", ErrInvalidModelAlias, alias.LLMProfile)
+		}
+	}
+
+	updated := make(map[string]*models.ModelAlias, len(aliases)+1)
+	for k, v := range aliases {
+		updated[k] = v
+	}
+	stored := *alias
+	stored.UpdatedAt = time.Now().UTC()
+	updated[alias.Name] = &stored
+
+	if err := s.store.SetSetting(ctx, "model_aliases", updated); err != nil {
+		return err
+	}
+	alias.UpdatedAt = stored.UpdatedAt
+
+	s.invalidate(ctx, cacheKeyAliases)
+
+	log.Info().Str("alias", alias.Name).Str("model", alias.Model).Str("profile", alias.LLMProfile).Msg("Model alias saved")
+	return nil
+}
+
+// DeleteModelAlias removes a model alias. Requests still sending it go to a
+// model of that name.
+func (s *Service) DeleteModelAlias(ctx context.Context, name string) error {
+	aliases, err := s.GetModelAliases(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrModelAliasNotFound, name)
+	}
+
+	updated := make(map[string]*models.ModelAlias, len(aliases))
+	for k, v := range aliases {
+		if k != name {
+			updated[k] = v
+		}
+	}
+
+	if err := s.store.SetSetting(ctx, "model_aliases", updated); err != nil {
+		return err
+	}
+
+	s.invalidate(ctx, cacheKeyAliases)
+
+	log.Info().Str("alias", name).Msg("Model alias deleted")
+	return nil
+}
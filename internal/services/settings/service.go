@@ -2,17 +2,60 @@ package settings
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/config"
 	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
 	"github.com/rs/zerolog/log"
 )
 
-// Service manages application settings with database persistence
+// DefaultLLMProfile is the name of the profile backed by the top-level LLM settings
+const DefaultLLMProfile = "default"
+
+// Cache keys for settings read from the database
+const (
+	cacheKeyLLMSettings = "llm_settings"
+	cacheKeyLLMProfiles = "llm_profiles"
+	cacheKeyModeration  = "moderation"
+	cacheKeyPII         = "pii_settings"
+	cacheKeyAliases     = "model_aliases"
+)
+
+// Service manages application settings, persisted in a settings store
 type Service struct {
-	repo  *database.Repository
-	cache map[string]interface{}
-	mu    sync.RWMutex
+	store     database.SettingsStore
+	cache     cache.Cache
+	llmStatus map[string]*LLMStatus
+	mu        sync.RWMutex
+
+	// lastKnown holds the last value read of each setting, nil for settings
+	// that weren't saved, served while the database is unreachable
+	lastKnown map[string]interface{}
+
+	// llmKeys holds the stored API keys of the LLM settings cached under
+	// each cache key, by profile. They are left out of the cache, which may
+	// be shared, and read again with the settings when it misses.
+	llmKeys map[string]map[string]string
+
+	// secrets resolves secret:// references saved as API keys
+	secrets SecretResolver
+	// encrypter encrypts API keys before they are stored
+	encrypter Encrypter
+
+	// securityDefaults fills in security settings that were never saved
+	securityDefaults SecuritySettings
+	// securityChanged wakes WatchSecuritySettings after a local change
+	securityChanged chan struct{}
+	// piiChanged wakes WatchPIISettings after a local change
+	piiChanged chan struct{}
 }
 
 // LLMSettings holds LLM configuration
@@ -25,6 +68,8 @@ type LLMSettings struct {
 	Temperature float64 `json:"temperature"`
 	// AWS Bedrock specific
 	AWSRegion string `json:"aws_region"`
+	// Status is the last validation result; populated on read, ignored on write
+	Status *LLMStatus `json:"status,omitempty"`
 }
 
 // SecuritySettings holds security configuration
@@ -33,6 +78,26 @@ type SecuritySettings struct {
 	BlockOnDetection          bool `json:"block_on_detection"`
 	PIIMaskingEnabled         bool `json:"pii_masking_enabled"`
 	RateLimitPerMinute        int  `json:"rate_limit_per_minute"`
+	// LLM requests in flight per user and per API key (0 = unlimited), and
+	// how long requests over a limit wait for a slot
+	MaxConcurrentPerUser      int `json:"max_concurrent_per_user"`
+	MaxConcurrentPerKey       int `json:"max_concurrent_per_key"`
+	ConcurrencyQueueTimeoutMs int `json:"concurrency_queue_timeout_ms"`
+
+	// Moderation overrides the moderation config file settings once saved
+	Moderation *models.ModerationSettings `json:"moderation,omitempty"`
+}
+
+// SecretResolver resolves secret:// references, returning other values as is
+type SecretResolver interface {
+	Resolve(ctx context.Context, value string) (string, error)
+}
+
+// Encrypter encrypts sensitive settings before they are stored. Decrypt
+// returns values that aren't encrypted as they are.
+type Encrypter interface {
+	Encrypt(ctx context.Context, plaintext string) (string, error)
+	Decrypt(ctx context.Context, value string) (string, error)
 }
 
 // NotificationSettings holds notification configuration
@@ -41,12 +106,207 @@ type NotificationSettings struct {
 	EmailRecipients []string `json:"email_recipients"`
 }
 
-// NewService creates a new settings service
-func NewService(repo *database.Repository) *Service {
+// NewService creates a settings service saving to store, which is the
+// database or, without one, memory. A nil store saves nothing.
+func NewService(store database.SettingsStore) *Service {
 	return &Service{
-		repo:  repo,
-		cache: make(map[string]interface{}),
+		store:     store,
+		cache:     cache.NewMemory(time.Minute),
+		llmStatus: make(map[string]*LLMStatus),
+		lastKnown: make(map[string]interface{}),
+		llmKeys:   make(map[string]map[string]string),
+		securityDefaults: SecuritySettings{
+			InjectionDetectionEnabled: true,
+			BlockOnDetection:          true,
+			PIIMaskingEnabled:         true,
+			RateLimitPerMinute:        100,
+		},
+		securityChanged: make(chan struct{}, 1),
+		piiChanged:      make(chan struct{}, 1),
+	}
+}
+
+// SetSecurityDefaults sets the security settings in effect until others are
+// saved, normally those of the config file. A running WatchSecuritySettings
+// picks up the change.
+func (s *Service) SetSecurityDefaults(defaults SecuritySettings) {
+	defaults.Moderation = nil
+	s.mu.Lock()
+	s.securityDefaults = defaults
+	s.mu.Unlock()
+	s.notifySecurityChanged()
+}
+
+// notifySecurityChanged wakes WatchSecuritySettings
+func (s *Service) notifySecurityChanged() {
+	notify(s.securityChanged)
+}
+
+func notify(changed chan struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// SetCache replaces the default in-memory settings cache, e.g. with a shared Redis cache
+func (s *Service) SetCache(c cache.Cache) {
+	s.cache = c
+}
+
+// SetSecretResolver lets API keys be saved as secret:// references, which
+// are resolved whenever a client is configured, so the keys themselves are
+// never stored or cached
+func (s *Service) SetSecretResolver(r SecretResolver) {
+	s.secrets = r
+}
+
+// SetEncrypter encrypts API keys before they are stored. Stored keys are
+// decrypted where they are used.
+func (s *Service) SetEncrypter(e Encrypter) {
+	s.encrypter = e
+}
+
+// encrypt returns an API key as it is stored
+func (s *Service) encrypt(ctx context.Context, value string) (string, error) {
+	if s.encrypter == nil {
+		return value, nil
+	}
+	return s.encrypter.Encrypt(ctx, value)
+}
+
+// resolveSecret returns the secret a stored API key holds or refers to
+func (s *Service) resolveSecret(ctx context.Context, value string) (string, error) {
+	if s.encrypter != nil {
+		decrypted, err := s.encrypter.Decrypt(ctx, value)
+		if err != nil {
+			return "", fmt.Errorf("decrypt API key: %w", err)
+		}
+		value = decrypted
+	}
+	if s.secrets == nil {
+		return value, nil
 	}
+	return s.secrets.Resolve(ctx, value)
+}
+
+// getCached decodes a cached value, treating cache errors as misses
+func (s *Service) getCached(ctx context.Context, key string, dest interface{}) bool {
+	found, err := s.cache.Get(ctx, key, dest)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Settings cache read failed")
+		return false
+	}
+	return found
+}
+
+// setCached stores a value, logging cache errors. Values read while the
+// database is unreachable aren't cached, so saved ones are read again as soon
+// as it is back.
+func (s *Service) setCached(ctx context.Context, key string, value interface{}) {
+	if s.store != nil && s.store.Degraded() {
+		return
+	}
+	if err := s.cache.Set(ctx, key, value, 0); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Settings cache write failed")
+	}
+}
+
+// getSetting reads a setting from the database, returning sql.ErrNoRows if
+// it was never saved. While the database is unreachable it returns the last
+// value read instead of failing, or the error if the setting wasn't read
+// since startup.
+func (s *Service) getSetting(ctx context.Context, key string) (interface{}, error) {
+	if s.store.Degraded() {
+		if val, ok := s.lastKnownSetting(key); ok {
+			return val, nil
+		}
+		if s.knownUnsaved(key) {
+			return nil, sql.ErrNoRows
+		}
+	}
+
+	val, err := s.store.GetSetting(ctx, key)
+	switch {
+	case err == nil:
+		s.mu.Lock()
+		s.lastKnown[key] = val
+		s.mu.Unlock()
+	case errors.Is(err, sql.ErrNoRows):
+		s.mu.Lock()
+		s.lastKnown[key] = nil
+		s.mu.Unlock()
+	case s.store.Unavailable(err):
+		if val, ok := s.lastKnownSetting(key); ok {
+			return val, nil
+		}
+		if s.knownUnsaved(key) {
+			return nil, sql.ErrNoRows
+		}
+	}
+	return val, err
+}
+
+// lastKnownSetting returns the last value read of a saved setting
+func (s *Service) lastKnownSetting(key string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.lastKnown[key]
+	return val, ok && val != nil
+}
+
+// knownUnsaved reports whether the setting was last read as never saved
+func (s *Service) knownUnsaved(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.lastKnown[key]
+	return ok && val == nil
+}
+
+// invalidate removes a cached value, logging cache errors
+func (s *Service) invalidate(ctx context.Context, key string) {
+	s.mu.Lock()
+	delete(s.llmKeys, key)
+	s.mu.Unlock()
+	if err := s.cache.Delete(ctx, key); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Settings cache invalidation failed")
+	}
+}
+
+// getCachedLLM returns the LLM settings cached under key by profile, with
+// the API keys this instance read along with them
+func (s *Service) getCachedLLM(ctx context.Context, key string) (map[string]*LLMSettings, bool) {
+	s.mu.RLock()
+	keys, ok := s.llmKeys[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	var profiles map[string]*LLMSettings
+	if !s.getCached(ctx, key, &profiles) {
+		return nil, false
+	}
+	for name, profile := range profiles {
+		profile.APIKey = keys[name]
+	}
+	return profiles, true
+}
+
+// setCachedLLM caches LLM settings by profile without their API keys,
+// which are kept in this instance's memory instead
+func (s *Service) setCachedLLM(ctx context.Context, key string, profiles map[string]*LLMSettings) {
+	keys := make(map[string]string, len(profiles))
+	stripped := make(map[string]*LLMSettings, len(profiles))
+	for name, profile := range profiles {
+		keys[name] = profile.APIKey
+		copied := *profile
+		copied.APIKey = ""
+		stripped[name] = &copied
+	}
+	s.mu.Lock()
+	s.llmKeys[key] = keys
+	s.mu.Unlock()
+	s.setCached(ctx, key, stripped)
 }
 
 // GetLLMConfig implements the llm.SettingsProvider interface
@@ -56,17 +316,18 @@ func (s *Service) GetLLMConfig(ctx context.Context) (provider, model, apiKey, ba
 	if err != nil {
 		return "", "", "", "", err
 	}
-	return settings.Provider, settings.Model, settings.APIKey, settings.BaseURL, nil
+	apiKey, err = s.resolveSecret(ctx, settings.APIKey)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	return settings.Provider, settings.Model, apiKey, settings.BaseURL, nil
 }
 
 // GetLLMSettings returns current LLM settings
 func (s *Service) GetLLMSettings(ctx context.Context) (*LLMSettings, error) {
-	s.mu.RLock()
-	if cached, ok := s.cache["llm_settings"]; ok {
-		s.mu.RUnlock()
-		return cached.(*LLMSettings), nil
+	if cached, ok := s.getCachedLLM(ctx, cacheKeyLLMSettings); ok && cached[DefaultLLMProfile] != nil {
+		return cached[DefaultLLMProfile], nil
 	}
-	s.mu.RUnlock()
 
 	settings := &LLMSettings{
 		Provider:    "openai",
@@ -75,155 +336,520 @@ func (s *Service) GetLLMSettings(ctx context.Context) (*LLMSettings, error) {
 		Temperature: 0.7,
 	}
 
-	if s.repo != nil {
-		if provider, err := s.repo.GetSetting(ctx, "llm_provider"); err == nil && provider != nil {
+	if s.store != nil {
+		if provider, err := s.getSetting(ctx, "llm_provider"); err == nil && provider != nil {
 			if str, ok := provider.(string); ok {
 				settings.Provider = str
 			}
 		}
-		if model, err := s.repo.GetSetting(ctx, "llm_model"); err == nil && model != nil {
+		if model, err := s.getSetting(ctx, "llm_model"); err == nil && model != nil {
 			if str, ok := model.(string); ok {
 				settings.Model = str
 			}
 		}
-		if apiKey, err := s.repo.GetSetting(ctx, "llm_api_key"); err == nil && apiKey != nil {
+		if apiKey, err := s.getSetting(ctx, "llm_api_key"); err == nil && apiKey != nil {
 			if str, ok := apiKey.(string); ok {
 				settings.APIKey = str
 			}
 		}
-		if baseURL, err := s.repo.GetSetting(ctx, "llm_base_url"); err == nil && baseURL != nil {
+		if baseURL, err := s.getSetting(ctx, "llm_base_url"); err == nil && baseURL != nil {
 			if str, ok := baseURL.(string); ok {
 				settings.BaseURL = str
 			}
 		}
-		if maxTokens, err := s.repo.GetSetting(ctx, "llm_max_tokens"); err == nil && maxTokens != nil {
+		if maxTokens, err := s.getSetting(ctx, "llm_max_tokens"); err == nil && maxTokens != nil {
 			if num, ok := maxTokens.(float64); ok {
 				settings.MaxTokens = int(num)
 			}
 		}
-		if temp, err := s.repo.GetSetting(ctx, "llm_temperature"); err == nil && temp != nil {
+		if temp, err := s.getSetting(ctx, "llm_temperature"); err == nil && temp != nil {
 			if num, ok := temp.(float64); ok {
 				settings.Temperature = num
 			}
 		}
-		if region, err := s.repo.GetSetting(ctx, "aws_region"); err == nil && region != nil {
+		if region, err := s.getSetting(ctx, "aws_region"); err == nil && region != nil {
 			if str, ok := region.(string); ok {
 				settings.AWSRegion = str
 			}
 		}
 	}
 
-	s.mu.Lock()
-	s.cache["llm_settings"] = settings
-	s.mu.Unlock()
+	s.setCachedLLM(ctx, cacheKeyLLMSettings, map[string]*LLMSettings{DefaultLLMProfile: settings})
 
 	return settings, nil
 }
 
 // UpdateLLMSettings updates LLM settings in the database
 func (s *Service) UpdateLLMSettings(ctx context.Context, settings *LLMSettings) error {
-	if s.repo == nil {
+	if s.store == nil {
 		return nil
 	}
 
-	if err := s.repo.SetSetting(ctx, "llm_provider", settings.Provider); err != nil {
+	if err := s.store.SetSetting(ctx, "llm_provider", settings.Provider); err != nil {
 		return err
 	}
-	if err := s.repo.SetSetting(ctx, "llm_model", settings.Model); err != nil {
+	if err := s.store.SetSetting(ctx, "llm_model", settings.Model); err != nil {
 		return err
 	}
 	if settings.APIKey != "" {
-		if err := s.repo.SetSetting(ctx, "llm_api_key", settings.APIKey); err != nil {
+		apiKey, err := s.encrypt(ctx, settings.APIKey)
+		if err != nil {
+			return err
+		}
+		if err := s.store.SetSetting(ctx, "llm_api_key", apiKey); err != nil {
 			return err
 		}
 	}
 	if settings.BaseURL != "" {
-		if err := s.repo.SetSetting(ctx, "llm_base_url", settings.BaseURL); err != nil {
+		if err := s.store.SetSetting(ctx, "llm_base_url", settings.BaseURL); err != nil {
 			return err
 		}
 	}
-	if err := s.repo.SetSetting(ctx, "llm_max_tokens", settings.MaxTokens); err != nil {
+	if err := s.store.SetSetting(ctx, "llm_max_tokens", settings.MaxTokens); err != nil {
 		return err
 	}
-	if err := s.repo.SetSetting(ctx, "llm_temperature", settings.Temperature); err != nil {
+	if err := s.store.SetSetting(ctx, "llm_temperature", settings.Temperature); err != nil {
 		return err
 	}
 	if settings.AWSRegion != "" {
-		if err := s.repo.SetSetting(ctx, "aws_region", settings.AWSRegion); err != nil {
+		if err := s.store.SetSetting(ctx, "aws_region", settings.AWSRegion); err != nil {
 			return err
 		}
 	}
 
-	// Invalidate cache
-	s.mu.Lock()
-	delete(s.cache, "llm_settings")
-	s.mu.Unlock()
+	s.invalidate(ctx, cacheKeyLLMSettings)
 
 	log.Info().Str("provider", settings.Provider).Str("model", settings.Model).Msg("LLM settings updated")
 	return nil
 }
 
-// GetSecuritySettings returns current security settings
-func (s *Service) GetSecuritySettings(ctx context.Context) (*SecuritySettings, error) {
-	settings := &SecuritySettings{
-		InjectionDetectionEnabled: true,
-		BlockOnDetection:          true,
-		PIIMaskingEnabled:         true,
-		RateLimitPerMinute:        100,
+// GetLLMProfile implements the llm.SettingsProvider interface
+// Returns the full LLM configuration for a named profile
+func (s *Service) GetLLMProfile(ctx context.Context, name string) (*config.LLMConfig, error) {
+	var settings *LLMSettings
+	if name == "" || name == DefaultLLMProfile {
+		defaultSettings, err := s.GetLLMSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		settings = defaultSettings
+	} else {
+		profiles, err := s.GetLLMProfiles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		profile, ok := profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("LLM profile not found: %s", name)
+		}
+		settings = profile
+	}
+
+	apiKey, err := s.resolveSecret(ctx, settings.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("LLM profile %s: %w", name, err)
+	}
+
+	return &config.LLMConfig{
+		Provider:    settings.Provider,
+		Model:       settings.Model,
+		APIKey:      apiKey,
+		BaseURL:     settings.BaseURL,
+		MaxTokens:   settings.MaxTokens,
+		Temperature: settings.Temperature,
+	}, nil
+}
+
+// GetLLMProfiles returns all named LLM profiles stored in the database
+// The default profile is not included; it is managed via GetLLMSettings
+func (s *Service) GetLLMProfiles(ctx context.Context) (map[string]*LLMSettings, error) {
+	if cached, ok := s.getCachedLLM(ctx, cacheKeyLLMProfiles); ok {
+		return cached, nil
+	}
+
+	profiles := make(map[string]*LLMSettings)
+
+	if s.store != nil {
+		if val, err := s.getSetting(ctx, "llm_profiles"); err == nil && val != nil {
+			// Settings are stored as raw JSON, so round-trip to get typed profiles
+			raw, _ := json.Marshal(val)
+			if err := json.Unmarshal(raw, &profiles); err != nil {
+				return nil, fmt.Errorf("failed to decode LLM profiles: %w", err)
+			}
+		}
+	}
+
+	s.setCachedLLM(ctx, cacheKeyLLMProfiles, profiles)
+
+	return profiles, nil
+}
+
+// SaveLLMProfile creates or replaces a named LLM profile
+func (s *Service) SaveLLMProfile(ctx context.Context, name string, settings *LLMSettings) error {
+	if name == DefaultLLMProfile {
+		return s.UpdateLLMSettings(ctx, settings)
+	}
+	if s.store == nil {
+		return nil
+	}
+
+	profiles, err := s.GetLLMProfiles(ctx)
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[string]*LLMSettings, len(profiles)+1)
+	for k, v := range profiles {
+		updated[k] = v
+	}
+
+	// Keep the stored API key if the update doesn't provide a new one
+	stored := *settings
+	if existing, ok := updated[name]; ok && stored.APIKey == "" {
+		stored.APIKey = existing.APIKey
+	}
+	if stored.APIKey, err = s.encrypt(ctx, stored.APIKey); err != nil {
+		return err
+	}
+	stored.Status = nil
+	updated[name] = &stored
+
+	if err := s.store.SetSetting(ctx, "llm_profiles", updated); err != nil {
+		return err
+	}
+
+	s.invalidate(ctx, cacheKeyLLMProfiles)
+
+	log.Info().Str("profile", name).Str("provider", settings.Provider).Str("model", settings.Model).Msg("LLM profile saved")
+	return nil
+}
+
+// DeleteLLMProfile removes a named LLM profile
+func (s *Service) DeleteLLMProfile(ctx context.Context, name string) error {
+	if name == DefaultLLMProfile {
+		return fmt.Errorf("the %s profile cannot be deleted", DefaultLLMProfile)
+	}
+	if s.store == nil {
+		return nil
+	}
+
+	profiles, err := s.GetLLMProfiles(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := profiles[name]; !ok {
+		return fmt.Errorf("LLM profile not found: %s", name)
+	}
+
+	updated := make(map[string]*LLMSettings, len(profiles))
+	for k, v := range profiles {
+		if k != name {
+			updated[k] = v
+		}
+	}
+
+	if err := s.store.SetSetting(ctx, "llm_profiles", updated); err != nil {
+		return err
+	}
+
+	s.invalidate(ctx, cacheKeyLLMProfiles)
+
+	log.Info().Str("profile", name).Msg("LLM profile deleted")
+	return nil
+}
+
+// RotateEncryption re-encrypts every stored API key with a new data key
+// under the current master key, including keys stored before encryption was
+// set up. Afterwards, previous master keys are no longer needed. It returns
+// the number of keys re-encrypted.
+func (s *Service) RotateEncryption(ctx context.Context) (int, error) {
+	if s.store == nil || s.encrypter == nil {
+		return 0, nil
 	}
 
-	if s.repo != nil {
-		if val, err := s.repo.GetSetting(ctx, "injection_detection_enabled"); err == nil && val != nil {
-			if b, ok := val.(bool); ok {
-				settings.InjectionDetectionEnabled = b
+	// Other writes may have gone through before an error, so the caches are
+	// cleared either way
+	defer s.invalidate(ctx, cacheKeyLLMProfiles)
+	defer s.invalidate(ctx, cacheKeyLLMSettings)
+
+	rotated := 0
+	reencrypt := func(value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		plaintext, err := s.encrypter.Decrypt(ctx, value)
+		if err != nil {
+			return "", err
+		}
+		rotated++
+		return s.encrypter.Encrypt(ctx, plaintext)
+	}
+
+	// Read from the database rather than the cache, so no key is missed
+	if val, err := s.store.GetSetting(ctx, "llm_api_key"); err == nil {
+		if apiKey, ok := val.(string); ok && apiKey != "" {
+			if apiKey, err = reencrypt(apiKey); err != nil {
+				return 0, fmt.Errorf("llm_api_key: %w", err)
+			}
+			if err := s.store.SetSetting(ctx, "llm_api_key", apiKey); err != nil {
+				return 0, err
 			}
 		}
-		if val, err := s.repo.GetSetting(ctx, "block_on_detection"); err == nil && val != nil {
-			if b, ok := val.(bool); ok {
-				settings.BlockOnDetection = b
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	profiles := make(map[string]*LLMSettings)
+	if val, err := s.store.GetSetting(ctx, "llm_profiles"); err == nil && val != nil {
+		raw, _ := json.Marshal(val)
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return rotated, fmt.Errorf("failed to decode LLM profiles: %w", err)
+		}
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return rotated, err
+	}
+	if len(profiles) > 0 {
+		for name, profile := range profiles {
+			apiKey, err := reencrypt(profile.APIKey)
+			if err != nil {
+				return rotated, fmt.Errorf("LLM profile %s: %w", name, err)
 			}
+			profile.APIKey = apiKey
+		}
+		if err := s.store.SetSetting(ctx, "llm_profiles", profiles); err != nil {
+			return rotated, err
 		}
-		if val, err := s.repo.GetSetting(ctx, "pii_masking_enabled"); err == nil && val != nil {
-			if b, ok := val.(bool); ok {
-				settings.PIIMaskingEnabled = b
+	}
+
+	log.Info().Int("count", rotated).Msg("Stored API keys re-encrypted")
+	return rotated, nil
+}
+
+// GetSecuritySettings returns current security settings
+func (s *Service) GetSecuritySettings(ctx context.Context) (*SecuritySettings, error) {
+	s.mu.RLock()
+	settings := s.securityDefaults
+	s.mu.RUnlock()
+
+	if s.store != nil {
+		for key, dest := range map[string]interface{}{
+			"injection_detection_enabled":    &settings.InjectionDetectionEnabled,
+			"block_on_detection":             &settings.BlockOnDetection,
+			"pii_masking_enabled":            &settings.PIIMaskingEnabled,
+			"rate_limit_requests_per_minute": &settings.RateLimitPerMinute,
+			"max_concurrent_per_user":        &settings.MaxConcurrentPerUser,
+			"max_concurrent_per_key":         &settings.MaxConcurrentPerKey,
+			"concurrency_queue_timeout_ms":   &settings.ConcurrencyQueueTimeoutMs,
+		} {
+			val, err := s.getSetting(ctx, key)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			// A failed read must not pass off the defaults as saved settings
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", key, err)
+			}
+			switch dest := dest.(type) {
+			case *bool:
+				if b, ok := val.(bool); ok {
+					*dest = b
+				}
+			case *int:
+				if num, ok := val.(float64); ok {
+					*dest = int(num)
+				}
 			}
 		}
-		if val, err := s.repo.GetSetting(ctx, "rate_limit_requests_per_minute"); err == nil && val != nil {
-			if num, ok := val.(float64); ok {
-				settings.RateLimitPerMinute = int(num)
+	}
+
+	moderation, err := s.GetModerationSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	settings.Moderation = moderation
+
+	return &settings, nil
+}
+
+// GetModerationSettings returns the saved response moderation settings, or
+// nil if none were saved and the config file applies
+func (s *Service) GetModerationSettings(ctx context.Context) (*models.ModerationSettings, error) {
+	var cached *models.ModerationSettings
+	if s.getCached(ctx, cacheKeyModeration, &cached) {
+		return cached, nil
+	}
+
+	if s.store != nil {
+		if val, err := s.getSetting(ctx, "moderation"); err == nil && val != nil {
+			raw, _ := json.Marshal(val)
+			if err := json.Unmarshal(raw, &cached); err != nil {
+				return nil, fmt.Errorf("failed to decode moderation settings: %w", err)
 			}
 		}
 	}
 
-	return settings, nil
+	s.setCached(ctx, cacheKeyModeration, cached)
+
+	return cached, nil
 }
 
 // UpdateSecuritySettings updates security settings
 func (s *Service) UpdateSecuritySettings(ctx context.Context, settings *SecuritySettings) error {
-	if s.repo == nil {
+	if s.store == nil {
 		return nil
 	}
 
-	if err := s.repo.SetSetting(ctx, "injection_detection_enabled", settings.InjectionDetectionEnabled); err != nil {
+	if err := s.store.SetSetting(ctx, "injection_detection_enabled", settings.InjectionDetectionEnabled); err != nil {
 		return err
 	}
-	if err := s.repo.SetSetting(ctx, "block_on_detection", settings.BlockOnDetection); err != nil {
+	if err := s.store.SetSetting(ctx, "block_on_detection", settings.BlockOnDetection); err != nil {
 		return err
 	}
-	if err := s.repo.SetSetting(ctx, "pii_masking_enabled", settings.PIIMaskingEnabled); err != nil {
+	if err := s.store.SetSetting(ctx, "pii_masking_enabled", settings.PIIMaskingEnabled); err != nil {
 		return err
 	}
-	if err := s.repo.SetSetting(ctx, "rate_limit_requests_per_minute", settings.RateLimitPerMinute); err != nil {
+	if err := s.store.SetSetting(ctx, "rate_limit_requests_per_minute", settings.RateLimitPerMinute); err != nil {
 		return err
 	}
+	if err := s.store.SetSetting(ctx, "max_concurrent_per_user", settings.MaxConcurrentPerUser); err != nil {
+		return err
+	}
+	if err := s.store.SetSetting(ctx, "max_concurrent_per_key", settings.MaxConcurrentPerKey); err != nil {
+		return err
+	}
+	if err := s.store.SetSetting(ctx, "concurrency_queue_timeout_ms", settings.ConcurrencyQueueTimeoutMs); err != nil {
+		return err
+	}
+	if settings.Moderation != nil {
+		if err := s.store.SetSetting(ctx, "moderation", settings.Moderation); err != nil {
+			return err
+		}
+		s.invalidate(ctx, cacheKeyModeration)
+	}
+
+	s.notifySecurityChanged()
 
 	log.Info().Msg("Security settings updated")
 	return nil
 }
 
+// WatchSecuritySettings calls apply with the security settings now and each
+// time they change, until ctx is cancelled. Updates made through this
+// service apply at once; the database is polled every interval for those
+// saved by other instances. Settings that can't be read are retried at the
+// next poll, leaving the running ones in place.
+func (s *Service) WatchSecuritySettings(ctx context.Context, interval time.Duration, apply func(*SecuritySettings)) {
+	// The first load happens before returning, so saved settings are in
+	// effect before any request is served
+	applied := s.reloadSecuritySettings(ctx, nil, apply)
+	go watch(ctx, interval, s.securityChanged, func() {
+		applied = s.reloadSecuritySettings(ctx, applied, apply)
+	})
+}
+
+// watch calls reload every interval and when changed is signalled, until
+// ctx is cancelled
+func watch(ctx context.Context, interval time.Duration, changed <-chan struct{}, reload func()) {
+	var poll <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll:
+		case <-changed:
+		}
+		reload()
+	}
+}
+
+// reloadSecuritySettings applies the security settings if they differ from
+// those applied before, and returns the settings in effect
+func (s *Service) reloadSecuritySettings(ctx context.Context, applied *SecuritySettings, apply func(*SecuritySettings)) *SecuritySettings {
+	current, err := s.GetSecuritySettings(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to reload security settings")
+		return applied
+	}
+	// Moderation settings are read by the moderator itself
+	current.Moderation = nil
+	if applied != nil && *current == *applied {
+		return applied
+	}
+	apply(current)
+	return current
+}
+
+// GetPIISettings returns the saved custom PII types and actions, or empty
+// settings if none were saved
+func (s *Service) GetPIISettings(ctx context.Context) (*models.PIISettings, error) {
+	var cached models.PIISettings
+	if s.getCached(ctx, cacheKeyPII, &cached) {
+		return &cached, nil
+	}
+
+	val, err := s.getSetting(ctx, "pii_settings")
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to read PII settings: %w", err)
+	}
+	if val != nil {
+		raw, _ := json.Marshal(val)
+		if err := json.Unmarshal(raw, &cached); err != nil {
+			return nil, fmt.Errorf("failed to decode PII settings: %w", err)
+		}
+	}
+
+	s.setCached(ctx, cacheKeyPII, cached)
+	return &cached, nil
+}
+
+// UpdatePIISettings saves custom PII types and actions. A running
+// WatchPIISettings applies them at once.
+func (s *Service) UpdatePIISettings(ctx context.Context, settings *models.PIISettings) error {
+	if err := s.store.SetSetting(ctx, "pii_settings", settings); err != nil {
+		return err
+	}
+	s.invalidate(ctx, cacheKeyPII)
+	notify(s.piiChanged)
+
+	log.Info().Int("custom_types", len(settings.Patterns)).Msg("PII settings updated")
+	return nil
+}
+
+// WatchPIISettings calls apply with the saved PII settings now and each time
+// they change, until ctx is cancelled, polling every interval for those saved
+// by other instances. Settings that fail to apply are retried at the next
+// poll.
+func (s *Service) WatchPIISettings(ctx context.Context, interval time.Duration, apply func(*models.PIISettings) error) {
+	var applied *models.PIISettings
+	reload := func() {
+		current, err := s.GetPIISettings(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to reload PII settings")
+			return
+		}
+		if applied != nil && current.Equal(*applied) {
+			return
+		}
+		if err := apply(current); err != nil {
+			log.Warn().Err(err).Msg("Failed to apply PII settings")
+			return
+		}
+		applied = current
+	}
+
+	reload()
+	go watch(ctx, interval, s.piiChanged, reload)
+}
+
 // GetAllSettings returns all settings as a map
 func (s *Service) GetAllSettings(ctx context.Context) (map[string]interface{}, error) {
-	if s.repo == nil {
+	if s.store == nil {
 		return map[string]interface{}{
 			"llm_provider":                   "openai",
 			"llm_model":                      "gpt-4o",
@@ -232,12 +858,31 @@ func (s *Service) GetAllSettings(ctx context.Context) (map[string]interface{}, e
 			"rate_limit_requests_per_minute": 100,
 		}, nil
 	}
-	return s.repo.GetAllSettings(ctx)
+	return s.store.GetAllSettings(ctx)
+}
+
+// SettingChanged drops the cached settings after another instance saved key,
+// and wakes the security and PII watchers to apply it. The instance saving
+// LLM credentials validates them, so the statuses recorded here for the old
+// ones are dropped instead of calling the providers again.
+func (s *Service) SettingChanged(ctx context.Context, key string) {
+	if err := s.InvalidateCache(ctx); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Settings cache invalidation failed")
+	}
+	s.notifySecurityChanged()
+	notify(s.piiChanged)
+	if !strings.HasPrefix(key, "llm_") && key != "aws_region" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.llmStatus)
 }
 
 // InvalidateCache clears the settings cache
-func (s *Service) InvalidateCache() {
+func (s *Service) InvalidateCache(ctx context.Context) error {
 	s.mu.Lock()
-	s.cache = make(map[string]interface{})
+	clear(s.llmKeys)
 	s.mu.Unlock()
+	return s.cache.Clear(ctx)
 }
@@ -0,0 +1,174 @@
+package settings
+
+import (
+	"context"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/rs/zerolog/log"
+)
+
+// LLM validation statuses
+const (
+	LLMStatusUnknown      = "unknown"
+	LLMStatusOK           = "ok"
+	LLMStatusError        = "error"
+	LLMStatusUnconfigured = "unconfigured"
+)
+
+// LLMStatus holds the result of validating an LLM profile against its provider
+type LLMStatus struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ValidateLLMSettings performs a test call with the given settings without saving them
+// An empty API key falls back to the key currently stored for the profile
+func (s *Service) ValidateLLMSettings(ctx context.Context, name string, settings *LLMSettings) *LLMStatus {
+	cfg := config.LLMConfig{
+		Provider:    settings.Provider,
+		Model:       settings.Model,
+		APIKey:      settings.APIKey,
+		BaseURL:     settings.BaseURL,
+		MaxTokens:   settings.MaxTokens,
+		Temperature: settings.Temperature,
+	}
+
+	if cfg.APIKey == "" {
+		if existing, err := s.GetLLMProfile(ctx, name); err == nil {
+			cfg.APIKey = existing.APIKey
+		}
+	}
+	apiKey, err := s.resolveSecret(ctx, cfg.APIKey)
+	if err != nil {
+		return &LLMStatus{Status: LLMStatusError, Error: err.Error(), CheckedAt: time.Now()}
+	}
+	cfg.APIKey = apiKey
+
+	return checkLLMConfig(ctx, cfg)
+}
+
+// ValidateLLMProfile validates a stored profile and records the result
+func (s *Service) ValidateLLMProfile(ctx context.Context, name string) *LLMStatus {
+	var status *LLMStatus
+	cfg, err := s.GetLLMProfile(ctx, name)
+	if err != nil {
+		status = &LLMStatus{Status: LLMStatusError, Error: err.Error(), CheckedAt: time.Now()}
+	} else {
+		status = checkLLMConfig(ctx, *cfg)
+	}
+
+	s.SetLLMStatus(name, status)
+	return status
+}
+
+// ValidateAllLLMProfiles validates the default profile and every named profile
+func (s *Service) ValidateAllLLMProfiles(ctx context.Context) map[string]*LLMStatus {
+	results := map[string]*LLMStatus{
+		DefaultLLMProfile: s.ValidateLLMProfile(ctx, DefaultLLMProfile),
+	}
+
+	profiles, err := s.GetLLMProfiles(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load LLM profiles for validation")
+		return results
+	}
+	for name := range profiles {
+		results[name] = s.ValidateLLMProfile(ctx, name)
+	}
+	return results
+}
+
+// SetLLMStatus records the validation status for a profile
+func (s *Service) SetLLMStatus(name string, status *LLMStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.llmStatus[name]
+	s.llmStatus[name] = status
+
+	if status.Status == LLMStatusError && (previous == nil || previous.Status != LLMStatusError) {
+		log.Warn().Str("profile", name).Str("error", status.Error).Msg("LLM profile failed validation")
+	} else if status.Status == LLMStatusOK && previous != nil && previous.Status == LLMStatusError {
+		log.Info().Str("profile", name).Msg("LLM profile recovered")
+	}
+}
+
+// GetLLMStatus returns the last validation status for a profile
+func (s *Service) GetLLMStatus(name string) *LLMStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if status, ok := s.llmStatus[name]; ok {
+		copied := *status
+		return &copied
+	}
+	return &LLMStatus{Status: LLMStatusUnknown}
+}
+
+// GetAllLLMStatuses returns the last validation status of every checked profile
+func (s *Service) GetAllLLMStatuses() map[string]*LLMStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make(map[string]*LLMStatus, len(s.llmStatus))
+	for name, status := range s.llmStatus {
+		copied := *status
+		statuses[name] = &copied
+	}
+	return statuses
+}
+
+// IsLLMProfileHealthy implements the llm.SettingsProvider interface
+// Profiles that have not been checked yet are considered healthy
+func (s *Service) IsLLMProfileHealthy(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status, ok := s.llmStatus[name]
+	return !ok || status.Status != LLMStatusError
+}
+
+// StartLLMValidation periodically re-validates all LLM profiles until ctx is cancelled
+func (s *Service) StartLLMValidation(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.ValidateAllLLMProfiles(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func checkLLMConfig(ctx context.Context, cfg config.LLMConfig) *LLMStatus {
+	if cfg.APIKey == "" && cfg.Provider != "ollama" {
+		return &LLMStatus{Status: LLMStatusUnconfigured, CheckedAt: time.Now()}
+	}
+
+	start := time.Now()
+	err := llm.ValidateConfig(ctx, cfg)
+	status := &LLMStatus{
+		Status:    LLMStatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		status.Status = LLMStatusError
+		status.Error = err.Error()
+	}
+	return status
+}
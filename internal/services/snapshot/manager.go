@@ -0,0 +1,155 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/audit"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/quota"
+	"github.com/rs/zerolog/log"
+)
+
+// currentVersion is the snapshot file format version
+const currentVersion = 1
+
+// Snapshot is the on-disk representation of in-memory governance state
+type Snapshot struct {
+	Version   int                   `json:"version"`
+	CreatedAt time.Time             `json:"created_at"`
+	State     *policy.State         `json:"state"`
+	AuditLogs []models.AuditLog     `json:"audit_logs"`
+	Alerts    []models.Alert        `json:"alerts"`
+	Quotas    []models.QuotaCounter `json:"quotas,omitempty"`
+}
+
+// Manager periodically writes in-memory state to a JSON file and restores it on startup
+type Manager struct {
+	cfg          config.SnapshotConfig
+	policyEngine *policy.Engine
+	auditLogger  *audit.Logger
+	quotas       *quota.Service
+}
+
+// NewManager creates a new snapshot manager
+func NewManager(cfg config.SnapshotConfig, engine *policy.Engine, logger *audit.Logger) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	return &Manager{
+		cfg:          cfg,
+		policyEngine: engine,
+		auditLogger:  logger,
+	}
+}
+
+// SetQuotaService includes request quota counters in snapshots
+func (m *Manager) SetQuotaService(svc *quota.Service) {
+	m.quotas = svc
+}
+
+// Load restores state from the snapshot file; a missing file is not an error
+func (m *Manager) Load() error {
+	data, err := os.ReadFile(m.cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info().Str("path", m.cfg.Path).Msg("No snapshot found - starting with empty state")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snap.Version > currentVersion {
+		return fmt.Errorf("snapshot version %d is newer than supported version %d", snap.Version, currentVersion)
+	}
+
+	if snap.State != nil {
+		m.policyEngine.ImportState(snap.State)
+	}
+	m.auditLogger.Import(snap.AuditLogs, snap.Alerts)
+	if m.quotas != nil {
+		m.quotas.Import(snap.Quotas)
+	}
+
+	log.Info().
+		Str("path", m.cfg.Path).
+		Time("created_at", snap.CreatedAt).
+		Int("audit_logs", len(snap.AuditLogs)).
+		Msg("State restored from snapshot")
+	return nil
+}
+
+// Save writes the current state to the snapshot file atomically
+func (m *Manager) Save() error {
+	logs, alerts := m.auditLogger.Export(m.cfg.AuditLogLimit)
+	snap := Snapshot{
+		Version:   currentVersion,
+		CreatedAt: time.Now(),
+		State:     m.policyEngine.ExportState(),
+		AuditLogs: logs,
+		Alerts:    alerts,
+	}
+	if m.quotas != nil {
+		snap.Quotas = m.quotas.Export()
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	// Write to a temp file in the same directory and rename so a crash never leaves a partial snapshot
+	tmp, err := os.CreateTemp(filepath.Dir(m.cfg.Path), ".goguard-snapshot-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set snapshot permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), m.cfg.Path); err != nil {
+		return fmt.Errorf("failed to replace snapshot: %w", err)
+	}
+
+	log.Debug().Str("path", m.cfg.Path).Msg("Snapshot saved")
+	return nil
+}
+
+// Start saves snapshots periodically until ctx is cancelled
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.Save(); err != nil {
+					log.Warn().Err(err).Msg("Failed to save snapshot")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,403 @@
+package spending
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+)
+
+// Units prices can be quoted in
+const (
+	UnitMillion  = "1M"
+	UnitThousand = "1K"
+)
+
+// maxFeedSize bounds how much of a price feed is read
+const maxFeedSize = 4 << 20
+
+// ErrInvalidPrice is returned for prices that can't be stored
+var ErrInvalidPrice = errors.New("invalid model price")
+
+// ErrNoPriceFeed is returned when syncing without a feed configured
+var ErrNoPriceFeed = errors.New("no pricing feed configured")
+
+// SyncResult summarizes one pull of the pricing feed
+type SyncResult struct {
+	Fetched       int       `json:"fetched"`
+	Updated       int       `json:"updated"`
+	Unchanged     int       `json:"unchanged"`
+	SkippedManual int       `json:"skipped_manual"`
+	Invalid       int       `json:"invalid"`
+	SyncedAt      time.Time `json:"synced_at"`
+}
+
+// feedPrice is one entry of the pricing feed
+type feedPrice struct {
+	Model       string  `json:"model"`
+	Provider    string  `json:"provider"`
+	InputPrice  float64 `json:"input_price"`
+	OutputPrice float64 `json:"output_price"`
+	Unit        string  `json:"unit"`
+	Currency    string  `json:"currency"`
+}
+
+// ParseUnit normalizes a price unit, returning how many units make up a
+// million tokens. An empty unit means per million.
+func ParseUnit(unit string) (string, float64, error) {
+	switch strings.ToUpper(strings.TrimSpace(unit)) {
+	case "", UnitMillion:
+		return UnitMillion, 1, nil
+	case UnitThousand:
+		return UnitThousand, 1000, nil
+	}
+	return "", 0, fmt.Errorf("%w: unit must be 1M or 1K, got %q", ErrInvalidPrice, unit)
+}
+
+// inUnit returns a copy of a per-million price quoted in unit
+func inUnit(p models.ModelPrice, unit string, perMillion float64) *models.ModelPrice {
+	p.InputPrice = roundPrice(p.InputPrice / perMillion)
+	p.OutputPrice = roundPrice(p.OutputPrice / perMillion)
+	p.Unit = unit
+	return &p
+}
+
+// roundPrice drops float noise from unit conversions
+func roundPrice(v float64) float64 {
+	return math.Round(v*1e9) / 1e9
+}
+
+// normalize validates a price and converts it to per million tokens
+func normalize(p *models.ModelPrice) (*models.ModelPrice, error) {
+	p.Model = strings.TrimSpace(p.Model)
+	if p.Model == "" {
+		return nil, fmt.Errorf("%w: model is required", ErrInvalidPrice)
+	}
+	if p.InputPrice < 0 || p.OutputPrice < 0 || math.IsNaN(p.InputPrice) || math.IsNaN(p.OutputPrice) {
+		return nil, fmt.Errorf("%w: prices must not be negative", ErrInvalidPrice)
+	}
+	// Costs are tracked in USD throughout; other currencies would need rates
+	if p.Currency == "" {
+		p.Currency = "USD"
+	}
+	if !strings.EqualFold(p.Currency, "USD") {
+		return nil, fmt.Errorf("%w: only USD prices are supported, got %q", ErrInvalidPrice, p.Currency)
+	}
+	_, perMillion, err := ParseUnit(p.Unit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ModelPrice{
+		Model:       p.Model,
+		Provider:    p.Provider,
+		InputPrice:  roundPrice(p.InputPrice * perMillion),
+		OutputPrice: roundPrice(p.OutputPrice * perMillion),
+		Unit:        UnitMillion,
+		Currency:    "USD",
+		Source:      p.Source,
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
+// ListPrices returns the effective price table, built-in prices included,
+// quoted in unit
+func (t *Tracker) ListPrices(unit string) ([]*models.ModelPrice, error) {
+	unit, perMillion, err := ParseUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	prices := make([]*models.ModelPrice, 0, len(defaultPricing)+len(t.customPricing))
+	for _, p := range t.customPricing {
+		prices = append(prices, inUnit(*p, unit, perMillion))
+	}
+	for model, p := range defaultPricing {
+		if _, ok := t.customPricing[model]; ok {
+			continue
+		}
+		prices = append(prices, inUnit(defaultPrice(model, p), unit, perMillion))
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Model < prices[j].Model })
+	return prices, nil
+}
+
+// Price returns the price that applies to a model, which may be a prefix
+// match or the default, quoted in unit
+func (t *Tracker) Price(model, unit string) (*models.ModelPrice, error) {
+	unit, perMillion, err := ParseUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	key, custom := t.matchModel(model)
+	if custom {
+		return inUnit(*t.customPricing[key], unit, perMillion), nil
+	}
+	return inUnit(defaultPrice(key, defaultPricing[key]), unit, perMillion), nil
+}
+
+func defaultPrice(model string, p ModelPricing) models.ModelPrice {
+	return models.ModelPrice{
+		Model:       model,
+		InputPrice:  p.InputPricePerMillion,
+		OutputPrice: p.OutputPricePerMillion,
+		Unit:        UnitMillion,
+		Currency:    "USD",
+		Source:      models.PriceSourceDefault,
+	}
+}
+
+// SetPrice stores a manual price for a model. Manual prices are never
+// overwritten by the feed.
+func (t *Tracker) SetPrice(ctx context.Context, p *models.ModelPrice) (*models.ModelPrice, error) {
+	price, err := normalize(p)
+	if err != nil {
+		return nil, err
+	}
+	price.Source = models.PriceSourceManual
+
+	if t.repo != nil {
+		if err := t.repo.UpsertModelPrice(ctx, price); err != nil {
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	t.customPricing[price.Model] = price
+	t.mu.Unlock()
+	t.clearPricingCache()
+
+	copied := *price
+	return &copied, nil
+}
+
+// DeletePrice removes a stored price, so the model falls back to the
+// built-in table
+func (t *Tracker) DeletePrice(ctx context.Context, model string) error {
+	if t.repo != nil {
+		if err := t.repo.DeleteModelPrice(ctx, model); err != nil {
+			return err
+		}
+	} else {
+		t.mu.RLock()
+		_, ok := t.customPricing[model]
+		t.mu.RUnlock()
+		if !ok {
+			return fmt.Errorf("model price not found: %s", model)
+		}
+	}
+	t.mu.Lock()
+	delete(t.customPricing, model)
+	t.mu.Unlock()
+	t.clearPricingCache()
+	return nil
+}
+
+// ReloadPricing replaces the in-memory prices with the stored ones
+func (t *Tracker) ReloadPricing(ctx context.Context) error {
+	if t.repo == nil {
+		return nil
+	}
+	list, err := t.repo.ListModelPrices(ctx)
+	if err != nil {
+		return err
+	}
+	prices := make(map[string]*models.ModelPrice, len(list))
+	for _, p := range list {
+		prices[p.Model] = p
+	}
+
+	t.mu.Lock()
+	changed := !samePrices(t.customPricing, prices)
+	t.customPricing = prices
+	t.mu.Unlock()
+	if changed {
+		t.clearPricingCache()
+	}
+	return nil
+}
+
+func samePrices(a, b map[string]*models.ModelPrice) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for model, p := range a {
+		q, ok := b[model]
+		if !ok || p.InputPrice != q.InputPrice || p.OutputPrice != q.OutputPrice {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncPricing pulls the configured feed and stores any changed prices.
+// Models with a manual price are left alone.
+func (t *Tracker) SyncPricing(ctx context.Context) (*SyncResult, error) {
+	t.mu.RLock()
+	feedURL := t.pricingCfg.FeedURL
+	t.mu.RUnlock()
+	if feedURL == "" {
+		return nil, ErrNoPriceFeed
+	}
+	feed, err := t.fetchFeed(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{Fetched: len(feed), SyncedAt: time.Now()}
+	for _, entry := range feed {
+		price, err := normalize(&models.ModelPrice{
+			Model:       entry.Model,
+			Provider:    entry.Provider,
+			InputPrice:  entry.InputPrice,
+			OutputPrice: entry.OutputPrice,
+			Unit:        entry.Unit,
+			Currency:    entry.Currency,
+		})
+		if err != nil {
+			log.Debug().Err(err).Str("model", entry.Model).Msg("Skipping pricing feed entry")
+			result.Invalid++
+			continue
+		}
+		price.Source = models.PriceSourceFeed
+
+		t.mu.RLock()
+		current, ok := t.customPricing[price.Model]
+		t.mu.RUnlock()
+		switch {
+		case ok && current.Source == models.PriceSourceManual:
+			result.SkippedManual++
+			continue
+		case ok && current.InputPrice == price.InputPrice && current.OutputPrice == price.OutputPrice && current.Provider == price.Provider:
+			result.Unchanged++
+			continue
+		}
+
+		if t.repo != nil {
+			if err := t.repo.UpsertModelPrice(ctx, price); err != nil {
+				return nil, err
+			}
+		}
+		t.mu.Lock()
+		t.customPricing[price.Model] = price
+		t.mu.Unlock()
+		result.Updated++
+	}
+	if result.Updated > 0 {
+		t.clearPricingCache()
+	}
+	return result, nil
+}
+
+// fetchFeed reads the feed, either a JSON array of prices or an object with
+// a "prices" array
+func (t *Tracker) fetchFeed(ctx context.Context, feedURL string) ([]feedPrice, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := t.feedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch pricing feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch pricing feed: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read pricing feed: %w", err)
+	}
+	if len(body) > maxFeedSize {
+		return nil, fmt.Errorf("pricing feed exceeds %d bytes", maxFeedSize)
+	}
+
+	var feed []feedPrice
+	if err := json.Unmarshal(body, &feed); err == nil {
+		return feed, nil
+	}
+	var wrapped struct {
+		Prices []feedPrice `json:"prices"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return nil, fmt.Errorf("parse pricing feed: %w", err)
+	}
+	return wrapped.Prices, nil
+}
+
+// StartPricing loads stored prices, then reloads them and syncs the feed
+// periodically until ctx is cancelled. Starting it again, e.g. when the
+// config is reloaded, stops the previous reloads and syncs.
+func (t *Tracker) StartPricing(ctx context.Context, cfg config.PricingConfig) {
+	ctx, stop := context.WithCancel(ctx)
+	t.mu.Lock()
+	if t.stopPricing != nil {
+		t.stopPricing()
+	}
+	t.pricingCfg = cfg
+	t.stopPricing = stop
+	t.mu.Unlock()
+
+	if err := t.ReloadPricing(ctx); err != nil {
+		log.Warn().Err(err).Msg("Failed to load model prices")
+	}
+
+	if cfg.RefreshInterval > 0 {
+		go t.every(ctx, cfg.RefreshInterval, func() {
+			if err := t.ReloadPricing(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to reload model prices")
+			}
+		})
+	}
+	if cfg.FeedURL != "" && cfg.SyncInterval > 0 {
+		sync := func() {
+			result, err := t.SyncPricing(ctx)
+			if err != nil {
+				log.Warn().Err(err).Msg("Pricing feed sync failed")
+				return
+			}
+			log.Info().
+				Int("fetched", result.Fetched).
+				Int("updated", result.Updated).
+				Int("skipped_manual", result.SkippedManual).
+				Int("invalid", result.Invalid).
+				Msg("Synced model prices")
+		}
+		go func() {
+			sync()
+			t.every(ctx, cfg.SyncInterval, sync)
+		}()
+	}
+}
+
+// every runs fn every interval until ctx is cancelled
+func (t *Tracker) every(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
@@ -2,10 +2,19 @@ package spending
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/config"
 	"github.com/epps11/goguard/internal/database"
 	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/fx"
+	"github.com/epps11/goguard/internal/tenant"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
@@ -15,8 +24,8 @@ type ModelPricing struct {
 	OutputPricePerMillion float64 // Cost per 1M output tokens
 }
 
-// Default pricing for common models (USD per 1M tokens)
-// Prices as of late 2024 - should be configurable
+// Default pricing for common models (USD per 1M tokens), as of late 2024.
+// Prices set through the control API or synced from a feed take precedence.
 var defaultPricing = map[string]ModelPricing{
 	// OpenAI models
 	"gpt-4o":        {InputPricePerMillion: 2.50, OutputPricePerMillion: 10.00},
@@ -25,6 +34,11 @@ var defaultPricing = map[string]ModelPricing{
 	"gpt-4":         {InputPricePerMillion: 30.00, OutputPricePerMillion: 60.00},
 	"gpt-3.5-turbo": {InputPricePerMillion: 0.50, OutputPricePerMillion: 1.50},
 
+	// OpenAI embedding models (input tokens only)
+	"text-embedding-3-small": {InputPricePerMillion: 0.02},
+	"text-embedding-3-large": {InputPricePerMillion: 0.13},
+	"text-embedding-ada-002": {InputPricePerMillion: 0.10},
+
 	// Anthropic models
 	"claude-3-5-sonnet-latest":   {InputPricePerMillion: 3.00, OutputPricePerMillion: 15.00},
 	"claude-3-5-sonnet-20241022": {InputPricePerMillion: 3.00, OutputPricePerMillion: 15.00},
@@ -52,7 +66,12 @@ var defaultPricing = map[string]ModelPricing{
 // Tracker tracks spending for users based on LLM usage
 type Tracker struct {
 	repo          *database.Repository
-	customPricing map[string]ModelPricing
+	customPricing map[string]*models.ModelPrice // per million tokens
+	pricingCfg    config.PricingConfig
+	stopPricing   context.CancelFunc
+	pricingCache  cache.Cache
+	feedClient    *http.Client
+	fx            *fx.Converter
 	mu            sync.RWMutex
 }
 
@@ -60,41 +79,127 @@ type Tracker struct {
 func NewTracker(repo *database.Repository) *Tracker {
 	return &Tracker{
 		repo:          repo,
-		customPricing: make(map[string]ModelPricing),
+		customPricing: make(map[string]*models.ModelPrice),
+		pricingCache:  cache.NewMemory(10 * time.Minute),
+		feedClient:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetPricingCache replaces the default in-memory cache of resolved model pricing
+func (t *Tracker) SetPricingCache(c cache.Cache) {
+	t.pricingCache = c
+}
+
+// SetConverter sets the exchange rates used for limits in other currencies
+// than USD
+func (t *Tracker) SetConverter(c *fx.Converter) {
+	t.fx = c
+}
+
+// fromUSD converts a recorded cost to a limit's currency
+func (t *Tracker) fromUSD(amount float64, currency string) (float64, error) {
+	if t.fx == nil {
+		if code := fx.Normalize(currency); code != "" && code != fx.Base {
+			return 0, fmt.Errorf("%w: %s", fx.ErrUnknownCurrency, code)
+		}
+		return amount, nil
 	}
+	return t.fx.Convert(amount, fx.Base, currency)
 }
 
-// SetCustomPricing allows setting custom pricing for a model
+// toUSD converts an amount in a limit's currency to USD
+func (t *Tracker) toUSD(amount float64, currency string) (float64, error) {
+	if t.fx == nil {
+		if code := fx.Normalize(currency); code != "" && code != fx.Base {
+			return 0, fmt.Errorf("%w: %s", fx.ErrUnknownCurrency, code)
+		}
+		return amount, nil
+	}
+	return t.fx.Convert(amount, currency, fx.Base)
+}
+
+// SetCustomPricing allows setting custom pricing for a model in memory
 func (t *Tracker) SetCustomPricing(model string, pricing ModelPricing) {
 	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.customPricing[model] = pricing
+	t.customPricing[model] = &models.ModelPrice{
+		Model:       model,
+		InputPrice:  pricing.InputPricePerMillion,
+		OutputPrice: pricing.OutputPricePerMillion,
+		Unit:        UnitMillion,
+		Currency:    "USD",
+		Source:      models.PriceSourceManual,
+		UpdatedAt:   time.Now(),
+	}
+	t.mu.Unlock()
+
+	t.clearPricingCache()
+}
+
+// clearPricingCache drops resolved prices; prefix matches may resolve to a
+// different entry after any change, so everything goes
+func (t *Tracker) clearPricingCache() {
+	if err := t.pricingCache.Clear(context.Background()); err != nil {
+		log.Warn().Err(err).Msg("Failed to clear pricing cache")
+	}
 }
 
 // GetPricing returns the pricing for a model
 func (t *Tracker) GetPricing(model string) ModelPricing {
+	ctx := context.Background()
+
+	var cached ModelPricing
+	if found, err := t.pricingCache.Get(ctx, model, &cached); err == nil && found {
+		return cached
+	}
+
+	pricing := t.resolvePricing(model)
+	if err := t.pricingCache.Set(ctx, model, pricing, 0); err != nil {
+		log.Warn().Err(err).Str("model", model).Msg("Failed to cache model pricing")
+	}
+	return pricing
+}
+
+// resolvePricing looks up pricing from custom and default tables
+func (t *Tracker) resolvePricing(model string) ModelPricing {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
 
-	// Check custom pricing first
-	if pricing, ok := t.customPricing[model]; ok {
-		return pricing
+	key, custom := t.matchModel(model)
+	if custom {
+		p := t.customPricing[key]
+		return ModelPricing{InputPricePerMillion: p.InputPrice, OutputPricePerMillion: p.OutputPrice}
 	}
+	return defaultPricing[key]
+}
 
-	// Check default pricing
-	if pricing, ok := defaultPricing[model]; ok {
-		return pricing
+// matchModel finds the price entry for a model: an exact match, else the
+// longest entry the model name starts with (e.g. "gpt-4o-2024-08-06" ->
+// "gpt-4o"), else "default". Custom prices win over built-in ones of the
+// same length. The caller must hold t.mu.
+func (t *Tracker) matchModel(model string) (key string, custom bool) {
+	if _, ok := t.customPricing[model]; ok {
+		return model, true
+	}
+	if _, ok := defaultPricing[model]; ok {
+		return model, false
 	}
 
-	// Try to match partial model names (e.g., "gpt-4o-2024-08-06" -> "gpt-4o")
-	for key, pricing := range defaultPricing {
-		if len(model) >= len(key) && model[:len(key)] == key {
-			return pricing
+	key = "default"
+	best := 0
+	for k := range t.customPricing {
+		if len(k) > best && strings.HasPrefix(model, k) {
+			key, custom, best = k, true, len(k)
 		}
 	}
-
-	// Return default pricing
-	return defaultPricing["default"]
+	for k := range defaultPricing {
+		if len(k) > best && strings.HasPrefix(model, k) {
+			key, custom, best = k, false, len(k)
+		}
+	}
+	if key == "default" {
+		_, custom = t.customPricing["default"]
+	}
+	return key, custom
 }
 
 // CalculateCost calculates the cost for a given usage
@@ -107,62 +212,180 @@ func (t *Tracker) CalculateCost(model string, promptTokens, completionTokens int
 	return inputCost + outputCost
 }
 
-// RecordUsage records usage for a user and updates their spending limits
-func (t *Tracker) RecordUsage(ctx context.Context, userID, model string, usage *models.Usage) error {
-	if t.repo == nil || usage == nil {
+// periodStart returns when the spending limit period containing t began.
+// Periods are aligned to UTC; weeks start on Monday.
+func periodStart(limitType string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch limitType {
+	case "daily":
+		return day
+	case "weekly":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// periodEnd returns when the spending limit period containing t ends
+func periodEnd(limitType string, t time.Time) time.Time {
+	start := periodStart(limitType, t)
+	switch limitType {
+	case "daily":
+		return start.AddDate(0, 0, 1)
+	case "weekly":
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// appliesTo reports whether a limit covers a user of a tenant; limits
+// without a user cover every user of their tenant
+func appliesTo(limit *models.SpendingLimit, tenantID, userID string) bool {
+	if tenant.Of(limit.TenantID) != tenantID {
+		return false
+	}
+	return limit.UserID == userID || limit.UserID == "" || limit.UserID == "*"
+}
+
+// RecordUsage stores the usage record of an LLM call, pricing it if no cost
+// is set, and charges it to the spending limits covering the user in the
+// same transaction. Records are never updated.
+func (t *Tracker) RecordUsage(ctx context.Context, record *models.UsageRecord) error {
+	if t.repo == nil || record == nil {
 		return nil
 	}
 
-	cost := t.CalculateCost(model, usage.PromptTokens, usage.CompletionTokens)
+	if record.ID == "" {
+		record.ID = uuid.New().String()
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	if record.Currency == "" {
+		record.Currency = "USD"
+	}
+	if record.Cost == 0 {
+		record.Cost = t.CalculateCost(record.Model, record.PromptTokens, record.CompletionTokens)
+	}
+	// Set before queueing, as replayed writes run outside the request
+	record.TenantID = tenant.Assign(ctx, record.TenantID)
 
 	log.Debug().
-		Str("user_id", userID).
-		Str("model", model).
-		Int("prompt_tokens", usage.PromptTokens).
-		Int("completion_tokens", usage.CompletionTokens).
-		Float64("cost", cost).
+		Str("user_id", record.UserID).
+		Str("model", record.Model).
+		Int("prompt_tokens", record.PromptTokens).
+		Int("completion_tokens", record.CompletionTokens).
+		Float64("cost", record.Cost).
 		Msg("Recording usage")
 
-	// Update all spending limits for this user
+	// Queued for replay while the database is unreachable, charging the
+	// limits once it is back
+	return t.repo.Write(ctx, "usage_record", func(ctx context.Context) error {
+		return t.charge(ctx, record)
+	})
+}
+
+// charge stores a usage record and adds its cost to the spending limits of
+// its tenant covering its user, logging the limits whose alert threshold it
+// crosses
+func (t *Tracker) charge(ctx context.Context, record *models.UsageRecord) error {
 	limits, err := t.repo.ListSpendingLimits(ctx)
 	if err != nil {
-		log.Warn().Err(err).Msg("Failed to list spending limits")
 		return err
 	}
 
+	now := time.Now()
+	var charged []*models.SpendingLimit
+	var charges []database.SpendCharge
 	for _, limit := range limits {
-		// Update limits that match this user or are global (empty user_id)
-		if limit.UserID == userID || limit.UserID == "" || limit.UserID == "*" {
-			limit.CurrentSpend += cost
-			if err := t.repo.UpdateSpendingLimit(ctx, limit); err != nil {
-				log.Warn().Err(err).Str("limit_id", limit.ID).Msg("Failed to update spending limit")
-			} else {
-				log.Debug().
-					Str("limit_id", limit.ID).
-					Float64("new_spend", limit.CurrentSpend).
-					Float64("limit", limit.LimitAmount).
-					Msg("Updated spending limit")
-
-				// Check if alert threshold reached
-				if limit.AlertAt > 0 {
-					alertThreshold := limit.LimitAmount * (limit.AlertAt / 100)
-					if limit.CurrentSpend >= alertThreshold {
-						log.Warn().
-							Str("limit_id", limit.ID).
-							Str("user_id", limit.UserID).
-							Float64("current_spend", limit.CurrentSpend).
-							Float64("alert_threshold", alertThreshold).
-							Msg("Spending alert threshold reached")
-					}
-				}
-			}
+		if !appliesTo(limit, record.TenantID, record.UserID) {
+			continue
+		}
+		rate, err := t.fromUSD(1, limit.Currency)
+		if err != nil {
+			log.Warn().Err(err).Str("limit_id", limit.ID).Msg("Failed to convert usage cost")
+			continue
+		}
+		userID := limit.UserID
+		if userID == "*" {
+			userID = ""
+		}
+		charged = append(charged, limit)
+		charges = append(charges, database.SpendCharge{
+			LimitID:     limit.ID,
+			TenantID:    record.TenantID,
+			UserID:      userID,
+			Rate:        rate,
+			PeriodStart: periodStart(limit.LimitType, now),
+			PeriodEnd:   periodEnd(limit.LimitType, now),
+		})
+	}
+
+	spends, err := t.repo.RecordUsage(ctx, record, charges)
+	if err != nil {
+		return err
+	}
+	for i, limit := range charged {
+		if limit.AlertAt <= 0 {
+			continue
 		}
+		spend, cost := spends[i], record.Cost*charges[i].Rate
+		// Only the request that crosses the threshold alerts
+		alertThreshold := limit.LimitAmount * (limit.AlertAt / 100)
+		if spend-cost < alertThreshold && spend >= alertThreshold {
+			log.Warn().
+				Str("limit_id", limit.ID).
+				Str("user_id", limit.UserID).
+				Float64("current_spend", spend).
+				Str("currency", limit.Currency).
+				Float64("alert_threshold", alertThreshold).
+				Msg("Spending alert threshold reached")
+		}
+	}
+	return nil
+}
+
+// LimitSpend returns the usage a spending limit covers in its current period,
+// in the limit's currency. Charges keep the stored spend current until the
+// period ends; after that, and before the first charge, usage is summed.
+func (t *Tracker) LimitSpend(ctx context.Context, limit *models.SpendingLimit) (float64, error) {
+	if t.repo == nil || time.Now().Before(limit.ResetAt) {
+		return limit.CurrentSpend, nil
+	}
+	spend, err := t.usageCost(ctx, limit)
+	if err != nil {
+		return 0, err
 	}
+	return t.fromUSD(spend, limit.Currency)
+}
 
+// usageCost sums the usage a spending limit covers in its current period, in USD
+func (t *Tracker) usageCost(ctx context.Context, limit *models.SpendingLimit) (float64, error) {
+	userID := limit.UserID
+	if userID == "*" {
+		userID = ""
+	}
+	return t.repo.SumUsageCost(ctx, tenant.Of(limit.TenantID), userID, periodStart(limit.LimitType, time.Now()))
+}
+
+// FillSpend sets each limit's current spend and reset time from usage records
+func (t *Tracker) FillSpend(ctx context.Context, limits ...*models.SpendingLimit) error {
+	now := time.Now()
+	for _, limit := range limits {
+		spend, err := t.LimitSpend(ctx, limit)
+		if err != nil {
+			return err
+		}
+		limit.CurrentSpend = spend
+		limit.ResetAt = periodEnd(limit.LimitType, now)
+	}
 	return nil
 }
 
-// CheckLimit checks if a user has exceeded their spending limit
+// CheckLimit checks if a user has exceeded a spending limit of the tenant
+// ctx is confined to
 func (t *Tracker) CheckLimit(ctx context.Context, userID string) (bool, float64, float64, error) {
 	if t.repo == nil {
 		return false, 0, 0, nil
@@ -172,19 +395,83 @@ func (t *Tracker) CheckLimit(ctx context.Context, userID string) (bool, float64,
 	if err != nil {
 		return false, 0, 0, err
 	}
+	current := tenant.Current(ctx)
 
 	for _, limit := range limits {
-		if limit.UserID == userID || limit.UserID == "" || limit.UserID == "*" {
-			if limit.CurrentSpend >= limit.LimitAmount {
-				return true, limit.CurrentSpend, limit.LimitAmount, nil
-			}
+		if !appliesTo(limit, current, userID) {
+			continue
+		}
+		spend, err := t.LimitSpend(ctx, limit)
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if spend >= limit.LimitAmount {
+			return true, spend, limit.LimitAmount, nil
 		}
 	}
 
 	return false, 0, 0, nil
 }
 
-// GetUserSpending returns the current spending for a user
+// Remaining returns what is left, in USD, of the spending limit of the
+// current tenant covering the user that has the least left. It reports false when no limit applies.
+func (t *Tracker) Remaining(ctx context.Context, userID string) (float64, bool, error) {
+	if t.repo == nil {
+		return 0, false, nil
+	}
+
+	limits, err := t.repo.ListSpendingLimits(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	current := tenant.Current(ctx)
+
+	var least float64
+	found := false
+	for _, limit := range limits {
+		if !appliesTo(limit, current, userID) {
+			continue
+		}
+		spend, err := t.LimitSpend(ctx, limit)
+		if err != nil {
+			return 0, false, err
+		}
+		left, err := t.toUSD(limit.LimitAmount-spend, limit.Currency)
+		if err != nil {
+			return 0, false, err
+		}
+		if !found || left < least {
+			least, found = left, true
+		}
+	}
+	return max(least, 0), found, nil
+}
+
+// UserLimits returns the spending limits of the current tenant covering a
+// user, with their current spend and reset time
+func (t *Tracker) UserLimits(ctx context.Context, userID string) ([]*models.SpendingLimit, error) {
+	if t.repo == nil {
+		return []*models.SpendingLimit{}, nil
+	}
+
+	limits, err := t.repo.ListSpendingLimits(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := tenant.Current(ctx)
+	covering := make([]*models.SpendingLimit, 0, len(limits))
+	for _, limit := range limits {
+		if appliesTo(limit, current, userID) {
+			covering = append(covering, limit)
+		}
+	}
+	if err := t.FillSpend(ctx, covering...); err != nil {
+		return nil, err
+	}
+	return covering, nil
+}
+
+// GetUserSpending returns the current spending for a user in USD
 func (t *Tracker) GetUserSpending(ctx context.Context, userID string) (float64, error) {
 	if t.repo == nil {
 		return 0, nil
@@ -194,13 +481,37 @@ func (t *Tracker) GetUserSpending(ctx context.Context, userID string) (float64,
 	if err != nil {
 		return 0, err
 	}
+	current := tenant.Current(ctx)
 
 	var totalSpend float64
 	for _, limit := range limits {
-		if limit.UserID == userID || limit.UserID == "" || limit.UserID == "*" {
-			totalSpend += limit.CurrentSpend
+		if appliesTo(limit, current, userID) {
+			spend, err := t.usageCost(ctx, limit)
+			if err != nil {
+				return 0, err
+			}
+			totalSpend += spend
 		}
 	}
 
 	return totalSpend, nil
 }
+
+// ListUsage returns usage records matching the query with their totals.
+// Callers confined to a tenant only see its records.
+func (t *Tracker) ListUsage(ctx context.Context, q *models.UsageQuery) ([]*models.UsageRecord, *models.UsageSummary, error) {
+	if t.repo == nil {
+		return []*models.UsageRecord{}, &models.UsageSummary{}, nil
+	}
+	if scope, ok := tenant.FromContext(ctx); ok {
+		q.TenantID = scope
+	}
+	records, summary, err := t.repo.ListUsageRecords(ctx, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if records == nil {
+		records = []*models.UsageRecord{}
+	}
+	return records, summary, nil
+}
@@ -0,0 +1,73 @@
+package structured
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/epps11/goguard/internal/models"
+)
+
+// maxRepairErrors bounds the errors quoted back to the model when asking it
+// to repair a response
+const maxRepairErrors = 10
+
+// Check parses an LLM response as JSON and validates it against schema, if
+// not nil. A response wrapped in a markdown code fence is unwrapped first;
+// the JSON itself is returned, so callers can replace the response with it.
+func Check(content string, schema *Schema) (string, []string) {
+	text := unfence(content)
+
+	var doc interface{}
+	dec := json.NewDecoder(strings.NewReader(text))
+	if err := dec.Decode(&doc); err != nil {
+		return content, []string{"response is not valid JSON: " + err.Error()}
+	}
+	if dec.More() {
+		return content, []string{"response has text after the JSON value"}
+	}
+	if schema == nil {
+		return text, nil
+	}
+	return text, schema.Validate(doc)
+}
+
+// unfence strips surrounding whitespace and a markdown code fence, such as
+// ```json ... ```, that models often wrap JSON in
+func unfence(content string) string {
+	text := strings.TrimSpace(content)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") || len(text) < 6 {
+		return text
+	}
+	body := strings.TrimSuffix(text[3:], "```")
+	// The info string, e.g. json, runs to the end of the first line
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	} else {
+		return text
+	}
+	return strings.TrimSpace(body)
+}
+
+// RepairMessages returns the conversation to send the model to ask for a
+// corrected response: the original messages, its response and the errors
+// found in it
+func RepairMessages(messages []models.Message, response string, errs []string) []models.Message {
+	if len(errs) > maxRepairErrors {
+		errs = errs[:maxRepairErrors]
+	}
+	var b strings.Builder
+	b.WriteString("Your previous response is not valid. It must be only a JSON value, without any other text or code fences, that matches the requested schema. Problems found:\n")
+	for _, err := range errs {
+		b.WriteString("- ")
+		b.WriteString(err)
+		b.WriteString("\n")
+	}
+	b.WriteString("Reply with the corrected JSON only.")
+
+	repair := make([]models.Message, 0, len(messages)+2)
+	repair = append(repair, messages...)
+	return append(repair,
+		models.Message{Role: "assistant", Content: response},
+		models.Message{Role: "user", Content: b.String()},
+	)
+}
@@ -0,0 +1,564 @@
+// Package structured checks that LLM responses are JSON matching a schema
+// supplied by the caller
+package structured
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxErrors bounds the errors reported for a document
+const maxErrors = 20
+
+// maxDepth bounds how deeply schemas may nest and refer to each other
+const maxDepth = 64
+
+// Schema is a compiled JSON Schema. The validation keywords of draft 2020-12
+// that structured output APIs use are supported: type, enum, const,
+// properties, required, additionalProperties, items, prefixItems, minItems,
+// maxItems, uniqueItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, minProperties,
+// maxProperties, allOf, anyOf, oneOf, not, and $ref to $defs or definitions
+// of the same schema. Other keywords, such as format and description, are
+// ignored.
+type Schema struct {
+	// A boolean schema: true accepts anything, false nothing
+	boolean *bool
+
+	ref   string
+	root  *Schema
+	defs  map[string]*Schema
+	types []string
+	enum  []interface{}
+	konst *interface{}
+
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	minProperties        *int
+	maxProperties        *int
+
+	items       *Schema
+	prefixItems []*Schema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*Schema
+	anyOf []*Schema
+	oneOf []*Schema
+	not   *Schema
+}
+
+var jsonTypes = []string{"array", "boolean", "integer", "null", "number", "object", "string"}
+
+// Compile parses a JSON Schema, returning an error naming the first keyword
+// with an invalid value
+func Compile(raw json.RawMessage) (*Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("is not valid JSON: %w", err)
+	}
+	root := &Schema{}
+	if err := root.compile(doc, root, "", 0); err != nil {
+		return nil, err
+	}
+	if err := root.checkRefs(root, 0); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (s *Schema) compile(doc interface{}, root *Schema, path string, depth int) error {
+	if depth > maxDepth {
+		return errors.New("is nested too deeply")
+	}
+	s.root = root
+	if b, ok := doc.(bool); ok {
+		s.boolean = &b
+		return nil
+	}
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return keywordError(path, "must be an object or a boolean")
+	}
+
+	sub := func(key string, v interface{}) (*Schema, error) {
+		child := &Schema{}
+		return child, child.compile(v, root, path+"/"+key, depth+1)
+	}
+	subs := func(key string, v interface{}) ([]*Schema, error) {
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, keywordError(path+"/"+key, "must be a non-empty array of schemas")
+		}
+		out := make([]*Schema, len(list))
+		for i, item := range list {
+			child, err := sub(key+"/"+strconv.Itoa(i), item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = child
+		}
+		return out, nil
+	}
+	count := func(key string, v interface{}) (*int, error) {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != math.Trunc(n) {
+			return nil, keywordError(path+"/"+key, "must be a non-negative integer")
+		}
+		i := int(n)
+		return &i, nil
+	}
+	number := func(key string, v interface{}) (*float64, error) {
+		n, ok := v.(float64)
+		if !ok {
+			return nil, keywordError(path+"/"+key, "must be a number")
+		}
+		return &n, nil
+	}
+
+	// Keywords are compiled in order, so the error reported is stable
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var err error
+	for _, key := range keys {
+		v := m[key]
+		switch key {
+		case "$defs", "definitions":
+			defs, ok := v.(map[string]interface{})
+			if !ok {
+				return keywordError(path+"/"+key, "must be an object of schemas")
+			}
+			if s.defs == nil {
+				s.defs = make(map[string]*Schema, len(defs))
+			}
+			for name, def := range defs {
+				child, err := sub(key+"/"+name, def)
+				if err != nil {
+					return err
+				}
+				s.defs["#/"+key+"/"+name] = child
+			}
+		case "$ref":
+			ref, ok := v.(string)
+			if !ok {
+				return keywordError(path+"/$ref", "must be a string")
+			}
+			if ref != "#" && !strings.HasPrefix(ref, "#/$defs/") && !strings.HasPrefix(ref, "#/definitions/") {
+				return keywordError(path+"/$ref", "must refer to the schema itself or its $defs or definitions")
+			}
+			s.ref = ref
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, item := range t {
+					name, _ := item.(string)
+					s.types = append(s.types, name)
+				}
+			}
+			if len(s.types) == 0 {
+				return keywordError(path+"/type", "must be a type name or an array of them")
+			}
+			for _, t := range s.types {
+				if !slices.Contains(jsonTypes, t) {
+					return keywordError(path+"/type", "must be one of "+strings.Join(jsonTypes, ", "))
+				}
+			}
+		case "enum":
+			list, ok := v.([]interface{})
+			if !ok {
+				return keywordError(path+"/enum", "must be an array")
+			}
+			s.enum = list
+		case "const":
+			konst := v
+			s.konst = &konst
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return keywordError(path+"/properties", "must be an object of schemas")
+			}
+			s.properties = make(map[string]*Schema, len(props))
+			for name, prop := range props {
+				if s.properties[name], err = sub("properties/"+name, prop); err != nil {
+					return err
+				}
+			}
+		case "required":
+			list, ok := v.([]interface{})
+			if !ok {
+				return keywordError(path+"/required", "must be an array of strings")
+			}
+			for _, item := range list {
+				name, ok := item.(string)
+				if !ok {
+					return keywordError(path+"/required", "must be an array of strings")
+				}
+				s.required = append(s.required, name)
+			}
+		case "additionalProperties":
+			s.additionalProperties, err = sub(key, v)
+		case "minProperties":
+			s.minProperties, err = count(key, v)
+		case "maxProperties":
+			s.maxProperties, err = count(key, v)
+		case "items":
+			s.items, err = sub(key, v)
+		case "prefixItems":
+			s.prefixItems, err = subs(key, v)
+		case "minItems":
+			s.minItems, err = count(key, v)
+		case "maxItems":
+			s.maxItems, err = count(key, v)
+		case "uniqueItems":
+			b, ok := v.(bool)
+			if !ok {
+				return keywordError(path+"/uniqueItems", "must be a boolean")
+			}
+			s.uniqueItems = b
+		case "minLength":
+			s.minLength, err = count(key, v)
+		case "maxLength":
+			s.maxLength, err = count(key, v)
+		case "pattern":
+			p, ok := v.(string)
+			if !ok {
+				return keywordError(path+"/pattern", "must be a string")
+			}
+			if s.pattern, err = regexp.Compile(p); err != nil {
+				return keywordError(path+"/pattern", "is not a valid regular expression")
+			}
+		case "minimum":
+			s.minimum, err = number(key, v)
+		case "maximum":
+			s.maximum, err = number(key, v)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = number(key, v)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = number(key, v)
+		case "multipleOf":
+			if s.multipleOf, err = number(key, v); err == nil && *s.multipleOf <= 0 {
+				return keywordError(path+"/multipleOf", "must be greater than 0")
+			}
+		case "allOf":
+			s.allOf, err = subs(key, v)
+		case "anyOf":
+			s.anyOf, err = subs(key, v)
+		case "oneOf":
+			s.oneOf, err = subs(key, v)
+		case "not":
+			s.not, err = sub(key, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRefs makes sure every $ref resolves, so validation never meets one
+// that doesn't
+func (s *Schema) checkRefs(root *Schema, depth int) error {
+	if s == nil || depth > maxDepth {
+		return nil
+	}
+	if s.ref != "" && s.ref != "#" {
+		if _, ok := root.defs[s.ref]; !ok {
+			return keywordError("$ref", s.ref+" is not defined")
+		}
+	}
+	children := []*Schema{s.additionalProperties, s.items, s.not}
+	children = append(children, s.prefixItems...)
+	children = append(children, s.allOf...)
+	children = append(children, s.anyOf...)
+	children = append(children, s.oneOf...)
+	for _, p := range s.properties {
+		children = append(children, p)
+	}
+	for _, d := range s.defs {
+		children = append(children, d)
+	}
+	for _, child := range children {
+		if err := child.checkRefs(root, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func keywordError(path, msg string) error {
+	if path == "" {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("%s %s", strings.TrimPrefix(path, "/"), msg)
+}
+
+// Validate checks a decoded JSON document against the schema. It returns up
+// to 20 errors, each starting with the path of the value at fault, e.g.
+// "$.items[2].price must be at least 0".
+func (s *Schema) Validate(doc interface{}) []string {
+	v := &validation{}
+	v.check(s, doc, "$", 0)
+	return v.errs
+}
+
+type validation struct {
+	errs []string
+}
+
+func (v *validation) fail(path, format string, args ...interface{}) {
+	if len(v.errs) < maxErrors {
+		v.errs = append(v.errs, path+" "+fmt.Sprintf(format, args...))
+	}
+}
+
+// passes reports whether doc matches s, without recording errors
+func passes(s *Schema, doc interface{}, depth int) bool {
+	probe := &validation{}
+	probe.check(s, doc, "$", depth)
+	return len(probe.errs) == 0
+}
+
+func (v *validation) check(s *Schema, doc interface{}, path string, depth int) {
+	if depth > maxDepth {
+		v.fail(path, "nests schema references too deeply")
+		return
+	}
+	if s.boolean != nil {
+		if !*s.boolean {
+			v.fail(path, "is not allowed")
+		}
+		return
+	}
+	if s.ref == "#" {
+		v.check(s.root, doc, path, depth+1)
+	} else if s.ref != "" {
+		v.check(s.root.defs[s.ref], doc, path, depth+1)
+	}
+
+	if len(s.types) > 0 && !matchesType(s.types, doc) {
+		v.fail(path, "must be of type %s, not %s", strings.Join(s.types, " or "), typeOf(doc))
+		return
+	}
+	if s.enum != nil && !containsValue(s.enum, doc) {
+		v.fail(path, "must be one of %s", compact(s.enum))
+	}
+	if s.konst != nil && !reflect.DeepEqual(*s.konst, doc) {
+		v.fail(path, "must be %s", compact(*s.konst))
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		v.checkObject(s, d, path, depth)
+	case []interface{}:
+		v.checkArray(s, d, path, depth)
+	case string:
+		n := utf8.RuneCountInString(d)
+		if s.minLength != nil && n < *s.minLength {
+			v.fail(path, "must have at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			v.fail(path, "must have at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(d) {
+			v.fail(path, "must match %s", s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && d < *s.minimum {
+			v.fail(path, "must be at least %g", *s.minimum)
+		}
+		if s.maximum != nil && d > *s.maximum {
+			v.fail(path, "must be at most %g", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && d <= *s.exclusiveMinimum {
+			v.fail(path, "must be greater than %g", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && d >= *s.exclusiveMaximum {
+			v.fail(path, "must be less than %g", *s.exclusiveMaximum)
+		}
+		if s.multipleOf != nil {
+			if q := d / *s.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+				v.fail(path, "must be a multiple of %g", *s.multipleOf)
+			}
+		}
+	}
+
+	for _, sub := range s.allOf {
+		v.check(sub, doc, path, depth+1)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if passes(sub, doc, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "must match at least one of the schemas in anyOf")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if passes(sub, doc, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(path, "must match exactly one of the schemas in oneOf, matches %d", matched)
+		}
+	}
+	if s.not != nil && passes(s.not, doc, depth+1) {
+		v.fail(path, "must not match the schema in not")
+	}
+}
+
+func (v *validation) checkObject(s *Schema, obj map[string]interface{}, path string, depth int) {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			v.fail(path, "is missing required property %q", name)
+		}
+	}
+	if s.minProperties != nil && len(obj) < *s.minProperties {
+		v.fail(path, "must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(obj) > *s.maxProperties {
+		v.fail(path, "must have at most %d properties", *s.maxProperties)
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := propertyPath(path, name)
+		if prop, ok := s.properties[name]; ok {
+			v.check(prop, obj[name], child, depth+1)
+			continue
+		}
+		if s.additionalProperties != nil {
+			if b := s.additionalProperties.boolean; b != nil && !*b {
+				v.fail(child, "is not an allowed property")
+				continue
+			}
+			v.check(s.additionalProperties, obj[name], child, depth+1)
+		}
+	}
+}
+
+func (v *validation) checkArray(s *Schema, arr []interface{}, path string, depth int) {
+	if s.minItems != nil && len(arr) < *s.minItems {
+		v.fail(path, "must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(arr) > *s.maxItems {
+		v.fail(path, "must have at most %d items", *s.maxItems)
+	}
+	for i, item := range arr {
+		child := path + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case i < len(s.prefixItems):
+			v.check(s.prefixItems[i], item, child, depth+1)
+		case s.items != nil:
+			v.check(s.items, item, child, depth+1)
+		}
+	}
+	if s.uniqueItems {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if reflect.DeepEqual(arr[i], arr[j]) {
+					v.fail(path, "must have unique items, items %d and %d are equal", i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+// propertyPath appends a property to a path, quoting names that aren't
+// identifiers
+func propertyPath(path, name string) string {
+	for i, r := range name {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return path + "[" + strconv.Quote(name) + "]"
+		}
+	}
+	if name == "" {
+		return path + `[""]`
+	}
+	return path + "." + name
+}
+
+func matchesType(types []string, doc interface{}) bool {
+	actual := typeOf(doc)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(doc interface{}) string {
+	switch d := doc.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if d == math.Trunc(d) && !math.IsInf(d, 0) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func containsValue(values []interface{}, doc interface{}) bool {
+	for _, value := range values {
+		if reflect.DeepEqual(value, doc) {
+			return true
+		}
+	}
+	return false
+}
+
+// compact renders a value in errors
+func compact(value interface{}) string {
+	data, _ := json.Marshal(value)
+	if len(data) > 200 {
+		return string(data[:200]) + "..."
+	}
+	return string(data)
+}
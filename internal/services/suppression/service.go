@@ -0,0 +1,244 @@
+// Package suppression drops injection detections that are false positives
+// for some users or groups, such as a support team whose prompts say "act
+// as a customer"
+package suppression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/cache"
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/injection"
+)
+
+// ErrInvalidSuppression is returned for suppressions without a pattern or
+// without users or groups to apply to
+var ErrInvalidSuppression = errors.New("invalid suppression")
+
+// ErrSuppressionNotFound is returned when removing an unknown suppression
+var ErrSuppressionNotFound = errors.New("detection suppression not found")
+
+const cacheKeySuppressions = "detection_suppressions"
+
+// Stats counts the detections this instance dropped
+type Stats struct {
+	Suppressed    int64            `json:"suppressed"`
+	BySuppression map[string]int64 `json:"by_suppression"`
+	ByPattern     map[string]int64 `json:"by_pattern"`
+}
+
+// Service manages suppressions and applies them to the users and groups
+// they name
+type Service struct {
+	repo  *database.Repository
+	cache cache.Cache
+
+	mu           sync.Mutex
+	suppressions map[string]*models.DetectionSuppression // by ID, used without a database
+	stats        Stats
+}
+
+// NewService creates the service; suppressions are kept in memory when repo
+// is nil
+func NewService(repo *database.Repository) *Service {
+	return &Service{
+		repo:         repo,
+		cache:        cache.NewMemory(time.Minute),
+		suppressions: make(map[string]*models.DetectionSuppression),
+		stats: Stats{
+			BySuppression: make(map[string]int64),
+			ByPattern:     make(map[string]int64),
+		},
+	}
+}
+
+// SetCache replaces the default in-memory cache of stored suppressions, e.g.
+// with a Redis cache so suppressions reach every replica at once
+func (s *Service) SetCache(c cache.Cache) {
+	s.cache = c
+}
+
+// List returns the suppressions that haven't expired, newest first, with
+// the detections this instance dropped with each
+func (s *Service) List(ctx context.Context) ([]*models.DetectionSuppression, error) {
+	suppressions, err := s.active(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sup := range suppressions {
+		copied := *sup
+		copied.Hits = s.stats.BySuppression[sup.ID]
+		suppressions[i] = &copied
+	}
+	return suppressions, nil
+}
+
+// active returns the suppressions that haven't expired, newest first
+func (s *Service) active(ctx context.Context) ([]*models.DetectionSuppression, error) {
+	now := time.Now()
+	if s.repo == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		suppressions := make([]*models.DetectionSuppression, 0, len(s.suppressions))
+		for id, sup := range s.suppressions {
+			if sup.ExpiresAt != nil && !now.Before(*sup.ExpiresAt) {
+				delete(s.suppressions, id)
+				continue
+			}
+			suppressions = append(suppressions, sup)
+		}
+		slices.SortFunc(suppressions, func(a, b *models.DetectionSuppression) int { return b.CreatedAt.Compare(a.CreatedAt) })
+		return suppressions, nil
+	}
+
+	var suppressions []*models.DetectionSuppression
+	found, err := s.cache.Get(ctx, cacheKeySuppressions, &suppressions)
+	if err != nil {
+		log.Warn().Err(err).Msg("Detection suppression cache read failed")
+	}
+	if !found {
+		if suppressions, err = s.repo.ListDetectionSuppressions(ctx); err != nil {
+			return nil, err
+		}
+		if err := s.cache.Set(ctx, cacheKeySuppressions, suppressions, 0); err != nil {
+			log.Warn().Err(err).Msg("Detection suppression cache write failed")
+		}
+	}
+	// Cached suppressions may have run out since
+	var active []*models.DetectionSuppression
+	for _, sup := range suppressions {
+		if sup.ExpiresAt == nil || now.Before(*sup.ExpiresAt) {
+			active = append(active, sup)
+		}
+	}
+	return active, nil
+}
+
+// Create drops the detections of sup.PatternID for its users and groups,
+// until sup.ExpiresAt when set
+func (s *Service) Create(ctx context.Context, sup *models.DetectionSuppression) (*models.DetectionSuppression, error) {
+	if sup.PatternID == "" {
+		return nil, fmt.Errorf("%w: pattern_id is required", ErrInvalidSuppression)
+	}
+	if len(sup.Users) == 0 && len(sup.Groups) == 0 {
+		return nil, fmt.Errorf("%w: name the users or groups it applies to", ErrInvalidSuppression)
+	}
+	if slices.Contains(sup.Users, "") || slices.Contains(sup.Groups, "") {
+		return nil, fmt.Errorf("%w: users and groups can't be empty", ErrInvalidSuppression)
+	}
+	sup.ID = uuid.New().String()
+	sup.CreatedAt = time.Now()
+	sup.Hits = 0
+
+	if s.repo != nil {
+		if err := s.repo.DeleteExpiredDetectionSuppressions(ctx); err != nil {
+			log.Warn().Err(err).Msg("Failed to delete expired detection suppressions")
+		}
+		if err := s.repo.CreateDetectionSuppression(ctx, sup); err != nil {
+			return nil, err
+		}
+		s.Invalidate(ctx)
+	} else {
+		s.mu.Lock()
+		copied := *sup
+		s.suppressions[sup.ID] = &copied
+		s.mu.Unlock()
+	}
+
+	log.Info().Str("pattern_id", sup.PatternID).Strs("users", sup.Users).Strs("groups", sup.Groups).
+		Str("reason", sup.Reason).Msg("Detection suppressed")
+	return sup, nil
+}
+
+// Delete removes a suppression
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if s.repo != nil {
+		if err := s.repo.DeleteDetectionSuppression(ctx, id); err != nil {
+			return fmt.Errorf("%w: %s", ErrSuppressionNotFound, id)
+		}
+		s.Invalidate(ctx)
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.suppressions[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrSuppressionNotFound, id)
+	}
+	delete(s.suppressions, id)
+	return nil
+}
+
+// Suppressor returns the suppressor of a user in groups, or nil when no
+// suppression applies to them. When suppressions can't be loaded nothing is
+// suppressed, so detections err on the side of blocking.
+func (s *Service) Suppressor(ctx context.Context, userID string, groups []string) injection.Suppressor {
+	suppressions, err := s.active(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load detection suppressions")
+		return nil
+	}
+	// The oldest suppression of a pattern is the one reported
+	byPattern := make(map[string]string)
+	for _, sup := range slices.Backward(suppressions) {
+		if _, ok := byPattern[sup.PatternID]; ok {
+			continue
+		}
+		if (userID != "" && slices.Contains(sup.Users, userID)) || slices.ContainsFunc(sup.Groups, func(g string) bool {
+			return slices.Contains(groups, g)
+		}) {
+			byPattern[sup.PatternID] = sup.ID
+		}
+	}
+	if len(byPattern) == 0 {
+		return nil
+	}
+	return func(det models.Detection) string {
+		return byPattern[det.PatternID]
+	}
+}
+
+// Record counts the detections a report's suppressions dropped
+func (s *Service) Record(suppressed []models.Detection) {
+	if len(suppressed) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, det := range suppressed {
+		s.stats.Suppressed++
+		s.stats.BySuppression[det.SuppressedBy]++
+		s.stats.ByPattern[det.PatternID]++
+	}
+}
+
+// Stats returns the detections this instance dropped since it started
+func (s *Service) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		Suppressed:    s.stats.Suppressed,
+		BySuppression: maps.Clone(s.stats.BySuppression),
+		ByPattern:     maps.Clone(s.stats.ByPattern),
+	}
+}
+
+// Invalidate drops the cached suppressions, so they are read from the
+// database again, e.g. after another instance changed them
+func (s *Service) Invalidate(ctx context.Context) {
+	if err := s.cache.Delete(ctx, cacheKeySuppressions); err != nil {
+		log.Warn().Err(err).Msg("Detection suppression cache invalidation failed")
+	}
+}
@@ -0,0 +1,304 @@
+package topics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/llm"
+	"github.com/epps11/goguard/internal/services/policy"
+)
+
+// Where a conversation strayed off topic
+const (
+	LocationRequest  = "request"
+	LocationResponse = "response"
+)
+
+// DefaultThreshold is the cosine similarity to an example phrase at which
+// text counts as on its topic, for policies that don't set one
+const DefaultThreshold = 0.8
+
+// ErrTopicDenied is returned when a topic policy with a deny action is broken
+var ErrTopicDenied = errors.New("off-topic conversation denied by policy")
+
+// Checker matches requests and responses against topic policies. Keywords
+// are always checked; example phrases are compared by embedding similarity
+// when an embeddings client is available.
+type Checker struct {
+	engine  *policy.Engine
+	factory *llm.ClientFactory
+
+	mu       sync.Mutex
+	keywords map[string]*regexp.Regexp
+	examples map[string][]float64 // by embedding model and phrase
+}
+
+// NewChecker creates a checker for the topic policies of engine. factory
+// supplies the embeddings client; with a nil factory only keywords are used.
+func NewChecker(engine *policy.Engine, factory *llm.ClientFactory) *Checker {
+	return &Checker{
+		engine:   engine,
+		factory:  factory,
+		keywords: make(map[string]*regexp.Regexp),
+		examples: make(map[string][]float64),
+	}
+}
+
+// CheckRequest checks the user messages of a request: keywords anywhere in
+// them, similarity on the latest one. It returns nil when no topic policy
+// targets the request, and ErrTopicDenied, with the report, when it must
+// be refused.
+func (c *Checker) CheckRequest(ctx context.Context, userID, provider, model string, messages []models.Message) (*models.TopicReport, error) {
+	policies := c.engine.TopicPolicies(ctx, userID, provider, model)
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	var texts []string
+	for _, msg := range messages {
+		if msg.Role == "user" && strings.TrimSpace(msg.Content) != "" {
+			texts = append(texts, msg.Content)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return c.check(ctx, policies, LocationRequest, texts)
+}
+
+// CheckResponse checks an LLM response against the blocked topics of the
+// policies that ask for responses to be checked
+func (c *Checker) CheckResponse(ctx context.Context, userID, provider, model string, resp *models.LLMResponse) (*models.TopicReport, error) {
+	if resp == nil || strings.TrimSpace(resp.Content) == "" {
+		return nil, nil
+	}
+	var policies []models.Policy
+	for _, p := range c.engine.TopicPolicies(ctx, userID, provider, model) {
+		if p.Config.CheckResponses {
+			policies = append(policies, p)
+		}
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	return c.check(ctx, policies, LocationResponse, []string{resp.Content})
+}
+
+// check applies policies to texts. The last text is the one compared with
+// example phrases. Texts breaking no policy get no report.
+func (c *Checker) check(ctx context.Context, policies []models.Policy, location string, texts []string) (*models.TopicReport, error) {
+	report := &models.TopicReport{}
+	sim := &similarity{checker: c, text: texts[len(texts)-1]}
+
+	for _, p := range policies {
+		threshold := p.Config.TopicThreshold
+		if threshold == 0 {
+			threshold = DefaultThreshold
+		}
+		action := string(models.ActionWarn)
+		if p.Actions.Action == models.ActionDeny {
+			action = string(models.ActionDeny)
+		}
+		violation := models.TopicViolation{
+			PolicyID:   p.ID,
+			PolicyName: p.Name,
+			Location:   location,
+			Action:     action,
+		}
+
+		blocked := false
+		for _, topic := range p.Config.BlockedTopics {
+			match, score, ok := c.matchTopic(ctx, sim, topic, texts, threshold)
+			if !ok {
+				continue
+			}
+			v := violation
+			v.Topic, v.Match, v.Similarity = topic.Name, match, score
+			v.Reason = fmt.Sprintf("blocked topic %q", topic.Name)
+			report.Violations = append(report.Violations, v)
+			blocked = true
+			break
+		}
+
+		// Responses often answer without naming the topic, so only
+		// requests are held to the allowed topics
+		if !blocked && location == LocationRequest && len(p.Config.AllowedTopics) > 0 {
+			onTopic := false
+			names := make([]string, len(p.Config.AllowedTopics))
+			for i, topic := range p.Config.AllowedTopics {
+				names[i] = topic.Name
+				if !onTopic {
+					_, _, onTopic = c.matchTopic(ctx, sim, topic, texts, threshold)
+				}
+			}
+			if !onTopic {
+				v := violation
+				v.Reason = fmt.Sprintf("not on an allowed topic (%s)", strings.Join(names, ", "))
+				report.Violations = append(report.Violations, v)
+			}
+		}
+	}
+
+	if sim.err != nil {
+		report.Error = sim.err.Error()
+	}
+	if len(report.Violations) == 0 && report.Error == "" {
+		return nil, nil
+	}
+	for _, v := range report.Violations {
+		if v.Action == string(models.ActionDeny) {
+			report.Denied = true
+			return report, ErrTopicDenied
+		}
+	}
+	return report, nil
+}
+
+// matchTopic reports whether texts are on topic, and the keyword or example
+// phrase that put them there
+func (c *Checker) matchTopic(ctx context.Context, sim *similarity, topic models.Topic, texts []string, threshold float64) (string, float64, bool) {
+	for _, keyword := range topic.Keywords {
+		re := c.keyword(keyword)
+		if re == nil {
+			continue
+		}
+		for _, text := range texts {
+			if re.MatchString(text) {
+				return keyword, 0, true
+			}
+		}
+	}
+
+	best, bestScore := "", 0.0
+	for _, example := range topic.Examples {
+		score, ok := sim.score(ctx, example)
+		if ok && score > bestScore {
+			best, bestScore = example, score
+		}
+	}
+	if best != "" && bestScore >= threshold {
+		return best, math.Round(bestScore*1000) / 1000, true
+	}
+	return "", 0, false
+}
+
+// keyword returns the case-insensitive, whole-word pattern for a keyword
+func (c *Checker) keyword(keyword string) *regexp.Regexp {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	re, ok := c.keywords[keyword]
+	if !ok {
+		re = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(keyword) + `\b`)
+		c.keywords[keyword] = re
+	}
+	return re
+}
+
+// similarity compares one text with example phrases. The text is embedded
+// on first use, so requests matched by keywords alone cost no embeddings
+// call; after a failure, similarity is skipped for the rest of the check.
+type similarity struct {
+	checker *Checker
+	text    string
+
+	client *llm.EmbeddingClient
+	model  string
+	vector []float64
+	err    error
+}
+
+func (s *similarity) score(ctx context.Context, example string) (float64, bool) {
+	if s.err != nil {
+		return 0, false
+	}
+	if s.vector == nil {
+		if s.err = s.init(ctx); s.err != nil {
+			log.Warn().Err(s.err).Msg("Topic similarity unavailable - checking keywords only")
+			return 0, false
+		}
+	}
+
+	key := s.model + "\x00" + example
+	s.checker.mu.Lock()
+	vector, ok := s.checker.examples[key]
+	s.checker.mu.Unlock()
+	if !ok {
+		vectors, err := embed(ctx, s.client, []string{example})
+		if err != nil {
+			s.err = err
+			log.Warn().Err(err).Msg("Topic similarity unavailable - checking keywords only")
+			return 0, false
+		}
+		vector = vectors[0]
+		s.checker.mu.Lock()
+		s.checker.examples[key] = vector
+		s.checker.mu.Unlock()
+	}
+	return cosine(s.vector, vector), true
+}
+
+func (s *similarity) init(ctx context.Context) error {
+	if s.checker.factory == nil {
+		return errors.New("no embeddings client")
+	}
+	client, err := s.checker.factory.GetEmbeddingClient("")
+	if err != nil {
+		return err
+	}
+	vectors, err := embed(ctx, client, []string{s.text})
+	if err != nil {
+		return err
+	}
+	s.client = client
+	_, s.model = client.Target()
+	s.vector = vectors[0]
+	return nil
+}
+
+// embed returns the embeddings of texts as float vectors
+func embed(ctx context.Context, client *llm.EmbeddingClient, texts []string) ([][]float64, error) {
+	resp, err := client.Embed(ctx, &models.EmbeddingRequest{EncodingFormat: "float"}, texts)
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float64, len(resp.Data))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		if err := json.Unmarshal(d.Embedding, &vectors[d.Index]); err != nil {
+			return nil, fmt.Errorf("unreadable embedding: %w", err)
+		}
+	}
+	return vectors, nil
+}
+
+// cosine is the cosine similarity of two vectors, 0 if they can't be compared
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
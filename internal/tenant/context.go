@@ -0,0 +1,65 @@
+// Package tenant confines control plane and data plane work to an
+// organization. Every policy, user, limit, budget, API key and audit entry
+// belongs to a tenant; callers confined to one see and change only its own.
+package tenant
+
+import "context"
+
+// Default owns everything stored before tenants existed and everything made
+// by callers not assigned a tenant
+const Default = "default"
+
+type scopeKey struct{}
+
+// WithScope confines the work done with ctx to a tenant
+func WithScope(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, Of(id))
+}
+
+// FromContext returns the tenant ctx is confined to. Contexts that aren't,
+// such as those of super admins and of GoGuard's own background work, see
+// every tenant.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(scopeKey{}).(string)
+	return id, ok
+}
+
+// Of returns the tenant of an entry, mapping the empty tenant of entries
+// stored before tenants existed to Default
+func Of(id string) string {
+	if id == "" {
+		return Default
+	}
+	return id
+}
+
+// Visible reports whether an entry of tenant id can be seen with ctx
+func Visible(ctx context.Context, id string) bool {
+	scope, ok := FromContext(ctx)
+	return !ok || scope == Of(id)
+}
+
+// Assign returns the tenant of an entry created with ctx: the tenant ctx is
+// confined to, else the one asked for
+func Assign(ctx context.Context, id string) string {
+	if scope, ok := FromContext(ctx); ok {
+		return scope
+	}
+	return Of(id)
+}
+
+// Filter returns the tenant queries made with ctx are limited to, or "" for
+// every tenant
+func Filter(ctx context.Context) string {
+	scope, _ := FromContext(ctx)
+	return scope
+}
+
+// Current returns the tenant whose policies, limits and budgets apply to
+// work done with ctx: the one it is confined to, else Default
+func Current(ctx context.Context) string {
+	if scope, ok := FromContext(ctx); ok {
+		return scope
+	}
+	return Default
+}
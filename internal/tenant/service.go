@@ -0,0 +1,217 @@
+package tenant
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/epps11/goguard/internal/database"
+	"github.com/epps11/goguard/internal/models"
+)
+
+var (
+	// ErrInvalidTenant is returned for tenants with missing or invalid fields
+	ErrInvalidTenant = errors.New("invalid tenant")
+
+	// ErrTenantInUse is returned when deleting a tenant that still owns users,
+	// policies, limits, budgets or API keys
+	ErrTenantInUse = errors.New("tenant in use")
+)
+
+// idPattern is the form of tenant IDs, which are sent in headers and stored
+// on every entry of the tenant
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Usage reports whether a tenant still owns anything. Without a database
+// the policy engine, budgets and API keys keep their own entries and are
+// asked through it.
+type Usage func(ctx context.Context, id string) bool
+
+// Service manages the tenants of a deployment. The default tenant always
+// exists.
+type Service struct {
+	repo    *database.Repository
+	inUse   Usage
+	tenants map[string]*models.Tenant // used without a database
+	mu      sync.RWMutex
+}
+
+// NewService creates a tenant service; tenants are kept in memory when repo
+// is nil
+func NewService(repo *database.Repository) *Service {
+	now := time.Now()
+	return &Service{
+		repo: repo,
+		tenants: map[string]*models.Tenant{
+			Default: {
+				ID:          Default,
+				Name:        "Default",
+				Description: "Owns everything not assigned to another tenant",
+				Status:      models.TenantStatusActive,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			},
+		},
+	}
+}
+
+// SetUsage sets how tenants kept in memory are checked for entries before
+// they are deleted
+func (s *Service) SetUsage(inUse Usage) {
+	s.inUse = inUse
+}
+
+func validate(t *models.Tenant) error {
+	if !idPattern.MatchString(t.ID) {
+		return fmt.Errorf("%w: id must be 1 to 63 lower case letters, digits and hyphens", ErrInvalidTenant)
+	}
+	if t.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTenant)
+	}
+	switch t.Status {
+	case "":
+		t.Status = models.TenantStatusActive
+	case models.TenantStatusActive, models.TenantStatusSuspended:
+	default:
+		return fmt.Errorf("%w: status must be %s or %s", ErrInvalidTenant, models.TenantStatusActive, models.TenantStatusSuspended)
+	}
+	return nil
+}
+
+// Create adds a tenant
+func (s *Service) Create(ctx context.Context, t *models.Tenant) (*models.Tenant, error) {
+	if err := validate(t); err != nil {
+		return nil, err
+	}
+	if _, err := s.Get(ctx, t.ID); err == nil {
+		return nil, fmt.Errorf("%w: tenant %s exists", ErrInvalidTenant, t.ID)
+	}
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = t.CreatedAt
+
+	if s.repo != nil {
+		if err := s.repo.CreateTenant(ctx, t); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *t
+	s.tenants[t.ID] = &copied
+	return t, nil
+}
+
+// Get retrieves a tenant by ID
+func (s *Service) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	if s.repo != nil {
+		t, err := s.repo.GetTenant(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("tenant not found: %s", id)
+		}
+		return t, nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("tenant not found: %s", id)
+	}
+	copied := *t
+	return &copied, nil
+}
+
+// List returns every tenant, oldest first
+func (s *Service) List(ctx context.Context) ([]*models.Tenant, error) {
+	if s.repo != nil {
+		return s.repo.ListTenants(ctx)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tenants := make([]*models.Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		copied := *t
+		tenants = append(tenants, &copied)
+	}
+	slices.SortFunc(tenants, func(a, b *models.Tenant) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return tenants, nil
+}
+
+// Update changes a tenant's name, description and status. The default
+// tenant can't be suspended.
+func (s *Service) Update(ctx context.Context, t *models.Tenant) (*models.Tenant, error) {
+	if err := validate(t); err != nil {
+		return nil, err
+	}
+	if t.ID == Default && t.Status != models.TenantStatusActive {
+		return nil, fmt.Errorf("%w: the default tenant can't be suspended", ErrInvalidTenant)
+	}
+	existing, err := s.Get(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	t.CreatedAt = existing.CreatedAt
+	t.UpdatedAt = time.Now()
+
+	if s.repo != nil {
+		if err := s.repo.UpdateTenant(ctx, t); err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *t
+	s.tenants[t.ID] = &copied
+	return t, nil
+}
+
+// Delete removes a tenant that no longer owns anything. Its audit log is
+// kept. The default tenant can't be deleted.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if id == Default {
+		return fmt.Errorf("%w: the default tenant can't be deleted", ErrInvalidTenant)
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+
+	if s.repo != nil {
+		used, err := s.repo.TenantInUse(ctx, id)
+		if err != nil {
+			return err
+		}
+		if used {
+			return fmt.Errorf("%w: %s still has users, policies, limits, budgets or API keys", ErrTenantInUse, id)
+		}
+		return s.repo.DeleteTenant(ctx, id)
+	}
+
+	if s.inUse != nil && s.inUse(ctx, id) {
+		return fmt.Errorf("%w: %s still has users, policies, limits, budgets or API keys", ErrTenantInUse, id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tenants, id)
+	return nil
+}
+
+// Active reports whether a tenant exists and isn't suspended
+func (s *Service) Active(ctx context.Context, id string) bool {
+	t, err := s.Get(ctx, Of(id))
+	return err == nil && t.Status == models.TenantStatusActive
+}
@@ -0,0 +1,275 @@
+// Package goguard runs GoGuard's checks in-process, for applications that
+// call LLMs themselves instead of through a GoGuard server. It detects
+// prompt injections and credentials, masks PII and applies model and tool
+// access policies with the same detectors as the server.
+//
+//	guard, err := goguard.New(goguard.DefaultConfig())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	resp, err := guard.Guard(ctx, &goguard.GuardRequest{
+//		UserID:   "alice",
+//		Messages: []goguard.Message{{Role: "user", Content: prompt}},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if !resp.Allowed {
+//		return errors.New(resp.Error)
+//	}
+//	send(resp.ProcessedInput.MaskedMessages)
+//
+// Quotas, budgets, spending, topic and OPA policies, response moderation and
+// the audit log need the state of a server and are only applied by one.
+package goguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/epps11/goguard/internal/config"
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/injection"
+	"github.com/epps11/goguard/internal/services/pii"
+	"github.com/epps11/goguard/internal/services/policy"
+	"github.com/epps11/goguard/internal/services/secrets"
+)
+
+// ErrNoMessages is returned for requests without messages
+var ErrNoMessages = errors.New("goguard: request has no messages")
+
+// Config configures a Guard. DefaultConfig returns the settings a server
+// starts with.
+type Config struct {
+	// Prompt injection
+	DetectInjection   bool
+	BlockOnInjection  bool
+	InjectionPatterns []string // regular expressions added to the built-in ones
+	MaxScanBytes      int      // longest prompt scanned for injections, in bytes; longer ones are refused. 0 is unlimited.
+
+	// PII
+	MaskPII        bool
+	PIITypes       []string // email, phone, ssn, credit_card, etc.; empty masks every type
+	PIILocales     []string // locale packs adding their types: uk, eu, ca, in
+	MaskCharacter  string
+	PreserveDomain bool   // for emails, keep the domain visible
+	PIIMode        string // mask (default) or pseudonymize
+	PseudonymKey   string // derives pseudonyms; random per Guard when empty
+
+	// Credentials
+	DetectSecrets     bool
+	SecretsAction     string   // block (default), mask or warn
+	SecretTypes       []string // detectors to run; empty runs all
+	SecretsMinEntropy float64  // bits per character a token needs to count as a secret
+
+	// Policies are applied with their model and tool allow/deny lists.
+	// Policies without a status are active.
+	Policies []*Policy
+}
+
+// DefaultConfig returns the default configuration of a GoGuard server
+func DefaultConfig() Config {
+	defaults := config.DefaultConfig()
+	return Config{
+		DetectInjection:   defaults.Security.EnableInjectionDetection,
+		BlockOnInjection:  defaults.Security.BlockOnDetection,
+		MaxScanBytes:      defaults.Security.ScanLimit(),
+		MaskPII:           defaults.PII.EnableMasking,
+		PIITypes:          defaults.PII.PIITypes,
+		MaskCharacter:     defaults.PII.MaskCharacter,
+		PreserveDomain:    defaults.PII.PreserveDomain,
+		PIIMode:           defaults.PII.Mode,
+		DetectSecrets:     defaults.Secrets.Enabled,
+		SecretsAction:     defaults.Secrets.Action,
+		SecretsMinEntropy: defaults.Secrets.MinEntropy,
+	}
+}
+
+// Guard checks requests before they are sent to an LLM. It is safe for
+// concurrent use.
+type Guard struct {
+	detector *injection.Detector
+	masker   *pii.Masker
+	secrets  *secrets.Detector
+	policies *policy.Engine
+}
+
+// New creates a guard, returning an error for invalid settings and policies
+func New(cfg Config) (*Guard, error) {
+	detector := injection.NewDetector(nil, cfg.DetectInjection, cfg.BlockOnInjection)
+	detector.SetScanLimits(injection.DefaultChunkBytes, cfg.MaxScanBytes, true)
+	if err := detector.SetCustomPatterns(cfg.InjectionPatterns); err != nil {
+		return nil, fmt.Errorf("goguard: %w", err)
+	}
+
+	piiTypes, err := pii.WithLocales(cfg.PIITypes, cfg.PIILocales)
+	if err != nil {
+		return nil, fmt.Errorf("goguard: %w", err)
+	}
+	if cfg.MaskCharacter == "" {
+		cfg.MaskCharacter = "*"
+	}
+	masker := pii.NewMasker(piiTypes, cfg.MaskCharacter, cfg.PreserveDomain, cfg.MaskPII)
+	masker.SetPseudonymKey([]byte(cfg.PseudonymKey))
+	if cfg.PIIMode != "" {
+		if err := masker.SetMode(cfg.PIIMode); err != nil {
+			return nil, fmt.Errorf("goguard: %w", err)
+		}
+	}
+
+	// The server falls back to blocking on unknown settings; a library
+	// caller can fix them instead
+	if cfg.SecretsAction == "" {
+		cfg.SecretsAction = secrets.ActionBlock
+	}
+	switch cfg.SecretsAction {
+	case secrets.ActionBlock, secrets.ActionMask, secrets.ActionWarn:
+	default:
+		return nil, fmt.Errorf("goguard: unknown secrets action %q (use %s, %s or %s)",
+			cfg.SecretsAction, secrets.ActionBlock, secrets.ActionMask, secrets.ActionWarn)
+	}
+	for _, t := range cfg.SecretTypes {
+		if !slices.Contains(secrets.Types(), t) {
+			return nil, fmt.Errorf("goguard: unknown secret type %q (use %s)", t, strings.Join(secrets.Types(), ", "))
+		}
+	}
+	secretsDetector := secrets.NewDetector(config.SecretsConfig{
+		Enabled:    cfg.DetectSecrets,
+		Action:     cfg.SecretsAction,
+		Types:      cfg.SecretTypes,
+		MinEntropy: cfg.SecretsMinEntropy,
+	})
+
+	engine := policy.NewEngine()
+	for i, p := range cfg.Policies {
+		// The engine keeps what it is given, so later changes by the caller
+		// don't reach it
+		stored := *p
+		if stored.Status == "" {
+			stored.Status = models.PolicyStatusActive
+		}
+		if _, err := engine.CreatePolicy(context.Background(), &stored); err != nil {
+			return nil, fmt.Errorf("goguard: policy %d (%s): %w", i, p.Name, err)
+		}
+	}
+
+	return &Guard{
+		detector: detector,
+		masker:   masker,
+		secrets:  secretsDetector,
+		policies: engine,
+	}, nil
+}
+
+// Guard checks a request and masks its PII. Refused requests are returned
+// with Allowed false and the reason in Error; the messages to send are
+// ProcessedInput.MaskedMessages. Of the request options, only injection
+// detection, PII masking and the block threshold apply.
+func (g *Guard) Guard(ctx context.Context, req *GuardRequest) (*GuardResponse, error) {
+	startTime := time.Now()
+	if req == nil || len(req.Messages) == 0 {
+		return nil, ErrNoMessages
+	}
+
+	response := &GuardResponse{RequestID: req.RequestID, Allowed: true}
+	if response.RequestID == "" {
+		response.RequestID = uuid.New().String()
+	}
+	refuse := func(reason string) (*GuardResponse, error) {
+		response.Allowed = false
+		response.Error = reason
+		response.ProcessingTime = time.Since(startTime)
+		return response, nil
+	}
+
+	// Injection detection
+	securityReport := &models.SecurityReport{ThreatLevel: "none", Detections: []models.Detection{}, Recommendations: []string{}}
+	if req.Options.DetectInjection() {
+		securityReport = g.detector.AnalyzeUntil(req.Messages, req.Options.Threshold(), nil)
+		securityReport.ToolFindings = g.detector.AnalyzeToolCalls(req.Messages, nil)
+	}
+	response.SecurityReport = securityReport
+
+	blocked := g.detector.ShouldBlock(securityReport)
+	if req.Options != nil && req.Options.BlockThreshold != "" {
+		blocked = injection.ShouldBlockAt(securityReport, req.Options.BlockThreshold)
+		securityReport.BlockedReason = ""
+		if blocked {
+			securityReport.BlockedReason = "Potential prompt injection detected"
+		}
+	}
+	if blocked {
+		return refuse(securityReport.BlockedReason)
+	}
+	if securityReport.ScanTruncated {
+		return refuse(fmt.Sprintf("prompt too large: only the first %d bytes are scanned for injections", g.detector.MaxScanBytes()))
+	}
+
+	// Credentials
+	messages, secretsReport := g.secrets.Scan(req.Messages)
+	response.SecretsReport = secretsReport
+	if secretsReport.Action == secrets.ActionBlock {
+		return refuse(secretsError(secretsReport))
+	}
+
+	// PII
+	maskedMessages, piiReport := messages, &models.PIIReport{PIITypes: []models.PIIMatch{}}
+	if req.Options.MaskPII() {
+		maskedMessages, piiReport = g.masker.Mask(messages)
+	}
+	response.PIIReport = piiReport
+	response.ProcessedInput = &models.ProcessedInput{
+		OriginalMessages: req.Messages,
+		MaskedMessages:   maskedMessages,
+		PIIMasked:        piiReport.PIIDetected,
+	}
+
+	// Model and tool access
+	if denial := g.policies.CheckModelAccess(ctx, req.UserID, req.Provider, req.Model); denial != nil {
+		return refuse(fmt.Sprintf("Model access denied by policy '%s': %s", denial.PolicyName, denial.Reason))
+	}
+	if denial := g.policies.CheckToolAccess(ctx, req.UserID, req.Provider, req.Model, toolNames(req)); denial != nil {
+		return refuse(fmt.Sprintf("Tool access denied by policy '%s': %s", denial.PolicyName, denial.Reason))
+	}
+
+	response.ProcessingTime = time.Since(startTime)
+	return response, nil
+}
+
+// secretsError explains a request blocked for containing credentials
+func secretsError(report *models.SecretsReport) string {
+	var types []string
+	for _, f := range report.Findings {
+		if !slices.Contains(types, f.Type) {
+			types = append(types, f.Type)
+		}
+	}
+	return fmt.Sprintf("Request blocked: it contains credentials (%s). Remove them and retry.", strings.Join(types, ", "))
+}
+
+// toolNames returns the functions offered to or called by the model
+func toolNames(req *GuardRequest) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, tool := range req.Tools {
+		add(tool.Function.Name)
+	}
+	for _, msg := range req.Messages {
+		for _, call := range msg.ToolCalls {
+			add(call.Function.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,130 @@
+package goguard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/epps11/goguard/internal/models"
+	"github.com/epps11/goguard/internal/services/secrets"
+)
+
+// contextKey stores the guard response of a request in its context
+type contextKey struct{}
+
+// FromContext returns the response of the middleware for the request whose
+// context this is
+func FromContext(ctx context.Context) (*GuardResponse, bool) {
+	resp, ok := ctx.Value(contextKey{}).(*GuardResponse)
+	return resp, ok
+}
+
+// Middleware guards requests with an OpenAI-style chat body before next
+// handles them. Refused requests get a 403 with the guard response, as from
+// a GoGuard server; allowed ones reach next with their messages masked and
+// the guard response in their context. The user is the user_id or user
+// field of the body. Requests without a JSON body with messages are passed
+// on untouched.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, status, body := g.guardHTTP(r)
+		if body != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(body)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Gin is Middleware for Gin routers
+func (g *Guard) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, status, body := g.guardHTTP(c.Request)
+		if body != nil {
+			c.AbortWithStatusJSON(status, body)
+			return
+		}
+		c.Request = r
+		c.Next()
+	}
+}
+
+// guardHTTP guards the body of r. It returns the request to pass on, or the
+// status and body to respond with instead.
+func (g *Guard) guardHTTP(r *http.Request) (*http.Request, int, interface{}) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, 0, nil
+	}
+	data, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return r, http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid request body",
+			Code:  models.ErrCodeInvalidRequest,
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	var req struct {
+		GuardRequest
+		User string `json:"user"` // the OpenAI field
+	}
+	if json.Unmarshal(data, &req) != nil || len(req.Messages) == 0 {
+		return r, 0, nil
+	}
+	if req.UserID == "" {
+		req.UserID = req.User
+	}
+	if req.RequestID == "" {
+		req.RequestID = r.Header.Get("X-Request-ID")
+	}
+
+	resp, err := g.Guard(r.Context(), &req.GuardRequest)
+	if err != nil {
+		return r, http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+			Code:  models.ErrCodeInvalidRequest,
+		}
+	}
+	if !resp.Allowed {
+		return r, http.StatusForbidden, resp
+	}
+
+	// Only changed messages are written back, so the rest of the body keeps
+	// its exact form
+	masked := resp.ProcessedInput.PIIMasked ||
+		(resp.SecretsReport.SecretsDetected && resp.SecretsReport.Action == secrets.ActionMask)
+	if masked {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return r, http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid request body",
+				Code:  models.ErrCodeInvalidRequest,
+			}
+		}
+		messages, err := json.Marshal(resp.ProcessedInput.MaskedMessages)
+		if err != nil {
+			return r, http.StatusInternalServerError, models.ErrorResponse{
+				Error: err.Error(),
+				Code:  models.ErrCodeInternal,
+			}
+		}
+		fields["messages"] = messages
+		if data, err = json.Marshal(fields); err != nil {
+			return r, http.StatusInternalServerError, models.ErrorResponse{
+				Error: err.Error(),
+				Code:  models.ErrCodeInternal,
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		r.ContentLength = int64(len(data))
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, resp)), 0, nil
+}
@@ -0,0 +1,45 @@
+package goguard
+
+import "github.com/epps11/goguard/internal/models"
+
+// The request, response and policy types are those of the server, so
+// checks run in-process report the same way as checks run by a server.
+
+// Requests and reports
+type (
+	GuardRequest     = models.GuardRequest
+	GuardOptions     = models.GuardOptions
+	GuardResponse    = models.GuardResponse
+	Message          = models.Message
+	ContentPart      = models.ContentPart
+	ImageURL         = models.ImageURL
+	Tool             = models.Tool
+	ToolFunction     = models.ToolFunction
+	ToolCall         = models.ToolCall
+	ToolCallFunction = models.ToolCallFunction
+	ProcessedInput   = models.ProcessedInput
+	SecurityReport   = models.SecurityReport
+	Detection        = models.Detection
+	PIIReport        = models.PIIReport
+	PIIMatch         = models.PIIMatch
+	SecretsReport    = models.SecretsReport
+	SecretFinding    = models.SecretFinding
+)
+
+// Policies
+type (
+	Policy        = models.Policy
+	PolicyType    = models.PolicyType
+	PolicyStatus  = models.PolicyStatus
+	PolicyConfig  = models.PolicyConfig
+	PolicyTargets = models.PolicyTargets
+	PolicyActions = models.PolicyActions
+)
+
+const (
+	PolicyTypeAccess     = models.PolicyTypeAccess
+	PolicyTypeCompliance = models.PolicyTypeCompliance
+
+	PolicyStatusActive   = models.PolicyStatusActive
+	PolicyStatusInactive = models.PolicyStatusInactive
+)
@@ -0,0 +1,266 @@
+// Package goguardclient calls the GoGuard data plane and control plane APIs
+// from Go, with retries and context support.
+//
+//	client := goguardclient.New(goguardclient.Config{
+//		BaseURL: "http://localhost:8080",
+//		APIKey:  os.Getenv("GOGUARD_API_KEY"),
+//	})
+//	resp, err := client.Guard(ctx, &goguardclient.GuardRequest{
+//		UserID:   "alice",
+//		Messages: []goguardclient.Message{{Role: "user", Content: "Hello"}},
+//	})
+package goguardclient
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for the zero values of Config
+const (
+	DefaultMaxRetries = 3
+	DefaultMinBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff = 5 * time.Second
+	DefaultTimeout    = 60 * time.Second
+)
+
+// Config configures a Client
+type Config struct {
+	BaseURL    string       // GoGuard server, e.g. http://localhost:8080
+	APIKey     string       // sent as X-API-Key; needs the permissions of the endpoints called
+	HTTPClient *http.Client // defaults to a client with a 60s timeout
+
+	// MaxRetries is how often a failed request is retried: after connection
+	// errors, 502, 503 and 504 responses, and 429 responses that don't ask to
+	// wait longer than MaxBackoff. 0 uses DefaultMaxRetries; a negative value
+	// turns retries off.
+	MaxRetries int
+	MinBackoff time.Duration // first retry delay, doubled on each retry
+	MaxBackoff time.Duration // longest retry delay
+}
+
+// Client calls a GoGuard server. It uses the v1 API, whose response shapes
+// are frozen. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	http       *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// New creates a client
+func New(cfg Config) *Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	switch {
+	case cfg.MaxRetries == 0:
+		cfg.MaxRetries = DefaultMaxRetries
+	case cfg.MaxRetries < 0:
+		cfg.MaxRetries = 0
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.MinBackoff)
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(cfg.BaseURL, "/") + "/api/v1",
+		apiKey:     cfg.APIKey,
+		http:       cfg.HTTPClient,
+		maxRetries: cfg.MaxRetries,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+	}
+}
+
+// APIError is a response with an error status
+type APIError struct {
+	StatusCode int
+	Message    string // the error field of the response, or the status text
+	Code       string // machine-readable code, when the endpoint sets one
+	RequestID  string
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("goguard: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// do sends a request, retrying failures, and decodes a successful JSON
+// response into out if it isn't nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	body, err := c.send(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("goguard: unreadable response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request, retrying failures, and returns the response body.
+// Responses with an error status are returned as an *APIError along with
+// their body. Every attempt of a POST carries the same Idempotency-Key, so
+// a retry of a request that did reach the server isn't applied twice.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in interface{}) ([]byte, error) {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var idempotencyKey string
+	if method == http.MethodPost {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, retryAfter, err := c.attempt(ctx, method, target, payload, idempotencyKey)
+		if err == nil || attempt >= c.maxRetries || !c.retryable(ctx, err, retryAfter) {
+			return body, err
+		}
+
+		wait := c.backoff(attempt)
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return body, err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a request once, returning the delay asked for by a
+// Retry-After header along with the body
+func (c *Client) attempt(ctx context.Context, method, target string, payload []byte, idempotencyKey string) ([]byte, time.Duration, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var retryAfter time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+	if resp.StatusCode >= 300 {
+		return body, retryAfter, newAPIError(resp, body)
+	}
+	return body, retryAfter, nil
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: resp.StatusCode, Body: body, RequestID: resp.Header.Get("X-Request-ID")}
+	var fields struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(body, &fields) == nil {
+		apiErr.Message, apiErr.Code = fields.Error, fields.Code
+		if fields.RequestID != "" {
+			apiErr.RequestID = fields.RequestID
+		}
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
+
+// retryable reports whether a failed attempt is worth repeating
+func (c *Client) retryable(ctx context.Context, err error, retryAfter time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// The server couldn't be reached or the connection dropped
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusTooManyRequests:
+		// Exhausted budgets ask to wait until they reset, often days away
+		return retryAfter <= c.maxBackoff
+	}
+	return false
+}
+
+// newIdempotencyKey returns a random key identifying a request across its
+// retries
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// backoff returns the delay before a retry: exponential, capped at
+// maxBackoff, with jitter so clients don't retry in lockstep
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << attempt
+	if d > c.maxBackoff || d <= 0 {
+		d = c.maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,161 @@
+package goguardclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListPolicies returns every policy
+func (c *Client) ListPolicies(ctx context.Context) ([]*Policy, error) {
+	var resp struct {
+		Policies []*Policy `json:"policies"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/control/policies", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Policies, nil
+}
+
+// GetPolicy returns a policy by ID. IsNotFound reports a missing policy.
+func (c *Client) GetPolicy(ctx context.Context, id string) (*Policy, error) {
+	var policy Policy
+	if err := c.do(ctx, http.MethodGet, "/control/policies/"+url.PathEscape(id), nil, nil, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// CreatePolicy creates a policy and returns it with its ID
+func (c *Client) CreatePolicy(ctx context.Context, policy *Policy) (*Policy, error) {
+	var created Policy
+	if err := c.do(ctx, http.MethodPost, "/control/policies", nil, policy, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdatePolicy replaces the policy with policy.ID
+func (c *Client) UpdatePolicy(ctx context.Context, policy *Policy) (*Policy, error) {
+	var updated Policy
+	if err := c.do(ctx, http.MethodPut, "/control/policies/"+url.PathEscape(policy.ID), nil, policy, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeletePolicy deletes a policy, giving the reason recorded with it. The
+// policy can be restored with RestorePolicy.
+func (c *Client) DeletePolicy(ctx context.Context, id, reason string) error {
+	body := map[string]string{"reason": reason}
+	return c.do(ctx, http.MethodDelete, "/control/policies/"+url.PathEscape(id), nil, body, nil)
+}
+
+// RestorePolicy restores a deleted policy
+func (c *Client) RestorePolicy(ctx context.Context, id string) (*Policy, error) {
+	var restored Policy
+	if err := c.do(ctx, http.MethodPost, "/control/policies/"+url.PathEscape(id)+"/restore", nil, nil, &restored); err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+// ListSpendingLimits returns every spending limit with its current spend
+func (c *Client) ListSpendingLimits(ctx context.Context) ([]*SpendingLimit, error) {
+	var resp struct {
+		SpendingLimits []*SpendingLimit `json:"spending_limits"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/control/spending-limits", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.SpendingLimits, nil
+}
+
+// GetSpendingLimit returns a spending limit by ID
+func (c *Client) GetSpendingLimit(ctx context.Context, id string) (*SpendingLimit, error) {
+	var limit SpendingLimit
+	if err := c.do(ctx, http.MethodGet, "/control/spending-limits/"+url.PathEscape(id), nil, nil, &limit); err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// CreateSpendingLimit creates a spending limit and returns it with its ID
+func (c *Client) CreateSpendingLimit(ctx context.Context, limit *SpendingLimit) (*SpendingLimit, error) {
+	var created SpendingLimit
+	if err := c.do(ctx, http.MethodPost, "/control/spending-limits", nil, limit, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateSpendingLimit replaces the spending limit with limit.ID
+func (c *Client) UpdateSpendingLimit(ctx context.Context, limit *SpendingLimit) (*SpendingLimit, error) {
+	var updated SpendingLimit
+	if err := c.do(ctx, http.MethodPut, "/control/spending-limits/"+url.PathEscape(limit.ID), nil, limit, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// AuditQuery filters audit log entries. Zero fields don't filter.
+type AuditQuery struct {
+	EventTypes   []AuditEventType
+	UserID       string
+	ResourceType string
+	Status       AuditStatus
+	StartTime    time.Time
+	EndTime      time.Time
+	Limit        int // entries per page; the server's default when 0
+	Offset       int
+}
+
+// AuditLogPage is a page of audit log entries, newest first
+type AuditLogPage struct {
+	Logs   []*AuditLog `json:"logs"`
+	Total  int         `json:"total"` // entries matching the query
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// QueryAuditLogs returns a page of the audit log entries matching q
+func (c *Client) QueryAuditLogs(ctx context.Context, q AuditQuery) (*AuditLogPage, error) {
+	query := url.Values{}
+	if len(q.EventTypes) > 0 {
+		types := make([]string, len(q.EventTypes))
+		for i, t := range q.EventTypes {
+			types[i] = string(t)
+		}
+		query.Set("event_types", strings.Join(types, ","))
+	}
+	if q.UserID != "" {
+		query.Set("user_id", q.UserID)
+	}
+	if q.ResourceType != "" {
+		query.Set("resource_type", q.ResourceType)
+	}
+	if q.Status != "" {
+		query.Set("status", string(q.Status))
+	}
+	if !q.StartTime.IsZero() {
+		query.Set("start_time", q.StartTime.Format(time.RFC3339))
+	}
+	if !q.EndTime.IsZero() {
+		query.Set("end_time", q.EndTime.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset > 0 {
+		query.Set("offset", strconv.Itoa(q.Offset))
+	}
+
+	var page AuditLogPage
+	if err := c.do(ctx, http.MethodGet, "/control/audit/logs", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
@@ -0,0 +1,55 @@
+package goguardclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Guard runs a request through the full pipeline and forwards it to the LLM.
+// Requests GoGuard refuses, for an injection, a policy, a quota or a budget,
+// are returned with Allowed false and the reason in Error, not as an error.
+// A request ID is set if the request has none, so retries of the same
+// request share it. Streaming isn't supported.
+func (c *Client) Guard(ctx context.Context, req *GuardRequest) (*GuardResponse, error) {
+	return c.guard(ctx, "/guard", req)
+}
+
+// Analyze checks a request for injections and PII without calling the LLM
+func (c *Client) Analyze(ctx context.Context, req *GuardRequest) (*GuardResponse, error) {
+	return c.guard(ctx, "/analyze", req)
+}
+
+func (c *Client) guard(ctx context.Context, path string, req *GuardRequest) (*GuardResponse, error) {
+	body := *req
+	if body.RequestID == "" {
+		body.RequestID = uuid.New().String()
+	}
+	body.Stream = false
+
+	data, err := c.send(ctx, http.MethodPost, path, nil, &body)
+	var apiErr *APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode < 500) {
+		return nil, err
+	}
+
+	// Refused requests come back with an error status and a full response
+	var allowed struct {
+		Allowed *bool `json:"allowed"`
+	}
+	if json.Unmarshal(data, &allowed) != nil || allowed.Allowed == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("goguard: unreadable guard response")
+	}
+	var resp GuardResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("goguard: unreadable guard response: %w", err)
+	}
+	return &resp, nil
+}
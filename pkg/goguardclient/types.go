@@ -0,0 +1,95 @@
+package goguardclient
+
+import "github.com/epps11/goguard/internal/models"
+
+// The request and response types are those of the server, so the client
+// can't drift from the API it calls.
+
+// Data plane
+type (
+	GuardRequest     = models.GuardRequest
+	GuardOptions     = models.GuardOptions
+	GuardResponse    = models.GuardResponse
+	Message          = models.Message
+	ContentPart      = models.ContentPart
+	ImageURL         = models.ImageURL
+	Tool             = models.Tool
+	ToolFunction     = models.ToolFunction
+	ToolCall         = models.ToolCall
+	ToolCallFunction = models.ToolCallFunction
+	ProcessedInput   = models.ProcessedInput
+	LLMResponse      = models.LLMResponse
+	Usage            = models.Usage
+	SecurityReport   = models.SecurityReport
+	Detection        = models.Detection
+	PIIReport        = models.PIIReport
+	PIIMatch         = models.PIIMatch
+	SecretsReport    = models.SecretsReport
+	SecretFinding    = models.SecretFinding
+	ImageReport      = models.ImageReport
+	ModerationReport = models.ModerationReport
+	TopicReport      = models.TopicReport
+)
+
+// Policies
+type (
+	Policy          = models.Policy
+	PolicyType      = models.PolicyType
+	PolicyStatus    = models.PolicyStatus
+	PolicyConfig    = models.PolicyConfig
+	PolicyRule      = models.PolicyRule
+	PolicyTargets   = models.PolicyTargets
+	PolicyActions   = models.PolicyActions
+	PolicyVersion   = models.PolicyVersion
+	RuleType        = models.RuleType
+	RuleOperator    = models.RuleOperator
+	RuleCondition   = models.RuleCondition
+	ActionType      = models.ActionType
+	Topic           = models.Topic
+	PolicyFieldDiff = models.PolicyFieldDiff
+)
+
+const (
+	PolicyTypeSpending   = models.PolicyTypeSpending
+	PolicyTypeRateLimit  = models.PolicyTypeRateLimit
+	PolicyTypeContent    = models.PolicyTypeContent
+	PolicyTypeAccess     = models.PolicyTypeAccess
+	PolicyTypeCompliance = models.PolicyTypeCompliance
+	PolicyTypeTopic      = models.PolicyTypeTopic
+
+	PolicyStatusActive   = models.PolicyStatusActive
+	PolicyStatusInactive = models.PolicyStatusInactive
+	PolicyStatusDraft    = models.PolicyStatusDraft
+
+	ActionAllow    = models.ActionAllow
+	ActionDeny     = models.ActionDeny
+	ActionWarn     = models.ActionWarn
+	ActionAudit    = models.ActionAudit
+	ActionThrottle = models.ActionThrottle
+)
+
+// Spending limits
+type SpendingLimit = models.SpendingLimit
+
+// Audit logs
+type (
+	AuditLog         = models.AuditLog
+	AuditEventType   = models.AuditEventType
+	AuditStatus      = models.AuditStatus
+	PolicyEvaluation = models.PolicyEvaluation
+)
+
+const (
+	EventTypeRequest       = models.EventTypeRequest
+	EventTypePolicyChange  = models.EventTypePolicyChange
+	EventTypeUserAction    = models.EventTypeUserAction
+	EventTypeSystemEvent   = models.EventTypeSystemEvent
+	EventTypeSecurityAlert = models.EventTypeSecurityAlert
+	EventTypeSpendingAlert = models.EventTypeSpendingAlert
+	EventTypeAnomaly       = models.EventTypeAnomaly
+
+	AuditStatusSuccess = models.AuditStatusSuccess
+	AuditStatusFailure = models.AuditStatusFailure
+	AuditStatusBlocked = models.AuditStatusBlocked
+	AuditStatusWarning = models.AuditStatusWarning
+)
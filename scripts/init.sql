@@ -1,5 +1,31 @@
 -- GoGuard Database Schema
 
+-- Schema version, checked by goguard doctor. Bump it (and
+-- database.CurrentSchemaVersion) with every schema change.
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    applied_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+INSERT INTO schema_version (version) VALUES (1), (2), (3), (4), (5), (6), (7), (8), (9), (10), (11), (12), (13), (14) ON CONFLICT (version) DO NOTHING;
+
+-- Tenants (organizations) sharing the deployment; everything else belongs
+-- to one of them through its tenant_id
+CREATE TABLE IF NOT EXISTS tenants (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    status VARCHAR(50) NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT valid_tenant_status CHECK (status IN ('active', 'suspended'))
+);
+
+INSERT INTO tenants (id, name, description) VALUES
+    ('default', 'Default', 'Owns everything not assigned to another tenant')
+ON CONFLICT (id) DO NOTHING;
+
 -- Users table with RBAC
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -17,6 +43,19 @@ CREATE TABLE IF NOT EXISTS users (
     CONSTRAINT valid_status CHECK (status IN ('active', 'inactive', 'suspended'))
 );
 
+-- Groups of users, e.g. provisioned through SCIM (schema version 6). Users
+-- belong to the groups their groups column names.
+CREATE TABLE IF NOT EXISTS groups (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT unique_group_name UNIQUE (tenant_id, name)
+);
+
 -- Policies table
 CREATE TABLE IF NOT EXISTS policies (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -33,10 +72,53 @@ CREATE TABLE IF NOT EXISTS policies (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     created_by UUID REFERENCES users(id),
 
-    CONSTRAINT valid_policy_type CHECK (type IN ('spending', 'rate_limit', 'content', 'access', 'compliance')),
+    CONSTRAINT valid_policy_type CHECK (type IN ('spending', 'rate_limit', 'content', 'access', 'compliance', 'topic', 'routing')),
     CONSTRAINT valid_policy_status CHECK (status IN ('active', 'inactive', 'draft'))
 );
 
+-- Schema version 2 added topic policies, version 5 routing policies
+ALTER TABLE policies DROP CONSTRAINT IF EXISTS valid_policy_type;
+ALTER TABLE policies ADD CONSTRAINT valid_policy_type
+    CHECK (type IN ('spending', 'rate_limit', 'content', 'access', 'compliance', 'topic', 'routing'));
+
+-- Policy versions table (immutable history of every policy change)
+CREATE TABLE IF NOT EXISTS policy_versions (
+    policy_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    change_type VARCHAR(50) NOT NULL,
+    changed_by VARCHAR(255),
+    changes JSONB DEFAULT '[]',
+    policy JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    PRIMARY KEY (policy_id, version),
+    CONSTRAINT valid_change_type CHECK (change_type IN ('create', 'update', 'rollback', 'delete', 'restore'))
+);
+
+-- Schema version 12 soft-deleted policies and users: they are kept, with
+-- who deleted them and why, until restored
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS delete_reason TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS delete_reason TEXT;
+ALTER TABLE policy_versions DROP CONSTRAINT IF EXISTS valid_change_type;
+ALTER TABLE policy_versions ADD CONSTRAINT valid_change_type
+    CHECK (change_type IN ('create', 'update', 'rollback', 'delete', 'restore'));
+
+-- Request quota counters (one row per policy, user and window length)
+CREATE TABLE IF NOT EXISTS quota_counters (
+    policy_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    period VARCHAR(10) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (policy_id, user_id, period),
+    CONSTRAINT valid_quota_period CHECK (period IN ('minute', 'hour', 'day'))
+);
+
 -- Spending limits table
 CREATE TABLE IF NOT EXISTS spending_limits (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -53,6 +135,123 @@ CREATE TABLE IF NOT EXISTS spending_limits (
     CONSTRAINT valid_limit_type CHECK (limit_type IN ('daily', 'weekly', 'monthly'))
 );
 
+-- Budgets cap the combined spend of a group, a project tag or all requests
+CREATE TABLE IF NOT EXISTS budgets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    scope VARCHAR(50) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    period VARCHAR(50) NOT NULL,
+    limit_amount DECIMAL(12, 6) NOT NULL,
+    current_spend DECIMAL(12, 6) NOT NULL DEFAULT 0,
+    currency VARCHAR(10) NOT NULL DEFAULT 'USD',
+    alert_at INTEGER NOT NULL DEFAULT 80,
+    enforce BOOLEAN NOT NULL DEFAULT false,
+    reset_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT valid_budget_scope CHECK (scope IN ('group', 'project', 'global')),
+    CONSTRAINT valid_budget_period CHECK (period IN ('daily', 'weekly', 'monthly'))
+);
+
+-- Schema version 3 added global budgets
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS valid_budget_scope;
+ALTER TABLE budgets ADD CONSTRAINT valid_budget_scope
+    CHECK (scope IN ('group', 'project', 'global'));
+
+-- Model prices overriding the built-in table, per million tokens
+CREATE TABLE IF NOT EXISTS model_prices (
+    model VARCHAR(255) PRIMARY KEY,
+    provider VARCHAR(100),
+    input_per_million DECIMAL(14, 6) NOT NULL,
+    output_per_million DECIMAL(14, 6) NOT NULL,
+    currency VARCHAR(10) NOT NULL DEFAULT 'USD',
+    source VARCHAR(20) NOT NULL DEFAULT 'manual',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT valid_price_source CHECK (source IN ('manual', 'feed'))
+);
+
+-- One row per LLM call; never updated, so spend can be reconciled and
+-- limits, budgets and reports derived from it
+CREATE TABLE IF NOT EXISTS usage_records (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    request_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    project VARCHAR(255),
+    team VARCHAR(255),
+    provider VARCHAR(100),
+    model VARCHAR(255) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    cost DECIMAL(12, 6) NOT NULL,
+    currency VARCHAR(10) NOT NULL DEFAULT 'USD',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- API keys for control plane access (only the key hash is stored)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    key_prefix VARCHAR(32) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id VARCHAR(255),
+    role VARCHAR(50),
+    permissions TEXT[] DEFAULT '{}',
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Schema version 9 limited API keys to client address ranges
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_cidrs TEXT[] DEFAULT '{}';
+
+-- Schema version 14 gave API keys the LLM profile of their requests
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS llm_profile VARCHAR(100) NOT NULL DEFAULT '';
+
+-- Addresses refused by the network access checks, added through the control
+-- plane or automatically after repeated offenses (schema version 9)
+CREATE TABLE IF NOT EXISTS ip_blocks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    cidr VARCHAR(64) NOT NULL,
+    reason TEXT,
+    automatic BOOLEAN NOT NULL DEFAULT false,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Injection detections dropped for some users or groups, managed through the
+-- control plane (schema version 10)
+CREATE TABLE IF NOT EXISTS detection_suppressions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    pattern_id VARCHAR(64) NOT NULL,
+    users TEXT[] DEFAULT '{}',
+    groups TEXT[] DEFAULT '{}',
+    reason TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- How often each policy triggered per UTC hour, counted from the policy
+-- results of audit logs (schema version 11)
+CREATE TABLE IF NOT EXISTS policy_metrics (
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    policy_id VARCHAR(255) NOT NULL,
+    hour TIMESTAMP WITH TIME ZONE NOT NULL,
+    policy_name VARCHAR(255),
+    trigger_count BIGINT NOT NULL DEFAULT 0,
+    block_count BIGINT NOT NULL DEFAULT 0,
+    warn_count BIGINT NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (tenant_id, policy_id, hour)
+);
+
 -- Audit logs table (partitioned by month for performance)
 CREATE TABLE IF NOT EXISTS audit_logs (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -70,7 +269,7 @@ CREATE TABLE IF NOT EXISTS audit_logs (
     details JSONB DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 
-    CONSTRAINT valid_event_type CHECK (event_type IN ('request', 'security_alert', 'policy_change', 'spending_alert', 'user_action', 'system'))
+    CONSTRAINT valid_event_type CHECK (event_type IN ('request', 'security_alert', 'policy_change', 'spending_alert', 'user_action', 'system', 'system_event', 'anomaly'))
 );
 
 -- Alerts table
@@ -99,6 +298,72 @@ CREATE TABLE IF NOT EXISTS settings (
     updated_by UUID REFERENCES users(id)
 );
 
+-- Captured content table (opt-in prompt/response capture, PII-redacted before storage)
+CREATE TABLE IF NOT EXISTS captured_content (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    request_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255),
+    model VARCHAR(255),
+    policy_id VARCHAR(255),
+    messages JSONB NOT NULL DEFAULT '[]',
+    response TEXT,
+    redaction_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Webhooks and emails sent when policies trigger
+CREATE TABLE IF NOT EXISTS action_deliveries (
+    id UUID PRIMARY KEY,
+    policy_id VARCHAR(255) NOT NULL,
+    policy_name VARCHAR(255),
+    channel VARCHAR(20) NOT NULL,
+    target TEXT NOT NULL,
+    request_id VARCHAR(255),
+    user_id VARCHAR(255),
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT valid_delivery_channel CHECK (channel IN ('webhook', 'email')),
+    CONSTRAINT valid_delivery_status CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+
+-- Long-running control plane operations, claimed by background workers
+CREATE TABLE IF NOT EXISTS jobs (
+    id UUID PRIMARY KEY,
+    type VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    params JSONB,
+    result JSONB,
+    error TEXT,
+    progress INTEGER NOT NULL DEFAULT 0,
+    total INTEGER NOT NULL DEFAULT 0,
+    cancel_requested BOOLEAN NOT NULL DEFAULT false,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    started_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE,
+
+    CONSTRAINT valid_job_status CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled'))
+);
+
+-- Feature flag overrides; flags without a row use their built-in default (off)
+CREATE TABLE IF NOT EXISTS feature_flags (
+    key VARCHAR(100) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    rollout INTEGER NOT NULL DEFAULT 0,
+    tenants TEXT[] DEFAULT '{}',
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    CONSTRAINT valid_flag_rollout CHECK (rollout BETWEEN 0 AND 100)
+);
+
 -- OIDC providers table
 CREATE TABLE IF NOT EXISTS oidc_providers (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -125,7 +390,39 @@ CREATE TABLE IF NOT EXISTS sessions (
     user_agent TEXT
 );
 
+-- Schema version 7 kept dashboard login sessions here, keyed by the hash of
+-- the session cookie. Sessions may belong to users only known to an
+-- identity provider, so user_id no longer references users.
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_user_id_fkey;
+ALTER TABLE sessions ALTER COLUMN user_id TYPE VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS name VARCHAR(255);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS role VARCHAR(50);
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS idle_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- Schema version 8 confined sessions, and the refresh tokens backed by
+-- them, to the tenant they were started in (empty = across tenants)
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64);
+
+-- Schema version 4 scoped entries by tenant
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE policies ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE spending_limits ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+-- Schema version 13 charged usage to the tenant it was made in
+ALTER TABLE usage_records ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
 -- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_policies_tenant_id ON policies(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_spending_limits_tenant_id ON spending_limits(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_tenant_id ON budgets(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_tenant_id_created_at ON audit_logs(tenant_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_records_tenant_id_created_at ON usage_records(tenant_id, created_at);
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
 CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
@@ -133,9 +430,17 @@ CREATE INDEX IF NOT EXISTS idx_users_status ON users(status);
 CREATE INDEX IF NOT EXISTS idx_policies_type ON policies(type);
 CREATE INDEX IF NOT EXISTS idx_policies_status ON policies(status);
 
+CREATE INDEX IF NOT EXISTS idx_quota_counters_user_id ON quota_counters(user_id);
+
 CREATE INDEX IF NOT EXISTS idx_spending_limits_user_id ON spending_limits(user_id);
 CREATE INDEX IF NOT EXISTS idx_spending_limits_type ON spending_limits(limit_type);
 
+CREATE INDEX IF NOT EXISTS idx_usage_records_created_at ON usage_records(created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_records_user_created ON usage_records(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_usage_records_request_id ON usage_records(request_id);
+
+CREATE INDEX IF NOT EXISTS idx_budgets_scope_target ON budgets(scope, target);
+
 CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
 CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id);
 CREATE INDEX IF NOT EXISTS idx_audit_logs_event_type ON audit_logs(event_type);
@@ -146,8 +451,26 @@ CREATE INDEX IF NOT EXISTS idx_alerts_type ON alerts(type);
 CREATE INDEX IF NOT EXISTS idx_alerts_severity ON alerts(severity);
 CREATE INDEX IF NOT EXISTS idx_alerts_acked_at ON alerts(acked_at);
 
+CREATE INDEX IF NOT EXISTS idx_captured_content_request_id ON captured_content(request_id);
+CREATE INDEX IF NOT EXISTS idx_captured_content_user_id ON captured_content(user_id);
+CREATE INDEX IF NOT EXISTS idx_captured_content_expires_at ON captured_content(expires_at);
+
+CREATE INDEX IF NOT EXISTS idx_action_deliveries_created_at ON action_deliveries(created_at);
+CREATE INDEX IF NOT EXISTS idx_action_deliveries_policy_id ON action_deliveries(policy_id);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_created_at ON jobs(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_type ON jobs(type);
+
+CREATE INDEX IF NOT EXISTS idx_ip_blocks_expires_at ON ip_blocks(expires_at);
+
+CREATE INDEX IF NOT EXISTS idx_detection_suppressions_expires_at ON detection_suppressions(expires_at);
+
+CREATE INDEX IF NOT EXISTS idx_policy_metrics_tenant_id_hour ON policy_metrics(tenant_id, hour);
+
 CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions(token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_idle_expires_at ON sessions(idle_expires_at);
 
 -- Insert default settings
 INSERT INTO settings (key, value, description) VALUES